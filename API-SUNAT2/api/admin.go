@@ -0,0 +1,1087 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	. "API-SUNAT2/util"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	service     *UBLConverterService
+	compression *CompressionMetrics
+}
+
+func NewAdminController(service *UBLConverterService) *AdminController {
+	return &AdminController{service: service, compression: NewCompressionMetrics()}
+}
+
+// RuntimeStats retorna estadísticas del runtime de Go y documentos en proceso
+func (ctrl *AdminController) RuntimeStats(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	// Últimas pausas de GC, de la más reciente a la más antigua
+	var pauses []int64
+	for i := uint32(0); i < mem.NumGC && i < 10; i++ {
+		idx := (mem.NumGC - 1 - i) % uint32(len(mem.PauseNs))
+		pauses = append(pauses, int64(mem.PauseNs[idx]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp":           time.Now().Format(time.RFC3339),
+		"goroutines":          runtime.NumGoroutine(),
+		"heapAllocBytes":      mem.HeapAlloc,
+		"heapInuseBytes":      mem.HeapInuse,
+		"heapObjects":         mem.HeapObjects,
+		"gcCount":             mem.NumGC,
+		"gcPauseTotalNs":      mem.PauseTotalNs,
+		"gcRecentPausesNs":    pauses,
+		"documentsInProgress": ctrl.service.GetInFlightCount(),
+	})
+}
+
+// XMLSizeReport retorna los percentiles de tamaño de los XML generados por emisor; con
+// ?environment= los de los XML enviados a ese ambiente
+func (ctrl *AdminController) XMLSizeReport(c *gin.Context) {
+	environment := c.Query("environment")
+	if environment != "" && environment != EnvironmentMock && !IsValidEnvironment(environment) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_ENVIRONMENT",
+			ErrorMessage: "Environment must be beta, produccion, homologacion or mock",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	report, err := ctrl.service.XMLSizeReport(environment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	data := map[string]interface{}{"issuers": report}
+	if environment != "" {
+		data["environment"] = environment
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data:        data,
+	})
+}
+
+// EngineVersionReport cuenta los documentos por versión del convertidor y hash de
+// reglas, filtrable con ?ruc=&engineVersion=&rulesHash=
+func (ctrl *AdminController) EngineVersionReport(c *gin.Context) {
+	report, err := ctrl.service.EngineVersionReport(c.Query("ruc"), c.Query("engineVersion"), c.Query("rulesHash"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"report": report,
+		},
+	})
+}
+
+// ValidationReport retorna el ranking de reglas de validación falladas, filtrable con
+// ?ruc=&from=&to=. Una API key de emisor debe indicar uno de sus RUC.
+func (ctrl *AdminController) ValidationReport(c *gin.Context) {
+	ruc := c.Query("ruc")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	report, err := ctrl.service.ValidationReport(ruc, c.Query("from"), c.Query("to"))
+	var rangeErr *ErrInvalidReportRange
+	switch {
+	case errors.As(err, &rangeErr):
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_DATE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: fmt.Sprintf("Could not read validation statistics: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"validation": report,
+		},
+	})
+}
+
+// ZIPIntegrityReport compara los ZIP del store con los hashes registrados al generarlos
+// y al enviarlos a SUNAT; ?documentId= lo limita a un documento
+func (ctrl *AdminController) ZIPIntegrityReport(c *gin.Context) {
+	report, err := ctrl.service.CheckZIPIntegrity(c.Query("documentId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"report": report,
+		},
+	})
+}
+
+// EndOfDayReport retorna los comprobantes emitidos en ?date= (hoy en Lima por defecto)
+// que siguen sin enviarse, por emisor; ?ruc= lo limita a un emisor e ?includeTest=true
+// revisa también los documentos de prueba
+func (ctrl *AdminController) EndOfDayReport(c *gin.Context) {
+	ruc := c.Query("ruc")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	report, err := ctrl.service.EndOfDayReport(ruc, c.Query("date"), c.Query("includeTest") == "true")
+	ctrl.renderEndOfDay(c, report, err)
+}
+
+// CloseDay ejecuta el cierre diario de ?date= bajo demanda, con sus notificaciones
+func (ctrl *AdminController) CloseDay(c *gin.Context) {
+	report, err := ctrl.service.CloseDay(c.Request.Context(), c.Query("date"))
+	if err == ErrEndOfDayRunning {
+		c.JSON(http.StatusConflict, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_END_OF_DAY_RUNNING",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	ctrl.renderEndOfDay(c, report, err)
+}
+
+func (ctrl *AdminController) renderEndOfDay(c *gin.Context, report *EndOfDayReport, err error) {
+	var rangeErr *ErrInvalidReportRange
+	switch {
+	case errors.As(err, &rangeErr):
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_DATE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: fmt.Sprintf("Could not build the end-of-day report: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"endOfDay": report,
+		},
+	})
+}
+
+// HTTPLatencyReport retorna la latencia de las salidas HTTP por destino
+func (ctrl *AdminController) HTTPLatencyReport(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"destinations": ctrl.service.GetHTTPPool().Metrics().Report(),
+		},
+	})
+}
+
+// IssuerStatus consulta bajo demanda el estado de un RUC en el padrón
+func (ctrl *AdminController) IssuerStatus(c *gin.Context) {
+	padron := ctrl.service.GetPadronClient()
+	if padron == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_PADRON_NOT_CONFIGURED",
+			ErrorMessage: "Padron client is not configured",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	status, err := padron.Lookup(c.Param("ruc"))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_PADRON_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"ruc":         status.RUC,
+			"name":        status.Name,
+			"state":       status.State,
+			"condition":   status.Condition,
+			"operational": status.IsOperational(),
+		},
+	})
+}
+
+// UnitMappings retorna el mapeo de unidades del emisor
+func (ctrl *AdminController) UnitMappings(c *gin.Context) {
+	ruc := c.Param("ruc")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"ruc":      ruc,
+			"mappings": ctrl.service.UnitMappings(ruc),
+		},
+	})
+}
+
+// SetUnitMappings reemplaza el mapeo de unidades del emisor con el cuerpo
+// {"mappings": {"CAJ": "BX", "PAQ": "PK"}}; el pipeline lo aplica antes de validar
+func (ctrl *AdminController) SetUnitMappings(c *gin.Context) {
+	ruc := c.Param("ruc")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	var request struct {
+		Mappings map[string]string `json:"mappings" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	set, err := ctrl.service.SetUnitMappings(ruc, request.Mappings)
+	if err != nil {
+		var mappingErr *ErrInvalidUnitMapping
+		if errors.As(err, &mappingErr) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Status:       "error",
+				ErrorCode:    "ERR_INVALID_UNIT_MAPPING",
+				ErrorMessage: err.Error(),
+				ProcessedAt:  time.Now(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"unitMappings": set,
+		},
+	})
+}
+
+// AccountingAccounts retorna las cuentas contables vigentes del emisor por concepto
+func (ctrl *AdminController) AccountingAccounts(c *gin.Context) {
+	ruc := c.Param("ruc")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"ruc":      ruc,
+			"accounts": ctrl.service.AccountingAccounts(ruc),
+		},
+	})
+}
+
+// SetAccountingAccounts reemplaza las cuentas contables del emisor con el cuerpo
+// {"accounts": {"receivable": "1213", "1000": "40111"}}; las claves son conceptos del
+// asiento o códigos de tributo
+func (ctrl *AdminController) SetAccountingAccounts(c *gin.Context) {
+	ruc := c.Param("ruc")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	var request struct {
+		Accounts map[string]string `json:"accounts" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	set, err := ctrl.service.SetAccountingAccounts(ruc, request.Accounts)
+	if err != nil {
+		var accountErr *ErrInvalidAccountingAccount
+		if errors.As(err, &accountErr) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Status:       "error",
+				ErrorCode:    "ERR_INVALID_ACCOUNTING_ACCOUNT",
+				ErrorMessage: err.Error(),
+				ProcessedAt:  time.Now(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"accountingAccounts": set,
+		},
+	})
+}
+
+// DocumentAccounting retorna el asiento del documento derivado de su XML emitido, con
+// las divergencias respecto del desglose calculado en la emisión
+func (ctrl *AdminController) DocumentAccounting(c *gin.Context) {
+	documentID := CanonicalDocumentID(c.Param("documentId"))
+	ruc, _, _ := strings.Cut(documentID, "-")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	entry, err := ctrl.service.DocumentAccounting(documentID)
+	if err != nil {
+		status, code := http.StatusInternalServerError, "ERR_INVALID_DOCUMENT_XML"
+		if errors.Is(err, ErrDocumentNotFound) {
+			status, code = http.StatusNotFound, "ERR_DOCUMENT_NOT_FOUND"
+		}
+		c.JSON(status, APIResponse{
+			Status:       "error",
+			ErrorCode:    code,
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		DocumentID:  documentID,
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"accounting": entry,
+		},
+	})
+}
+
+// DocumentDefaults retorna la plantilla de documentos del emisor
+func (ctrl *AdminController) DocumentDefaults(c *gin.Context) {
+	ruc := c.Param("ruc")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"ruc":      ruc,
+			"defaults": ctrl.service.DocumentTemplateDefaults(ruc),
+		},
+	})
+}
+
+// SetDocumentDefaults reemplaza la plantilla de documentos del emisor con el cuerpo
+// {"defaults": {"currency": "PEN", "issuer": {...}}}; el pipeline la aplica por debajo
+// de cada documento del emisor
+func (ctrl *AdminController) SetDocumentDefaults(c *gin.Context) {
+	ruc := c.Param("ruc")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	var request struct {
+		Defaults map[string]interface{} `json:"defaults" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	template, err := ctrl.service.SetDocumentTemplate(ruc, request.Defaults)
+	if err != nil {
+		var templateErr *ErrInvalidDocumentTemplate
+		if errors.As(err, &templateErr) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Status:       "error",
+				ErrorCode:    "ERR_INVALID_DOCUMENT_TEMPLATE",
+				ErrorMessage: err.Error(),
+				ProcessedAt:  time.Now(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"template": template,
+		},
+	})
+}
+
+// Advances lista las facturas de anticipo con su saldo pendiente; ?ruc= las limita a un
+// emisor y ?customer= a un cliente
+func (ctrl *AdminController) Advances(c *gin.Context) {
+	ruc := c.Query("ruc")
+	if !ctrl.issuerAllowed(c, ruc) {
+		return
+	}
+	advances, err := ctrl.service.AdvanceBalances(ruc, c.Query("customer"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"advances": advances,
+		},
+	})
+}
+
+// issuerAllowed responde 403 si la API key del request no está autorizada para el RUC
+func (ctrl *AdminController) issuerAllowed(c *gin.Context, ruc string) bool {
+	if IssuerAllowed(c, ruc) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, APIResponse{
+		Status:       "error",
+		ErrorCode:    "ERR_FORBIDDEN",
+		ErrorMessage: "The API key is not authorized for RUC " + ruc,
+		ProcessedAt:  time.Now(),
+	})
+	return false
+}
+
+// Submissions lista los envíos a SUNAT registrados, filtrables con ?environment= y
+// ?engineVersion= (versión del convertidor que generó el documento)
+func (ctrl *AdminController) Submissions(c *gin.Context) {
+	environment := c.Query("environment")
+	if environment != "" && environment != EnvironmentMock && !IsValidEnvironment(environment) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_ENVIRONMENT",
+			ErrorMessage: "Environment must be beta, produccion, homologacion or mock",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	records, err := ctrl.service.ListSubmissions(environment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	if engineVersion := c.Query("engineVersion"); engineVersion != "" {
+		records = ctrl.service.FilterSubmissionsByEngine(records, engineVersion)
+	}
+
+	byEnvironment := make(map[string]int)
+	for _, record := range records {
+		byEnvironment[record.Environment]++
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"submissions":   records,
+			"byEnvironment": byEnvironment,
+		},
+	})
+}
+
+// Reconcile ejecuta la reconciliación de envíos sin CDR; ?minAge= y ?batchSize=
+// reemplazan la configuración para esta ejecución
+func (ctrl *AdminController) Reconcile(c *gin.Context) {
+	opts := ctrl.service.GetReconcileOptions()
+	if value := c.Query("minAge"); value != "" {
+		minAge, err := time.ParseDuration(value)
+		if err != nil || minAge < 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Status:       "error",
+				ErrorCode:    "ERR_INVALID_MIN_AGE",
+				ErrorMessage: "minAge must be a duration such as 2h or 30m",
+				ProcessedAt:  time.Now(),
+			})
+			return
+		}
+		opts.MinAge = minAge
+	}
+	if value := c.Query("batchSize"); value != "" {
+		batchSize, err := strconv.Atoi(value)
+		if err != nil || batchSize <= 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Status:       "error",
+				ErrorCode:    "ERR_INVALID_BATCH_SIZE",
+				ErrorMessage: "batchSize must be a positive integer",
+				ProcessedAt:  time.Now(),
+			})
+			return
+		}
+		opts.BatchSize = batchSize
+	}
+
+	report, err := ctrl.service.ReconcileSubmissions(c.Request.Context(), opts)
+	if err == ErrReconcileRunning {
+		c.JSON(http.StatusConflict, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_RECONCILE_RUNNING",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"reconciliation": report,
+		},
+	})
+}
+
+// Logs retorna en orden las entradas de log de una operación, indicada con ?correlationId=
+func (ctrl *AdminController) Logs(c *gin.Context) {
+	correlationID := c.Query("correlationId")
+	if correlationID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_MISSING_CORRELATION_ID",
+			ErrorMessage: "correlationId query parameter is required",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	entries, err := ctrl.service.GetLogService().GetEntries(correlationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_LOGS_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_LOGS_NOT_FOUND",
+			ErrorMessage: "No log entries found for correlationId " + correlationID,
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"correlationId": correlationID,
+			"entries":       entries,
+		},
+	})
+}
+
+// ExpiringCertificates lista los certificados registrados que vencen dentro de ?days=
+// días (30 por defecto), incluidos los ya vencidos
+func (ctrl *AdminController) ExpiringCertificates(c *gin.Context) {
+	days := CertificateAlertThresholds[0]
+	if value := c.Query("days"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Status:       "error",
+				ErrorCode:    "ERR_INVALID_DAYS",
+				ErrorMessage: "days must be a non-negative integer",
+				ProcessedAt:  time.Now(),
+			})
+			return
+		}
+	}
+
+	certificates, err := ctrl.service.ExpiringCertificates(days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"days":         days,
+			"certificates": certificates,
+		},
+	})
+}
+
+// SOAPTrace retorna las peticiones y respuestas SOAP crudas de los envíos del documento
+// que siguen dentro de la retención, con las credenciales redactadas
+func (ctrl *AdminController) SOAPTrace(c *gin.Context) {
+	documentID := CanonicalDocumentID(c.Param("documentId"))
+	traces, err := ctrl.service.SOAPTraces(documentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	if len(traces) == 0 {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_DOCUMENT_NOT_FOUND",
+			ErrorMessage: "No SOAP trace stored for document " + documentID,
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		DocumentID:  documentID,
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"traces": traces,
+		},
+	})
+}
+
+// RegisterCertificate registra el certificado de un emisor para un ambiente. En
+// producción rechaza los certificados autofirmados o de CAs no acreditadas con 422
+// ERR_CERT_NOT_ACCEPTED_IN_PROD, antes del primer envío a SUNAT; en los demás ambientes
+// los registra con una advertencia.
+func (ctrl *AdminController) RegisterCertificate(c *gin.Context) {
+	var request CertificateRegistrationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	if !IsValidEnvironment(request.Environment) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_ENVIRONMENT",
+			ErrorMessage: fmt.Sprintf("Invalid environment: %s", request.Environment),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	certPEM, err := base64.StdEncoding.DecodeString(request.Certificate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_CERTIFICATE",
+			ErrorMessage: "Invalid certificate format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	record, warning, err := ctrl.service.RegisterEnvironmentCertificate(request.RUC, certPEM, request.Environment)
+	if err != nil {
+		var keyErr *KeyValidationError
+		if errors.As(err, &keyErr) {
+			c.JSON(http.StatusUnprocessableEntity, APIResponse{
+				Status:       "error",
+				ErrorCode:    keyErr.Code,
+				ErrorMessage: keyErr.Message,
+				ProcessedAt:  time.Now(),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_CERTIFICATE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	resp := APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"certificate": record,
+		},
+	}
+	if warning != "" {
+		resp.Warnings = []ValidationError{{
+			Field:    "certificate",
+			Expected: "Certificate from an accredited CA",
+			Received: warning,
+			Rule:     "certificate_not_accepted_in_production",
+			Message:  "Certificate would be rejected in production",
+		}}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Homologation genera el set de casos de prueba de homologación para el RUC indicado,
+// lo procesa y opcionalmente lo envía al ambiente beta; retorna el resultado de cada caso
+func (ctrl *AdminController) Homologation(c *gin.Context) {
+	var request HomologationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	certPEM, err := base64.StdEncoding.DecodeString(request.Certificate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_CERTIFICATE",
+			ErrorMessage: "Invalid certificate format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	keyPEM, err := base64.StdEncoding.DecodeString(request.PrivateKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_PRIVATE_KEY",
+			ErrorMessage: "Invalid private key format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	report, err := ctrl.service.RunHomologation(c.Request.Context(), request, certPEM, keyPEM)
+	ZeroBytes(keyPEM)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"homologation": report,
+		},
+	})
+}
+
+// Metrics expone las métricas del servicio en formato de texto de Prometheus
+func (ctrl *AdminController) Metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	ctrl.service.WriteCertificateMetrics(c.Writer)
+	ctrl.service.WriteEventMetrics(c.Writer)
+	ctrl.service.WriteClockSkewMetrics(c.Writer)
+	ctrl.service.WriteValidationStatsMetrics(c.Writer)
+	ctrl.service.WriteHookMetrics(c.Writer)
+	ctrl.compression.WriteMetrics(c.Writer)
+}
+
+// DefaultQueueItemsLimit es la cantidad de elementos por cola que lista /admin/queues
+const DefaultQueueItemsLimit = 50
+
+// Queues retorna el estado de las colas en memoria con una página de sus elementos;
+// ?offset= y ?limit= paginan los elementos de cada cola
+func (ctrl *AdminController) Queues(c *gin.Context) {
+	offset, limit := 0, DefaultQueueItemsLimit
+	for param, target := range map[string]*int{"offset": &offset, "limit": &limit} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || (param == "limit" && parsed == 0) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Status:       "error",
+				ErrorCode:    "ERR_INVALID_PAGINATION",
+				ErrorMessage: "offset must be a non-negative integer and limit a positive integer",
+				ProcessedAt:  time.Now(),
+			})
+			return
+		}
+		*target = parsed
+	}
+
+	queues := []QueueDetail{}
+	for _, queue := range ctrl.service.Queues() {
+		queues = append(queues, QueueDetail{QueueStats: queue.Stats(), Items: queue.Items(offset, limit)})
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"queues": queues,
+		},
+	})
+}
+
+// PauseQueue deja de tomar elementos de la cola; el que está en proceso termina
+func (ctrl *AdminController) PauseQueue(c *gin.Context) {
+	ctrl.queueAction(c, func(queue Queue) error {
+		queue.Pause()
+		return nil
+	})
+}
+
+// ResumeQueue reanuda una cola pausada
+func (ctrl *AdminController) ResumeQueue(c *gin.Context) {
+	ctrl.queueAction(c, func(queue Queue) error {
+		queue.Resume()
+		return nil
+	})
+}
+
+// DrainQueue procesa los pendientes de la cola, aunque esté pausada, y responde cuando
+// quedó vacía
+func (ctrl *AdminController) DrainQueue(c *gin.Context) {
+	ctrl.queueAction(c, func(queue Queue) error {
+		return queue.Drain(c.Request.Context())
+	})
+}
+
+// queueAction aplica la acción a la cola de :name y responde con su estado
+func (ctrl *AdminController) queueAction(c *gin.Context, action func(Queue) error) {
+	queue, ok := ctrl.service.Queue(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_QUEUE_NOT_FOUND",
+			ErrorMessage: fmt.Sprintf("Queue %q does not exist or is not enabled", c.Param("name")),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	if err := action(queue); err != nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_QUEUE_DRAIN_CANCELLED",
+			ErrorMessage: fmt.Sprintf("Queue was not drained: %v", err),
+			ProcessedAt:  time.Now(),
+			Data: map[string]interface{}{
+				"queue": queue.Stats(),
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"queue": queue.Stats(),
+		},
+	})
+}
+
+// registerPprofRoutes monta los handlers de net/http/pprof bajo /debug/pprof
+func registerPprofRoutes(group *gin.RouterGroup) {
+	group.Any("/*name", func(c *gin.Context) {
+		switch c.Param("name") {
+		case "/cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "/profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "/symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "/trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			pprof.Index(c.Writer, c.Request)
+		}
+	})
+}
+
+// Purge elimina o anonimiza los datos personales de los documentos que cumplen el
+// filtro (derecho de supresión). Los documentos dentro del período de conservación
+// legal no se purgan y se listan en retained; con dryRun solo se cuenta.
+func (ctrl *AdminController) Purge(c *gin.Context) {
+	var request PurgeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	report, err := ctrl.service.PurgeDocuments(request)
+	if err != nil {
+		var requestErr *ErrInvalidPurgeRequest
+		if errors.As(err, &requestErr) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Status:       "error",
+				ErrorCode:    "ERR_INVALID_PURGE_REQUEST",
+				ErrorMessage: err.Error(),
+				ProcessedAt:  time.Now(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"purge":          report,
+			"retentionYears": ctrl.service.GetRetentionYears(),
+		},
+	})
+}
+
+// PurgeAudits retorna el registro de auditoría de las purgas realizadas
+func (ctrl *AdminController) PurgeAudits(c *gin.Context) {
+	audits, err := ctrl.service.ListPurgeAudits()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "success",
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"purges": audits,
+		},
+	})
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"github.com/gin-gonic/gin"
+)
+
+// responseContract adapta el APIResponse interno a una versión concreta del API.
+// Los handlers construyen siempre el APIResponse interno y delegan la serialización.
+type responseContract interface {
+	// render escribe la respuesta con el código HTTP indicado
+	render(c *gin.Context, httpStatus int, resp *APIResponse)
+	// processStatus decide el código HTTP para las respuestas del servicio (ProcessDocument, SendDocument)
+	processStatus(resp *APIResponse) int
+}
+
+// V1Response es el contrato congelado de /api/v1. No agregar ni renombrar campos:
+// hay clientes en producción que lo parsean, incluyendo el status en mayúsculas
+// ("SUCCESS"/"ERROR") del servicio y en minúsculas ("success"/"error") de los handlers.
+// Environment solo aparece en los despliegues validate-only, nunca en producción.
+type V1Response struct {
+	Status           string                 `json:"status"`
+	CorrelationID    string                 `json:"correlationId"`
+	DocumentID       string                 `json:"documentId,omitempty"`
+	XMLPath          string                 `json:"xmlPath,omitempty"`
+	XMLHash          string                 `json:"xmlHash,omitempty"`
+	ProcessedAt      time.Time              `json:"processedAt"`
+	Duration         int64                  `json:"duration,omitempty"`
+	ErrorCode        string                 `json:"errorCode,omitempty"`
+	ErrorMessage     string                 `json:"errorMessage,omitempty"`
+	ValidationErrors []ValidationError      `json:"validationErrors,omitempty"`
+	Warnings         []ValidationError      `json:"warnings,omitempty"`
+	Data             map[string]interface{} `json:"data,omitempty"`
+	Message          string                 `json:"message,omitempty"`
+	Environment      string                 `json:"environment,omitempty"`
+}
+
+type v1Contract struct{}
+
+func toV1Response(resp *APIResponse) V1Response {
+	return V1Response{
+		Status:           resp.Status,
+		CorrelationID:    resp.CorrelationID,
+		DocumentID:       resp.DocumentID,
+		XMLPath:          resp.XMLPath,
+		XMLHash:          resp.XMLHash,
+		ProcessedAt:      resp.ProcessedAt,
+		Duration:         resp.Duration,
+		ErrorCode:        resp.ErrorCode,
+		ErrorMessage:     resp.ErrorMessage,
+		ValidationErrors: resp.ValidationErrors,
+		Warnings:         resp.Warnings,
+		Data:             resp.Data,
+		Message:          resp.Message,
+		Environment:      resp.Environment,
+	}
+}
+
+// render responde con el contrato de v1. Los errores que v1 devuelve con HTTP 200 toman
+// el código HTTP de v2 si el request negoció Problem Details, que exige un status de error.
+func (v1Contract) render(c *gin.Context, httpStatus int, resp *APIResponse) {
+	if httpStatus < http.StatusBadRequest && !strings.EqualFold(resp.Status, V2StatusSuccess) && wantsProblem(c) {
+		httpStatus = v2Contract{}.processStatus(resp)
+	}
+	c.JSON(httpStatus, toV1Response(resp))
+}
+
+// processStatus conserva el comportamiento histórico de v1: el servicio responde
+// "ERROR" en mayúsculas, por lo que sus errores se devuelven con HTTP 200, también los
+// de validación salvo que el controlador unifique las respuestas de validación.
+func (v1Contract) processStatus(resp *APIResponse) int {
+	if resp.Status == "error" {
+		return http.StatusBadRequest
+	}
+	return http.StatusOK
+}
+
+// Valores posibles del status en v2
+const (
+	V2StatusSuccess = "success"
+	V2StatusError   = "error"
+)
+
+// V2Response es el contrato de /api/v2: status tipado en minúsculas, errores
+// agrupados en un objeto y tiempos por etapa del pipeline
+type V2Response struct {
+	Status        string                 `json:"status"`
+	CorrelationID string                 `json:"correlationId,omitempty"`
+	ProcessedAt   time.Time              `json:"processedAt"`
+	Document      *V2Document            `json:"document,omitempty"`
+	Error         *V2Error               `json:"error,omitempty"`
+	Warnings      []ValidationError      `json:"warnings,omitempty"`
+	Timings       *V2Timings             `json:"timings,omitempty"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+	Environment   string                 `json:"environment,omitempty"`
+}
+
+type V2Document struct {
+	ID      string `json:"id"`
+	XMLPath string `json:"xmlPath"`
+	XMLHash string `json:"xmlHash"`
+}
+
+type V2Error struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details []ValidationError `json:"details,omitempty"`
+}
+
+type V2Timings struct {
+	TotalMs int64              `json:"totalMs"`
+	Stages  map[string]float64 `json:"stages,omitempty"`
+}
+
+type v2Contract struct{}
+
+func toV2Response(resp *APIResponse) V2Response {
+	out := V2Response{
+		Status:        V2StatusSuccess,
+		CorrelationID: resp.CorrelationID,
+		ProcessedAt:   resp.ProcessedAt,
+		Warnings:      resp.Warnings,
+		Data:          resp.Data,
+		Environment:   resp.Environment,
+	}
+
+	if !strings.EqualFold(resp.Status, V2StatusSuccess) {
+		out.Status = V2StatusError
+		out.Error = &V2Error{
+			Code:    resp.ErrorCode,
+			Message: resp.ErrorMessage,
+			Details: resp.ValidationErrors,
+		}
+	}
+
+	if resp.DocumentID != "" {
+		out.Document = &V2Document{
+			ID:      resp.DocumentID,
+			XMLPath: resp.XMLPath,
+			XMLHash: resp.XMLHash,
+		}
+	}
+
+	if resp.Timings != nil {
+		out.Timings = &V2Timings{
+			TotalMs: resp.Duration,
+			Stages:  resp.Timings,
+		}
+	}
+
+	return out
+}
+
+func (v2Contract) render(c *gin.Context, httpStatus int, resp *APIResponse) {
+	c.JSON(httpStatus, toV2Response(resp))
+}
+
+// StatusClientClosedRequest es el código (no estándar) de una operación cancelada
+// porque el cliente cerró la conexión
+const StatusClientClosedRequest = 499
+
+// processStatus mapea el código de error del servicio a un código HTTP; el de los
+// errores de validación lo configura el controlador (VALIDATION_ERROR_STATUS)
+func (v2Contract) processStatus(resp *APIResponse) int {
+	if strings.EqualFold(resp.Status, V2StatusSuccess) {
+		return http.StatusOK
+	}
+
+	switch resp.ErrorCode {
+	case ValidationFailedCode, "ERR_ISSUER_STATUS", "ERR_SUNAT_CREDENTIALS", "ERR_XML_ENCODING", ErrCertNotAcceptedInProdCode, BatchFailedCode, ErrHookAbortedCode:
+		return http.StatusUnprocessableEntity
+	case "ERR_INVALID_DOCUMENT_ID", "ERR_INVALID_ENVIRONMENT", "ERR_INVALID_RUC", "ERR_INVALID_DATE", "ERR_INVALID_CORRELATION_ID", "ERR_INVALID_INTEREST_REQUEST",
+		"ERR_INVALID_REVERSION":
+		return http.StatusBadRequest
+	case "ERR_DOCUMENT_NOT_FOUND", "ERR_CORRELATION_NOT_FOUND":
+		return http.StatusNotFound
+	case ErrTestDocumentProdCode, "ERR_SUMMARY_EMPTY", "ERR_NOT_SUMMARIZED", ErrValidateOnlyCode,
+		"ERR_NOT_AN_INVOICE", "ERR_DOCUMENT_NOT_OVERDUE", "ERR_NO_BALANCE", "ERR_REVERSION_EMPTY", "ERR_ALREADY_REVERTED":
+		return http.StatusConflict
+	case "ERR_SUNAT_NOT_CONFIGURED", ErrClockSkewCode:
+		return http.StatusServiceUnavailable
+	case ErrCancelledCode:
+		return StatusClientClosedRequest
+	case "ERR_DOCUMENT_TOO_LARGE":
+		return http.StatusRequestEntityTooLarge
+	case "ERR_KEY_TOO_SMALL", "ERR_KEY_TYPE_UNSUPPORTED":
+		return http.StatusBadRequest
+	case "ERR_TIMESTAMP_FAILED", "ERR_SUNAT_REJECTED", "ERR_SUNAT_UNAVAILABLE":
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// environmentContract etiqueta todas las respuestas de un contrato con el modo del
+// despliegue, para que QA no confunda sus documentos con los de producción
+type environmentContract struct {
+	responseContract
+	environment string
+}
+
+func (e environmentContract) render(c *gin.Context, httpStatus int, resp *APIResponse) {
+	resp.Environment = e.environment
+	e.responseContract.render(c, httpStatus, resp)
+}
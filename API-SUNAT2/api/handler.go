@@ -2,34 +2,324 @@ package api
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	. "API-SUNAT2/model"
 	. "API-SUNAT2/service"
+	. "API-SUNAT2/util"
+	"API-SUNAT2/version"
 	"github.com/gin-gonic/gin"
 )
 
 type UBLController struct {
-	service *UBLConverterService
+	service          *UBLConverterService
+	contract         responseContract
+	validationStatus int
+	// legacyValidation conserva las respuestas de validación congeladas de v1
+	legacyValidation bool
+	strictParsing    bool
 }
 
+// NewUBLController crea el controlador con el contrato de respuesta de /api/v1
 func NewUBLController(service *UBLConverterService) *UBLController {
-	return &UBLController{service: service}
+	return &UBLController{service: service, contract: v1Contract{}, validationStatus: http.StatusUnprocessableEntity, legacyValidation: true}
+}
+
+// NewUBLControllerV2 crea el controlador con el contrato de respuesta de /api/v2
+func NewUBLControllerV2(service *UBLConverterService) *UBLController {
+	return &UBLController{service: service, contract: v2Contract{}, validationStatus: http.StatusUnprocessableEntity}
+}
+
+// SetValidationStatus configura el código HTTP de los documentos que no pasan la
+// validación, el mismo en /validate y /convert
+func (ctrl *UBLController) SetValidationStatus(status int) {
+	ctrl.validationStatus = status
+}
+
+// SetUnifiedValidation hace que el controlador de v1 responda los documentos inválidos
+// como v2: VALIDATION_FAILED con el código HTTP configurado en /validate y /convert. Sin
+// activarlo v1 conserva su contrato congelado.
+func (ctrl *UBLController) SetUnifiedValidation(unified bool) {
+	ctrl.legacyValidation = !unified
+}
+
+// responseStatus decide el código HTTP de una respuesta del servicio
+func (ctrl *UBLController) responseStatus(resp *APIResponse) int {
+	if resp.ErrorCode == ValidationFailedCode && !ctrl.legacyValidation {
+		return ctrl.validationStatus
+	}
+	return ctrl.contract.processStatus(resp)
+}
+
+// renderServiceResponse responde una respuesta del servicio con su código HTTP
+func (ctrl *UBLController) renderServiceResponse(c *gin.Context, resp *APIResponse) {
+	ctrl.contract.render(c, ctrl.responseStatus(resp), resp)
+}
+
+// renderValidationFailure responde la falla de /validate. El contrato congelado de v1
+// responde los documentos inválidos con ERR_VALIDATION_FAILED y HTTP 400, a diferencia
+// de /convert, que devuelve el error del servicio con HTTP 200.
+func (ctrl *UBLController) renderValidationFailure(c *gin.Context, failure *APIResponse) {
+	if !ctrl.legacyValidation || failure.ErrorCode != ValidationFailedCode {
+		ctrl.contract.render(c, ctrl.responseStatus(failure), failure)
+		return
+	}
+	ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+		Status:           "error",
+		CorrelationID:    failure.CorrelationID,
+		ErrorCode:        "ERR_VALIDATION_FAILED",
+		ErrorMessage:     "Document validation failed",
+		ValidationErrors: failure.ValidationErrors,
+		Warnings:         failure.Warnings,
+		ProcessedAt:      failure.ProcessedAt,
+	})
+}
+
+// SetResponseEnvironment etiqueta todas las respuestas del controlador con el campo
+// environment; vacío no las etiqueta
+func (ctrl *UBLController) SetResponseEnvironment(environment string) {
+	if tagged, ok := ctrl.contract.(environmentContract); ok {
+		ctrl.contract = tagged.responseContract
+	}
+	if environment != "" {
+		ctrl.contract = environmentContract{responseContract: ctrl.contract, environment: environment}
+	}
+}
+
+// SetStrictParsing configura si un campo desconocido en el request se rechaza con
+// ERR_UNKNOWN_FIELD; el query ?strictParsing= lo define por request
+func (ctrl *UBLController) SetStrictParsing(strict bool) {
+	ctrl.strictParsing = strict
+}
+
+// bindRequest decodifica el cuerpo en target con DecodeRequest. Si el request no se
+// puede procesar responde el error y retorna false; si no, retorna los campos ignorados.
+// Los documentos inválidos los responde invalid, que difiere entre /validate y /convert.
+func (ctrl *UBLController) bindRequest(c *gin.Context, schema *JSONSchema, target interface{}, invalid func(*gin.Context, *APIResponse)) ([]ValidationError, bool) {
+	strict := ctrl.strictParsing
+	if value, err := strconv.ParseBool(c.Query("strictParsing")); err == nil {
+		strict = value
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return nil, false
+	}
+
+	ignored, failure := ctrl.service.DecodeRequest(schema, body, target, strict)
+	if failure != nil {
+		if failure.ErrorCode == ValidationFailedCode {
+			invalid(c, failure)
+		} else {
+			ctrl.contract.render(c, http.StatusBadRequest, failure)
+		}
+		return nil, false
+	}
+	return ignored, true
 }
 
 func (ctrl *UBLController) ConvertDocument(c *gin.Context) {
+	var request ConvertRequest
+
+	ignored, ok := ctrl.bindRequest(c, ConvertRequestSchema(), &request, ctrl.renderServiceResponse)
+	if !ok {
+		return
+	}
+
+	certPEM, err := base64.StdEncoding.DecodeString(request.Certificate)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_CERTIFICATE",
+			ErrorMessage: "Invalid certificate format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	keyPEM, err := base64.StdEncoding.DecodeString(request.PrivateKey)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_PRIVATE_KEY",
+			ErrorMessage: "Invalid private key format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	response, err := ctrl.service.ProcessDocument(c.Request.Context(), &request.Document, certPEM, keyPEM)
+	ZeroBytes(keyPEM)
+	if err == nil {
+		if auditErr := ctrl.service.AuditConvertRequest(response.CorrelationID, &request); auditErr != nil {
+			ctrl.service.GetLogger().Warnf("No se pudo guardar la auditoría del request: %v", auditErr)
+		}
+	}
+	if err != nil {
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_PROCESSING_FAILED",
+			ErrorMessage: fmt.Sprintf("Processing failed: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	response.Warnings = append(response.Warnings, ignored...)
+	ctrl.contract.render(c, ctrl.responseStatus(response), response)
+}
+
+// ConvertBatch emite un lote de documentos con el mismo certificado. onError define si un
+// documento inválido aborta el lote completo (abort, por defecto) o si se emiten los
+// válidos (continue); la respuesta trae el resultado de cada documento y el resumen.
+func (ctrl *UBLController) ConvertBatch(c *gin.Context) {
+	var request BatchConvertRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	if len(request.Documents) == 0 || !IsValidBatchOnError(request.OnError) {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: "documents must not be empty and onError must be abort or continue",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	certPEM, err := base64.StdEncoding.DecodeString(request.Certificate)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_CERTIFICATE",
+			ErrorMessage: "Invalid certificate format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	keyPEM, err := base64.StdEncoding.DecodeString(request.PrivateKey)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_PRIVATE_KEY",
+			ErrorMessage: "Invalid private key format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	// Cada documento se decodifica como en /convert: un documento mal formado falla solo
+	strict := ctrl.strictParsing
+	if value, err := strconv.ParseBool(c.Query("strictParsing")); err == nil {
+		strict = value
+	}
+	entries := make([]BatchEntry, len(request.Documents))
+	for i, raw := range request.Documents {
+		doc := &BusinessDocument{}
+		ignored, failure := ctrl.service.DecodeRequest(DocumentSchema(), raw, doc, strict)
+		entries[i] = BatchEntry{Document: doc, Ignored: ignored, Failure: failure}
+	}
+
+	result, err := ctrl.service.ProcessBatch(c.Request.Context(), entries, certPEM, keyPEM, request.OnError)
+	ZeroBytes(keyPEM)
+	var tooLarge *ErrBatchTooLarge
+	if errors.As(err, &tooLarge) {
+		ctrl.contract.render(c, http.StatusRequestEntityTooLarge, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_BATCH_TOO_LARGE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	if err != nil {
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_PROCESSING_FAILED",
+			ErrorMessage: fmt.Sprintf("Processing failed: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	for i, item := range result.Items {
+		if item.Status != BatchItemSuccess {
+			continue
+		}
+		audited := &ConvertRequest{Document: *entries[i].Document, Certificate: request.Certificate, PrivateKey: request.PrivateKey}
+		if auditErr := ctrl.service.AuditConvertRequest(item.CorrelationID, audited); auditErr != nil {
+			ctrl.service.GetLogger().Warnf("No se pudo guardar la auditoría del request: %v", auditErr)
+		}
+	}
+
+	// El lote no es parte del contrato congelado de v1: un lote abortado por validación
+	// responde VALIDATION_ERROR_STATUS en ambas versiones
+	response := ctrl.service.BatchResponse(result)
+	status := ctrl.responseStatus(response)
+	if response.ErrorCode == ValidationFailedCode {
+		status = ctrl.validationStatus
+	}
+	ctrl.contract.render(c, status, response)
+}
+
+// SendDocument envía a SUNAT un documento ya generado. El cuerpo es opcional:
+// {"environment": "beta|produccion|homologacion"}
+func (ctrl *UBLController) SendDocument(c *gin.Context) {
 	var request struct {
-		Document    BusinessDocument `json:"document"`
-		Certificate string          `json:"certificate"`
-		PrivateKey  string          `json:"privateKey"`
+		Environment string `json:"environment"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
 	}
 
+	response, err := ctrl.service.SendDocument(c.Request.Context(), c.Param("documentId"), request.Environment)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_PROCESSING_FAILED",
+			ErrorMessage: fmt.Sprintf("Processing failed: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	ctrl.contract.render(c, ctrl.responseStatus(response), response)
+}
+
+// GenerateSummary arma y firma el resumen diario (RC) de las boletas del store:
+// ?ruc=&date=AAAA-MM-DD. Con autoSend en el cuerpo, el resumen se envía a SUNAT.
+func (ctrl *UBLController) GenerateSummary(c *gin.Context) {
+	var request GenerateSummaryRequest
+
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
 			Status:       "error",
 			ErrorCode:    "ERR_INVALID_REQUEST",
 			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
@@ -40,7 +330,7 @@ func (ctrl *UBLController) ConvertDocument(c *gin.Context) {
 
 	certPEM, err := base64.StdEncoding.DecodeString(request.Certificate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
 			Status:       "error",
 			ErrorCode:    "ERR_INVALID_CERTIFICATE",
 			ErrorMessage: "Invalid certificate format",
@@ -51,7 +341,7 @@ func (ctrl *UBLController) ConvertDocument(c *gin.Context) {
 
 	keyPEM, err := base64.StdEncoding.DecodeString(request.PrivateKey)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
 			Status:       "error",
 			ErrorCode:    "ERR_INVALID_PRIVATE_KEY",
 			ErrorMessage: "Invalid private key format",
@@ -60,9 +350,21 @@ func (ctrl *UBLController) ConvertDocument(c *gin.Context) {
 		return
 	}
 
-	response, err := ctrl.service.ProcessDocument(&request.Document, certPEM, keyPEM)
+	response, err := ctrl.service.GenerateSummary(c.Request.Context(), c.Query("ruc"), c.Query("date"), certPEM, keyPEM)
+	ZeroBytes(keyPEM)
+	if err == nil && request.AutoSend && response.Status == "SUCCESS" {
+		var sent *APIResponse
+		sent, err = ctrl.service.SendDocument(c.Request.Context(), response.DocumentID, request.Environment)
+		if err == nil {
+			if sent.Status != "SUCCESS" {
+				response = sent
+			} else {
+				response.Data["submission"] = sent.Data
+			}
+		}
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, APIResponse{
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
 			Status:       "error",
 			ErrorCode:    "ERR_PROCESSING_FAILED",
 			ErrorMessage: fmt.Sprintf("Processing failed: %v", err),
@@ -71,31 +373,280 @@ func (ctrl *UBLController) ConvertDocument(c *gin.Context) {
 		return
 	}
 
-	statusCode := http.StatusOK
-	if response.Status == "error" {
-		statusCode = http.StatusBadRequest
+	ctrl.contract.render(c, ctrl.responseStatus(response), response)
+}
+
+// GenerateReversion arma y firma el resumen de reversiones (RR) de los comprobantes de
+// retención y percepción del cuerpo. Con autoSend, el resumen se envía a SUNAT.
+func (ctrl *UBLController) GenerateReversion(c *gin.Context) {
+	var request ReversionRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	certPEM, err := base64.StdEncoding.DecodeString(request.Certificate)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_CERTIFICATE",
+			ErrorMessage: "Invalid certificate format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	keyPEM, err := base64.StdEncoding.DecodeString(request.PrivateKey)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_PRIVATE_KEY",
+			ErrorMessage: "Invalid private key format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	response, err := ctrl.service.GenerateReversion(c.Request.Context(), &request, certPEM, keyPEM)
+	ZeroBytes(keyPEM)
+	if err == nil && request.AutoSend && response.Status == "SUCCESS" {
+		var sent *APIResponse
+		sent, err = ctrl.service.SendDocument(c.Request.Context(), response.DocumentID, request.Environment)
+		if err == nil {
+			if sent.Status != "SUCCESS" {
+				response = sent
+			} else {
+				response.Data["submission"] = sent.Data
+			}
+		}
+	}
+	if err != nil {
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_PROCESSING_FAILED",
+			ErrorMessage: fmt.Sprintf("Processing failed: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
 	}
 
-	c.JSON(statusCode, response)
+	ctrl.contract.render(c, ctrl.responseStatus(response), response)
 }
 
+// VoidDocument anula localmente una boleta o nota asociada para informarla con
+// estado 3 en el próximo resumen diario. El cuerpo es opcional: {"reason": "..."}
+func (ctrl *UBLController) VoidDocument(c *gin.Context) {
+	var request struct {
+		Reason string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	response, err := ctrl.service.VoidDocument(c.Param("documentId"), request.Reason)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_PROCESSING_FAILED",
+			ErrorMessage: fmt.Sprintf("Processing failed: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	ctrl.contract.render(c, ctrl.responseStatus(response), response)
+}
+
+// IssueInterestDebitNote emite la nota de débito por intereses moratorios de una
+// factura vencida del store, con la tasa y la fecha de cálculo del request
+func (ctrl *UBLController) IssueInterestDebitNote(c *gin.Context) {
+	var request InterestDebitNoteRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	certPEM, err := base64.StdEncoding.DecodeString(request.Certificate)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_CERTIFICATE",
+			ErrorMessage: "Invalid certificate format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	keyPEM, err := base64.StdEncoding.DecodeString(request.PrivateKey)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_PRIVATE_KEY",
+			ErrorMessage: "Invalid private key format",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	response, err := ctrl.service.IssueInterestDebitNote(c.Request.Context(), c.Param("documentId"), request, certPEM, keyPEM)
+	ZeroBytes(keyPEM)
+	if err != nil {
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_PROCESSING_FAILED",
+			ErrorMessage: fmt.Sprintf("Processing failed: %v", err),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	ctrl.contract.render(c, ctrl.responseStatus(response), response)
+}
+
+// GetDocumentStatus consulta un procesamiento por su correlationId: su resultado, el
+// documento que procesó y el estado y artefactos actuales de ese documento
 func (ctrl *UBLController) GetDocumentStatus(c *gin.Context) {
 	correlationID := c.Param("correlationId")
-	c.JSON(http.StatusOK, APIResponse{
+	lookup, err := ctrl.service.CorrelationStatus(correlationID)
+	switch {
+	case errors.Is(err, ErrInvalidCorrelationID):
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:        "error",
+			CorrelationID: correlationID,
+			ErrorCode:     "ERR_INVALID_CORRELATION_ID",
+			ErrorMessage:  err.Error(),
+			ProcessedAt:   time.Now(),
+		})
+		return
+	case errors.Is(err, ErrCorrelationNotFound):
+		ctrl.contract.render(c, http.StatusNotFound, &APIResponse{
+			Status:        "error",
+			CorrelationID: correlationID,
+			ErrorCode:     "ERR_CORRELATION_NOT_FOUND",
+			ErrorMessage:  fmt.Sprintf("No document was processed with correlationId %s", correlationID),
+			ProcessedAt:   time.Now(),
+		})
+		return
+	case err != nil:
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	ruc, _, _ := strings.Cut(lookup.Record.DocumentID, "-")
+	if !IssuerAllowed(c, ruc) {
+		ctrl.contract.render(c, http.StatusForbidden, &APIResponse{
+			Status:        "error",
+			CorrelationID: correlationID,
+			ErrorCode:     "ERR_FORBIDDEN",
+			ErrorMessage:  "The API key is not authorized for RUC " + ruc,
+			ProcessedAt:   time.Now(),
+		})
+		return
+	}
+
+	ctrl.contract.render(c, http.StatusOK, &APIResponse{
 		Status:        "success",
 		CorrelationID: correlationID,
+		DocumentID:    lookup.Record.DocumentID,
+		XMLHash:       lookup.Record.XMLHash,
 		ProcessedAt:   time.Now(),
 		Data: map[string]interface{}{
-			"message": "Document processing completed successfully",
+			"result":         lookup.Record.Status,
+			"errorCode":      lookup.Record.ErrorCode,
+			"processedAt":    lookup.Record.ProcessedAt,
+			"documentStatus": lookup.DocumentStatus,
+			"artifacts":      lookup.Artifacts,
 		},
 	})
 }
 
-func (ctrl *UBLController) ValidateDocument(c *gin.Context) {
-	var doc BusinessDocument
+// GetDocumentCorrelations retorna en orden cronológico los correlationId de todos los
+// procesamientos de un documento (reintentos y reprocesos) con su resultado
+func (ctrl *UBLController) GetDocumentCorrelations(c *gin.Context) {
+	documentID := CanonicalDocumentID(c.Param("documentId"))
+	ruc, _, _ := strings.Cut(documentID, "-")
+	if !IssuerAllowed(c, ruc) {
+		ctrl.contract.render(c, http.StatusForbidden, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_FORBIDDEN",
+			ErrorMessage: "The API key is not authorized for RUC " + ruc,
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
 
-	if err := c.ShouldBindJSON(&doc); err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
+	correlations, err := ctrl.service.DocumentCorrelations(documentID)
+	switch {
+	case errors.Is(err, ErrInvalidDocumentKey):
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_DOCUMENT_ID",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	case errors.Is(err, ErrDocumentNotFound):
+		ctrl.contract.render(c, http.StatusNotFound, &APIResponse{
+			Status:       "error",
+			DocumentID:   documentID,
+			ErrorCode:    "ERR_DOCUMENT_NOT_FOUND",
+			ErrorMessage: fmt.Sprintf("No processing was recorded for document %s", documentID),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	case err != nil:
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	ctrl.contract.render(c, http.StatusOK, &APIResponse{
+		Status:      "success",
+		DocumentID:  documentID,
+		ProcessedAt: time.Now(),
+		Data: map[string]interface{}{
+			"correlations": correlations,
+		},
+	})
+}
+
+// ParseCDR parsea un CDR subido con {"cdr": "<ZIP en base64>", "environment": "beta"}
+// y lo asocia al documento del store que responde, como si hubiera llegado por el
+// envío. Si el documento no existe solo retorna el parseo con un warning.
+func (ctrl *UBLController) ParseCDR(c *gin.Context) {
+	var request struct {
+		CDR         string `json:"cdr"`
+		Environment string `json:"environment"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
 			Status:       "error",
 			ErrorCode:    "ERR_INVALID_REQUEST",
 			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
@@ -103,34 +654,185 @@ func (ctrl *UBLController) ValidateDocument(c *gin.Context) {
 		})
 		return
 	}
+	cdr, err := base64.StdEncoding.DecodeString(request.CDR)
+	if err != nil || len(cdr) == 0 {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_CDR_INVALID",
+			ErrorMessage: "cdr must be the CDR ZIP encoded in base64",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	if request.Environment != "" && !IsValidEnvironment(request.Environment) {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_ENVIRONMENT",
+			ErrorMessage: fmt.Sprintf("Invalid environment %q (beta, produccion, homologacion)", request.Environment),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
 
-	validationErrors := ctrl.service.GetValidator().ValidateBusinessDocument(&doc)
+	imported, warnings, err := ctrl.service.ImportCDR(cdr, request.Environment, func(ruc string) bool {
+		return IssuerAllowed(c, ruc)
+	})
+	switch {
+	case errors.Is(err, ErrInvalidCDR):
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_CDR_INVALID",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	case errors.Is(err, ErrForbiddenIssuer):
+		ctrl.contract.render(c, http.StatusForbidden, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_FORBIDDEN",
+			ErrorMessage: "The API key is not authorized for the RUC of the CDR",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	case err != nil:
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+
+	ctrl.contract.render(c, http.StatusOK, &APIResponse{
+		Status:      "success",
+		DocumentID:  imported.DocumentID,
+		ProcessedAt: time.Now(),
+		Warnings:    warnings,
+		Data: map[string]interface{}{
+			"cdr":              imported.CDR,
+			"associated":       imported.Associated,
+			"environment":      imported.Environment,
+			"cdrFile":          imported.CDRFile,
+			"lineCountNumeric": imported.LineCountNumeric,
+			"currency":         imported.Currency,
+			"totals":           imported.Totals,
+		},
+	})
+}
+
+// GetDocumentByNumber consulta un documento por ?ruc=&type=&series=&number=: su registro,
+// artefactos, envíos, CDR e historial de estados
+func (ctrl *UBLController) GetDocumentByNumber(c *gin.Context) {
+	ruc, docType, series, number := c.Query("ruc"), c.Query("type"), c.Query("series"), c.Query("number")
+	if ruc == "" || docType == "" || series == "" || number == "" {
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_REQUEST",
+			ErrorMessage: "ruc, type, series and number query parameters are required",
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
+	if !IssuerAllowed(c, ruc) {
+		ctrl.contract.render(c, http.StatusForbidden, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_FORBIDDEN",
+			ErrorMessage: "The API key is not authorized for RUC " + ruc,
+			ProcessedAt:  time.Now(),
+		})
+		return
+	}
 
-	if len(validationErrors) > 0 {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Status:           "error",
-			ErrorCode:        "ERR_VALIDATION_FAILED",
-			ErrorMessage:     "Document validation failed",
-			ValidationErrors: validationErrors,
-			ProcessedAt:      time.Now(),
+	lookup, err := ctrl.service.FindDocument(ruc, docType, series, number)
+	switch {
+	case errors.Is(err, ErrInvalidDocumentKey):
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_INVALID_DOCUMENT_ID",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	case errors.Is(err, ErrDocumentNotFound):
+		ctrl.contract.render(c, http.StatusNotFound, &APIResponse{
+			Status:       "error",
+			DocumentID:   DocumentKey(ruc, docType, series, number),
+			ErrorCode:    "ERR_DOCUMENT_NOT_FOUND",
+			ErrorMessage: fmt.Sprintf("Document %s not found", DocumentKey(ruc, docType, series, number)),
+			ProcessedAt:  time.Now(),
+		})
+		return
+	case err != nil:
+		ctrl.contract.render(c, http.StatusInternalServerError, &APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: err.Error(),
+			ProcessedAt:  time.Now(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, APIResponse{
+	ctrl.contract.render(c, http.StatusOK, &APIResponse{
 		Status:      "success",
+		DocumentID:  lookup.Record.DocumentID,
+		XMLHash:     lookup.Record.XMLHash,
 		ProcessedAt: time.Now(),
 		Data: map[string]interface{}{
-			"message": "Document validation passed",
+			"status":      lookup.Status,
+			"record":      lookup.Record,
+			"artifacts":   lookup.Artifacts,
+			"submissions": lookup.Submissions,
+			"cdr":         lookup.CDR,
+			"history":     lookup.History,
 		},
 	})
 }
 
+func (ctrl *UBLController) ValidateDocument(c *gin.Context) {
+	var doc BusinessDocument
+
+	ignored, ok := ctrl.bindRequest(c, DocumentSchema(), &doc, ctrl.renderValidationFailure)
+	if !ok {
+		return
+	}
+
+	ctx, failure := ctrl.service.ValidateDocument(c.Request.Context(), &doc)
+	if failure != nil {
+		failure.Warnings = append(failure.Warnings, ignored...)
+		ctrl.renderValidationFailure(c, failure)
+		return
+	}
+
+	data := map[string]interface{}{
+		"message": "Document validation passed",
+	}
+	for key, value := range ctx.Data {
+		data[key] = value
+	}
+	ctrl.contract.render(c, http.StatusOK, &APIResponse{
+		Status:        "success",
+		CorrelationID: ctx.CorrelationID,
+		ProcessedAt:   time.Now(),
+		Warnings:      append(ctx.Warnings, ignored...),
+		Data:          data,
+	})
+}
+
+// GetDocumentSchema publica el JSON Schema del documento y del request de /convert
+func (ctrl *UBLController) GetDocumentSchema(c *gin.Context) {
+	if c.Query("request") == "convert" {
+		c.JSON(http.StatusOK, ConvertRequestSchema())
+		return
+	}
+	c.JSON(http.StatusOK, DocumentSchema())
+}
+
 func (ctrl *UBLController) GetXMLContent(c *gin.Context) {
 	filename := c.Param("filename")
 
 	if !strings.HasSuffix(filename, ".xml") {
-		c.JSON(http.StatusBadRequest, APIResponse{
+		ctrl.contract.render(c, http.StatusBadRequest, &APIResponse{
 			Status:       "error",
 			ErrorCode:    "ERR_INVALID_FILENAME",
 			ErrorMessage: "Invalid filename format",
@@ -139,10 +841,14 @@ func (ctrl *UBLController) GetXMLContent(c *gin.Context) {
 		return
 	}
 
-	filePath := fmt.Sprintf("%s/%s", ctrl.service.GetXMLStorePath(), filename)
-	content, err := os.ReadFile(filePath)
+	content, err := ctrl.service.GetStore().Read(filename)
+	if err != nil {
+		// El correlativo puede venir con ceros a la izquierda
+		canonical := CanonicalDocumentID(strings.TrimSuffix(filename, ".xml")) + ".xml"
+		content, err = ctrl.service.GetStore().Read(canonical)
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, APIResponse{
+		ctrl.contract.render(c, http.StatusNotFound, &APIResponse{
 			Status:       "error",
 			ErrorCode:    "ERR_FILE_NOT_FOUND",
 			ErrorMessage: "XML file not found",
@@ -160,8 +866,32 @@ func (ctrl *UBLController) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "healthy",
 		"timestamp": time.Now().Format(time.RFC3339),
-		"version":   "1.0.0",
+		"version":   version.Version,
 		"service":   "UBL Converter API",
+		"mode":      ctrl.service.Mode(),
+		"storage":   ctrl.service.StorageStatus(),
+	})
+}
+
+// Version retorna la versión del binario, el commit, la fecha de build, el hash de las
+// reglas activas y las versiones de los catálogos cargados
+func (ctrl *UBLController) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, ctrl.service.VersionInfo())
+}
+
+// ReadinessCheck indica si el servicio puede emitir. Con el reloj desfasado por encima
+// del máximo en modo estricto responde 503, porque la emisión está bloqueada.
+func (ctrl *UBLController) ReadinessCheck(c *gin.Context) {
+	status, ready := http.StatusOK, "ready"
+	clock := ctrl.service.ClockSkewStatus()
+	if clock != nil && clock.Status == ClockBlocking {
+		status, ready = http.StatusServiceUnavailable, "not_ready"
+	}
+	c.JSON(status, gin.H{
+		"status":    ready,
+		"timestamp": time.Now().Format(time.RFC3339),
+		"storage":   ctrl.service.StorageStatus(),
+		"clock":     clock,
 	})
 }
 
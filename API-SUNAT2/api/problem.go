@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	. "API-SUNAT2/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ProblemJSONContentType es el media type de las respuestas de error RFC 7807
+const ProblemJSONContentType = "application/problem+json"
+
+// DefaultProblemTypeBaseURI es la base de los type de Problem Details; relativa, se
+// resuelve contra el host del API
+const DefaultProblemTypeBaseURI = "/problems/"
+
+// ProblemDetails es un error en formato RFC 7807. Code y CorrelationID extienden el
+// formato con el código interno y la correlación del request; ValidationErrors trae
+// los errores por campo de los documentos inválidos.
+type ProblemDetails struct {
+	Type             string            `json:"type"`
+	Title            string            `json:"title"`
+	Status           int               `json:"status"`
+	Detail           string            `json:"detail,omitempty"`
+	Instance         string            `json:"instance,omitempty"`
+	Code             string            `json:"code,omitempty"`
+	CorrelationID    string            `json:"correlationId,omitempty"`
+	DocumentID       string            `json:"documentId,omitempty"`
+	ValidationErrors []ValidationError `json:"validationErrors,omitempty"`
+}
+
+// ProblemTypeURI es el type de Problem Details de un código de error interno: la base
+// seguida del código en minúsculas sin el prefijo ERR_ y con guiones
+// (ERR_DOCUMENT_NOT_FOUND es /problems/document-not-found). Sin código es about:blank.
+func ProblemTypeURI(baseURI, code string) string {
+	if code == "" {
+		return "about:blank"
+	}
+	if baseURI == "" {
+		baseURI = DefaultProblemTypeBaseURI
+	}
+	slug := strings.ToLower(strings.TrimPrefix(code, "ERR_"))
+	return baseURI + strings.ReplaceAll(slug, "_", "-")
+}
+
+// acceptsProblem indica si el header Accept pide application/problem+json con q mayor a cero
+func acceptsProblem(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), ProblemJSONContentType) {
+			continue
+		}
+		if params = strings.ReplaceAll(params, " ", ""); strings.HasPrefix(params, "q=") {
+			q, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			return err == nil && q > 0
+		}
+		return true
+	}
+	return false
+}
+
+// wantsProblem indica si el request negoció errores en Problem Details
+func wantsProblem(c *gin.Context) bool {
+	return acceptsProblem(c.GetHeader("Accept"))
+}
+
+// problemSource son los campos de error de las respuestas del API: los del APIResponse
+// de v1, de admin y de los middlewares, y el error agrupado de v2, que es un objeto
+type problemSource struct {
+	CorrelationID    string            `json:"correlationId"`
+	DocumentID       string            `json:"documentId"`
+	ErrorCode        string            `json:"errorCode"`
+	ErrorMessage     string            `json:"errorMessage"`
+	Message          string            `json:"message"`
+	ValidationErrors []ValidationError `json:"validationErrors"`
+	Error            json.RawMessage   `json:"error"`
+	Document         *V2Document       `json:"document"`
+}
+
+// newProblem arma el Problem Details de una respuesta de error a partir de su cuerpo;
+// un cuerpo que no es JSON, como el 404 de una ruta inexistente, solo aporta el status
+func newProblem(baseURI string, status int, body []byte, requestID string) ProblemDetails {
+	var source problemSource
+	json.Unmarshal(body, &source)
+	code, detail, errs := source.ErrorCode, source.ErrorMessage, source.ValidationErrors
+	var v2 V2Error
+	if json.Unmarshal(source.Error, &v2) == nil {
+		code, detail, errs = firstNonEmpty(code, v2.Code), firstNonEmpty(detail, v2.Message), append(errs, v2.Details...)
+	} else {
+		var message string
+		json.Unmarshal(source.Error, &message)
+		detail = firstNonEmpty(detail, message)
+	}
+	if source.Document != nil {
+		source.DocumentID = firstNonEmpty(source.DocumentID, source.Document.ID)
+	}
+
+	correlationID := firstNonEmpty(source.CorrelationID, requestID)
+	problem := ProblemDetails{
+		Type:             ProblemTypeURI(baseURI, code),
+		Title:            http.StatusText(status),
+		Status:           status,
+		Detail:           firstNonEmpty(detail, source.Message),
+		Code:             code,
+		CorrelationID:    correlationID,
+		DocumentID:       source.DocumentID,
+		ValidationErrors: errs,
+	}
+	problem.Instance = problemInstance(correlationID)
+	return problem
+}
+
+// problemInstance retorna el instance de la correlación: urn:uuid: si es un UUID y
+// urn:correlation: con el identificador escapado si el cliente envió otro X-Request-ID
+func problemInstance(correlationID string) string {
+	if correlationID == "" {
+		return ""
+	}
+	if _, err := uuid.Parse(correlationID); err == nil {
+		return "urn:uuid:" + correlationID
+	}
+	return "urn:correlation:" + url.PathEscape(correlationID)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ProblemDetailsMiddleware responde los errores (HTTP 4xx y 5xx) en formato RFC 7807
+// cuando el request envía Accept: application/problem+json; sin el header las respuestas
+// no cambian. Retiene el cuerpo de error de cualquier handler o middleware posterior y
+// lo reescribe al terminar, por lo que también cubre las rutas inexistentes y los
+// pánicos que recupera gin.Recovery.
+func ProblemDetailsMiddleware(baseURI string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !wantsProblem(c) {
+			c.Next()
+			return
+		}
+		writer := &problemResponseWriter{ResponseWriter: c.Writer, baseURI: baseURI, requestID: c.GetString("RequestID")}
+		c.Writer = writer
+		c.Next()
+		writer.finish()
+	}
+}
+
+// problemResponseWriter retiene el cuerpo de las respuestas de error hasta reescribirlo
+// como Problem Details; las demás respuestas pasan sin cambios
+type problemResponseWriter struct {
+	gin.ResponseWriter
+	baseURI   string
+	requestID string
+
+	body    bytes.Buffer
+	written bool
+}
+
+func (w *problemResponseWriter) retains() bool {
+	return !w.written && w.Status() >= http.StatusBadRequest
+}
+
+func (w *problemResponseWriter) Write(data []byte) (int, error) {
+	if !w.retains() {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *problemResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow escribe el error sin cuerpo de c.AbortWithStatus, como el 500 de
+// gin.Recovery, que llega cuando el handler ya no retorna a la middleware
+func (w *problemResponseWriter) WriteHeaderNow() {
+	if w.retains() {
+		w.finish()
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// finish escribe el Problem Details del error retenido
+func (w *problemResponseWriter) finish() {
+	if !w.retains() {
+		return
+	}
+	w.written = true
+	data, _ := json.Marshal(newProblem(w.baseURI, w.Status(), w.body.Bytes(), w.requestID))
+	header := w.Header()
+	header.Set("Content-Type", ProblemJSONContentType)
+	header.Del("Content-Length")
+	header.Add("Vary", "Accept")
+	w.ResponseWriter.Write(data)
+}
@@ -1,44 +1,563 @@
 package api
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"API-SUNAT2/catalog"
+	"API-SUNAT2/config"
+	"API-SUNAT2/kms"
+	. "API-SUNAT2/model"
 	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
 	. "API-SUNAT2/util"
+	"API-SUNAT2/util/httpclient"
 	"github.com/gin-gonic/gin"
 )
 
-func setupRoutes(controller *UBLController) *gin.Engine {
+// registerDocumentRoutes monta los endpoints de documentos sobre un grupo versionado;
+// statusAuth autentica la consulta del estado de un correlationId
+func registerDocumentRoutes(group *gin.RouterGroup, controller *UBLController, statusAuth gin.HandlerFunc) {
+	group.POST("/convert", controller.ConvertDocument)
+	group.POST("/convert/batch", controller.ConvertBatch)
+	group.POST("/validate", controller.ValidateDocument)
+	group.GET("/status/:correlationId", statusAuth, controller.GetDocumentStatus)
+	group.GET("/xml/:filename", controller.GetXMLContent)
+	group.POST("/documents/:documentId/send", controller.SendDocument)
+	group.POST("/documents/:documentId/void", controller.VoidDocument)
+	group.POST("/documents/:documentId/debit-note", controller.IssueInterestDebitNote)
+	group.POST("/summaries/generate", controller.GenerateSummary)
+	group.POST("/reversions", controller.GenerateReversion)
+}
+
+func setupRoutes(controller, controllerV2 *UBLController, admin *AdminController, cfg *config.Config) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	router.Use(LoggingMiddleware())
 	router.Use(gin.Recovery())
 	router.Use(CORSMiddleware())
 	router.Use(RequestIDMiddleware())
+	router.Use(GzipMiddleware(GzipOptions{
+		MaxDecompressedBytes: cfg.GzipMaxDecompressedBytes,
+		MinSize:              cfg.GzipMinSize,
+	}, admin.compression))
+	// Dentro de gzip, para que el Problem Details se comprima como cualquier respuesta
+	router.Use(ProblemDetailsMiddleware(cfg.ProblemTypeBaseURI))
+	if controller.service.IsValidateOnly() {
+		// Las respuestas que no pasan por el contrato (health, admin) se etiquetan con la cabecera
+		router.Use(func(c *gin.Context) {
+			c.Header("X-Environment", ModeValidateOnly)
+		})
+	}
 
 	router.GET("/health", controller.HealthCheck)
+	router.GET("/health/ready", controller.ReadinessCheck)
 	router.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "pong"})
 	})
 
+	// Con API keys de emisor el estado de un correlationId exige la API key de
+	// administración o la de un emisor del documento; sin ellas sigue abierto
+	issuerAuth := IssuerAuthMiddleware(cfg.AdminAPIKey, parseIssuerKeys(cfg.IssuerAPIKeys))
+	statusAuth := func(c *gin.Context) { c.Next() }
+	if cfg.IssuerAPIKeys != "" {
+		statusAuth = issuerAuth
+	}
+
+	// v1 está congelada; los cambios de contrato van en v2
 	api := router.Group("/api/v1")
 	{
-		api.POST("/convert", controller.ConvertDocument)
-		api.POST("/validate", controller.ValidateDocument)
-		api.GET("/status/:correlationId", controller.GetDocumentStatus)
-		api.GET("/xml/:filename", controller.GetXMLContent)
+		registerDocumentRoutes(api, controller, statusAuth)
+		api.GET("/schema/document", controller.GetDocumentSchema)
+		api.GET("/version", controller.Version)
+		api.GET("/issuers/:ruc/status", AdminAuthMiddleware(cfg.AdminAPIKey), admin.IssuerStatus)
+		api.GET("/certificates/expiring", AdminAuthMiddleware(cfg.AdminAPIKey), admin.ExpiringCertificates)
+		api.GET("/documents/:documentId/soap-trace", AdminAuthMiddleware(cfg.AdminAPIKey), admin.SOAPTrace)
+		api.GET("/documents/by-number", issuerAuth, controller.GetDocumentByNumber)
+		api.GET("/correlations/:documentId", issuerAuth, controller.GetDocumentCorrelations)
+		api.POST("/cdr/parse", issuerAuth, controller.ParseCDR)
+		api.GET("/issuers/:ruc/unit-mappings", issuerAuth, admin.UnitMappings)
+		api.PUT("/issuers/:ruc/unit-mappings", issuerAuth, admin.SetUnitMappings)
+		api.GET("/issuers/:ruc/defaults", issuerAuth, admin.DocumentDefaults)
+		api.PUT("/issuers/:ruc/defaults", issuerAuth, admin.SetDocumentDefaults)
+		api.GET("/issuers/:ruc/accounts", issuerAuth, admin.AccountingAccounts)
+		api.PUT("/issuers/:ruc/accounts", issuerAuth, admin.SetAccountingAccounts)
+		api.GET("/documents/:documentId/accounting", issuerAuth, admin.DocumentAccounting)
+		api.GET("/reports/validation", issuerAuth, admin.ValidationReport)
+		api.GET("/reports/end-of-day", issuerAuth, admin.EndOfDayReport)
+		api.GET("/advances", issuerAuth, admin.Advances)
+	}
+
+	registerDocumentRoutes(router.Group("/api/v2"), controllerV2, statusAuth)
+
+	adminGroup := api.Group("/admin", AdminAuthMiddleware(cfg.AdminAPIKey))
+	adminGroup.GET("/reports/xml-sizes", admin.XMLSizeReport)
+	adminGroup.GET("/reports/engine-versions", admin.EngineVersionReport)
+	adminGroup.GET("/reports/zip-integrity", admin.ZIPIntegrityReport)
+	adminGroup.GET("/submissions", admin.Submissions)
+	adminGroup.GET("/logs", admin.Logs)
+	adminGroup.GET("/reports/http-latency", admin.HTTPLatencyReport)
+	adminGroup.POST("/reconcile", admin.Reconcile)
+	adminGroup.POST("/end-of-day", admin.CloseDay)
+	adminGroup.GET("/metrics", admin.Metrics)
+	adminGroup.POST("/homologation", admin.Homologation)
+	adminGroup.POST("/certificates", admin.RegisterCertificate)
+	adminGroup.POST("/purge", admin.Purge)
+	adminGroup.GET("/purges", admin.PurgeAudits)
+	adminGroup.GET("/queues", admin.Queues)
+	adminGroup.POST("/queues/:name/pause", admin.PauseQueue)
+	adminGroup.POST("/queues/:name/resume", admin.ResumeQueue)
+	adminGroup.POST("/queues/:name/drain", admin.DrainQueue)
+
+	if cfg.EnablePprof {
+		adminGroup.GET("/runtime", admin.RuntimeStats)
+
+		// Sin puerto administrativo separado, pprof se monta en el router principal
+		if cfg.AdminPort == "" {
+			registerPprofRoutes(router.Group("/debug/pprof", AdminAuthMiddleware(cfg.AdminAPIKey)))
+		}
 	}
 
 	return router
 }
 
-// NewRouter crea y configura el router principal de la aplicación
-func NewRouter() *gin.Engine {
-	// Crear directorio para almacenar XML si no existe
-	xmlStorePath := "./xml_output"
-	
+// setupAdminRoutes crea el router del puerto administrativo con pprof
+func setupAdminRoutes(admin *AdminController, cfg *config.Config) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(AdminAuthMiddleware(cfg.AdminAPIKey))
+
+	registerPprofRoutes(router.Group("/debug/pprof"))
+	router.GET("/api/v1/admin/runtime", admin.RuntimeStats)
+
+	return router
+}
+
+// NewRouter crea y configura el router principal de la aplicación. Si pprof está
+// habilitado con un puerto administrativo, también retorna el router de administración;
+// en caso contrario el segundo valor es nil.
+func NewRouter(cfg *config.Config) (*gin.Engine, *gin.Engine) {
+	router, adminRouter, _ := NewRouterWithShutdown(cfg)
+	return router, adminRouter
+}
+
+// NewRouterWithShutdown es NewRouter y además retorna la función que detiene los
+// procesos en segundo plano al apagar el servidor: primero los jobs periódicos y al
+// final la publicación de eventos, que publica los que quedaron en el buffer.
+func NewRouterWithShutdown(cfg *config.Config) (*gin.Engine, *gin.Engine, func()) {
+	var jobs []func()
+	stopEvents := func() {}
+	// En modo validate-only los documentos se guardan en su propio subdirectorio, para que
+	// no se mezclen con los de producción
+	validateOnly := cfg.Mode == ModeValidateOnly
+	storePath, secondaryPath := cfg.XMLStorePath, cfg.XMLStoreSecondaryPath
+	if validateOnly {
+		storePath = filepath.Join(storePath, ValidateOnlyStorePrefix)
+		if secondaryPath != "" {
+			secondaryPath = filepath.Join(secondaryPath, ValidateOnlyStorePrefix)
+		}
+	}
+
 	// Crear servicios
-	service := NewUBLConverterService(xmlStorePath)
+	service := NewUBLConverterService(storePath)
+	if cfg.Mode != "" && !IsValidMode(cfg.Mode) {
+		service.GetLogger().Errorf("MODE desconocido (%s), se usa full", cfg.Mode)
+	}
+	if validateOnly {
+		for _, path := range []string{storePath, secondaryPath} {
+			if path == "" {
+				continue
+			}
+			if err := os.MkdirAll(path, 0755); err != nil {
+				service.GetLogger().Errorf("No se pudo crear el directorio %s: %v", path, err)
+			}
+		}
+		service.SetValidateOnly(true)
+		service.GetLogger().Warn("MODE=validate-only: los documentos se firman con el certificado de prueba y NO se envían a SUNAT")
+	}
+
+	// Todas las salidas HTTP comparten el transport del pool
+	pool, err := httpclient.NewPool(httpOptions(cfg))
+	if err != nil {
+		service.GetLogger().Errorf("No se pudo configurar HTTP_PROXY, se usa el pool por defecto: %v", err)
+		pool = httpclient.Default()
+	}
+	service.SetHTTPPool(pool)
+
+	// Con cifrado en reposo cada directorio del store se envuelve por separado, de modo
+	// que la contingencia y la re-sincronización manejan los artefactos ya descifrados.
+	// Cada directorio guarda aparte, en su subdirectorio prueba, los artefactos de los
+	// emisores y series de prueba.
+	service.SetTestDocuments(splitList(cfg.TestIssuers), splitList(cfg.TestSeries))
+	encrypt := encryptionWrapper(cfg, service, pool)
+	directory := func(path string) storage.DocumentStore {
+		testPath := filepath.Join(path, TestStorePrefix)
+		if err := os.MkdirAll(testPath, 0755); err != nil {
+			service.GetLogger().Errorf("No se pudo crear el directorio %s: %v", testPath, err)
+		}
+		return encrypt(storage.NewPartitionedStore(storage.NewFileStore(path), storage.NewFileStore(testPath), service.IsTestArtifact))
+	}
+	if secondaryPath != "" {
+		service.SetStore(storage.NewFailoverStore(directory(storePath), directory(secondaryPath)))
+		if cfg.StorageResyncInterval > 0 {
+			jobs = append(jobs, service.StartStorageResync(cfg.StorageResyncInterval))
+		}
+	} else {
+		service.SetStore(directory(storePath))
+	}
+	service.GetLogService().SetBufferSize(cfg.LogBufferSize)
+	if cfg.LogFile != "" {
+		if err := service.GetLogService().EnableFile(cfg.LogFile); err != nil {
+			service.GetLogger().Errorf("No se pudo abrir LOG_FILE: %v", err)
+		}
+	}
+	service.GetSigner().SetMinRSABits(cfg.MinRSABits)
+	service.GetSigner().SetReplaceSignatures(cfg.SignatureReplace)
+	if validateOnly {
+		// El certificado de prueba es autofirmado; nunca se usa en producción
+		service.GetSigner().SetCertificatePolicy(EnvironmentBeta, nil)
+	} else {
+		service.GetSigner().SetCertificatePolicy(cfg.SunatEnvironment, splitList(cfg.AcceptedCertCAs))
+	}
+	service.SetAuditRequests(cfg.AuditRequests)
+	service.SetRetentionYears(cfg.RetentionYears)
+	service.SetCheckNoteBalance(cfg.CheckNoteBalance)
+	if cfg.IGVRates != "" {
+		rates, err := catalog.ParseIGVRates(cfg.IGVRates)
+		if err != nil {
+			service.GetLogger().Errorf("IGV_RATES inválido, se usa la tabla histórica: %v", err)
+		}
+		service.GetValidator().SetIGVRates(rates)
+	}
+	if cfg.CatalogOverridePath != "" {
+		if _, err := service.LoadCatalogOverrides(cfg.CatalogOverridePath); err != nil {
+			service.GetLogger().Errorf("CATALOG_OVERRIDE_PATH inválido, se usan los catálogos embebidos: %v", err)
+		}
+	}
+	service.GetValidator().SetIGVRate(cfg.IGVRate)
+	service.GetValidator().SetIGVRateCheck(cfg.IGVRateCheck)
+	service.GetValidator().SetBoletaIdentificationCheck(cfg.BoletaIdentificationCheck)
+	service.GetValidator().SetIssueDateCheck(cfg.IssueDateCheck)
+	service.GetValidator().SetNoteMaxDays(cfg.NoteMaxDays)
+	if cfg.BoletaIdentificationThresholds != "" {
+		thresholds, err := catalog.ParseBoletaIdentificationThresholds(cfg.BoletaIdentificationThresholds)
+		if err != nil {
+			service.GetLogger().Errorf("BOLETA_IDENTIFICATION_THRESHOLDS inválido, se usa la tabla vigente: %v", err)
+		}
+		service.GetValidator().SetBoletaIdentificationThresholds(thresholds)
+	}
+	service.GetValidator().SetObservationLimits(cfg.MaxObservations, cfg.MaxObservationLength)
+	service.GetValidator().SetClassificationIssuers(splitList(cfg.ClassificationCodeIssuers))
+	service.GetValidator().SetLineWorkers(cfg.ValidationWorkers)
+	service.SetLimits(cfg.MaxItems, cfg.MaxXMLBytes)
+	service.SetBatchLimit(cfg.MaxBatchDocuments)
+	service.SetDescriptionPolicy(cfg.DescriptionWhitespace)
+	if cfg.FixMojibake != "" && !IsValidMojibakeMode(cfg.FixMojibake) {
+		service.GetLogger().Errorf("FIX_MOJIBAKE desconocido (%s), se usa off", cfg.FixMojibake)
+	}
+	service.SetMojibakeMode(cfg.FixMojibake)
+	service.SetJobTimeout(cfg.JobTimeout)
+	if cfg.XMLEncoding != "" && !IsValidXMLEncoding(cfg.XMLEncoding) {
+		service.GetLogger().Errorf("XML_ENCODING desconocido (%s), se usa utf8", cfg.XMLEncoding)
+	}
+	service.SetXMLEncoding(cfg.XMLEncoding)
+	xmlFormat := XMLFormat{LineEnding: cfg.XMLLineEnding, OmitDeclaration: cfg.XMLOmitDeclaration}
+	if cfg.XMLLineEnding != "" && !IsValidXMLLineEnding(cfg.XMLLineEnding) {
+		service.GetLogger().Errorf("XML_LINE_ENDING desconocido (%s), se usa lf", cfg.XMLLineEnding)
+		xmlFormat.LineEnding = XMLLineEndingLF
+	}
+	if cfg.XMLOmitDeclaration && cfg.XMLEncoding == XMLEncodingLatin1 {
+		service.GetLogger().Warn("XML_OMIT_DECLARATION no aplica con XML_ENCODING=iso-8859-1, la declaración se conserva")
+	}
+	service.GetSigner().SetXMLFormat(xmlFormat)
+	if cfg.DecimalSeparator != "" && !IsValidDecimalSeparator(cfg.DecimalSeparator) {
+		service.GetLogger().Errorf("DECIMAL_SEPARATOR desconocido (%s), se usa .", cfg.DecimalSeparator)
+	}
+	SetDecimalSeparator(cfg.DecimalSeparator)
+	service.SetAmountWordsAccents(cfg.AmountWordsAccents)
+	service.SetCatalogURIs(cfg.CatalogURIs)
+	service.SetIDReferenceIssuers(splitList(cfg.SignatureIDReferenceIssuers))
+	service.SetPricingReferenceOmitIssuers(splitList(cfg.PricingReferenceOmitIssuers))
+	service.SetConvertNegativeLines(cfg.ConvertNegativeLines)
+
+	if cfg.ClockSkewSource != "" {
+		service.SetClockSkewCheck(NewTimeSource(cfg.ClockSkewSource, pool.Client(httpclient.DestinationTime)), ClockSkewOptions{
+			Mode:          cfg.ClockSkewMode,
+			WarnThreshold: cfg.ClockSkewWarnThreshold,
+			MaxSkew:       cfg.ClockSkewMax,
+		})
+		if cfg.ClockSkewInterval > 0 {
+			jobs = append(jobs, service.StartClockSkewMonitor(cfg.ClockSkewInterval))
+		}
+	}
+	if cfg.ValidationStatsInterval > 0 {
+		jobs = append(jobs, service.StartValidationStats(cfg.ValidationStatsInterval, DefaultValidationStatsBuffer))
+	}
+	if cfg.TSAURL != "" {
+		service.GetSigner().SetTimestampAuthority(NewHTTPTimestampAuthority(cfg.TSAURL, pool.Client(httpclient.DestinationTSA)), cfg.TSAFailOnError)
+	}
+	if cfg.SunatCredentialsFile != "" && !validateOnly {
+		credentials, err := LoadSunatCredentials(cfg.SunatCredentialsFile)
+		if err != nil {
+			service.GetLogger().Errorf("No se pudieron cargar las credenciales SUNAT: %v", err)
+		} else {
+			sunatClient := pool.Client(httpclient.DestinationSunat)
+			service.SetSunatRouter(NewSunatRouter(credentials, func(endpoint SunatEndpoint) SunatClient {
+				return NewSOAPSunatClient(endpoint, sunatClient)
+			}), cfg.SunatEnvironment)
+		}
+	}
+	if cfg.SunatMock && !validateOnly {
+		if err := enableSunatMock(service, cfg); err != nil {
+			service.GetLogger().Errorf("No se pudo habilitar SUNAT_MOCK: %v", err)
+		} else {
+			service.GetLogger().Warn("SUNAT_MOCK habilitado: los envíos NO llegan a SUNAT y se registran con environment \"mock\"")
+		}
+	}
+	service.SetSOAPTrace(SOAPTraceOptions{
+		Enabled:   cfg.SOAPTraceEnabled,
+		MaxBytes:  cfg.SOAPTraceMaxBytes,
+		Retention: cfg.SOAPTraceRetention,
+	})
+	if cfg.SOAPTraceEnabled && cfg.SOAPTracePurgeInterval > 0 {
+		jobs = append(jobs, service.StartSOAPTracePurge(cfg.SOAPTracePurgeInterval))
+	}
+	service.SetReconcileOptions(ReconcileOptions{
+		MinAge:          cfg.ReconcileMinAge,
+		BatchSize:       cfg.ReconcileBatchSize,
+		RequestInterval: cfg.ReconcileRequestInterval,
+	})
+	if cfg.ReconcileInterval > 0 && !validateOnly {
+		jobs = append(jobs, service.StartReconciler(cfg.ReconcileInterval))
+	}
+	var notifiers []CertificateNotifier
+	if cfg.CertAlertWebhookURL != "" {
+		notifiers = append(notifiers, NewWebhookNotifier(cfg.CertAlertWebhookURL, pool.Client(httpclient.DestinationWebhook)))
+	}
+	if cfg.SMTPAddr != "" && cfg.CertAlertEmailTo != "" {
+		notifiers = append(notifiers, NewSMTPNotifier(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom, splitList(cfg.CertAlertEmailTo)))
+	}
+	service.SetCertificateNotifiers(notifiers...)
+	if cfg.CertCheckInterval > 0 {
+		jobs = append(jobs, service.StartCertificateMonitor(cfg.CertCheckInterval))
+	}
+	var endOfDayNotifiers []EndOfDayNotifier
+	if cfg.EndOfDayWebhookURL != "" {
+		endOfDayNotifiers = append(endOfDayNotifiers, NewWebhookNotifier(cfg.EndOfDayWebhookURL, pool.Client(httpclient.DestinationWebhook)))
+	}
+	if cfg.SMTPAddr != "" && cfg.EndOfDayEmailTo != "" {
+		endOfDayNotifiers = append(endOfDayNotifiers, NewSMTPNotifier(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom, splitList(cfg.EndOfDayEmailTo)))
+	}
+	service.SetEndOfDayAlerts(cfg.EndOfDayAlertThreshold, endOfDayNotifiers...)
+	if cfg.EndOfDayTime != "" && !validateOnly {
+		if hour, minute, err := ParseEndOfDayTime(cfg.EndOfDayTime); err != nil {
+			service.GetLogger().Errorf("END_OF_DAY_TIME inválido, no se programa el cierre diario: %v", err)
+		} else {
+			jobs = append(jobs, service.StartEndOfDayJob(hour, minute))
+		}
+	}
+	if cfg.EventsDriver != "" {
+		if cfg.EventsDriver == "kafka" {
+			service.GetLogger().Warn("EVENTS_DRIVER=kafka está obsoleto, use kafka-rest: los eventos se publican en un Kafka REST Proxy")
+		}
+		publisher, err := newEventPublisher(cfg, pool)
+		if err != nil {
+			service.GetLogger().Errorf("No se pudo configurar EVENTS_DRIVER, no se publican eventos: %v", err)
+		} else {
+			stopEvents = service.StartEventPublisher(publisher, cfg.EventsBufferSize)
+		}
+	}
+	if cfg.PadronURL != "" {
+		service.SetPadronClient(NewCachedPadronClient(NewHTTPPadronClient(cfg.PadronURL, pool.Client(httpclient.DestinationPadron)), time.Hour, SystemClock{}))
+		if cfg.CheckIssuerStatus {
+			service.SetIssuerStatusCheck(cfg.IssuerStatusMode)
+		}
+		if cfg.CheckCustomerName {
+			service.SetCustomerNameCheck(cfg.CustomerNameMinSimilarity)
+		}
+	}
+
+	router, adminRouter := NewRouterWithService(cfg, service)
+	return router, adminRouter, func() {
+		for i := len(jobs) - 1; i >= 0; i-- {
+			jobs[i]()
+		}
+		stopEvents()
+	}
+}
+
+// newEventPublisher crea el publicador de eventos del driver configurado. "kafka" es el
+// nombre anterior de "kafka-rest" y se sigue aceptando.
+func newEventPublisher(cfg *config.Config, pool *httpclient.Pool) (EventPublisher, error) {
+	urls := splitList(cfg.EventsURLs)
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("EVENTS_URLS is required")
+	}
+	switch cfg.EventsDriver {
+	case "kafka-rest", "kafka":
+		return NewKafkaRESTPublisher(urls, cfg.EventsTopic, pool.Client(httpclient.DestinationEvents)), nil
+	case "nats":
+		opts := NATSOptions{User: cfg.EventsNATSUser, Password: cfg.EventsNATSPassword, Token: cfg.EventsNATSToken}
+		if cfg.EventsNATSTLS || cfg.EventsNATSCAFile != "" || cfg.EventsNATSCertFile != "" {
+			tlsConfig, err := natsTLSConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			opts.TLS = tlsConfig
+		}
+		return NewNATSPublisher(urls, cfg.EventsTopic, opts), nil
+	}
+	return nil, fmt.Errorf("unknown driver %q (kafka-rest, nats)", cfg.EventsDriver)
+}
+
+// natsTLSConfig arma el TLS de NATS con la CA y el certificado de cliente configurados;
+// sin CA se verifica el servidor con las CA del sistema
+func natsTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.EventsNATSCAFile != "" {
+		data, err := os.ReadFile(cfg.EventsNATSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("EVENTS_NATS_CA_FILE: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("EVENTS_NATS_CA_FILE has no PEM certificates")
+		}
+	}
+	if cfg.EventsNATSCertFile != "" || cfg.EventsNATSKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.EventsNATSCertFile, cfg.EventsNATSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("EVENTS_NATS_CERT_FILE/EVENTS_NATS_KEY_FILE: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// httpOptions arma las opciones del pool HTTP a partir de la configuración
+func httpOptions(cfg *config.Config) httpclient.Options {
+	opts := httpclient.DefaultOptions()
+	opts.ProxyURL = cfg.HTTPProxy
+	if cfg.HTTPMaxConnsPerHost > 0 {
+		opts.MaxConnsPerHost = cfg.HTTPMaxConnsPerHost
+	}
+	for destination, timeout := range map[string]time.Duration{
+		httpclient.DestinationSunat:  cfg.SunatTimeout,
+		httpclient.DestinationPadron: cfg.PadronTimeout,
+		httpclient.DestinationTSA:    cfg.TSATimeout,
+	} {
+		if timeout > 0 {
+			opts.Timeouts[destination] = timeout
+		}
+	}
+	return opts
+}
+
+// enableSunatMock configura el cliente simulado con el certificado y las reglas de la configuración
+func enableSunatMock(service *UBLConverterService, cfg *config.Config) error {
+	certPEM, err := os.ReadFile(cfg.SunatMockCertFile)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(cfg.SunatMockKeyFile)
+	if err != nil {
+		return err
+	}
+
+	rules := MockSunatRules{
+		ObserveAmount: cfg.SunatMockObserveAmount,
+		RejectSeries:  splitList(cfg.SunatMockRejectSeries),
+	}
+
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, rules, SystemClock{}))
+	return nil
+}
+
+// encryptionWrapper retorna la función que envuelve un store con el cifrado en reposo de
+// ENCRYPTION_KEY_PROVIDER; sin proveedor retorna el store tal cual. Si el proveedor no
+// puede crearse el store rechaza las escrituras en lugar de guardar en claro.
+func encryptionWrapper(cfg *config.Config, service *UBLConverterService, pool *httpclient.Pool) func(storage.DocumentStore) storage.DocumentStore {
+	if cfg.EncryptionKeyProvider == "" {
+		return func(store storage.DocumentStore) storage.DocumentStore { return store }
+	}
+	keys, err := kms.New(kms.Options{
+		Provider:     cfg.EncryptionKeyProvider,
+		MasterKey:    cfg.EncryptionMasterKey,
+		PreviousKeys: splitList(cfg.EncryptionPreviousMasterKeys),
+		KeyFile:      cfg.EncryptionKeyFile,
+		KeyID:        cfg.EncryptionKMSKeyID,
+		Region:       cfg.EncryptionKMSRegion,
+		Endpoint:     cfg.EncryptionKMSEndpoint,
+		AWS: kms.AWSCredentials{
+			AccessKeyID:     cfg.AWSAccessKeyID,
+			SecretAccessKey: cfg.AWSSecretAccessKey,
+			SessionToken:    cfg.AWSSessionToken,
+		},
+		GCPAccessToken: cfg.GCPAccessToken,
+	}, pool.Client(httpclient.DestinationKMS))
+	if err != nil {
+		service.GetLogger().Errorf("No se pudo configurar ENCRYPTION_KEY_PROVIDER, el store rechaza las escrituras: %v", err)
+		keys = kms.Unavailable(err)
+	} else if cfg.EncryptionKeyProvider == kms.ProviderStatic && cfg.SunatEnvironment == EnvironmentProduction {
+		service.GetLogger().Warn("ENCRYPTION_KEY_PROVIDER=static es para desarrollo: la clave maestra queda en el entorno")
+	}
+	return func(store storage.DocumentStore) storage.DocumentStore {
+		return storage.NewEncryptedStore(store, keys, cfg.EncryptionDataKeyRotation)
+	}
+}
+
+// splitList separa una lista de la configuración separada por comas, sin elementos vacíos
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseIssuerKeys arma el mapa API key -> RUC de ISSUER_API_KEYS ("clave:RUC,clave:RUC");
+// una misma clave puede repetirse para varios RUC
+func parseIssuerKeys(value string) map[string][]string {
+	keys := make(map[string][]string)
+	for _, item := range splitList(value) {
+		key, ruc, ok := strings.Cut(item, ":")
+		if key, ruc = strings.TrimSpace(key), strings.TrimSpace(ruc); ok && key != "" && ruc != "" {
+			keys[key] = append(keys[key], ruc)
+		}
+	}
+	return keys
+}
+
+// NewRouterWithService monta los routers sobre un servicio ya configurado. Las
+// versiones v1 y v2 comparten el mismo servicio.
+func NewRouterWithService(cfg *config.Config, service *UBLConverterService) (*gin.Engine, *gin.Engine) {
 	controller := NewUBLController(service)
-	
-	return setupRoutes(controller)
-} 
\ No newline at end of file
+	controllerV2 := NewUBLControllerV2(service)
+	if cfg.ValidationErrorStatus != 0 {
+		controller.SetValidationStatus(cfg.ValidationErrorStatus)
+		controllerV2.SetValidationStatus(cfg.ValidationErrorStatus)
+	}
+	controller.SetUnifiedValidation(cfg.V1UnifiedValidation)
+	controller.SetStrictParsing(cfg.StrictParsing)
+	controllerV2.SetStrictParsing(cfg.StrictParsing)
+	if service.IsValidateOnly() {
+		controller.SetResponseEnvironment(ModeValidateOnly)
+		controllerV2.SetResponseEnvironment(ModeValidateOnly)
+	}
+	admin := NewAdminController(service)
+
+	var adminRouter *gin.Engine
+	if cfg.EnablePprof && cfg.AdminPort != "" {
+		adminRouter = setupAdminRoutes(admin, cfg)
+	}
+
+	return setupRoutes(controller, controllerV2, admin, cfg), adminRouter
+}
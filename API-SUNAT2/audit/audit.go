@@ -0,0 +1,300 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "API-SUNAT2/service"
+	. "API-SUNAT2/util"
+)
+
+// Options configura una verificación masiva de XML firmados
+type Options struct {
+	// Dir es el directorio con los XML (RUC-TIPO-SERIE-NUMERO.xml), recorrido recursivamente
+	Dir string
+	// Workers es el número de archivos que se verifican en paralelo
+	Workers int
+	// Compatibility tolera las diferencias conocidas de los XML de otros facturadores
+	Compatibility CompatibilityOptions
+}
+
+// Motivos de fallo de un archivo, para el resumen
+const (
+	CheckRead      = "read"
+	CheckFileName  = "file_name"
+	CheckSignature = "signature"
+	CheckStructure = "structure"
+)
+
+// FileResult es el resultado de la verificación de un archivo
+type FileResult struct {
+	File string `json:"file"`
+	OK   bool   `json:"ok"`
+	// Checks son las verificaciones que fallaron y Reason su detalle
+	Checks []string `json:"checks,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+// Report resume una verificación masiva
+type Report struct {
+	Dir     string `json:"dir"`
+	Workers int    `json:"workers"`
+	// Scanned son los .xml encontrados; los CDR (R-*.xml) y los demás archivos se ignoran
+	Scanned int `json:"scanned"`
+	OK      int `json:"ok"`
+	Failed  int `json:"failed"`
+	// ByCheck cuenta los archivos que fallaron cada verificación; un archivo puede fallar varias
+	ByCheck    map[string]int `json:"byCheck"`
+	DurationMs float64        `json:"durationMs"`
+	Files      []FileResult   `json:"files"`
+}
+
+// documentFilePattern reconoce el nombre RUC-TIPO-SERIE-NUMERO.xml de un documento
+var documentFilePattern = regexp.MustCompile(`^(\d{11})-(01|03|07|08)-([A-Za-z0-9]{4})-(\d{1,8})\.xml$`)
+
+// Run verifica en paralelo cada XML de opts.Dir: la firma, los invariantes estructurales
+// y que el nombre del archivo corresponda al RUC, tipo, serie y número del contenido.
+// Un archivo ilegible o corrupto falla sin detener la corrida.
+func Run(opts Options) (*Report, error) {
+	if opts.Workers <= 0 {
+		return nil, fmt.Errorf("workers must be greater than 0")
+	}
+	var files []string
+	err := filepath.WalkDir(opts.Dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(name), ".xml") && !strings.HasPrefix(name, "R-") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	started := time.Now()
+	results := make([]FileResult, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Cada worker con su propio verificador de firmas
+			signer := NewDigitalSignatureService(nil)
+			signer.SetCompatibility(opts.Compatibility)
+			checker := NewInvariantChecker()
+			for i := range jobs {
+				results[i] = auditFile(files[i], signer, checker, opts.Compatibility)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := &Report{Dir: opts.Dir, Workers: opts.Workers, Scanned: len(files), ByCheck: map[string]int{}, Files: results}
+	for _, result := range results {
+		if result.OK {
+			report.OK++
+			continue
+		}
+		report.Failed++
+		for _, check := range result.Checks {
+			report.ByCheck[check]++
+		}
+	}
+	report.DurationMs = float64(time.Since(started).Microseconds()) / 1000
+	return report, nil
+}
+
+// auditFile verifica un archivo; un XML que no se puede leer solo se reporta como
+// ilegible, sin las demás verificaciones
+func auditFile(path string, signer *DigitalSignatureService, checker *InvariantChecker, compatibility CompatibilityOptions) (result FileResult) {
+	result.File = path
+	var reasons []string
+	fail := func(check, reason string) {
+		result.Checks = append(result.Checks, check)
+		reasons = append(reasons, check+": "+reason)
+	}
+	defer func() {
+		// Un archivo corrupto no debe abortar la corrida
+		if r := recover(); r != nil {
+			fail(CheckRead, fmt.Sprintf("%v", r))
+		}
+		result.OK = len(result.Checks) == 0
+		result.Reason = strings.Join(reasons, "; ")
+	}()
+
+	xmlData, err := os.ReadFile(path)
+	if err != nil {
+		fail(CheckRead, err.Error())
+		return
+	}
+	identity, err := readIdentity(xmlData)
+	if err != nil {
+		fail(CheckRead, err.Error())
+		return
+	}
+	if err := identity.matchFileName(filepath.Base(path)); err != nil {
+		fail(CheckFileName, err.Error())
+	}
+
+	verifications, err := signer.VerifySignatures(xmlData)
+	if err != nil {
+		fail(CheckSignature, err.Error())
+	}
+	for _, verification := range verifications {
+		if !verification.Valid {
+			fail(CheckSignature, fmt.Sprintf("signature %d: %s", verification.Index, verification.Error))
+		}
+	}
+
+	var rules []string
+	for _, validationError := range checker.CheckReceived(xmlData, compatibility) {
+		rules = append(rules, fmt.Sprintf("%s (%s)", validationError.Rule, validationError.Message))
+	}
+	if len(rules) > 0 {
+		fail(CheckStructure, strings.Join(rules, ", "))
+	}
+	return
+}
+
+// documentIdentity son los datos del XML que determinan su nombre de archivo
+type documentIdentity struct {
+	issuerRUC    string
+	documentType string
+	id           string
+}
+
+// readIdentity lee del XML el RUC del emisor, el tipo de comprobante y la serie-número
+func readIdentity(xmlData []byte) (*documentIdentity, error) {
+	identity := &documentIdentity{}
+	decoder := NewXMLDecoder(bytes.NewReader(xmlData))
+	var path []xml.Name
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(path) == 0 && !IsUBLDocumentRoot(t.Name) {
+				return nil, fmt.Errorf("root element %s is not an invoice, boleta or note", t.Name.Local)
+			}
+			path = append(path, t.Name)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			switch {
+			case len(path) == 2 && t.Name == CBC("ID"):
+				identity.id = value
+			case len(path) == 2 && t.Name == CBC("InvoiceTypeCode"):
+				identity.documentType = value
+			case len(path) == 5 && path[1] == CAC("AccountingSupplierParty") && path[3] == CAC("PartyIdentification") && t.Name == CBC("ID"):
+				identity.issuerRUC = value
+			case len(path) == 3 && path[1] == CAC("AccountingSupplierParty") && t.Name == CBC("CustomerAssignedAccountID") && identity.issuerRUC == "":
+				// UBL 2.0
+				identity.issuerRUC = value
+			}
+			if len(path) == 1 {
+				switch t.Name.Local {
+				case "CreditNote":
+					identity.documentType = "07"
+				case "DebitNote":
+					identity.documentType = "08"
+				}
+			}
+			path = path[:len(path)-1]
+			text.Reset()
+		}
+	}
+	if len(path) > 0 || identity.id == "" {
+		return nil, fmt.Errorf("invalid XML: document ID not found")
+	}
+	return identity, nil
+}
+
+// matchFileName verifica que el nombre RUC-TIPO-SERIE-NUMERO.xml corresponda al
+// contenido; el correlativo puede llevar ceros a la izquierda
+func (identity *documentIdentity) matchFileName(fileName string) error {
+	match := documentFilePattern.FindStringSubmatch(fileName)
+	if match == nil {
+		return fmt.Errorf("file name does not match RUC-TIPO-SERIE-NUMERO.xml")
+	}
+	var mismatches []string
+	if match[1] != identity.issuerRUC {
+		mismatches = append(mismatches, fmt.Sprintf("RUC %s in name, %q in XML", match[1], identity.issuerRUC))
+	}
+	if match[2] != identity.documentType {
+		mismatches = append(mismatches, fmt.Sprintf("type %s in name, %q in XML", match[2], identity.documentType))
+	}
+	series, number := identity.id, ""
+	if i := strings.LastIndex(identity.id, "-"); i >= 0 {
+		series, number = identity.id[:i], identity.id[i+1:]
+	}
+	if series != match[3] || CanonicalNumber(number) != CanonicalNumber(match[4]) {
+		mismatches = append(mismatches, fmt.Sprintf("series-number %s-%s in name, %q in XML", match[3], match[4], identity.id))
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%s", strings.Join(mismatches, ", "))
+	}
+	return nil
+}
+
+// Print escribe el resumen de la verificación en formato legible
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Verificación de %s (%d workers, %.0f ms)\n", r.Dir, r.Workers, r.DurationMs)
+	fmt.Fprintf(w, "XML encontrados: %d\n", r.Scanned)
+	fmt.Fprintf(w, "Correctos:       %d\n", r.OK)
+	fmt.Fprintf(w, "Con fallas:      %d\n", r.Failed)
+	for _, check := range []string{CheckRead, CheckFileName, CheckSignature, CheckStructure} {
+		if r.ByCheck[check] > 0 {
+			fmt.Fprintf(w, "  %-10s %d\n", check+":", r.ByCheck[check])
+		}
+	}
+}
+
+// WriteCSV exporta una fila por archivo: file, result (ok o failed), checks y reason
+func (r *Report) WriteCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"file", "result", "checks", "reason"})
+	for _, result := range r.Files {
+		status := "ok"
+		if !result.OK {
+			status = "failed"
+		}
+		w.Write([]string{result.File, status, strings.Join(result.Checks, "|"), result.Reason})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,237 @@
+package bench
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+// Options configura una corrida sintética del pipeline
+type Options struct {
+	Docs        int
+	Concurrency int
+	Lines       int
+	// Timeout es el tiempo máximo de cada documento; 0 usa DefaultJobTimeout
+	Timeout time.Duration
+}
+
+// StageStats resume las latencias de una etapa en milisegundos
+type StageStats struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50Ms"`
+	P90   float64 `json:"p90Ms"`
+	P99   float64 `json:"p99Ms"`
+	Max   float64 `json:"maxMs"`
+}
+
+// Report es el resultado exportable de una corrida
+type Report struct {
+	StartedAt     time.Time             `json:"startedAt"`
+	GoVersion     string                `json:"goVersion"`
+	NumCPU        int                   `json:"numCpu"`
+	Docs          int                   `json:"docs"`
+	Concurrency   int                   `json:"concurrency"`
+	Lines         int                   `json:"lines"`
+	Errors        int                   `json:"errors"`
+	DurationMs    float64               `json:"durationMs"`
+	DocsPerSecond float64               `json:"docsPerSecond"`
+	Stages        map[string]StageStats `json:"stages"`
+}
+
+// stageOrder define el orden de impresión de las etapas del pipeline
+var stageOrder = []string{"validate", "convert", "invariants", "ubl_signature", "sign", "save", "zip", "total"}
+
+// Run ejecuta el pipeline completo sobre documentos sintéticos con storage en memoria
+func Run(opts Options) (*Report, error) {
+	if opts.Docs <= 0 || opts.Concurrency <= 0 || opts.Lines <= 0 {
+		return nil, fmt.Errorf("docs, concurrency and lines must be greater than 0")
+	}
+
+	certPEM, keyPEM, err := GenerateTestCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	samples := make(map[string][]time.Duration)
+	record := func(stage string, duration time.Duration) {
+		mu.Lock()
+		samples[stage] = append(samples[stage], duration)
+		mu.Unlock()
+	}
+
+	service := NewUBLConverterService("")
+	service.SetStore(storage.NewMemoryStore())
+	service.SetStageObserver(record)
+	service.GetLogger().SetOutput(io.Discard)
+	service.SetJobTimeout(opts.Timeout)
+
+	report := &Report{
+		StartedAt:   time.Now(),
+		GoVersion:   runtime.Version(),
+		NumCPU:      runtime.NumCPU(),
+		Docs:        opts.Docs,
+		Concurrency: opts.Concurrency,
+		Lines:       opts.Lines,
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var errorsMu sync.Mutex
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				doc := SyntheticDocument(opts.Lines)
+				doc.Number = fmt.Sprintf("%08d", i+1)
+
+				start := time.Now()
+				ctx, cancel := service.JobContext()
+				response, err := service.ProcessDocument(ctx, doc, certPEM, keyPEM)
+				cancel()
+				record("total", time.Since(start))
+				if err != nil || response.Status != "SUCCESS" {
+					errorsMu.Lock()
+					report.Errors++
+					errorsMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < opts.Docs; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	elapsed := time.Since(report.StartedAt)
+	report.DurationMs = float64(elapsed) / float64(time.Millisecond)
+	report.DocsPerSecond = float64(opts.Docs) / elapsed.Seconds()
+	report.Stages = make(map[string]StageStats)
+	for stage, durations := range samples {
+		report.Stages[stage] = summarize(durations)
+	}
+
+	return report, nil
+}
+
+func summarize(durations []time.Duration) StageStats {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	percentile := func(p float64) float64 {
+		idx := int(p * float64(len(durations)-1))
+		return float64(durations[idx]) / float64(time.Millisecond)
+	}
+	return StageStats{
+		Count: len(durations),
+		P50:   percentile(0.50),
+		P90:   percentile(0.90),
+		P99:   percentile(0.99),
+		Max:   percentile(1),
+	}
+}
+
+// Print imprime el reporte en formato tabla
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "docs=%d concurrency=%d lines=%d errors=%d\n", r.Docs, r.Concurrency, r.Lines, r.Errors)
+	fmt.Fprintf(w, "duración=%.1fms throughput=%.1f docs/s\n\n", r.DurationMs, r.DocsPerSecond)
+	fmt.Fprintf(w, "%-14s %8s %10s %10s %10s %10s\n", "etapa", "n", "p50(ms)", "p90(ms)", "p99(ms)", "max(ms)")
+	for _, stage := range stageOrder {
+		stats, ok := r.Stages[stage]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "%-14s %8d %10.3f %10.3f %10.3f %10.3f\n", stage, stats.Count, stats.P50, stats.P90, stats.P99, stats.Max)
+	}
+}
+
+// WriteJSON exporta el reporte a un archivo JSON para comparar entre versiones
+func (r *Report) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// SyntheticDocument genera una factura válida con el número de líneas indicado
+func SyntheticDocument(lines int) *BusinessDocument {
+	address := Address{
+		Street:     "Av. Principal 123",
+		City:       "LIMA",
+		District:   "MIRAFLORES",
+		Province:   "LIMA",
+		Department: "LIMA",
+		Country:    "PE",
+		Ubigeo:     "150122",
+	}
+	doc := &BusinessDocument{
+		Type:      "01",
+		Series:    "F001",
+		Number:    "00000001",
+		IssueDate: time.Now().Format("2006-01-02"),
+		Currency:  "PEN",
+		Issuer:    Party{DocumentType: "6", DocumentID: "20123456786", Name: "EMPRESA BENCH S.A.C.", Address: address},
+		Customer:  Party{DocumentType: "6", DocumentID: "20123456794", Name: "CLIENTE BENCH S.A.C.", Address: address},
+	}
+
+	var subTotal, taxTotal float64
+	for i := 0; i < lines; i++ {
+		doc.Items = append(doc.Items, DocumentItem{
+			ID:          fmt.Sprintf("P%04d", i+1),
+			Description: fmt.Sprintf("Producto %d", i+1),
+			Quantity:    1,
+			UnitCode:    "NIU",
+			UnitPrice:   10,
+			LineTotal:   10,
+			Taxes:       []Tax{{TaxType: "1000", TaxAmount: 1.8, TaxRate: 18, TaxBase: 10}},
+		})
+		subTotal += 10
+		taxTotal += 1.8
+	}
+	doc.Taxes = []TaxTotal{{TaxType: "1000", TaxAmount: FlexFloat(taxTotal), TaxRate: 18, TaxBase: FlexFloat(subTotal)}}
+	doc.Totals = DocumentTotals{
+		SubTotal:      FlexFloat(subTotal),
+		TotalTaxes:    FlexFloat(taxTotal),
+		TotalAmount:   FlexFloat(subTotal + taxTotal),
+		PayableAmount: FlexFloat(subTotal + taxTotal),
+	}
+	return doc
+}
+
+// GenerateTestCertificate crea un certificado autofirmado y su clave en PEM
+func GenerateTestCertificate() ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "API-SUNAT bench"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,63 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BoletaIdentificationThreshold es el importe total en soles vigente desde From
+// (AAAA-MM-DD) por encima del cual la boleta debe identificar al adquiriente
+type BoletaIdentificationThreshold struct {
+	From   string  `json:"from"`
+	Amount float64 `json:"amount"`
+}
+
+// BoletaIdentificationThresholds es la tabla vigente: S/ 700 desde 2016-01-01 (R.S.
+// 274-2015/SUNAT, que modificó el Reglamento de Comprobantes de Pago)
+var BoletaIdentificationThresholds = []BoletaIdentificationThreshold{
+	{From: "2016-01-01", Amount: 700},
+}
+
+// ParseBoletaIdentificationThresholds lee una tabla de umbrales con el formato
+// "AAAA-MM-DD:monto,AAAA-MM-DD:monto" y la retorna ordenada por fecha
+func ParseBoletaIdentificationThresholds(value string) ([]BoletaIdentificationThreshold, error) {
+	var thresholds []BoletaIdentificationThreshold
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		from, amountText, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid boleta threshold %q: expected date:amount", entry)
+		}
+		if _, err := time.Parse("2006-01-02", from); err != nil {
+			return nil, fmt.Errorf("invalid boleta threshold date %q", from)
+		}
+		amount, err := strconv.ParseFloat(amountText, 64)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("invalid boleta threshold amount %q", amountText)
+		}
+		thresholds = append(thresholds, BoletaIdentificationThreshold{From: from, Amount: amount})
+	}
+	if len(thresholds) == 0 {
+		return nil, fmt.Errorf("empty boleta threshold table")
+	}
+	sort.SliceStable(thresholds, func(i, j int) bool { return thresholds[i].From < thresholds[j].From })
+	return thresholds, nil
+}
+
+// BoletaIdentificationThresholdAt retorna el umbral vigente en la fecha de emisión
+// según la tabla ordenada; 0 si la fecha es anterior al primer tramo
+func BoletaIdentificationThresholdAt(thresholds []BoletaIdentificationThreshold, issueDate string) float64 {
+	amount := 0.0
+	for _, t := range thresholds {
+		if t.From > issueDate {
+			break
+		}
+		amount = t.Amount
+	}
+	return amount
+}
@@ -0,0 +1,97 @@
+// Package catalog centraliza los catálogos de códigos de la guía XML de SUNAT y
+// los atributos (agencia, nombre y URI) con que se emite cada código en el UBL.
+package catalog
+
+import "sort"
+
+// Agencias responsables de las listas de códigos
+const (
+	AgencySunat = "PE:SUNAT"
+	AgencyUNECE = "United Nations Economic Commission for Europe"
+	AgencyINEI  = "PE:INEI"
+	AgencyGS1   = "GS1 US"
+)
+
+// URIPrefix es el prefijo de los URIs oficiales de los catálogos de SUNAT
+const URIPrefix = "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo"
+
+// Identificadores de los catálogos. Los numéricos son los de la guía de SUNAT; los
+// que no tienen número son listas que la guía usa sin catálogo propio.
+const (
+	DocumentType       = "01"
+	Currency           = "02"
+	UnitOfMeasure      = "03"
+	Country            = "04"
+	TaxType            = "05"
+	IdentityDocument   = "06"
+	IGVAffectation     = "07"
+	CreditNoteReason   = "09"
+	DebitNoteReason    = "10"
+	RelatedDocument    = "12"
+	Ubigeo             = "13"
+	PriceType          = "16"
+	ItemClassification = "25"
+	OperationType      = "51"
+	AllowanceCharge    = "53"
+	ItemProperty       = "55"
+	PaymentMeans       = "59"
+	TaxCategory        = "UN/ECE 5305"
+	Establishment      = "anexos"
+)
+
+// TaxIdentityDocumentName es el nombre del catálogo 06 en el CompanyID del emisor y del receptor
+const TaxIdentityDocumentName = "SUNAT:Identificador de Documento de Identidad"
+
+// Catalog describe los atributos con que se emite un código de la lista
+type Catalog struct {
+	ID         string
+	AgencyName string
+	Name       string
+	// ListID es el identificador de las listas internacionales (ISO, UN/ECE, UNSPSC)
+	ListID string
+	// URI es el URI oficial; solo los catálogos propios de SUNAT lo tienen
+	URI string
+}
+
+// sunat arma un catálogo propio de SUNAT con su URI oficial
+func sunat(id, name string) Catalog {
+	return Catalog{ID: id, AgencyName: AgencySunat, Name: name, URI: URIPrefix + id}
+}
+
+var catalogs = map[string]Catalog{
+	DocumentType:       sunat(DocumentType, "Tipo de Documento"),
+	Currency:           {ID: Currency, AgencyName: AgencyUNECE, Name: "Currency", ListID: "ISO 4217 Alpha"},
+	UnitOfMeasure:      {ID: UnitOfMeasure, AgencyName: AgencyUNECE, ListID: "UN/ECE rec 20"},
+	Country:            {ID: Country, AgencyName: AgencyUNECE, Name: "Country", ListID: "ISO 3166-1"},
+	TaxType:            {ID: TaxType, AgencyName: AgencySunat, Name: "Codigo de tributos", ListID: "UN/ECE 5153", URI: URIPrefix + TaxType},
+	IdentityDocument:   sunat(IdentityDocument, "Documento de Identidad"),
+	IGVAffectation:     sunat(IGVAffectation, "Afectacion del IGV"),
+	CreditNoteReason:   sunat(CreditNoteReason, "Tipo de nota de credito"),
+	DebitNoteReason:    sunat(DebitNoteReason, "Tipo de nota de debito"),
+	RelatedDocument:    sunat(RelatedDocument, "Documento Relacionado"),
+	Ubigeo:             {ID: Ubigeo, AgencyName: AgencyINEI, Name: "Ubigeos"},
+	PriceType:          sunat(PriceType, "Tipo de Precio"),
+	ItemClassification: {ID: ItemClassification, AgencyName: AgencyGS1, Name: "Item Classification", ListID: "UNSPSC"},
+	OperationType:      sunat(OperationType, "Tipo de Operacion"),
+	AllowanceCharge:    sunat(AllowanceCharge, "Cargo/descuento"),
+	ItemProperty:       sunat(ItemProperty, "Propiedad del item"),
+	PaymentMeans:       sunat(PaymentMeans, "Medio de pago"),
+	TaxCategory:        {ID: TaxCategory, AgencyName: AgencyUNECE, Name: "Tax Category Identifier", ListID: "UN/ECE 5305"},
+	Establishment:      {ID: Establishment, AgencyName: AgencySunat, Name: "Establecimientos anexos"},
+}
+
+// Lookup retorna el catálogo con el identificador indicado
+func Lookup(id string) (Catalog, bool) {
+	c, ok := catalogs[id]
+	return c, ok
+}
+
+// All retorna los catálogos ordenados por identificador
+func All() []Catalog {
+	all := make([]Catalog, 0, len(catalogs))
+	for _, c := range catalogs {
+		all = append(all, c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
+}
@@ -0,0 +1,285 @@
+package catalog
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Origen de una lista de códigos activa
+const (
+	SourceEmbedded = "embedded"
+	SourceOverride = "override"
+)
+
+// Code es un código de un catálogo con su descripción
+type Code struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// CodeList es el formato de los archivos JSON de catálogos, embebidos en data/ o en el
+// directorio de overrides: los códigos de un catálogo con su versión y la fecha
+// (AAAA-MM-DD) desde la que rigen
+type CodeList struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	ValidFrom string `json:"validFrom"`
+	Codes     []Code `json:"codes"`
+
+	source string
+	index  map[string]string
+}
+
+// ListVersion describe una lista de códigos activa
+type ListVersion struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	ValidFrom string `json:"validFrom"`
+	Source    string `json:"source"`
+	Codes     int    `json:"codes"`
+}
+
+// Override es una lista leída del directorio de overrides; Reason explica por qué no
+// quedó activa
+type Override struct {
+	ListVersion
+	Active bool   `json:"active"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// codePatterns es el formato de los códigos de cada lista; un override con un código
+// fuera de formato se rechaza
+var codePatterns = map[string]*regexp.Regexp{
+	UnitOfMeasure:      regexp.MustCompile(`^[A-Z0-9]{2,3}$`),
+	IGVAffectation:     regexp.MustCompile(`^\d{2}$`),
+	CreditNoteReason:   regexp.MustCompile(`^\d{2}$`),
+	DebitNoteReason:    regexp.MustCompile(`^\d{2}$`),
+	ItemClassification: regexp.MustCompile(`^\d{2}$`),
+	PaymentMeans:       regexp.MustCompile(`^\d{3}$`),
+}
+
+//go:embed data/*.json
+var embeddedData embed.FS
+
+var (
+	listsMu sync.RWMutex
+	// embeddedLists son las listas congeladas en el binario y activeLists las vigentes,
+	// con los overrides aplicados
+	embeddedLists   map[string]*CodeList
+	activeLists     map[string]*CodeList
+	embeddedVersion string
+)
+
+func init() {
+	lists, err := readCodeLists(embeddedData, "data", SourceEmbedded)
+	if err != nil {
+		panic(fmt.Sprintf("embedded catalogs: %v", err))
+	}
+	// Las listas embebidas se congelan juntas con una sola versión
+	for _, list := range lists {
+		if embeddedVersion == "" {
+			embeddedVersion = list.Version
+		}
+		if list.Version != embeddedVersion {
+			panic(fmt.Sprintf("embedded catalog %s has version %s, expected %s", list.ID, list.Version, embeddedVersion))
+		}
+	}
+	embeddedLists, activeLists = lists, lists
+}
+
+// readCodeLists lee y valida los archivos .json del directorio; un archivo inválido
+// invalida la carga completa
+func readCodeLists(fsys fs.FS, dir, source string) (map[string]*CodeList, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	lists := make(map[string]*CodeList)
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		list, err := parseCodeList(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path.Base(file), err)
+		}
+		if _, ok := lists[list.ID]; ok {
+			return nil, fmt.Errorf("%s: catalog %s is defined twice", path.Base(file), list.ID)
+		}
+		list.source = source
+		lists[list.ID] = list
+	}
+	return lists, nil
+}
+
+// parseCodeList decodifica una lista y valida su formato: campos desconocidos,
+// metadatos obligatorios, fecha de vigencia y códigos únicos con el formato del catálogo
+func parseCodeList(data []byte) (*CodeList, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var list CodeList
+	if err := decoder.Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	pattern, ok := codePatterns[list.ID]
+	if !ok {
+		return nil, fmt.Errorf("unknown catalog %q", list.ID)
+	}
+	if strings.TrimSpace(list.Version) == "" {
+		return nil, fmt.Errorf("catalog %s: version is required", list.ID)
+	}
+	if _, err := time.Parse("2006-01-02", list.ValidFrom); err != nil {
+		return nil, fmt.Errorf("catalog %s: validFrom must have the format YYYY-MM-DD", list.ID)
+	}
+	if len(list.Codes) == 0 {
+		return nil, fmt.Errorf("catalog %s: codes is empty", list.ID)
+	}
+	list.index = make(map[string]string, len(list.Codes))
+	for i, code := range list.Codes {
+		if !pattern.MatchString(code.Code) {
+			return nil, fmt.Errorf("catalog %s: codes[%d] %q does not match %s", list.ID, i, code.Code, pattern)
+		}
+		if strings.TrimSpace(code.Description) == "" {
+			return nil, fmt.Errorf("catalog %s: codes[%d] %s has no description", list.ID, i, code.Code)
+		}
+		if _, ok := list.index[code.Code]; ok {
+			return nil, fmt.Errorf("catalog %s: code %s is repeated", list.ID, code.Code)
+		}
+		list.index[code.Code] = code.Description
+	}
+	return &list, nil
+}
+
+// LoadOverrides lee las listas del directorio y las activa en lugar de las embebidas.
+// Por cada catálogo rige la lista con la vigencia más reciente que no sea posterior a
+// today: un override con validFrom futuro no se aplica todavía y uno anterior a la
+// lista embebida no la reemplaza. Si algún archivo es inválido no se aplica ninguno y
+// siguen activas las listas anteriores. Los catálogos sin override vuelven a los
+// embebidos.
+func LoadOverrides(dir, today string) ([]Override, error) {
+	lists, err := readCodeLists(os.DirFS(dir), ".", SourceOverride)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]*CodeList, len(embeddedLists))
+	for id, list := range embeddedLists {
+		active[id] = list
+	}
+	var overrides []Override
+	for _, id := range sortedIDs(lists) {
+		list := lists[id]
+		override := Override{ListVersion: list.version()}
+		switch {
+		case list.ValidFrom > today:
+			override.Reason = fmt.Sprintf("valid from %s", list.ValidFrom)
+		case list.ValidFrom < embeddedLists[id].ValidFrom:
+			override.Reason = fmt.Sprintf("embedded version %s is more recent (valid from %s)", embeddedLists[id].Version, embeddedLists[id].ValidFrom)
+		default:
+			override.Active = true
+			active[id] = list
+		}
+		overrides = append(overrides, override)
+	}
+
+	listsMu.Lock()
+	activeLists = active
+	listsMu.Unlock()
+	return overrides, nil
+}
+
+// ResetOverrides vuelve a las listas embebidas
+func ResetOverrides() {
+	listsMu.Lock()
+	activeLists = embeddedLists
+	listsMu.Unlock()
+}
+
+func activeList(id string) *CodeList {
+	listsMu.RLock()
+	defer listsMu.RUnlock()
+	return activeLists[id]
+}
+
+// Codes retorna los códigos activos del catálogo en el orden del archivo; nil si el
+// catálogo no tiene lista de códigos
+func Codes(id string) []Code {
+	if list := activeList(id); list != nil {
+		return list.Codes
+	}
+	return nil
+}
+
+// CodeValues retorna solo los códigos activos del catálogo
+func CodeValues(id string) []string {
+	codes := Codes(id)
+	values := make([]string, len(codes))
+	for i, code := range codes {
+		values[i] = code.Code
+	}
+	return values
+}
+
+// Description retorna la descripción de un código activo del catálogo
+func Description(id, code string) (string, bool) {
+	list := activeList(id)
+	if list == nil {
+		return "", false
+	}
+	description, ok := list.index[code]
+	return description, ok
+}
+
+// HasCode indica si el código está entre los activos del catálogo
+func HasCode(id, code string) bool {
+	_, ok := Description(id, code)
+	return ok
+}
+
+// Versions retorna las listas de códigos activas ordenadas por catálogo
+func Versions() []ListVersion {
+	listsMu.RLock()
+	defer listsMu.RUnlock()
+	versions := make([]ListVersion, 0, len(activeLists))
+	for _, id := range sortedIDs(activeLists) {
+		versions = append(versions, activeLists[id].version())
+	}
+	return versions
+}
+
+// Version identifica el conjunto de listas activo: la versión embebida, seguida de
+// "+catálogo@versión" por cada override aplicado (2024.06+03@2025.01)
+func Version() string {
+	version := embeddedVersion
+	for _, list := range Versions() {
+		if list.Source == SourceOverride {
+			version += "+" + list.ID + "@" + list.Version
+		}
+	}
+	return version
+}
+
+func (list *CodeList) version() ListVersion {
+	return ListVersion{ID: list.ID, Name: list.Name, Version: list.Version, ValidFrom: list.ValidFrom, Source: list.source, Codes: len(list.Codes)}
+}
+
+func sortedIDs(lists map[string]*CodeList) []string {
+	ids := make([]string, 0, len(lists))
+	for id := range lists {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,71 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IGVRate es la tasa del IGV (incluido el IPM) en porcentaje vigente desde From (AAAA-MM-DD)
+type IGVRate struct {
+	From string  `json:"from"`
+	Rate float64 `json:"rate"`
+}
+
+// IGVRates es la tabla histórica de tasas del IGV: 19% desde 2003-08-01 y 18% desde
+// 2011-03-01 (Ley 29666)
+var IGVRates = []IGVRate{
+	{From: "2003-08-01", Rate: 19},
+	{From: "2011-03-01", Rate: 18},
+}
+
+// ParseIGVRates lee una tabla de tasas con el formato "AAAA-MM-DD:tasa,AAAA-MM-DD:tasa"
+// y la retorna ordenada por fecha
+func ParseIGVRates(value string) ([]IGVRate, error) {
+	var rates []IGVRate
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		from, rateText, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid IGV rate %q: expected date:rate", entry)
+		}
+		if _, err := time.Parse("2006-01-02", from); err != nil {
+			return nil, fmt.Errorf("invalid IGV rate date %q", from)
+		}
+		rate, err := strconv.ParseFloat(rateText, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid IGV rate %q", rateText)
+		}
+		rates = append(rates, IGVRate{From: from, Rate: rate})
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("empty IGV rate table")
+	}
+	SortIGVRates(rates)
+	return rates, nil
+}
+
+// SortIGVRates ordena la tabla por fecha de inicio de vigencia
+func SortIGVRates(rates []IGVRate) {
+	sort.SliceStable(rates, func(i, j int) bool { return rates[i].From < rates[j].From })
+}
+
+// IGVRateAt retorna la tasa vigente en la fecha de emisión (AAAA-MM-DD) según la
+// tabla ordenada. Una fecha anterior al primer tramo usa la tasa más antigua.
+func IGVRateAt(rates []IGVRate, issueDate string) float64 {
+	if len(rates) == 0 {
+		return 0
+	}
+	rate := rates[0].Rate
+	for _, r := range rates {
+		if r.From > issueDate {
+			break
+		}
+		rate = r.Rate
+	}
+	return rate
+}
@@ -0,0 +1,19 @@
+package catalog
+
+import "regexp"
+
+var unspscCode = regexp.MustCompile(`^\d{8}$`)
+
+// IsUNSPSCCode indica si el código de producto tiene los 8 dígitos de la clasificación UNSPSC
+func IsUNSPSCCode(code string) bool {
+	return unspscCode.MatchString(code)
+}
+
+// UNSPSCSegment retorna la descripción del segmento del código de producto, si existe
+func UNSPSCSegment(code string) (string, bool) {
+	if len(code) < 2 {
+		return "", false
+	}
+	// Los segmentos UNSPSC v14 del catálogo 25 están en data/25.json
+	return Description(ItemClassification, code[:2])
+}
@@ -2,19 +2,350 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
-	Port         string `json:"port"`
-	XMLStorePath string `json:"xmlStorePath"`
-	LogLevel     string `json:"logLevel"`
+	Port         string  `json:"port"`
+	XMLStorePath string  `json:"xmlStorePath"`
+	LogLevel     string  `json:"logLevel"`
+	EnablePprof  bool    `json:"enablePprof"`
+	AdminAPIKey  string  `json:"-"`
+	AdminPort    string  `json:"adminPort"`
+	MinRSABits   int     `json:"minRsaBits"`
+	IGVRate      float64 `json:"igvRate"`
+	PadronURL    string  `json:"padronUrl"`
+	// CheckIssuerStatus consulta el padrón al procesar; IssuerStatusMode es "warning" o "error"
+	CheckIssuerStatus bool   `json:"checkIssuerStatus"`
+	IssuerStatusMode  string `json:"issuerStatusMode"`
+	// CheckCustomerName compara la razón social de los clientes con RUC contra el padrón
+	// y advierte si la similitud es menor que CustomerNameMinSimilarity
+	CheckCustomerName         bool    `json:"checkCustomerName"`
+	CustomerNameMinSimilarity float64 `json:"customerNameMinSimilarity"`
+	MaxItems          int    `json:"maxItems"`
+	MaxXMLBytes       int    `json:"maxXmlBytes"`
+	// MaxBatchDocuments es el número máximo de documentos de un lote de /convert/batch
+	MaxBatchDocuments int `json:"maxBatchDocuments"`
+	// TSAURL habilita el sellado de tiempo RFC 3161 de la firma
+	TSAURL         string `json:"tsaUrl"`
+	TSAFailOnError bool   `json:"tsaFailOnError"`
+	// DescriptionWhitespace es la política de whitespace en descripciones: preserve, collapse o strip
+	DescriptionWhitespace string `json:"descriptionWhitespace"`
+	// FixMojibake es off, fix (corrige los textos doblemente codificados con un warning)
+	// o strict (los rechaza con ERR_INVALID_ENCODING)
+	FixMojibake string `json:"fixMojibake"`
+	// Mode es el modo de operación: full, o validate-only para QA (firma con un
+	// certificado de prueba y no envía a SUNAT)
+	Mode string `json:"mode"`
+	// SunatCredentialsFile es un JSON con URL y credenciales SOL por emisor y ambiente
+	SunatCredentialsFile string `json:"sunatCredentialsFile"`
+	// SunatEnvironment es el ambiente usado cuando el request no indica uno
+	SunatEnvironment string `json:"sunatEnvironment"`
+	// SunatMock simula SUNAT sin red; los CDR se firman con SunatMockCertFile/SunatMockKeyFile
+	SunatMock              bool    `json:"sunatMock"`
+	SunatMockCertFile      string  `json:"sunatMockCertFile"`
+	SunatMockKeyFile       string  `json:"sunatMockKeyFile"`
+	SunatMockRejectSeries  string  `json:"sunatMockRejectSeries"`
+	SunatMockObserveAmount float64 `json:"sunatMockObserveAmount"`
+	// LogBufferSize es la cantidad de entradas retenidas en memoria para /admin/logs
+	LogBufferSize int `json:"logBufferSize"`
+	// LogFile persiste los logs en un archivo JSON consultable cuando salen del buffer
+	LogFile string `json:"logFile"`
+	// ValidationErrorStatus es el código HTTP de los documentos inválidos en /validate y /convert de v2
+	ValidationErrorStatus int `json:"validationErrorStatus"`
+	// V1UnifiedValidation hace que v1 responda los documentos inválidos como v2; sin
+	// activarlo v1 conserva su contrato congelado
+	V1UnifiedValidation bool `json:"v1UnifiedValidation"`
+	// HTTPProxy es el proxy corporativo de las salidas HTTP (SUNAT, padrón, TSA)
+	HTTPProxy           string        `json:"httpProxy"`
+	HTTPMaxConnsPerHost int           `json:"httpMaxConnsPerHost"`
+	SunatTimeout        time.Duration `json:"sunatTimeout"`
+	PadronTimeout       time.Duration `json:"padronTimeout"`
+	TSATimeout          time.Duration `json:"tsaTimeout"`
+	// MaxObservations y MaxObservationLength limitan las observaciones libres del emisor
+	MaxObservations      int `json:"maxObservations"`
+	MaxObservationLength int `json:"maxObservationLength"`
+	// JobTimeout es el tiempo máximo de los trabajos que no dependen de un request
+	JobTimeout time.Duration `json:"jobTimeout"`
+	// XMLEncoding es la codificación de los bytes del XML generado: utf8, utf8-bom o iso-8859-1
+	XMLEncoding string `json:"xmlEncoding"`
+	// XMLLineEnding es el fin de línea del XML firmado (lf o crlf) y XMLOmitDeclaration
+	// lo emite sin la declaración <?xml ...?>
+	XMLLineEnding      string `json:"xmlLineEnding"`
+	XMLOmitDeclaration bool   `json:"xmlOmitDeclaration"`
+	// StrictParsing rechaza los requests con campos que el modelo no declara
+	StrictParsing bool `json:"strictParsing"`
+	// DecimalSeparator es el separador decimal de los montos enviados como string: "." o ","
+	DecimalSeparator string `json:"decimalSeparator"`
+	// ReconcileInterval programa la reconciliación de envíos sin CDR; 0 la desactiva
+	ReconcileInterval        time.Duration `json:"reconcileInterval"`
+	ReconcileMinAge          time.Duration `json:"reconcileMinAge"`
+	ReconcileBatchSize       int           `json:"reconcileBatchSize"`
+	ReconcileRequestInterval time.Duration `json:"reconcileRequestInterval"`
+	// SOAPTraceEnabled guarda la petición y la respuesta SOAP crudas de cada envío, con
+	// las credenciales redactadas, hasta SOAPTraceMaxBytes por traza y durante
+	// SOAPTraceRetention; SOAPTracePurgeInterval programa la purga de las vencidas
+	SOAPTraceEnabled       bool          `json:"soapTraceEnabled"`
+	SOAPTraceMaxBytes      int           `json:"soapTraceMaxBytes"`
+	SOAPTraceRetention     time.Duration `json:"soapTraceRetention"`
+	SOAPTracePurgeInterval time.Duration `json:"soapTracePurgeInterval"`
+	// IGVRates es la tabla "AAAA-MM-DD:tasa,..." de tasas de IGV vigentes; vacía usa la
+	// tabla histórica. IGVRate, si no es cero, fija una sola tasa para cualquier fecha.
+	IGVRates string `json:"igvRates"`
+	// ProblemTypeBaseURI es la base de los type de los errores en Problem Details
+	// (RFC 7807), que se responden con Accept: application/problem+json; vacía usa
+	// /problems/
+	ProblemTypeBaseURI string `json:"problemTypeBaseUri"`
+	// CatalogOverridePath es el directorio con listas de códigos JSON que reemplazan a las
+	// embebidas desde su fecha de vigencia; vacío usa solo los catálogos embebidos
+	CatalogOverridePath string `json:"catalogOverridePath"`
+	// IGVRateCheck es "error" o "warning" cuando una línea no usa la tasa vigente en la emisión
+	IGVRateCheck string `json:"igvRateCheck"`
+	// BoletaIdentificationCheck es "error", "warning" u "off" para las boletas que superan
+	// el umbral sin identificar al cliente; BoletaIdentificationThresholds es la tabla de
+	// umbrales "AAAA-MM-DD:monto,..."
+	BoletaIdentificationCheck      string `json:"boletaIdentificationCheck"`
+	BoletaIdentificationThresholds string `json:"boletaIdentificationThresholds"`
+	// IssueDateCheck es "error", "warning" u "off" para las notas anteriores al documento
+	// que modifican o fuera de NoteMaxDays, y los comprobantes de contingencia posteriores
+	// a la caída declarada
+	IssueDateCheck string `json:"issueDateCheck"`
+	NoteMaxDays    int    `json:"noteMaxDays"`
+	// AmountWordsAccents conserva las tildes del monto en letras de la leyenda 1000
+	AmountWordsAccents bool `json:"amountWordsAccents"`
+	// CatalogURIs emite listURI/schemeURI en los códigos de catálogos SUNAT
+	CatalogURIs bool `json:"catalogURIs"`
+	// CertCheckInterval programa la revisión de vencimiento de certificados; 0 la desactiva
+	CertCheckInterval time.Duration `json:"certCheckInterval"`
+	// ClockSkewSource es el servidor NTP (host[:puerto]) o la URL https cuya cabecera Date
+	// se usa para medir el desvío del reloj; vacío desactiva el chequeo
+	ClockSkewSource        string        `json:"clockSkewSource"`
+	ClockSkewInterval      time.Duration `json:"clockSkewInterval"`
+	ClockSkewWarnThreshold time.Duration `json:"clockSkewWarnThreshold"`
+	// ClockSkewMode es "warning" o "strict"; en strict se bloquea la emisión si el
+	// desvío supera ClockSkewMax
+	ClockSkewMode string        `json:"clockSkewMode"`
+	ClockSkewMax  time.Duration `json:"clockSkewMax"`
+	// ValidationStatsInterval es cada cuánto se escriben en el store los conteos de
+	// errores de validación por regla; 0 desactiva las estadísticas
+	ValidationStatsInterval time.Duration `json:"validationStatsInterval"`
+	// CertAlertWebhookURL recibe las alertas de vencimiento de certificados como JSON
+	CertAlertWebhookURL string `json:"certAlertWebhookUrl"`
+	// SMTP para las alertas por correo; sin SMTPAddr o sin destinatarios no se envían
+	SMTPAddr         string `json:"smtpAddr"`
+	SMTPUsername     string `json:"smtpUsername"`
+	SMTPPassword     string `json:"-"`
+	SMTPFrom         string `json:"smtpFrom"`
+	CertAlertEmailTo string `json:"certAlertEmailTo"`
+	// EndOfDayTime es la hora de Lima (HH:MM) del cierre diario que verifica que todo lo
+	// emitido en el día fue enviado; vacío lo desactiva
+	EndOfDayTime string `json:"endOfDayTime"`
+	// EndOfDayAlertThreshold es la cantidad de pendientes tolerada sin notificar
+	EndOfDayAlertThreshold int    `json:"endOfDayAlertThreshold"`
+	EndOfDayWebhookURL     string `json:"endOfDayWebhookUrl"`
+	EndOfDayEmailTo        string `json:"endOfDayEmailTo"`
+	// SignatureReplace hace que firmar un XML ya firmado reemplace sus firmas en lugar
+	// de agregar una más
+	SignatureReplace bool `json:"signatureReplace"`
+	// AcceptedCertCAs son los CN (o DN) de las CAs acreditadas, separados por comas; en
+	// producción se rechaza firmar con certificados de otras CAs. Vacío acepta cualquier
+	// CA pero igual rechaza los autofirmados.
+	AcceptedCertCAs string `json:"acceptedCertCas"`
+	// SignatureIDReferenceIssuers son los RUC, separados por comas, cuyos documentos se
+	// firman con la ds:Reference apuntando al Id del elemento raíz (URI="#id")
+	SignatureIDReferenceIssuers string `json:"signatureIdReferenceIssuers"`
+	// PricingReferenceOmitIssuers son los RUC, separados por comas, cuyas líneas se
+	// emiten sin cac:PricingReference salvo que el request indique emitPricingReference
+	PricingReferenceOmitIssuers string `json:"pricingReferenceOmitIssuers"`
+	// TestIssuers y TestSeries son los RUC y las series, separados por comas, cuyos
+	// documentos se marcan como de prueba: se guardan en el subdirectorio prueba del
+	// store, no entran en reportes ni resúmenes y no pueden enviarse a producción
+	TestIssuers string `json:"testIssuers"`
+	// ConvertNegativeLines convierte las líneas con cantidad o precio negativo en
+	// descuentos en lugar de rechazarlas, salvo que el request indique convertNegativeLines
+	ConvertNegativeLines bool `json:"convertNegativeLines"`
+	TestSeries  string `json:"testSeries"`
+	// ClassificationCodeIssuers son los RUC, separados por comas, obligados a indicar el
+	// código de producto SUNAT (catálogo 25) en cada línea
+	ClassificationCodeIssuers string `json:"classificationCodeIssuers"`
+	// AuditRequests guarda en el store cada request de conversión, sin certificado ni clave
+	AuditRequests bool `json:"auditRequests"`
+	// RetentionYears es el período de conservación legal de los comprobantes: no se
+	// purgan documentos emitidos hace menos años
+	RetentionYears int `json:"retentionYears"`
+	// IssuerAPIKeys asocia API keys con los RUC que pueden consultar: "clave:RUC,clave:RUC"
+	IssuerAPIKeys string `json:"-"`
+	// CheckNoteBalance verifica que las notas de crédito no excedan el saldo del documento afectado
+	CheckNoteBalance bool `json:"checkNoteBalance"`
+	// EventsDriver habilita la publicación de eventos de documentos: "kafka-rest" (un
+	// Kafka REST Proxy, no los brokers de Kafka) o "nats"; EventsURLs son las URLs de
+	// los REST Proxy o de los servidores NATS
+	EventsDriver     string `json:"eventsDriver"`
+	EventsURLs       string `json:"eventsUrls"`
+	EventsTopic      string `json:"eventsTopic"`
+	EventsBufferSize int    `json:"eventsBufferSize"`
+	// EventsNATS* son las credenciales y el TLS de la conexión con NATS: token o usuario
+	// y contraseña, y la CA y el certificado de cliente si el servidor los exige
+	EventsNATSUser     string `json:"eventsNatsUser"`
+	EventsNATSPassword string `json:"-"`
+	EventsNATSToken    string `json:"-"`
+	EventsNATSTLS      bool   `json:"eventsNatsTls"`
+	EventsNATSCAFile   string `json:"eventsNatsCaFile"`
+	EventsNATSCertFile string `json:"eventsNatsCertFile"`
+	EventsNATSKeyFile  string `json:"eventsNatsKeyFile"`
+	// XMLStoreSecondaryPath es el directorio de contingencia si falla la escritura en
+	// XMLStorePath; vacío lo desactiva
+	XMLStoreSecondaryPath string        `json:"xmlStoreSecondaryPath"`
+	StorageResyncInterval time.Duration `json:"storageResyncInterval"`
+	// EncryptionKeyProvider cifra en reposo los artefactos del store con la clave maestra
+	// de static, file, aws-kms o gcp-kms; vacío no cifra
+	EncryptionKeyProvider string `json:"encryptionKeyProvider"`
+	// EncryptionMasterKey y EncryptionPreviousMasterKeys son las claves en base64 del
+	// proveedor static; las anteriores solo descifran
+	EncryptionMasterKey          string `json:"-"`
+	EncryptionPreviousMasterKeys string `json:"-"`
+	EncryptionKeyFile            string `json:"encryptionKeyFile"`
+	// EncryptionKMSKeyID es el ARN o alias de AWS KMS, o el recurso de la clave de GCP KMS
+	EncryptionKMSKeyID        string        `json:"encryptionKmsKeyId"`
+	EncryptionKMSRegion       string        `json:"encryptionKmsRegion"`
+	EncryptionKMSEndpoint     string        `json:"encryptionKmsEndpoint"`
+	EncryptionDataKeyRotation time.Duration `json:"encryptionDataKeyRotation"`
+	AWSAccessKeyID            string        `json:"-"`
+	AWSSecretAccessKey        string        `json:"-"`
+	AWSSessionToken           string        `json:"-"`
+	GCPAccessToken            string        `json:"-"`
+	// GzipMaxDecompressedBytes es el tamaño máximo de un body gzip ya descomprimido;
+	// GzipMinSize es el tamaño mínimo de una respuesta para comprimirla
+	GzipMaxDecompressedBytes int64 `json:"gzipMaxDecompressedBytes"`
+	GzipMinSize              int   `json:"gzipMinSize"`
+	// ValidationWorkers son las goroutines que validan las líneas de los documentos
+	// grandes; 0 usa GOMAXPROCS y 1 valida en forma secuencial
+	ValidationWorkers int `json:"validationWorkers"`
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		Port:         getEnvOrDefault("PORT", "8080"),
-		XMLStorePath: getEnvOrDefault("XML_STORE_PATH", "./xml_output"),
-		LogLevel:     getEnvOrDefault("LOG_LEVEL", "info"),
+		Port:                     getEnvOrDefault("PORT", "8080"),
+		XMLStorePath:             getEnvOrDefault("XML_STORE_PATH", "./xml_output"),
+		LogLevel:                 getEnvOrDefault("LOG_LEVEL", "info"),
+		EnablePprof:              getEnvBool("ENABLE_PPROF", false),
+		AdminAPIKey:              getEnvOrDefault("ADMIN_API_KEY", ""),
+		AdminPort:                getEnvOrDefault("ADMIN_PORT", ""),
+		MinRSABits:               getEnvInt("MIN_RSA_BITS", 2048),
+		IGVRate:                  getEnvFloat("IGV_RATE", 0),
+		IGVRates:                 getEnvOrDefault("IGV_RATES", ""),
+		IGVRateCheck:             getEnvOrDefault("IGV_RATE_CHECK", "error"),
+		CatalogOverridePath:      getEnvOrDefault("CATALOG_OVERRIDE_PATH", ""),
+		ProblemTypeBaseURI:       getEnvOrDefault("PROBLEM_TYPE_BASE_URI", ""),
+		BoletaIdentificationCheck:      getEnvOrDefault("BOLETA_IDENTIFICATION_CHECK", "error"),
+		BoletaIdentificationThresholds: getEnvOrDefault("BOLETA_IDENTIFICATION_THRESHOLDS", ""),
+		IssueDateCheck:                 getEnvOrDefault("ISSUE_DATE_CHECK", "error"),
+		NoteMaxDays:                    getEnvInt("NOTE_MAX_DAYS", 365),
+		AmountWordsAccents:       getEnvBool("AMOUNT_WORDS_ACCENTS", true),
+		CatalogURIs:              getEnvBool("CATALOG_URIS", true),
+		PadronURL:                getEnvOrDefault("PADRON_URL", ""),
+		CheckIssuerStatus:        getEnvBool("CHECK_ISSUER_STATUS", false),
+		IssuerStatusMode:         getEnvOrDefault("ISSUER_STATUS_MODE", "warning"),
+		CheckCustomerName:        getEnvBool("CHECK_CUSTOMER_NAME", false),
+		CustomerNameMinSimilarity: getEnvFloat("CUSTOMER_NAME_MIN_SIMILARITY", 0.85),
+		MaxItems:                 getEnvInt("MAX_ITEMS", 2000),
+		MaxXMLBytes:              getEnvInt("MAX_XML_BYTES", 10*1024*1024),
+		MaxBatchDocuments:        getEnvInt("MAX_BATCH_DOCUMENTS", 500),
+		TSAURL:                   getEnvOrDefault("TSA_URL", ""),
+		TSAFailOnError:           getEnvBool("TSA_FAIL_ON_ERROR", false),
+		DescriptionWhitespace:    getEnvOrDefault("DESCRIPTION_WHITESPACE", "preserve"),
+		FixMojibake:              getEnvOrDefault("FIX_MOJIBAKE", "off"),
+		Mode:                     getEnvOrDefault("MODE", "full"),
+		SunatCredentialsFile:     getEnvOrDefault("SUNAT_CREDENTIALS_FILE", ""),
+		SunatEnvironment:         getEnvOrDefault("SUNAT_ENVIRONMENT", "beta"),
+		SunatMock:                getEnvBool("SUNAT_MOCK", false),
+		SunatMockCertFile:        getEnvOrDefault("SUNAT_MOCK_CERT_FILE", "cert.pem"),
+		SunatMockKeyFile:         getEnvOrDefault("SUNAT_MOCK_KEY_FILE", "key.pem"),
+		SunatMockRejectSeries:    getEnvOrDefault("SUNAT_MOCK_REJECT_SERIES", ""),
+		SunatMockObserveAmount:   getEnvFloat("SUNAT_MOCK_OBSERVE_AMOUNT", 0),
+		LogBufferSize:            getEnvInt("LOG_BUFFER_SIZE", 10000),
+		LogFile:                  getEnvOrDefault("LOG_FILE", ""),
+		ValidationErrorStatus:    getEnvInt("VALIDATION_ERROR_STATUS", 422),
+		V1UnifiedValidation:      getEnvBool("V1_UNIFIED_VALIDATION", false),
+		HTTPProxy:                getEnvOrDefault("HTTP_PROXY", ""),
+		HTTPMaxConnsPerHost:      getEnvInt("HTTP_MAX_CONNS_PER_HOST", 20),
+		SunatTimeout:             getEnvDuration("SUNAT_TIMEOUT", 60*time.Second),
+		PadronTimeout:            getEnvDuration("PADRON_TIMEOUT", 10*time.Second),
+		TSATimeout:               getEnvDuration("TSA_TIMEOUT", 10*time.Second),
+		MaxObservations:          getEnvInt("MAX_OBSERVATIONS", 10),
+		MaxObservationLength:     getEnvInt("MAX_OBSERVATION_LENGTH", 200),
+		JobTimeout:               getEnvDuration("JOB_TIMEOUT", 5*time.Minute),
+		XMLEncoding:              getEnvOrDefault("XML_ENCODING", "utf8"),
+		XMLLineEnding:            getEnvOrDefault("XML_LINE_ENDING", "lf"),
+		XMLOmitDeclaration:       getEnvBool("XML_OMIT_DECLARATION", false),
+		StrictParsing:            getEnvBool("STRICT_PARSING", false),
+		DecimalSeparator:         getEnvOrDefault("DECIMAL_SEPARATOR", "."),
+		ReconcileInterval:        getEnvDuration("RECONCILE_INTERVAL", 0),
+		ReconcileMinAge:          getEnvDuration("RECONCILE_MIN_AGE", 2*time.Hour),
+		ReconcileBatchSize:       getEnvInt("RECONCILE_BATCH_SIZE", 50),
+		ReconcileRequestInterval: getEnvDuration("RECONCILE_REQUEST_INTERVAL", time.Second),
+		SOAPTraceEnabled:         getEnvBool("SOAP_TRACE_ENABLED", false),
+		SOAPTraceMaxBytes:        getEnvInt("SOAP_TRACE_MAX_BYTES", 256*1024),
+		SOAPTraceRetention:       getEnvDuration("SOAP_TRACE_RETENTION", 7*24*time.Hour),
+		SOAPTracePurgeInterval:   getEnvDuration("SOAP_TRACE_PURGE_INTERVAL", time.Hour),
+		CertCheckInterval:        getEnvDuration("CERT_CHECK_INTERVAL", 24*time.Hour),
+		ClockSkewSource:          getEnvOrDefault("CLOCK_SKEW_SOURCE", ""),
+		ClockSkewInterval:        getEnvDuration("CLOCK_SKEW_INTERVAL", 5*time.Minute),
+		ClockSkewWarnThreshold:   getEnvDuration("CLOCK_SKEW_WARN_THRESHOLD", 30*time.Second),
+		ClockSkewMode:            getEnvOrDefault("CLOCK_SKEW_MODE", "warning"),
+		ClockSkewMax:             getEnvDuration("CLOCK_SKEW_MAX", 2*time.Minute),
+		ValidationStatsInterval:  getEnvDuration("VALIDATION_STATS_INTERVAL", time.Minute),
+		CertAlertWebhookURL:      getEnvOrDefault("CERT_ALERT_WEBHOOK_URL", ""),
+		SMTPAddr:                 getEnvOrDefault("SMTP_ADDR", ""),
+		SMTPUsername:             getEnvOrDefault("SMTP_USERNAME", ""),
+		SMTPPassword:             getEnvOrDefault("SMTP_PASSWORD", ""),
+		SMTPFrom:                 getEnvOrDefault("SMTP_FROM", ""),
+		CertAlertEmailTo:         getEnvOrDefault("CERT_ALERT_EMAIL_TO", ""),
+		EndOfDayTime:             getEnvOrDefault("END_OF_DAY_TIME", ""),
+		EndOfDayAlertThreshold:   getEnvInt("END_OF_DAY_ALERT_THRESHOLD", 0),
+		EndOfDayWebhookURL:       getEnvOrDefault("END_OF_DAY_WEBHOOK_URL", ""),
+		EndOfDayEmailTo:          getEnvOrDefault("END_OF_DAY_EMAIL_TO", ""),
+		SignatureReplace:         getEnvBool("SIGNATURE_REPLACE", false),
+		AcceptedCertCAs:          getEnvOrDefault("ACCEPTED_CERT_CAS", ""),
+		SignatureIDReferenceIssuers: getEnvOrDefault("SIGNATURE_ID_REFERENCE_ISSUERS", ""),
+		PricingReferenceOmitIssuers: getEnvOrDefault("PRICING_REFERENCE_OMIT_ISSUERS", ""),
+		TestIssuers:              getEnvOrDefault("TEST_ISSUERS", "20000000001"),
+		TestSeries:               getEnvOrDefault("TEST_SERIES", ""),
+		ConvertNegativeLines:     getEnvBool("CONVERT_NEGATIVE_LINES", false),
+		ClassificationCodeIssuers: getEnvOrDefault("CLASSIFICATION_CODE_ISSUERS", ""),
+		AuditRequests:            getEnvBool("AUDIT_REQUESTS", false),
+		RetentionYears:           getEnvInt("DOCUMENT_RETENTION_YEARS", 5),
+		IssuerAPIKeys:            getEnvOrDefault("ISSUER_API_KEYS", ""),
+		CheckNoteBalance:         getEnvBool("CHECK_NOTE_BALANCE", false),
+		EventsDriver:             getEnvOrDefault("EVENTS_DRIVER", ""),
+		EventsURLs:               getEnvOrDefault("EVENTS_URLS", getEnvOrDefault("EVENTS_BROKERS", "")),
+		EventsTopic:              getEnvOrDefault("EVENTS_TOPIC", "sunat.documents"),
+		EventsBufferSize:         getEnvInt("EVENTS_BUFFER_SIZE", 1000),
+		EventsNATSUser:           getEnvOrDefault("EVENTS_NATS_USER", ""),
+		EventsNATSPassword:       getEnvOrDefault("EVENTS_NATS_PASSWORD", ""),
+		EventsNATSToken:          getEnvOrDefault("EVENTS_NATS_TOKEN", ""),
+		EventsNATSTLS:            getEnvBool("EVENTS_NATS_TLS", false),
+		EventsNATSCAFile:         getEnvOrDefault("EVENTS_NATS_CA_FILE", ""),
+		EventsNATSCertFile:       getEnvOrDefault("EVENTS_NATS_CERT_FILE", ""),
+		EventsNATSKeyFile:        getEnvOrDefault("EVENTS_NATS_KEY_FILE", ""),
+		XMLStoreSecondaryPath:    getEnvOrDefault("XML_STORE_SECONDARY_PATH", ""),
+		StorageResyncInterval:    getEnvDuration("STORAGE_RESYNC_INTERVAL", time.Minute),
+		EncryptionKeyProvider:    getEnvOrDefault("ENCRYPTION_KEY_PROVIDER", ""),
+		EncryptionMasterKey:      getEnvOrDefault("ENCRYPTION_MASTER_KEY", ""),
+		EncryptionPreviousMasterKeys: getEnvOrDefault("ENCRYPTION_PREVIOUS_MASTER_KEYS", ""),
+		EncryptionKeyFile:        getEnvOrDefault("ENCRYPTION_KEY_FILE", ""),
+		EncryptionKMSKeyID:       getEnvOrDefault("ENCRYPTION_KMS_KEY_ID", ""),
+		EncryptionKMSRegion:      getEnvOrDefault("ENCRYPTION_KMS_REGION", os.Getenv("AWS_REGION")),
+		EncryptionKMSEndpoint:    getEnvOrDefault("ENCRYPTION_KMS_ENDPOINT", ""),
+		EncryptionDataKeyRotation: getEnvDuration("ENCRYPTION_DATA_KEY_ROTATION", 24*time.Hour),
+		AWSAccessKeyID:           getEnvOrDefault("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey:       getEnvOrDefault("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken:          getEnvOrDefault("AWS_SESSION_TOKEN", ""),
+		GCPAccessToken:           getEnvOrDefault("GCP_ACCESS_TOKEN", ""),
+		GzipMaxDecompressedBytes: int64(getEnvInt("GZIP_MAX_DECOMPRESSED_BYTES", 64*1024*1024)),
+		GzipMinSize:              getEnvInt("GZIP_MIN_SIZE", 1024),
+		ValidationWorkers:        getEnvInt("VALIDATION_WORKERS", 0),
 	}
 }
 
@@ -23,4 +354,36 @@ func getEnvOrDefault(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-} 
\ No newline at end of file
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
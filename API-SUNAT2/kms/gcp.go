@@ -0,0 +1,162 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcpMetadataTokenURL es el endpoint del servidor de metadatos que entrega el token de
+// la cuenta de servicio de la instancia
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPProvider cifra las data keys con una clave de Cloud KMS (métodos encrypt y decrypt
+// del API REST)
+type GCPProvider struct {
+	keyName  string
+	endpoint string
+	client   *http.Client
+	// tokenURL es el endpoint de metadatos; se reemplaza en pruebas
+	tokenURL string
+
+	mu           sync.Mutex
+	token        string
+	tokenExpires time.Time
+	// staticToken evita consultar el servidor de metadatos
+	staticToken bool
+}
+
+// NewGCPProvider crea el proveedor de Cloud KMS. keyName es el recurso de la clave
+// (projects/p/locations/l/keyRings/r/cryptoKeys/k); con accessToken vacío el token se
+// obtiene del servidor de metadatos.
+func NewGCPProvider(keyName, endpoint, accessToken string, client *http.Client) (*GCPProvider, error) {
+	if !strings.HasPrefix(keyName, "projects/") || !strings.Contains(keyName, "/cryptoKeys/") {
+		return nil, fmt.Errorf("gcp-kms key provider requires a key resource name, got %q", keyName)
+	}
+	if endpoint == "" {
+		endpoint = "https://cloudkms.googleapis.com"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &GCPProvider{
+		keyName:     keyName,
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		client:      client,
+		tokenURL:    gcpMetadataTokenURL,
+		token:       accessToken,
+		staticToken: accessToken != "",
+	}, nil
+}
+
+// SetTokenURL reemplaza el servidor de metadatos del que se obtiene el token
+func (p *GCPProvider) SetTokenURL(tokenURL string) {
+	p.tokenURL = tokenURL
+}
+
+func (p *GCPProvider) KeyID() string {
+	return p.keyName
+}
+
+func (p *GCPProvider) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	var out struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	if err := p.call(ctx, "encrypt", map[string][]byte{"plaintext": plaintext}, &out); err != nil {
+		return nil, err
+	}
+	return out.Ciphertext, nil
+}
+
+func (p *GCPProvider) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	if err := p.call(ctx, "decrypt", map[string][]byte{"ciphertext": ciphertext}, &out); err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// call invoca keyName:method; Cloud KMS elige la versión primaria al cifrar y la
+// versión con que se cifró al descifrar
+func (p *GCPProvider) call(ctx context.Context, method string, input interface{}, output interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/v1/%s:%s", p.endpoint, p.keyName, method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gcp kms %s: %v", method, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &failure)
+		return fmt.Errorf("gcp kms %s: HTTP %d %s", method, resp.StatusCode, failure.Error.Message)
+	}
+	return json.Unmarshal(data, output)
+}
+
+// accessToken retorna el token fijo o el de la cuenta de servicio, renovándolo un
+// minuto antes de que venza
+func (p *GCPProvider) accessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.staticToken || (p.token != "" && time.Now().Before(p.tokenExpires)) {
+		return p.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("gcp metadata token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gcp metadata token: HTTP %d", resp.StatusCode)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("gcp metadata token: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("gcp metadata token: empty access token")
+	}
+	p.token = token.AccessToken
+	p.tokenExpires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
@@ -0,0 +1,240 @@
+// Package kms entrega la clave maestra con que se cifran en reposo las data keys de los
+// artefactos (envelope encryption): una clave estática para desarrollo, un archivo
+// protegido, AWS KMS o GCP KMS.
+package kms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Proveedores de la clave maestra
+const (
+	ProviderStatic = "static"
+	ProviderFile   = "file"
+	ProviderAWS    = "aws-kms"
+	ProviderGCP    = "gcp-kms"
+)
+
+// KeyProvider cifra y descifra data keys con la clave maestra, que nunca sale del
+// proveedor
+type KeyProvider interface {
+	// KeyID identifica la clave maestra vigente; si cambia, las data keys cifradas con la
+	// anterior se re-cifran al leerse
+	KeyID() string
+	// Encrypt cifra una data key con la clave maestra vigente
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+	// Decrypt descifra una data key cifrada con la clave maestra vigente o una anterior
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// Options configura el proveedor de la clave maestra
+type Options struct {
+	// Provider es static, file, aws-kms o gcp-kms
+	Provider string
+	// MasterKey es la clave estática en base64 (32 bytes); PreviousKeys son las anteriores,
+	// que solo se usan para descifrar
+	MasterKey    string
+	PreviousKeys []string
+	// KeyFile es el archivo con la clave, legible solo por su dueño
+	KeyFile string
+	// KeyID es el ARN o alias de la clave en AWS KMS, o el nombre del recurso en GCP KMS
+	// (projects/.../locations/.../keyRings/.../cryptoKeys/...)
+	KeyID string
+	// Region es la región de AWS KMS
+	Region string
+	// Endpoint reemplaza el endpoint del KMS (por ejemplo un VPC endpoint)
+	Endpoint string
+	// AWS son las credenciales de AWS KMS
+	AWS AWSCredentials
+	// GCPAccessToken es un token OAuth fijo para GCP KMS; vacío lo obtiene del servidor de
+	// metadatos
+	GCPAccessToken string
+}
+
+// IsValidProvider indica si el proveedor es conocido
+func IsValidProvider(provider string) bool {
+	switch provider {
+	case ProviderStatic, ProviderFile, ProviderAWS, ProviderGCP:
+		return true
+	}
+	return false
+}
+
+// New crea el proveedor de la clave maestra configurado; client es el cliente HTTP de
+// los KMS remotos
+func New(opts Options, client *http.Client) (KeyProvider, error) {
+	switch opts.Provider {
+	case ProviderStatic:
+		if opts.MasterKey == "" {
+			return nil, errors.New("static key provider requires a master key")
+		}
+		key, err := decodeKey(opts.MasterKey)
+		if err != nil {
+			return nil, err
+		}
+		var previous [][]byte
+		for _, encoded := range opts.PreviousKeys {
+			old, err := decodeKey(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid previous master key: %v", err)
+			}
+			previous = append(previous, old)
+		}
+		return NewStaticProvider(key, previous...)
+	case ProviderFile:
+		return NewFileProvider(opts.KeyFile)
+	case ProviderAWS:
+		return NewAWSProvider(opts.KeyID, opts.Region, opts.Endpoint, opts.AWS, client)
+	case ProviderGCP:
+		return NewGCPProvider(opts.KeyID, opts.Endpoint, opts.GCPAccessToken, client)
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", opts.Provider)
+	}
+}
+
+// decodeKey decodifica una clave de 32 bytes en base64
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key must be base64: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// fingerprintSize es la longitud de la huella de la clave con que se antepone cada data
+// key cifrada por un StaticProvider, para elegir la clave al descifrar
+const fingerprintSize = 8
+
+// StaticProvider cifra con AES-256-GCM usando una clave que el servicio conoce. Es
+// para desarrollo: la clave queda en el entorno o en un archivo del servidor.
+type StaticProvider struct {
+	id      string
+	current localKey
+	keys    map[string]cipher.AEAD
+}
+
+type localKey struct {
+	fingerprint []byte
+	aead        cipher.AEAD
+}
+
+// NewStaticProvider crea el proveedor con la clave vigente y las anteriores, que solo se
+// usan para descifrar
+func NewStaticProvider(key []byte, previous ...[]byte) (*StaticProvider, error) {
+	p := &StaticProvider{keys: make(map[string]cipher.AEAD)}
+	for i, k := range append([][]byte{key}, previous...) {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(k)
+		fingerprint := sum[:fingerprintSize]
+		p.keys[string(fingerprint)] = aead
+		if i == 0 {
+			p.current = localKey{fingerprint: fingerprint, aead: aead}
+			p.id = ProviderStatic + ":" + hex.EncodeToString(fingerprint)
+		}
+	}
+	return p, nil
+}
+
+// NewFileProvider lee la clave (32 bytes, en crudo o en base64) de un archivo que no
+// puede ser legible por el grupo ni por otros
+func NewFileProvider(path string) (*StaticProvider, error) {
+	if path == "" {
+		return nil, errors.New("file key provider requires a key file")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("key file %s must not be accessible by group or others (mode %v)", path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := data
+	if len(key) != 32 {
+		if key, err = decodeKey(string(data)); err != nil {
+			return nil, err
+		}
+	}
+	p, err := NewStaticProvider(key)
+	if err != nil {
+		return nil, err
+	}
+	p.id = ProviderFile + strings.TrimPrefix(p.id, ProviderStatic)
+	return p, nil
+}
+
+func (p *StaticProvider) KeyID() string {
+	return p.id
+}
+
+func (p *StaticProvider) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, p.current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append([]byte(nil), p.current.fingerprint...), nonce...)
+	return p.current.aead.Seal(out, nonce, plaintext, p.current.fingerprint), nil
+}
+
+func (p *StaticProvider) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < fingerprintSize {
+		return nil, errors.New("encrypted data key is too short")
+	}
+	fingerprint := ciphertext[:fingerprintSize]
+	aead, ok := p.keys[string(fingerprint)]
+	if !ok {
+		return nil, errors.New("data key was encrypted with an unknown master key")
+	}
+	rest := ciphertext[fingerprintSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("encrypted data key is too short")
+	}
+	return aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], fingerprint)
+}
+
+// unavailableProvider falla en cada operación; se usa cuando el proveedor configurado
+// no pudo crearse, para no guardar artefactos en claro
+type unavailableProvider struct {
+	err error
+}
+
+// Unavailable retorna un proveedor que falla siempre con err
+func Unavailable(err error) KeyProvider {
+	return unavailableProvider{err: err}
+}
+
+func (p unavailableProvider) KeyID() string {
+	return "unavailable"
+}
+
+func (p unavailableProvider) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return nil, fmt.Errorf("key provider unavailable: %v", p.err)
+}
+
+func (p unavailableProvider) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	return nil, fmt.Errorf("key provider unavailable: %v", p.err)
+}
@@ -1,18 +1,147 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"API-SUNAT2/api"
+	"API-SUNAT2/audit"
+	"API-SUNAT2/bench"
 	"API-SUNAT2/config"
+	"API-SUNAT2/migrate"
+	"API-SUNAT2/service"
+	"API-SUNAT2/storage"
+	"API-SUNAT2/util"
 )
 
+// shutdownTimeout es el tiempo que se espera a los requests en curso al apagar el servidor
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		runBench(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-store" {
+		runMigrateStore(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		runAudit(os.Args[2:])
+		return
+	}
+
 	cfg := config.LoadConfig()
-	router := api.NewRouter()
+	router, adminRouter, stopJobs := api.NewRouterWithShutdown(cfg)
 
+	servers := []*http.Server{{Addr: ":" + cfg.Port, Handler: router}}
+	if adminRouter != nil {
+		servers = append(servers, &http.Server{Addr: ":" + cfg.AdminPort, Handler: adminRouter})
+		log.Printf("Servidor de administración iniciado en el puerto %s", cfg.AdminPort)
+	}
 	log.Printf("Servidor iniciado en el puerto %s", cfg.Port)
-	if err := router.Run(":" + cfg.Port); err != nil {
-		log.Fatalf("Error al iniciar el servidor: %v", err)
+	for _, server := range servers {
+		go func(server *http.Server) {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Error al iniciar el servidor %s: %v", server.Addr, err)
+			}
+		}(server)
+	}
+
+	// Al recibir SIGINT o SIGTERM se terminan los requests en curso y después se
+	// detienen los jobs y se publican los eventos pendientes
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-ctx.Done()
+	log.Printf("Apagando el servidor")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error al apagar el servidor %s: %v", server.Addr, err)
+		}
+	}
+	stopJobs()
+}
+
+// runBench ejecuta una corrida sintética del pipeline: api-sunat bench --docs 1000 --concurrency 16
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	docs := fs.Int("docs", 1000, "número de documentos a procesar")
+	concurrency := fs.Int("concurrency", 16, "número de workers concurrentes")
+	lines := fs.Int("lines", 10, "líneas por documento")
+	timeout := fs.Duration("timeout", 0, "tiempo máximo por documento (default: 5m)")
+	output := fs.String("json", "", "ruta del archivo JSON donde exportar el reporte")
+	fs.Parse(args)
+
+	report, err := bench.Run(bench.Options{Docs: *docs, Concurrency: *concurrency, Lines: *lines, Timeout: *timeout})
+	if err != nil {
+		log.Fatalf("Error en el benchmark: %v", err)
+	}
+	report.Print(os.Stdout)
+
+	if *output != "" {
+		if err := report.WriteJSON(*output); err != nil {
+			log.Fatalf("Error al exportar el reporte: %v", err)
+		}
+	}
+}
+
+// runMigrateStore registra en el store los XML existentes: api-sunat migrate-store --from ./xml_output
+func runMigrateStore(args []string) {
+	cfg := config.LoadConfig()
+	fs := flag.NewFlagSet("migrate-store", flag.ExitOnError)
+	from := fs.String("from", cfg.XMLStorePath, "directorio con los XML firmados a migrar")
+	to := fs.String("to", cfg.XMLStorePath, "directorio del store de destino")
+	dryRun := fs.Bool("dry-run", false, "reporta lo que se migraría sin escribir")
+	output := fs.String("json", "", "ruta del archivo JSON donde exportar el reporte")
+	fs.Parse(args)
+
+	report, err := migrate.Run(migrate.Options{From: *from, DryRun: *dryRun}, storage.NewFileStore(*to), util.SystemClock{})
+	if err != nil {
+		log.Fatalf("Error en la migración: %v", err)
+	}
+	report.Print(os.Stdout)
+
+	if *output != "" {
+		if err := report.WriteJSON(*output); err != nil {
+			log.Fatalf("Error al exportar el reporte: %v", err)
+		}
+	}
+}
+
+// runAudit verifica la integridad de un directorio de XML firmados: api-sunat audit --dir ./historico --workers 8 --report reporte.csv
+func runAudit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	dir := fs.String("dir", "", "directorio con los XML firmados a verificar")
+	workers := fs.Int("workers", 8, "número de archivos que se verifican en paralelo")
+	output := fs.String("report", "", "ruta del archivo CSV con el resultado de cada archivo")
+	allowSHA1 := fs.Bool("allow-sha1", false, "acepta firmas rsa-sha1 (FACTURADOR SUNAT)")
+	allowMissingLineCount := fs.Bool("allow-missing-line-count", false, "acepta XML sin cbc:LineCountNumeric")
+	fs.Parse(args)
+	if *dir == "" {
+		log.Fatalf("Falta --dir con el directorio a verificar")
+	}
+
+	report, err := audit.Run(audit.Options{
+		Dir:           *dir,
+		Workers:       *workers,
+		Compatibility: service.CompatibilityOptions{AllowSHA1: *allowSHA1, AllowMissingLineCount: *allowMissingLineCount},
+	})
+	if err != nil {
+		log.Fatalf("Error en la verificación: %v", err)
+	}
+	report.Print(os.Stdout)
+
+	if *output != "" {
+		if err := report.WriteCSV(*output); err != nil {
+			log.Fatalf("Error al exportar el reporte: %v", err)
+		}
 	}
-} 
\ No newline at end of file
+}
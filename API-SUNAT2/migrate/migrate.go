@@ -0,0 +1,191 @@
+package migrate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+	. "API-SUNAT2/util"
+)
+
+// Options configura una migración de XML existentes al store
+type Options struct {
+	// From es el directorio con los XML firmados (RUC-TIPO-SERIE-NUMERO.xml)
+	From string
+	// DryRun reporta lo que se migraría sin escribir en el store
+	DryRun bool
+}
+
+// FailedFile es un archivo que no se pudo interpretar o migrar
+type FailedFile struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// Report resume el resultado de una migración
+type Report struct {
+	DryRun bool `json:"dryRun"`
+	// Scanned son los .xml encontrados; los demás archivos (ZIP, CDR, marcas) se ignoran
+	Scanned  int `json:"scanned"`
+	Migrated int `json:"migrated"`
+	// Updated son los registros existentes cuyo XML cambió
+	Updated int `json:"updated"`
+	// Skipped son los documentos que ya tenían un registro con el mismo hash
+	Skipped int `json:"skipped"`
+	// Normalized son los archivos cuyo correlativo tenía ceros a la izquierda y se
+	// copiaron al store con el nombre canónico
+	Normalized int          `json:"normalized"`
+	Failed     []FailedFile `json:"failed"`
+}
+
+// Run recorre opts.From y crea en el store el registro de cada XML firmado, copiando
+// el XML y su ZIP si aún no están en el store. Es idempotente: un documento cuyo
+// registro ya existe con el mismo hash no se vuelve a escribir.
+func Run(opts Options, store storage.DocumentStore, clock Clock) (*Report, error) {
+	var files []string
+	err := filepath.WalkDir(opts.From, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".xml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	report := &Report{DryRun: opts.DryRun, Failed: []FailedFile{}}
+	for _, path := range files {
+		report.Scanned++
+		status, normalized, err := migrateFile(path, opts.DryRun, store, clock)
+		if err != nil {
+			report.Failed = append(report.Failed, FailedFile{File: path, Reason: err.Error()})
+			continue
+		}
+		if normalized {
+			report.Normalized++
+		}
+		switch status {
+		case "migrated":
+			report.Migrated++
+		case "updated":
+			report.Updated++
+		default:
+			report.Skipped++
+		}
+	}
+	return report, nil
+}
+
+// migrateFile retorna el estado del documento y si su nombre se normalizó al
+// correlativo canónico
+func migrateFile(path string, dryRun bool, store storage.DocumentStore, clock Clock) (string, bool, error) {
+	xmlData, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	sourceName := filepath.Base(path)
+	record, err := ExtractDocumentRecord(sourceName, xmlData)
+	if err != nil {
+		return "", false, err
+	}
+	// Los archivos con ceros a la izquierda (F001-00000123) se guardan con el nombre
+	// canónico, el mismo que usa el pipeline, para que ambos converjan en un registro
+	sourceID := strings.TrimSuffix(sourceName, filepath.Ext(sourceName))
+	normalized := sourceID != record.DocumentID
+	fileName := record.DocumentID + ".xml"
+	record.XMLFile = fileName
+
+	zipPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".zip"
+	zipData, err := os.ReadFile(zipPath)
+	if err == nil {
+		hash := sha256.Sum256(zipData)
+		record.ZIPHash = hex.EncodeToString(hash[:])
+	}
+
+	status := "migrated"
+	if existing, err := store.Read(RecordName(record.DocumentID)); err == nil {
+		var previous DocumentRecord
+		if json.Unmarshal(existing, &previous) == nil && previous.XMLHash == record.XMLHash {
+			return "skipped", normalized, nil
+		}
+		status = "updated"
+	}
+	if dryRun {
+		return status, normalized, nil
+	}
+
+	// Copiar el XML y el ZIP si el store no es el mismo directorio de origen
+	if current, err := store.Read(fileName); err != nil || !bytes.Equal(current, xmlData) {
+		if _, err := store.Save(fileName, xmlData); err != nil {
+			return "", false, err
+		}
+	}
+	if zipData != nil {
+		zipName := record.DocumentID + ".zip"
+		if _, err := store.Read(zipName); err != nil {
+			if _, err := store.Save(zipName, zipData); err != nil {
+				return "", false, err
+			}
+		}
+	}
+
+	record.Source = RecordSourceMigration
+	record.CreatedAt = clock.Now()
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := store.Save(RecordName(record.DocumentID), recordJSON); err != nil {
+		return "", false, err
+	}
+	// Un registro previo con el nombre sin normalizar quedaría duplicado
+	if normalized {
+		if _, err := store.Read(RecordName(sourceID)); err == nil {
+			if err := store.Delete(RecordName(sourceID)); err != nil {
+				return "", false, err
+			}
+		}
+	}
+	return status, normalized, nil
+}
+
+// Print escribe el resumen de la migración en formato legible
+func (r *Report) Print(w io.Writer) {
+	mode := ""
+	if r.DryRun {
+		mode = " (dry-run, no se escribió nada)"
+	}
+	fmt.Fprintf(w, "Migración del store%s\n", mode)
+	fmt.Fprintf(w, "XML encontrados:  %d\n", r.Scanned)
+	fmt.Fprintf(w, "Migrados:         %d\n", r.Migrated)
+	fmt.Fprintf(w, "Actualizados:     %d\n", r.Updated)
+	fmt.Fprintf(w, "Ya registrados:   %d\n", r.Skipped)
+	fmt.Fprintf(w, "Normalizados:     %d\n", r.Normalized)
+	fmt.Fprintf(w, "No interpretados: %d\n", len(r.Failed))
+	for _, failed := range r.Failed {
+		fmt.Fprintf(w, "  %s: %s\n", failed.File, failed.Reason)
+	}
+}
+
+// WriteJSON exporta el reporte a un archivo JSON
+func (r *Report) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,61 @@
+package model
+
+import "time"
+
+// AccountingBreakdown es el desglose tributario de un comprobante del que se arma su
+// asiento: las bases por afectación, los tributos y el total a cobrar
+type AccountingBreakdown struct {
+	Currency string `json:"currency"`
+	// Taxable es la base imponible del IGV de las líneas gravadas, ISC incluido
+	Taxable    float64 `json:"taxable"`
+	Exonerated float64 `json:"exonerated"`
+	Unaffected float64 `json:"unaffected"`
+	Export     float64 `json:"export"`
+	// Free es el valor referencial de las líneas gratuitas; no entra al asiento
+	Free   float64 `json:"free"`
+	IGV    float64 `json:"igv"`
+	ISC    float64 `json:"isc"`
+	ICBPER float64 `json:"icbper"`
+	Total  float64 `json:"total"`
+}
+
+// AccountingLine es una línea del asiento: la cuenta, el concepto y el monto al debe o
+// al haber
+type AccountingLine struct {
+	Account string  `json:"account"`
+	Concept string  `json:"concept"`
+	Debit   float64 `json:"debit"`
+	Credit  float64 `json:"credit"`
+}
+
+// AccountingDivergence es un concepto cuyo monto en el XML emitido difiere del
+// calculado al emitir el documento
+type AccountingDivergence struct {
+	Concept string  `json:"concept"`
+	Issued  float64 `json:"issued"`
+	XML     float64 `json:"xml"`
+}
+
+// AccountingEntry es el asiento de un comprobante derivado de su XML emitido
+type AccountingEntry struct {
+	DocumentID   string              `json:"documentId"`
+	DocumentType string              `json:"documentType"`
+	Breakdown    AccountingBreakdown `json:"breakdown"`
+	Lines        []AccountingLine    `json:"lines"`
+	TotalDebit   float64             `json:"totalDebit"`
+	TotalCredit  float64             `json:"totalCredit"`
+	// Balanced indica que el debe y el haber cuadran
+	Balanced bool `json:"balanced"`
+	// Verified indica que el registro tiene el desglose de la emisión y se comparó con el
+	// del XML; Divergences son los conceptos que no coinciden
+	Verified    bool                   `json:"verified"`
+	Divergences []AccountingDivergence `json:"divergences"`
+}
+
+// AccountingAccountSet son las cuentas contables que un emisor asigna a cada concepto
+// del asiento, sobre las del plan contable por defecto
+type AccountingAccountSet struct {
+	IssuerRUC string            `json:"issuerRuc"`
+	Accounts  map[string]string `json:"accounts"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
@@ -0,0 +1,15 @@
+package model
+
+// AdvanceBalance es una factura de anticipo con lo regularizado y el saldo por aplicar
+type AdvanceBalance struct {
+	DocumentID         string  `json:"documentId"`
+	IssuerRUC          string  `json:"issuerRuc"`
+	CustomerDocumentID string  `json:"customerDocumentId"`
+	IssueDate          string  `json:"issueDate"`
+	Currency           string  `json:"currency"`
+	Amount             float64 `json:"amount"`
+	Applied            float64 `json:"applied"`
+	Balance            float64 `json:"balance"`
+	// Applications son las facturas que regularizaron el anticipo con el monto de cada una
+	Applications []AffectedDocument `json:"applications"`
+}
@@ -0,0 +1,76 @@
+package model
+
+import "encoding/json"
+
+// Modos de /convert/batch ante un documento que falla
+const (
+	// BatchOnErrorAbort valida todo el lote antes de firmar: con un documento inválido no
+	// se emite ninguno
+	BatchOnErrorAbort = "abort"
+	// BatchOnErrorContinue emite los documentos válidos y reporta los que fallan
+	BatchOnErrorContinue = "continue"
+)
+
+// Resultado de cada documento del lote
+const (
+	BatchItemSuccess = "SUCCESS"
+	BatchItemError   = "ERROR"
+	// BatchItemSkipped es un documento válido que no se procesó porque el lote se abortó
+	BatchItemSkipped = "SKIPPED"
+)
+
+// IsValidBatchOnError indica si el modo es abort o continue; vacío usa abort
+func IsValidBatchOnError(mode string) bool {
+	return mode == "" || mode == BatchOnErrorAbort || mode == BatchOnErrorContinue
+}
+
+// BatchConvertRequest es el cuerpo de /convert/batch: los documentos comparten el
+// certificado y la clave privada. Cada documento se decodifica por separado, así un
+// documento mal formado falla solo y no invalida el cuerpo completo.
+type BatchConvertRequest struct {
+	Documents   []json.RawMessage `json:"documents"`
+	Certificate string            `json:"certificate"`
+	PrivateKey  string            `json:"privateKey"`
+	OnError     string            `json:"onError,omitempty"`
+}
+
+// BatchItemResult es el resultado de un documento del lote; Index es su posición en el request
+type BatchItemResult struct {
+	Index            int               `json:"index"`
+	Status           string            `json:"status"`
+	DocumentID       string            `json:"documentId,omitempty"`
+	CorrelationID    string            `json:"correlationId,omitempty"`
+	XMLHash          string            `json:"xmlHash,omitempty"`
+	ErrorCode        string            `json:"errorCode,omitempty"`
+	ErrorMessage     string            `json:"errorMessage,omitempty"`
+	ValidationErrors []ValidationError `json:"validationErrors,omitempty"`
+	Warnings         []ValidationError `json:"warnings,omitempty"`
+}
+
+// BatchFailure es un documento fallido en el resumen del lote
+type BatchFailure struct {
+	Index            int               `json:"index"`
+	DocumentID       string            `json:"documentId,omitempty"`
+	ErrorCode        string            `json:"errorCode"`
+	ErrorMessage     string            `json:"errorMessage,omitempty"`
+	ValidationErrors []ValidationError `json:"validationErrors,omitempty"`
+}
+
+// BatchSummary resume el lote: los conteos por resultado y los índices fallidos con sus errores
+type BatchSummary struct {
+	OnError       string         `json:"onError"`
+	Total         int            `json:"total"`
+	Succeeded     int            `json:"succeeded"`
+	Failed        int            `json:"failed"`
+	Skipped       int            `json:"skipped"`
+	Aborted       bool           `json:"aborted"`
+	FailedIndices []int          `json:"failedIndices"`
+	Failures      []BatchFailure `json:"failures"`
+}
+
+// BatchResult es el resultado de /convert/batch, con un elemento por documento en el
+// orden del request
+type BatchResult struct {
+	Summary BatchSummary      `json:"summary"`
+	Items   []BatchItemResult `json:"items"`
+}
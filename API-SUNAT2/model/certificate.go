@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// CertificateRecord es el certificado de firma registrado para un emisor. Se registra
+// al firmar y se reemplaza cuando el emisor firma con otro certificado.
+type CertificateRecord struct {
+	IssuerRUC    string    `json:"issuerRuc"`
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serialNumber"`
+	NotAfter     time.Time `json:"notAfter"`
+	// Environment es el ambiente al que se asoció el certificado al registrarlo
+	Environment  string    `json:"environment,omitempty"`
+	RegisteredAt time.Time `json:"registeredAt"`
+	// NotifiedThresholds son los umbrales de vencimiento (en días) ya notificados
+	NotifiedThresholds []int `json:"notifiedThresholds,omitempty"`
+}
+
+// ExpiringCertificate es un certificado registrado que vence dentro de un umbral de alerta
+type ExpiringCertificate struct {
+	CertificateRecord
+	DaysLeft int `json:"daysLeft"`
+	// Threshold es el umbral más estricto alcanzado; 0 si el certificado ya venció
+	Threshold int `json:"threshold"`
+}
+
+// CertificateRegistrationRequest registra el certificado (PEM en base64) con que el
+// emisor va a firmar en el ambiente indicado
+type CertificateRegistrationRequest struct {
+	RUC         string `json:"ruc" binding:"required"`
+	Certificate string `json:"certificate" binding:"required"`
+	Environment string `json:"environment" binding:"required"`
+}
@@ -17,6 +17,10 @@ type BusinessDocument struct {
 	IssueDate    string                 `json:"issueDate"`
 	DueDate      string                 `json:"dueDate,omitempty"`
 	Currency     string                 `json:"currency"`
+	// Tipo de cambio a soles de un documento en moneda extranjera
+	ExchangeRate FlexFloat `json:"exchangeRate,omitempty"`
+	// Tipo de operación del catálogo 51 (ProfileID); por defecto 0101, venta interna
+	OperationType string `json:"operationType,omitempty"`
 	Issuer       Party                  `json:"issuer"`
 	Customer     Party                  `json:"customer"`
 	Items        []DocumentItem         `json:"items"`
@@ -24,6 +28,88 @@ type BusinessDocument struct {
 	Taxes        []TaxTotal             `json:"taxes"`
 	Additional   map[string]interface{} `json:"additional,omitempty"`
 	Reference    *DocumentReference     `json:"reference,omitempty"`
+	// Documentos que ajusta una nota consolidada, cada uno con su monto; reemplaza a
+	// Reference cuando la nota afecta a más de un documento
+	References []DocumentReference `json:"references,omitempty"`
+	VehiclePlate string                 `json:"vehiclePlate,omitempty"`
+	// Boletas canjeadas por esta factura (catálogo 12, código 03)
+	ExchangedDocuments []DocumentReference `json:"exchangedDocuments,omitempty"`
+	// Anticipos que regulariza esta factura: la factura de anticipo (documentType 01,
+	// serie-número) y el monto que se deduce de su saldo
+	Advances []DocumentReference `json:"advances,omitempty"`
+	// Comprobante físico de contingencia informado electrónicamente (serie numérica)
+	Contingency  bool                   `json:"contingency,omitempty"`
+	// Día de la caída declarada que obligó a emitir en contingencia (AAAA-MM-DD)
+	ContingencyDate string `json:"contingencyDate,omitempty"`
+	// Documento de prueba: no puede enviarse al ambiente de producción
+	Test         bool                   `json:"test,omitempty"`
+	// Forma de pago; sin indicar se emite al contado
+	PaymentTerms *PaymentTerms          `json:"paymentTerms,omitempty"`
+	// Percepción cobrada por un agente de percepción (solo boletas)
+	Perception   *Perception            `json:"perception,omitempty"`
+	// Los precios unitarios de los ítems incluyen IGV: el servicio deriva base, IGV y totales
+	PricesIncludeTax bool `json:"pricesIncludeTax,omitempty"`
+	// Texto libre del emisor ("Cuenta BCP: ...") emitido como cbc:Note tras las leyendas
+	Observations []string `json:"observations,omitempty"`
+	// Cuentas del emisor para el pago o la detracción, emitidas como cac:PaymentMeans
+	PaymentMeans []PaymentMean `json:"paymentMeans,omitempty"`
+	// Emite cac:PricingReference en las líneas; sin indicar decide la configuración del
+	// emisor. false lo omite para receptores que rechazan el bloque
+	EmitPricingReference *bool `json:"emitPricingReference,omitempty"`
+	// Descuento global que afecta la base imponible del IGV (catálogo 53, código 02):
+	// subTotal es el valor de las líneas menos el descuento
+	GlobalDiscount FlexFloat `json:"globalDiscount,omitempty"`
+	// Convierte las líneas con cantidad o precio negativo en descuentos en lugar de
+	// rechazarlas; sin indicar decide la configuración del servicio
+	ConvertNegativeLines *bool `json:"convertNegativeLines,omitempty"`
+	// TemplateFields son los campos que se completaron con la plantilla del emisor al
+	// decodificar el request; no forman parte del JSON del documento
+	TemplateFields []string `json:"-"`
+	// Interest es el cálculo de una nota de débito por intereses armada por el servicio;
+	// se registra con el documento y no forma parte del JSON del request
+	Interest *InterestCalculation `json:"-"`
+}
+
+// ConvertRequest es el cuerpo de /convert: el documento con el certificado y la
+// clave privada PEM codificados en base64
+type ConvertRequest struct {
+	Document    BusinessDocument `json:"document"`
+	Certificate string           `json:"certificate"`
+	PrivateKey  string           `json:"privateKey"`
+}
+
+// Perception es el monto percibido según el régimen del catálogo 53 (51, 52 o 53)
+type Perception struct {
+	RegimeCode string  `json:"regimeCode"`
+	// Rate es la tasa en porcentaje (2, 1 o 0.5)
+	Rate       FlexFloat `json:"rate"`
+	Base       FlexFloat `json:"base"`
+	Amount     FlexFloat `json:"amount"`
+	// TotalCharged es el total cobrado: importe total más percepción
+	TotalCharged FlexFloat `json:"totalCharged"`
+}
+
+// PaymentTerms es la forma de pago: "Contado" o "Credito" con sus cuotas
+type PaymentTerms struct {
+	Method       string        `json:"method"`
+	// Monto neto pendiente de pago; por defecto el importe total
+	Amount       FlexFloat       `json:"amount,omitempty"`
+	Installments []Installment `json:"installments,omitempty"`
+}
+
+// PaymentMean es una cuenta del emisor con su medio de pago del catálogo 59
+type PaymentMean struct {
+	Code      string `json:"code"`
+	// AccountID es el número de cuenta; con transferencia (003) el CCI de 20 dígitos
+	AccountID string `json:"accountId"`
+	FinancialInstitution string `json:"financialInstitution,omitempty"`
+	// Detraction indica la cuenta de detracciones del Banco de la Nación
+	Detraction bool `json:"detraction,omitempty"`
+}
+
+type Installment struct {
+	Amount  FlexFloat `json:"amount"`
+	DueDate string  `json:"dueDate"`
 }
 
 type Party struct {
@@ -32,6 +118,9 @@ type Party struct {
 	Name         string `json:"name"`
 	TradeName    string `json:"tradeName,omitempty"`
 	Address      Address `json:"address"`
+	// Datos de contacto emitidos en cac:Contact; los del emisor suelen venir de su plantilla
+	Email     string `json:"email,omitempty"`
+	Telephone string `json:"telephone,omitempty"`
 }
 
 type Address struct {
@@ -42,37 +131,71 @@ type Address struct {
 	Department  string `json:"department"`
 	Country     string `json:"country"`
 	PostalCode  string `json:"postalCode,omitempty"`
+	Ubigeo      string `json:"ubigeo,omitempty"`
 }
 
 type DocumentItem struct {
 	ID          string  `json:"id"`
 	Description string  `json:"description"`
-	Quantity    float64 `json:"quantity"`
+	Quantity    FlexFloat `json:"quantity"`
 	UnitCode    string  `json:"unitCode"`
-	UnitPrice   float64 `json:"unitPrice"`
-	LineTotal   float64 `json:"lineTotal"`
+	UnitPrice   FlexFloat `json:"unitPrice"`
+	LineTotal   FlexFloat `json:"lineTotal"`
 	Taxes       []Tax   `json:"taxes"`
+	// Línea informativa: se admite con cantidad cero y en ese caso no se emite en el XML
+	Informative bool    `json:"informative,omitempty"`
+	// Pasajero y servicio turístico de la línea (agencias de viaje y operadores turísticos)
+	TourismDetail *TourismDetail `json:"tourismDetail,omitempty"`
+	// Transferencia gratuita: el valor de la línea es referencial y no suma al total a pagar
+	Free bool `json:"free,omitempty"`
+	// Código de producto SUNAT (catálogo 25, UNSPSC de 8 dígitos), exigido para ciertos bienes fiscalizados
+	ClassificationCode string `json:"classificationCode,omitempty"`
+	// Descuento de la línea que afecta la base imponible (catálogo 53, código 00):
+	// lineTotal es el valor neto, cantidad × precio menos el descuento
+	Discount FlexFloat `json:"discount,omitempty"`
+}
+
+// TourismDetail es el servicio turístico prestado a un pasajero no domiciliado
+type TourismDetail struct {
+	// PassengerDocType es el tipo de documento del catálogo 06 (7 pasaporte, 4 carné de extranjería...)
+	PassengerDocType   string `json:"passengerDocType"`
+	PassengerDocNumber string `json:"passengerDocNumber"`
+	PassengerName      string `json:"passengerName"`
+	// ServiceType es "hospedaje" o "paquete" (paquete turístico)
+	ServiceType string `json:"serviceType"`
+	StartDate   string `json:"startDate"`
+	EndDate     string `json:"endDate"`
 }
 
 type DocumentTotals struct {
-	SubTotal     float64 `json:"subTotal"`
-	TotalTaxes   float64 `json:"totalTaxes"`
-	TotalAmount  float64 `json:"totalAmount"`
-	PayableAmount float64 `json:"payableAmount"`
+	SubTotal     FlexFloat `json:"subTotal"`
+	TotalTaxes   FlexFloat `json:"totalTaxes"`
+	TotalAmount  FlexFloat `json:"totalAmount"`
+	PayableAmount FlexFloat `json:"payableAmount"`
 }
 
 type TaxTotal struct {
 	TaxType   string  `json:"taxType"`
-	TaxAmount float64 `json:"taxAmount"`
-	TaxRate   float64 `json:"taxRate,omitempty"`
-	TaxBase   float64 `json:"taxBase,omitempty"`
+	TaxAmount FlexFloat `json:"taxAmount"`
+	TaxRate   FlexFloat `json:"taxRate,omitempty"`
+	TaxBase   FlexFloat `json:"taxBase,omitempty"`
 }
 
 type Tax struct {
 	TaxType   string  `json:"taxType"`
-	TaxAmount float64 `json:"taxAmount"`
-	TaxRate   float64 `json:"taxRate,omitempty"`
-	TaxBase   float64 `json:"taxBase,omitempty"`
+	TaxAmount FlexFloat `json:"taxAmount"`
+	TaxRate   FlexFloat `json:"taxRate,omitempty"`
+	TaxBase   FlexFloat `json:"taxBase,omitempty"`
+	// Tipo de afectación del IGV de la línea (catálogo 07): 10 gravado, 20 exonerado,
+	// 30 inafecto, 40 exportación y los retiros y transferencias gratuitas. Por defecto
+	// el que corresponde a TaxType.
+	AffectationCode string `json:"affectationCode,omitempty"`
+	// Sistema de cálculo del ISC (catálogo 08): 01 al valor, 02 específico, 03 precio de venta al público
+	IscSystem string `json:"iscSystem,omitempty"`
+	// Monto fijo por unidad del sistema específico (02)
+	IscAmountPerUnit FlexFloat `json:"iscAmountPerUnit,omitempty"`
+	// Precio de venta al público sugerido por unidad, IGV incluido, del sistema 03
+	RetailPrice FlexFloat `json:"retailPrice,omitempty"`
 }
 
 type DocumentReference struct {
@@ -80,12 +203,20 @@ type DocumentReference struct {
 	DocumentID   string `json:"documentId"`
 	IssueDate    string `json:"issueDate"`
 	Reason       string `json:"reason"`
+	// Motivo de la nota: catálogo 09 (crédito) o 10 (débito); por defecto "01"
+	ReasonCode   string `json:"reasonCode,omitempty"`
+	// Monto que ajusta la nota sobre este documento, solo en References
+	Amount FlexFloat `json:"amount,omitempty"`
+	// Documento de identidad del cliente del documento afectado, opcional en References
+	CustomerDocumentID string `json:"customerDocumentId,omitempty"`
 }
 
 // Estructuras UBL 2.1 XML
 type UBLInvoice struct {
 	XMLName                xml.Name               `xml:"Invoice"`
 	Xmlns                  string                 `xml:"xmlns,attr"`
+	// RootID es el atributo Id del elemento raíz, solo con firma por referencia a Id
+	RootID                 string                 `xml:"Id,attr,omitempty"`
 	UBLExtensions          *UBLExtensions         `xml:"ext:UBLExtensions"`
 	UBLVersionID           string                 `xml:"cbc:UBLVersionID"`
 	CustomizationID        UBLIDWithScheme        `xml:"cbc:CustomizationID"`
@@ -95,13 +226,18 @@ type UBLInvoice struct {
 	IssueTime              string                 `xml:"cbc:IssueTime,omitempty"`
 	DueDate                string                 `xml:"cbc:DueDate,omitempty"`
 	InvoiceTypeCode        UBLTypeCode            `xml:"cbc:InvoiceTypeCode"`
-	DocumentCurrencyCode   UBLIDWithScheme        `xml:"cbc:DocumentCurrencyCode"`
+	Notes                  []UBLNote              `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode   UBLTypeCode            `xml:"cbc:DocumentCurrencyCode"`
 	LineCountNumeric       int                    `xml:"cbc:LineCountNumeric"`
-	Note                   string                 `xml:"cbc:Note,omitempty"`
+	OrderReference         *UBLOrderReference     `xml:"cac:OrderReference,omitempty"`
+	AdditionalDocumentReference []UBLAdditionalDocumentReference `xml:"cac:AdditionalDocumentReference,omitempty"`
 	Signature              *UBLSignature          `xml:"cac:Signature"`
 	AccountingSupplierParty UBLParty              `xml:"cac:AccountingSupplierParty"`
 	AccountingCustomerParty UBLParty              `xml:"cac:AccountingCustomerParty"`
+	PaymentMeans           []UBLPaymentMeans      `xml:"cac:PaymentMeans,omitempty"`
 	PaymentTerms           []UBLPaymentTerms      `xml:"cac:PaymentTerms,omitempty"`
+	PrepaidPayments        []UBLPrepaidPayment    `xml:"cac:PrepaidPayment,omitempty"`
+	AllowanceCharge        []UBLAllowanceCharge   `xml:"cac:AllowanceCharge,omitempty"`
 	TaxTotal               []UBLTaxTotal          `xml:"cac:TaxTotal"`
 	LegalMonetaryTotal     UBLLegalMonetaryTotal  `xml:"cac:LegalMonetaryTotal"`
 	InvoiceLines           []UBLInvoiceLine       `xml:"cac:InvoiceLine"`
@@ -110,6 +246,8 @@ type UBLInvoice struct {
 type UBLCreditNote struct {
 	XMLName                xml.Name               `xml:"CreditNote"`
 	Xmlns                  string                 `xml:"xmlns,attr"`
+	// RootID es el atributo Id del elemento raíz, solo con firma por referencia a Id
+	RootID                 string                 `xml:"Id,attr,omitempty"`
 	XmlnsCac               string                 `xml:"xmlns:cac,attr"`
 	XmlnsCbc               string                 `xml:"xmlns:cbc,attr"`
 	XmlnsDs                string                 `xml:"xmlns:ds,attr"`
@@ -122,9 +260,11 @@ type UBLCreditNote struct {
 	IssueDate              string                 `xml:"cbc:IssueDate"`
 	IssueTime              string                 `xml:"cbc:IssueTime,omitempty"`
 	CreditNoteTypeCode     UBLTypeCode            `xml:"cbc:CreditNoteTypeCode"`
-	DocumentCurrencyCode   UBLIDWithScheme        `xml:"cbc:DocumentCurrencyCode"`
+	Notes                  []UBLNote              `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode   UBLTypeCode            `xml:"cbc:DocumentCurrencyCode"`
 	LineCountNumeric       int                    `xml:"cbc:LineCountNumeric"`
 	DiscrepancyResponse    []UBLDiscrepancyResponse `xml:"cac:DiscrepancyResponse"`
+	OrderReference         *UBLOrderReference     `xml:"cac:OrderReference,omitempty"`
 	BillingReference       []UBLBillingReference  `xml:"cac:BillingReference"`
 	Signature              *UBLSignature          `xml:"cac:Signature,omitempty"`
 	AccountingSupplierParty UBLParty              `xml:"cac:AccountingSupplierParty"`
@@ -138,6 +278,8 @@ type UBLCreditNote struct {
 type UBLDebitNote struct {
 	XMLName                xml.Name               `xml:"DebitNote"`
 	Xmlns                  string                 `xml:"xmlns,attr"`
+	// RootID es el atributo Id del elemento raíz, solo con firma por referencia a Id
+	RootID                 string                 `xml:"Id,attr,omitempty"`
 	XmlnsCac               string                 `xml:"xmlns:cac,attr"`
 	XmlnsCbc               string                 `xml:"xmlns:cbc,attr"`
 	XmlnsDs                string                 `xml:"xmlns:ds,attr"`
@@ -150,9 +292,11 @@ type UBLDebitNote struct {
 	IssueDate              string                 `xml:"cbc:IssueDate"`
 	IssueTime              string                 `xml:"cbc:IssueTime,omitempty"`
 	DebitNoteTypeCode      UBLTypeCode            `xml:"cbc:DebitNoteTypeCode"`
-	DocumentCurrencyCode   UBLIDWithScheme        `xml:"cbc:DocumentCurrencyCode"`
+	Notes                  []UBLNote              `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode   UBLTypeCode            `xml:"cbc:DocumentCurrencyCode"`
 	LineCountNumeric       int                    `xml:"cbc:LineCountNumeric"`
 	DiscrepancyResponse    []UBLDiscrepancyResponse `xml:"cac:DiscrepancyResponse"`
+	OrderReference         *UBLOrderReference     `xml:"cac:OrderReference,omitempty"`
 	BillingReference       []UBLBillingReference  `xml:"cac:BillingReference"`
 	Signature              *UBLSignature          `xml:"cac:Signature,omitempty"`
 	AccountingSupplierParty UBLParty              `xml:"cac:AccountingSupplierParty"`
@@ -224,8 +368,8 @@ type UBLPartyName struct {
 }
 
 type UBLRegistrationAddress struct {
-	ID                 UBLIDWithScheme `xml:"cbc:ID,omitempty"`
-	AddressTypeCode    UBLIDWithScheme `xml:"cbc:AddressTypeCode,omitempty"`
+	ID                 *UBLIDWithScheme `xml:"cbc:ID,omitempty"`
+	AddressTypeCode    UBLTypeCode     `xml:"cbc:AddressTypeCode,omitempty"`
 	CityName           string          `xml:"cbc:CityName"`
 	CountrySubentity   string          `xml:"cbc:CountrySubentity"`
 	District           string          `xml:"cbc:District"`
@@ -238,7 +382,7 @@ type UBLAddressLine struct {
 }
 
 type UBLCountry struct {
-	IdentificationCode UBLIDWithScheme `xml:"cbc:IdentificationCode"`
+	IdentificationCode UBLTypeCode     `xml:"cbc:IdentificationCode"`
 }
 
 type UBLPartyTaxScheme struct {
@@ -259,7 +403,9 @@ type UBLPartyLegalEntity struct {
 }
 
 type UBLContact struct {
-	Name string `xml:"cbc:Name,omitempty"`
+	Name           string `xml:"cbc:Name,omitempty"`
+	Telephone      string `xml:"cbc:Telephone,omitempty"`
+	ElectronicMail string `xml:"cbc:ElectronicMail,omitempty"`
 }
 
 type UBLTaxTotal struct {
@@ -280,14 +426,20 @@ type UBLTaxSubtotal struct {
 
 type UBLTaxCategory struct {
 	ID                    UBLIDWithScheme `xml:"cbc:ID"`
-	Percent               float64         `xml:"cbc:Percent,omitempty"`
-	TaxExemptionReasonCode UBLIDWithScheme `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	Percent               Decimal2        `xml:"cbc:Percent"`
+	PerUnitAmount         *UBLAmountWithCurrency `xml:"cbc:PerUnitAmount,omitempty"`
+	// El código de afectación es del IGV: el ISC no lo lleva
+	TaxExemptionReasonCode *UBLTypeCode    `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	// Sistema de cálculo del ISC
+	TierRange             string          `xml:"cbc:TierRange,omitempty"`
 	TaxScheme             UBLTaxScheme    `xml:"cac:TaxScheme"`
 }
 
 type UBLLegalMonetaryTotal struct {
 	LineExtensionAmount UBLAmountWithCurrency `xml:"cbc:LineExtensionAmount"`
 	TaxInclusiveAmount  UBLAmountWithCurrency `xml:"cbc:TaxInclusiveAmount"`
+	// PrepaidAmount es el total de anticipos deducidos, solo en la factura que los regulariza
+	PrepaidAmount       *UBLAmountWithCurrency `xml:"cbc:PrepaidAmount,omitempty"`
 	PayableAmount       UBLAmountWithCurrency `xml:"cbc:PayableAmount"`
 }
 
@@ -296,6 +448,8 @@ type UBLInvoiceLine struct {
 	InvoicedQuantity    UBLQuantityWithUnit   `xml:"cbc:InvoicedQuantity"`
 	LineExtensionAmount UBLAmountWithCurrency `xml:"cbc:LineExtensionAmount"`
 	PricingReference    *UBLPricingReference  `xml:"cac:PricingReference,omitempty"`
+	// AllowanceCharge es el descuento de la línea
+	AllowanceCharge     []UBLAllowanceCharge  `xml:"cac:AllowanceCharge,omitempty"`
 	TaxTotal            []UBLTaxTotal         `xml:"cac:TaxTotal"`
 	Item                UBLItem               `xml:"cac:Item"`
 	Price               UBLPrice              `xml:"cac:Price"`
@@ -324,7 +478,7 @@ type UBLPricingReference struct {
 
 type UBLAlternativeConditionPrice struct {
 	PriceAmount   UBLAmountWithCurrency `xml:"cbc:PriceAmount"`
-	PriceTypeCode UBLIDWithScheme       `xml:"cbc:PriceTypeCode"`
+	PriceTypeCode UBLTypeCode           `xml:"cbc:PriceTypeCode"`
 }
 
 type UBLPrice struct {
@@ -332,9 +486,24 @@ type UBLPrice struct {
 }
 
 type UBLItem struct {
-	Description              string                    `xml:"cbc:Description"`
+	Description              UBLText                   `xml:"cbc:Description"`
 	SellersItemIdentification *UBLSellersItemIdentification `xml:"cac:SellersItemIdentification,omitempty"`
 	CommodityClassification  *UBLCommodityClassification  `xml:"cac:CommodityClassification,omitempty"`
+	AdditionalItemProperty   []UBLAdditionalItemProperty  `xml:"cac:AdditionalItemProperty,omitempty"`
+}
+
+type UBLAdditionalItemProperty struct {
+	Name     string      `xml:"cbc:Name"`
+	NameCode UBLTypeCode `xml:"cbc:NameCode"`
+	Value    string      `xml:"cbc:Value,omitempty"`
+	// Las propiedades de fechas y duración del catálogo 55 van en cac:UsabilityPeriod
+	UsabilityPeriod *UBLUsabilityPeriod `xml:"cac:UsabilityPeriod,omitempty"`
+}
+
+type UBLUsabilityPeriod struct {
+	StartDate       string              `xml:"cbc:StartDate,omitempty"`
+	EndDate         string              `xml:"cbc:EndDate,omitempty"`
+	DurationMeasure *UBLQuantityWithUnit `xml:"cbc:DurationMeasure,omitempty"`
 }
 
 type UBLSellersItemIdentification struct {
@@ -342,15 +511,20 @@ type UBLSellersItemIdentification struct {
 }
 
 type UBLCommodityClassification struct {
-	ItemClassificationCode UBLIDWithScheme `xml:"cbc:ItemClassificationCode"`
+	ItemClassificationCode UBLTypeCode     `xml:"cbc:ItemClassificationCode"`
 }
 
 type UBLDiscrepancyResponse struct {
 	ReferenceID string `xml:"cbc:ReferenceID"`
-	ResponseCode string `xml:"cbc:ResponseCode"`
+	ResponseCode UBLTypeCode `xml:"cbc:ResponseCode"`
 	Description string `xml:"cbc:Description"`
 }
 
+// UBLOrderReference es la orden de compra del cliente a la que corresponde el comprobante
+type UBLOrderReference struct {
+	ID string `xml:"cbc:ID"`
+}
+
 type UBLBillingReference struct {
 	InvoiceDocumentReference UBLDocumentReference `xml:"cac:InvoiceDocumentReference"`
 }
@@ -358,7 +532,27 @@ type UBLBillingReference struct {
 type UBLDocumentReference struct {
 	ID        string `xml:"cbc:ID"`
 	IssueDate string `xml:"cbc:IssueDate"`
-	DocumentTypeCode string `xml:"cbc:DocumentTypeCode"`
+	DocumentTypeCode UBLTypeCode `xml:"cbc:DocumentTypeCode"`
+}
+
+// UBLNote es una nota o leyenda del comprobante; LanguageLocaleID lleva el código del catálogo 52
+type UBLNote struct {
+	LanguageLocaleID string `xml:"languageLocaleID,attr,omitempty"`
+	Value            string `xml:",chardata"`
+}
+
+type UBLAdditionalDocumentReference struct {
+	ID               string      `xml:"cbc:ID"`
+	DocumentTypeCode UBLTypeCode `xml:"cbc:DocumentTypeCode"`
+	// DocumentStatusCode enlaza un anticipo con su cac:PrepaidPayment
+	DocumentStatusCode *UBLTypeCode `xml:"cbc:DocumentStatusCode,omitempty"`
+}
+
+// UBLPrepaidPayment es un anticipo deducido; su ID coincide con el DocumentStatusCode
+// de la AdditionalDocumentReference de la factura de anticipo
+type UBLPrepaidPayment struct {
+	ID         UBLIDWithScheme       `xml:"cbc:ID"`
+	PaidAmount UBLAmountWithCurrency `xml:"cbc:PaidAmount"`
 }
 
 type UBLTypeCode struct {
@@ -370,9 +564,40 @@ type UBLTypeCode struct {
 	Value          string `xml:",chardata"`
 }
 
+// UBLPaymentMeans es un medio de pago (catálogo 59) con la cuenta del emisor
+type UBLPaymentMeans struct {
+	ID                    string               `xml:"cbc:ID,omitempty"`
+	PaymentMeansCode      UBLTypeCode          `xml:"cbc:PaymentMeansCode"`
+	PayeeFinancialAccount UBLFinancialAccount  `xml:"cac:PayeeFinancialAccount"`
+}
+
+type UBLFinancialAccount struct {
+	ID                         string     `xml:"cbc:ID"`
+	FinancialInstitutionBranch *UBLBranch `xml:"cac:FinancialInstitutionBranch,omitempty"`
+}
+
+type UBLBranch struct {
+	FinancialInstitution UBLFinancialInstitution `xml:"cac:FinancialInstitution"`
+}
+
+type UBLFinancialInstitution struct {
+	Name string `xml:"cbc:Name"`
+}
+
 type UBLPaymentTerms struct {
 	ID              string `xml:"cbc:ID"`
-	PaymentMeansID  string `xml:"cbc:PaymentMeansID"`
+	PaymentMeansID  string `xml:"cbc:PaymentMeansID,omitempty"`
+	Amount          *UBLAmountWithCurrency `xml:"cbc:Amount,omitempty"`
+	PaymentDueDate  string `xml:"cbc:PaymentDueDate,omitempty"`
+}
+
+// UBLAllowanceCharge es un cargo o descuento, global o de línea (catálogo 53)
+type UBLAllowanceCharge struct {
+	ChargeIndicator           bool                  `xml:"cbc:ChargeIndicator"`
+	AllowanceChargeReasonCode UBLTypeCode           `xml:"cbc:AllowanceChargeReasonCode"`
+	MultiplierFactorNumeric   float64               `xml:"cbc:MultiplierFactorNumeric"`
+	Amount                    UBLAmountWithCurrency `xml:"cbc:Amount"`
+	BaseAmount                UBLAmountWithCurrency `xml:"cbc:BaseAmount"`
 }
 
 type UBLDelivery struct {
@@ -456,8 +681,12 @@ type APIResponse struct {
 	ErrorCode     string                 `json:"errorCode,omitempty"`
 	ErrorMessage  string                 `json:"errorMessage,omitempty"`
 	ValidationErrors []ValidationError   `json:"validationErrors,omitempty"`
+	Timings       map[string]float64     `json:"timings,omitempty"`
+	Warnings      []ValidationError      `json:"warnings,omitempty"`
 	Data          map[string]interface{} `json:"data,omitempty"`
 	Message       string                 `json:"message,omitempty"`
+	// Environment es "validate-only" en los despliegues que no firman ni envían a SUNAT
+	Environment   string                 `json:"environment,omitempty"`
 }
 
 type ValidationError struct {
@@ -466,6 +695,8 @@ type ValidationError struct {
 	Received string `json:"received"`
 	Rule     string `json:"rule"`
 	Message  string `json:"message"`
+	// Suggestion indica cómo corregir el error, solo cuando el validador puede calcularlo
+	Suggestion string `json:"suggestion,omitempty"`
 }
 
 type OperationLog struct {
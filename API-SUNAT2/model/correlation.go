@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// CorrelationRecord es el resultado de un procesamiento de un documento, identificado
+// por el correlationId que recibió el cliente
+type CorrelationRecord struct {
+	CorrelationID string `json:"correlationId"`
+	DocumentID    string `json:"documentId"`
+	// Status es SUCCESS o ERROR; ErrorCode indica el motivo de un procesamiento fallido
+	Status    string `json:"status"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	// XMLHash es el SHA-256 del XML generado por este procesamiento
+	XMLHash     string    `json:"xmlHash,omitempty"`
+	ProcessedAt time.Time `json:"processedAt"`
+}
+
+// CorrelationLookup es un procesamiento consultado por su correlationId con el estado y
+// los artefactos actuales de su documento
+type CorrelationLookup struct {
+	Record CorrelationRecord `json:"record"`
+	// DocumentStatus es el último estado del historial del documento; vacío si el
+	// documento no llegó a generarse
+	DocumentStatus string            `json:"documentStatus,omitempty"`
+	Artifacts      map[string]string `json:"artifacts"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+)
+
+// Decimal2 es un valor numérico que se serializa siempre con dos decimales
+// redondeando al centésimo más cercano (18 -> "18.00", 17.999999999999996 -> "18.00")
+type Decimal2 float64
+
+// Round retorna el valor redondeado a dos decimales
+func (d Decimal2) Round() float64 {
+	return math.Round(float64(d)*100) / 100
+}
+
+func (d Decimal2) String() string {
+	return strconv.FormatFloat(d.Round(), 'f', 2, 64)
+}
+
+func (d Decimal2) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(d.String(), start)
+}
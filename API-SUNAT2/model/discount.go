@@ -0,0 +1,22 @@
+package model
+
+// Destinos de una línea negativa convertida en descuento
+const (
+	// NegativeLineToLine es un descuento de la línea con el mismo id (catálogo 53, código 00)
+	NegativeLineToLine = "line"
+	// NegativeLineToGlobal es un descuento global que afecta la base (catálogo 53, código 02)
+	NegativeLineToGlobal = "global"
+)
+
+// ConvertedNegativeLine es una línea con cantidad o precio negativo que se convirtió en
+// un descuento antes de validar el documento
+type ConvertedNegativeLine struct {
+	// Field es la línea original en el request, p. ej. items[3]
+	Field       string  `json:"field"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+	// Target es line o global
+	Target string `json:"target"`
+	// ItemID es el id de la línea que recibe el descuento, solo en los de línea
+	ItemID string `json:"itemId,omitempty"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// EndOfDayReport es el cierre de un día: los comprobantes emitidos con esa fecha que
+// todavía no fueron enviados a SUNAT ni tienen una explicación (anulación, purga)
+type EndOfDayReport struct {
+	// Date es la fecha de emisión revisada (YYYY-MM-DD, hora de Lima)
+	Date string `json:"date"`
+	// RUC filtra el reporte a un emisor; vacío incluye a todos
+	RUC         string    `json:"ruc,omitempty"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Issued      int       `json:"issued"`
+	Sent        int       `json:"sent"`
+	// Explained son los comprobantes anulados o purgados, que no requieren envío
+	Explained int `json:"explained"`
+	Pending   int `json:"pending"`
+	// TestExcluded son los documentos de prueba que no se revisaron; el reporte solo los
+	// incluye si se piden
+	TestExcluded int `json:"testExcluded,omitempty"`
+	// Issuers son los emisores con pendientes, ordenados por RUC
+	Issuers []EndOfDayIssuer `json:"issuers"`
+}
+
+// EndOfDayIssuer son los pendientes de un emisor
+type EndOfDayIssuer struct {
+	IssuerRUC string            `json:"issuerRuc"`
+	Issued    int               `json:"issued"`
+	Pending   int               `json:"pending"`
+	Documents []EndOfDayPending `json:"documents"`
+}
+
+// EndOfDayPending es un comprobante estancado con su último estado y el motivo
+type EndOfDayPending struct {
+	DocumentID   string `json:"documentId"`
+	DocumentType string `json:"documentType"`
+	Series       string `json:"series"`
+	Number       string `json:"number"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason"`
+	// Since es el momento del último cambio de estado
+	Since time.Time `json:"since"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// EventSchemaVersion es la versión del esquema de DocumentEvent. Agregar campos no
+// cambia la versión; renombrarlos o cambiar su significado sí.
+const EventSchemaVersion = 1
+
+// Tipos de eventos de documentos
+const (
+	DocumentProcessedEvent = "document.processed"
+	DocumentSentEvent      = "document.sent"
+	DocumentAcceptedEvent  = "document.accepted"
+	DocumentRejectedEvent  = "document.rejected"
+	DocumentVoidedEvent    = "document.voided"
+	DocumentRevertedEvent  = "document.reverted"
+)
+
+// DocumentEvent es el evento que se publica en el bus de mensajes cuando un documento
+// se emite o cambia de estado
+type DocumentEvent struct {
+	Version    int       `json:"version"`
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurredAt"`
+
+	DocumentID    string  `json:"documentId"`
+	IssuerRUC     string  `json:"issuerRuc,omitempty"`
+	DocumentType  string  `json:"documentType,omitempty"`
+	Series        string  `json:"series,omitempty"`
+	Number        string  `json:"number,omitempty"`
+	IssueDate     string  `json:"issueDate,omitempty"`
+	Currency      string  `json:"currency,omitempty"`
+	TaxAmount     float64 `json:"taxAmount"`
+	PayableAmount float64 `json:"payableAmount"`
+	XMLHash       string  `json:"xmlHash,omitempty"`
+	ZIPHash       string  `json:"zipHash,omitempty"`
+
+	// Status es el estado del documento en el historial (GENERADO, ENVIADO, ACEPTADO...)
+	Status      string `json:"status"`
+	Environment string `json:"environment,omitempty"`
+	// Detail es la descripción del CDR o el motivo de la anulación
+	Detail string `json:"detail,omitempty"`
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Separadores decimales admitidos en los montos enviados como string
+const (
+	DecimalPoint = "."
+	DecimalComma = ","
+)
+
+// decimalSeparator es el separador decimal de los montos enviados como string
+var decimalSeparator atomic.Value
+
+func init() {
+	decimalSeparator.Store(DecimalPoint)
+}
+
+// IsValidDecimalSeparator indica si el separador decimal es "." o ","
+func IsValidDecimalSeparator(separator string) bool {
+	return separator == DecimalPoint || separator == DecimalComma
+}
+
+// SetDecimalSeparator configura el separador decimal con que los ERPs serializan los
+// montos como string; un valor desconocido se ignora
+func SetDecimalSeparator(separator string) {
+	if IsValidDecimalSeparator(separator) {
+		decimalSeparator.Store(separator)
+	}
+}
+
+// GetDecimalSeparator retorna el separador decimal configurado
+func GetDecimalSeparator() string {
+	return decimalSeparator.Load().(string)
+}
+
+// FlexFloat es un monto o cantidad del request que acepta tanto un número JSON como
+// un string numérico ("10.50", o "10,50" con separador decimal coma). Se serializa
+// siempre como número.
+type FlexFloat float64
+
+// ParseFlexFloat interpreta un monto enviado como string con el separador decimal
+// configurado. Con separador coma el punto se acepta como separador de miles
+// ("1.234,50"); con separador punto, la coma ("1,234.50").
+func ParseFlexFloat(value string) (FlexFloat, error) {
+	text := strings.TrimSpace(value)
+	thousands := DecimalComma
+	if GetDecimalSeparator() == DecimalComma {
+		thousands = DecimalPoint
+	}
+	text = strings.ReplaceAll(text, thousands, "")
+	text = strings.Replace(text, GetDecimalSeparator(), ".", 1)
+	// ParseFloat acepta también Inf, NaN y hexadecimales, que no son montos
+	if text == "" || strings.Trim(text, "+-0123456789.eE") != "" {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return FlexFloat(number), nil
+}
+
+func (f *FlexFloat) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		number, err := ParseFlexFloat(text)
+		if err != nil {
+			return err
+		}
+		*f = number
+		return nil
+	}
+	var number float64
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid number %s", data)
+	}
+	*f = FlexFloat(number)
+	return nil
+}
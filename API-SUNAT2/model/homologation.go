@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// HomologationCase es un caso del set de pruebas de homologación de SUNAT: qué documento
+// emitir y con qué características
+type HomologationCase struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	// DocumentType es el tipo del catálogo 01: 01 factura, 03 boleta, 07 y 08 notas
+	DocumentType string `json:"documentType"`
+	Series       string `json:"series"`
+	// Items es el tributo de cada línea: 1000 gravado, 9997 exonerado, 9998 inafecto
+	// o 9996 gratuito
+	Items []string `json:"items"`
+	// Reference es el ID del caso cuyo documento afecta la nota
+	Reference  string `json:"reference,omitempty"`
+	ReasonCode string `json:"reasonCode,omitempty"`
+}
+
+// HomologationRequest es el cuerpo de /admin/homologation. Sin cases se genera el set
+// por defecto; caseIds elige solo algunos casos del set.
+type HomologationRequest struct {
+	RUC         string             `json:"ruc"`
+	Certificate string             `json:"certificate"`
+	PrivateKey  string             `json:"privateKey"`
+	Cases       []HomologationCase `json:"cases,omitempty"`
+	CaseIDs     []string           `json:"caseIds,omitempty"`
+	// StartNumber es el correlativo del primer documento de cada serie (default: 1)
+	StartNumber int  `json:"startNumber,omitempty"`
+	Send        bool `json:"send,omitempty"`
+	// Environment es el ambiente de envío (default: beta)
+	Environment string `json:"environment,omitempty"`
+}
+
+// HomologationResult es el resultado de un caso del set
+type HomologationResult struct {
+	CaseID       string `json:"caseId"`
+	Description  string `json:"description"`
+	DocumentID   string `json:"documentId,omitempty"`
+	Status       string `json:"status"`
+	ErrorCode    string `json:"errorCode,omitempty"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	// CDRStatus y CDRDescription solo están cuando el caso se envió a SUNAT
+	CDRStatus      string `json:"cdrStatus,omitempty"`
+	CDRDescription string `json:"cdrDescription,omitempty"`
+}
+
+// HomologationReport es el reporte de una corrida del set de homologación
+type HomologationReport struct {
+	RUC         string               `json:"ruc"`
+	GeneratedAt time.Time            `json:"generatedAt"`
+	Environment string               `json:"environment,omitempty"`
+	Total       int                  `json:"total"`
+	Succeeded   int                  `json:"succeeded"`
+	Failed      int                  `json:"failed"`
+	Cases       []HomologationResult `json:"cases"`
+}
@@ -0,0 +1,56 @@
+package model
+
+// Métodos de cálculo de los intereses moratorios sobre el saldo de una factura vencida
+const (
+	// InterestMethodEffective capitaliza la tasa anual efectiva (TEA) por los días de
+	// atraso: saldo × ((1 + TEA)^(días/360) − 1)
+	InterestMethodEffective = "effective"
+	// InterestMethodSimple aplica la tasa anual nominal en proporción a los días de
+	// atraso: saldo × TNA × días/360
+	InterestMethodSimple = "simple"
+)
+
+// InterestDayBase es el año comercial con que se convierte la tasa anual a días
+const InterestDayBase = 360
+
+// InterestDebitNoteRequest es el cuerpo de /documents/:documentId/debit-note: la tasa y
+// la fecha con que se calculan los intereses, la serie-número de la nota y el
+// certificado y la clave privada PEM en base64 con que se firma
+type InterestDebitNoteRequest struct {
+	// AnnualRate es la tasa anual en porcentaje (12 es 12 %)
+	AnnualRate float64 `json:"annualRate"`
+	// CalculationDate es la fecha hasta la que se calculan los intereses y la de emisión
+	// de la nota (AAAA-MM-DD); por defecto la fecha actual
+	CalculationDate string `json:"calculationDate,omitempty"`
+	// Method es effective (por defecto) o simple
+	Method string `json:"method,omitempty"`
+	// Taxed grava los intereses con IGV; por defecto son inafectos (9998)
+	Taxed       bool   `json:"taxed,omitempty"`
+	Series      string `json:"series"`
+	Number      string `json:"number"`
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"privateKey"`
+}
+
+// InterestCalculation registra el cálculo de los intereses de una nota de débito con
+// los parámetros que lo determinaron, para su trazabilidad
+type InterestCalculation struct {
+	// AffectedDocumentID es la factura vencida (RUC-01-SERIE-NUMERO)
+	AffectedDocumentID string `json:"affectedDocumentId"`
+	// InvoiceTotal es el importe total de la factura y CreditedAmount la suma de sus
+	// notas de crédito no anuladas; Balance es la diferencia, sobre la que se calcula
+	InvoiceTotal   float64 `json:"invoiceTotal"`
+	CreditedAmount float64 `json:"creditedAmount"`
+	Balance        float64 `json:"balance"`
+	// DueDate es el vencimiento de la factura, o su emisión si no tiene vencimiento
+	DueDate         string  `json:"dueDate"`
+	CalculationDate string  `json:"calculationDate"`
+	Days            int     `json:"days"`
+	AnnualRate      float64 `json:"annualRate"`
+	Method          string  `json:"method"`
+	DayBase         int     `json:"dayBase"`
+	// Interest es el valor de la línea de la nota, sin IGV
+	Interest  float64 `json:"interest"`
+	Taxed     bool    `json:"taxed,omitempty"`
+	TaxAmount float64 `json:"taxAmount,omitempty"`
+}
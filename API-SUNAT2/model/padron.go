@@ -0,0 +1,14 @@
+package model
+
+// TaxpayerStatus es la información del padrón RUC de SUNAT para un contribuyente
+type TaxpayerStatus struct {
+	RUC       string `json:"ruc"`
+	Name      string `json:"name"`
+	State     string `json:"state"`     // ACTIVO, BAJA DE OFICIO, BAJA DEFINITIVA, SUSPENSION TEMPORAL...
+	Condition string `json:"condition"` // HABIDO, NO HABIDO, NO HALLADO...
+}
+
+// IsOperational indica si el contribuyente está activo y habido
+func (t *TaxpayerStatus) IsOperational() bool {
+	return t.State == "ACTIVO" && t.Condition == "HABIDO"
+}
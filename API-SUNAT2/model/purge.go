@@ -0,0 +1,71 @@
+package model
+
+import "time"
+
+// Modos de purga de datos personales
+const (
+	// PurgeModeAnonymize elimina los archivos con datos personales (XML, ZIP, CDR,
+	// auditoría) y conserva el registro del documento sin el cliente
+	PurgeModeAnonymize = "anonymize"
+	// PurgeModeDelete elimina todos los archivos del documento, incluido su registro
+	PurgeModeDelete = "delete"
+)
+
+// PurgeRequest es el cuerpo de /admin/purge. El filtro necesita al menos un criterio;
+// los criterios indicados se combinan (todos deben cumplirse).
+type PurgeRequest struct {
+	// CustomerDocumentID es el documento de identidad (RUC, DNI) del cliente
+	CustomerDocumentID string `json:"customerDocumentId,omitempty"`
+	// From y To acotan la fecha de emisión (YYYY-MM-DD), ambos inclusive
+	From        string   `json:"from,omitempty"`
+	To          string   `json:"to,omitempty"`
+	DocumentIDs []string `json:"documentIds,omitempty"`
+	// Mode es anonymize (default) o delete
+	Mode string `json:"mode,omitempty"`
+	// DryRun solo cuenta lo que se purgaría, sin modificar el store ni auditar
+	DryRun bool `json:"dryRun,omitempty"`
+	// RequestedBy es quién ordena la purga; queda en el registro de auditoría
+	RequestedBy string `json:"requestedBy" binding:"required"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// PurgedDocument es un documento purgado y los archivos eliminados del store
+type PurgedDocument struct {
+	DocumentID string   `json:"documentId"`
+	IssueDate  string   `json:"issueDate"`
+	Artifacts  []string `json:"artifacts"`
+}
+
+// RetainedDocument es un documento que el filtro alcanza pero que sigue dentro del
+// período de conservación legal, por lo que no se purga
+type RetainedDocument struct {
+	DocumentID  string `json:"documentId"`
+	IssueDate   string `json:"issueDate"`
+	RetainUntil string `json:"retainUntil"`
+}
+
+// PurgeReport es el resultado de una purga. En dry-run Documents son los que se
+// purgarían y no hay AuditID.
+type PurgeReport struct {
+	AuditID   string             `json:"auditId,omitempty"`
+	Mode      string             `json:"mode"`
+	DryRun    bool               `json:"dryRun"`
+	Matched   int                `json:"matched"`
+	Purged    int                `json:"purged"`
+	Artifacts int                `json:"artifacts"`
+	Documents []PurgedDocument   `json:"documents"`
+	Retained  []RetainedDocument `json:"retained"`
+}
+
+// PurgeAudit es el registro de auditoría de una purga: qué se purgó, cuándo, por
+// orden de quién y con qué filtro
+type PurgeAudit struct {
+	AuditID     string       `json:"auditId"`
+	RequestedBy string       `json:"requestedBy"`
+	Reason      string       `json:"reason,omitempty"`
+	Filter      PurgeRequest `json:"filter"`
+	PurgedAt    time.Time    `json:"purgedAt"`
+	// RetentionYears es el período de conservación vigente al purgar
+	RetentionYears int         `json:"retentionYears"`
+	Report         PurgeReport `json:"report"`
+}
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// QueueStats es el estado de una cola en memoria del servicio
+type QueueStats struct {
+	Name string `json:"name"`
+	// Depth son los elementos pendientes, sin contar el que se está procesando
+	Depth    int  `json:"depth"`
+	InFlight int  `json:"inFlight"`
+	Capacity int  `json:"capacity"`
+	Paused   bool `json:"paused"`
+	// OldestAgeSeconds es la antigüedad del elemento pendiente más antiguo
+	OldestAgeSeconds float64 `json:"oldestAgeSeconds"`
+	// ProcessedLastMinute son los elementos que terminaron de procesarse (con éxito o no)
+	// en el último minuto
+	ProcessedLastMinute int `json:"processedLastMinute"`
+	// Retries es la suma de los intentos fallidos de los elementos que siguen en la cola
+	Retries int `json:"retries"`
+}
+
+// QueueItem es un elemento pendiente o en proceso de una cola
+type QueueItem struct {
+	ID         string    `json:"id"`
+	DocumentID string    `json:"documentId,omitempty"`
+	Kind       string    `json:"kind"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+	Attempts   int       `json:"attempts"`
+	// NextAttemptAt es cuándo se reintenta un elemento que ya falló; nil si espera su turno
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	InFlight      bool       `json:"inFlight,omitempty"`
+}
+
+// QueueDetail es el estado de una cola con una página de sus elementos
+type QueueDetail struct {
+	QueueStats
+	Items []QueueItem `json:"items"`
+}
@@ -0,0 +1,115 @@
+package model
+
+import "time"
+
+// DocumentRecord es el registro con metadatos de un documento guardado en el store
+type DocumentRecord struct {
+	DocumentID    string  `json:"documentId"`
+	IssuerRUC     string  `json:"issuerRuc"`
+	DocumentType  string  `json:"documentType"`
+	Series        string  `json:"series"`
+	Number        string  `json:"number"`
+	IssueDate     string  `json:"issueDate"`
+	Currency      string  `json:"currency"`
+	TaxAmount     float64 `json:"taxAmount"`
+	PayableAmount float64 `json:"payableAmount"`
+	// DigestValue es el digest de la firma (ds:DigestValue)
+	DigestValue string `json:"digestValue"`
+	// XMLHash y ZIPHash son SHA-256 en hexadecimal; ZIPHash vacío si no hay ZIP
+	XMLHash string `json:"xmlHash"`
+	ZIPHash string `json:"zipHash,omitempty"`
+	// ZIPSize es el tamaño en bytes del ZIP tal como lo generó el servicio
+	ZIPSize int64  `json:"zipSize,omitempty"`
+	XMLFile string `json:"xmlFile"`
+	// AffectedDocumentID es el documento (RUC-TIPO-SERIE-NUMERO) que modifica una nota
+	AffectedDocumentID string `json:"affectedDocumentId,omitempty"`
+	// AffectedDocuments son los documentos que ajusta una nota consolidada con su monto;
+	// AffectedDocumentID es el primero
+	AffectedDocuments []AffectedDocument `json:"affectedDocuments,omitempty"`
+	// Advance indica una factura de anticipo (tipo de operación 0103), cuyo saldo
+	// regularizan facturas posteriores
+	Advance bool `json:"advance,omitempty"`
+	// Advances son los anticipos (RUC-01-SERIE-NUMERO) que regulariza la factura con el
+	// monto deducido de cada uno
+	Advances []AffectedDocument `json:"advances,omitempty"`
+	// CustomerDocumentID es el documento de identidad del cliente; se borra al purgar
+	CustomerDocumentID string `json:"customerDocumentId,omitempty"`
+	// StorageLocation es "secondary" mientras el documento está en el directorio de
+	// contingencia porque el principal no respondía
+	StorageLocation string `json:"storageLocation,omitempty"`
+	// UnitMappings son las unidades de las líneas que se reemplazaron con el mapeo del
+	// emisor antes de validar
+	UnitMappings []AppliedUnitMapping `json:"unitMappings,omitempty"`
+	// TemplateFields son los campos del documento que provinieron de la plantilla del
+	// emisor en lugar del request
+	TemplateFields []string `json:"templateFields,omitempty"`
+	// NegativeLines son las líneas negativas del request convertidas en descuentos
+	NegativeLines []ConvertedNegativeLine `json:"negativeLines,omitempty"`
+	// Interest es el cálculo de los intereses de una nota de débito por mora armada
+	// desde la factura vencida
+	Interest *InterestCalculation `json:"interest,omitempty"`
+	// Test indica un documento de prueba: por el request o por su RUC o serie de prueba
+	Test bool `json:"test,omitempty"`
+	// PricingReferenceOmitted indica que las líneas se emitieron sin cac:PricingReference,
+	// por el request o por la configuración del emisor
+	PricingReferenceOmitted bool `json:"pricingReferenceOmitted,omitempty"`
+	// Engine es la versión del convertidor y el hash de las reglas con que se generó el
+	// XML; vacío en los documentos migrados o anteriores al registro de la versión
+	Engine *EngineVersion `json:"engine,omitempty"`
+	// Breakdown es el desglose contable calculado al emitir, con que se verifica el que
+	// se deriva del XML; vacío en los documentos migrados o anteriores al desglose
+	Breakdown *AccountingBreakdown `json:"breakdown,omitempty"`
+	// Source indica el origen del registro: "pipeline" o "migration"
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"createdAt"`
+	// PurgedAt es el momento en que se eliminaron los datos personales del documento
+	PurgedAt *time.Time `json:"purgedAt,omitempty"`
+}
+
+// EngineVersion identifica la versión del convertidor y el conjunto de reglas y
+// catálogos activos con que se generó un documento
+type EngineVersion struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	RulesHash string `json:"rulesHash"`
+	// CatalogVersion es la versión de las listas de códigos con que se validó, vacía en
+	// los documentos anteriores al versionado de catálogos
+	CatalogVersion string `json:"catalogVersion,omitempty"`
+}
+
+// AffectedDocument es un documento (RUC-TIPO-SERIE-NUMERO) ajustado por una nota
+// consolidada y el monto del ajuste
+type AffectedDocument struct {
+	DocumentID string  `json:"documentId"`
+	Amount     float64 `json:"amount"`
+}
+
+// StatusChange es un cambio de estado de un documento: su generación, cada envío a
+// SUNAT con su resultado y la anulación
+type StatusChange struct {
+	Status      string    `json:"status"`
+	Environment string    `json:"environment,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// DocumentCDR es el último CDR recibido para un documento
+type DocumentCDR struct {
+	CDRResult
+	Environment string `json:"environment"`
+	File        string `json:"file"`
+	// Content es el ZIP del CDR, en base64 en el JSON
+	Content []byte `json:"content"`
+}
+
+// DocumentLookup es el estado de un documento consultado por RUC, tipo, serie y número
+type DocumentLookup struct {
+	Record DocumentRecord `json:"record"`
+	// Status es el último estado del historial
+	Status string `json:"status"`
+	// Artifacts son las rutas en el store de los archivos del documento, por tipo
+	Artifacts   map[string]string  `json:"artifacts"`
+	Submissions []SubmissionRecord `json:"submissions"`
+	CDR         *DocumentCDR       `json:"cdr,omitempty"`
+	History     []StatusChange     `json:"history"`
+}
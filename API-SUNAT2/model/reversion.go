@@ -0,0 +1,53 @@
+package model
+
+import "encoding/xml"
+
+// ReversionRequest es el cuerpo de /reversions: los comprobantes de retención (20) o
+// percepción (40) que se revierten, todos emitidos en ReferenceDate, y el certificado
+// y la clave privada PEM en base64 con que se firma el resumen. Con AutoSend el
+// resumen se envía a SUNAT al ambiente indicado.
+type ReversionRequest struct {
+	RUC              string              `json:"ruc"`
+	RegistrationName string              `json:"registrationName"`
+	ReferenceDate    string              `json:"referenceDate"`
+	Documents        []ReversionDocument `json:"documents"`
+	Certificate      string              `json:"certificate"`
+	PrivateKey       string              `json:"privateKey"`
+	AutoSend         bool                `json:"autoSend,omitempty"`
+	Environment      string              `json:"environment,omitempty"`
+}
+
+// ReversionDocument es un comprobante a revertir con el motivo de la reversión
+type ReversionDocument struct {
+	DocumentType string `json:"documentType"`
+	Series       string `json:"series"`
+	Number       string `json:"number"`
+	Reason       string `json:"reason"`
+}
+
+// UBLVoidedDocuments es el resumen de reversiones (VoidedDocuments-1 con ID RR-...)
+type UBLVoidedDocuments struct {
+	XMLName                 xml.Name           `xml:"VoidedDocuments"`
+	Xmlns                   string             `xml:"xmlns,attr"`
+	XmlnsCac                string             `xml:"xmlns:cac,attr"`
+	XmlnsCbc                string             `xml:"xmlns:cbc,attr"`
+	XmlnsDs                 string             `xml:"xmlns:ds,attr"`
+	XmlnsExt                string             `xml:"xmlns:ext,attr"`
+	XmlnsSac                string             `xml:"xmlns:sac,attr"`
+	UBLVersionID            string             `xml:"cbc:UBLVersionID"`
+	CustomizationID         string             `xml:"cbc:CustomizationID"`
+	ID                      string             `xml:"cbc:ID"`
+	ReferenceDate           string             `xml:"cbc:ReferenceDate"`
+	IssueDate               string             `xml:"cbc:IssueDate"`
+	Signature               *UBLSignature      `xml:"cac:Signature,omitempty"`
+	AccountingSupplierParty UBLSummarySupplier `xml:"cac:AccountingSupplierParty"`
+	Lines                   []UBLVoidedLine    `xml:"sac:VoidedDocumentsLine"`
+}
+
+type UBLVoidedLine struct {
+	LineID                string `xml:"cbc:LineID"`
+	DocumentTypeCode      string `xml:"cbc:DocumentTypeCode"`
+	DocumentSerialID      string `xml:"sac:DocumentSerialID"`
+	DocumentNumberID      string `xml:"sac:DocumentNumberID"`
+	VoidReasonDescription string `xml:"sac:VoidReasonDescription"`
+}
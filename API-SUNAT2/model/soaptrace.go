@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// SOAPTrace es la petición y la respuesta SOAP crudas de una llamada a SUNAT, guardadas
+// para diagnosticar faults ambiguos. Las credenciales WS-Security van redactadas.
+type SOAPTrace struct {
+	DocumentID  string `json:"documentId"`
+	Environment string `json:"environment"`
+	// Operation es la acción SOAP: sendBill, sendSummary, getStatus o getStatusCdr
+	Operation  string    `json:"operation"`
+	URL        string    `json:"url"`
+	RecordedAt time.Time `json:"recordedAt"`
+	// HTTPStatus es 0 si la llamada no obtuvo respuesta; Error indica entonces el motivo
+	HTTPStatus int    `json:"httpStatus"`
+	Error      string `json:"error,omitempty"`
+	Request    string `json:"request"`
+	Response   string `json:"response,omitempty"`
+	// RequestTruncated y ResponseTruncated indican que el contenido superó el límite por traza
+	RequestTruncated  bool `json:"requestTruncated,omitempty"`
+	ResponseTruncated bool `json:"responseTruncated,omitempty"`
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// GenerateSummaryRequest es el cuerpo de /summaries/generate: el certificado y la clave
+// privada PEM en base64 con que se firma el resumen y, con AutoSend, el ambiente de envío
+type GenerateSummaryRequest struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"privateKey"`
+	AutoSend    bool   `json:"autoSend,omitempty"`
+	Environment string `json:"environment,omitempty"`
+}
+
+// SummaryRecord registra un resumen diario de boletas (RC) o de reversiones (RR)
+// generado por el servicio
+type SummaryRecord struct {
+	// SummaryID es RUC-RC-AAAAMMDD-N o RUC-RR-AAAAMMDD-N, el nombre base de sus archivos
+	// en el store
+	SummaryID string `json:"summaryId"`
+	IssuerRUC string `json:"issuerRuc"`
+	// ReferenceDate es la fecha de emisión de los comprobantes informados
+	ReferenceDate string `json:"referenceDate"`
+	// IssueDate es la fecha de generación del resumen
+	IssueDate string              `json:"issueDate"`
+	Lines     []SummaryRecordLine `json:"lines"`
+	// Status es GENERADO, EN_PROCESO (ticket pendiente) o el estado del CDR
+	Status      string    `json:"status"`
+	Ticket      string    `json:"ticket,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// SummaryRecordLine es un comprobante informado en el resumen diario con su estado del
+// catálogo 19, o uno revertido en el resumen de reversiones con su motivo
+type SummaryRecordLine struct {
+	DocumentID    string  `json:"documentId"`
+	DocumentType  string  `json:"documentType"`
+	Number        string  `json:"number"`
+	Status        string  `json:"status,omitempty"`
+	Currency      string  `json:"currency"`
+	PayableAmount float64 `json:"payableAmount"`
+	Reason        string  `json:"reason,omitempty"`
+}
+
+// UBLSummaryDocuments es el resumen diario de boletas y notas asociadas (SummaryDocuments-1)
+type UBLSummaryDocuments struct {
+	XMLName                 xml.Name           `xml:"SummaryDocuments"`
+	Xmlns                   string             `xml:"xmlns,attr"`
+	XmlnsCac                string             `xml:"xmlns:cac,attr"`
+	XmlnsCbc                string             `xml:"xmlns:cbc,attr"`
+	XmlnsDs                 string             `xml:"xmlns:ds,attr"`
+	XmlnsExt                string             `xml:"xmlns:ext,attr"`
+	XmlnsSac                string             `xml:"xmlns:sac,attr"`
+	UBLVersionID            string             `xml:"cbc:UBLVersionID"`
+	CustomizationID         string             `xml:"cbc:CustomizationID"`
+	ID                      string             `xml:"cbc:ID"`
+	ReferenceDate           string             `xml:"cbc:ReferenceDate"`
+	IssueDate               string             `xml:"cbc:IssueDate"`
+	Signature               *UBLSignature      `xml:"cac:Signature,omitempty"`
+	AccountingSupplierParty UBLSummarySupplier `xml:"cac:AccountingSupplierParty"`
+	Lines                   []UBLSummaryLine   `xml:"sac:SummaryDocumentsLine"`
+}
+
+type UBLSummarySupplier struct {
+	CustomerAssignedAccountID string `xml:"cbc:CustomerAssignedAccountID"`
+	AdditionalAccountID       string `xml:"cbc:AdditionalAccountID"`
+	RegistrationName          string `xml:"cac:Party>cac:PartyLegalEntity>cbc:RegistrationName"`
+}
+
+type UBLSummaryLine struct {
+	LineID                  string               `xml:"cbc:LineID"`
+	DocumentTypeCode        string               `xml:"cbc:DocumentTypeCode"`
+	ID                      string               `xml:"cbc:ID"`
+	AccountingCustomerParty *UBLSummaryCustomer  `xml:"cac:AccountingCustomerParty,omitempty"`
+	BillingReference        *UBLBillingReference `xml:"cac:BillingReference,omitempty"`
+	ConditionCode           string               `xml:"cac:Status>cbc:ConditionCode"`
+	TotalAmount             UBLSummaryAmount     `xml:"sac:TotalAmount"`
+	BillingPayments         []UBLSummaryPayment  `xml:"sac:BillingPayment"`
+	TaxTotals               []UBLSummaryTaxTotal `xml:"cac:TaxTotal"`
+}
+
+type UBLSummaryCustomer struct {
+	CustomerAssignedAccountID string `xml:"cbc:CustomerAssignedAccountID"`
+	AdditionalAccountID       string `xml:"cbc:AdditionalAccountID"`
+}
+
+// UBLSummaryAmount es un importe con moneda; Value va formateado con dos decimales
+type UBLSummaryAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+// UBLSummaryPayment es el importe de una afectación (01 gravado, 02 exonerado, 03 inafecto, 05 gratuito)
+type UBLSummaryPayment struct {
+	PaidAmount    UBLSummaryAmount `xml:"cbc:PaidAmount"`
+	InstructionID string           `xml:"cbc:InstructionID"`
+}
+
+type UBLSummaryTaxTotal struct {
+	TaxAmount   UBLSummaryAmount      `xml:"cbc:TaxAmount"`
+	TaxSubtotal UBLSummaryTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type UBLSummaryTaxSubtotal struct {
+	TaxAmount UBLSummaryAmount `xml:"cbc:TaxAmount"`
+	TaxScheme UBLTaxScheme     `xml:"cac:TaxCategory>cac:TaxScheme"`
+}
@@ -0,0 +1,72 @@
+package model
+
+import "time"
+
+// SunatEndpoint es la URL y credenciales SOL de un emisor en un ambiente SUNAT
+type SunatEndpoint struct {
+	URL string `json:"url,omitempty"`
+	// ConsultURL es el billConsultService de getStatusCdr; por defecto el de SUNAT en producción
+	ConsultURL string `json:"consultUrl,omitempty"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	// ZIPFileName es la plantilla del nombre del ZIP enviado, con {ruc}, {tipo}, {serie},
+	// {numero} y {timestamp}; vacío usa el nombre estándar de SUNAT
+	ZIPFileName string `json:"zipFileName,omitempty"`
+}
+
+// SubmissionRecord registra el envío de un documento a SUNAT
+type SubmissionRecord struct {
+	DocumentID  string    `json:"documentId"`
+	Environment string    `json:"environment"`
+	SentAt      time.Time `json:"sentAt"`
+	CDRFile     string    `json:"cdrFile"`
+	// Resultado del CDR: ACEPTADO, OBSERVADO o RECHAZADO; ENVIADO mientras no hay CDR y
+	// REENVIAR si la reconciliación no encontró el comprobante en SUNAT
+	Status       string   `json:"status"`
+	ResponseCode string   `json:"responseCode"`
+	Description  string   `json:"description"`
+	Notes        []string `json:"notes,omitempty"`
+	// ZIPHash (SHA-256 en hexadecimal) y ZIPSize son los del ZIP exactamente como se
+	// adjuntó al SOAP; SUNAT calcula su hash sobre ese archivo
+	ZIPHash string `json:"zipHash,omitempty"`
+	ZIPSize int64  `json:"zipSize,omitempty"`
+	// ZIPFile es el nombre estándar con que se archiva el ZIP y SentFileName el nombre con
+	// que se adjuntó al SOAP, distinto si el proveedor exige otro formato
+	ZIPFile      string `json:"zipFile,omitempty"`
+	SentFileName string `json:"sentFileName,omitempty"`
+	// ReconciledAt es la última consulta de la reconciliación con getStatusCdr
+	ReconciledAt *time.Time `json:"reconciledAt,omitempty"`
+}
+
+// SunatCDRStatus es la respuesta de getStatusCdr: el código de estado de SUNAT y, si
+// el comprobante existe, su CDR (ZIP)
+type SunatCDRStatus struct {
+	Code    string
+	Message string
+	CDR     []byte
+}
+
+// CDRResult es el contenido relevante de la Constancia de Recepción (ApplicationResponse)
+type CDRResult struct {
+	ReferenceID  string   `json:"referenceId"`
+	ResponseCode string   `json:"responseCode"`
+	Description  string   `json:"description"`
+	Notes        []string `json:"notes,omitempty"`
+	Status       string   `json:"status"`
+}
+
+// CDRImport es un CDR subido por el cliente, con el documento del store al que se asoció
+type CDRImport struct {
+	CDR CDRResult `json:"cdr"`
+	// DocumentID es el documento (RUC-TIPO-SERIE-NUMERO) que responde el CDR; vacío si
+	// el CDR no permite identificarlo
+	DocumentID string `json:"documentId,omitempty"`
+	// Associated indica que el documento existe en el store y se actualizó su estado
+	Associated  bool   `json:"associated"`
+	Environment string `json:"environment,omitempty"`
+	CDRFile     string `json:"cdrFile,omitempty"`
+	// LineCountNumeric, Currency y Totals se leen del XML emitido del documento asociado
+	LineCountNumeric int                  `json:"lineCountNumeric,omitempty"`
+	Currency         string               `json:"currency,omitempty"`
+	Totals           *AccountingBreakdown `json:"totals,omitempty"`
+}
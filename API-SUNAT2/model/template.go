@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// DocumentTemplate son los valores por defecto de los documentos de un emisor (su
+// dirección, leyendas, serie, moneda), con la forma de un BusinessDocument parcial. Se
+// aplican por debajo del documento recibido: lo que el request envía siempre gana.
+type DocumentTemplate struct {
+	IssuerRUC string                 `json:"issuerRuc"`
+	Defaults  map[string]interface{} `json:"defaults"`
+	UpdatedAt time.Time              `json:"updatedAt"`
+}
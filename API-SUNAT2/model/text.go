@@ -0,0 +1,19 @@
+package model
+
+import "encoding/xml"
+
+// UBLText es un texto que se emite como CDATA cuando CDATA es true, para que los
+// saltos de línea y tabulaciones lleguen intactos al receptor
+type UBLText struct {
+	Value string
+	CDATA bool
+}
+
+func (t UBLText) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if t.CDATA {
+		return e.EncodeElement(struct {
+			Value string `xml:",cdata"`
+		}{t.Value}, start)
+	}
+	return e.EncodeElement(t.Value, start)
+}
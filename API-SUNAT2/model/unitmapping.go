@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// UnitMappingSet son las equivalencias de unidades de un emisor: el código que usa su
+// ERP ("CAJ", "PAQ") y el código UN/ECE del catálogo 03 que se emite ("BX", "PK")
+type UnitMappingSet struct {
+	IssuerRUC string            `json:"issuerRuc"`
+	Mappings  map[string]string `json:"mappings"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// AppliedUnitMapping es una unidad de una línea reemplazada por el mapeo del emisor
+type AppliedUnitMapping struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
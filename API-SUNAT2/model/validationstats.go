@@ -0,0 +1,34 @@
+package model
+
+// ValidationExample es un valor recibido que no pasó una regla, anonimizado: los
+// dígitos se reemplazan por 9 y las letras por X, de modo que se ve el formato que
+// envía el ERP sin exponer los datos
+type ValidationExample struct {
+	Field    string `json:"field"`
+	Received string `json:"received"`
+}
+
+// ValidationRuleStats es el conteo de fallos de una regla de validación
+type ValidationRuleStats struct {
+	Rule     string              `json:"rule"`
+	Count    int                 `json:"count"`
+	Examples []ValidationExample `json:"examples,omitempty"`
+}
+
+// ValidationStatsDay son los fallos de validación de un emisor en un día, tal como se
+// guardan en el store
+type ValidationStatsDay struct {
+	RUC   string                          `json:"ruc"`
+	Date  string                          `json:"date"`
+	Rules map[string]*ValidationRuleStats `json:"rules"`
+}
+
+// ValidationReport es el ranking de las reglas que más fallan, de un emisor o de todos,
+// entre From y To (YYYY-MM-DD, ambos inclusive)
+type ValidationReport struct {
+	RUC   string                `json:"ruc,omitempty"`
+	From  string                `json:"from,omitempty"`
+	To    string                `json:"to,omitempty"`
+	Total int                   `json:"total"`
+	Rules []ValidationRuleStats `json:"rules"`
+}
@@ -0,0 +1,22 @@
+package model
+
+// ZIPIntegrityIssue es un ZIP en el store que ya no corresponde al hash registrado al
+// generarlo o al enviarlo a SUNAT
+type ZIPIntegrityIssue struct {
+	DocumentID string `json:"documentId"`
+	// Reference es el registro contra el que se comparó: "generated" o el ambiente del envío
+	Reference    string `json:"reference"`
+	ExpectedHash string `json:"expectedHash"`
+	ExpectedSize int64  `json:"expectedSize,omitempty"`
+	// ActualHash y ActualSize son los del ZIP en disco; vacíos si el ZIP no existe
+	ActualHash string `json:"actualHash,omitempty"`
+	ActualSize int64  `json:"actualSize"`
+	Message    string `json:"message"`
+}
+
+// ZIPIntegrityReport es el resultado de comparar los ZIP del store con sus hashes
+// registrados
+type ZIPIntegrityReport struct {
+	Checked int                 `json:"checked"`
+	Issues  []ZIPIntegrityIssue `json:"issues"`
+}
@@ -0,0 +1,401 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// AccountingAccountSuffix es la extensión de las cuentas contables de cada emisor en el store
+const AccountingAccountSuffix = ".cuentas"
+
+// AccountingAccountName retorna el nombre de las cuentas contables del emisor en el store
+func AccountingAccountName(ruc string) string {
+	return ruc + AccountingAccountSuffix
+}
+
+// Conceptos del asiento de un comprobante; son también las claves del mapa de cuentas
+const (
+	AccountingReceivable = "receivable"
+	AccountingTaxable    = "taxable"
+	AccountingExonerated = "exonerated"
+	AccountingUnaffected = "unaffected"
+	AccountingExport     = "export"
+	AccountingIGV        = "igv"
+	AccountingISC        = "isc"
+	AccountingICBPER     = "icbper"
+)
+
+// DefaultAccountingAccounts son las cuentas del Plan Contable General Empresarial que
+// se sugieren cuando el emisor no configuró otras
+var DefaultAccountingAccounts = map[string]string{
+	AccountingReceivable: "1212",  // Emitidas en cartera
+	AccountingTaxable:    "70111", // Mercaderías - Terceros
+	AccountingExonerated: "70111",
+	AccountingUnaffected: "70111",
+	AccountingExport:     "70111",
+	AccountingIGV:        "40111", // IGV - Cuenta propia
+	AccountingISC:        "4012",  // Impuesto selectivo al consumo
+	AccountingICBPER:     "40189", // Otros impuestos
+}
+
+// accountingTaxConcepts traduce los tributos del catálogo 05, que también se aceptan
+// como claves del mapa de cuentas, al concepto del asiento
+var accountingTaxConcepts = map[string]string{
+	"1000":     AccountingIGV,
+	ISCTaxType: AccountingISC,
+	"7152":     AccountingICBPER,
+	"9995":     AccountingExport,
+	"9997":     AccountingExonerated,
+	"9998":     AccountingUnaffected,
+}
+
+var accountPattern = regexp.MustCompile(`^[0-9A-Za-z.\-]{1,20}$`)
+
+// ErrInvalidAccountingAccount indica una cuenta para un concepto que el asiento no
+// tiene o con un código vacío o inválido
+type ErrInvalidAccountingAccount struct {
+	Concept, Account string
+}
+
+func (e *ErrInvalidAccountingAccount) Error() string {
+	if _, ok := DefaultAccountingAccounts[e.Concept]; !ok {
+		return fmt.Sprintf("unknown accounting concept %q", e.Concept)
+	}
+	return fmt.Sprintf("invalid account %q for %s", e.Account, e.Concept)
+}
+
+// SetAccountingAccounts reemplaza las cuentas contables del emisor. Las claves son los
+// conceptos del asiento o los códigos de tributo del catálogo 05; los conceptos que no
+// se indican usan la cuenta por defecto.
+func (s *UBLConverterService) SetAccountingAccounts(ruc string, accounts map[string]string) (*AccountingAccountSet, error) {
+	normalized := make(map[string]string, len(accounts))
+	for concept, account := range accounts {
+		concept, account = strings.ToLower(strings.TrimSpace(concept)), strings.TrimSpace(account)
+		if alias, ok := accountingTaxConcepts[concept]; ok {
+			concept = alias
+		}
+		if _, ok := DefaultAccountingAccounts[concept]; !ok || !accountPattern.MatchString(account) {
+			return nil, &ErrInvalidAccountingAccount{Concept: concept, Account: account}
+		}
+		normalized[concept] = account
+	}
+
+	set := &AccountingAccountSet{IssuerRUC: ruc, Accounts: normalized, UpdatedAt: s.clock.Now()}
+	data, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.store.Save(AccountingAccountName(ruc), data); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// AccountingAccounts retorna las cuentas vigentes del emisor para cada concepto: las
+// que configuró y, para el resto, las por defecto
+func (s *UBLConverterService) AccountingAccounts(ruc string) map[string]string {
+	accounts := make(map[string]string, len(DefaultAccountingAccounts))
+	for concept, account := range DefaultAccountingAccounts {
+		accounts[concept] = account
+	}
+	data, err := s.store.Read(AccountingAccountName(ruc))
+	if err != nil {
+		return accounts
+	}
+	var set AccountingAccountSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		s.GetLogger().Warnf("Cuentas contables de %s inválidas: %v", ruc, err)
+		return accounts
+	}
+	for concept, account := range set.Accounts {
+		accounts[concept] = account
+	}
+	return accounts
+}
+
+// addAccountingBase suma la base de un subtotal de línea a la afectación de su tributo
+func addAccountingBase(b *AccountingBreakdown, taxType string, base float64) {
+	switch taxType {
+	case "1000":
+		b.Taxable += base
+	case "9995":
+		b.Export += base
+	case FreeTaxType:
+		b.Free += base
+	case "9997":
+		b.Exonerated += base
+	case "9998":
+		b.Unaffected += base
+	}
+}
+
+// addAccountingTax suma el monto de un subtotal del documento a su tributo
+func addAccountingTax(b *AccountingBreakdown, taxType string, amount float64) {
+	switch taxType {
+	case "1000":
+		b.IGV += amount
+	case ISCTaxType:
+		b.ISC += amount
+	case "7152":
+		b.ICBPER += amount
+	}
+}
+
+func roundAccountingBreakdown(b *AccountingBreakdown) {
+	for _, value := range []*float64{&b.Taxable, &b.Exonerated, &b.Unaffected, &b.Export, &b.Free, &b.IGV, &b.ISC, &b.ICBPER, &b.Total} {
+		*value = Decimal2(*value).Round()
+	}
+}
+
+// issuedBreakdown calcula el desglose contable del documento tal como se emite: las
+// bases de los tributos de sus líneas, los tributos del documento y el total a pagar
+func issuedBreakdown(doc *BusinessDocument) *AccountingBreakdown {
+	b := &AccountingBreakdown{Currency: doc.Currency, Total: float64(doc.Totals.PayableAmount)}
+	for _, line := range documentLines(doc) {
+		free := isFreeLine(line.Item)
+		for _, tax := range line.Item.Taxes {
+			taxType := tax.TaxType
+			// Las líneas gratuitas se emiten con el tributo 9996, salvo el ISC
+			if free && taxType != ISCTaxType {
+				taxType = FreeTaxType
+			}
+			addAccountingBase(b, taxType, float64(tax.TaxBase))
+		}
+	}
+	for _, tax := range documentTaxes(doc) {
+		addAccountingTax(b, tax.TaxType, float64(tax.TaxAmount))
+	}
+	// El descuento global rebaja la base gravada de las líneas
+	b.Taxable -= float64(doc.GlobalDiscount)
+	roundAccountingBreakdown(b)
+	return b
+}
+
+// ExtractAccountingBreakdown deriva el desglose contable de un XML emitido: las bases
+// por afectación de los subtotales de sus líneas, menos el descuento global que afecta
+// la base, los tributos del TaxTotal del documento y el importe total a pagar
+func ExtractAccountingBreakdown(xmlData []byte) (*AccountingBreakdown, error) {
+	b := &AccountingBreakdown{}
+	var payable string
+	var subtotal struct {
+		taxType, base, amount string
+	}
+	var allowance struct {
+		charge, code, amount string
+	}
+	decoder := NewXMLDecoder(bytes.NewReader(xmlData))
+	var path []xml.Name
+	var text strings.Builder
+	parent := func(n int) xml.Name {
+		if len(path) > n {
+			return path[len(path)-1-n]
+		}
+		return xml.Name{}
+	}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name)
+			text.Reset()
+			if t.Name == CAC("TaxSubtotal") {
+				subtotal.taxType, subtotal.base, subtotal.amount = "", "", ""
+			}
+			if t.Name == CAC("AllowanceCharge") {
+				allowance.charge, allowance.code, allowance.amount = "", "", ""
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			switch {
+			case len(path) == 2 && IsUBLDocumentRoot(path[0]) && t.Name == CBC("DocumentCurrencyCode"):
+				b.Currency = value
+			case len(path) == 3 && (path[1] == CAC("LegalMonetaryTotal") || path[1] == CAC("RequestedMonetaryTotal")) && t.Name == CBC("PayableAmount"):
+				payable = value
+			case len(path) == 3 && path[1] == CAC("AllowanceCharge") && t.Name == CBC("ChargeIndicator"):
+				allowance.charge = value
+			case len(path) == 3 && path[1] == CAC("AllowanceCharge") && t.Name == CBC("AllowanceChargeReasonCode"):
+				allowance.code = value
+			case len(path) == 3 && path[1] == CAC("AllowanceCharge") && t.Name == CBC("Amount"):
+				allowance.amount = value
+			case len(path) == 2 && t.Name == CAC("AllowanceCharge"):
+				if allowance.charge == "false" && allowance.code == GlobalDiscountReasonCode {
+					amount, err := parseAccountingAmount("Amount", allowance.amount)
+					if err != nil {
+						return nil, err
+					}
+					b.Taxable -= amount
+				}
+			case parent(1) == CAC("TaxSubtotal") && t.Name == CBC("TaxableAmount"):
+				subtotal.base = value
+			case parent(1) == CAC("TaxSubtotal") && t.Name == CBC("TaxAmount"):
+				subtotal.amount = value
+			case parent(1) == CAC("TaxScheme") && parent(2) == CAC("TaxCategory") && t.Name == CBC("ID"):
+				subtotal.taxType = value
+			case t.Name == CAC("TaxSubtotal"):
+				// El TaxTotal del documento es hijo de la raíz; los de las líneas, de cada línea
+				if len(path) == 3 {
+					amount, err := parseAccountingAmount("TaxAmount", subtotal.amount)
+					if err != nil {
+						return nil, err
+					}
+					addAccountingTax(b, subtotal.taxType, amount)
+				} else if len(path) == 4 {
+					base, err := parseAccountingAmount("TaxableAmount", subtotal.base)
+					if err != nil {
+						return nil, err
+					}
+					addAccountingBase(b, subtotal.taxType, base)
+				}
+			}
+			path = path[:len(path)-1]
+			text.Reset()
+		}
+	}
+
+	total, err := strconv.ParseFloat(payable, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PayableAmount %q", payable)
+	}
+	b.Total = total
+	roundAccountingBreakdown(b)
+	return b, nil
+}
+
+func parseAccountingAmount(element, value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", element, value)
+	}
+	return amount, nil
+}
+
+// accountingEntryLines arma el asiento del desglose: el total al debe de la cuenta por
+// cobrar y las ventas por afectación y los tributos al haber. La venta gravada es la
+// base del IGV sin el ISC. Una nota de crédito revierte el asiento.
+func accountingEntryLines(b AccountingBreakdown, docType string, accounts map[string]string) []AccountingLine {
+	amounts := []struct {
+		concept string
+		amount  float64
+		debit   bool
+	}{
+		{AccountingReceivable, b.Total, true},
+		{AccountingTaxable, b.Taxable - b.ISC, false},
+		{AccountingExonerated, b.Exonerated, false},
+		{AccountingUnaffected, b.Unaffected, false},
+		{AccountingExport, b.Export, false},
+		{AccountingIGV, b.IGV, false},
+		{AccountingISC, b.ISC, false},
+		{AccountingICBPER, b.ICBPER, false},
+	}
+	lines := []AccountingLine{}
+	for _, entry := range amounts {
+		amount := Decimal2(entry.amount).Round()
+		if amount == 0 {
+			continue
+		}
+		line := AccountingLine{Account: accounts[entry.concept], Concept: entry.concept}
+		if entry.debit != (docType == "07") {
+			line.Debit = amount
+		} else {
+			line.Credit = amount
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// accountingDivergences compara concepto por concepto el desglose de la emisión con
+// el del XML
+func accountingDivergences(issued, fromXML AccountingBreakdown) []AccountingDivergence {
+	concepts := []struct {
+		concept     string
+		issued, xml float64
+	}{
+		{AccountingTaxable, issued.Taxable, fromXML.Taxable},
+		{AccountingExonerated, issued.Exonerated, fromXML.Exonerated},
+		{AccountingUnaffected, issued.Unaffected, fromXML.Unaffected},
+		{AccountingExport, issued.Export, fromXML.Export},
+		{"free", issued.Free, fromXML.Free},
+		{AccountingIGV, issued.IGV, fromXML.IGV},
+		{AccountingISC, issued.ISC, fromXML.ISC},
+		{AccountingICBPER, issued.ICBPER, fromXML.ICBPER},
+		{"total", issued.Total, fromXML.Total},
+	}
+	divergences := []AccountingDivergence{}
+	for _, c := range concepts {
+		if Decimal2(c.issued).Round() != Decimal2(c.xml).Round() {
+			divergences = append(divergences, AccountingDivergence{Concept: c.concept, Issued: c.issued, XML: c.xml})
+		}
+	}
+	return divergences
+}
+
+// DocumentAccounting arma el asiento de un documento a partir del XML guardado, con las
+// cuentas del emisor, y lo compara con el desglose calculado en la emisión. Los
+// documentos sin ese desglose (migrados o anteriores) se informan sin verificar.
+func (s *UBLConverterService) DocumentAccounting(documentID string) (*AccountingEntry, error) {
+	documentID = CanonicalDocumentID(documentID)
+	data, err := s.store.Read(RecordName(documentID))
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	var record DocumentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid document record %s: %v", documentID, err)
+	}
+	xmlFile := record.XMLFile
+	if xmlFile == "" {
+		xmlFile = documentID + ".xml"
+	}
+	xmlData, err := s.store.Read(xmlFile)
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	breakdown, err := ExtractAccountingBreakdown(xmlData)
+	if err != nil {
+		return nil, fmt.Errorf("document %s: %v", documentID, err)
+	}
+
+	entry := &AccountingEntry{
+		DocumentID:   documentID,
+		DocumentType: record.DocumentType,
+		Breakdown:    *breakdown,
+		Lines:        accountingEntryLines(*breakdown, record.DocumentType, s.AccountingAccounts(record.IssuerRUC)),
+		Divergences:  []AccountingDivergence{},
+	}
+	for _, line := range entry.Lines {
+		entry.TotalDebit += line.Debit
+		entry.TotalCredit += line.Credit
+	}
+	entry.TotalDebit, entry.TotalCredit = Decimal2(entry.TotalDebit).Round(), Decimal2(entry.TotalCredit).Round()
+	entry.Balanced = entry.TotalDebit == entry.TotalCredit
+	if record.Breakdown != nil {
+		entry.Verified = true
+		entry.Divergences = accountingDivergences(*record.Breakdown, *breakdown)
+	}
+	if len(entry.Divergences) > 0 || !entry.Balanced {
+		s.GetLogger().Warnf("El asiento de %s no cuadra: debe %.2f, haber %.2f, %d divergencias con la emisión",
+			documentID, entry.TotalDebit, entry.TotalCredit, len(entry.Divergences))
+	}
+	return entry, nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// AdditionalValidationRule es la regla de los valores de additional con tipo o formato inválido
+const AdditionalValidationRule = "additional_validation"
+
+// Destinos en el XML de las claves de additional
+const (
+	// AdditionalToNote emite el valor como cbc:Note, después de las observaciones
+	AdditionalToNote = "note"
+	// AdditionalToProperty emite el valor en un elemento propio del documento
+	AdditionalToProperty = "property"
+	// AdditionalToAttribute reemplaza un dato de un nodo que el documento ya emite
+	AdditionalToAttribute = "attribute"
+)
+
+// additionalKey es una clave permitida de additional: el tipo JSON que admite (string, o
+// además array de strings), el formato de cada valor y su destino en el XML
+type additionalKey struct {
+	description string
+	array       bool
+	pattern     string
+	target      string
+	apply       func(values []string, nodes additionalNodes)
+}
+
+// additionalNodes son los nodos del XML donde se emiten las claves de additional,
+// comunes a facturas, boletas y notas
+type additionalNodes struct {
+	notes          *[]UBLNote
+	supplier       *UBLParty
+	orderReference **UBLOrderReference
+}
+
+// additionalKeys es el registro de las claves de additional. Una clave que no está
+// aquí se rechaza con strictParsing y, si no, se ignora con un warning unknown_field.
+var additionalKeys = map[string]additionalKey{
+	"ubigeoEmisor": {
+		description: "Ubigeo del establecimiento emisor; reemplaza al de issuer.address en cac:RegistrationAddress",
+		pattern:     `^\d{6}$`,
+		target:      AdditionalToAttribute,
+		apply: func(values []string, nodes additionalNodes) {
+			ubigeo := catalogScheme(values[0], catalog.Ubigeo)
+			forEachSupplierAddress(nodes.supplier, func(address *UBLRegistrationAddress) { address.ID = &ubigeo })
+		},
+	},
+	"codigoEstablecimiento": {
+		description: "Código del local anexo emisor registrado en SUNAT (cbc:AddressTypeCode); por defecto 0000, el domicilio fiscal",
+		pattern:     `^\d{4}$`,
+		target:      AdditionalToAttribute,
+		apply: func(values []string, nodes additionalNodes) {
+			code := catalogAttr(values[0], catalog.Establishment)
+			forEachSupplierAddress(nodes.supplier, func(address *UBLRegistrationAddress) { address.AddressTypeCode = code })
+		},
+	},
+	"ordenCompra": {
+		description: "Número de la orden de compra del cliente (cac:OrderReference), hasta 20 caracteres",
+		pattern:     `^\S.{0,19}$`,
+		target:      AdditionalToProperty,
+		apply: func(values []string, nodes additionalNodes) {
+			*nodes.orderReference = &UBLOrderReference{ID: values[0]}
+		},
+	},
+	"observaciones": {
+		description: "Texto libre emitido como cbc:Note, un string o un arreglo de strings",
+		array:       true,
+		pattern:     `\S`,
+		target:      AdditionalToNote,
+		apply: func(values []string, nodes additionalNodes) {
+			for _, value := range values {
+				*nodes.notes = append(*nodes.notes, UBLNote{Value: value})
+			}
+		},
+	},
+}
+
+// forEachSupplierAddress aplica fn a las dos direcciones del emisor que emite convertParty
+func forEachSupplierAddress(supplier *UBLParty, fn func(address *UBLRegistrationAddress)) {
+	fn(&supplier.Party.RegistrationAddress)
+	for i := range supplier.Party.PartyLegalEntity {
+		fn(&supplier.Party.PartyLegalEntity[i].RegistrationAddress)
+	}
+}
+
+// additionalSchema describe las claves de additional en el JSON Schema del documento,
+// con la regla y los mensajes del validador de negocio
+func additionalSchema() map[string]*JSONSchema {
+	properties := make(map[string]*JSONSchema, len(additionalKeys))
+	for name, key := range additionalKeys {
+		expected := additionalExpected(key)
+		schema := &JSONSchema{
+			Description: key.description,
+			Type:        SchemaTypes{"string"},
+			Pattern:     key.pattern,
+			rule:        AdditionalValidationRule,
+			expected:    expected,
+			message:     fmt.Sprintf("additional.%s has the wrong type or format", name),
+		}
+		if key.array {
+			schema.Type = append(schema.Type, "array")
+			schema.Items = &JSONSchema{Type: SchemaTypes{"string"}, Pattern: key.pattern, rule: schema.rule, expected: expected, message: schema.message}
+		}
+		properties[name] = schema
+	}
+	return properties
+}
+
+func additionalExpected(key additionalKey) string {
+	if key.array {
+		return "String or array of strings matching " + key.pattern
+	}
+	return "String matching " + key.pattern
+}
+
+// additionalValues retorna los valores de una clave como strings; ok es false si el
+// tipo no es el que admite la clave
+func additionalValues(key additionalKey, value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, true
+	case []string:
+		return v, key.array
+	case []interface{}:
+		if !key.array {
+			return nil, false
+		}
+		values := make([]string, len(v))
+		for i, item := range v {
+			text, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			values[i] = text
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// sortedAdditionalNames retorna las claves de additional del documento en orden
+func sortedAdditionalNames(doc *BusinessDocument) []string {
+	names := make([]string, 0, len(doc.Additional))
+	for name := range doc.Additional {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateAdditional valida el tipo y el formato de las claves registradas de
+// additional; las desconocidas las reporta el decodificador del request
+func (v *ValidationService) validateAdditional(doc *BusinessDocument) []ValidationError {
+	var errors []ValidationError
+	for _, name := range sortedAdditionalNames(doc) {
+		key, ok := additionalKeys[name]
+		if !ok {
+			continue
+		}
+		values, ok := additionalValues(key, doc.Additional[name])
+		valid := ok && len(values) > 0
+		for _, value := range values {
+			if matched, _ := regexp.MatchString(key.pattern, value); !matched {
+				valid = false
+			}
+		}
+		if !valid {
+			errors = append(errors, ValidationError{
+				Field:    "additional." + name,
+				Expected: additionalExpected(key),
+				Received: strings.TrimSpace(fmt.Sprintf("%v", doc.Additional[name])),
+				Rule:     AdditionalValidationRule,
+				Message:  fmt.Sprintf("additional.%s has the wrong type or format", name),
+			})
+		}
+	}
+	return errors
+}
+
+// applyAdditional emite en la factura o boleta las claves registradas de additional
+func applyAdditional(doc *BusinessDocument, invoice *UBLInvoice) {
+	applyAdditionalTo(doc, additionalNodes{notes: &invoice.Notes, supplier: &invoice.AccountingSupplierParty, orderReference: &invoice.OrderReference})
+}
+
+// applyAdditionalTo es el mapeo central de additional al XML: cada clave registrada se
+// emite en su destino y las desconocidas se ignoran
+func applyAdditionalTo(doc *BusinessDocument, nodes additionalNodes) {
+	for _, name := range sortedAdditionalNames(doc) {
+		key, ok := additionalKeys[name]
+		if !ok {
+			continue
+		}
+		if values, ok := additionalValues(key, doc.Additional[name]); ok && len(values) > 0 {
+			key.apply(values, nodes)
+		}
+	}
+}
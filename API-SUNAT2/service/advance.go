@@ -0,0 +1,294 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// AdvanceOperationType es el tipo de operación del catálogo 51 de una factura de anticipo
+const AdvanceOperationType = "0103"
+
+// advanceRelatedDocumentType es el código del catálogo 12 de una factura emitida por
+// anticipo, con que la factura que lo regulariza lo referencia
+const advanceRelatedDocumentType = "02"
+
+// advanceDocumentID retorna el RUC-01-SERIE-NUMERO de un anticipo del emisor
+func advanceDocumentID(doc *BusinessDocument, advance DocumentReference) string {
+	return fmt.Sprintf("%s-01-%s", doc.Issuer.DocumentID, advance.DocumentID)
+}
+
+// advanceDeductions retorna los anticipos que regulariza la factura con su monto, para
+// el registro del documento
+func advanceDeductions(doc *BusinessDocument) []AffectedDocument {
+	if len(doc.Advances) == 0 {
+		return nil
+	}
+	deductions := make([]AffectedDocument, 0, len(doc.Advances))
+	for _, advance := range doc.Advances {
+		deductions = append(deductions, AffectedDocument{DocumentID: advanceDocumentID(doc, advance), Amount: float64(advance.Amount)})
+	}
+	return deductions
+}
+
+// validateAdvances valida los anticipos que regulariza una factura: que solo los
+// deduzca una factura que no es a su vez de anticipo, que no se repitan y que el total
+// a pagar descuente su suma
+func (v *ValidationService) validateAdvances(doc *BusinessDocument) []ValidationError {
+	if len(doc.Advances) == 0 {
+		return nil
+	}
+	var errors []ValidationError
+	if doc.Type != "01" {
+		errors = append(errors, ValidationError{
+			Field:    "advances",
+			Expected: "Document type 01",
+			Received: doc.Type,
+			Rule:     "advance_validation",
+			Message:  "Only invoices can apply advances",
+		})
+	}
+	if operationTypeOf(doc) == AdvanceOperationType {
+		errors = append(errors, ValidationError{
+			Field:    "operationType",
+			Expected: "Operation type other than " + AdvanceOperationType,
+			Received: AdvanceOperationType,
+			Rule:     "advance_validation",
+			Message:  "An advance invoice cannot apply other advances",
+		})
+	}
+
+	seen := map[string]bool{}
+	applied := 0.0
+	for i, advance := range doc.Advances {
+		field := fmt.Sprintf("advances[%d]", i)
+		if advance.DocumentType != "01" {
+			errors = append(errors, ValidationError{
+				Field:    field + ".documentType",
+				Expected: "01",
+				Received: advance.DocumentType,
+				Rule:     "advance_validation",
+				Message:  "Advances must be invoices (01)",
+			})
+		}
+		if !v.isValidSeriesNumber(advance.DocumentID) {
+			errors = append(errors, ValidationError{
+				Field:    field + ".documentId",
+				Expected: "SERIE-NUMERO",
+				Received: advance.DocumentID,
+				Rule:     "advance_validation",
+				Message:  "Advance document ID must have the series-number format",
+			})
+		}
+		if seen[advance.DocumentID] {
+			errors = append(errors, ValidationError{
+				Field:    field + ".documentId",
+				Expected: "Unique document",
+				Received: advance.DocumentID,
+				Rule:     "advance_validation",
+				Message:  "Advance is duplicated",
+			})
+		}
+		seen[advance.DocumentID] = true
+		if advance.Amount <= 0 {
+			errors = append(errors, ValidationError{
+				Field:    field + ".amount",
+				Expected: "Amount greater than 0",
+				Received: fmt.Sprintf("%.2f", advance.Amount),
+				Rule:     "advance_validation",
+				Message:  "Advance amount must be positive",
+			})
+		}
+		applied += float64(advance.Amount)
+	}
+
+	if expected := float64(doc.Totals.TotalAmount) - applied; math.Abs(expected-float64(doc.Totals.PayableAmount)) > 0.01 {
+		errors = append(errors, ValidationError{
+			Field:      "totals.payableAmount",
+			Expected:   fmt.Sprintf("%.2f", expected),
+			Received:   fmt.Sprintf("%.2f", doc.Totals.PayableAmount),
+			Rule:       "advance_totals_mismatch",
+			Message:    "Payable amount must be the total amount minus the applied advances",
+			Suggestion: fmt.Sprintf("Set payableAmount to %.2f", expected),
+		})
+	}
+	return errors
+}
+
+// advanceLedger lee del store las facturas de anticipo del emisor (todas si ruc viene
+// vacío) con lo regularizado por cada factura, sin contar las facturas anuladas ni
+// exclude, la que se está procesando. Retorna también los anticipos anulados.
+func (s *UBLConverterService) advanceLedger(ruc, exclude string) (map[string]*AdvanceBalance, map[string]bool, error) {
+	advances := map[string]*AdvanceBalance{}
+	voided := map[string]bool{}
+	var applications []DocumentRecord
+	err := s.readJSONRecords(RecordSuffix, func(name string, data []byte) error {
+		var record DocumentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("invalid document record %s: %v", name, err)
+		}
+		if ruc != "" && record.IssuerRUC != ruc {
+			return nil
+		}
+		if !record.Advance && (len(record.Advances) == 0 || record.DocumentID == exclude) {
+			return nil
+		}
+		if _, err := s.store.Read(record.DocumentID + VoidedSuffix); err == nil {
+			if record.Advance {
+				voided[record.DocumentID] = true
+			}
+			return nil
+		}
+		if record.Advance {
+			advances[record.DocumentID] = &AdvanceBalance{
+				DocumentID:         record.DocumentID,
+				IssuerRUC:          record.IssuerRUC,
+				CustomerDocumentID: record.CustomerDocumentID,
+				IssueDate:          record.IssueDate,
+				Currency:           record.Currency,
+				Amount:             record.PayableAmount,
+				Applications:       []AffectedDocument{},
+			}
+		}
+		if len(record.Advances) > 0 && record.DocumentID != exclude {
+			applications = append(applications, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, record := range applications {
+		for _, deduction := range record.Advances {
+			if advance, ok := advances[deduction.DocumentID]; ok {
+				advance.Applied += deduction.Amount
+				advance.Applications = append(advance.Applications, AffectedDocument{DocumentID: record.DocumentID, Amount: deduction.Amount})
+			}
+		}
+	}
+	for _, advance := range advances {
+		advance.Balance = math.Round((advance.Amount-advance.Applied)*100) / 100
+		sort.Slice(advance.Applications, func(i, j int) bool {
+			return advance.Applications[i].DocumentID < advance.Applications[j].DocumentID
+		})
+	}
+	return advances, voided, nil
+}
+
+// AdvanceBalances lista las facturas de anticipo no anuladas del emisor, filtrables por
+// el documento del cliente, con lo regularizado y el saldo pendiente de cada una
+func (s *UBLConverterService) AdvanceBalances(ruc, customer string) ([]AdvanceBalance, error) {
+	advances, _, err := s.advanceLedger(strings.TrimSpace(ruc), "")
+	if err != nil {
+		return nil, err
+	}
+	balances := []AdvanceBalance{}
+	for _, advance := range advances {
+		if customer == "" || advance.CustomerDocumentID == customer {
+			balances = append(balances, *advance)
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].DocumentID < balances[j].DocumentID
+	})
+	return balances, nil
+}
+
+// checkAdvances verifica contra el store que cada anticipo que regulariza la factura
+// exista, no esté anulado, sea del mismo cliente y moneda y tenga saldo para el monto
+// deducido. ProcessDocument serializa las facturas con anticipos para que dos emisiones
+// concurrentes no apliquen el mismo saldo.
+func (s *UBLConverterService) checkAdvances(doc *BusinessDocument) []ValidationError {
+	advances, voided, err := s.advanceLedger(doc.Issuer.DocumentID, DocumentIDOf(doc))
+	if err != nil {
+		return []ValidationError{{
+			Field:    "advances",
+			Expected: "Advances readable from store",
+			Received: err.Error(),
+			Rule:     "advance_unknown",
+			Message:  "Advances could not be read, their balance was not verified",
+		}}
+	}
+
+	var errors []ValidationError
+	for i, deduction := range doc.Advances {
+		field := fmt.Sprintf("advances[%d]", i)
+		id := advanceDocumentID(doc, deduction)
+		advance, ok := advances[id]
+		switch {
+		case voided[id]:
+			errors = append(errors, ValidationError{
+				Field:    field + ".documentId",
+				Expected: "Advance not voided",
+				Received: deduction.DocumentID,
+				Rule:     "advance_voided",
+				Message:  fmt.Sprintf("Advance %s is voided", id),
+			})
+		case !ok:
+			errors = append(errors, ValidationError{
+				Field:    field + ".documentId",
+				Expected: "Advance invoice (operation type " + AdvanceOperationType + ") issued by this service",
+				Received: deduction.DocumentID,
+				Rule:     "advance_not_found",
+				Message:  fmt.Sprintf("Advance %s was not found", id),
+			})
+		case advance.CustomerDocumentID != doc.Customer.DocumentID:
+			errors = append(errors, ValidationError{
+				Field:    field + ".documentId",
+				Expected: "Advance of customer " + doc.Customer.DocumentID,
+				Received: advance.CustomerDocumentID,
+				Rule:     "advance_customer_mismatch",
+				Message:  fmt.Sprintf("Advance %s belongs to another customer", id),
+			})
+		case advance.Currency != doc.Currency:
+			errors = append(errors, ValidationError{
+				Field:    field + ".documentId",
+				Expected: doc.Currency,
+				Received: advance.Currency,
+				Rule:     "advance_currency_mismatch",
+				Message:  fmt.Sprintf("Advance %s was issued in another currency", id),
+			})
+		case float64(deduction.Amount) > advance.Balance+0.005:
+			errors = append(errors, ValidationError{
+				Field:      field + ".amount",
+				Expected:   fmt.Sprintf("At most %.2f", math.Max(advance.Balance, 0)),
+				Received:   fmt.Sprintf("%.2f", deduction.Amount),
+				Rule:       "advance_balance_exceeded",
+				Message:    fmt.Sprintf("Amount exceeds the balance of advance %s: total %.2f, applied %.2f", id, advance.Amount, advance.Applied),
+				Suggestion: fmt.Sprintf("The remaining balance of %s is %.2f", id, math.Max(advance.Balance, 0)),
+			})
+		}
+	}
+	return errors
+}
+
+// applyAdvances agrega a la factura los anticipos que regulariza: la referencia a cada
+// factura de anticipo (catálogo 12, código 02), su cac:PrepaidPayment y el total
+// deducido en LegalMonetaryTotal
+func (c *UBLConverter) applyAdvances(invoice *UBLInvoice, doc *BusinessDocument) {
+	if len(doc.Advances) == 0 {
+		return
+	}
+	prepaid := 0.0
+	for i, advance := range doc.Advances {
+		id := strconv.Itoa(i + 1)
+		invoice.AdditionalDocumentReference = append(invoice.AdditionalDocumentReference, UBLAdditionalDocumentReference{
+			ID:                 advance.DocumentID,
+			DocumentTypeCode:   catalogAttr(advanceRelatedDocumentType, catalog.RelatedDocument),
+			DocumentStatusCode: &UBLTypeCode{ListAgencyName: catalog.AgencySunat, ListName: "Anticipo", Value: id},
+		})
+		invoice.PrepaidPayments = append(invoice.PrepaidPayments, UBLPrepaidPayment{
+			ID:         UBLIDWithScheme{SchemeAgencyName: catalog.AgencySunat, SchemeName: "Anticipo", Value: id},
+			PaidAmount: UBLAmountWithCurrency{CurrencyID: doc.Currency, Value: float64(advance.Amount)},
+		})
+		prepaid += float64(advance.Amount)
+	}
+	invoice.LegalMonetaryTotal.PrepaidAmount = &UBLAmountWithCurrency{CurrencyID: doc.Currency, Value: prepaid}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"fmt"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// IVAPTaxType es el código del Impuesto a la Venta del Arroz Pilado en el catálogo 05
+const IVAPTaxType = "1016"
+
+// AffectationValidationRule es la regla de los tipos de afectación del IGV de las líneas
+const AffectationValidationRule = "affectation_code_validation"
+
+// igvAffectation es el tratamiento de un tipo de afectación del IGV: el tributo al que
+// corresponde, la categoría UN/ECE 5305 y si es un retiro o transferencia gratuita,
+// que se declara en el 9996 con la categoría Z
+type igvAffectation struct {
+	taxType  string
+	category string
+	free     bool
+}
+
+// igvAffectations es el tratamiento de cada tipo de afectación del catálogo 07; los
+// códigos y sus descripciones son los de la lista activa del paquete catalog
+var igvAffectations = map[string]igvAffectation{
+	"10": {"1000", "S", false},
+	"11": {"1000", "S", true},
+	"12": {"1000", "S", true},
+	"13": {"1000", "S", true},
+	"14": {"1000", "S", true},
+	"15": {"1000", "S", true},
+	"16": {"1000", "S", true},
+	"17": {IVAPTaxType, "S", false},
+	"20": {"9997", "E", false},
+	"21": {"9997", "E", true},
+	"30": {"9998", "O", false},
+	"31": {"9998", "O", true},
+	"32": {"9998", "O", true},
+	"33": {"9998", "O", true},
+	"34": {"9998", "O", true},
+	"35": {"9998", "O", true},
+	"36": {"9998", "O", true},
+	"37": {"9998", "O", true},
+	"40": {"9995", "G", false},
+}
+
+// lookupAffectation retorna el tratamiento de un tipo de afectación de la lista activa
+// del catálogo 07
+func lookupAffectation(code string) (igvAffectation, bool) {
+	affectation, ok := igvAffectations[code]
+	if !ok || !catalog.HasCode(catalog.IGVAffectation, code) {
+		return igvAffectation{}, false
+	}
+	return affectation, true
+}
+
+// affectsIGV indica si el tributo lleva tipo de afectación del IGV: el IGV, el IVAP y
+// los que declaran las operaciones exportadas, gratuitas, exoneradas e inafectas
+func affectsIGV(taxType string) bool {
+	switch taxType {
+	case "1000", IVAPTaxType, "9995", FreeTaxType, "9997", "9998":
+		return true
+	}
+	return false
+}
+
+// defaultAffectationCode es el tipo de afectación de un tributo que no lo indica: el de
+// la operación onerosa y, en el 9996, gravado por retiro si lleva IGV o exonerado por
+// transferencia gratuita si no
+func defaultAffectationCode(taxType string, rate float64) string {
+	switch taxType {
+	case IVAPTaxType:
+		return "17"
+	case "9995":
+		return "40"
+	case "9997":
+		return "20"
+	case "9998":
+		return "30"
+	case FreeTaxType:
+		if rate > 0 {
+			return "11"
+		}
+		return "21"
+	}
+	return "10"
+}
+
+// isFreeAffectation indica si el tributo tiene un tipo de afectación gratuito
+func isFreeAffectation(tax Tax) bool {
+	affectation, ok := lookupAffectation(tax.AffectationCode)
+	return ok && affectation.free
+}
+
+// validateAffectationCodes verifica que el tipo de afectación de cada tributo de la
+// línea sea del catálogo 07 y corresponda al tributo: un código gratuito admite el 9996
+// o el tributo de la operación onerosa, y una línea marcada como gratuita no admite un
+// código oneroso
+func (v *ValidationService) validateAffectationCodes(item DocumentItem, i int) []ValidationError {
+	var errors []ValidationError
+	for j, tax := range item.Taxes {
+		if tax.AffectationCode == "" {
+			continue
+		}
+		field := fmt.Sprintf("items[%d].taxes[%d].affectationCode", i, j)
+		affectation, ok := lookupAffectation(tax.AffectationCode)
+		switch {
+		case !affectsIGV(tax.TaxType):
+			errors = append(errors, ValidationError{
+				Field:    field,
+				Expected: "No affectation code",
+				Received: tax.AffectationCode,
+				Rule:     AffectationValidationRule,
+				Message:  fmt.Sprintf("Tax %s does not take an IGV affectation code", tax.TaxType),
+			})
+		case !ok:
+			errors = append(errors, ValidationError{
+				Field:    field,
+				Expected: "IGV affectation code from catalog 07",
+				Received: tax.AffectationCode,
+				Rule:     AffectationValidationRule,
+				Message:  "Affectation code is not valid",
+			})
+		case tax.TaxType != affectation.taxType && !(affectation.free && tax.TaxType == FreeTaxType):
+			errors = append(errors, ValidationError{
+				Field:    field,
+				Expected: fmt.Sprintf("Affectation code for tax %s", tax.TaxType),
+				Received: tax.AffectationCode,
+				Rule:     AffectationValidationRule,
+				Message:  fmt.Sprintf("Affectation code %s belongs to tax %s", tax.AffectationCode, affectation.taxType),
+			})
+		case !affectation.free && (item.Free || tax.TaxType == FreeTaxType):
+			errors = append(errors, ValidationError{
+				Field:    field,
+				Expected: "Free transfer affectation code",
+				Received: tax.AffectationCode,
+				Rule:     AffectationValidationRule,
+				Message:  "Free lines need a withdrawal or free transfer affectation code",
+			})
+		}
+	}
+	return errors
+}
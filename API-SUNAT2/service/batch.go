@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	. "API-SUNAT2/model"
+)
+
+// DefaultMaxBatchDocuments es el número máximo de documentos de un lote de /convert/batch
+const DefaultMaxBatchDocuments = 500
+
+// BatchFailedCode es el código de un lote sin documentos emitidos por errores que no son
+// todos de validación
+const BatchFailedCode = "ERR_BATCH_FAILED"
+
+// BatchDuplicateRule es la regla de un documento que repite el número de otro del lote
+const BatchDuplicateRule = "batch_duplicate"
+
+// ErrBatchTooLarge indica un lote con más documentos que el máximo configurado
+type ErrBatchTooLarge struct {
+	Size int
+	Max  int
+}
+
+func (e *ErrBatchTooLarge) Error() string {
+	return fmt.Sprintf("batch has %d documents, the maximum is %d", e.Size, e.Max)
+}
+
+// BatchEntry es un documento del lote ya decodificado. Failure es el error de
+// decodificación o de estructura del documento: lo marca como fallido sin procesarlo.
+type BatchEntry struct {
+	Document *BusinessDocument
+	Ignored  []ValidationError
+	Failure  *APIResponse
+}
+
+// SetBatchLimit configura el número máximo de documentos de un lote
+func (s *UBLConverterService) SetBatchLimit(max int) {
+	if max > 0 {
+		s.maxBatchDocuments = max
+	}
+}
+
+// ProcessBatch emite los documentos del lote con el mismo certificado. Con onError
+// abort se valida todo el lote antes de firmar: si un documento es inválido no se emite
+// ninguno y los válidos quedan SKIPPED; si un documento falla después de la validación
+// se detiene el lote, pero lo ya emitido no se deshace. Con continue se emiten los
+// válidos. En ambos modos un número repetido dentro del lote falla en su segunda aparición.
+func (s *UBLConverterService) ProcessBatch(ctx context.Context, entries []BatchEntry, certPEM, keyPEM []byte, onError string) (*BatchResult, error) {
+	if len(entries) > s.maxBatchDocuments {
+		return nil, &ErrBatchTooLarge{Size: len(entries), Max: s.maxBatchDocuments}
+	}
+	if onError == "" {
+		onError = BatchOnErrorAbort
+	}
+
+	items := make([]BatchItemResult, len(entries))
+	seen := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		item := &items[i]
+		item.Index = i
+		if entry.Failure != nil {
+			failBatchItem(item, entry.Failure)
+			continue
+		}
+		// El número se compara sin ceros a la izquierda, como lo emite el pipeline
+		item.DocumentID = CanonicalDocumentID(DocumentIDOf(entry.Document))
+		if first, repeated := seen[item.DocumentID]; repeated {
+			failBatchItem(item, &APIResponse{
+				ErrorCode:    ValidationFailedCode,
+				ErrorMessage: "Documento no válido",
+				ValidationErrors: []ValidationError{{
+					Field:    "number",
+					Expected: "Document number not repeated in the batch",
+					Received: entry.Document.Number,
+					Rule:     BatchDuplicateRule,
+					Message:  fmt.Sprintf("Document %s is already at index %d of the batch", item.DocumentID, first),
+				}},
+			})
+			continue
+		}
+		seen[item.DocumentID] = i
+	}
+
+	aborted := false
+	if onError == BatchOnErrorAbort {
+		// La validación corre sobre una copia: el pipeline normaliza el documento y lo
+		// vuelve a validar al emitirlo
+		for i, entry := range entries {
+			if items[i].Status != "" {
+				continue
+			}
+			if _, failure := s.ValidateDocument(ctx, cloneDocument(entry.Document)); failure != nil {
+				failure.Warnings = append(failure.Warnings, entry.Ignored...)
+				failBatchItem(&items[i], failure)
+			}
+		}
+		aborted = hasBatchFailures(items)
+	}
+
+	for i, entry := range entries {
+		item := &items[i]
+		if item.Status != "" {
+			continue
+		}
+		if aborted {
+			item.Status = BatchItemSkipped
+			continue
+		}
+
+		resp, err := s.ProcessDocument(ctx, entry.Document, certPEM, keyPEM)
+		if err != nil {
+			resp = &APIResponse{
+				Status:       "ERROR",
+				ErrorCode:    "ERR_PROCESSING_FAILED",
+				ErrorMessage: fmt.Sprintf("Processing failed: %v", err),
+			}
+		}
+		item.CorrelationID = resp.CorrelationID
+		resp.Warnings = append(resp.Warnings, entry.Ignored...)
+		if resp.Status != "SUCCESS" {
+			failBatchItem(item, resp)
+			aborted = onError == BatchOnErrorAbort
+			continue
+		}
+		item.Status = BatchItemSuccess
+		item.Warnings = resp.Warnings
+		item.DocumentID = resp.DocumentID
+		item.XMLHash = resp.XMLHash
+	}
+
+	return &BatchResult{Summary: summarizeBatch(items, onError, aborted), Items: items}, nil
+}
+
+// BatchResponse arma la respuesta del API de un lote. Un lote con algún documento
+// emitido responde SUCCESS y el detalle de los fallidos; sin documentos emitidos
+// responde VALIDATION_FAILED si todos fallaron la validación y ERR_BATCH_FAILED si no.
+func (s *UBLConverterService) BatchResponse(result *BatchResult) *APIResponse {
+	summary := result.Summary
+	resp := &APIResponse{
+		Status:      "SUCCESS",
+		ProcessedAt: s.clock.Now(),
+		Message:     fmt.Sprintf("%d of %d documents issued", summary.Succeeded, summary.Total),
+		Data: map[string]interface{}{
+			"summary": summary,
+			"items":   result.Items,
+		},
+	}
+	if summary.Failed == 0 || summary.Succeeded > 0 {
+		return resp
+	}
+
+	resp.Status = "ERROR"
+	resp.ErrorCode = ValidationFailedCode
+	for _, failure := range summary.Failures {
+		if failure.ErrorCode != ValidationFailedCode {
+			resp.ErrorCode = BatchFailedCode
+			break
+		}
+	}
+	resp.ErrorMessage = fmt.Sprintf("%d of %d documents failed, no document was issued", summary.Failed, summary.Total)
+	if summary.Aborted {
+		resp.ErrorMessage = fmt.Sprintf("Batch aborted: %d of %d documents failed, no document was issued", summary.Failed, summary.Total)
+	}
+	return resp
+}
+
+func failBatchItem(item *BatchItemResult, failure *APIResponse) {
+	item.Status = BatchItemError
+	item.ErrorCode = failure.ErrorCode
+	item.ErrorMessage = failure.ErrorMessage
+	item.ValidationErrors = failure.ValidationErrors
+	if item.CorrelationID == "" {
+		item.CorrelationID = failure.CorrelationID
+	}
+	item.Warnings = failure.Warnings
+}
+
+func hasBatchFailures(items []BatchItemResult) bool {
+	for _, item := range items {
+		if item.Status == BatchItemError {
+			return true
+		}
+	}
+	return false
+}
+
+func summarizeBatch(items []BatchItemResult, onError string, aborted bool) BatchSummary {
+	summary := BatchSummary{
+		OnError:       onError,
+		Total:         len(items),
+		Aborted:       aborted,
+		FailedIndices: []int{},
+		Failures:      []BatchFailure{},
+	}
+	for _, item := range items {
+		switch item.Status {
+		case BatchItemSuccess:
+			summary.Succeeded++
+		case BatchItemSkipped:
+			summary.Skipped++
+		case BatchItemError:
+			summary.Failed++
+			summary.FailedIndices = append(summary.FailedIndices, item.Index)
+			summary.Failures = append(summary.Failures, BatchFailure{
+				Index:            item.Index,
+				DocumentID:       item.DocumentID,
+				ErrorCode:        item.ErrorCode,
+				ErrorMessage:     item.ErrorMessage,
+				ValidationErrors: item.ValidationErrors,
+			})
+		}
+	}
+	return summary
+}
+
+// cloneDocument copia el documento por JSON, conservando los campos que no se serializan
+func cloneDocument(doc *BusinessDocument) *BusinessDocument {
+	clone := &BusinessDocument{}
+	if data, err := json.Marshal(doc); err == nil && json.Unmarshal(data, clone) == nil {
+		clone.TemplateFields = doc.TemplateFields
+		return clone
+	}
+	copied := *doc
+	return &copied
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// Modos de la regla de identificación del adquiriente en boletas
+const (
+	BoletaIdentificationError   = "error"
+	BoletaIdentificationWarning = "warning"
+	BoletaIdentificationOff     = "off"
+)
+
+// BoletaIdentificationRule es la regla de una boleta que supera el umbral sin
+// identificar al adquiriente
+const BoletaIdentificationRule = "boleta_customer_identification"
+
+var identityDocumentPattern = regexp.MustCompile(`^[A-Za-z0-9]{1,15}$`)
+
+// SetBoletaIdentificationCheck configura si una boleta sobre el umbral sin cliente
+// identificado es un error, un warning o no se verifica; valores desconocidos se ignoran
+func (v *ValidationService) SetBoletaIdentificationCheck(mode string) {
+	switch mode {
+	case BoletaIdentificationError, BoletaIdentificationWarning, BoletaIdentificationOff:
+		v.boletaIdentificationCheck = mode
+	}
+}
+
+// SetBoletaIdentificationThresholds configura la tabla de umbrales por fecha de vigencia
+func (v *ValidationService) SetBoletaIdentificationThresholds(thresholds []catalog.BoletaIdentificationThreshold) {
+	if len(thresholds) > 0 {
+		v.boletaThresholds = thresholds
+	}
+}
+
+// BoletaIdentificationWarnings retorna como warnings las boletas sobre el umbral sin
+// cliente identificado cuando la regla está en modo warning
+func (v *ValidationService) BoletaIdentificationWarnings(doc *BusinessDocument) []ValidationError {
+	if v.boletaIdentificationCheck != BoletaIdentificationWarning {
+		return nil
+	}
+	return v.checkBoletaIdentification(doc)
+}
+
+// checkBoletaIdentification verifica que una boleta cuyo importe total en soles supera
+// el umbral vigente en su fecha de emisión identifique al adquiriente. En moneda
+// extranjera el total se convierte con exchangeRate, obligatorio para decidir.
+func (v *ValidationService) checkBoletaIdentification(doc *BusinessDocument) []ValidationError {
+	if doc.Type != "03" || v.boletaIdentificationCheck == BoletaIdentificationOff {
+		return nil
+	}
+	threshold := catalog.BoletaIdentificationThresholdAt(v.boletaThresholds, doc.IssueDate)
+	if threshold == 0 || v.hasValidCustomerIdentity(doc.Customer) {
+		return nil
+	}
+
+	total := float64(doc.Totals.TotalAmount)
+	if doc.Currency != "" && doc.Currency != "PEN" {
+		if doc.ExchangeRate <= 0 {
+			// Sin tipo de cambio el total no se puede comparar con el umbral en soles
+			return []ValidationError{{
+				Field:    "exchangeRate",
+				Expected: "Exchange rate to PEN",
+				Received: "",
+				Rule:     BoletaIdentificationRule,
+				Message:  fmt.Sprintf("Boleta in %s without an identified customer needs the exchange rate to check the S/ %.2f threshold", doc.Currency, threshold),
+			}}
+		}
+		total = math.Round(total*float64(doc.ExchangeRate)*100) / 100
+	}
+	if total <= threshold {
+		return nil
+	}
+	return []ValidationError{{
+		Field:    "customer.documentId",
+		Expected: fmt.Sprintf("Customer identity document for boletas over S/ %.2f", threshold),
+		Received: strings.TrimSpace(doc.Customer.DocumentType + " " + doc.Customer.DocumentID),
+		Rule:     BoletaIdentificationRule,
+		Message:  fmt.Sprintf("Boleta total S/ %.2f exceeds S/ %.2f and the customer is not identified", total, threshold),
+	}}
+}
+
+// hasValidCustomerIdentity indica si el cliente tiene un documento de identidad del
+// catálogo 06 con el formato de su tipo; "0" o "-" (sin documento) y los números en
+// ceros de "CLIENTES VARIOS" no lo identifican
+func (v *ValidationService) hasValidCustomerIdentity(customer Party) bool {
+	id := strings.TrimSpace(customer.DocumentID)
+	if strings.Trim(id, "0") == "" || strings.Trim(id, "-") == "" {
+		return false
+	}
+	switch customer.DocumentType {
+	case "", "0", "-":
+		return false
+	case "1":
+		return isDigits(id) && len(id) == 8
+	case CustomerDocumentRUC:
+		return v.isValidRUC(id)
+	case "4", "7":
+		return identityDocumentPattern.MatchString(id) && len(id) <= 12
+	default:
+		return identityDocumentPattern.MatchString(id)
+	}
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	. "API-SUNAT2/util"
+)
+
+// Algoritmos de canonicalización (C14N 1.0 sin comentarios) y transformación
+// enveloped-signature con que firman los facturadores
+const (
+	C14NInclusive      = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	C14NExclusive      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	TransformEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+// xmlNamespace es el namespace implícito del prefijo xml
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// c14nTarget indica qué parte del XML se canonicaliza
+type c14nTarget struct {
+	// id elige el elemento con ese atributo Id; vacío es el elemento raíz
+	id string
+	// signedInfo elige el ds:SignedInfo de la ds:Signature con ese ordinal (0 es la
+	// primera del documento); -1 no lo usa
+	signedInfo int
+	// enveloped omite la ds:Signature con ese ordinal; -1 no omite ninguna
+	enveloped int
+}
+
+// c14nFrame es el estado de un elemento abierto durante la canonicalización
+type c14nFrame struct {
+	// scope son los namespaces visibles por prefijo; rendered los ya escritos en la salida
+	scope    map[string]string
+	rendered map[string]string
+	name     string
+	// signature es el ordinal de la ds:Signature que contiene al elemento, -1 si ninguna
+	signature      int
+	inTarget, apex bool
+	skip           bool
+}
+
+// canonicalize retorna la forma canónica C14N 1.0 (inclusiva o exclusiva) de la parte
+// del XML que indica target. Cubre lo que emiten los facturadores: no normaliza los
+// espacios de los valores de atributos, no hereda atributos xml:* de los ancestros ni
+// admite la lista InclusiveNamespaces de la variante exclusiva.
+func canonicalize(xmlData []byte, algorithm string, target c14nTarget) ([]byte, error) {
+	exclusive := false
+	switch algorithm {
+	case C14NInclusive:
+	case C14NExclusive:
+		exclusive = true
+	default:
+		return nil, fmt.Errorf("unsupported canonicalization algorithm %q", algorithm)
+	}
+
+	decoder := NewRawXMLDecoder(bytes.NewReader(xmlData))
+	var out bytes.Buffer
+	stack := []c14nFrame{{scope: map[string]string{"xml": xmlNamespace}, rendered: map[string]string{}, signature: -1}}
+	signatures := 0
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			return nil, fmt.Errorf("element to canonicalize not found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		parent := &stack[len(stack)-1]
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			frame := c14nFrame{scope: parent.scope, rendered: parent.rendered, signature: parent.signature, inTarget: parent.inTarget, skip: parent.skip}
+			declared := map[string]string{}
+			var attrs []xml.Attr
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					declared[""] = attr.Value
+				case attr.Name.Space == "xmlns":
+					declared[attr.Name.Local] = attr.Value
+				default:
+					attrs = append(attrs, attr)
+				}
+			}
+			if len(declared) > 0 {
+				frame.scope = mergeNamespaces(parent.scope, declared)
+			}
+			name := ResolveName(t.Name)
+			if space, ok := frame.scope[t.Name.Space]; ok {
+				name.Space = space
+			}
+
+			if name == DS("Signature") {
+				frame.signature = signatures
+				signatures++
+			}
+			if !frame.inTarget {
+				switch {
+				case target.signedInfo >= 0:
+					frame.apex = name == DS("SignedInfo") && frame.signature == target.signedInfo
+				case target.id != "":
+					for _, attr := range attrs {
+						if attr.Name.Space == "" && attr.Name.Local == "Id" && attr.Value == target.id {
+							frame.apex = true
+						}
+					}
+				default:
+					frame.apex = len(stack) == 1
+				}
+				frame.inTarget = frame.apex
+			}
+			if frame.inTarget && name == DS("Signature") && frame.signature == target.enveloped {
+				frame.skip = true
+			}
+			if frame.inTarget && !frame.skip {
+				frame.name = qualifiedName(t.Name)
+				frame.rendered = writeC14NStart(&out, &frame, t.Name, attrs, declared, parent.rendered, exclusive)
+			}
+			stack = append(stack, frame)
+		case xml.EndElement:
+			frame := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if frame.inTarget && !frame.skip {
+				out.WriteString("</" + frame.name + ">")
+			}
+			if frame.apex {
+				return out.Bytes(), nil
+			}
+		case xml.CharData:
+			if parent.inTarget && !parent.skip {
+				out.WriteString(escapeC14N(string(t), false))
+			}
+		case xml.ProcInst:
+			if parent.inTarget && !parent.skip {
+				out.WriteString("<?" + t.Target)
+				if len(t.Inst) > 0 {
+					out.WriteString(" " + string(t.Inst))
+				}
+				out.WriteString("?>")
+			}
+		}
+	}
+}
+
+// writeC14NStart escribe la etiqueta de apertura canónica y retorna los namespaces
+// escritos hasta el elemento. La variante inclusiva escribe en el ápice todos los
+// namespaces visibles y después los que cada elemento declara; la exclusiva solo los
+// que usan el elemento y sus atributos.
+func writeC14NStart(out *bytes.Buffer, frame *c14nFrame, name xml.Name, attrs []xml.Attr, declared, rendered map[string]string, exclusive bool) map[string]string {
+	candidates := declared
+	switch {
+	case exclusive:
+		candidates = map[string]string{}
+		used := []string{name.Space}
+		for _, attr := range attrs {
+			if attr.Name.Space != "" {
+				used = append(used, attr.Name.Space)
+			}
+		}
+		for _, prefix := range used {
+			if space, ok := frame.scope[prefix]; ok {
+				candidates[prefix] = space
+			} else if prefix == "" {
+				candidates[""] = ""
+			}
+		}
+	case frame.apex:
+		candidates = frame.scope
+	}
+
+	var prefixes []string
+	for prefix, space := range candidates {
+		if prefix == "xml" {
+			continue
+		}
+		previous, ok := rendered[prefix]
+		if prefix == "" && space == "" {
+			// xmlns="" solo anula un namespace por defecto ya escrito
+			if ok && previous != "" {
+				prefixes = append(prefixes, prefix)
+			}
+			continue
+		}
+		if !ok || previous != space {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+
+	out.WriteString("<" + frame.name)
+	if len(prefixes) > 0 {
+		added := map[string]string{}
+		for _, prefix := range prefixes {
+			added[prefix] = candidates[prefix]
+			if prefix == "" {
+				out.WriteString(` xmlns="` + escapeC14N(candidates[prefix], true) + `"`)
+			} else {
+				out.WriteString(" xmlns:" + prefix + `="` + escapeC14N(candidates[prefix], true) + `"`)
+			}
+		}
+		rendered = mergeNamespaces(rendered, added)
+	}
+
+	// Los atributos se ordenan por namespace y nombre local; los sin prefijo van primero
+	namespaceOf := func(attr xml.Attr) string {
+		if attr.Name.Space == "" {
+			return ""
+		}
+		return frame.scope[attr.Name.Space]
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		if a, b := namespaceOf(attrs[i]), namespaceOf(attrs[j]); a != b {
+			return a < b
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+	for _, attr := range attrs {
+		out.WriteString(" " + qualifiedName(attr.Name) + `="` + escapeC14N(attr.Value, true) + `"`)
+	}
+	out.WriteString(">")
+	return rendered
+}
+
+// mergeNamespaces retorna una copia de base con los namespaces de added
+func mergeNamespaces(base, added map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(added))
+	for prefix, space := range base {
+		merged[prefix] = space
+	}
+	for prefix, space := range added {
+		merged[prefix] = space
+	}
+	return merged
+}
+
+// qualifiedName retorna el nombre con prefijo de un token leído con RawToken
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+var (
+	c14nTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	c14nAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// escapeC14N escapa un texto o, con attr, el valor de un atributo según C14N
+func escapeC14N(value string, attr bool) string {
+	if attr {
+		return c14nAttrEscaper.Replace(value)
+	}
+	return c14nTextEscaper.Replace(value)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"regexp"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// catalogURIAttr reconoce los atributos listURI/schemeURI que apuntan a un catálogo SUNAT
+var catalogURIAttr = regexp.MustCompile(` (?:listURI|schemeURI)="` + regexp.QuoteMeta(catalog.URIPrefix) + `\d+"`)
+
+// stripCatalogURIs quita del XML los URI de catálogos SUNAT; el resto de atributos de
+// lista y esquema se conserva
+func stripCatalogURIs(xmlData []byte) []byte {
+	return catalogURIAttr.ReplaceAll(xmlData, nil)
+}
+
+// catalogAttr retorna el código con los atributos de lista (listAgencyName, listName,
+// listURI y listID) de su catálogo. Un catálogo desconocido emite el código sin atributos.
+func catalogAttr(code, catalogID string) UBLTypeCode {
+	c, _ := catalog.Lookup(catalogID)
+	return UBLTypeCode{
+		ListAgencyName: c.AgencyName,
+		ListID:         c.ListID,
+		ListName:       c.Name,
+		ListURI:        c.URI,
+		Value:          code,
+	}
+}
+
+// catalogScheme retorna el identificador con los atributos de esquema de su catálogo,
+// para los elementos cbc:ID que la guía emite con schemeAgencyName/schemeName/schemeURI
+func catalogScheme(value, catalogID string) UBLIDWithScheme {
+	c, _ := catalog.Lookup(catalogID)
+	return UBLIDWithScheme{
+		SchemeAgencyName: c.AgencyName,
+		SchemeID:         c.ListID,
+		SchemeName:       c.Name,
+		SchemeURI:        c.URI,
+		Value:            value,
+	}
+}
+
+// catalogQuantity retorna la cantidad con la unidad de medida del catálogo 03
+func catalogQuantity(quantity float64, unitCode string) UBLQuantityWithUnit {
+	c, _ := catalog.Lookup(catalog.UnitOfMeasure)
+	return UBLQuantityWithUnit{
+		UnitCode:               unitCode,
+		UnitCodeListAgencyName: c.AgencyName,
+		UnitCodeListID:         c.ListID,
+		Value:                  quantity,
+	}
+}
+
+// identityScheme retorna el número de documento con el tipo de documento (catálogo 06)
+// en schemeID
+func identityScheme(documentID, documentType string) UBLIDWithScheme {
+	id := catalogScheme(documentID, catalog.IdentityDocument)
+	id.SchemeID = documentType
+	return id
+}
+
+// documentTypeCode retorna el tipo de comprobante (catálogo 01) con el tipo de operación
+// (catálogo 51) en listID
+func documentTypeCode(docType, operationType string) UBLTypeCode {
+	code := catalogAttr(docType, catalog.DocumentType)
+	operation, _ := catalog.Lookup(catalog.OperationType)
+	code.ListID = operationType
+	code.Name = operation.Name
+	return code
+}
+
+// LoadCatalogOverrides aplica las listas de códigos del directorio de overrides con la
+// fecha del reloj del servicio y registra en el log cuáles quedaron activas. Si el
+// directorio tiene un archivo inválido se mantienen las listas vigentes.
+func (s *UBLConverterService) LoadCatalogOverrides(dir string) ([]catalog.Override, error) {
+	overrides, err := catalog.LoadOverrides(dir, s.clock.Now().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		if override.Active {
+			s.GetLogger().Infof("Catálogo %s: override versión %s vigente desde %s (%d códigos)", override.ID, override.Version, override.ValidFrom, override.Codes)
+		} else {
+			s.GetLogger().Warnf("Catálogo %s: override versión %s no aplicado: %s", override.ID, override.Version, override.Reason)
+		}
+	}
+	return overrides, nil
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// Estados del documento según el CDR
+const (
+	CDRAccepted = "ACEPTADO"
+	CDRObserved = "OBSERVADO"
+	CDRRejected = "RECHAZADO"
+)
+
+// EnvironmentMock es el ambiente registrado para los envíos simulados
+const EnvironmentMock = "mock"
+
+// sunatRUC es el RUC de SUNAT, emisor de los CDR
+const sunatRUC = "20131312955"
+
+type cdrApplicationResponse struct {
+	Notes        []string `xml:"Note"`
+	ReceiverID   string   `xml:"ReceiverParty>PartyIdentification>ID"`
+	ReferenceID  string   `xml:"DocumentResponse>Response>ReferenceID"`
+	ResponseCode string   `xml:"DocumentResponse>Response>ResponseCode"`
+	Description  string   `xml:"DocumentResponse>Response>Description"`
+	DocumentType string   `xml:"DocumentResponse>DocumentReference>DocumentTypeCode"`
+}
+
+// ParseCDR extrae el resultado del ApplicationResponse contenido en el ZIP del CDR
+func ParseCDR(zipData []byte) (*CDRResult, error) {
+	_, result, _, err := parseCDRResponse(zipData)
+	return result, err
+}
+
+// parseCDRResponse retorna además del resultado el nombre del XML del CDR y el
+// ApplicationResponse completo, de donde se identifica el documento que responde
+func parseCDRResponse(zipData []byte) (string, *CDRResult, *cdrApplicationResponse, error) {
+	fileName, xmlData, err := UnzipXMLBytes(zipData)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid CDR zip: %v", err)
+	}
+
+	// Se busca el elemento ApplicationResponse en lugar de asumir que es el primero,
+	// porque la firma puede ir antes del elemento raíz
+	decoder := NewXMLDecoder(bytes.NewReader(xmlData))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", nil, nil, fmt.Errorf("ApplicationResponse not found in CDR")
+		}
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("invalid CDR XML: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name != (xml.Name{Space: NamespaceApplicationResponse, Local: "ApplicationResponse"}) {
+			continue
+		}
+
+		var response cdrApplicationResponse
+		if err := decoder.DecodeElement(&response, &start); err != nil {
+			return "", nil, nil, fmt.Errorf("invalid CDR XML: %v", err)
+		}
+		result := &CDRResult{
+			ReferenceID:  strings.TrimSpace(response.ReferenceID),
+			ResponseCode: strings.TrimSpace(response.ResponseCode),
+			Description:  strings.TrimSpace(response.Description),
+			Notes:        response.Notes,
+		}
+		result.Status = cdrStatus(result)
+		return fileName, result, &response, nil
+	}
+}
+
+// cdrStatus clasifica el CDR: código 0 es aceptado (observado si trae notas) y
+// cualquier otro código es rechazo
+func cdrStatus(result *CDRResult) string {
+	code, err := strconv.Atoi(result.ResponseCode)
+	if err != nil || code != 0 {
+		return CDRRejected
+	}
+	if len(result.Notes) > 0 {
+		return CDRObserved
+	}
+	return CDRAccepted
+}
+
+// MockSunatRules define el resultado de los CDR simulados. Sin reglas se acepta todo.
+type MockSunatRules struct {
+	// RejectSeries son las series que se rechazan
+	RejectSeries []string
+	// ObserveAmount observa los documentos con importe total mayor; 0 desactiva la regla
+	ObserveAmount float64
+}
+
+// MockSunatClient simula el billService de SUNAT sin red: genera un CDR sintético
+// firmado con el certificado configurado según las reglas indicadas
+type MockSunatClient struct {
+	signer  *DigitalSignatureService
+	certPEM []byte
+	keyPEM  []byte
+	rules   MockSunatRules
+	clock   Clock
+
+	mu      sync.Mutex
+	tickets map[string][]byte
+	// bills son los CDR de los comprobantes recibidos, para getStatusCdr
+	bills map[string]*SunatCDRStatus
+}
+
+func NewMockSunatClient(signer *DigitalSignatureService, certPEM, keyPEM []byte, rules MockSunatRules, clock Clock) *MockSunatClient {
+	return &MockSunatClient{
+		signer:  signer,
+		certPEM: certPEM,
+		keyPEM:  keyPEM,
+		rules:   rules,
+		clock:   clock,
+		tickets: make(map[string][]byte),
+		bills:   make(map[string]*SunatCDRStatus),
+	}
+}
+
+type mockCDRDocument struct {
+	XMLName             xml.Name `xml:"ar:ApplicationResponse"`
+	XmlnsAr             string   `xml:"xmlns:ar,attr"`
+	XmlnsCac            string   `xml:"xmlns:cac,attr"`
+	XmlnsCbc            string   `xml:"xmlns:cbc,attr"`
+	UBLVersionID        string   `xml:"cbc:UBLVersionID"`
+	CustomizationID     string   `xml:"cbc:CustomizationID"`
+	ID                  string   `xml:"cbc:ID"`
+	IssueDate           string   `xml:"cbc:IssueDate"`
+	IssueTime           string   `xml:"cbc:IssueTime"`
+	ResponseDate        string   `xml:"cbc:ResponseDate"`
+	ResponseTime        string   `xml:"cbc:ResponseTime"`
+	Notes               []string `xml:"cbc:Note"`
+	SenderID            string   `xml:"cac:SenderParty>cac:PartyIdentification>cbc:ID"`
+	ReceiverID          string   `xml:"cac:ReceiverParty>cac:PartyIdentification>cbc:ID"`
+	ReferenceID         string   `xml:"cac:DocumentResponse>cac:Response>cbc:ReferenceID"`
+	ResponseCode        string   `xml:"cac:DocumentResponse>cac:Response>cbc:ResponseCode"`
+	Description         string   `xml:"cac:DocumentResponse>cac:Response>cbc:Description"`
+	DocumentReferenceID string   `xml:"cac:DocumentResponse>cac:DocumentReference>cbc:ID"`
+}
+
+func (m *MockSunatClient) SendBill(ctx context.Context, fileName string, zipData []byte) ([]byte, error) {
+	baseName := strings.TrimSuffix(fileName, ".zip")
+	parts := documentIDPattern.FindStringSubmatch(baseName)
+	if parts == nil {
+		return nil, &SunatFault{Code: "soap-env:Client.0151", Message: "El nombre del archivo ZIP es incorrecto"}
+	}
+	ruc, series := parts[1], parts[3]
+	reference := fmt.Sprintf("%s-%s", series, parts[4])
+
+	_, xmlData, err := UnzipXMLBytes(zipData)
+	if err != nil {
+		return nil, &SunatFault{Code: "soap-env:Client.0155", Message: "El archivo ZIP esta vacio o no contiene un XML"}
+	}
+
+	responseCode := "0"
+	description := fmt.Sprintf("El comprobante numero %s, ha sido aceptado", reference)
+	var notes []string
+	for _, rejected := range m.rules.RejectSeries {
+		if strings.EqualFold(rejected, series) {
+			responseCode = "2999"
+			description = fmt.Sprintf("El comprobante numero %s fue rechazado por el simulador (serie %s)", reference, series)
+		}
+	}
+	if responseCode == "0" && m.rules.ObserveAmount > 0 {
+		if amount, err := readPayableAmount(xmlData); err == nil && amount > m.rules.ObserveAmount {
+			notes = append(notes, fmt.Sprintf("4999 - El importe total %.2f supera el umbral del simulador (%.2f)", amount, m.rules.ObserveAmount))
+		}
+	}
+
+	cdr, err := m.buildCDR(ruc, baseName, reference, responseCode, description, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := &SunatCDRStatus{Code: "0001", Message: "El comprobante existe y está aceptado.", CDR: cdr}
+	if responseCode != "0" {
+		status.Code, status.Message = "0002", "El comprobante existe y está rechazado."
+	}
+	m.bills[baseName] = status
+	return cdr, nil
+}
+
+// SendSummary simula sendSummary: el resumen se acepta de inmediato y su CDR queda
+// disponible con el ticket retornado
+func (m *MockSunatClient) SendSummary(ctx context.Context, fileName string, zipData []byte) (string, error) {
+	baseName := strings.TrimSuffix(fileName, ".zip")
+	parts := summaryIDPattern.FindStringSubmatch(baseName)
+	if parts == nil {
+		return "", &SunatFault{Code: "soap-env:Client.0151", Message: "El nombre del archivo ZIP es incorrecto"}
+	}
+	if _, _, err := UnzipXMLBytes(zipData); err != nil {
+		return "", &SunatFault{Code: "soap-env:Client.0155", Message: "El archivo ZIP esta vacio o no contiene un XML"}
+	}
+
+	reference := strings.TrimPrefix(baseName, parts[1]+"-")
+	description := fmt.Sprintf("El Resumen diario %s, ha sido aceptado", reference)
+	if parts[2] == ReversionDocumentType {
+		description = fmt.Sprintf("El Resumen de Reversiones %s, ha sido aceptado", reference)
+	}
+	cdr, err := m.buildCDR(parts[1], baseName, reference, "0", description, nil)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ticket := fmt.Sprintf("%d%03d", m.clock.Now().Unix(), len(m.tickets)+1)
+	m.tickets[ticket] = cdr
+	return ticket, nil
+}
+
+// GetStatus retorna el CDR de un ticket de SendSummary
+func (m *MockSunatClient) GetStatus(ctx context.Context, ticket string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cdr, ok := m.tickets[ticket]
+	if !ok {
+		return nil, &SunatFault{Code: "soap-env:Client.0127", Message: "El ticket no existe"}
+	}
+	return cdr, nil
+}
+
+// GetStatusCdr retorna el CDR de un comprobante recibido por SendBill, o el código 0011
+// si el simulador no lo recibió
+func (m *MockSunatClient) GetStatusCdr(ctx context.Context, ruc, docType, series, number string) (*SunatCDRStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if status, ok := m.bills[fmt.Sprintf("%s-%s-%s-%s", ruc, docType, series, number)]; ok {
+		return status, nil
+	}
+	return &SunatCDRStatus{Code: SunatCdrNotFound, Message: "El comprobante de pago electrónico no existe."}, nil
+}
+
+// buildCDR genera el ZIP con el ApplicationResponse firmado
+func (m *MockSunatClient) buildCDR(ruc, baseName, reference, responseCode, description string, notes []string) ([]byte, error) {
+	now := m.clock.Now()
+	cdrXML, err := xml.MarshalIndent(mockCDRDocument{
+		XmlnsAr:             "urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2",
+		XmlnsCac:            "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
+		XmlnsCbc:            "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
+		UBLVersionID:        "2.0",
+		CustomizationID:     "1.0",
+		ID:                  strconv.FormatInt(now.UnixNano(), 10),
+		IssueDate:           now.Format("2006-01-02"),
+		IssueTime:           now.Format("15:04:05"),
+		ResponseDate:        now.Format("2006-01-02"),
+		ResponseTime:        now.Format("15:04:05"),
+		Notes:               notes,
+		SenderID:            sunatRUC,
+		ReceiverID:          "6-" + ruc,
+		ReferenceID:         reference,
+		ResponseCode:        responseCode,
+		Description:         description,
+		DocumentReferenceID: reference,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	signedCDR, err := m.signer.SignXML(append([]byte(xml.Header), cdrXML...), m.certPEM, m.keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("mock CDR signing failed: %v", err)
+	}
+	return ZipXMLBytes("R-"+baseName+".xml", signedCDR)
+}
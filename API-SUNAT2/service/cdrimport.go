@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "API-SUNAT2/model"
+)
+
+// CDRDocumentNotFoundRule es el warning de un CDR cuyo documento no está en el store
+const CDRDocumentNotFoundRule = "cdr_document_not_found"
+
+var (
+	ErrInvalidCDR      = errors.New("invalid CDR")
+	ErrForbiddenIssuer = errors.New("the client is not authorized for RUC")
+)
+
+// cdrReferencePattern reconoce el SERIE-NUMERO del cbc:ReferenceID de un CDR
+var cdrReferencePattern = regexp.MustCompile(`^([A-Z0-9]{4})-(\d{1,8})$`)
+
+// cdrFileNamePattern reconoce el R-RUC-TIPO-SERIE-NUMERO del XML de un CDR
+var cdrFileNamePattern = regexp.MustCompile(`^R-(\d{11})-(\d{2})-([A-Z0-9]{4})-(\d{1,8})\.xml$`)
+
+// cdrDocumentID identifica el documento que responde el CDR: la serie y el número del
+// cbc:ReferenceID, el RUC del receptor y el tipo del DocumentReference. El RUC y el tipo
+// que falten se toman del nombre R-RUC-TIPO-SERIE-NUMERO.xml, que debe coincidir con la
+// serie y el número de la referencia.
+func cdrDocumentID(fileName string, result *CDRResult, response *cdrApplicationResponse) string {
+	reference := cdrReferencePattern.FindStringSubmatch(strings.ToUpper(result.ReferenceID))
+	if reference == nil {
+		return ""
+	}
+	ruc := strings.TrimPrefix(strings.TrimSpace(response.ReceiverID), "6-")
+	docType := strings.TrimSpace(response.DocumentType)
+	if named := cdrFileNamePattern.FindStringSubmatch(path.Base(fileName)); named != nil &&
+		named[3] == reference[1] && CanonicalNumber(named[4]) == CanonicalNumber(reference[2]) {
+		if ruc == "" {
+			ruc = named[1]
+		}
+		if docType == "" {
+			docType = named[2]
+		}
+	}
+	documentID := DocumentKey(ruc, docType, reference[1], reference[2])
+	if !documentIDPattern.MatchString(documentID) {
+		return ""
+	}
+	return documentID
+}
+
+// ImportCDR parsea un CDR recibido fuera del flujo de envío y lo asocia al documento
+// que responde: guarda el CDR y el envío del ambiente y registra el estado, con los
+// mismos eventos que un envío. Si el documento no está en el store solo retorna el
+// parseo con un warning. authorized decide si el cliente puede actualizar el RUC del
+// documento; si no, retorna ErrForbiddenIssuer.
+func (s *UBLConverterService) ImportCDR(cdr []byte, environment string, authorized func(ruc string) bool) (*CDRImport, []ValidationError, error) {
+	fileName, result, response, err := parseCDRResponse(cdr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidCDR, err)
+	}
+	imported := &CDRImport{CDR: *result, DocumentID: cdrDocumentID(fileName, result, response)}
+	if imported.DocumentID == "" {
+		return imported, []ValidationError{{
+			Field:    "cdr",
+			Expected: "ReferenceID SERIE-NUMERO and the receiver RUC",
+			Received: result.ReferenceID,
+			Rule:     CDRDocumentNotFoundRule,
+			Message:  "The CDR does not identify the document it responds to",
+		}}, nil
+	}
+	ruc, _, _ := strings.Cut(imported.DocumentID, "-")
+	if authorized != nil && !authorized(ruc) {
+		return nil, nil, fmt.Errorf("%w %s", ErrForbiddenIssuer, ruc)
+	}
+	if _, err := s.store.Read(RecordName(imported.DocumentID)); err != nil {
+		return imported, []ValidationError{{
+			Field:    "cdr.referenceId",
+			Expected: "A document in the store",
+			Received: imported.DocumentID,
+			Rule:     CDRDocumentNotFoundRule,
+			Message:  fmt.Sprintf("Document %s is not in the store; the CDR was parsed but not associated", imported.DocumentID),
+		}}, nil
+	}
+
+	if environment == "" {
+		environment = s.defaultEnvironment
+	}
+	if s.sunatMock != nil {
+		environment = EnvironmentMock
+	}
+	if err := s.associateCDR(imported, cdr, environment); err != nil {
+		return nil, nil, err
+	}
+	s.describeIssuedDocument(imported)
+	return imported, nil, nil
+}
+
+// associateCDR guarda el CDR y el registro del envío del ambiente, conservando los
+// datos del envío previo si lo hubo, y registra el estado del documento
+func (s *UBLConverterService) associateCDR(imported *CDRImport, cdr []byte, environment string) error {
+	documentID, result := imported.DocumentID, imported.CDR
+	submissionName := fmt.Sprintf("%s.%s.envio", documentID, environment)
+	record := SubmissionRecord{DocumentID: documentID, Environment: environment, SentAt: s.clock.Now(), ZIPFile: documentID + ".zip"}
+	if previous, err := s.store.Read(submissionName); err == nil {
+		if err := json.Unmarshal(previous, &record); err != nil {
+			return fmt.Errorf("invalid submission record %s: %v", documentID, err)
+		}
+	}
+	record.CDRFile = fmt.Sprintf("R-%s.%s.zip", documentID, environment)
+	record.Status, record.ResponseCode = result.Status, result.ResponseCode
+	record.Description, record.Notes = result.Description, result.Notes
+
+	if _, err := s.store.Save(record.CDRFile, cdr); err != nil {
+		return fmt.Errorf("saving CDR: %v", err)
+	}
+	data, _ := json.Marshal(record)
+	if _, err := s.store.Save(submissionName, data); err != nil {
+		return fmt.Errorf("saving submission record: %v", err)
+	}
+	s.recordStatusChange(documentID, result.Status, environment, result.Description)
+	imported.Associated, imported.Environment, imported.CDRFile = true, environment, record.CDRFile
+	return nil
+}
+
+// describeIssuedDocument completa la cantidad de líneas, la moneda y los totales con el
+// XML emitido del documento; sin XML legible se omiten
+func (s *UBLConverterService) describeIssuedDocument(imported *CDRImport) {
+	xmlData, err := s.store.Read(imported.DocumentID + ".xml")
+	if err != nil {
+		return
+	}
+	if summary, err := s.invariants.summarize(xmlData); err == nil {
+		imported.LineCountNumeric = len(summary.lineIDs)
+		if count, err := strconv.Atoi(summary.lineCountNumeric); err == nil {
+			imported.LineCountNumeric = count
+		}
+		imported.Currency = summary.currency
+	}
+	if breakdown, err := ExtractAccountingBreakdown(xmlData); err == nil {
+		imported.Totals = breakdown
+		if imported.Currency == "" {
+			imported.Currency = breakdown.Currency
+		}
+	}
+}
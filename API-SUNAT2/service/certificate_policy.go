@@ -0,0 +1,54 @@
+package service
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// ErrCertNotAcceptedInProdCode es el código del error de un certificado autofirmado o
+// de una CA no acreditada usado en producción
+const ErrCertNotAcceptedInProdCode = "ERR_CERT_NOT_ACCEPTED_IN_PROD"
+
+// SetCertificatePolicy configura el ambiente en que se firma y las CAs acreditadas. En
+// producción no se firma con certificados autofirmados ni, si la lista no está vacía,
+// de otras CAs; en los demás ambientes solo se advierte.
+func (s *DigitalSignatureService) SetCertificatePolicy(environment string, acceptedCAs []string) {
+	s.environment = environment
+	s.acceptedCAs = acceptedCAs
+}
+
+// certificateIssue retorna por qué el certificado no sería aceptado en producción;
+// vacío si es de una CA acreditada
+func (s *DigitalSignatureService) certificateIssue(cert *x509.Certificate) string {
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return fmt.Sprintf("certificate %q is self-signed", cert.Subject.CommonName)
+	}
+	if len(s.acceptedCAs) == 0 {
+		return ""
+	}
+	for _, ca := range s.acceptedCAs {
+		if strings.EqualFold(ca, cert.Issuer.CommonName) || strings.EqualFold(ca, cert.Issuer.String()) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("certificate issuer %q is not an accredited CA", cert.Issuer.CommonName)
+}
+
+// CheckCertificate aplica la regla del ambiente al certificado de firma: en producción
+// un certificado no aceptado es un error ERR_CERT_NOT_ACCEPTED_IN_PROD; en los demás
+// ambientes el motivo se retorna como advertencia
+func (s *DigitalSignatureService) CheckCertificate(cert *x509.Certificate, environment string) (warning string, err error) {
+	issue := s.certificateIssue(cert)
+	if issue == "" {
+		return "", nil
+	}
+	if environment == EnvironmentProduction {
+		return "", &KeyValidationError{
+			Code:    ErrCertNotAcceptedInProdCode,
+			Message: fmt.Sprintf("%s: SUNAT only accepts certificates from accredited CAs in production", issue),
+		}
+	}
+	return issue, nil
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "API-SUNAT2/model"
+	"github.com/sirupsen/logrus"
+)
+
+// CertificateSuffix es la extensión del registro del certificado de cada emisor en el store
+const CertificateSuffix = ".cert"
+
+// CertificateAlertThresholds son los días antes del vencimiento en que se alerta,
+// del más holgado al más estricto
+var CertificateAlertThresholds = []int{30, 15, 7}
+
+// CertificateErrorThreshold es el umbral desde el que la alerta se registra como error
+const CertificateErrorThreshold = 7
+
+// CertificateName retorna el nombre del registro del certificado del emisor en el store
+func CertificateName(ruc string) string {
+	return ruc + CertificateSuffix
+}
+
+// certificateMonitor agrupa el estado de las alertas de vencimiento de certificados
+type certificateMonitor struct {
+	mu        sync.Mutex
+	notifiers []CertificateNotifier
+	// expiring es el resultado de la última revisión, expuesto como métrica
+	expiring []ExpiringCertificate
+}
+
+// SetCertificateNotifiers reemplaza los destinos de las alertas de vencimiento
+func (s *UBLConverterService) SetCertificateNotifiers(notifiers ...CertificateNotifier) {
+	s.certificates.mu.Lock()
+	defer s.certificates.mu.Unlock()
+	s.certificates.notifiers = notifiers
+}
+
+// RegisterCertificate registra el certificado con que firma el emisor. Si el emisor
+// cambió de certificado se reinician los umbrales notificados.
+func (s *UBLConverterService) RegisterCertificate(ruc string, certPEM []byte) (*CertificateRecord, error) {
+	record, _, err := s.RegisterEnvironmentCertificate(ruc, certPEM, "")
+	return record, err
+}
+
+// RegisterEnvironmentCertificate registra el certificado asociado al ambiente en que el
+// emisor va a firmar y le aplica la misma regla que el firmante: en producción un
+// certificado autofirmado o de una CA no acreditada es un KeyValidationError
+// ERR_CERT_NOT_ACCEPTED_IN_PROD y no se registra; en los demás ambientes el motivo se
+// retorna como advertencia.
+func (s *UBLConverterService) RegisterEnvironmentCertificate(ruc string, certPEM []byte, environment string) (*CertificateRecord, string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, "", fmt.Errorf("failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	var warning string
+	if environment != "" {
+		if warning, err = s.signer.CheckCertificate(cert, environment); err != nil {
+			return nil, "", err
+		}
+	}
+
+	s.certificates.mu.Lock()
+	defer s.certificates.mu.Unlock()
+
+	serial := cert.SerialNumber.String()
+	if current, err := s.readCertificate(ruc); err == nil && current.SerialNumber == serial &&
+		(environment == "" || current.Environment == environment) {
+		return current, warning, nil
+	}
+	record := &CertificateRecord{
+		IssuerRUC:    ruc,
+		Subject:      cert.Subject.String(),
+		SerialNumber: serial,
+		NotAfter:     cert.NotAfter,
+		Environment:  environment,
+		RegisteredAt: s.clock.Now(),
+	}
+	if err := s.saveCertificate(record); err != nil {
+		return nil, "", err
+	}
+	return record, warning, nil
+}
+
+func (s *UBLConverterService) readCertificate(ruc string) (*CertificateRecord, error) {
+	data, err := s.store.Read(CertificateName(ruc))
+	if err != nil {
+		return nil, err
+	}
+	var record CertificateRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid certificate record %s: %v", ruc, err)
+	}
+	return &record, nil
+}
+
+func (s *UBLConverterService) saveCertificate(record *CertificateRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.Save(CertificateName(record.IssuerRUC), data)
+	return err
+}
+
+// ListCertificates retorna los certificados registrados ordenados por vencimiento
+func (s *UBLConverterService) ListCertificates() ([]CertificateRecord, error) {
+	names, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []CertificateRecord{}
+	for _, name := range names {
+		if !strings.HasSuffix(name, CertificateSuffix) {
+			continue
+		}
+		record, err := s.readCertificate(strings.TrimSuffix(name, CertificateSuffix))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].NotAfter.Before(records[j].NotAfter) })
+	return records, nil
+}
+
+// ExpiringCertificates retorna los certificados que vencen dentro de withinDays días,
+// incluidos los ya vencidos, con los días restantes según el reloj del servicio
+func (s *UBLConverterService) ExpiringCertificates(withinDays int) ([]ExpiringCertificate, error) {
+	records, err := s.ListCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	expiring := []ExpiringCertificate{}
+	for _, record := range records {
+		daysLeft := int(math.Floor(record.NotAfter.Sub(now).Hours() / 24))
+		if daysLeft > withinDays {
+			continue
+		}
+		expiring = append(expiring, ExpiringCertificate{
+			CertificateRecord: record,
+			DaysLeft:          daysLeft,
+			Threshold:         certificateThreshold(daysLeft),
+		})
+	}
+	return expiring, nil
+}
+
+// certificateThreshold retorna el umbral más estricto alcanzado; 0 si ya venció y -1
+// si aún no alcanza ninguno
+func certificateThreshold(daysLeft int) int {
+	if daysLeft < 0 {
+		return 0
+	}
+	threshold := -1
+	for _, t := range CertificateAlertThresholds {
+		if daysLeft <= t {
+			threshold = t
+		}
+	}
+	return threshold
+}
+
+// CheckCertificates revisa los certificados registrados: registra una advertencia (o
+// un error desde los 7 días) por cada certificado próximo a vencer, actualiza la
+// métrica y notifica una sola vez por umbral. Un umbral cuya notificación falla se
+// reintenta en la siguiente revisión.
+func (s *UBLConverterService) CheckCertificates(ctx context.Context) ([]ExpiringCertificate, error) {
+	expiring, err := s.ExpiringCertificates(CertificateAlertThresholds[0])
+	if err != nil {
+		return nil, err
+	}
+
+	s.certificates.mu.Lock()
+	s.certificates.expiring = expiring
+	notifiers := s.certificates.notifiers
+	s.certificates.mu.Unlock()
+
+	for _, cert := range expiring {
+		entry := s.GetLogger().WithFields(logrus.Fields{
+			"ruc":       cert.IssuerRUC,
+			"serial":    cert.SerialNumber,
+			"days_left": cert.DaysLeft,
+		})
+		if cert.DaysLeft < 0 {
+			entry.Errorf("El certificado de firma de %s venció el %s", cert.IssuerRUC, cert.NotAfter.Format("2006-01-02"))
+		} else if cert.Threshold <= CertificateErrorThreshold {
+			entry.Errorf("El certificado de firma de %s vence en %d días", cert.IssuerRUC, cert.DaysLeft)
+		} else {
+			entry.Warnf("El certificado de firma de %s vence en %d días", cert.IssuerRUC, cert.DaysLeft)
+		}
+
+		if len(notifiers) == 0 || containsInt(cert.NotifiedThresholds, cert.Threshold) {
+			continue
+		}
+		if err := notifyCertificate(ctx, notifiers, cert); err != nil {
+			entry.Errorf("No se pudo notificar el vencimiento del certificado: %v", err)
+			continue
+		}
+		if err := s.markCertificateNotified(cert); err != nil {
+			return expiring, err
+		}
+	}
+	return expiring, nil
+}
+
+func notifyCertificate(ctx context.Context, notifiers []CertificateNotifier, cert ExpiringCertificate) error {
+	for _, notifier := range notifiers {
+		if err := notifier.NotifyCertificateExpiring(ctx, cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markCertificateNotified registra el umbral notificado, salvo que el emisor haya
+// registrado otro certificado mientras se notificaba
+func (s *UBLConverterService) markCertificateNotified(cert ExpiringCertificate) error {
+	s.certificates.mu.Lock()
+	defer s.certificates.mu.Unlock()
+
+	record, err := s.readCertificate(cert.IssuerRUC)
+	if err != nil || record.SerialNumber != cert.SerialNumber {
+		return err
+	}
+	record.NotifiedThresholds = append(record.NotifiedThresholds, cert.Threshold)
+	return s.saveCertificate(record)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteCertificateMetrics escribe la métrica certificates_expiring de la última
+// revisión en formato de texto de Prometheus, por emisor y umbral
+func (s *UBLConverterService) WriteCertificateMetrics(w io.Writer) {
+	s.certificates.mu.Lock()
+	defer s.certificates.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP certificates_expiring Certificados de firma que vencen dentro del umbral en días (0 = vencido)")
+	fmt.Fprintln(w, "# TYPE certificates_expiring gauge")
+	for _, cert := range s.certificates.expiring {
+		fmt.Fprintf(w, "certificates_expiring{ruc=%q,days=\"%d\"} 1\n", cert.IssuerRUC, cert.Threshold)
+	}
+}
+
+// StartCertificateMonitor revisa los certificados registrados cada interval en segundo
+// plano, hasta que se llame a la función retornada
+func (s *UBLConverterService) StartCertificateMonitor(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := s.JobContext()
+			if _, err := s.CheckCertificates(ctx); err != nil {
+				s.GetLogger().Errorf("Revisión de certificados falló: %v", err)
+			}
+			cancel()
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// itemClassification emite el código de producto SUNAT (catálogo 25, UNSPSC) de la
+// línea, o nada si la línea no lo indica
+func itemClassification(item DocumentItem) *UBLCommodityClassification {
+	if item.ClassificationCode == "" {
+		return nil
+	}
+	return &UBLCommodityClassification{
+		ItemClassificationCode: catalogAttr(item.ClassificationCode, catalog.ItemClassification),
+	}
+}
+
+// SetClassificationIssuers configura los emisores obligados a indicar el código de
+// producto SUNAT en cada línea; a los demás no se les exige
+func (v *ValidationService) SetClassificationIssuers(rucs []string) {
+	v.classificationIssuers = make(map[string]bool, len(rucs))
+	for _, ruc := range rucs {
+		v.classificationIssuers[ruc] = true
+	}
+}
+
+// validateClassificationCodes valida que el código de producto de cada línea tenga los
+// 8 dígitos de la clasificación UNSPSC y pertenezca a un segmento del catálogo 25
+func (v *ValidationService) validateClassificationCodes(doc *BusinessDocument) []ValidationError {
+	var errors []ValidationError
+	for i, item := range doc.Items {
+		code := item.ClassificationCode
+		if code == "" {
+			continue
+		}
+		field := fmt.Sprintf("items[%d].classificationCode", i)
+		if !catalog.IsUNSPSCCode(code) {
+			errors = append(errors, ValidationError{
+				Field:    field,
+				Expected: "8-digit UNSPSC code",
+				Received: code,
+				Rule:     "classification_code_validation",
+				Message:  "Product code must have the 8 digits of the UNSPSC classification (catalog 25)",
+			})
+			continue
+		}
+		if _, ok := catalog.UNSPSCSegment(code); !ok {
+			errors = append(errors, ValidationError{
+				Field:    field,
+				Expected: "UNSPSC segment from catalog 25",
+				Received: code[:2],
+				Rule:     "classification_code_validation",
+				Message:  fmt.Sprintf("Product code %s does not belong to a UNSPSC segment", code),
+			})
+		}
+	}
+	return errors
+}
+
+// ClassificationWarnings retorna como warnings las líneas sin código de producto de
+// los emisores obligados a indicarlo
+func (v *ValidationService) ClassificationWarnings(doc *BusinessDocument) []ValidationError {
+	if !v.classificationIssuers[doc.Issuer.DocumentID] {
+		return nil
+	}
+	var warnings []ValidationError
+	for i, item := range doc.Items {
+		if item.ClassificationCode == "" && !item.Informative {
+			warnings = append(warnings, ValidationError{
+				Field:    fmt.Sprintf("items[%d].classificationCode", i),
+				Expected: "8-digit UNSPSC code",
+				Rule:     "classification_code_missing",
+				Message:  "Issuer must indicate the SUNAT product code (catalog 25) of each line",
+			})
+		}
+	}
+	return warnings
+}
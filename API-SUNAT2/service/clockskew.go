@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClockSkewCode es el código con que se bloquea la emisión en modo estricto
+const ErrClockSkewCode = "ERR_CLOCK_SKEW"
+
+// Modos del chequeo del reloj
+const (
+	// ClockSkewWarning solo registra el desvío en los logs, el health y las métricas
+	ClockSkewWarning = "warning"
+	// ClockSkewStrict además bloquea la emisión si el desvío supera MaxSkew
+	ClockSkewStrict = "strict"
+)
+
+// Estados del reloj en ClockSkewStatus
+const (
+	ClockUnchecked = "unchecked"
+	ClockOK        = "ok"
+	ClockDrifting  = "drifting"
+	ClockBlocking  = "blocking"
+	ClockUnknown   = "unknown"
+)
+
+// DefaultClockSkewOptions advierte desde 30 segundos de desvío y, en modo estricto,
+// bloquea desde 2 minutos
+var DefaultClockSkewOptions = ClockSkewOptions{Mode: ClockSkewWarning, WarnThreshold: 30 * time.Second, MaxSkew: 2 * time.Minute}
+
+// TimeSource es una fuente de hora de referencia. Offset retorna cuánto adelanta la
+// referencia al reloj local: positivo si el reloj local está atrasado.
+type TimeSource interface {
+	Offset(ctx context.Context) (time.Duration, error)
+	String() string
+}
+
+// ClockSkewOptions configura el chequeo del reloj; los valores en cero conservan el default
+type ClockSkewOptions struct {
+	Mode          string
+	WarnThreshold time.Duration
+	MaxSkew       time.Duration
+}
+
+// ClockSkewStatus es el resultado del último chequeo del reloj
+type ClockSkewStatus struct {
+	Status string `json:"status"`
+	Source string `json:"source,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+	// DriftMs es el desvío del reloj local en milisegundos: positivo si está atrasado
+	DriftMs             int64      `json:"driftMs"`
+	WarnThresholdMs     int64      `json:"warnThresholdMs"`
+	MaxSkewMs           int64      `json:"maxSkewMs"`
+	CheckedAt           *time.Time `json:"checkedAt,omitempty"`
+	Error               string     `json:"error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures,omitempty"`
+}
+
+type clockSkewMonitor struct {
+	mu     sync.Mutex
+	source TimeSource
+	opts   ClockSkewOptions
+	status ClockSkewStatus
+}
+
+// SetClockSkewCheck configura la fuente de hora contra la que se mide el desvío del
+// reloj del servidor; nil deshabilita el chequeo
+func (s *UBLConverterService) SetClockSkewCheck(source TimeSource, opts ClockSkewOptions) {
+	if opts.Mode != ClockSkewStrict {
+		opts.Mode = ClockSkewWarning
+	}
+	if opts.WarnThreshold <= 0 {
+		opts.WarnThreshold = DefaultClockSkewOptions.WarnThreshold
+	}
+	if opts.MaxSkew <= 0 {
+		opts.MaxSkew = DefaultClockSkewOptions.MaxSkew
+	}
+
+	s.clockSkew.mu.Lock()
+	defer s.clockSkew.mu.Unlock()
+	s.clockSkew.source = source
+	s.clockSkew.opts = opts
+	s.clockSkew.status = ClockSkewStatus{Status: ClockUnchecked}
+	if source != nil {
+		s.clockSkew.status.Source = source.String()
+		s.clockSkew.status.Mode = opts.Mode
+		s.clockSkew.status.WarnThresholdMs = opts.WarnThreshold.Milliseconds()
+		s.clockSkew.status.MaxSkewMs = opts.MaxSkew.Milliseconds()
+	}
+}
+
+// ClockSkewStatus retorna el resultado del último chequeo del reloj, o nil si el
+// chequeo no está configurado
+func (s *UBLConverterService) ClockSkewStatus() *ClockSkewStatus {
+	s.clockSkew.mu.Lock()
+	defer s.clockSkew.mu.Unlock()
+	if s.clockSkew.source == nil {
+		return nil
+	}
+	status := s.clockSkew.status
+	return &status
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// CheckClockSkew mide el desvío del reloj contra la fuente configurada y lo registra en
+// los logs si supera el umbral. Si la fuente no responde se conserva el último desvío
+// medido y el estado pasa a unknown: una fuente caída nunca bloquea la emisión.
+func (s *UBLConverterService) CheckClockSkew(ctx context.Context) (*ClockSkewStatus, error) {
+	s.clockSkew.mu.Lock()
+	source, opts := s.clockSkew.source, s.clockSkew.opts
+	s.clockSkew.mu.Unlock()
+	if source == nil {
+		return nil, errors.New("clock skew check is not configured")
+	}
+
+	offset, err := source.Offset(ctx)
+	now := s.clock.Now()
+
+	s.clockSkew.mu.Lock()
+	defer s.clockSkew.mu.Unlock()
+	status := &s.clockSkew.status
+	status.CheckedAt = &now
+	if err != nil {
+		status.Status = ClockUnknown
+		status.Error = err.Error()
+		status.ConsecutiveFailures++
+		s.GetLogger().Warnf("No se pudo medir el desvío del reloj contra %s: %v", source, err)
+		result := *status
+		return &result, err
+	}
+
+	status.DriftMs = offset.Milliseconds()
+	status.Error = ""
+	status.ConsecutiveFailures = 0
+	drift := absDuration(offset)
+	switch {
+	case opts.Mode == ClockSkewStrict && drift > opts.MaxSkew:
+		status.Status = ClockBlocking
+		s.GetLogger().Errorf("El reloj del servidor está desfasado %v respecto de %s (máximo %v): emisión bloqueada", offset, source, opts.MaxSkew)
+	case drift > opts.WarnThreshold:
+		status.Status = ClockDrifting
+		s.GetLogger().Warnf("El reloj del servidor está desfasado %v respecto de %s (umbral %v)", offset, source, opts.WarnThreshold)
+	default:
+		status.Status = ClockOK
+	}
+	result := *status
+	return &result, nil
+}
+
+// clockSkewBlocking indica si el último chequeo en modo estricto superó el máximo
+func (s *UBLConverterService) clockSkewBlocking() (*ClockSkewStatus, bool) {
+	status := s.ClockSkewStatus()
+	return status, status != nil && status.Status == ClockBlocking
+}
+
+// StartClockSkewMonitor mide el desvío del reloj al iniciar y luego cada interval en
+// segundo plano, hasta que se llame a la función retornada
+func (s *UBLConverterService) StartClockSkewMonitor(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			ctx, cancel := s.JobContext()
+			s.CheckClockSkew(ctx)
+			cancel()
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// WriteClockSkewMetrics escribe en formato de texto de Prometheus el último desvío medido
+func (s *UBLConverterService) WriteClockSkewMetrics(w io.Writer) {
+	status := s.ClockSkewStatus()
+	if status == nil || status.CheckedAt == nil {
+		return
+	}
+	fmt.Fprintln(w, "# HELP clock_drift_seconds Desvío del reloj del servidor respecto de la fuente de hora (positivo si está atrasado)")
+	fmt.Fprintln(w, "# TYPE clock_drift_seconds gauge")
+	fmt.Fprintf(w, "clock_drift_seconds{source=%q} %.3f\n", status.Source, float64(status.DriftMs)/1000)
+	fmt.Fprintln(w, "# HELP clock_drift_check_failures Chequeos consecutivos del reloj que fallaron")
+	fmt.Fprintln(w, "# TYPE clock_drift_check_failures gauge")
+	fmt.Fprintf(w, "clock_drift_check_failures{source=%q} %d\n", status.Source, status.ConsecutiveFailures)
+}
+
+// ntpEpochOffset son los segundos entre la época NTP (1900) y la época Unix (1970)
+const ntpEpochOffset = 2208988800
+
+// NTPTimeSource consulta la hora a un servidor NTP con una petición SNTP (RFC 4330)
+type NTPTimeSource struct {
+	// Addr es host:puerto; sin puerto se usa el 123
+	Addr    string
+	Timeout time.Duration
+}
+
+func NewNTPTimeSource(addr string) *NTPTimeSource {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "123")
+	}
+	return &NTPTimeSource{Addr: addr, Timeout: 5 * time.Second}
+}
+
+func (n *NTPTimeSource) String() string {
+	return "ntp://" + n.Addr
+}
+
+// ntpTime convierte una marca de tiempo NTP de 64 bits (segundos y fracción) a time.Time
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(seconds, (fraction*1e9)>>32)
+}
+
+// Offset calcula el desvío con las cuatro marcas de tiempo del intercambio SNTP:
+// ((recepción - envío) + (respuesta - llegada)) / 2
+func (n *NTPTimeSource) Offset(ctx context.Context) (time.Duration, error) {
+	dialer := net.Dialer{Timeout: n.Timeout}
+	conn, err := dialer.DialContext(ctx, "udp", n.Addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(n.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	// LI 0, versión 4, modo 3 (cliente)
+	request := make([]byte, 48)
+	request[0] = 0x23
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+	response := make([]byte, 48)
+	read, err := conn.Read(response)
+	arrived := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if read < 48 || response[0]&0x07 != 4 {
+		return 0, errors.New("invalid NTP response")
+	}
+	if response[1] == 0 {
+		return 0, errors.New("NTP server sent a kiss-of-death response")
+	}
+
+	received, transmitted := ntpTime(response[32:40]), ntpTime(response[40:48])
+	return (received.Sub(sent) + transmitted.Sub(arrived)) / 2, nil
+}
+
+// HTTPDateTimeSource toma la hora de la cabecera Date de un endpoint HTTP confiable.
+// Date tiene resolución de segundos, por lo que el desvío medido tiene un error de
+// hasta medio segundo más la mitad del tiempo de ida y vuelta.
+type HTTPDateTimeSource struct {
+	URL    string
+	client *http.Client
+}
+
+func NewHTTPDateTimeSource(url string, client *http.Client) *HTTPDateTimeSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPDateTimeSource{URL: url, client: client}
+}
+
+func (h *HTTPDateTimeSource) String() string {
+	return h.URL
+}
+
+func (h *HTTPDateTimeSource) Offset(ctx context.Context) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, h.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	sent := time.Now()
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	arrived := time.Now()
+	resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid Date header %q", resp.Header.Get("Date"))
+	}
+	// La cabecera trunca a segundos: se toma la mitad del segundo como estimación
+	reference := date.Add(500 * time.Millisecond)
+	local := sent.Add(arrived.Sub(sent) / 2)
+	return reference.Sub(local), nil
+}
+
+// NewTimeSource interpreta CLOCK_SKEW_SOURCE: una URL http(s) usa la cabecera Date y
+// cualquier otro valor (host, host:puerto o ntp://host) un servidor NTP
+func NewTimeSource(source string, client *http.Client) TimeSource {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return NewHTTPDateTimeSource(source, client)
+	}
+	return NewNTPTimeSource(strings.TrimPrefix(source, "ntp://"))
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	. "API-SUNAT2/model"
+)
+
+// noteReferences retorna los documentos que ajusta la nota: los de una nota consolidada
+// o el único de reference
+func noteReferences(doc *BusinessDocument) []DocumentReference {
+	if len(doc.References) > 0 {
+		return doc.References
+	}
+	if doc.Reference != nil {
+		return []DocumentReference{*doc.Reference}
+	}
+	return nil
+}
+
+// referenceField retorna el campo JSON de la i-ésima referencia de la nota
+func referenceField(doc *BusinessDocument, i int) string {
+	if len(doc.References) > 0 {
+		return fmt.Sprintf("references[%d]", i)
+	}
+	return "reference"
+}
+
+// referenceAmount retorna el monto que la nota ajusta sobre la referencia y el campo del
+// que sale: el de la referencia en una nota consolidada o el total de la nota
+func referenceAmount(doc *BusinessDocument, i int) (float64, string) {
+	if len(doc.References) > 0 {
+		return float64(doc.References[i].Amount), fmt.Sprintf("references[%d].amount", i)
+	}
+	return float64(doc.Totals.PayableAmount), "totals.payableAmount"
+}
+
+// affectedDocuments retorna los documentos que ajusta una nota consolidada con sus
+// montos, para el registro de la nota
+func affectedDocuments(doc *BusinessDocument) []AffectedDocument {
+	if len(doc.References) == 0 {
+		return nil
+	}
+	affected := make([]AffectedDocument, 0, len(doc.References))
+	for _, ref := range doc.References {
+		affected = append(affected, AffectedDocument{DocumentID: affectedDocumentID(doc.Issuer.DocumentID, ref), Amount: float64(ref.Amount)})
+	}
+	return affected
+}
+
+// validateNoteReferences valida las referencias de una nota consolidada: que no se
+// combinen con reference, que no se repitan, que sus montos sumen el total de la nota y
+// que sean del mismo cliente que la nota
+func (v *ValidationService) validateNoteReferences(doc *BusinessDocument) []ValidationError {
+	if len(doc.References) == 0 {
+		return nil
+	}
+	if doc.Type != "07" && doc.Type != "08" {
+		return []ValidationError{{
+			Field:    "references",
+			Expected: "Only in credit (07) or debit (08) notes",
+			Received: doc.Type,
+			Rule:     "note_references_validation",
+			Message:  "Only notes can reference affected documents",
+		}}
+	}
+	var errors []ValidationError
+	if doc.Reference != nil {
+		errors = append(errors, ValidationError{
+			Field:    "reference",
+			Expected: "Either reference or references",
+			Received: doc.Reference.DocumentID,
+			Rule:     "note_references_validation",
+			Message:  "A note cannot have both reference and references",
+		})
+	}
+
+	seen := make(map[string]bool, len(doc.References))
+	sum := 0.0
+	for i, ref := range doc.References {
+		field := referenceField(doc, i)
+		key := ref.DocumentType + "-" + ref.DocumentID
+		if seen[key] {
+			errors = append(errors, ValidationError{
+				Field:    field + ".documentId",
+				Expected: "Each affected document referenced once",
+				Received: ref.DocumentID,
+				Rule:     "note_references_validation",
+				Message:  "Affected document is referenced more than once",
+			})
+		}
+		seen[key] = true
+		if ref.Amount <= 0 {
+			errors = append(errors, ValidationError{
+				Field:    field + ".amount",
+				Expected: "Amount greater than 0",
+				Received: fmt.Sprintf("%.2f", ref.Amount),
+				Rule:     "note_references_validation",
+				Message:  "Each affected document must have the amount the note adjusts",
+			})
+		}
+		if ref.CustomerDocumentID != "" && ref.CustomerDocumentID != doc.Customer.DocumentID {
+			errors = append(errors, ValidationError{
+				Field:    field + ".customerDocumentId",
+				Expected: doc.Customer.DocumentID,
+				Received: ref.CustomerDocumentID,
+				Rule:     "note_references_customer",
+				Message:  "All affected documents must belong to the note customer",
+			})
+		}
+		sum += float64(ref.Amount)
+	}
+
+	if math.Abs(sum-float64(doc.Totals.PayableAmount)) > 0.01 {
+		errors = append(errors, ValidationError{
+			Field:      "references",
+			Expected:   fmt.Sprintf("%.2f", doc.Totals.PayableAmount),
+			Received:   fmt.Sprintf("%.2f", sum),
+			Rule:       "note_references_total",
+			Message:    "The amounts of the affected documents must add up to the note total",
+			Suggestion: fmt.Sprintf("Adjust the amounts by %.2f", float64(doc.Totals.PayableAmount)-sum),
+		})
+	}
+	return errors
+}
+
+// checkReferencesCustomer verifica contra el store que los documentos que ajusta una
+// nota consolidada sean del cliente de la nota. Los documentos que no están en el store
+// o ya fueron purgados no se verifican.
+func (s *UBLConverterService) checkReferencesCustomer(doc *BusinessDocument) []ValidationError {
+	if len(doc.References) == 0 || (doc.Type != "07" && doc.Type != "08") {
+		return nil
+	}
+	var errors []ValidationError
+	for i, ref := range doc.References {
+		affected := affectedDocumentID(doc.Issuer.DocumentID, ref)
+		data, err := s.store.Read(RecordName(affected))
+		if err != nil {
+			continue
+		}
+		var record DocumentRecord
+		if json.Unmarshal(data, &record) != nil || record.CustomerDocumentID == "" {
+			continue
+		}
+		if record.CustomerDocumentID != doc.Customer.DocumentID {
+			errors = append(errors, ValidationError{
+				Field:    referenceField(doc, i) + ".documentId",
+				Expected: fmt.Sprintf("Document of customer %s", doc.Customer.DocumentID),
+				Received: fmt.Sprintf("%s (customer %s)", ref.DocumentID, record.CustomerDocumentID),
+				Rule:     "note_references_customer",
+				Message:  "All affected documents must belong to the note customer",
+			})
+		}
+	}
+	return errors
+}
@@ -1,26 +1,77 @@
 package service
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"API-SUNAT2/catalog"
 	. "API-SUNAT2/model"
+	"API-SUNAT2/storage"
 	. "API-SUNAT2/util"
+	"API-SUNAT2/util/httpclient"
 	"github.com/sirupsen/logrus"
 )
 
 type UBLConverterService struct {
 	validator     *ValidationService
-	converter     *UBLConverter
+	converter     DocumentConverter
+	invariants    *InvariantChecker
 	signer        *DigitalSignatureService
 	logService    *LogService
 	xmlStorePath  string
+	store         storage.DocumentStore
+	clock         Clock
+	stageObserver func(stage string, duration time.Duration)
+	hooks         []registeredHook
+	hookMetrics   *HookMetrics
+	inFlight      int64
+	exchangeMu    sync.Mutex
+	advanceMu     sync.Mutex
+	summaryMu     sync.Mutex
+	padron        PadronClient
+	issuerStatusMode string
+	customerNameSimilarity float64
+	maxItems      int
+	maxXMLBytes   int
+	maxBatchDocuments int
+	sizes         *SizeRegistry
+	descriptionPolicy string
+	// mojibakeMode es off, fix o strict
+	mojibakeMode string
+	sunat         *SunatRouter
+	sunatMock     SunatClient
+	validateOnly  bool
+	testDocuments testDocumentRules
+	// convertNegativeLines convierte las líneas negativas en descuentos en lugar de rechazarlas
+	convertNegativeLines bool
+	defaultEnvironment string
+	httpPool      *httpclient.Pool
+	jobTimeout    time.Duration
+	xmlEncoding   string
+	reconcile     ReconcileOptions
+	soapTrace     SOAPTraceOptions
+	reconcileMu   sync.Mutex
+	certificates  certificateMonitor
+	endOfDay      endOfDayMonitor
+	clockSkew     clockSkewMonitor
+	unitMappings  unitMappingCache
+	templates     documentTemplateCache
+	auditRequests bool
+	historyMu     sync.Mutex
+	correlationMu sync.Mutex
+	purgeMu       sync.Mutex
+	retentionYears int
+	checkNoteBalance bool
+	events        *eventDispatcher
+	validationStats *validationStatsAggregator
 }
 
 // GetValidator retorna el validador para uso externo
@@ -28,140 +79,310 @@ func (s *UBLConverterService) GetValidator() *ValidationService {
 	return s.validator
 }
 
+// GetSigner retorna el servicio de firma digital
+func (s *UBLConverterService) GetSigner() *DigitalSignatureService {
+	return s.signer
+}
+
 // GetXMLStorePath retorna la ruta de almacenamiento XML
 func (s *UBLConverterService) GetXMLStorePath() string {
 	return s.xmlStorePath
 }
 
+// GetInFlightCount retorna el número de documentos que se están procesando
+func (s *UBLConverterService) GetInFlightCount() int64 {
+	return atomic.LoadInt64(&s.inFlight)
+}
+
+// SetConverter reemplaza el convertidor UBL usado por el pipeline
+func (s *UBLConverterService) SetConverter(converter DocumentConverter) {
+	s.converter = converter
+}
+
+// GetLogService retorna el servicio de logs, que permite consultar los logs por operación
+func (s *UBLConverterService) GetLogService() *LogService {
+	return s.logService
+}
+
+// GetLogger retorna el logger del servicio
+func (s *UBLConverterService) GetLogger() *logrus.Logger {
+	return s.logService.GetLogger()
+}
+
+// GetPadronClient retorna el cliente del padrón RUC, o nil si no está configurado
+func (s *UBLConverterService) GetPadronClient() PadronClient {
+	return s.padron
+}
+
+// SetPadronClient configura el cliente del padrón RUC
+func (s *UBLConverterService) SetPadronClient(client PadronClient) {
+	s.padron = client
+}
+
+// SetIssuerStatusCheck habilita el chequeo del estado del emisor en modo "warning" o "error"
+func (s *UBLConverterService) SetIssuerStatusCheck(mode string) {
+	s.issuerStatusMode = mode
+}
+
+// SetLimits configura el número máximo de líneas y el tamaño máximo del XML generado
+func (s *UBLConverterService) SetLimits(maxItems, maxXMLBytes int) {
+	if maxItems > 0 {
+		s.maxItems = maxItems
+	}
+	if maxXMLBytes > 0 {
+		s.maxXMLBytes = maxXMLBytes
+	}
+}
+
+// SetDescriptionPolicy configura el tratamiento de whitespace en las descripciones
+// (preserve, collapse o strip); valores desconocidos se ignoran
+func (s *UBLConverterService) SetDescriptionPolicy(policy string) {
+	if isValidDescriptionPolicy(policy) {
+		s.descriptionPolicy = policy
+	}
+}
+
+// SetAmountWordsAccents configura si el monto en letras de la leyenda 1000 lleva tildes
+func (s *UBLConverterService) SetAmountWordsAccents(enabled bool) {
+	if converter, ok := s.converter.(*UBLConverter); ok {
+		converter.SetAmountWordsAccents(enabled)
+	}
+}
+
+// SetCatalogURIs configura si los catálogos SUNAT se emiten con listURI/schemeURI
+func (s *UBLConverterService) SetCatalogURIs(enabled bool) {
+	if converter, ok := s.converter.(*UBLConverter); ok {
+		converter.SetCatalogURIs(enabled)
+	}
+}
+
+// SetIDReferenceIssuers configura los emisores que firman por referencia al Id del
+// elemento raíz (URI="#id") en lugar de la referencia vacía sobre el documento completo
+func (s *UBLConverterService) SetIDReferenceIssuers(rucs []string) {
+	if converter, ok := s.converter.(*UBLConverter); ok {
+		converter.SetIDReferenceIssuers(rucs)
+	}
+}
+
+// SetPricingReferenceOmitIssuers configura los emisores cuyas líneas se emiten sin
+// cac:PricingReference
+func (s *UBLConverterService) SetPricingReferenceOmitIssuers(rucs []string) {
+	if converter, ok := s.converter.(*UBLConverter); ok {
+		converter.SetPricingReferenceOmitIssuers(rucs)
+	}
+}
+
+// emitsPricingReference indica si las líneas del documento llevan cac:PricingReference
+// con el convertidor configurado; otros convertidores lo emiten siempre
+func (s *UBLConverterService) emitsPricingReference(doc *BusinessDocument) bool {
+	if converter, ok := s.converter.(*UBLConverter); ok {
+		return converter.EmitsPricingReference(doc)
+	}
+	return true
+}
+
+// SetXMLEncoding configura la codificación de los bytes del XML generado (utf8,
+// utf8-bom o iso-8859-1); valores desconocidos se ignoran
+func (s *UBLConverterService) SetXMLEncoding(encoding string) {
+	if IsValidXMLEncoding(encoding) {
+		s.xmlEncoding = encoding
+	}
+}
+
+// SetSunatRouter habilita el envío a SUNAT; defaultEnvironment se usa cuando el
+// request no indica ambiente
+func (s *UBLConverterService) SetSunatRouter(router *SunatRouter, defaultEnvironment string) {
+	s.sunat = router
+	if IsValidEnvironment(defaultEnvironment) {
+		s.defaultEnvironment = defaultEnvironment
+	}
+}
+
+// SetSunatMock activa el modo mock: los envíos usan el cliente indicado en lugar de
+// SUNAT y se registran con el ambiente "mock"
+func (s *UBLConverterService) SetSunatMock(client SunatClient) {
+	s.sunatMock = client
+}
+
+// IsSunatMock indica si el modo mock está activo
+func (s *UBLConverterService) IsSunatMock() bool {
+	return s.sunatMock != nil
+}
+
+// GetStore retorna el almacenamiento de artefactos
+func (s *UBLConverterService) GetStore() storage.DocumentStore {
+	return s.store
+}
+
+// SetStore reemplaza el almacenamiento de artefactos (por ejemplo, en memoria)
+func (s *UBLConverterService) SetStore(store storage.DocumentStore) {
+	s.store = store
+}
+
+// GetHTTPPool retorna el pool de clientes HTTP de los integradores externos
+func (s *UBLConverterService) GetHTTPPool() *httpclient.Pool {
+	return s.httpPool
+}
+
+// SetHTTPPool configura el pool de clientes HTTP; los integradores externos deben
+// crearse con clientes de este pool para compartir conexiones y métricas
+func (s *UBLConverterService) SetHTTPPool(pool *httpclient.Pool) {
+	s.httpPool = pool
+}
+
+// DefaultJobTimeout es el tiempo máximo de un trabajo asíncrono
+const DefaultJobTimeout = 5 * time.Minute
+
+// SetJobTimeout configura el tiempo máximo de los trabajos asíncronos
+func (s *UBLConverterService) SetJobTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.jobTimeout = timeout
+	}
+}
+
+// JobContext retorna el contexto de un trabajo asíncrono: no depende de ningún
+// request, de modo que sobrevive al cliente que lo originó, y vence con el timeout
+// configurado
+func (s *UBLConverterService) JobContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.jobTimeout)
+}
+
+// SetClock reemplaza el reloj usado para timestamps y duraciones
+func (s *UBLConverterService) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// SetStageObserver registra una función que recibe la duración de cada etapa del pipeline
+func (s *UBLConverterService) SetStageObserver(observer func(stage string, duration time.Duration)) {
+	s.stageObserver = observer
+}
+
 func NewUBLConverterService(xmlStorePath string) *UBLConverterService {
 	logService := NewLogService()
 	return &UBLConverterService{
 		validator:     NewValidationService(logService.GetLogger()),
 		converter:     NewUBLConverter(logService.GetLogger()),
+		invariants:    NewInvariantChecker(),
 		signer:        NewDigitalSignatureService(logService.GetLogger()),
 		logService:    logService,
 		xmlStorePath:  xmlStorePath,
+		store:         storage.NewFileStore(xmlStorePath),
+		clock:         SystemClock{},
+		maxItems:      DefaultMaxItems,
+		maxXMLBytes:   DefaultMaxXMLBytes,
+		maxBatchDocuments: DefaultMaxBatchDocuments,
+		sizes:         NewSizeRegistry(),
+		hookMetrics:   NewHookMetrics(),
+		descriptionPolicy: DescriptionPreserve,
+		mojibakeMode:      MojibakeOff,
+		defaultEnvironment: EnvironmentBeta,
+		httpPool:      httpclient.Default(),
+		jobTimeout:    DefaultJobTimeout,
+		xmlEncoding:   XMLEncodingUTF8,
+		soapTrace:     SOAPTraceOptions{MaxBytes: DefaultSOAPTraceMaxBytes, Retention: DefaultSOAPTraceRetention},
+		reconcile:     DefaultReconcileOptions,
+		retentionYears: DefaultRetentionYears,
 	}
 }
 
-func (s *UBLConverterService) ProcessDocument(doc *BusinessDocument, certPEM, keyPEM []byte) (*APIResponse, error) {
-	startTime := time.Now()
-	correlationID := GenerateCorrelationID()
+// ProcessDocument ejecuta el pipeline por defecto y arma la respuesta del API. Si ctx
+// se cancela el pipeline se detiene en la siguiente etapa y elimina lo ya escrito.
+func (s *UBLConverterService) ProcessDocument(ctx context.Context, doc *BusinessDocument, certPEM, keyPEM []byte) (*APIResponse, error) {
+	startTime := s.clock.Now()
 
-	// Log inicio del proceso
-	s.logService.LogInfo(correlationID, "PROCESS_DOCUMENT", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "Iniciando procesamiento de documento")
+	atomic.AddInt64(&s.inFlight, 1)
+	defer atomic.AddInt64(&s.inFlight, -1)
 
-	// Validar documento
-	validationErrors := s.validator.ValidateBusinessDocument(doc)
-	if len(validationErrors) > 0 {
-		s.logService.LogError(correlationID, "VALIDATION_ERROR", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "VALIDATION_FAILED", "Documento no válido")
-		return &APIResponse{
-			Status:           "ERROR",
-			CorrelationID:    correlationID,
-			ProcessedAt:      time.Now(),
-			ErrorCode:        "VALIDATION_FAILED",
-			ErrorMessage:     "Documento no válido",
-			ValidationErrors: validationErrors,
-		}, nil
+	if len(doc.ExchangedDocuments) > 0 {
+		// Serializar los canjes para que dos facturas no canjeen la misma boleta
+		s.exchangeMu.Lock()
+		defer s.exchangeMu.Unlock()
+	}
+	if len(doc.Advances) > 0 {
+		// Serializar las regularizaciones para que dos facturas no apliquen el mismo saldo
+		s.advanceMu.Lock()
+		defer s.advanceMu.Unlock()
 	}
 
-	// Convertir a UBL
-	xmlData, err := s.converter.ConvertToUBL(doc)
-	if err != nil {
-		s.logService.LogError(correlationID, "CONVERSION_ERROR", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "CONVERSION_FAILED", err.Error())
-		return &APIResponse{
-			Status:        "ERROR",
-			CorrelationID: correlationID,
-			ProcessedAt:   time.Now(),
-			ErrorCode:     "CONVERSION_FAILED",
-			ErrorMessage:  fmt.Sprintf("Error en conversión UBL: %v", err),
-		}, nil
-	}
-
-	// Agregar firma UBL al XML
-	xmlData, err = s.addUBLSignature(xmlData, doc)
-	if err != nil {
-		s.logService.LogError(correlationID, "UBL_SIGNATURE_ERROR", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "UBL_SIGNATURE_FAILED", err.Error())
-		return &APIResponse{
-			Status:        "ERROR",
-			CorrelationID: correlationID,
-			ProcessedAt:   time.Now(),
-			ErrorCode:     "UBL_SIGNATURE_FAILED",
-			ErrorMessage:  fmt.Sprintf("Error al agregar firma UBL: %v", err),
-		}, nil
-	}
-
-	// Firmar digitalmente
-	signedXML, err := s.signer.SignXML(xmlData, certPEM, keyPEM)
-	if err != nil {
-		s.logService.LogError(correlationID, "DIGITAL_SIGNATURE_ERROR", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "SIGNATURE_FAILED", err.Error())
-		return &APIResponse{
-			Status:        "ERROR",
-			CorrelationID: correlationID,
-			ProcessedAt:   time.Now(),
-			ErrorCode:     "SIGNATURE_FAILED",
-			ErrorMessage:  fmt.Sprintf("Error en firma digital: %v", err),
-		}, nil
-	}
-
-	// Generar nombre de archivo
-	fileName := fmt.Sprintf("%s-%s-%s-%s.xml", doc.Issuer.DocumentID, doc.Type, doc.Series, doc.Number)
-	filePath := filepath.Join(s.xmlStorePath, fileName)
-
-	// Guardar XML firmado
-	err = os.WriteFile(filePath, signedXML, 0644)
-	if err != nil {
-		s.logService.LogError(correlationID, "FILE_SAVE_ERROR", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "SAVE_FAILED", err.Error())
-		return &APIResponse{
-			Status:        "ERROR",
-			CorrelationID: correlationID,
-			ProcessedAt:   time.Now(),
-			ErrorCode:     "SAVE_FAILED",
-			ErrorMessage:  fmt.Sprintf("Error al guardar archivo: %v", err),
-		}, nil
-	}
-
-	// Crear archivo ZIP
-	zipPath, err := ZipXMLFile(filePath)
+	if s.validateOnly {
+		// Nunca se firma con el certificado del request en modo validate-only
+		certPEM, keyPEM = validateOnlyCertificate, validateOnlyKey
+	}
+
+	pctx, err := s.NewDefaultPipeline().Run(ctx, doc, certPEM, keyPEM)
 	if err != nil {
-		s.logService.LogError(correlationID, "ZIP_ERROR", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "ZIP_FAILED", err.Error())
-		return &APIResponse{
-			Status:        "ERROR",
-			CorrelationID: correlationID,
-			ProcessedAt:   time.Now(),
-			ErrorCode:     "ZIP_FAILED",
-			ErrorMessage:  fmt.Sprintf("Error al crear ZIP: %v", err),
-		}, nil
+		var stepErr *StepError
+		if !errors.As(err, &stepErr) {
+			return nil, err
+		}
+		resp := s.stepErrorResponse(pctx.CorrelationID, stepErr)
+		s.recordCorrelation(DocumentIDOf(doc), resp)
+		return resp, nil
+	}
+
+	// Registrar el certificado de firma para las alertas de vencimiento; un fallo no
+	// impide la emisión. El certificado de prueba no se registra.
+	if !s.validateOnly {
+		if _, err := s.RegisterCertificate(doc.Issuer.DocumentID, certPEM); err != nil {
+			s.GetLogger().Warnf("No se pudo registrar el certificado de %s: %v", doc.Issuer.DocumentID, err)
+		}
 	}
 
+	s.emitDocumentEvent(DocumentProcessedEvent, pctx.DocumentID(), StatusChange{Status: DocumentGenerated, At: s.clock.Now()})
+
 	// Calcular hash del XML
-	hash := sha256.Sum256(signedXML)
+	hash := sha256.Sum256(pctx.XML)
 	xmlHash := hex.EncodeToString(hash[:])
 
-	// Calcular duración
-	duration := time.Since(startTime).Milliseconds()
-
-	// Log éxito
-	s.logService.LogInfo(correlationID, "PROCESS_SUCCESS", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "Documento procesado exitosamente")
+	data := map[string]interface{}{
+		"fileName": pctx.FileName,
+		"fileSize": len(pctx.XML),
+	}
+	for key, value := range pctx.Data {
+		data[key] = value
+	}
 
-	// Retornar respuesta exitosa
-	response := &APIResponse{
+	resp := &APIResponse{
 		Status:        "SUCCESS",
-		CorrelationID: correlationID,
-		DocumentID:    fmt.Sprintf("%s-%s-%s-%s", doc.Issuer.DocumentID, doc.Type, doc.Series, doc.Number),
-		XMLPath:       zipPath,
+		CorrelationID: pctx.CorrelationID,
+		DocumentID:    pctx.DocumentID(),
+		XMLPath:       pctx.XMLPath,
 		XMLHash:       xmlHash,
-		ProcessedAt:   time.Now(),
-		Duration:      duration,
-		Data: map[string]interface{}{
-			"fileName": fileName,
-			"fileSize": len(signedXML),
-			"zipSize":  getFileSize(zipPath),
-		},
-		Message:       fmt.Sprintf("El archivo ZIP fue generado exitosamente en: %s", zipPath),
+		ProcessedAt:   s.clock.Now(),
+		Duration:      s.clock.Now().Sub(startTime).Milliseconds(),
+		Timings:       pctx.Timings,
+		Warnings:      pctx.Warnings,
+		Data:          data,
+		Message:       fmt.Sprintf("El archivo ZIP fue generado exitosamente en: %s", pctx.XMLPath),
+	}
+	s.recordCorrelation(resp.DocumentID, resp)
+	return resp, nil
+}
+
+// ValidationFailedCode es el código de error de un documento que no pasa la validación
+const ValidationFailedCode = "VALIDATION_FAILED"
+
+// ValidateDocument ejecuta solo la validación del pipeline por defecto. Si el documento
+// no es válido retorna la respuesta de error, la misma que daría ProcessDocument.
+func (s *UBLConverterService) ValidateDocument(ctx context.Context, doc *BusinessDocument) (*PipelineContext, *APIResponse) {
+	pctx, err := s.NewDefaultPipeline().Validate(ctx, doc)
+	if err != nil {
+		return pctx, s.stepErrorResponse(pctx.CorrelationID, err.(*StepError))
 	}
+	return pctx, nil
+}
 
-	return response, nil
+// stepErrorResponse arma la respuesta de un paso fallido del pipeline. /validate y
+// /convert la comparten para que un mismo documento inválido reciba la misma respuesta.
+func (s *UBLConverterService) stepErrorResponse(correlationID string, stepErr *StepError) *APIResponse {
+	return &APIResponse{
+		Status:           "ERROR",
+		CorrelationID:    correlationID,
+		ProcessedAt:      s.clock.Now(),
+		ErrorCode:        stepErr.Code,
+		ErrorMessage:     stepErr.Message,
+		ValidationErrors: stepErr.ValidationErrors,
+	}
 }
 
 func (s *UBLConverterService) addUBLSignature(xmlData []byte, doc *BusinessDocument) ([]byte, error) {
@@ -206,36 +427,122 @@ func (s *UBLConverterService) addUBLSignature(xmlData []byte, doc *BusinessDocum
 	return []byte(xmlStr), nil
 }
 
-func getFileSize(filePath string) int64 {
-	info, err := os.Stat(filePath)
-	if err != nil {
-		return 0
-	}
-	return info.Size()
-}
-
 type UBLConverter struct {
 	logger *logrus.Logger
+	// amountWordsAccents conserva las tildes del monto en letras de la leyenda 1000
+	amountWordsAccents bool
+	// idReferenceIssuers son los emisores cuyo elemento raíz lleva el atributo Id
+	idReferenceIssuers map[string]bool
+	// watermark es la nota que marca los documentos generados fuera de producción
+	watermark string
+	// omitCatalogURIs quita los atributos listURI/schemeURI de los catálogos SUNAT
+	omitCatalogURIs bool
+	// omitPricingReferenceIssuers son los emisores cuyas líneas se emiten sin
+	// cac:PricingReference, salvo que el request lo pida
+	omitPricingReferenceIssuers map[string]bool
 }
 
 func NewUBLConverter(logger *logrus.Logger) *UBLConverter {
-	return &UBLConverter{logger: logger}
+	return &UBLConverter{logger: logger, amountWordsAccents: true}
+}
+
+// SetIDReferenceIssuers configura los emisores que firman con la ds:Reference apuntando
+// al Id del elemento raíz; a sus documentos se les agrega ese atributo
+func (c *UBLConverter) SetIDReferenceIssuers(rucs []string) {
+	c.idReferenceIssuers = make(map[string]bool, len(rucs))
+	for _, ruc := range rucs {
+		c.idReferenceIssuers[ruc] = true
+	}
+}
+
+// SetPricingReferenceOmitIssuers configura los emisores cuyas líneas se emiten sin
+// cac:PricingReference porque sus receptores lo rechazan
+func (c *UBLConverter) SetPricingReferenceOmitIssuers(rucs []string) {
+	c.omitPricingReferenceIssuers = make(map[string]bool, len(rucs))
+	for _, ruc := range rucs {
+		c.omitPricingReferenceIssuers[ruc] = true
+	}
+}
+
+// EmitsPricingReference indica si las líneas del documento llevan cac:PricingReference:
+// emitPricingReference del request decide y, sin indicarlo, se omite solo para los
+// emisores configurados
+func (c *UBLConverter) EmitsPricingReference(doc *BusinessDocument) bool {
+	if doc.EmitPricingReference != nil {
+		return *doc.EmitPricingReference
+	}
+	return !c.omitPricingReferenceIssuers[doc.Issuer.DocumentID]
+}
+
+// pricingReference arma el precio de referencia de la línea, nil si no se emite. El
+// tipo de precio (catálogo 16) sale del carácter de la línea: 02, valor referencial,
+// en las gratuitas y 01, precio unitario, en las onerosas.
+func (c *UBLConverter) pricingReference(item DocumentItem, currency string, emit bool) *UBLPricingReference {
+	if !emit {
+		return nil
+	}
+	priceType := "01"
+	if isFreeLine(item) {
+		priceType = "02"
+	}
+	return &UBLPricingReference{
+		AlternativeConditionPrice: UBLAlternativeConditionPrice{
+			PriceAmount: UBLAmountWithCurrency{
+				CurrencyID: currency,
+				Value:      float64(item.UnitPrice * item.Quantity),
+			},
+			PriceTypeCode: catalogAttr(priceType, catalog.PriceType),
+		},
+	}
+}
+
+// rootID retorna el atributo Id del elemento raíz: la serie y el número del documento
+// (con prefijo si no empieza con letra, porque un Id XML no puede empezar con dígito),
+// o vacío si el emisor firma sobre el documento completo
+func (c *UBLConverter) rootID(doc *BusinessDocument) string {
+	if !c.idReferenceIssuers[doc.Issuer.DocumentID] {
+		return ""
+	}
+	id := fmt.Sprintf("%s-%s", doc.Series, doc.Number)
+	if first := id[0]; !(first >= 'A' && first <= 'Z' || first >= 'a' && first <= 'z') {
+		id = "ID-" + id
+	}
+	return id
+}
+
+// SetAmountWordsAccents configura si el monto en letras lleva tildes; algunos
+// receptores comparan la leyenda sin ellas
+func (c *UBLConverter) SetAmountWordsAccents(enabled bool) {
+	c.amountWordsAccents = enabled
+}
+
+// SetCatalogURIs configura si los códigos e identificadores de catálogos SUNAT llevan
+// listURI/schemeURI; algunos receptores rechazan esos atributos
+func (c *UBLConverter) SetCatalogURIs(enabled bool) {
+	c.omitCatalogURIs = !enabled
 }
 
 func (c *UBLConverter) ConvertToUBL(doc *BusinessDocument) ([]byte, error) {
+	var xmlData []byte
+	var err error
 	switch doc.Type {
 	case "01", "03": // Factura o Boleta
-		return c.convertToInvoice(doc)
+		xmlData, err = c.convertToInvoice(doc)
 	case "07": // Nota de Crédito
-		return c.convertToCreditNote(doc)
+		xmlData, err = c.convertToCreditNote(doc)
 	case "08": // Nota de Débito
-		return c.convertToDebitNote(doc)
+		xmlData, err = c.convertToDebitNote(doc)
 	default:
 		return nil, fmt.Errorf("unsupported document type: %s", doc.Type)
 	}
+	if err != nil || !c.omitCatalogURIs {
+		return xmlData, err
+	}
+	return stripCatalogURIs(xmlData), nil
 }
 
 func (c *UBLConverter) convertToInvoice(doc *BusinessDocument) ([]byte, error) {
+	lines := documentLines(doc)
 	invoice := &UBLInvoice{
 		XMLName:       xml.Name{Local: "Invoice"},
 		Xmlns:         "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2",
@@ -248,60 +555,57 @@ func (c *UBLConverter) convertToInvoice(doc *BusinessDocument) ([]byte, error) {
 		},
 		UBLVersionID: "2.1",
 		CustomizationID: UBLIDWithScheme{
-			SchemeAgencyName: "PE:SUNAT",
+			SchemeAgencyName: catalog.AgencySunat,
 			Value:            "2.0",
 		},
-		ProfileID: UBLIDWithScheme{
-			SchemeAgencyName: "PE:SUNAT",
-			SchemeName:       "Tipo de Operacion",
-			SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo51",
-			Value:            "0101",
-		},
+		ProfileID: catalogScheme(operationTypeOf(doc), catalog.OperationType),
 		ID: fmt.Sprintf("%s-%s", doc.Series, doc.Number),
 		IssueDate: doc.IssueDate,
 		IssueTime: "10:30:00",
-		DueDate:   doc.IssueDate,
-		InvoiceTypeCode: UBLTypeCode{
-			ListAgencyName: "PE:SUNAT",
-			ListID:         "0101",
-			ListName:       "Tipo de Documento",
-			ListURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo01",
-			Name:           "Tipo de Operacion",
-			Value:          doc.Type,
-		},
-		DocumentCurrencyCode: UBLIDWithScheme{
-			SchemeAgencyName: "United Nations Economic Commission for Europe",
-			SchemeID:         "ISO 4217 Alpha",
-			SchemeName:       "Currency",
-			Value:            doc.Currency,
-		},
-		LineCountNumeric:       len(doc.Items),
-		Note:                   "",
+		DueDate:   ResolveDueDate(doc),
+		InvoiceTypeCode: documentTypeCode(doc.Type, operationTypeOf(doc)),
+		DocumentCurrencyCode: catalogAttr(doc.Currency, catalog.Currency),
+		LineCountNumeric:       len(lines),
+		Notes:                  c.convertNotes(doc),
 		Signature:              c.createUBLSignature(doc),
 		AccountingSupplierParty: c.convertParty(doc.Issuer),
 		AccountingCustomerParty: c.convertParty(doc.Customer),
-		PaymentTerms: []UBLPaymentTerms{
-			{
-				ID:             "FormaPago",
-				PaymentMeansID: "Contado",
-			},
-		},
-		TaxTotal:           c.convertTaxTotals(doc.Taxes, doc.Currency),
+		PaymentMeans:            c.convertPaymentMeans(doc),
+		PaymentTerms:            c.convertPaymentTerms(doc),
+		TaxTotal:           c.convertTaxTotals(documentTaxes(doc), doc.Currency),
 		LegalMonetaryTotal: c.convertLegalMonetaryTotal(doc.Totals, doc.Currency),
-		InvoiceLines:       c.convertInvoiceLines(doc.Items, doc.Currency),
+		InvoiceLines:       c.convertInvoiceLines(lines, doc.Currency, c.EmitsPricingReference(doc)),
+	}
+	for _, exchanged := range doc.ExchangedDocuments {
+		invoice.AdditionalDocumentReference = append(invoice.AdditionalDocumentReference, UBLAdditionalDocumentReference{
+			ID: exchanged.DocumentID,
+			DocumentTypeCode: catalogAttr("03", catalog.RelatedDocument),
+		})
+	}
+	if doc.VehiclePlate != "" {
+		for i := range invoice.InvoiceLines {
+			item := &invoice.InvoiceLines[i].Item
+			item.AdditionalItemProperty = append(item.AdditionalItemProperty, c.convertVehiclePlate(doc.VehiclePlate)...)
+		}
 	}
-	if doc.Type == "03" {
-		invoice.Note = "TRANSFERENCIA GRATUITA DE UN BIEN Y/O SERVICIO PRESTADO GRATUITAMENTE"
+	if doc.Type == "03" && !hasFreeLines(doc) {
+		invoice.Notes = append([]UBLNote{{Value: FreeTransferLegend}}, invoice.Notes...)
 	}
+	c.applyPerception(invoice, doc)
+	c.applyGlobalDiscount(invoice, doc)
+	c.applyAdvances(invoice, doc)
+	invoice.Notes = append(invoice.Notes, observationNotes(doc)...)
+	applyAdditional(doc, invoice)
+	invoice.RootID = c.rootID(doc)
 	xmlData, err := xml.MarshalIndent(invoice, "", "  ")
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling invoice XML: %v", err)
 	}
-	xmlDeclaration := []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
-	return append(xmlDeclaration, xmlData...), nil
+	return append([]byte(xml.Header), xmlData...), nil
 }
 
 func (c *UBLConverter) convertToCreditNote(doc *BusinessDocument) ([]byte, error) {
+	lines := documentLines(doc)
 	creditNote := &UBLCreditNote{
 		Xmlns:                  "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2",
 		XmlnsCac:               "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
@@ -311,33 +615,17 @@ func (c *UBLConverter) convertToCreditNote(doc *BusinessDocument) ([]byte, error
 		UBLExtensions:          nil,
 		UBLVersionID:           "2.1",
 		CustomizationID: UBLIDWithScheme{
-			SchemeAgencyName: "PE:SUNAT",
+			SchemeAgencyName: catalog.AgencySunat,
 			Value:            "2.0",
 		},
-		ProfileID: UBLIDWithScheme{
-			SchemeAgencyName: "PE:SUNAT",
-			SchemeName:       "Tipo de Operacion",
-			SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo51",
-			Value:            "0101",
-		},
+		ProfileID: catalogScheme(operationTypeOf(doc), catalog.OperationType),
 		ID:                     fmt.Sprintf("%s-%s", doc.Series, doc.Number),
 		IssueDate:              doc.IssueDate,
 		IssueTime:              "10:30:00",
-		CreditNoteTypeCode: UBLTypeCode{
-			ListAgencyName: "PE:SUNAT",
-			ListID:         "0101",
-			ListName:       "Tipo de Documento",
-			ListURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo09",
-			Name:           "Tipo de Operacion",
-			Value:          doc.Type,
-		},
-		DocumentCurrencyCode: UBLIDWithScheme{
-			SchemeAgencyName: "United Nations Economic Commission for Europe",
-			SchemeID:         "ISO 4217 Alpha",
-			SchemeName:       "Currency",
-			Value:            doc.Currency,
-		},
-		LineCountNumeric:       len(doc.Items),
+		CreditNoteTypeCode: documentTypeCode(doc.Type, operationTypeOf(doc)),
+		DocumentCurrencyCode: catalogAttr(doc.Currency, catalog.Currency),
+		LineCountNumeric:       len(lines),
+		Notes:                  append(c.convertNotes(doc), observationNotes(doc)...),
 		DiscrepancyResponse:    []UBLDiscrepancyResponse{},
 		BillingReference:       []UBLBillingReference{},
 		Signature:              nil,
@@ -349,37 +637,42 @@ func (c *UBLConverter) convertToCreditNote(doc *BusinessDocument) ([]byte, error
 				PaymentMeansID: "Contado",
 			},
 		},
-		TaxTotal:           c.convertTaxTotals(doc.Taxes, doc.Currency),
+		TaxTotal:           c.convertTaxTotals(documentTaxes(doc), doc.Currency),
 		LegalMonetaryTotal: c.convertLegalMonetaryTotal(doc.Totals, doc.Currency),
-		CreditNoteLines:    c.convertCreditNoteLines(doc.Items, doc.Currency),
+		CreditNoteLines:    c.convertCreditNoteLines(lines, doc.Currency, c.EmitsPricingReference(doc)),
 	}
-	if doc.Reference != nil {
-		creditNote.DiscrepancyResponse = []UBLDiscrepancyResponse{
-			{
-				ReferenceID:  doc.Reference.DocumentID,
-				ResponseCode: "01",
-				Description:  doc.Reference.Reason,
-			},
-		}
-		creditNote.BillingReference = []UBLBillingReference{
-			{
-				InvoiceDocumentReference: UBLDocumentReference{
-					ID:              doc.Reference.DocumentID,
-					IssueDate:       doc.Reference.IssueDate,
-					DocumentTypeCode: doc.Reference.DocumentType,
-				},
+	// Un DiscrepancyResponse y un BillingReference por cada documento afectado
+	for _, ref := range noteReferences(doc) {
+		creditNote.DiscrepancyResponse = append(creditNote.DiscrepancyResponse, UBLDiscrepancyResponse{
+			ReferenceID:  ref.DocumentID,
+			ResponseCode: catalogAttr(noteReasonCode(&ref), catalog.CreditNoteReason),
+			Description:  ref.Reason,
+		})
+		creditNote.BillingReference = append(creditNote.BillingReference, UBLBillingReference{
+			InvoiceDocumentReference: UBLDocumentReference{
+				ID:               ref.DocumentID,
+				IssueDate:        ref.IssueDate,
+				DocumentTypeCode: catalogAttr(ref.DocumentType, catalog.DocumentType),
 			},
+		})
+	}
+	if doc.VehiclePlate != "" {
+		for i := range creditNote.CreditNoteLines {
+			item := &creditNote.CreditNoteLines[i].Item
+			item.AdditionalItemProperty = append(item.AdditionalItemProperty, c.convertVehiclePlate(doc.VehiclePlate)...)
 		}
 	}
+	applyAdditionalTo(doc, additionalNodes{notes: &creditNote.Notes, supplier: &creditNote.AccountingSupplierParty, orderReference: &creditNote.OrderReference})
+	creditNote.RootID = c.rootID(doc)
 	xmlData, err := xml.MarshalIndent(creditNote, "", "    ")
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling credit note XML: %v", err)
 	}
-	xmlDeclaration := []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
-	return append(xmlDeclaration, xmlData...), nil
+	return append([]byte(xml.Header), xmlData...), nil
 }
 
 func (c *UBLConverter) convertToDebitNote(doc *BusinessDocument) ([]byte, error) {
+	lines := documentLines(doc)
 	debitNote := &UBLDebitNote{
 		Xmlns:                  "urn:oasis:names:specification:ubl:schema:xsd:DebitNote-2",
 		XmlnsCac:               "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
@@ -389,33 +682,17 @@ func (c *UBLConverter) convertToDebitNote(doc *BusinessDocument) ([]byte, error)
 		UBLExtensions:          nil,
 		UBLVersionID:           "2.1",
 		CustomizationID: UBLIDWithScheme{
-			SchemeAgencyName: "PE:SUNAT",
+			SchemeAgencyName: catalog.AgencySunat,
 			Value:            "2.0",
 		},
-		ProfileID: UBLIDWithScheme{
-			SchemeAgencyName: "PE:SUNAT",
-			SchemeName:       "Tipo de Operacion",
-			SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo51",
-			Value:            "0101",
-		},
+		ProfileID: catalogScheme(operationTypeOf(doc), catalog.OperationType),
 		ID:                     fmt.Sprintf("%s-%s", doc.Series, doc.Number),
 		IssueDate:              doc.IssueDate,
 		IssueTime:              "10:30:00",
-		DebitNoteTypeCode: UBLTypeCode{
-			ListAgencyName: "PE:SUNAT",
-			ListID:         "0101",
-			ListName:       "Tipo de Documento",
-			ListURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo10",
-			Name:           "Tipo de Operacion",
-			Value:          doc.Type,
-		},
-		DocumentCurrencyCode: UBLIDWithScheme{
-			SchemeAgencyName: "United Nations Economic Commission for Europe",
-			SchemeID:         "ISO 4217 Alpha",
-			SchemeName:       "Currency",
-			Value:            doc.Currency,
-		},
-		LineCountNumeric:       len(doc.Items),
+		DebitNoteTypeCode: documentTypeCode(doc.Type, operationTypeOf(doc)),
+		DocumentCurrencyCode: catalogAttr(doc.Currency, catalog.Currency),
+		LineCountNumeric:       len(lines),
+		Notes:                  append(c.convertNotes(doc), observationNotes(doc)...),
 		DiscrepancyResponse:    []UBLDiscrepancyResponse{},
 		BillingReference:       []UBLBillingReference{},
 		Signature:              nil,
@@ -427,34 +704,59 @@ func (c *UBLConverter) convertToDebitNote(doc *BusinessDocument) ([]byte, error)
 				PaymentMeansID: "Contado",
 			},
 		},
-		TaxTotal:           c.convertTaxTotals(doc.Taxes, doc.Currency),
+		TaxTotal:           c.convertTaxTotals(documentTaxes(doc), doc.Currency),
 		LegalMonetaryTotal: c.convertLegalMonetaryTotal(doc.Totals, doc.Currency),
-		DebitNoteLines:     c.convertDebitNoteLines(doc.Items, doc.Currency),
+		DebitNoteLines:     c.convertDebitNoteLines(lines, doc.Currency, c.EmitsPricingReference(doc)),
 	}
-	if doc.Reference != nil {
-		debitNote.DiscrepancyResponse = []UBLDiscrepancyResponse{
-			{
-				ReferenceID:  doc.Reference.DocumentID,
-				ResponseCode: "01",
-				Description:  doc.Reference.Reason,
-			},
-		}
-		debitNote.BillingReference = []UBLBillingReference{
-			{
-				InvoiceDocumentReference: UBLDocumentReference{
-					ID:              doc.Reference.DocumentID,
-					IssueDate:       doc.Reference.IssueDate,
-					DocumentTypeCode: doc.Reference.DocumentType,
-				},
+	// Un DiscrepancyResponse y un BillingReference por cada documento afectado
+	for _, ref := range noteReferences(doc) {
+		debitNote.DiscrepancyResponse = append(debitNote.DiscrepancyResponse, UBLDiscrepancyResponse{
+			ReferenceID:  ref.DocumentID,
+			ResponseCode: catalogAttr(noteReasonCode(&ref), catalog.DebitNoteReason),
+			Description:  ref.Reason,
+		})
+		debitNote.BillingReference = append(debitNote.BillingReference, UBLBillingReference{
+			InvoiceDocumentReference: UBLDocumentReference{
+				ID:               ref.DocumentID,
+				IssueDate:        ref.IssueDate,
+				DocumentTypeCode: catalogAttr(ref.DocumentType, catalog.DocumentType),
 			},
+		})
+	}
+	if doc.VehiclePlate != "" {
+		for i := range debitNote.DebitNoteLines {
+			item := &debitNote.DebitNoteLines[i].Item
+			item.AdditionalItemProperty = append(item.AdditionalItemProperty, c.convertVehiclePlate(doc.VehiclePlate)...)
 		}
 	}
+	applyAdditionalTo(doc, additionalNodes{notes: &debitNote.Notes, supplier: &debitNote.AccountingSupplierParty, orderReference: &debitNote.OrderReference})
+	debitNote.RootID = c.rootID(doc)
 	xmlData, err := xml.MarshalIndent(debitNote, "", "    ")
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling debit note XML: %v", err)
 	}
-	xmlDeclaration := []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
-	return append(xmlDeclaration, xmlData...), nil
+	return append([]byte(xml.Header), xmlData...), nil
+}
+
+// AmountInWordsLegendCode es el código de leyenda del catálogo 52 del monto en letras
+const AmountInWordsLegendCode = "1000"
+
+// convertNotes genera las notas del comprobante según sus características, empezando
+// por el importe total en letras en la moneda del documento (leyenda 1000)
+func (c *UBLConverter) convertNotes(doc *BusinessDocument) []UBLNote {
+	amountInWords := AmountToWords(float64(doc.Totals.PayableAmount), doc.Currency)
+	if !c.amountWordsAccents {
+		amountInWords = RemoveAccents(amountInWords)
+	}
+	notes := []UBLNote{{LanguageLocaleID: AmountInWordsLegendCode, Value: amountInWords}}
+	notes = append(notes, freeTransferNote(doc)...)
+	if doc.Contingency {
+		notes = append(notes, UBLNote{Value: "COMPROBANTE DE CONTINGENCIA"})
+	}
+	if c.watermark != "" {
+		notes = append(notes, UBLNote{Value: c.watermark})
+	}
+	return notes
 }
 
 func (c *UBLConverter) createUBLSignature(doc *BusinessDocument) *UBLSignature {
@@ -483,66 +785,37 @@ func (c *UBLConverter) convertParty(party Party) UBLParty {
 	if party.DocumentType == "1" {
 		schemeID = "1"
 	}
+	taxIdentity := identityScheme(party.DocumentID, schemeID)
+	taxIdentity.SchemeName = catalog.TaxIdentityDocumentName
 	return UBLParty{
 		Party: UBLPartyDetail{
 			PartyIdentification: []UBLPartyIdentification{
 				{
-					ID: UBLIDWithScheme{
-						SchemeAgencyName: "PE:SUNAT",
-						SchemeID:         schemeID,
-						SchemeName:       "Documento de Identidad",
-						SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06",
-						Value:            party.DocumentID,
-					},
+					ID: identityScheme(party.DocumentID, schemeID),
 				},
 			},
 			PartyName: []UBLPartyName{
 				{Name: party.Name},
 			},
 			RegistrationAddress: UBLRegistrationAddress{
-				ID: UBLIDWithScheme{
-					SchemeAgencyName: "PE:INEI",
-					SchemeName:       "Ubigeos",
-					Value:            "140101",
-				},
-				AddressTypeCode: UBLIDWithScheme{
-					SchemeAgencyName: "PE:SUNAT",
-					SchemeName:       "Establecimientos anexos",
-					Value:          "0000",
-				},
+				ID:              c.convertUbigeo(party.Address),
+				AddressTypeCode: catalogAttr("0000", catalog.Establishment),
 				CityName:         party.Address.City,
 				CountrySubentity: party.Address.Province,
 				District:         party.Address.District,
 				AddressLine: UBLAddressLine{
-					Line: fmt.Sprintf("%s - %s - %s - %s", party.Address.Street, party.Address.District, party.Address.Province, party.Address.Department),
+					Line: party.Address.Street,
 				},
 				Country: UBLCountry{
-					IdentificationCode: UBLIDWithScheme{
-						SchemeAgencyName: "United Nations Economic Commission for Europe",
-						SchemeID:         "ISO 3166-1",
-						SchemeName:       "Country",
-						Value:          party.Address.Country,
-					},
+					IdentificationCode: catalogAttr(party.Address.Country, catalog.Country),
 				},
 			},
 			PartyTaxScheme: []UBLPartyTaxScheme{
 				{
 					RegistrationName: party.Name,
-					CompanyID: UBLIDWithScheme{
-						SchemeAgencyName: "PE:SUNAT",
-						SchemeID:         schemeID,
-						SchemeName:       "SUNAT:Identificador de Documento de Identidad",
-						SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06",
-						Value:            party.DocumentID,
-					},
+					CompanyID: taxIdentity,
 					TaxScheme: UBLTaxScheme{
-						ID: UBLIDWithScheme{
-							SchemeAgencyName: "PE:SUNAT",
-							SchemeID:         schemeID,
-							SchemeName:       "SUNAT:Identificador de Documento de Identidad",
-							SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06",
-							Value:            party.DocumentID,
-						},
+						ID: taxIdentity,
 					},
 				},
 			},
@@ -550,88 +823,116 @@ func (c *UBLConverter) convertParty(party Party) UBLParty {
 				{
 					RegistrationName: party.Name,
 					RegistrationAddress: UBLRegistrationAddress{
-						ID: UBLIDWithScheme{
-							SchemeAgencyName: "PE:INEI",
-							SchemeName:       "Ubigeos",
-							Value:            "140101",
-						},
-						AddressTypeCode: UBLIDWithScheme{
-							SchemeAgencyName: "PE:SUNAT",
-							SchemeName:       "Establecimientos anexos",
-							Value:          "0000",
-						},
+						ID:              c.convertUbigeo(party.Address),
+						AddressTypeCode: catalogAttr("0000", catalog.Establishment),
 						CityName:         party.Address.City,
 						CountrySubentity: party.Address.Province,
 						District:         party.Address.District,
 						AddressLine: UBLAddressLine{
-							Line: fmt.Sprintf("%s - %s - %s - %s", party.Address.Street, party.Address.District, party.Address.Province, party.Address.Department),
+							Line: party.Address.Street,
 						},
 						Country: UBLCountry{
-							IdentificationCode: UBLIDWithScheme{
-								SchemeAgencyName: "United Nations Economic Commission for Europe",
-								SchemeID:         "ISO 3166-1",
-								SchemeName:       "Country",
-								Value:          party.Address.Country,
-							},
+							IdentificationCode: catalogAttr(party.Address.Country, catalog.Country),
 						},
 					},
 				},
 			},
 			Contact: &UBLContact{
-				Name: "",
+				Name:           "",
+				Telephone:      party.Telephone,
+				ElectronicMail: party.Email,
 			},
 		},
 	}
 }
 
+// convertVehiclePlate emite la placa como propiedad del ítem (catálogo 55, código 7000)
+// según la guía de SUNAT para estaciones de servicio
+func (c *UBLConverter) convertVehiclePlate(plate string) []UBLAdditionalItemProperty {
+	return []UBLAdditionalItemProperty{
+		{
+			Name: "Gastos Art. 37 Renta: Número de Placa",
+			NameCode: catalogAttr("7000", catalog.ItemProperty),
+			Value: strings.ToUpper(plate),
+		},
+	}
+}
+
+// convertUbigeo emite el código de ubigeo solo cuando la dirección lo tiene
+func (c *UBLConverter) convertUbigeo(address Address) *UBLIDWithScheme {
+	if address.Ubigeo == "" {
+		return nil
+	}
+	ubigeo := catalogScheme(address.Ubigeo, catalog.Ubigeo)
+	return &ubigeo
+}
+
+// convertTaxTotals emite un solo TaxTotal con un subtotal por tributo, de modo que el
+// ISC se acumula aparte del IGV y el 9996 de las gratuitas no suma al total
 func (c *UBLConverter) convertTaxTotals(taxes []TaxTotal, currency string) []UBLTaxTotal {
-	var taxTotals []UBLTaxTotal
+	if len(taxes) == 0 {
+		return nil
+	}
+	taxTotal := UBLTaxTotal{TaxAmount: UBLAmountWithCurrency{CurrencyID: currency}}
 	for _, tax := range taxes {
-		taxTotal := UBLTaxTotal{
-			TaxAmount: UBLAmountWithCurrency{
+		// El tributo de las gratuitas no suma al total de tributos
+		if tax.TaxType != FreeTaxType {
+			taxTotal.TaxAmount.Value += float64(tax.TaxAmount)
+		}
+		taxTotal.TaxSubtotals = append(taxTotal.TaxSubtotals, UBLTaxSubtotal{
+			TaxableAmount: UBLAmountWithCurrency{
 				CurrencyID: currency,
-				Value:      tax.TaxAmount,
+				Value:      float64(tax.TaxBase),
 			},
-			TaxSubtotals: []UBLTaxSubtotal{
-				{
-					TaxableAmount: UBLAmountWithCurrency{
-						CurrencyID: currency,
-						Value:      tax.TaxBase,
-					},
-					TaxAmount: UBLAmountWithCurrency{
-						CurrencyID: currency,
-						Value:      tax.TaxAmount,
-					},
-					TaxCategory: UBLTaxCategory{
-						ID: UBLIDWithScheme{
-							SchemeAgencyName: "United Nations Economic Commission for Europe",
-							SchemeID:         "UN/ECE 5305",
-							SchemeName:       "Tax Category Identifier",
-							Value:            "S",
-						},
-						Percent: tax.TaxRate,
-						TaxExemptionReasonCode: UBLIDWithScheme{
-							SchemeAgencyName: "PE:SUNAT",
-							SchemeName:       "Afectacion del IGV",
-							SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo07",
-							Value:          "10",
-						},
-						TaxScheme: UBLTaxScheme{
-							ID: UBLIDWithScheme{
-								SchemeAgencyName: "PE:SUNAT",
-								SchemeID:         "UN/ECE 5153",
-								Value:            tax.TaxType,
-							},
-							Name:        c.getTaxName(tax.TaxType),
-							TaxTypeCode: "VAT",
-						},
-					},
-				},
+			TaxAmount: UBLAmountWithCurrency{
+				CurrencyID: currency,
+				Value:      float64(tax.TaxAmount),
 			},
+			TaxCategory: c.convertTaxCategory(tax.TaxType, float64(tax.TaxRate), ""),
+		})
+	}
+	taxTotal.TaxAmount.Value = Decimal2(taxTotal.TaxAmount.Value).Round()
+	return []UBLTaxTotal{taxTotal}
+}
+
+// convertTaxCategory arma la categoría de un tributo. En los tributos que llevan tipo
+// de afectación del IGV (catálogo 07) el tipo determina la categoría, el código de
+// exención y el tributo: los retiros y transferencias gratuitas se declaran en el 9996
+// con la categoría Z. Sin tipo se usa el que corresponde al tributo. El ISC no lleva
+// afectación.
+func (c *UBLConverter) convertTaxCategory(taxType string, rate float64, affectationCode string) UBLTaxCategory {
+	categoryID, reasonCode := "S", ""
+	if affectsIGV(taxType) {
+		if affectationCode == "" {
+			affectationCode = defaultAffectationCode(taxType, rate)
+		}
+		reasonCode = affectationCode
+		if affectation, ok := lookupAffectation(affectationCode); ok {
+			taxType, categoryID = affectation.taxType, affectation.category
+			if affectation.free {
+				taxType, categoryID = FreeTaxType, "Z"
+			}
+		} else if taxType == FreeTaxType {
+			categoryID = "Z"
 		}
-		taxTotals = append(taxTotals, taxTotal)
+	} else if taxType != ISCTaxType {
+		reasonCode = "10"
 	}
-	return taxTotals
+
+	category := UBLTaxCategory{
+		ID:      catalogScheme(categoryID, catalog.TaxCategory),
+		Percent: Decimal2(rate),
+		TaxScheme: UBLTaxScheme{
+			ID:          catalogScheme(taxType, catalog.TaxType),
+			Name:        c.getTaxName(taxType),
+			TaxTypeCode: c.getTaxTypeCode(taxType),
+		},
+	}
+	if reasonCode != "" {
+		reason := catalogAttr(reasonCode, catalog.IGVAffectation)
+		category.TaxExemptionReasonCode = &reason
+	}
+	return category
 }
 
 func (c *UBLConverter) getTaxName(taxType string) string {
@@ -642,243 +943,181 @@ func (c *UBLConverter) getTaxName(taxType string) string {
 		return "ISC"
 	case "7152":
 		return "ICBPER"
+	case IVAPTaxType:
+		return "IVAP"
+	case "9995":
+		return "EXP"
+	case FreeTaxType:
+		return "GRA"
+	case "9997":
+		return "EXO"
+	case "9998":
+		return "INA"
 	default:
 		return "TAX"
 	}
 }
 
+// getTaxTypeCode retorna el código UN/ECE 5153 del tributo
+func (c *UBLConverter) getTaxTypeCode(taxType string) string {
+	switch taxType {
+	case ISCTaxType:
+		return "EXC"
+	case "9995", FreeTaxType, "9998":
+		return "FRE"
+	}
+	return "VAT"
+}
+
 func (c *UBLConverter) convertLegalMonetaryTotal(totals DocumentTotals, currency string) UBLLegalMonetaryTotal {
 	return UBLLegalMonetaryTotal{
 		LineExtensionAmount: UBLAmountWithCurrency{
 			CurrencyID: currency,
-			Value:      totals.SubTotal,
+			Value:      float64(totals.SubTotal),
 		},
 		TaxInclusiveAmount: UBLAmountWithCurrency{
 			CurrencyID: currency,
-			Value:      totals.TotalAmount,
+			Value:      float64(totals.TotalAmount),
 		},
 		PayableAmount: UBLAmountWithCurrency{
 			CurrencyID: currency,
-			Value:      totals.PayableAmount,
+			Value:      float64(totals.PayableAmount),
 		},
 	}
 }
 
-func (c *UBLConverter) convertInvoiceLines(items []DocumentItem, currency string) []UBLInvoiceLine {
+func (c *UBLConverter) convertInvoiceLines(items []documentLine, currency string, emitPricing bool) []UBLInvoiceLine {
 	var lines []UBLInvoiceLine
-	for i, item := range items {
+	for _, numbered := range items {
+		item := numbered.Item
 		line := UBLInvoiceLine{
-			ID: fmt.Sprintf("%d", i+1),
-			InvoicedQuantity: UBLQuantityWithUnit{
-				UnitCode:                    item.UnitCode,
-				UnitCodeListAgencyName:      "United Nations Economic Commission for Europe",
-				UnitCodeListID:              "UN/ECE rec 20",
-				Value:                       item.Quantity,
-			},
+			ID: numbered.ID,
+			InvoicedQuantity: catalogQuantity(float64(item.Quantity), item.UnitCode),
 			LineExtensionAmount: UBLAmountWithCurrency{
 				CurrencyID: currency,
-				Value:      item.LineTotal,
-			},
-			PricingReference: &UBLPricingReference{
-				AlternativeConditionPrice: UBLAlternativeConditionPrice{
-					PriceAmount: UBLAmountWithCurrency{
-						CurrencyID: currency,
-						Value:      item.UnitPrice * item.Quantity,
-					},
-					PriceTypeCode: UBLIDWithScheme{
-						SchemeAgencyName: "PE:SUNAT",
-						SchemeName:       "Tipo de Precio",
-						SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo16",
-						Value:          "01",
-					},
-				},
+				Value:      float64(item.LineTotal),
 			},
+			PricingReference: c.pricingReference(item, currency, emitPricing),
+			AllowanceCharge:  lineDiscount(item, currency),
 			TaxTotal: c.convertItemTaxes(item.Taxes, currency),
 			Item: UBLItem{
-				Description: item.Description,
+				Description: newItemDescription(item.Description),
 				SellersItemIdentification: &UBLSellersItemIdentification{
 					ID: item.ID,
 				},
-				CommodityClassification: &UBLCommodityClassification{
-					ItemClassificationCode: UBLIDWithScheme{
-						SchemeAgencyName: "GS1 US",
-						SchemeID:         "UNSPSC",
-						SchemeName:       "Item Classification",
-						Value:          "10191509",
-					},
-				},
+				CommodityClassification: itemClassification(item),
+				AdditionalItemProperty: c.convertTourismDetail(item.TourismDetail),
 			},
 			Price: UBLPrice{
 				PriceAmount: UBLAmountWithCurrency{
 					CurrencyID: currency,
-					Value:      item.UnitPrice,
+					Value:      float64(item.UnitPrice),
 				},
 			},
 		}
+		c.applyFreeLine(item, &line.Price, line.TaxTotal)
 		lines = append(lines, line)
 	}
 	return lines
 }
 
-func (c *UBLConverter) convertCreditNoteLines(items []DocumentItem, currency string) []UBLCreditNoteLine {
+func (c *UBLConverter) convertCreditNoteLines(items []documentLine, currency string, emitPricing bool) []UBLCreditNoteLine {
 	var lines []UBLCreditNoteLine
-	for i, item := range items {
+	for _, numbered := range items {
+		item := numbered.Item
 		line := UBLCreditNoteLine{
-			ID: fmt.Sprintf("%d", i+1),
-			CreditedQuantity: UBLQuantityWithUnit{
-				UnitCode:                    item.UnitCode,
-				UnitCodeListAgencyName:      "United Nations Economic Commission for Europe",
-				UnitCodeListID:              "UN/ECE rec 20",
-				Value:                       item.Quantity,
-			},
+			ID: numbered.ID,
+			CreditedQuantity: catalogQuantity(float64(item.Quantity), item.UnitCode),
 			LineExtensionAmount: UBLAmountWithCurrency{
 				CurrencyID: currency,
-				Value:      item.LineTotal,
-			},
-			PricingReference: &UBLPricingReference{
-				AlternativeConditionPrice: UBLAlternativeConditionPrice{
-					PriceAmount: UBLAmountWithCurrency{
-						CurrencyID: currency,
-						Value:      item.UnitPrice * item.Quantity,
-					},
-					PriceTypeCode: UBLIDWithScheme{
-						SchemeAgencyName: "PE:SUNAT",
-						SchemeName:       "Tipo de Precio",
-						SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo16",
-						Value:          "01",
-					},
-				},
+				Value:      float64(item.LineTotal),
 			},
+			PricingReference: c.pricingReference(item, currency, emitPricing),
 			TaxTotal: c.convertItemTaxes(item.Taxes, currency),
 			Item: UBLItem{
-				Description: item.Description,
+				Description: newItemDescription(item.Description),
 				SellersItemIdentification: &UBLSellersItemIdentification{
 					ID: item.ID,
 				},
-				CommodityClassification: &UBLCommodityClassification{
-					ItemClassificationCode: UBLIDWithScheme{
-						SchemeAgencyName: "GS1 US",
-						SchemeID:         "UNSPSC",
-						SchemeName:       "Item Classification",
-						Value:          "10191509",
-					},
-				},
+				CommodityClassification: itemClassification(item),
+				AdditionalItemProperty: c.convertTourismDetail(item.TourismDetail),
 			},
 			Price: UBLPrice{
 				PriceAmount: UBLAmountWithCurrency{
 					CurrencyID: currency,
-					Value:      item.UnitPrice,
+					Value:      float64(item.UnitPrice),
 				},
 			},
 		}
+		c.applyFreeLine(item, &line.Price, line.TaxTotal)
 		lines = append(lines, line)
 	}
 	return lines
 }
 
-func (c *UBLConverter) convertDebitNoteLines(items []DocumentItem, currency string) []UBLDebitNoteLine {
+func (c *UBLConverter) convertDebitNoteLines(items []documentLine, currency string, emitPricing bool) []UBLDebitNoteLine {
 	var lines []UBLDebitNoteLine
-	for i, item := range items {
+	for _, numbered := range items {
+		item := numbered.Item
 		line := UBLDebitNoteLine{
-			ID: fmt.Sprintf("%d", i+1),
-			DebitedQuantity: UBLQuantityWithUnit{
-				UnitCode:                    item.UnitCode,
-				UnitCodeListAgencyName:      "United Nations Economic Commission for Europe",
-				UnitCodeListID:              "UN/ECE rec 20",
-				Value:                       item.Quantity,
-			},
+			ID: numbered.ID,
+			DebitedQuantity: catalogQuantity(float64(item.Quantity), item.UnitCode),
 			LineExtensionAmount: UBLAmountWithCurrency{
 				CurrencyID: currency,
-				Value:      item.LineTotal,
-			},
-			PricingReference: &UBLPricingReference{
-				AlternativeConditionPrice: UBLAlternativeConditionPrice{
-					PriceAmount: UBLAmountWithCurrency{
-						CurrencyID: currency,
-						Value:      item.UnitPrice * item.Quantity,
-					},
-					PriceTypeCode: UBLIDWithScheme{
-						SchemeAgencyName: "PE:SUNAT",
-						SchemeName:       "Tipo de Precio",
-						SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo16",
-						Value:          "01",
-					},
-				},
+				Value:      float64(item.LineTotal),
 			},
+			PricingReference: c.pricingReference(item, currency, emitPricing),
 			TaxTotal: c.convertItemTaxes(item.Taxes, currency),
 			Item: UBLItem{
-				Description: item.Description,
+				Description: newItemDescription(item.Description),
 				SellersItemIdentification: &UBLSellersItemIdentification{
 					ID: item.ID,
 				},
-				CommodityClassification: &UBLCommodityClassification{
-					ItemClassificationCode: UBLIDWithScheme{
-						SchemeAgencyName: "GS1 US",
-						SchemeID:         "UNSPSC",
-						SchemeName:       "Item Classification",
-						Value:          "10191509",
-					},
-				},
+				CommodityClassification: itemClassification(item),
+				AdditionalItemProperty: c.convertTourismDetail(item.TourismDetail),
 			},
 			Price: UBLPrice{
 				PriceAmount: UBLAmountWithCurrency{
 					CurrencyID: currency,
-					Value:      item.UnitPrice,
+					Value:      float64(item.UnitPrice),
 				},
 			},
 		}
+		c.applyFreeLine(item, &line.Price, line.TaxTotal)
 		lines = append(lines, line)
 	}
 	return lines
 }
 
+// convertItemTaxes emite el TaxTotal de la línea con un subtotal por tributo. El
+// subtotal del ISC lleva su sistema de cálculo en TierRange y, en el sistema específico,
+// el monto fijo por unidad.
 func (c *UBLConverter) convertItemTaxes(taxes []Tax, currency string) []UBLTaxTotal {
-	var taxTotals []UBLTaxTotal
+	if len(taxes) == 0 {
+		return nil
+	}
+	taxTotal := UBLTaxTotal{TaxAmount: UBLAmountWithCurrency{CurrencyID: currency}}
 	for _, tax := range taxes {
-		taxTotal := UBLTaxTotal{
-			TaxAmount: UBLAmountWithCurrency{
+		category := c.convertTaxCategory(tax.TaxType, float64(tax.TaxRate), tax.AffectationCode)
+		if tax.TaxType == ISCTaxType {
+			category.TierRange = tax.IscSystem
+			if tax.IscSystem == ISCSystemSpecific {
+				category.PerUnitAmount = &UBLAmountWithCurrency{CurrencyID: currency, Value: float64(tax.IscAmountPerUnit)}
+			}
+		}
+		taxTotal.TaxAmount.Value += float64(tax.TaxAmount)
+		taxTotal.TaxSubtotals = append(taxTotal.TaxSubtotals, UBLTaxSubtotal{
+			TaxableAmount: UBLAmountWithCurrency{
 				CurrencyID: currency,
-				Value:      tax.TaxAmount,
+				Value:      float64(tax.TaxBase),
 			},
-			TaxSubtotals: []UBLTaxSubtotal{
-				{
-					TaxableAmount: UBLAmountWithCurrency{
-						CurrencyID: currency,
-						Value:      tax.TaxBase,
-					},
-					TaxAmount: UBLAmountWithCurrency{
-						CurrencyID: currency,
-						Value:      tax.TaxAmount,
-					},
-					TaxCategory: UBLTaxCategory{
-						ID: UBLIDWithScheme{
-							SchemeAgencyName: "United Nations Economic Commission for Europe",
-							SchemeID:         "UN/ECE 5305",
-							SchemeName:       "Tax Category Identifier",
-							Value:            "S",
-						},
-						Percent: tax.TaxRate,
-						TaxExemptionReasonCode: UBLIDWithScheme{
-							SchemeAgencyName: "PE:SUNAT",
-							SchemeName:       "Afectacion del IGV",
-							SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo07",
-							Value:          "10",
-						},
-						TaxScheme: UBLTaxScheme{
-							ID: UBLIDWithScheme{
-								SchemeAgencyName: "PE:SUNAT",
-								SchemeID:         "UN/ECE 5153",
-								SchemeName:       "Codigo de tributos",
-								Value:            tax.TaxType,
-							},
-							Name:        c.getTaxName(tax.TaxType),
-							TaxTypeCode: "VAT",
-						},
-					},
-				},
+			TaxAmount: UBLAmountWithCurrency{
+				CurrencyID: currency,
+				Value:      float64(tax.TaxAmount),
 			},
-		}
-		taxTotals = append(taxTotals, taxTotal)
+			TaxCategory: category,
+		})
 	}
-	return taxTotals
+	taxTotal.TaxAmount.Value = Decimal2(taxTotal.TaxAmount.Value).Round()
+	return []UBLTaxTotal{taxTotal}
 } 
\ No newline at end of file
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	. "API-SUNAT2/model"
+)
+
+// Extensiones del índice de correlaciones en el store: el procesamiento nombrado por su
+// correlationId y la lista de procesamientos de un documento
+const (
+	CorrelationSuffix          = ".correlacion"
+	DocumentCorrelationsSuffix = ".correlaciones"
+)
+
+var (
+	ErrInvalidCorrelationID = errors.New("correlationId must contain only letters, digits and hyphens")
+	ErrCorrelationNotFound  = errors.New("correlation not found")
+)
+
+// correlationIDPattern reconoce un correlationId (UUID o el X-Request-ID del cliente),
+// que también nombra un archivo del store
+var correlationIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// recordCorrelation indexa en ambos sentidos el correlationId de la respuesta con el
+// documento procesado. Un procesamiento fallido solo se indexa si el documento ya fue
+// generado (un reintento o reproceso): un documento que nunca se generó no deja nada en
+// el store. Un fallo solo se registra en el log: el índice no debe impedir la emisión.
+func (s *UBLConverterService) recordCorrelation(documentID string, resp *APIResponse) {
+	documentID = CanonicalDocumentID(documentID)
+	if !documentIDPattern.MatchString(documentID) || !correlationIDPattern.MatchString(resp.CorrelationID) {
+		return
+	}
+	if resp.Status != "SUCCESS" {
+		if _, err := s.store.Read(RecordName(documentID)); err != nil {
+			return
+		}
+	}
+	record := CorrelationRecord{
+		CorrelationID: resp.CorrelationID,
+		DocumentID:    documentID,
+		Status:        resp.Status,
+		ErrorCode:     resp.ErrorCode,
+		XMLHash:       resp.XMLHash,
+		ProcessedAt:   resp.ProcessedAt,
+	}
+
+	s.correlationMu.Lock()
+	defer s.correlationMu.Unlock()
+
+	data, err := json.Marshal(record)
+	if err == nil {
+		_, err = s.store.Save(record.CorrelationID+CorrelationSuffix, data)
+	}
+	if err == nil {
+		var records []CorrelationRecord
+		if records, err = s.readDocumentCorrelations(documentID); err == nil {
+			records = append(records, record)
+			if data, err = json.Marshal(records); err == nil {
+				_, err = s.store.Save(documentID+DocumentCorrelationsSuffix, data)
+			}
+		}
+	}
+	if err != nil {
+		s.GetLogger().Warnf("No se pudo indexar el correlationId %s de %s: %v", record.CorrelationID, documentID, err)
+	}
+}
+
+// readDocumentCorrelations retorna los procesamientos indexados del documento
+func (s *UBLConverterService) readDocumentCorrelations(documentID string) ([]CorrelationRecord, error) {
+	data, err := s.store.Read(documentID + DocumentCorrelationsSuffix)
+	if err != nil {
+		return nil, nil
+	}
+	var records []CorrelationRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("invalid correlation index %s: %v", documentID, err)
+	}
+	return records, nil
+}
+
+// CorrelationStatus retorna el procesamiento de un correlationId con el estado y los
+// artefactos actuales de su documento; si el documento se reprocesó después, son los
+// del último procesamiento
+func (s *UBLConverterService) CorrelationStatus(correlationID string) (*CorrelationLookup, error) {
+	if !correlationIDPattern.MatchString(correlationID) {
+		return nil, ErrInvalidCorrelationID
+	}
+	data, err := s.store.Read(correlationID + CorrelationSuffix)
+	if err != nil {
+		return nil, ErrCorrelationNotFound
+	}
+	lookup := &CorrelationLookup{Artifacts: map[string]string{}}
+	if err := json.Unmarshal(data, &lookup.Record); err != nil {
+		return nil, fmt.Errorf("invalid correlation record %s: %v", correlationID, err)
+	}
+
+	document, err := s.findDocument(lookup.Record.DocumentID)
+	switch {
+	case errors.Is(err, ErrDocumentNotFound):
+		return lookup, nil
+	case err != nil:
+		return nil, err
+	}
+	lookup.DocumentStatus = document.Status
+	lookup.Artifacts = document.Artifacts
+	return lookup, nil
+}
+
+// DocumentCorrelations retorna en orden cronológico todos los procesamientos de un
+// documento (el original, reintentos y reprocesos) con su resultado
+func (s *UBLConverterService) DocumentCorrelations(documentID string) ([]CorrelationRecord, error) {
+	documentID = CanonicalDocumentID(documentID)
+	if !documentIDPattern.MatchString(documentID) {
+		return nil, ErrInvalidDocumentKey
+	}
+	s.correlationMu.Lock()
+	records, err := s.readDocumentCorrelations(documentID)
+	s.correlationMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrDocumentNotFound
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].ProcessedAt.Before(records[j].ProcessedAt)
+	})
+	return records, nil
+}
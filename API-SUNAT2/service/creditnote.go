@@ -0,0 +1,292 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// DefaultNoteReasonCode es el motivo usado cuando la nota no indica reasonCode
+const DefaultNoteReasonCode = "01"
+
+// Reglas de monto asociadas a los motivos de nota de crédito
+const (
+	// reasonEqualTotal exige que el total de la nota iguale al del documento afectado
+	reasonEqualTotal = "reason_total_equal"
+	// reasonNotExceedTotal exige que el total de la nota no supere al del documento afectado
+	reasonNotExceedTotal = "reason_total_not_exceed"
+)
+
+type noteReason struct {
+	description string
+	rule        string
+}
+
+// creditNoteRules es la regla de montos de los motivos del catálogo 09; los motivos y
+// sus descripciones son los de la lista activa del paquete catalog
+var creditNoteRules = map[string]string{
+	"01": reasonEqualTotal,
+	"02": reasonEqualTotal,
+	"04": reasonNotExceedTotal,
+	"06": reasonEqualTotal,
+	"13": reasonEqualTotal,
+}
+
+// lookupNoteReason retorna el motivo de una nota de crédito (07) o débito (08) de la
+// lista activa del catálogo 09 o 10, con su regla de montos
+func lookupNoteReason(docType, code string) (noteReason, bool) {
+	catalogID := catalog.CreditNoteReason
+	if docType == "08" {
+		catalogID = catalog.DebitNoteReason
+	}
+	description, ok := catalog.Description(catalogID, code)
+	if !ok {
+		return noteReason{}, false
+	}
+	reason := noteReason{description: description}
+	if docType == "07" {
+		reason.rule = creditNoteRules[code]
+	}
+	return reason, true
+}
+
+// noteReasonCode retorna el motivo de la nota, o el motivo por defecto si no se indicó
+func noteReasonCode(ref *DocumentReference) string {
+	if ref.ReasonCode == "" {
+		return DefaultNoteReasonCode
+	}
+	return ref.ReasonCode
+}
+
+// affectedDocumentID retorna el documento (RUC-TIPO-SERIE-NUMERO) que modifica la nota
+func affectedDocumentID(issuer string, ref DocumentReference) string {
+	return fmt.Sprintf("%s-%s-%s", issuer, ref.DocumentType, ref.DocumentID)
+}
+
+// checkCreditNoteReason aplica la regla de montos del motivo contra cada documento
+// afectado guardado en el store; en una nota consolidada se compara el monto de cada
+// referencia. Solo se verifican los motivos indicados: sin reasonCode la nota se emite
+// con el motivo por defecto, pero no se le exige su regla, para no rechazar las notas
+// parciales que no lo indicaban. Si el documento afectado no está disponible se retorna
+// un warning en lugar de un error.
+func (s *UBLConverterService) checkCreditNoteReason(doc *BusinessDocument) ([]ValidationError, []ValidationError) {
+	if doc.Type != "07" {
+		return nil, nil
+	}
+	var errors, warnings []ValidationError
+	for i, ref := range noteReferences(doc) {
+		errs, warns := s.checkReferenceReason(doc, i, ref)
+		errors = append(errors, errs...)
+		warnings = append(warnings, warns...)
+	}
+	return errors, warnings
+}
+
+func (s *UBLConverterService) checkReferenceReason(doc *BusinessDocument, i int, ref DocumentReference) ([]ValidationError, []ValidationError) {
+	if ref.ReasonCode == "" {
+		return nil, nil
+	}
+	code := ref.ReasonCode
+	reason, ok := lookupNoteReason(doc.Type, code)
+	if !ok || reason.rule == "" {
+		return nil, nil
+	}
+	field := referenceField(doc, i)
+
+	content, err := s.store.Read(affectedDocumentID(doc.Issuer.DocumentID, ref) + ".xml")
+	if err != nil {
+		return nil, []ValidationError{{
+			Field:    field + ".documentId",
+			Expected: "Affected document available in store",
+			Received: ref.DocumentID,
+			Rule:     "credit_note_reason_unverified",
+			Message:  fmt.Sprintf("Motivo %s (%s): el documento afectado no está disponible, no se verificó la regla %s", code, reason.description, reason.rule),
+		}}
+	}
+	affectedTotal, err := readPayableAmount(content)
+	if err != nil {
+		return nil, []ValidationError{{
+			Field:    field + ".documentId",
+			Expected: "Affected document with PayableAmount",
+			Received: err.Error(),
+			Rule:     "credit_note_reason_unverified",
+			Message:  fmt.Sprintf("Motivo %s (%s): no se pudo leer el total del documento afectado, no se verificó la regla %s", code, reason.description, reason.rule),
+		}}
+	}
+
+	noteTotal, amountField := referenceAmount(doc, i)
+	switch reason.rule {
+	case reasonEqualTotal:
+		if math.Abs(noteTotal-affectedTotal) > 0.01 {
+			return []ValidationError{{
+				Field:    amountField,
+				Expected: fmt.Sprintf("%.2f", affectedTotal),
+				Received: fmt.Sprintf("%.2f", noteTotal),
+				Rule:     reasonEqualTotal,
+				Message:  fmt.Sprintf("Motivo %s (%s): el total de la nota debe ser igual al del documento afectado %s", code, reason.description, ref.DocumentID),
+			}}, nil
+		}
+	case reasonNotExceedTotal:
+		if noteTotal > affectedTotal+0.01 {
+			return []ValidationError{{
+				Field:    amountField,
+				Expected: fmt.Sprintf("At most %.2f", affectedTotal),
+				Received: fmt.Sprintf("%.2f", noteTotal),
+				Rule:     reasonNotExceedTotal,
+				Message:  fmt.Sprintf("Motivo %s (%s): el total de la nota no puede exceder al del documento afectado %s", code, reason.description, ref.DocumentID),
+			}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetCheckNoteBalance habilita verificar contra el store que el documento afectado por
+// una nota de crédito exista, no esté anulado ni rechazado y tenga saldo para la nota
+func (s *UBLConverterService) SetCheckNoteBalance(enabled bool) {
+	s.checkNoteBalance = enabled
+}
+
+// checkCreditNoteBalance verifica la nota de crédito contra el registro del documento
+// afectado: que no esté anulado ni rechazado por SUNAT y que el total de la nota, sumado
+// al de las notas de crédito previas sobre el mismo documento, no supere su total. Si el
+// documento afectado no está en el store (emitido por otro sistema) retorna un warning.
+// En una nota consolidada se verifica cada documento con el monto de su referencia.
+func (s *UBLConverterService) checkCreditNoteBalance(doc *BusinessDocument) ([]ValidationError, []ValidationError) {
+	if !s.checkNoteBalance || doc.Type != "07" {
+		return nil, nil
+	}
+	var errors, warnings []ValidationError
+	for i, ref := range noteReferences(doc) {
+		errs, warns := s.checkReferenceBalance(doc, i, ref)
+		errors = append(errors, errs...)
+		warnings = append(warnings, warns...)
+	}
+	return errors, warnings
+}
+
+func (s *UBLConverterService) checkReferenceBalance(doc *BusinessDocument, i int, ref DocumentReference) ([]ValidationError, []ValidationError) {
+	field := referenceField(doc, i)
+	affected := affectedDocumentID(doc.Issuer.DocumentID, ref)
+	data, err := s.store.Read(RecordName(affected))
+	if err != nil {
+		return nil, []ValidationError{{
+			Field:    field + ".documentId",
+			Expected: "Affected document issued by this service",
+			Received: ref.DocumentID,
+			Rule:     "credit_note_affected_unknown",
+			Message:  fmt.Sprintf("El documento afectado %s no está en el store, no se verificó su saldo", affected),
+		}}
+	}
+	var record DocumentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, []ValidationError{{
+			Field:    field + ".documentId",
+			Expected: "Affected document with a valid record",
+			Received: err.Error(),
+			Rule:     "credit_note_affected_unknown",
+			Message:  fmt.Sprintf("No se pudo leer el registro del documento afectado %s, no se verificó su saldo", affected),
+		}}
+	}
+
+	if _, err := s.store.Read(affected + VoidedSuffix); err == nil {
+		return []ValidationError{{
+			Field:    field + ".documentId",
+			Expected: "Affected document not voided",
+			Received: ref.DocumentID,
+			Rule:     "credit_note_affected_voided",
+			Message:  fmt.Sprintf("El documento afectado %s está anulado", affected),
+		}}, nil
+	}
+	if s.isRejectedBySunat(affected) {
+		return []ValidationError{{
+			Field:    field + ".documentId",
+			Expected: "Affected document accepted by SUNAT",
+			Received: ref.DocumentID,
+			Rule:     "credit_note_affected_rejected",
+			Message:  fmt.Sprintf("El documento afectado %s fue rechazado por SUNAT", affected),
+		}}, nil
+	}
+
+	credited, err := s.creditedAmount(affected, DocumentIDOf(doc))
+	if err != nil {
+		return nil, []ValidationError{{
+			Field:    field + ".documentId",
+			Expected: "Previous credit notes readable from store",
+			Received: err.Error(),
+			Rule:     "credit_note_affected_unknown",
+			Message:  fmt.Sprintf("No se pudieron leer las notas previas sobre %s, no se verificó su saldo", affected),
+		}}
+	}
+	available := record.PayableAmount - credited
+	if amount, amountField := referenceAmount(doc, i); amount > available+0.01 {
+		return []ValidationError{{
+			Field:      amountField,
+			Expected:   fmt.Sprintf("At most %.2f", math.Max(available, 0)),
+			Received:   fmt.Sprintf("%.2f", amount),
+			Rule:       "credit_note_balance_exceeded",
+			Message:    fmt.Sprintf("La nota excede el saldo de %s: total %.2f, notas de crédito previas %.2f", affected, record.PayableAmount, credited),
+			Suggestion: fmt.Sprintf("The remaining balance of %s is %.2f", affected, math.Max(available, 0)),
+		}}, nil
+	}
+	return nil, nil
+}
+
+// isRejectedBySunat indica si el documento fue rechazado en todos los ambientes en que
+// tiene un CDR: un rechazo en beta no cuenta si producción lo aceptó
+func (s *UBLConverterService) isRejectedBySunat(documentID string) bool {
+	rejected := false
+	for _, environment := range lookupEnvironments {
+		data, err := s.store.Read(fmt.Sprintf("%s.%s.envio", documentID, environment))
+		if err != nil {
+			continue
+		}
+		var submission SubmissionRecord
+		if json.Unmarshal(data, &submission) != nil {
+			continue
+		}
+		switch submission.Status {
+		case CDRAccepted, CDRObserved:
+			return false
+		case CDRRejected:
+			rejected = true
+		}
+	}
+	return rejected
+}
+
+// creditedAmount suma las notas de crédito registradas sobre el documento afectado,
+// sin contar las anuladas ni la nota que se está procesando. De una nota consolidada
+// cuenta solo el monto que ajusta sobre ese documento.
+func (s *UBLConverterService) creditedAmount(affected, noteID string) (float64, error) {
+	total := 0.0
+	err := s.readJSONRecords(RecordSuffix, func(name string, data []byte) error {
+		var record DocumentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("invalid document record %s: %v", name, err)
+		}
+		if record.DocumentType != "07" || record.DocumentID == noteID {
+			return nil
+		}
+		amount, ok := record.PayableAmount, record.AffectedDocumentID == affected
+		if len(record.AffectedDocuments) > 0 {
+			ok = false
+			for _, adjusted := range record.AffectedDocuments {
+				if adjusted.DocumentID == affected {
+					amount, ok = adjusted.Amount, true
+				}
+			}
+		}
+		if !ok {
+			return nil
+		}
+		if _, err := s.store.Read(record.DocumentID + VoidedSuffix); err == nil {
+			return nil
+		}
+		total += amount
+		return nil
+	})
+	return total, err
+}
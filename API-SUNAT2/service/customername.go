@@ -0,0 +1,163 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// DefaultCustomerNameSimilarity es la similitud mínima entre la razón social enviada y
+// la del padrón por debajo de la cual se advierte
+const DefaultCustomerNameSimilarity = 0.85
+
+// CustomerDocumentRUC es el tipo de documento (catálogo 06) de un cliente con RUC
+const CustomerDocumentRUC = "6"
+
+// legalForms abrevia las formas societarias escritas completas, ya sin tildes ni puntos
+var legalForms = strings.NewReplacer(
+	"SOCIEDAD ANONIMA CERRADA", "SAC",
+	"SOCIEDAD ANONIMA ABIERTA", "SAA",
+	"SOCIEDAD ANONIMA", "SA",
+	"EMPRESA INDIVIDUAL DE RESPONSABILIDAD LIMITADA", "EIRL",
+	"SOCIEDAD COMERCIAL DE RESPONSABILIDAD LIMITADA", "SRL",
+	"SOCIEDAD DE RESPONSABILIDAD LIMITADA", "SRL",
+)
+
+// SetCustomerNameCheck habilita la comparación de la razón social de los clientes con
+// RUC contra el padrón; minSimilarity (entre 0 y 1) es la similitud desde la que no se
+// advierte. 0 la deshabilita.
+func (s *UBLConverterService) SetCustomerNameCheck(minSimilarity float64) {
+	if minSimilarity < 0 || minSimilarity > 1 {
+		return
+	}
+	s.customerNameSimilarity = minSimilarity
+}
+
+// normalizeTaxpayerName deja la razón social en mayúsculas, sin tildes ni signos y con
+// la forma societaria abreviada: "Comercial Pérez S. A. C." -> "COMERCIAL PEREZ SAC"
+func normalizeTaxpayerName(name string) string {
+	name = strings.ToUpper(RemoveAccents(name))
+	name = strings.ReplaceAll(name, ".", " ")
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, name)
+
+	// Las iniciales sueltas son una sigla escrita con puntos o espacios ("S A C")
+	var words []string
+	initials := ""
+	for _, word := range strings.Fields(name) {
+		if len([]rune(word)) == 1 {
+			initials += word
+			continue
+		}
+		if initials != "" {
+			words = append(words, initials)
+			initials = ""
+		}
+		words = append(words, word)
+	}
+	if initials != "" {
+		words = append(words, initials)
+	}
+	return legalForms.Replace(strings.Join(words, " "))
+}
+
+// levenshtein retorna la distancia de edición entre a y b, por runas
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// relativeSimilarity es 1 menos la distancia de edición relativa al texto más largo
+func relativeSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// sortedWords retorna las palabras del texto ordenadas, para comparar sin importar el orden
+func sortedWords(text string) string {
+	words := strings.Fields(text)
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// TaxpayerNameSimilarity compara dos razones sociales normalizadas, sin importar el
+// orden de las palabras. Retorna un valor entre 0 (distintas) y 1 (iguales).
+func TaxpayerNameSimilarity(a, b string) float64 {
+	a, b = normalizeTaxpayerName(a), normalizeTaxpayerName(b)
+	similarity := relativeSimilarity(a, b)
+	if sorted := relativeSimilarity(sortedWords(a), sortedWords(b)); sorted > similarity {
+		similarity = sorted
+	}
+	return similarity
+}
+
+// checkCustomerName compara la razón social de un cliente con RUC con la del padrón y
+// retorna un warning con la razón social oficial si se parecen poco. Nunca bloquea: si
+// el padrón no responde no se advierte nada.
+func (s *UBLConverterService) checkCustomerName(doc *BusinessDocument) *ValidationError {
+	if s.padron == nil || s.customerNameSimilarity == 0 || doc.Customer.DocumentType != CustomerDocumentRUC {
+		return nil
+	}
+
+	status, err := s.padron.Lookup(doc.Customer.DocumentID)
+	if err != nil {
+		s.GetLogger().Debugf("No se pudo consultar la razón social de %s: %v", doc.Customer.DocumentID, err)
+		return nil
+	}
+	if status.Name == "" {
+		return nil
+	}
+
+	similarity := TaxpayerNameSimilarity(doc.Customer.Name, status.Name)
+	if similarity >= s.customerNameSimilarity {
+		return nil
+	}
+	return &ValidationError{
+		Field:      "customer.name",
+		Expected:   status.Name,
+		Received:   doc.Customer.Name,
+		Rule:       "customer_name_mismatch",
+		Message:    fmt.Sprintf("Customer name differs from the name registered in the SUNAT padron (similarity %.2f)", similarity),
+		Suggestion: fmt.Sprintf("Use the registered name: %s", status.Name),
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	. "API-SUNAT2/model"
+)
+
+// UnknownFieldRule es la regla de los campos del request que el modelo no declara
+const UnknownFieldRule = "unknown_field"
+
+// UnknownFieldCode es el código de error de un request rechazado en modo estricto
+const UnknownFieldCode = "ERR_UNKNOWN_FIELD"
+
+// UnknownFields retorna los campos de un valor JSON decodificado que el schema no
+// declara, con su path. Los nombres se comparan de forma exacta: encoding/json acepta
+// "unitcode" por "unitCode", pero el integrador debe enterarse de que escribió otro nombre.
+func (s *JSONSchema) UnknownFields(value interface{}) []ValidationError {
+	var fields []ValidationError
+	s.unknownFields(value, "", &fields)
+	return fields
+}
+
+func (s *JSONSchema) unknownFields(value interface{}, path string, fields *[]ValidationError) {
+	if s.relative {
+		path = ""
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// Los mapas del modelo no tienen propiedades declaradas: aceptan cualquier clave
+		if s.Properties == nil {
+			return
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if child, ok := s.Properties[name]; ok {
+				child.unknownFields(v[name], joinPath(path, name), fields)
+				continue
+			}
+			*fields = append(*fields, s.unknownField(joinPath(path, name), name))
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.unknownFields(item, fmt.Sprintf("%s[%d]", path, i), fields)
+			}
+		}
+	}
+}
+
+// unknownField arma el error de un campo desconocido; si difiere de un campo declarado
+// solo en mayúsculas, se indica el nombre correcto
+func (s *JSONSchema) unknownField(path, name string) ValidationError {
+	for declared := range s.Properties {
+		if strings.EqualFold(declared, name) {
+			return ValidationError{
+				Field:    path,
+				Expected: declared,
+				Received: name,
+				Rule:     UnknownFieldRule,
+				Message:  fmt.Sprintf("Field name differs from %s only in case", declared),
+			}
+		}
+	}
+	return ValidationError{
+		Field:    path,
+		Expected: "Field declared in the document schema",
+		Received: name,
+		Rule:     UnknownFieldRule,
+		Message:  "Field is not declared in the document schema",
+	}
+}
+
+// DecodeRequest reemplaza a ShouldBindJSON: valida el cuerpo contra el schema y lo
+// decodifica en target. En modo estricto un campo que el schema no declara rechaza el
+// request con ERR_UNKNOWN_FIELD; si no, el campo se ignora y se retorna como warning.
+// Los documentos se completan con la plantilla del emisor antes de decodificarse.
+// Retorna la respuesta de error si el request no se puede procesar.
+func (s *UBLConverterService) DecodeRequest(schema *JSONSchema, body []byte, target interface{}, strict bool) ([]ValidationError, *APIResponse) {
+	var ignored []ValidationError
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		ignored = schema.UnknownFields(value)
+	}
+
+	// En modo estricto el campo desconocido suele ser la causa de los errores de
+	// estructura (un "unitcode" deja unitCode vacío), por eso se reporta primero
+	if strict && len(ignored) > 0 {
+		return nil, unknownFieldsResponse(ignored)
+	}
+	// La plantilla del emisor completa los campos ausentes antes de verificar los requeridos
+	body, templateFields := s.applyDocumentTemplate(body, target)
+	if failure := s.CheckStructure(schema, body); failure != nil {
+		failure.Warnings = append(failure.Warnings, ignored...)
+		return nil, failure
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(target); err != nil {
+		code := "ERR_INVALID_REQUEST"
+		// Campo que el schema no describe (p. ej. dentro de un mapa) y el struct no acepta
+		if strings.HasPrefix(err.Error(), "json: unknown field") {
+			code = UnknownFieldCode
+		}
+		return nil, &APIResponse{
+			Status:       "error",
+			ErrorCode:    code,
+			ErrorMessage: fmt.Sprintf("Invalid request format: %v", err),
+			ProcessedAt:  time.Now(),
+		}
+	}
+	switch v := target.(type) {
+	case *BusinessDocument:
+		v.TemplateFields = templateFields
+	case *ConvertRequest:
+		v.Document.TemplateFields = templateFields
+	}
+	return ignored, nil
+}
+
+func unknownFieldsResponse(fields []ValidationError) *APIResponse {
+	return &APIResponse{
+		Status:           "error",
+		ErrorCode:        UnknownFieldCode,
+		ErrorMessage:     fmt.Sprintf("Unknown field %q at %s", fields[0].Received, fields[0].Field),
+		ValidationErrors: fields,
+		ProcessedAt:      time.Now(),
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+
+	. "API-SUNAT2/model"
+)
+
+// Políticas de tratamiento de whitespace en las descripciones de ítems
+const (
+	// DescriptionPreserve conserva saltos de línea y tabulaciones y emite el texto en CDATA
+	DescriptionPreserve = "preserve"
+	// DescriptionCollapse reemplaza cada secuencia de whitespace por un espacio
+	DescriptionCollapse = "collapse"
+	// DescriptionStrip elimina saltos de línea y tabulaciones
+	DescriptionStrip = "strip"
+)
+
+// MaxItemDescriptionLength es la longitud máxima de cbc:Description de un ítem
+const MaxItemDescriptionLength = 500
+
+var whitespaceRun = regexp.MustCompile(`\s+`)
+
+// NormalizeDescription aplica la política de whitespace a una descripción
+func NormalizeDescription(text, policy string) string {
+	switch policy {
+	case DescriptionCollapse:
+		return strings.TrimSpace(whitespaceRun.ReplaceAllString(text, " "))
+	case DescriptionStrip:
+		return strings.TrimSpace(strings.NewReplacer("\r", "", "\n", "", "\t", "").Replace(text))
+	default:
+		// El parser XML normaliza CRLF a LF incluso dentro de CDATA; hacerlo aquí
+		// evita que el digest de la firma dependa del fin de línea del cliente
+		return strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+	}
+}
+
+func isValidDescriptionPolicy(policy string) bool {
+	return policy == DescriptionPreserve || policy == DescriptionCollapse || policy == DescriptionStrip
+}
+
+// NormalizeDescriptions aplica la política configurada a las descripciones de los
+// ítems. Se ejecuta antes de validar para que la longitud se mida sobre el texto final.
+func (s *UBLConverterService) NormalizeDescriptions(doc *BusinessDocument) {
+	for i := range doc.Items {
+		doc.Items[i].Description = NormalizeDescription(doc.Items[i].Description, s.descriptionPolicy)
+	}
+}
+
+// newItemDescription emite en CDATA las descripciones que conservan saltos de línea
+func newItemDescription(text string) UBLText {
+	return UBLText{
+		Value: text,
+		CDATA: strings.ContainsAny(text, "\n\t"),
+	}
+}
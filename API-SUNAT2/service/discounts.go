@@ -0,0 +1,249 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// Códigos del catálogo 53 de los descuentos que afectan la base imponible
+const (
+	// LineDiscountReasonCode es el descuento de una línea
+	LineDiscountReasonCode = "00"
+	// GlobalDiscountReasonCode es el descuento global que afecta la base imponible del IGV
+	GlobalDiscountReasonCode = "02"
+)
+
+// SetConvertNegativeLines indica si las líneas con cantidad o precio negativo se
+// convierten en descuentos cuando el request no indica convertNegativeLines
+func (s *UBLConverterService) SetConvertNegativeLines(enabled bool) {
+	s.convertNegativeLines = enabled
+}
+
+// ConvertsNegativeLines indica si las líneas negativas del documento se convierten en
+// descuentos: convertNegativeLines del request decide y, sin indicarlo, la configuración
+func (s *UBLConverterService) ConvertsNegativeLines(doc *BusinessDocument) bool {
+	if doc.ConvertNegativeLines != nil {
+		return *doc.ConvertNegativeLines
+	}
+	return s.convertNegativeLines
+}
+
+// isNegativeLine indica una "línea de descuento" de un ERP: cantidad o precio negativo
+func isNegativeLine(item DocumentItem) bool {
+	return !item.Informative && (item.Quantity < 0 || item.UnitPrice < 0)
+}
+
+// discountsAllowed indica si el tipo de documento admite descuentos
+func discountsAllowed(doc *BusinessDocument) bool {
+	return doc.Type == "01" || doc.Type == "03"
+}
+
+// convertNegativeLines reemplaza las líneas negativas por el descuento equivalente. Si
+// la línea repite el id de una línea positiva es un descuento de esa línea, que rebaja
+// su valor y sus tributos; si no, y está gravada con IGV, es un descuento global. Los
+// totales y tributos del documento ya vienen netos, así que no cambian. Las líneas sin
+// equivalente se conservan para que el validador las rechace.
+func convertNegativeLines(doc *BusinessDocument) []ConvertedNegativeLine {
+	if !discountsAllowed(doc) {
+		return nil
+	}
+	var converted []ConvertedNegativeLine
+	removed := make(map[int]bool)
+	for i, item := range doc.Items {
+		if !isNegativeLine(item) {
+			continue
+		}
+		amount := math.Abs(float64(item.LineTotal))
+		if amount == 0 {
+			amount = math.Abs(float64(item.Quantity * item.UnitPrice))
+		}
+		conversion := ConvertedNegativeLine{Field: fmt.Sprintf("items[%d]", i), Description: item.Description, Amount: Decimal2(amount).Round()}
+		if target := lineDiscountTarget(doc.Items, i); target >= 0 && applyLineDiscount(&doc.Items[target], item, amount) {
+			conversion.Target, conversion.ItemID = NegativeLineToLine, doc.Items[target].ID
+		} else if isTaxedLine(item) {
+			doc.GlobalDiscount = FlexFloat(Decimal2(float64(doc.GlobalDiscount) + amount).Round())
+			conversion.Target = NegativeLineToGlobal
+		} else {
+			continue
+		}
+		converted = append(converted, conversion)
+		removed[i] = true
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	items := make([]DocumentItem, 0, len(doc.Items)-len(removed))
+	for i, item := range doc.Items {
+		if !removed[i] {
+			items = append(items, item)
+		}
+	}
+	doc.Items = items
+	return converted
+}
+
+// lineDiscountTarget retorna la línea positiva con el mismo id que la línea negativa i,
+// -1 si no hay
+func lineDiscountTarget(items []DocumentItem, i int) int {
+	if items[i].ID == "" {
+		return -1
+	}
+	for j, item := range items {
+		if j != i && item.ID == items[i].ID && !isNegativeLine(item) && !item.Informative && !isFreeLine(item) {
+			return j
+		}
+	}
+	return -1
+}
+
+// applyLineDiscount rebaja la línea con el monto de la línea negativa; no la modifica si
+// el descuento supera su valor o la línea negativa tiene un tributo que ella no tiene
+func applyLineDiscount(target *DocumentItem, negative DocumentItem, amount float64) bool {
+	if amount >= float64(target.Quantity*target.UnitPrice-target.Discount) {
+		return false
+	}
+	indexes := make([]int, len(negative.Taxes))
+	for k, tax := range negative.Taxes {
+		indexes[k] = -1
+		for t := range target.Taxes {
+			if target.Taxes[t].TaxType == tax.TaxType {
+				indexes[k] = t
+			}
+		}
+		if indexes[k] < 0 {
+			return false
+		}
+	}
+	target.Discount = FlexFloat(Decimal2(float64(target.Discount) + amount).Round())
+	target.LineTotal = FlexFloat(Decimal2(float64(target.LineTotal) - amount).Round())
+	for k, tax := range negative.Taxes {
+		targetTax := &target.Taxes[indexes[k]]
+		base := math.Abs(float64(tax.TaxBase))
+		if base == 0 {
+			base = amount
+		}
+		targetTax.TaxBase = FlexFloat(Decimal2(float64(targetTax.TaxBase) - base).Round())
+		targetTax.TaxAmount = FlexFloat(Decimal2(float64(targetTax.TaxAmount) - math.Abs(float64(tax.TaxAmount))).Round())
+	}
+	return true
+}
+
+// isTaxedLine indica una línea gravada solo con IGV
+func isTaxedLine(item DocumentItem) bool {
+	if len(item.Taxes) == 0 {
+		return false
+	}
+	for _, tax := range item.Taxes {
+		if tax.TaxType != "1000" {
+			return false
+		}
+	}
+	return true
+}
+
+// taxedLinesBase es el valor de las líneas gravadas con IGV, base del descuento global
+func taxedLinesBase(doc *BusinessDocument) float64 {
+	base := 0.0
+	for _, line := range documentLines(doc) {
+		if isFreeLine(line.Item) {
+			continue
+		}
+		for _, tax := range line.Item.Taxes {
+			if tax.TaxType == "1000" {
+				base += float64(line.Item.LineTotal)
+				break
+			}
+		}
+	}
+	return base
+}
+
+// discountAllowanceCharge arma el descuento del catálogo 53 sobre base
+func discountAllowanceCharge(code string, amount, base float64, currency string) UBLAllowanceCharge {
+	factor := 0.0
+	if base > 0 {
+		factor = math.Round(amount/base*100000) / 100000
+	}
+	return UBLAllowanceCharge{
+		ChargeIndicator:           false,
+		AllowanceChargeReasonCode: catalogAttr(code, catalog.AllowanceCharge),
+		MultiplierFactorNumeric:   factor,
+		Amount:                    UBLAmountWithCurrency{CurrencyID: currency, Value: amount},
+		BaseAmount:                UBLAmountWithCurrency{CurrencyID: currency, Value: base},
+	}
+}
+
+// lineDiscount emite el descuento de la línea sobre cantidad × precio
+func lineDiscount(item DocumentItem, currency string) []UBLAllowanceCharge {
+	if item.Discount <= 0 {
+		return nil
+	}
+	base := Decimal2(float64(item.Quantity * item.UnitPrice)).Round()
+	return []UBLAllowanceCharge{discountAllowanceCharge(LineDiscountReasonCode, float64(item.Discount), base, currency)}
+}
+
+// applyGlobalDiscount agrega el descuento global sobre el valor de las líneas gravadas
+func (c *UBLConverter) applyGlobalDiscount(invoice *UBLInvoice, doc *BusinessDocument) {
+	if doc.GlobalDiscount <= 0 {
+		return
+	}
+	base := Decimal2(taxedLinesBase(doc)).Round()
+	invoice.AllowanceCharge = append(invoice.AllowanceCharge, discountAllowanceCharge(GlobalDiscountReasonCode, float64(doc.GlobalDiscount), base, doc.Currency))
+}
+
+// validateDiscounts valida que los descuentos sean positivos, de facturas o boletas y
+// menores que el valor sobre el que se aplican
+func (v *ValidationService) validateDiscounts(doc *BusinessDocument) []ValidationError {
+	var errors []ValidationError
+	discountError := func(field, expected string, received float64, message string) {
+		errors = append(errors, ValidationError{
+			Field:    field,
+			Expected: expected,
+			Received: fmt.Sprintf("%.2f", received),
+			Rule:     "discount_validation",
+			Message:  message,
+		})
+	}
+	for i, item := range doc.Items {
+		if item.Discount == 0 {
+			continue
+		}
+		field := fmt.Sprintf("items[%d].discount", i)
+		switch {
+		case !discountsAllowed(doc):
+			discountError(field, "Document type 01 or 03", float64(item.Discount), "Discounts are only supported on invoices and boletas")
+		case item.Discount < 0:
+			discountError(field, "Greater than 0", float64(item.Discount), "Discount must be positive")
+		case item.Discount >= item.Quantity*item.UnitPrice:
+			discountError(field, fmt.Sprintf("Less than %.2f", item.Quantity*item.UnitPrice), float64(item.Discount), "Discount must be less than quantity × unit price")
+		}
+	}
+	if doc.GlobalDiscount == 0 {
+		return errors
+	}
+	base := taxedLinesBase(doc)
+	switch {
+	case !discountsAllowed(doc):
+		discountError("globalDiscount", "Document type 01 or 03", float64(doc.GlobalDiscount), "Discounts are only supported on invoices and boletas")
+	case doc.GlobalDiscount < 0:
+		discountError("globalDiscount", "Greater than 0", float64(doc.GlobalDiscount), "Discount must be positive")
+	case float64(doc.GlobalDiscount) >= base:
+		discountError("globalDiscount", fmt.Sprintf("Less than %.2f", base), float64(doc.GlobalDiscount), "Global discount must be less than the value of the IGV taxed lines")
+	}
+	return errors
+}
+
+// negativeLineError rechaza una línea con cantidad o precio negativo sugiriendo el descuento
+func negativeLineError(i int, item DocumentItem) ValidationError {
+	return ValidationError{
+		Field:      fmt.Sprintf("items[%d]", i),
+		Expected:   "Non-negative quantity and unit price",
+		Received:   fmt.Sprintf("quantity %.2f, unit price %.2f", item.Quantity, item.UnitPrice),
+		Rule:       "negative_line_validation",
+		Message:    "Negative lines are not accepted by SUNAT; send the amount as a discount",
+		Suggestion: "Use items[].discount on the discounted line or globalDiscount, or send convertNegativeLines: true",
+	}
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	. "API-SUNAT2/model"
+)
+
+// ErrEndOfDayRunning indica que ya hay un cierre diario en curso
+var ErrEndOfDayRunning = errors.New("end-of-day close already running")
+
+// LimaLocation es la zona horaria del cierre diario. Perú no tiene horario de verano:
+// si el sistema no trae la base de zonas horarias se usa UTC-5 fijo.
+var LimaLocation = loadLimaLocation()
+
+func loadLimaLocation() *time.Location {
+	if location, err := time.LoadLocation("America/Lima"); err == nil {
+		return location
+	}
+	return time.FixedZone("PET", -5*60*60)
+}
+
+// EndOfDayNotifier envía la alerta de un cierre diario con pendientes
+type EndOfDayNotifier interface {
+	NotifyEndOfDay(ctx context.Context, report *EndOfDayReport) error
+}
+
+// endOfDayMonitor agrupa la configuración de las alertas del cierre diario
+type endOfDayMonitor struct {
+	mu sync.Mutex
+	// running impide que dos cierres se solapen
+	running   sync.Mutex
+	notifiers []EndOfDayNotifier
+	// threshold es la cantidad de pendientes tolerada sin alertar
+	threshold int
+}
+
+// SetEndOfDayAlerts configura los destinos de la alerta del cierre diario, que se envía
+// cuando los pendientes superan threshold
+func (s *UBLConverterService) SetEndOfDayAlerts(threshold int, notifiers ...EndOfDayNotifier) {
+	s.endOfDay.mu.Lock()
+	defer s.endOfDay.mu.Unlock()
+	s.endOfDay.threshold = threshold
+	s.endOfDay.notifiers = notifiers
+}
+
+// ParseEndOfDayTime interpreta la hora del cierre diario en formato HH:MM
+func ParseEndOfDayTime(value string) (hour, minute int, err error) {
+	at, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid end-of-day time %q, expected HH:MM", value)
+	}
+	return at.Hour(), at.Minute(), nil
+}
+
+// nextEndOfDayRun retorna la próxima hora:minuto de Lima posterior a now
+func nextEndOfDayRun(now time.Time, hour, minute int) time.Time {
+	local := now.In(LimaLocation)
+	next := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, LimaLocation)
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// EndOfDayReport revisa los comprobantes del emisor (todos si ruc es vacío) emitidos en
+// date (YYYY-MM-DD; vacío es el día de hoy en Lima) y lista por emisor los que no fueron
+// enviados a SUNAT ni anulados, con el motivo del estancamiento. Las boletas y sus notas
+// cuentan como enviadas cuando un resumen diario enviado las informa. Los documentos de
+// prueba solo se revisan con includeTest; si no, se cuentan en TestExcluded.
+func (s *UBLConverterService) EndOfDayReport(ruc, date string, includeTest bool) (*EndOfDayReport, error) {
+	if date == "" {
+		date = s.clock.Now().In(LimaLocation).Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return nil, &ErrInvalidReportRange{Message: fmt.Sprintf("invalid date %q, expected YYYY-MM-DD", date)}
+	}
+
+	var records []DocumentRecord
+	testExcluded := 0
+	err := s.readJSONRecords(RecordSuffix, func(name string, data []byte) error {
+		var record DocumentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			s.GetLogger().Warnf("Registro de documento ilegible en %s: %v", name, err)
+			return nil
+		}
+		if record.IssueDate != date || (ruc != "" && record.IssuerRUC != ruc) {
+			return nil
+		}
+		if !includeTest && s.isTestRecord(&record) {
+			testExcluded++
+			return nil
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := s.summariesByDocument()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &EndOfDayReport{Date: date, RUC: ruc, GeneratedAt: s.clock.Now(), TestExcluded: testExcluded, Issuers: []EndOfDayIssuer{}}
+	issuers := map[string]*EndOfDayIssuer{}
+	issued := map[string]int{}
+	for i := range records {
+		record := &records[i]
+		report.Issued++
+		issued[record.IssuerRUC]++
+
+		history, err := s.readStatusHistory(record.DocumentID)
+		if err != nil {
+			return nil, err
+		}
+		last := StatusChange{Status: DocumentGenerated, At: record.CreatedAt}
+		if len(history) > 0 {
+			last = history[len(history)-1]
+		}
+
+		outcome, reason := endOfDayOutcome(record, last, summaries[record.DocumentID])
+		switch outcome {
+		case endOfDaySent:
+			report.Sent++
+			continue
+		case endOfDayExplained:
+			report.Explained++
+			continue
+		}
+
+		report.Pending++
+		issuer, ok := issuers[record.IssuerRUC]
+		if !ok {
+			issuer = &EndOfDayIssuer{IssuerRUC: record.IssuerRUC}
+			issuers[record.IssuerRUC] = issuer
+		}
+		issuer.Pending++
+		issuer.Documents = append(issuer.Documents, EndOfDayPending{
+			DocumentID:   record.DocumentID,
+			DocumentType: record.DocumentType,
+			Series:       record.Series,
+			Number:       record.Number,
+			Status:       last.Status,
+			Reason:       reason,
+			Since:        last.At,
+		})
+	}
+
+	for issuerRUC, issuer := range issuers {
+		issuer.Issued = issued[issuerRUC]
+		sort.Slice(issuer.Documents, func(i, j int) bool {
+			return issuer.Documents[i].DocumentID < issuer.Documents[j].DocumentID
+		})
+		report.Issuers = append(report.Issuers, *issuer)
+	}
+	sort.Slice(report.Issuers, func(i, j int) bool {
+		return report.Issuers[i].IssuerRUC < report.Issuers[j].IssuerRUC
+	})
+	return report, nil
+}
+
+// Resultado de un comprobante en el cierre diario
+const (
+	endOfDaySent = iota
+	endOfDayExplained
+	endOfDayPending
+)
+
+// endOfDayOutcome clasifica un comprobante según su último estado o, si se informa por
+// resumen diario, según los resúmenes que lo incluyen
+func endOfDayOutcome(record *DocumentRecord, last StatusChange, summaries []SummaryRecord) (int, string) {
+	switch last.Status {
+	case DocumentVoided, DocumentPurged:
+		return endOfDayExplained, ""
+	case SubmissionSent, CDRAccepted, CDRObserved, CDRRejected:
+		return endOfDaySent, ""
+	case SubmissionFailed:
+		return endOfDayPending, "Submission failed: " + last.Detail
+	case SubmissionResend:
+		return endOfDayPending, "SUNAT has no record of the submission, it must be resent"
+	}
+
+	if !isSummarizedDocument(record) {
+		return endOfDayPending, "Not sent to SUNAT"
+	}
+	reason := "Not included in a daily summary"
+	for _, summary := range summaries {
+		switch summary.Status {
+		case SummaryInProcess, CDRAccepted, CDRObserved:
+			return endOfDaySent, ""
+		case SummaryGenerated:
+			reason = fmt.Sprintf("Included in summary %s, which was not sent", summary.SummaryID)
+		case CDRRejected:
+			reason = fmt.Sprintf("Summary %s was rejected by SUNAT", summary.SummaryID)
+		}
+	}
+	return endOfDayPending, reason
+}
+
+// summariesByDocument retorna los resúmenes diarios que informan cada comprobante
+func (s *UBLConverterService) summariesByDocument() (map[string][]SummaryRecord, error) {
+	summaries := map[string][]SummaryRecord{}
+	err := s.readJSONRecords(SummarySuffix, func(name string, data []byte) error {
+		var summary SummaryRecord
+		if err := json.Unmarshal(data, &summary); err != nil {
+			return fmt.Errorf("invalid summary record %s: %v", name, err)
+		}
+		for _, line := range summary.Lines {
+			if line.Status == SummaryStatusAdd {
+				summaries[line.DocumentID] = append(summaries[line.DocumentID], summary)
+			}
+		}
+		return nil
+	})
+	return summaries, err
+}
+
+// CloseDay ejecuta el cierre de date para todos los emisores: registra los pendientes
+// y, si superan el umbral configurado, notifica a los destinos de alerta. Solo puede
+// haber un cierre a la vez.
+func (s *UBLConverterService) CloseDay(ctx context.Context, date string) (*EndOfDayReport, error) {
+	if !s.endOfDay.running.TryLock() {
+		return nil, ErrEndOfDayRunning
+	}
+	defer s.endOfDay.running.Unlock()
+
+	report, err := s.EndOfDayReport("", date, false)
+	if err != nil {
+		return nil, err
+	}
+	if report.Pending == 0 {
+		s.GetLogger().Infof("Cierre del %s: %d comprobantes emitidos, todos enviados o anulados", report.Date, report.Issued)
+		return report, nil
+	}
+	s.GetLogger().Warnf("Cierre del %s: %d de %d comprobantes pendientes de envío", report.Date, report.Pending, report.Issued)
+
+	s.endOfDay.mu.Lock()
+	notifiers, threshold := s.endOfDay.notifiers, s.endOfDay.threshold
+	s.endOfDay.mu.Unlock()
+	if report.Pending <= threshold {
+		return report, nil
+	}
+	for _, notifier := range notifiers {
+		if err := notifier.NotifyEndOfDay(ctx, report); err != nil {
+			s.GetLogger().Errorf("No se pudo notificar el cierre del %s: %v", report.Date, err)
+		}
+	}
+	return report, nil
+}
+
+// StartEndOfDayJob ejecuta el cierre diario todos los días a hour:minute de Lima, sobre
+// los comprobantes emitidos ese día, hasta que se llame a la función retornada
+func (s *UBLConverterService) StartEndOfDayJob(hour, minute int) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			now := s.clock.Now()
+			next := nextEndOfDayRun(now, hour, minute)
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			ctx, cancel := s.JobContext()
+			_, err := s.CloseDay(ctx, next.Format("2006-01-02"))
+			cancel()
+			if err != nil && err != ErrEndOfDayRunning {
+				s.GetLogger().Errorf("Cierre diario falló: %v", err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+	"API-SUNAT2/version"
+)
+
+// UnknownEngineVersion agrupa en los reportes los documentos sin versión registrada
+const UnknownEngineVersion = "unknown"
+
+// VersionInfo es la respuesta de GET /api/v1/version
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	RulesHash string `json:"rulesHash"`
+	// Catalogs es la versión (hash del contenido) de cada catálogo cargado
+	Catalogs map[string]string `json:"catalogs"`
+	// CatalogVersion es la versión del conjunto de listas de códigos activo y
+	// CatalogLists el detalle de cada lista: versión, vigencia y si es embebida u override
+	CatalogVersion string                `json:"catalogVersion"`
+	CatalogLists   []catalog.ListVersion `json:"catalogLists"`
+}
+
+// EngineVersionCount es la cantidad de documentos generados con una versión y reglas
+type EngineVersionCount struct {
+	EngineVersion
+	Documents int `json:"documents"`
+}
+
+// EngineVersionReport es el reporte de documentos por versión del convertidor
+type EngineVersionReport struct {
+	Versions []EngineVersionCount `json:"versions"`
+	// Documents son los documentos de la versión filtrada, vacío sin filtro
+	Documents []string `json:"documents,omitempty"`
+}
+
+// catalogCodes retorna los códigos activos de un catálogo y, en el 07 y el 09, el
+// tratamiento de cada tipo de afectación y la regla de montos de cada motivo, para que
+// cambiar un motivo o un medio de pago cambie la versión del catálogo
+func (s *UBLConverterService) catalogCodes(id string) interface{} {
+	codes := catalog.Codes(id)
+	rules := map[string]string{}
+	switch id {
+	case catalog.IGVAffectation:
+		for code, affectation := range igvAffectations {
+			rules[code] = fmt.Sprint(affectation)
+		}
+	case catalog.CreditNoteReason:
+		rules = creditNoteRules
+	default:
+		return codes
+	}
+	return struct {
+		Codes []catalog.Code
+		Rules map[string]string
+	}{codes, rules}
+}
+
+// CatalogVersions retorna la versión de cada catálogo cargado: los primeros 12
+// caracteres del SHA-256 de sus atributos, sus códigos y, en "igv", la tabla de tasas
+func (s *UBLConverterService) CatalogVersions() map[string]string {
+	versions := make(map[string]string)
+	for _, c := range catalog.All() {
+		versions[c.ID] = shortHash(struct {
+			Catalog catalog.Catalog
+			Codes   interface{}
+		}{c, s.catalogCodes(c.ID)})
+	}
+	versions["igv"] = shortHash(s.validator.igvRates)
+	return versions
+}
+
+// RulesHash retorna el hash de los catálogos y de las opciones que cambian el XML o la
+// validación; dos documentos con el mismo hash se generaron con las mismas reglas
+func (s *UBLConverterService) RulesHash() string {
+	options := map[string]interface{}{
+		"igvRateCheck":         s.validator.igvRateCheck,
+		"issueDateCheck":       s.validator.issueDateCheck,
+		"noteMaxDays":          s.validator.noteMaxDays,
+		"maxObservations":      s.validator.maxObservations,
+		"maxObservationLength": s.validator.maxObservationLength,
+		"descriptionPolicy":    s.descriptionPolicy,
+		"mojibakeMode":         s.mojibakeMode,
+		"xmlEncoding":          s.xmlEncoding,
+	}
+	if converter, ok := s.converter.(*UBLConverter); ok {
+		options["amountWordsAccents"] = converter.amountWordsAccents
+		options["catalogURIs"] = !converter.omitCatalogURIs
+		options["idReferenceIssuers"] = converter.idReferenceIssuers
+		options["pricingReferenceOmitIssuers"] = converter.omitPricingReferenceIssuers
+	}
+	data, _ := json.Marshal(map[string]interface{}{"catalogs": s.CatalogVersions(), "options": options})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// EngineVersion retorna la versión del binario, el hash de las reglas activas y la
+// versión de las listas de códigos
+func (s *UBLConverterService) EngineVersion() EngineVersion {
+	return EngineVersion{Version: version.Version, Commit: version.Commit, RulesHash: s.RulesHash(), CatalogVersion: catalog.Version()}
+}
+
+// VersionInfo retorna la versión del binario, su fecha de build y las versiones de los
+// catálogos cargados
+func (s *UBLConverterService) VersionInfo() VersionInfo {
+	return VersionInfo{
+		Version:        version.Version,
+		Commit:         version.Commit,
+		BuildDate:      version.BuildDate,
+		RulesHash:      s.RulesHash(),
+		Catalogs:       s.CatalogVersions(),
+		CatalogVersion: catalog.Version(),
+		CatalogLists:   catalog.Versions(),
+	}
+}
+
+// shortHash retorna los primeros 12 caracteres del SHA-256 del valor en JSON; los mapas
+// se serializan con las claves ordenadas
+func shortHash(value interface{}) string {
+	data, _ := json.Marshal(value)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// engineVersionOf retorna la versión del convertidor del registro, o
+// UnknownEngineVersion si no la tiene
+func engineVersionOf(record *DocumentRecord) EngineVersion {
+	if record.Engine == nil {
+		return EngineVersion{Version: UnknownEngineVersion}
+	}
+	return *record.Engine
+}
+
+// EngineVersionReport cuenta los documentos del store por versión del convertidor y
+// hash de reglas, para el emisor (todos si ruc es vacío). Con engineVersion o rulesHash
+// se cuentan solo los documentos que coinciden y se listan.
+func (s *UBLConverterService) EngineVersionReport(ruc, engineVersion, rulesHash string) (*EngineVersionReport, error) {
+	counts := make(map[EngineVersion]int)
+	report := &EngineVersionReport{Versions: []EngineVersionCount{}}
+	err := s.readJSONRecords(RecordSuffix, func(name string, data []byte) error {
+		var record DocumentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("invalid document record %s: %v", name, err)
+		}
+		engine := engineVersionOf(&record)
+		if (ruc != "" && record.IssuerRUC != ruc) || (engineVersion != "" && engine.Version != engineVersion) ||
+			(rulesHash != "" && engine.RulesHash != rulesHash) {
+			return nil
+		}
+		counts[engine]++
+		if engineVersion != "" || rulesHash != "" {
+			report.Documents = append(report.Documents, record.DocumentID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for engine, count := range counts {
+		report.Versions = append(report.Versions, EngineVersionCount{EngineVersion: engine, Documents: count})
+	}
+	sort.Slice(report.Versions, func(i, j int) bool {
+		a, b := report.Versions[i], report.Versions[j]
+		if a.Documents != b.Documents {
+			return a.Documents > b.Documents
+		}
+		return a.Version+a.RulesHash < b.Version+b.RulesHash
+	})
+	sort.Strings(report.Documents)
+	return report, nil
+}
+
+// FilterSubmissionsByEngine retorna los envíos cuyos documentos se generaron con la
+// versión del convertidor indicada
+func (s *UBLConverterService) FilterSubmissionsByEngine(records []SubmissionRecord, engineVersion string) []SubmissionRecord {
+	filtered := []SubmissionRecord{}
+	versions := make(map[string]string)
+	for _, submission := range records {
+		documentVersion, ok := versions[submission.DocumentID]
+		if !ok {
+			documentVersion = UnknownEngineVersion
+			if data, err := s.store.Read(RecordName(submission.DocumentID)); err == nil {
+				var record DocumentRecord
+				if json.Unmarshal(data, &record) == nil {
+					documentVersion = engineVersionOf(&record).Version
+				}
+			}
+			versions[submission.DocumentID] = documentVersion
+		}
+		if documentVersion == engineVersion {
+			filtered = append(filtered, submission)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,525 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+	"API-SUNAT2/util/httpclient"
+)
+
+// EventPublisher publica los eventos de documentos en un bus de mensajes. Cada driver
+// (Kafka, NATS...) implementa esta interfaz.
+type EventPublisher interface {
+	Publish(ctx context.Context, event DocumentEvent) error
+}
+
+// Valores por defecto de la publicación de eventos
+const (
+	DefaultEventBufferSize     = 1000
+	DefaultEventPublishTimeout = 10 * time.Second
+)
+
+// eventDispatcher publica los eventos en segundo plano y en orden. Los eventos esperan
+// en un buffer; si está lleno (broker caído o lento) se descartan en lugar de bloquear
+// el pipeline. Implementa Queue para consultarla, pausarla y drenarla.
+type eventDispatcher struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	clock    Clock
+	pending  []queuedEvent
+	capacity int
+	inFlight *queuedEvent
+	closed   bool
+	paused   bool
+	// draining son los Drain en curso: mientras haya alguno se procesa aunque esté pausada
+	draining  int
+	processed processedWindow
+	// Contadores de eventos publicados y descartados por buffer lleno o por error al publicar
+	published     int64
+	droppedFull   int64
+	droppedFailed int64
+}
+
+// queuedEvent es un evento en el buffer con el momento en que se encoló
+type queuedEvent struct {
+	event      DocumentEvent
+	enqueuedAt time.Time
+}
+
+// StartEventPublisher publica con publisher los eventos de los documentos emitidos y de
+// sus cambios de estado. Hasta bufferSize eventos esperan en memoria. La función
+// retornada deja de aceptar eventos y espera a que se publiquen los pendientes.
+func (s *UBLConverterService) StartEventPublisher(publisher EventPublisher, bufferSize int) (stop func()) {
+	if bufferSize <= 0 {
+		bufferSize = DefaultEventBufferSize
+	}
+	dispatcher := &eventDispatcher{clock: s.clock, capacity: bufferSize}
+	dispatcher.cond = sync.NewCond(&dispatcher.mu)
+	s.events = dispatcher
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			item, ok := dispatcher.next()
+			if !ok {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultEventPublishTimeout)
+			err := publisher.Publish(ctx, item.event)
+			cancel()
+			dispatcher.finish()
+			if err != nil {
+				atomic.AddInt64(&dispatcher.droppedFailed, 1)
+				s.GetLogger().Warnf("No se pudo publicar el evento %s de %s: %v", item.event.Type, item.event.DocumentID, err)
+				continue
+			}
+			atomic.AddInt64(&dispatcher.published, 1)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			dispatcher.mu.Lock()
+			dispatcher.closed = true
+			dispatcher.cond.Broadcast()
+			dispatcher.mu.Unlock()
+			<-done
+		})
+	}
+}
+
+// enqueue agrega el evento al buffer sin bloquear
+func (d *eventDispatcher) enqueue(event DocumentEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	if len(d.pending) >= d.capacity {
+		atomic.AddInt64(&d.droppedFull, 1)
+		return
+	}
+	d.pending = append(d.pending, queuedEvent{event: event, enqueuedAt: d.clock.Now()})
+	d.cond.Broadcast()
+}
+
+// next espera el siguiente evento a publicar y lo marca en proceso. Al cerrar se
+// publican los pendientes aunque la cola esté pausada; ok es false cuando no quedan.
+func (d *eventDispatcher) next() (queuedEvent, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for !d.closed && (len(d.pending) == 0 || (d.paused && d.draining == 0)) {
+		d.cond.Wait()
+	}
+	if len(d.pending) == 0 {
+		return queuedEvent{}, false
+	}
+	item := d.pending[0]
+	d.pending = d.pending[1:]
+	d.inFlight = &item
+	return item, true
+}
+
+// finish registra que terminó la publicación del evento en proceso
+func (d *eventDispatcher) finish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inFlight = nil
+	d.processed.add(d.clock.Now())
+	d.cond.Broadcast()
+}
+
+func (d *eventDispatcher) Name() string {
+	return EventQueueName
+}
+
+func (d *eventDispatcher) Stats() QueueStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.clock.Now()
+	stats := QueueStats{
+		Name:                EventQueueName,
+		Depth:               len(d.pending),
+		Capacity:            d.capacity,
+		Paused:              d.paused,
+		ProcessedLastMinute: d.processed.count(now),
+	}
+	if d.inFlight != nil {
+		stats.InFlight = 1
+	}
+	if len(d.pending) > 0 {
+		stats.OldestAgeSeconds = now.Sub(d.pending[0].enqueuedAt).Seconds()
+	}
+	return stats
+}
+
+// Items retorna el evento en publicación y los pendientes. Un evento que no se pudo
+// publicar se descarta, por lo que ninguno tiene reintentos.
+func (d *eventDispatcher) Items(offset, limit int) []QueueItem {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	items := make([]QueueItem, 0, len(d.pending)+1)
+	if d.inFlight != nil {
+		item := eventQueueItem(*d.inFlight)
+		item.Attempts, item.InFlight = 1, true
+		items = append(items, item)
+	}
+	for _, pending := range d.pending {
+		items = append(items, eventQueueItem(pending))
+	}
+	return pageItems(items, offset, limit)
+}
+
+func eventQueueItem(queued queuedEvent) QueueItem {
+	return QueueItem{
+		ID:         queued.event.ID,
+		DocumentID: queued.event.DocumentID,
+		Kind:       queued.event.Type,
+		EnqueuedAt: queued.enqueuedAt,
+	}
+}
+
+func (d *eventDispatcher) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = true
+}
+
+func (d *eventDispatcher) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = false
+	d.cond.Broadcast()
+}
+
+func (d *eventDispatcher) Drain(ctx context.Context) error {
+	// Despertar la espera si se cancela ctx
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			d.mu.Lock()
+			d.cond.Broadcast()
+			d.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draining++
+	d.cond.Broadcast()
+	defer func() { d.draining-- }()
+	for len(d.pending) > 0 || d.inFlight != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d.cond.Wait()
+	}
+	return nil
+}
+
+// emitDocumentEvent arma el evento con el registro del documento en el store y lo
+// encola; sin publicador configurado no hace nada
+func (s *UBLConverterService) emitDocumentEvent(eventType, documentID string, change StatusChange) {
+	if s.events == nil {
+		return
+	}
+
+	event := DocumentEvent{
+		Version:     EventSchemaVersion,
+		ID:          GenerateCorrelationID(),
+		Type:        eventType,
+		OccurredAt:  change.At,
+		DocumentID:  documentID,
+		Status:      change.Status,
+		Environment: change.Environment,
+		Detail:      change.Detail,
+	}
+	if data, err := s.store.Read(RecordName(documentID)); err == nil {
+		var record DocumentRecord
+		if json.Unmarshal(data, &record) == nil {
+			event.IssuerRUC, event.DocumentType = record.IssuerRUC, record.DocumentType
+			event.Series, event.Number, event.IssueDate = record.Series, record.Number, record.IssueDate
+			event.Currency, event.TaxAmount, event.PayableAmount = record.Currency, record.TaxAmount, record.PayableAmount
+			event.XMLHash, event.ZIPHash = record.XMLHash, record.ZIPHash
+		}
+	}
+	s.events.enqueue(event)
+}
+
+// statusEventTypes es el evento que corresponde a cada estado del historial; los
+// estados que no están (REENVIAR, ERROR_ENVIO) no se publican
+var statusEventTypes = map[string]string{
+	SubmissionSent:   DocumentSentEvent,
+	CDRAccepted:      DocumentAcceptedEvent,
+	CDRObserved:      DocumentAcceptedEvent,
+	CDRRejected:      DocumentRejectedEvent,
+	DocumentVoided:   DocumentVoidedEvent,
+	DocumentReverted: DocumentRevertedEvent,
+}
+
+// WriteEventMetrics escribe en formato de texto de Prometheus los eventos publicados y
+// descartados
+func (s *UBLConverterService) WriteEventMetrics(w io.Writer) {
+	var published, full, failed int64
+	if s.events != nil {
+		published = atomic.LoadInt64(&s.events.published)
+		full = atomic.LoadInt64(&s.events.droppedFull)
+		failed = atomic.LoadInt64(&s.events.droppedFailed)
+	}
+	fmt.Fprintln(w, "# HELP document_events_published_total Eventos de documentos publicados en el bus de mensajes")
+	fmt.Fprintln(w, "# TYPE document_events_published_total counter")
+	fmt.Fprintf(w, "document_events_published_total %d\n", published)
+	fmt.Fprintln(w, "# HELP document_events_dropped_total Eventos de documentos descartados, por buffer lleno o por error al publicar")
+	fmt.Fprintln(w, "# TYPE document_events_dropped_total counter")
+	fmt.Fprintf(w, "document_events_dropped_total{reason=\"buffer_full\"} %d\n", full)
+	fmt.Fprintf(w, "document_events_dropped_total{reason=\"publish_failed\"} %d\n", failed)
+}
+
+// KafkaRESTPublisher publica los eventos en un topic de Kafka a través de un Kafka
+// REST Proxy: POST {broker}/topics/{topic}. Se prueba cada broker en orden.
+type KafkaRESTPublisher struct {
+	brokers []string
+	topic   string
+	client  *http.Client
+}
+
+// NewKafkaRESTPublisher crea el publicador; si client es nil se usa el del pool
+// compartido del proceso
+func NewKafkaRESTPublisher(brokers []string, topic string, client *http.Client) *KafkaRESTPublisher {
+	if client == nil {
+		client = httpclient.Default().Client(httpclient.DestinationEvents)
+	}
+	return &KafkaRESTPublisher{brokers: brokers, topic: topic, client: client}
+}
+
+func (p *KafkaRESTPublisher) Publish(ctx context.Context, event DocumentEvent) error {
+	// La clave del mensaje es el documento, para que sus eventos vayan a la misma partición
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{{"key": event.DocumentID, "value": event}},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = fmt.Errorf("no kafka brokers configured")
+	for _, broker := range p.brokers {
+		if err = p.publishTo(ctx, broker, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (p *KafkaRESTPublisher) publishTo(ctx context.Context, broker string, body []byte) error {
+	endpoint := strings.TrimSuffix(broker, "/") + "/topics/" + url.PathEscape(p.topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kafka rest proxy request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("kafka rest proxy returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// NATSOptions son las credenciales y el TLS de la conexión con NATS. Se envía el token
+// si está configurado y si no el usuario y la contraseña. Con TLS nil la conexión usa
+// TLS solo si el servidor lo exige o si la URL es tls://.
+type NATSOptions struct {
+	User     string
+	Password string
+	Token    string
+	TLS      *tls.Config
+}
+
+// NATSPublisher publica los eventos en un subject de NATS con el protocolo de texto del
+// servidor. La conexión se abre al primer evento y se reabre después de un error.
+type NATSPublisher struct {
+	servers []string
+	subject string
+	opts    NATSOptions
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNATSPublisher crea el publicador; servers son host:puerto, con o sin nats:// o tls://
+func NewNATSPublisher(servers []string, subject string, opts NATSOptions) *NATSPublisher {
+	return &NATSPublisher{servers: servers, subject: subject, opts: opts}
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event DocumentEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := p.publish(ctx, payload); err != nil {
+		p.conn.Close()
+		p.conn, p.reader = nil, nil
+		return err
+	}
+	return nil
+}
+
+// publish envía el mensaje seguido de un PING; el PONG confirma que el servidor lo recibió
+func (p *NATSPublisher) publish(ctx context.Context, payload []byte) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultEventPublishTimeout)
+	}
+	p.conn.SetDeadline(deadline)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "PUB %s %d\r\n", p.subject, len(payload))
+	msg.Write(payload)
+	msg.WriteString("\r\nPING\r\n")
+	if _, err := p.conn.Write(msg.Bytes()); err != nil {
+		return fmt.Errorf("nats publish failed: %v", err)
+	}
+
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("nats publish failed: %v", err)
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			p.conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// connect abre la conexión con el primer servidor disponible
+func (p *NATSPublisher) connect(ctx context.Context) error {
+	err := fmt.Errorf("no nats servers configured")
+	for _, server := range p.servers {
+		secure := strings.HasPrefix(server, "tls://")
+		address := strings.TrimPrefix(strings.TrimPrefix(server, "tls://"), "nats://")
+		var conn net.Conn
+		dialer := net.Dialer{Timeout: DefaultEventPublishTimeout}
+		if conn, err = dialer.DialContext(ctx, "tcp", address); err != nil {
+			continue
+		}
+		var reader *bufio.Reader
+		if conn, reader, err = p.handshake(ctx, conn, address, secure); err != nil {
+			conn.Close()
+			continue
+		}
+		p.conn, p.reader = conn, reader
+		return nil
+	}
+	return fmt.Errorf("nats connect failed: %v", err)
+}
+
+// natsInfo son los campos del INFO del servidor que usa el publicador
+type natsInfo struct {
+	TLSRequired  bool `json:"tls_required"`
+	TLSAvailable bool `json:"tls_available"`
+}
+
+// natsConnect es el CONNECT que envía el publicador
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	Name        string `json:"name"`
+	TLSRequired bool   `json:"tls_required"`
+	User        string `json:"user,omitempty"`
+	Password    string `json:"pass,omitempty"`
+	Token       string `json:"auth_token,omitempty"`
+}
+
+// handshake lee el INFO del servidor, pasa a TLS si corresponde y envía el CONNECT con
+// las credenciales; el PONG al PING siguiente confirma que el servidor las aceptó.
+// Retorna la conexión, que con TLS es la cifrada.
+func (p *NATSPublisher) handshake(ctx context.Context, conn net.Conn, address string, secure bool) (net.Conn, *bufio.Reader, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return conn, nil, err
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		return conn, nil, fmt.Errorf("unexpected nats greeting %q", strings.TrimSpace(line))
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "INFO"))), &info); err != nil {
+		return conn, nil, fmt.Errorf("invalid nats INFO: %v", err)
+	}
+
+	secure = secure || p.opts.TLS != nil || info.TLSRequired
+	if secure {
+		if !info.TLSRequired && !info.TLSAvailable {
+			return conn, nil, fmt.Errorf("nats server does not support TLS")
+		}
+		config := &tls.Config{MinVersion: tls.VersionTLS12}
+		if p.opts.TLS != nil {
+			config = p.opts.TLS.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return conn, nil, fmt.Errorf("nats TLS handshake failed: %v", err)
+		}
+		conn, reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	connect, _ := json.Marshal(natsConnect{Name: "api-sunat", TLSRequired: secure, User: p.opts.User, Password: p.opts.Password, Token: p.opts.Token})
+	if _, err := conn.Write([]byte("CONNECT " + string(connect) + "\r\nPING\r\n")); err != nil {
+		return conn, nil, err
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return conn, nil, err
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return conn, reader, nil
+		case strings.HasPrefix(line, "-ERR"):
+			return conn, nil, fmt.Errorf("nats server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// exchangedBaseName retorna el nombre base con el que se guardó una boleta del emisor
+func exchangedBaseName(doc *BusinessDocument, exchanged DocumentReference) string {
+	return fmt.Sprintf("%s-03-%s", doc.Issuer.DocumentID, exchanged.DocumentID)
+}
+
+// checkExchangedDocuments verifica contra el store que las boletas emitidas por este
+// servicio no hayan sido canjeadas antes y que sus totales cuadren con la factura
+func (s *UBLConverterService) checkExchangedDocuments(doc *BusinessDocument) []ValidationError {
+	var errors []ValidationError
+	if len(doc.ExchangedDocuments) == 0 {
+		return errors
+	}
+
+	allFound := true
+	exchangedTotal := 0.0
+	for i, exchanged := range doc.ExchangedDocuments {
+		baseName := exchangedBaseName(doc, exchanged)
+
+		if marker, err := s.store.Read(baseName + ".canje"); err == nil {
+			errors = append(errors, ValidationError{
+				Field:    fmt.Sprintf("exchangedDocuments[%d].documentId", i),
+				Expected: "Boleta not previously exchanged",
+				Received: exchanged.DocumentID,
+				Rule:     "exchange_already_used",
+				Message:  fmt.Sprintf("Boleta was already exchanged by invoice %s", string(marker)),
+			})
+		}
+
+		content, err := s.store.Read(baseName + ".xml")
+		if err != nil {
+			// Boleta no emitida por este servicio: no se puede cuadrar
+			allFound = false
+			continue
+		}
+		amount, err := readPayableAmount(content)
+		if err != nil {
+			allFound = false
+			continue
+		}
+		exchangedTotal += amount
+	}
+
+	if allFound && math.Abs(exchangedTotal-float64(doc.Totals.PayableAmount)) > 0.01 {
+		errors = append(errors, ValidationError{
+			Field:    "totals.payableAmount",
+			Expected: fmt.Sprintf("%.2f", exchangedTotal),
+			Received: fmt.Sprintf("%.2f", doc.Totals.PayableAmount),
+			Rule:     "exchange_totals_mismatch",
+			Message:  "Invoice payable amount does not match the exchanged boletas",
+		})
+	}
+
+	return errors
+}
+
+// markExchangedDocuments registra con save que las boletas fueron canjeadas
+func (s *UBLConverterService) markExchangedDocuments(doc *BusinessDocument, save func(name string, data []byte) (string, error)) error {
+	invoiceID := fmt.Sprintf("%s-%s", doc.Series, doc.Number)
+	for _, exchanged := range doc.ExchangedDocuments {
+		if _, err := save(exchangedBaseName(doc, exchanged)+".canje", []byte(invoiceID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPayableAmount extrae LegalMonetaryTotal/PayableAmount de un XML UBL
+func readPayableAmount(xmlData []byte) (float64, error) {
+	decoder := NewXMLDecoder(bytes.NewReader(xmlData))
+	inMonetaryTotal := false
+	inPayable := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name == CAC("LegalMonetaryTotal") {
+				inMonetaryTotal = true
+			}
+			inPayable = inMonetaryTotal && t.Name == CBC("PayableAmount")
+		case xml.CharData:
+			if inPayable {
+				return strconv.ParseFloat(strings.TrimSpace(string(t)), 64)
+			}
+		case xml.EndElement:
+			if t.Name == CAC("LegalMonetaryTotal") {
+				inMonetaryTotal = false
+			}
+			inPayable = false
+		}
+	}
+	return 0, fmt.Errorf("PayableAmount not found")
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	. "API-SUNAT2/model"
+)
+
+// FreeTaxType es el código de las operaciones gratuitas en el catálogo 05
+const FreeTaxType = "9996"
+
+// Leyenda de las transferencias gratuitas (catálogo 52)
+const (
+	FreeTransferLegendCode = "1002"
+	FreeTransferLegend     = "TRANSFERENCIA GRATUITA DE UN BIEN Y/O SERVICIO PRESTADO GRATUITAMENTE"
+)
+
+// isFreeLine indica si la línea es una transferencia gratuita: marcada como tal, con
+// el tributo 9996 o con un tipo de afectación gratuito
+func isFreeLine(item DocumentItem) bool {
+	if item.Free {
+		return true
+	}
+	for _, tax := range item.Taxes {
+		if tax.TaxType == FreeTaxType || isFreeAffectation(tax) {
+			return true
+		}
+	}
+	return false
+}
+
+// freeTotals retorna el valor referencial y los tributos de las líneas gratuitas, y el
+// valor y el IGV de las onerosas
+func freeTotals(doc *BusinessDocument) (freeValue, freeTax, onerousValue, onerousIGV float64) {
+	for _, item := range doc.Items {
+		if !isFreeLine(item) {
+			onerousValue += float64(item.LineTotal)
+			for _, tax := range item.Taxes {
+				if tax.TaxType == "1000" {
+					onerousIGV += float64(tax.TaxAmount)
+				}
+			}
+			continue
+		}
+		freeValue += float64(item.LineTotal)
+		for _, tax := range item.Taxes {
+			freeTax += float64(tax.TaxAmount)
+		}
+	}
+	return freeValue, freeTax, onerousValue, onerousIGV
+}
+
+// hasFreeLines indica si el documento tiene al menos una línea gratuita
+func hasFreeLines(doc *BusinessDocument) bool {
+	for _, item := range doc.Items {
+		if isFreeLine(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// documentTaxes retorna los tributos del documento con el 9996 calculado a partir de
+// las líneas gratuitas; el 9996 que venga en el documento se reemplaza
+func documentTaxes(doc *BusinessDocument) []TaxTotal {
+	if !hasFreeLines(doc) {
+		return doc.Taxes
+	}
+	var taxes []TaxTotal
+	for _, tax := range doc.Taxes {
+		if tax.TaxType != FreeTaxType {
+			taxes = append(taxes, tax)
+		}
+	}
+	freeValue, freeTax, _, _ := freeTotals(doc)
+	return append(taxes, TaxTotal{
+		TaxType:   FreeTaxType,
+		TaxBase:   FlexFloat(Decimal2(freeValue).Round()),
+		TaxAmount: FlexFloat(Decimal2(freeTax).Round()),
+	})
+}
+
+// freeTransferNote retorna la leyenda 1002 si el documento tiene líneas gratuitas y no
+// la trae ya entre sus observaciones
+func freeTransferNote(doc *BusinessDocument) []UBLNote {
+	if !hasFreeLines(doc) {
+		return nil
+	}
+	for _, observation := range doc.Observations {
+		if strings.EqualFold(strings.TrimSpace(observation), FreeTransferLegend) {
+			return nil
+		}
+	}
+	return []UBLNote{{LanguageLocaleID: FreeTransferLegendCode, Value: FreeTransferLegend}}
+}
+
+// applyFreeLine emite una línea gratuita: el precio es cero y sus tributos se declaran
+// en el 9996 con su tipo de afectación gratuito; el valor referencial va en
+// PricingReference con tipo 02. Los subtotales de la línea siguen el orden de sus tributos.
+func (c *UBLConverter) applyFreeLine(item DocumentItem, price *UBLPrice, taxTotals []UBLTaxTotal) {
+	if !isFreeLine(item) || len(taxTotals) == 0 {
+		return
+	}
+	price.PriceAmount.Value = 0
+	for j, tax := range item.Taxes {
+		if tax.TaxType == ISCTaxType {
+			continue
+		}
+		affectationCode := ""
+		if isFreeAffectation(tax) {
+			affectationCode = tax.AffectationCode
+		}
+		taxTotals[0].TaxSubtotals[j].TaxCategory = c.convertTaxCategory(FreeTaxType, float64(tax.TaxRate), affectationCode)
+	}
+}
+
+// validateFreeLines verifica que el valor referencial de las líneas gratuitas y su IGV
+// no sumen al subtotal, al IGV ni al total a pagar
+func (v *ValidationService) validateFreeLines(doc *BusinessDocument) []ValidationError {
+	freeValue, freeTax, onerousValue, onerousIGV := freeTotals(doc)
+	if !hasFreeLines(doc) || Decimal2(freeValue+freeTax).Round() == 0 {
+		return nil
+	}
+	var errors []ValidationError
+	// includesFree indica si received es el monto oneroso más el gratuito
+	includesFree := func(field string, received, onerous, free float64) {
+		if free == 0 || Decimal2(received).Round() != Decimal2(onerous+free).Round() {
+			return
+		}
+		errors = append(errors, ValidationError{
+			Field:    field,
+			Expected: fmt.Sprintf("%.2f", onerous),
+			Received: fmt.Sprintf("%.2f", received),
+			Rule:     "free_lines_validation",
+			Message:  "Free lines must not add to the amounts to pay",
+		})
+	}
+
+	includesFree("totals.subTotal", float64(doc.Totals.SubTotal), onerousValue, freeValue)
+	for i, tax := range doc.Taxes {
+		if tax.TaxType == "1000" {
+			includesFree(fmt.Sprintf("taxes[%d].taxAmount", i), float64(tax.TaxAmount), onerousIGV, freeTax)
+		}
+	}
+	includesFree("totals.payableAmount", float64(doc.Totals.PayableAmount), float64(doc.Totals.TotalAmount), freeValue+freeTax)
+	return errors
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	. "API-SUNAT2/model"
+)
+
+var (
+	ErrHomologationRUC         = errors.New("ruc must have 11 digits")
+	ErrHomologationEnvironment = errors.New("homologation cases can only be sent to beta, homologacion or mock")
+)
+
+// homologationCases es el set de pruebas por defecto, con los grupos del proceso de
+// homologación de SUNAT: cada grupo usa su propia serie y sus notas afectan a
+// documentos del mismo grupo
+var homologationCases = []HomologationCase{
+	// Grupo 1: ventas gravadas con IGV
+	{ID: "1", Description: "Factura gravada de 1 ítem", DocumentType: "01", Series: "FF11", Items: gravado(1)},
+	{ID: "2", Description: "Factura gravada de 4 ítems", DocumentType: "01", Series: "FF11", Items: gravado(4)},
+	{ID: "3", Description: "Factura gravada de 7 ítems", DocumentType: "01", Series: "FF11", Items: gravado(7)},
+	{ID: "4", Description: "Factura gravada de 5 ítems", DocumentType: "01", Series: "FF11", Items: gravado(5)},
+	{ID: "5", Description: "Factura gravada de 10 ítems", DocumentType: "01", Series: "FF11", Items: gravado(10)},
+	{ID: "6", Description: "Nota de crédito por devolución de un ítem de la factura del caso 2", DocumentType: "07", Series: "FF11", Items: gravado(1), Reference: "2", ReasonCode: "07"},
+	{ID: "7", Description: "Nota de débito por aumento en el valor de la factura del caso 3", DocumentType: "08", Series: "FF11", Items: gravado(1), Reference: "3", ReasonCode: "02"},
+	// Grupo 2: ventas exoneradas e inafectas
+	{ID: "8", Description: "Factura exonerada de 1 ítem", DocumentType: "01", Series: "FF12", Items: []string{"9997"}},
+	{ID: "9", Description: "Factura inafecta de 4 ítems", DocumentType: "01", Series: "FF12", Items: []string{"9998", "9998", "9998", "9998"}},
+	{ID: "10", Description: "Factura con ítems exonerados e inafectos", DocumentType: "01", Series: "FF12", Items: []string{"9997", "9998", "9997"}},
+	{ID: "11", Description: "Nota de crédito por devolución de un ítem de la factura del caso 9", DocumentType: "07", Series: "FF12", Items: []string{"9998"}, Reference: "9", ReasonCode: "07"},
+	// Grupo 3: transferencias gratuitas
+	{ID: "12", Description: "Factura gratuita de 2 ítems", DocumentType: "01", Series: "FF13", Items: []string{"9996", "9996"}},
+	{ID: "13", Description: "Factura con ítems gravados y gratuitos", DocumentType: "01", Series: "FF13", Items: []string{"1000", "1000", "9996"}},
+	{ID: "14", Description: "Nota de crédito por devolución de un ítem de la factura del caso 13", DocumentType: "07", Series: "FF13", Items: gravado(1), Reference: "13", ReasonCode: "07"},
+	// Grupo 4: ventas gravadas, exoneradas e inafectas en el mismo comprobante
+	{ID: "15", Description: "Factura con ítems gravados, exonerados e inafectos", DocumentType: "01", Series: "FF14", Items: []string{"1000", "9997", "9998", "1000"}},
+	{ID: "16", Description: "Nota de débito por intereses de la factura del caso 15", DocumentType: "08", Series: "FF14", Items: gravado(1), Reference: "15", ReasonCode: "01"},
+	// Grupo 5: boletas de venta
+	{ID: "17", Description: "Boleta gravada de 1 ítem", DocumentType: "03", Series: "BB11", Items: gravado(1)},
+	{ID: "18", Description: "Boleta gravada de 4 ítems", DocumentType: "03", Series: "BB11", Items: gravado(4)},
+	{ID: "19", Description: "Boleta con ítems exonerados e inafectos", DocumentType: "03", Series: "BB11", Items: []string{"9997", "9998"}},
+	{ID: "20", Description: "Nota de crédito por devolución de un ítem de la boleta del caso 18", DocumentType: "07", Series: "BB11", Items: gravado(1), Reference: "18", ReasonCode: "07"},
+}
+
+func gravado(n int) []string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = "1000"
+	}
+	return items
+}
+
+// DefaultHomologationCases retorna una copia del set de pruebas por defecto
+func DefaultHomologationCases() []HomologationCase {
+	return append([]HomologationCase(nil), homologationCases...)
+}
+
+// SelectHomologationCases retorna los casos con los IDs indicados, en el orden del set
+func SelectHomologationCases(cases []HomologationCase, ids []string) ([]HomologationCase, error) {
+	if len(ids) == 0 {
+		return cases, nil
+	}
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var selected []HomologationCase
+	for _, c := range cases {
+		if wanted[c.ID] {
+			selected = append(selected, c)
+			delete(wanted, c.ID)
+		}
+	}
+	for id := range wanted {
+		return nil, fmt.Errorf("unknown homologation case %q", id)
+	}
+	return selected, nil
+}
+
+// BuildHomologationDocuments arma el documento de cada caso para el emisor ruc. Los
+// correlativos empiezan en startNumber en cada serie; las notas referencian al documento
+// de su caso, que debe estar antes en la lista.
+func BuildHomologationDocuments(ruc, issueDate string, cases []HomologationCase, startNumber int) ([]*BusinessDocument, error) {
+	if startNumber <= 0 {
+		startNumber = 1
+	}
+	next := make(map[string]int)
+	built := make(map[string]*BusinessDocument)
+	var docs []*BusinessDocument
+	for _, c := range cases {
+		if len(c.Items) == 0 {
+			return nil, fmt.Errorf("homologation case %s has no items", c.ID)
+		}
+		if _, ok := next[c.Series]; !ok {
+			next[c.Series] = startNumber
+		}
+		doc := homologationDocument(ruc, issueDate, c)
+		doc.Number = fmt.Sprintf("%d", next[c.Series])
+		next[c.Series]++
+
+		if c.DocumentType == "07" || c.DocumentType == "08" {
+			affected, ok := built[c.Reference]
+			if !ok {
+				return nil, fmt.Errorf("homologation case %s references case %q, which must come before it", c.ID, c.Reference)
+			}
+			doc.Reference = &DocumentReference{
+				DocumentType: affected.Type,
+				DocumentID:   affected.Series + "-" + affected.Number,
+				IssueDate:    affected.IssueDate,
+				Reason:       c.Description,
+				ReasonCode:   c.ReasonCode,
+			}
+			doc.Customer = affected.Customer
+		}
+		built[c.ID] = doc
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// homologationDocument arma el documento de un caso: el ítem n vale 50 x n y los
+// ítems gratuitos no suman al total
+func homologationDocument(ruc, issueDate string, c HomologationCase) *BusinessDocument {
+	address := Address{
+		Street:     "Av. Principal 123",
+		City:       "LIMA",
+		District:   "MIRAFLORES",
+		Province:   "LIMA",
+		Department: "LIMA",
+		Country:    "PE",
+		Ubigeo:     "150122",
+	}
+	customer := Party{DocumentType: "6", DocumentID: "20123456794", Name: "CLIENTE HOMOLOGACION S.A.C.", Address: address}
+	if strings.HasPrefix(c.Series, "B") {
+		customer = Party{DocumentType: "1", DocumentID: "12345678", Name: "CLIENTE HOMOLOGACION", Address: address}
+	}
+	doc := &BusinessDocument{
+		Type:      c.DocumentType,
+		Series:    c.Series,
+		IssueDate: issueDate,
+		Currency:  "PEN",
+		Issuer:    Party{DocumentType: "6", DocumentID: ruc, Name: "EMISOR EN HOMOLOGACION", Address: address},
+		Customer:  customer,
+		Test:      true,
+	}
+
+	var subTotal, taxTotal float64
+	byType := make(map[string]*TaxTotal)
+	var taxOrder []string
+	for i, taxType := range c.Items {
+		lineTotal := float64(50 * (i + 1))
+		tax := Tax{TaxType: taxType, TaxBase: FlexFloat(lineTotal)}
+		if taxType == "1000" {
+			tax.TaxRate = 18
+			tax.TaxAmount = FlexFloat(Decimal2(lineTotal * 0.18).Round())
+		}
+		doc.Items = append(doc.Items, DocumentItem{
+			ID:          fmt.Sprintf("P%03d", i+1),
+			Description: fmt.Sprintf("Producto de prueba %d", i+1),
+			Quantity:    FlexFloat(float64(i + 1)),
+			UnitCode:    "NIU",
+			UnitPrice:   50,
+			LineTotal:   FlexFloat(lineTotal),
+			Taxes:       []Tax{tax},
+		})
+
+		total, ok := byType[taxType]
+		if !ok {
+			total = &TaxTotal{TaxType: taxType, TaxRate: tax.TaxRate}
+			byType[taxType] = total
+			taxOrder = append(taxOrder, taxType)
+		}
+		total.TaxBase += FlexFloat(lineTotal)
+		total.TaxAmount += tax.TaxAmount
+		if taxType != "9996" {
+			subTotal += lineTotal
+			taxTotal += float64(tax.TaxAmount)
+		}
+	}
+	// El XML lleva un solo TaxTotal a nivel documento: el del IGV si hay ítems gravados,
+	// si no el del primer ítem que no es gratuito; cada línea conserva su afectación
+	rootType := taxOrder[0]
+	for _, taxType := range taxOrder {
+		if taxType == "1000" || rootType == "9996" {
+			rootType = taxType
+		}
+	}
+	doc.Taxes = []TaxTotal{*byType[rootType]}
+	doc.Totals = DocumentTotals{
+		SubTotal:      FlexFloat(subTotal),
+		TotalTaxes:    FlexFloat(taxTotal),
+		TotalAmount:   FlexFloat(subTotal + taxTotal),
+		PayableAmount: FlexFloat(subTotal + taxTotal),
+	}
+	return doc
+}
+
+// RunHomologation genera los documentos del set de homologación, los procesa por el
+// pipeline y, si se pide, los envía al ambiente de pruebas. Un caso que falla no detiene
+// los siguientes: el resultado de cada uno queda en el reporte.
+func (s *UBLConverterService) RunHomologation(ctx context.Context, request HomologationRequest, certPEM, keyPEM []byte) (*HomologationReport, error) {
+	if !rucPattern.MatchString(request.RUC) {
+		return nil, ErrHomologationRUC
+	}
+	environment := ""
+	if request.Send {
+		environment = request.Environment
+		if environment == "" {
+			environment = EnvironmentBeta
+		}
+		if environment != EnvironmentBeta && environment != EnvironmentHomologation && environment != EnvironmentMock {
+			return nil, ErrHomologationEnvironment
+		}
+	}
+
+	cases := request.Cases
+	if len(cases) == 0 {
+		cases = DefaultHomologationCases()
+	}
+	cases, err := SelectHomologationCases(cases, request.CaseIDs)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := BuildHomologationDocuments(request.RUC, s.clock.Now().Format("2006-01-02"), cases, request.StartNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &HomologationReport{
+		RUC:         request.RUC,
+		GeneratedAt: s.clock.Now(),
+		Environment: environment,
+		Total:       len(cases),
+		Cases:       []HomologationResult{},
+	}
+	for i, doc := range docs {
+		result := s.runHomologationCase(ctx, doc, environment, certPEM, keyPEM)
+		result.CaseID, result.Description = cases[i].ID, cases[i].Description
+		if result.Status == "SUCCESS" {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, result)
+	}
+	return report, nil
+}
+
+// runHomologationCase procesa un documento del set y lo envía si se indicó un ambiente
+func (s *UBLConverterService) runHomologationCase(ctx context.Context, doc *BusinessDocument, environment string, certPEM, keyPEM []byte) HomologationResult {
+	response, err := s.ProcessDocument(ctx, doc, certPEM, keyPEM)
+	if err != nil {
+		return HomologationResult{Status: "ERROR", ErrorCode: "ERR_PROCESSING_FAILED", ErrorMessage: err.Error()}
+	}
+	result := HomologationResult{DocumentID: response.DocumentID, Status: response.Status}
+	if response.Status != "SUCCESS" {
+		result.ErrorCode, result.ErrorMessage = response.ErrorCode, response.ErrorMessage
+		return result
+	}
+	if environment == "" {
+		return result
+	}
+
+	sent, err := s.SendDocument(ctx, response.DocumentID, environment)
+	if err != nil {
+		result.Status, result.ErrorCode, result.ErrorMessage = "ERROR", "ERR_PROCESSING_FAILED", err.Error()
+		return result
+	}
+	if sent.Status != "SUCCESS" {
+		result.Status, result.ErrorCode, result.ErrorMessage = "ERROR", sent.ErrorCode, sent.ErrorMessage
+		return result
+	}
+	result.CDRStatus, _ = sent.Data["cdrStatus"].(string)
+	result.CDRDescription, _ = sent.Data["description"].(string)
+	if result.CDRStatus == CDRRejected {
+		result.Status, result.ErrorCode, result.ErrorMessage = "ERROR", "ERR_SUNAT_REJECTED", result.CDRDescription
+	}
+	return result
+}
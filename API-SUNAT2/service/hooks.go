@@ -0,0 +1,250 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	. "API-SUNAT2/model"
+)
+
+// HookPoint es el momento del pipeline en que se ejecuta un hook
+type HookPoint string
+
+// Puntos del pipeline donde se pueden registrar hooks
+const (
+	// BeforeValidate corre antes del Validator, también en /validate; puede completar o
+	// corregir el documento
+	BeforeValidate HookPoint = "before_validate"
+	// AfterConvert corre con el XML sin firmar en ctx.XML
+	AfterConvert HookPoint = "after_convert"
+	// BeforeSign corre después de los hooks AfterConvert, justo antes de firmar
+	BeforeSign HookPoint = "before_sign"
+	// AfterStore corre con el XML firmado y los artefactos ya escritos (ctx.XMLPath,
+	// ctx.Artifacts); un error no elimina lo escrito. No corre en un pipeline sin writer.
+	AfterStore HookPoint = "after_store"
+)
+
+// hookPoints son los puntos válidos, en el orden en que los recorre el pipeline
+var hookPoints = []HookPoint{BeforeValidate, AfterConvert, BeforeSign, AfterStore}
+
+// Códigos de error de un hook que falla
+const (
+	// ErrHookAbortedCode es el código por defecto de un hook que aborta con *HookError
+	ErrHookAbortedCode = "ERR_HOOK_ABORTED"
+	// ErrHookFailedCode es el código de un hook que retorna cualquier otro error
+	ErrHookFailedCode = "ERR_HOOK_FAILED"
+)
+
+// Hook es una extensión de terceros que se ejecuta en un punto del pipeline. Recibe el
+// contexto de la operación con el documento (ctx.Document), los artefactos intermedios
+// (ctx.XML, ctx.SignResult, ctx.XMLPath, ctx.Artifacts) y ctx.Data, que se agrega a la
+// respuesta. Puede modificar el documento y el XML; para abortar retorna un *HookError.
+type Hook func(ctx *PipelineContext) error
+
+// HookError aborta el pipeline desde un hook con el código y el mensaje de la respuesta.
+// Sin Code se usa ErrHookAbortedCode; ValidationErrors se devuelven como los del
+// validador.
+type HookError struct {
+	Code             string
+	Message          string
+	ValidationErrors []ValidationError
+	Err              error
+}
+
+func (e *HookError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// registeredHook es un hook con el nombre con que se registró
+type registeredHook struct {
+	point HookPoint
+	name  string
+	hook  Hook
+}
+
+// AddHook registra un hook en un punto del pipeline. Los hooks de un mismo punto se
+// ejecutan en orden de registro.
+func (p *Pipeline) AddHook(point HookPoint, name string, hook Hook) error {
+	registered, err := newRegisteredHook(point, name, hook)
+	if err != nil {
+		return err
+	}
+	p.hooks = append(p.hooks, registered)
+	return nil
+}
+
+func newRegisteredHook(point HookPoint, name string, hook Hook) (registeredHook, error) {
+	if !validHookPoint(point) {
+		return registeredHook{}, fmt.Errorf("unknown hook point %q", point)
+	}
+	if name == "" || hook == nil {
+		return registeredHook{}, fmt.Errorf("hook at %s needs a name and a function", point)
+	}
+	return registeredHook{point: point, name: name, hook: hook}, nil
+}
+
+// SetHookMetrics registra la duración de cada ejecución de los hooks
+func (p *Pipeline) SetHookMetrics(metrics *HookMetrics) {
+	p.hookMetrics = metrics
+}
+
+// RegisterHook registra un hook en el pipeline por defecto de /convert, /validate y los
+// lotes. Se llama al construir las dependencias, antes de atender requests.
+func (s *UBLConverterService) RegisterHook(point HookPoint, name string, hook Hook) error {
+	registered, err := newRegisteredHook(point, name, hook)
+	if err != nil {
+		return err
+	}
+	s.hooks = append(s.hooks, registered)
+	return nil
+}
+
+// HookMetrics retorna las métricas de duración de los hooks registrados
+func (s *UBLConverterService) HookMetrics() *HookMetrics {
+	return s.hookMetrics
+}
+
+func validHookPoint(point HookPoint) bool {
+	for _, valid := range hookPoints {
+		if point == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// hookStages retorna las etapas de los hooks registrados en el punto, en orden de registro
+func (p *Pipeline) hookStages(point HookPoint) []pipelineStage {
+	var stages []pipelineStage
+	for _, registered := range p.hooks {
+		if registered.point != point {
+			continue
+		}
+		registered := registered
+		stages = append(stages, pipelineStage{
+			name:      "hook_" + registered.name,
+			operation: "HOOK_ERROR",
+			code:      ErrHookFailedCode,
+			fn: func(ctx *PipelineContext) error {
+				return p.runHook(ctx, registered)
+			},
+		})
+	}
+	return stages
+}
+
+// runHook ejecuta el hook midiendo su duración y convierte un *HookError en el
+// *StepError de la respuesta
+func (p *Pipeline) runHook(ctx *PipelineContext, registered registeredHook) error {
+	start := ctx.Now()
+	err := registered.hook(ctx)
+	ctx.Observe("hook_"+registered.name, start)
+	if p.hookMetrics != nil {
+		p.hookMetrics.record(registered.point, registered.name, ctx.Now().Sub(start), err != nil)
+	}
+
+	hookErr, ok := err.(*HookError)
+	if !ok {
+		return err
+	}
+	code := hookErr.Code
+	if code == "" {
+		code = ErrHookAbortedCode
+	}
+	return &StepError{
+		Operation:        "HOOK_ERROR",
+		Code:             code,
+		Message:          fmt.Sprintf("El hook %s abortó la operación: %s", registered.name, hookErr.Message),
+		ValidationErrors: hookErr.ValidationErrors,
+		Err:              hookErr,
+	}
+}
+
+// HookStats resume las ejecuciones de un hook
+type HookStats struct {
+	Point    HookPoint `json:"point"`
+	Name     string    `json:"name"`
+	Count    int64     `json:"count"`
+	Failures int64     `json:"failures"`
+	// TotalMs y MaxMs son la duración acumulada y la máxima en milisegundos
+	TotalMs float64 `json:"totalMs"`
+	MaxMs   float64 `json:"maxMs"`
+}
+
+// HookMetrics acumula la duración de las ejecuciones de cada hook
+type HookMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*HookStats
+}
+
+func NewHookMetrics() *HookMetrics {
+	return &HookMetrics{stats: make(map[string]*HookStats)}
+}
+
+func (m *HookMetrics) record(point HookPoint, name string, duration time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := string(point) + "/" + name
+	stats, ok := m.stats[key]
+	if !ok {
+		stats = &HookStats{Point: point, Name: name}
+		m.stats[key] = stats
+	}
+	ms := float64(duration.Microseconds()) / 1000
+	stats.Count++
+	stats.TotalMs += ms
+	if ms > stats.MaxMs {
+		stats.MaxMs = ms
+	}
+	if failed {
+		stats.Failures++
+	}
+}
+
+// Report retorna las estadísticas por hook ordenadas por punto y nombre
+func (m *HookMetrics) Report() []HookStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := make([]HookStats, 0, len(m.stats))
+	for _, stats := range m.stats {
+		report = append(report, *stats)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Point != report[j].Point {
+			return report[i].Point < report[j].Point
+		}
+		return report[i].Name < report[j].Name
+	})
+	return report
+}
+
+// WriteHookMetrics escribe en formato de texto de Prometheus la duración y los fallos
+// de cada hook
+func (s *UBLConverterService) WriteHookMetrics(w io.Writer) {
+	report := s.hookMetrics.Report()
+	if len(report) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "# HELP pipeline_hook_duration_seconds Duración de las ejecuciones de cada hook del pipeline")
+	fmt.Fprintln(w, "# TYPE pipeline_hook_duration_seconds summary")
+	for _, stats := range report {
+		labels := fmt.Sprintf("point=%q,hook=%q", stats.Point, stats.Name)
+		fmt.Fprintf(w, "pipeline_hook_duration_seconds_sum{%s} %g\n", labels, stats.TotalMs/1000)
+		fmt.Fprintf(w, "pipeline_hook_duration_seconds_count{%s} %d\n", labels, stats.Count)
+	}
+	fmt.Fprintln(w, "# HELP pipeline_hook_failures_total Ejecuciones de cada hook que retornaron error")
+	fmt.Fprintln(w, "# TYPE pipeline_hook_failures_total counter")
+	for _, stats := range report {
+		fmt.Fprintf(w, "pipeline_hook_failures_total{point=%q,hook=%q} %d\n", stats.Point, stats.Name, stats.Failures)
+	}
+}
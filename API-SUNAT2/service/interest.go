@@ -0,0 +1,278 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// InterestReasonCode es el motivo de la nota de débito por intereses (catálogo 10)
+const InterestReasonCode = "01"
+
+// interestParty son los datos de una parte que la nota de débito toma del XML de la
+// factura, tal como los emite convertParty
+type interestParty struct {
+	ID        UBLIDWithScheme `xml:"Party>PartyIdentification>ID"`
+	PartyName string          `xml:"Party>PartyName>Name"`
+	LegalName string          `xml:"Party>PartyLegalEntity>RegistrationName"`
+	Ubigeo    string          `xml:"Party>PartyLegalEntity>RegistrationAddress>ID"`
+	City      string          `xml:"Party>PartyLegalEntity>RegistrationAddress>CityName"`
+	Province  string          `xml:"Party>PartyLegalEntity>RegistrationAddress>CountrySubentity"`
+	District  string          `xml:"Party>PartyLegalEntity>RegistrationAddress>District"`
+	Street    string          `xml:"Party>PartyLegalEntity>RegistrationAddress>AddressLine>Line"`
+	Country   string          `xml:"Party>PartyLegalEntity>RegistrationAddress>Country>IdentificationCode"`
+	Email     string          `xml:"Party>Contact>ElectronicMail"`
+	Telephone string          `xml:"Party>Contact>Telephone"`
+}
+
+func (p interestParty) party() Party {
+	name := p.LegalName
+	if name == "" {
+		name = p.PartyName
+	}
+	return Party{
+		DocumentType: p.ID.SchemeID,
+		DocumentID:   p.ID.Value,
+		Name:         name,
+		Address: Address{
+			Street:   p.Street,
+			City:     p.City,
+			District: p.District,
+			Province: p.Province,
+			Country:  p.Country,
+			Ubigeo:   p.Ubigeo,
+		},
+		Email:     p.Email,
+		Telephone: p.Telephone,
+	}
+}
+
+// interestSource son los datos del XML firmado de la factura que la nota de débito
+// por intereses necesita y el registro no guarda
+type interestSource struct {
+	DueDate  string        `xml:"DueDate"`
+	Supplier interestParty `xml:"AccountingSupplierParty"`
+	Customer interestParty `xml:"AccountingCustomerParty"`
+}
+
+// readInterestSource decodifica el elemento raíz de la factura; la firma puede ir antes
+// del elemento raíz, por eso se busca por nombre
+func readInterestSource(xmlData []byte) (*interestSource, error) {
+	decoder := NewXMLDecoder(bytes.NewReader(xmlData))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("document root element not found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || !IsUBLDocumentRoot(start.Name) {
+			continue
+		}
+		var source interestSource
+		if err := decoder.DecodeElement(&source, &start); err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		return &source, nil
+	}
+}
+
+// CalculateInterest retorna los intereses de un saldo por los días de atraso con la
+// tasa anual en porcentaje, redondeados a dos decimales. Un método desconocido se
+// calcula como effective.
+func CalculateInterest(balance, annualRate float64, days int, method string) float64 {
+	if balance <= 0 || annualRate <= 0 || days <= 0 {
+		return 0
+	}
+	years := float64(days) / InterestDayBase
+	if method == InterestMethodSimple {
+		return Decimal2(balance * annualRate / 100 * years).Round()
+	}
+	return Decimal2(balance * (math.Pow(1+annualRate/100, years) - 1)).Round()
+}
+
+// IssueInterestDebitNote arma y procesa la nota de débito por intereses moratorios de
+// una factura vencida del store: calcula los intereses sobre el saldo (el total menos
+// las notas de crédito no anuladas) desde el vencimiento hasta la fecha de cálculo y
+// emite una nota con motivo 01 y una sola línea. El cálculo se registra con la nota.
+func (s *UBLConverterService) IssueInterestDebitNote(ctx context.Context, documentID string, request InterestDebitNoteRequest, certPEM, keyPEM []byte) (*APIResponse, error) {
+	correlationID := GenerateCorrelationID()
+	documentID = CanonicalDocumentID(documentID)
+	interestError := func(code, message string) *APIResponse {
+		s.logService.LogError(correlationID, "INTEREST_DEBIT_NOTE_ERROR", "08", "", code, message)
+		return &APIResponse{
+			Status:        "ERROR",
+			CorrelationID: correlationID,
+			DocumentID:    documentID,
+			ProcessedAt:   s.clock.Now(),
+			ErrorCode:     code,
+			ErrorMessage:  message,
+		}
+	}
+
+	if !documentIDPattern.MatchString(documentID) {
+		return interestError("ERR_INVALID_DOCUMENT_ID", "El documentId debe tener el formato RUC-TIPO-SERIE-NUMERO"), nil
+	}
+	method := request.Method
+	if method == "" {
+		method = InterestMethodEffective
+	}
+	if method != InterestMethodEffective && method != InterestMethodSimple {
+		return interestError("ERR_INVALID_INTEREST_REQUEST", fmt.Sprintf("method must be %s or %s", InterestMethodEffective, InterestMethodSimple)), nil
+	}
+	if request.AnnualRate <= 0 {
+		return interestError("ERR_INVALID_INTEREST_REQUEST", "annualRate must be a percentage greater than 0"), nil
+	}
+	today := s.clock.Now().Format("2006-01-02")
+	calculationDate := request.CalculationDate
+	if calculationDate == "" {
+		calculationDate = today
+	}
+	calculated, err := time.Parse("2006-01-02", calculationDate)
+	if err != nil {
+		return interestError("ERR_INVALID_INTEREST_REQUEST", "calculationDate must have the format YYYY-MM-DD"), nil
+	}
+	if calculationDate > today {
+		return interestError("ERR_INVALID_INTEREST_REQUEST", fmt.Sprintf("calculationDate %s is after today %s", calculationDate, today)), nil
+	}
+
+	data, err := s.store.Read(RecordName(documentID))
+	if err != nil {
+		return interestError("ERR_DOCUMENT_NOT_FOUND", fmt.Sprintf("No existe el documento %s", documentID)), nil
+	}
+	var record DocumentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid document record %s: %v", documentID, err)
+	}
+	if record.DocumentType != "01" {
+		return interestError("ERR_NOT_AN_INVOICE", "Solo se emiten notas de débito por intereses sobre facturas"), nil
+	}
+	if _, err := s.store.Read(documentID + VoidedSuffix); err == nil {
+		return interestError("ERR_NO_BALANCE", fmt.Sprintf("La factura %s está anulada", documentID)), nil
+	}
+	if s.isRejectedBySunat(documentID) {
+		return interestError("ERR_NO_BALANCE", fmt.Sprintf("La factura %s fue rechazada por SUNAT", documentID)), nil
+	}
+
+	xmlData, err := s.store.Read(documentID + ".xml")
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", documentID, err)
+	}
+	source, err := readInterestSource(xmlData)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", documentID, err)
+	}
+	dueDate := source.DueDate
+	if dueDate == "" {
+		dueDate = record.IssueDate
+	}
+	due, err := time.Parse("2006-01-02", dueDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid due date %q in %s", dueDate, documentID)
+	}
+	days := int(calculated.Sub(due).Hours() / 24)
+	if days <= 0 {
+		return interestError("ERR_DOCUMENT_NOT_OVERDUE", fmt.Sprintf("La factura %s vence el %s, no está vencida al %s", documentID, dueDate, calculationDate)), nil
+	}
+
+	credited, err := s.creditedAmount(documentID, "")
+	if err != nil {
+		return nil, err
+	}
+	balance := Decimal2(record.PayableAmount - credited).Round()
+	if balance <= 0 {
+		return interestError("ERR_NO_BALANCE", fmt.Sprintf("La factura %s no tiene saldo: total %.2f, notas de crédito %.2f", documentID, record.PayableAmount, credited)), nil
+	}
+	interest := CalculateInterest(balance, request.AnnualRate, days, method)
+	if interest <= 0 {
+		return interestError("ERR_NO_BALANCE", fmt.Sprintf("Los intereses de %.2f por %d días son menores a 0.01", balance, days)), nil
+	}
+
+	calculation := &InterestCalculation{
+		AffectedDocumentID: documentID,
+		InvoiceTotal:       record.PayableAmount,
+		CreditedAmount:     credited,
+		Balance:            balance,
+		DueDate:            dueDate,
+		CalculationDate:    calculationDate,
+		Days:               days,
+		AnnualRate:         request.AnnualRate,
+		Method:             method,
+		DayBase:            InterestDayBase,
+		Interest:           interest,
+		Taxed:              request.Taxed,
+	}
+	doc := interestDebitNote(&record, source, request, calculation)
+	if request.Taxed {
+		rate := s.validator.IGVRateAt(calculationDate)
+		calculation.TaxAmount = Decimal2(interest * rate / 100).Round()
+		setInterestTax(doc, "1000", rate, calculation.TaxAmount)
+	} else {
+		setInterestTax(doc, "9998", 0, 0)
+	}
+
+	resp, err := s.ProcessDocument(ctx, doc, certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		return resp, err
+	}
+	s.logService.LogInfo(resp.CorrelationID, "INTEREST_DEBIT_NOTE", "08", doc.Series+"-"+doc.Number,
+		fmt.Sprintf("Intereses de %s: saldo %.2f, %d días al %.4g%% %s, %.2f", documentID, balance, days, request.AnnualRate, method, interest))
+	return resp, nil
+}
+
+// interestDebitNote arma la nota de débito de la factura con una línea por los
+// intereses; los tributos los completa setInterestTax
+func interestDebitNote(record *DocumentRecord, source *interestSource, request InterestDebitNoteRequest, calculation *InterestCalculation) *BusinessDocument {
+	seriesNumber := record.Series + "-" + record.Number
+	return &BusinessDocument{
+		Type:      "08",
+		Series:    strings.TrimSpace(request.Series),
+		Number:    strings.TrimSpace(request.Number),
+		IssueDate: calculation.CalculationDate,
+		Currency:  record.Currency,
+		Issuer:    source.Supplier.party(),
+		Customer:  source.Customer.party(),
+		Reference: &DocumentReference{
+			DocumentType: "01",
+			DocumentID:   seriesNumber,
+			IssueDate:    record.IssueDate,
+			Reason:       interestReason(),
+			ReasonCode:   InterestReasonCode,
+		},
+		Items: []DocumentItem{{
+			ID:          "1",
+			Description: fmt.Sprintf("Intereses moratorios de la factura %s del %s al %s (%d días)", seriesNumber, calculation.DueDate, calculation.CalculationDate, calculation.Days),
+			Quantity:    1,
+			UnitCode:    "ZZ",
+			UnitPrice:   FlexFloat(calculation.Interest),
+			LineTotal:   FlexFloat(calculation.Interest),
+		}},
+		Interest: calculation,
+	}
+}
+
+// interestReason es la descripción del motivo 01 en la lista activa del catálogo 10
+func interestReason() string {
+	reason, _ := lookupNoteReason("08", InterestReasonCode)
+	return reason.description
+}
+
+// setInterestTax completa el tributo de la línea y los totales de la nota
+func setInterestTax(doc *BusinessDocument, taxType string, rate, taxAmount float64) {
+	base := doc.Items[0].LineTotal
+	doc.Items[0].Taxes = []Tax{{TaxType: taxType, TaxAmount: FlexFloat(taxAmount), TaxRate: FlexFloat(rate), TaxBase: base}}
+	doc.Taxes = []TaxTotal{{TaxType: taxType, TaxAmount: FlexFloat(taxAmount), TaxRate: FlexFloat(rate), TaxBase: base}}
+	total := FlexFloat(Decimal2(float64(base) + taxAmount).Round())
+	doc.Totals = DocumentTotals{SubTotal: base, TotalTaxes: FlexFloat(taxAmount), TotalAmount: total, PayableAmount: total}
+}
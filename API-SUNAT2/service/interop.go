@@ -0,0 +1,64 @@
+package service
+
+import (
+	"regexp"
+
+	. "API-SUNAT2/model"
+)
+
+// CompatibilityOptions toleran las diferencias conocidas de los XML de otros
+// facturadores al verificarlos y validarlos. Las muestras de cada uno están en
+// test/testdata/interop.
+//
+//   - FACTURADOR SUNAT firma con rsa-sha1 y digest sha1, en ISO-8859-1 y sin
+//     cbc:LineCountNumeric.
+//   - Nubefact firma con C14N exclusiva y rsa-sha256, con la firma en un
+//     ext:UBLExtension precedido por otros.
+//   - Bizlinks declara los namespaces en los elementos que los usan, escribe fin de
+//     línea CRLF, parte el SignatureValue en líneas con &#13; y omite cbc:LineCountNumeric.
+type CompatibilityOptions struct {
+	// AllowSHA1 acepta firmas rsa-sha1 con digest sha1 (FACTURADOR SUNAT)
+	AllowSHA1 bool `json:"allowSha1"`
+	// AllowMissingLineCount acepta documentos sin cbc:LineCountNumeric, que UBL no exige
+	// (FACTURADOR SUNAT, Bizlinks)
+	AllowMissingLineCount bool `json:"allowMissingLineCount"`
+}
+
+// SetCompatibility configura las diferencias toleradas al verificar firmas de otros facturadores
+func (s *DigitalSignatureService) SetCompatibility(options CompatibilityOptions) {
+	s.compatibility = options
+}
+
+// receivedIDPattern es el ID serie-número de un comprobante recibido
+var receivedIDPattern = regexp.MustCompile(`^[A-Z0-9]{4}-\d{1,8}$`)
+
+// CheckReceived verifica los invariantes estructurales de un XML recibido de otro
+// facturador, sin el documento de origen: un TaxTotal, líneas numeradas 1..N, un ID
+// serie-número y una sola moneda
+func (ic *InvariantChecker) CheckReceived(xmlData []byte, options CompatibilityOptions) []ValidationError {
+	summary, err := ic.summarize(xmlData)
+	if err != nil {
+		return []ValidationError{xmlParseError(err, "XML could not be parsed")}
+	}
+	errors := summary.structureErrors(summary.currency, !options.AllowMissingLineCount)
+
+	if len(summary.lineIDs) == 0 {
+		errors = append(errors, ValidationError{
+			Field:    "lines",
+			Expected: "At least 1",
+			Received: "0",
+			Rule:     "document_lines_invariant",
+			Message:  "Document has no lines",
+		})
+	}
+	if !receivedIDPattern.MatchString(summary.documentID) {
+		errors = append(errors, ValidationError{
+			Field:    "ID",
+			Expected: "Series-number (F001-123)",
+			Received: summary.documentID,
+			Rule:     "document_id_invariant",
+			Message:  "Document ID is not a series-number",
+		})
+	}
+	return errors
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// DocumentConverter convierte un BusinessDocument a XML UBL sin firmar
+type DocumentConverter interface {
+	ConvertToUBL(doc *BusinessDocument) ([]byte, error)
+}
+
+// InvariantChecker verifica invariantes estructurales del XML generado antes de firmarlo
+type InvariantChecker struct{}
+
+func NewInvariantChecker() *InvariantChecker {
+	return &InvariantChecker{}
+}
+
+// xmlSummary contiene los datos del XML necesarios para verificar los invariantes
+type xmlSummary struct {
+	rootTaxTotals    int
+	lineCountNumeric string
+	documentID       string
+	currency         string
+	lineIDs          []string
+	currencyIDs      []string
+}
+
+func (ic *InvariantChecker) Check(xmlData []byte, doc *BusinessDocument) []ValidationError {
+	summary, err := ic.summarize(xmlData)
+	if err != nil {
+		return []ValidationError{xmlParseError(err, "Generated XML could not be parsed")}
+	}
+	errors := summary.structureErrors(doc.Currency, true)
+
+	// Al menos una línea, tantas como ítems a emitir tiene el documento
+	if expected := len(documentLines(doc)); len(summary.lineIDs) == 0 || len(summary.lineIDs) != expected {
+		errors = append(errors, ValidationError{
+			Field:    "lines",
+			Expected: fmt.Sprintf("%d (at least 1)", expected),
+			Received: strconv.Itoa(len(summary.lineIDs)),
+			Rule:     "document_lines_invariant",
+			Message:  "Number of lines does not match the document items to emit",
+		})
+	}
+
+	// ID del documento consistente con serie-número
+	expectedID := fmt.Sprintf("%s-%s", doc.Series, doc.Number)
+	if summary.documentID != expectedID {
+		errors = append(errors, ValidationError{
+			Field:    "ID",
+			Expected: expectedID,
+			Received: summary.documentID,
+			Rule:     "document_id_invariant",
+			Message:  "Document ID does not match series-number",
+		})
+	}
+	return errors
+}
+
+func xmlParseError(err error, message string) ValidationError {
+	return ValidationError{
+		Field:    "xml",
+		Expected: "Well-formed XML",
+		Received: err.Error(),
+		Rule:     "xml_parse_invariant",
+		Message:  message,
+	}
+}
+
+// structureErrors verifica los invariantes que no dependen del documento de origen;
+// sin requireLineCount se acepta que falte cbc:LineCountNumeric
+func (summary *xmlSummary) structureErrors(currency string, requireLineCount bool) []ValidationError {
+	var errors []ValidationError
+
+	// Un solo TaxTotal a nivel documento
+	if summary.rootTaxTotals != 1 {
+		errors = append(errors, ValidationError{
+			Field:    "TaxTotal",
+			Expected: "1",
+			Received: strconv.Itoa(summary.rootTaxTotals),
+			Rule:     "single_root_taxtotal_invariant",
+			Message:  "Document must contain exactly one root TaxTotal",
+		})
+	}
+
+	// LineCountNumeric igual al número real de líneas
+	if (requireLineCount || summary.lineCountNumeric != "") && summary.lineCountNumeric != strconv.Itoa(len(summary.lineIDs)) {
+		errors = append(errors, ValidationError{
+			Field:    "LineCountNumeric",
+			Expected: strconv.Itoa(len(summary.lineIDs)),
+			Received: summary.lineCountNumeric,
+			Rule:     "line_count_invariant",
+			Message:  "LineCountNumeric does not match the number of lines",
+		})
+	}
+
+	// Moneda uniforme en todos los currencyID
+	for _, currencyID := range summary.currencyIDs {
+		if currencyID != currency {
+			errors = append(errors, ValidationError{
+				Field:    "currencyID",
+				Expected: currency,
+				Received: currencyID,
+				Rule:     "uniform_currency_invariant",
+				Message:  "All currencyID attributes must match the document currency",
+			})
+			break
+		}
+	}
+
+	// cbc:ID presente en cada línea con numeración 1..N
+	for i, lineID := range summary.lineIDs {
+		if lineID != strconv.Itoa(i+1) {
+			errors = append(errors, ValidationError{
+				Field:    fmt.Sprintf("lines[%d].ID", i),
+				Expected: strconv.Itoa(i + 1),
+				Received: lineID,
+				Rule:     "line_id_sequence_invariant",
+				Message:  "Line IDs must be present and numbered 1..N",
+			})
+		}
+	}
+	return errors
+}
+
+func (ic *InvariantChecker) summarize(xmlData []byte) (*xmlSummary, error) {
+	summary := &xmlSummary{}
+	decoder := NewXMLDecoder(bytes.NewReader(xmlData))
+
+	depth := 0
+	inLine := false
+	lineHasID := false
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			text.Reset()
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "currencyID" {
+					summary.currencyIDs = append(summary.currencyIDs, attr.Value)
+				}
+			}
+			if depth == 2 {
+				switch t.Name.Local {
+				case "TaxTotal":
+					summary.rootTaxTotals++
+				case "InvoiceLine", "CreditNoteLine", "DebitNoteLine":
+					inLine = true
+					lineHasID = false
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			switch {
+			case depth == 2 && t.Name.Local == "ID":
+				summary.documentID = value
+			case depth == 2 && t.Name.Local == "DocumentCurrencyCode":
+				summary.currency = value
+			case depth == 2 && t.Name.Local == "LineCountNumeric":
+				summary.lineCountNumeric = value
+			case depth == 3 && inLine && t.Name.Local == "ID":
+				summary.lineIDs = append(summary.lineIDs, value)
+				lineHasID = true
+			case depth == 2 && inLine:
+				if !lineHasID {
+					summary.lineIDs = append(summary.lineIDs, "")
+				}
+				inLine = false
+			}
+			text.Reset()
+			depth--
+		}
+	}
+
+	return summary, nil
+}
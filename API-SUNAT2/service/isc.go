@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+
+	. "API-SUNAT2/model"
+)
+
+// ISCTaxType es el código del ISC en el catálogo 05
+const ISCTaxType = "2000"
+
+// Sistemas de cálculo del ISC (catálogo 08), emitidos en cbc:TierRange
+const (
+	// ISCSystemValue aplica la tasa sobre el valor de venta
+	ISCSystemValue = "01"
+	// ISCSystemSpecific aplica un monto fijo por unidad
+	ISCSystemSpecific = "02"
+	// ISCSystemRetailPrice aplica la tasa sobre el precio de venta al público sin IGV
+	ISCSystemRetailPrice = "03"
+)
+
+// iscAmount calcula la base y el monto del ISC de una línea según su sistema. false si
+// el sistema no es válido.
+func iscAmount(item DocumentItem, tax Tax, igvRate float64) (base, amount float64, ok bool) {
+	switch tax.IscSystem {
+	case ISCSystemValue:
+		base = float64(item.LineTotal)
+		amount = base * float64(tax.TaxRate) / 100
+	case ISCSystemSpecific:
+		base = float64(item.LineTotal)
+		amount = float64(tax.IscAmountPerUnit * item.Quantity)
+	case ISCSystemRetailPrice:
+		// El precio de venta al público incluye el IGV
+		base = float64(tax.RetailPrice*item.Quantity) / (1 + igvRate/100)
+		amount = base * float64(tax.TaxRate) / 100
+	default:
+		return 0, 0, false
+	}
+	return Decimal2(base).Round(), Decimal2(amount).Round(), true
+}
+
+// iscMissingField retorna el campo que el sistema del ISC necesita y no tiene
+func iscMissingField(tax Tax) string {
+	switch {
+	case tax.IscSystem == ISCSystemSpecific && tax.IscAmountPerUnit <= 0:
+		return "iscAmountPerUnit"
+	case tax.IscSystem == ISCSystemRetailPrice && tax.RetailPrice <= 0:
+		return "retailPrice"
+	}
+	return ""
+}
+
+// validateISC verifica el cálculo del ISC de cada línea según su sistema, que el IGV de
+// esas líneas se calcule sobre el valor de venta más el ISC y que el ISC del documento
+// sea la suma del de las líneas
+func (v *ValidationService) validateISC(doc *BusinessDocument) []ValidationError {
+	var errors []ValidationError
+	mismatch := func(field string, expected, received float64, message string) {
+		errors = append(errors, ValidationError{
+			Field:    field,
+			Expected: fmt.Sprintf("%.2f", expected),
+			Received: fmt.Sprintf("%.2f", received),
+			Rule:     "isc_validation",
+			Message:  message,
+		})
+	}
+
+	igvRate := v.IGVRateAt(doc.IssueDate)
+	var lineISC float64
+	hasISC := false
+	for i, item := range doc.Items {
+		isc := 0.0
+		for j, tax := range item.Taxes {
+			if tax.TaxType != ISCTaxType {
+				if tax.IscSystem != "" {
+					errors = append(errors, ValidationError{
+						Field:    fmt.Sprintf("items[%d].taxes[%d].iscSystem", i, j),
+						Expected: "Empty for taxes other than ISC (2000)",
+						Received: tax.IscSystem,
+						Rule:     "isc_validation",
+						Message:  "Only the ISC has a calculation system",
+					})
+				}
+				continue
+			}
+
+			hasISC = true
+			field := fmt.Sprintf("items[%d].taxes[%d]", i, j)
+			base, amount, ok := iscAmount(item, tax, igvRate)
+			if !ok {
+				errors = append(errors, ValidationError{
+					Field:    field + ".iscSystem",
+					Expected: "01, 02 or 03 (catalog 08)",
+					Received: tax.IscSystem,
+					Rule:     "isc_validation",
+					Message:  "ISC calculation system is not valid",
+				})
+				continue
+			}
+			if missing := iscMissingField(tax); missing != "" {
+				errors = append(errors, ValidationError{
+					Field:    field + "." + missing,
+					Expected: "Greater than 0",
+					Received: "0.00",
+					Rule:     "isc_validation",
+					Message:  fmt.Sprintf("ISC system %s requires %s", tax.IscSystem, missing),
+				})
+				continue
+			}
+			if Decimal2(tax.TaxBase).Round() != base {
+				mismatch(field+".taxBase", base, float64(tax.TaxBase), "ISC taxable amount does not match the calculation system")
+			}
+			if Decimal2(tax.TaxAmount).Round() != amount {
+				mismatch(field+".taxAmount", amount, float64(tax.TaxAmount), "ISC amount does not match the calculation system")
+			}
+			isc += float64(tax.TaxAmount)
+		}
+		if isc == 0 {
+			continue
+		}
+		lineISC += isc
+
+		// El IGV de una línea con ISC se calcula sobre el valor de venta más el ISC
+		for j, tax := range item.Taxes {
+			if tax.TaxType != "1000" {
+				continue
+			}
+			field := fmt.Sprintf("items[%d].taxes[%d]", i, j)
+			base := Decimal2(float64(item.LineTotal) + isc).Round()
+			if Decimal2(tax.TaxBase).Round() != base {
+				mismatch(field+".taxBase", base, float64(tax.TaxBase), "IGV taxable amount must include the ISC")
+			}
+			if amount := Decimal2(base * float64(tax.TaxRate) / 100).Round(); Decimal2(tax.TaxAmount).Round() != amount {
+				mismatch(field+".taxAmount", amount, float64(tax.TaxAmount), "IGV amount must be calculated on the value plus the ISC")
+			}
+		}
+	}
+	if !hasISC {
+		return errors
+	}
+
+	// El ISC va en su propio subtotal del TaxTotal del documento
+	var documentISC float64
+	for _, tax := range doc.Taxes {
+		if tax.TaxType == ISCTaxType {
+			documentISC += float64(tax.TaxAmount)
+		}
+	}
+	if Decimal2(documentISC).Round() != Decimal2(lineISC).Round() {
+		mismatch("taxes", Decimal2(lineISC).Round(), documentISC, "Document ISC must be the sum of the line ISC amounts")
+	}
+	return errors
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	. "API-SUNAT2/model"
+)
+
+// Modos de la verificación de coherencia de la fecha de emisión con el documento que
+// modifica una nota y con la caída declarada de un comprobante de contingencia
+const (
+	IssueDateCheckError   = "error"
+	IssueDateCheckWarning = "warning"
+	IssueDateCheckOff     = "off"
+)
+
+// IssueDateCoherenceRule es la regla de una fecha de emisión incoherente con otra fecha
+// del documento
+const IssueDateCoherenceRule = "issue_date_coherence"
+
+// DefaultNoteMaxDays es el plazo por defecto, en días desde la emisión del documento
+// que modifica, para emitir una nota
+const DefaultNoteMaxDays = 365
+
+// SetIssueDateCheck configura si una fecha de emisión incoherente es un error, un
+// warning o no se verifica; valores desconocidos se ignoran
+func (v *ValidationService) SetIssueDateCheck(mode string) {
+	switch mode {
+	case IssueDateCheckError, IssueDateCheckWarning, IssueDateCheckOff:
+		v.issueDateCheck = mode
+	}
+}
+
+// SetNoteMaxDays configura el plazo en días para emitir una nota respecto al documento
+// que modifica; 0 no limita el plazo y un valor negativo se ignora
+func (v *ValidationService) SetNoteMaxDays(days int) {
+	if days >= 0 {
+		v.noteMaxDays = days
+	}
+}
+
+// IssueDateWarnings retorna como warnings las fechas de emisión incoherentes cuando la
+// verificación está en modo warning
+func (v *ValidationService) IssueDateWarnings(doc *BusinessDocument) []ValidationError {
+	if v.issueDateCheck != IssueDateCheckWarning {
+		return nil
+	}
+	return v.checkIssueDateCoherence(doc)
+}
+
+// checkIssueDateCoherence verifica que una nota no sea anterior al documento que
+// modifica ni se emita fuera del plazo, y que un comprobante de contingencia no tenga
+// fecha posterior a la caída declarada. Las fechas con formato inválido las reporta
+// date_validation y aquí se omiten.
+func (v *ValidationService) checkIssueDateCoherence(doc *BusinessDocument) []ValidationError {
+	if v.issueDateCheck == IssueDateCheckOff {
+		return nil
+	}
+	issued, err := time.Parse("2006-01-02", doc.IssueDate)
+	if err != nil {
+		return nil
+	}
+
+	var errors []ValidationError
+	if doc.Type == "07" || doc.Type == "08" {
+		for i, ref := range noteReferences(doc) {
+			referenced, err := time.Parse("2006-01-02", ref.IssueDate)
+			if err != nil {
+				continue
+			}
+			field := referenceField(doc, i) + ".issueDate"
+			days := int(issued.Sub(referenced).Hours() / 24)
+			switch {
+			case days < 0:
+				errors = append(errors, ValidationError{
+					Field:    field,
+					Expected: fmt.Sprintf("On or before %s", doc.IssueDate),
+					Received: ref.IssueDate,
+					Rule:     IssueDateCoherenceRule,
+					Message:  fmt.Sprintf("Note issue date %s is before the issue date %s of the document it modifies (%s)", doc.IssueDate, ref.IssueDate, ref.DocumentID),
+				})
+			case v.noteMaxDays > 0 && days > v.noteMaxDays:
+				errors = append(errors, ValidationError{
+					Field:    "issueDate",
+					Expected: fmt.Sprintf("On or before %s", referenced.AddDate(0, 0, v.noteMaxDays).Format("2006-01-02")),
+					Received: doc.IssueDate,
+					Rule:     IssueDateCoherenceRule,
+					Message:  fmt.Sprintf("Note issue date %s is %d days after the issue date %s of the document it modifies (%s); the limit is %d days", doc.IssueDate, days, ref.IssueDate, ref.DocumentID, v.noteMaxDays),
+				})
+			}
+		}
+	}
+
+	if doc.Contingency && doc.ContingencyDate != "" {
+		if outage, err := time.Parse("2006-01-02", doc.ContingencyDate); err == nil && issued.After(outage) {
+			errors = append(errors, ValidationError{
+				Field:    "issueDate",
+				Expected: fmt.Sprintf("On or before %s", doc.ContingencyDate),
+				Received: doc.IssueDate,
+				Rule:     IssueDateCoherenceRule,
+				Message:  fmt.Sprintf("Contingency document issue date %s is after the declared outage date %s", doc.IssueDate, doc.ContingencyDate),
+			})
+		}
+	}
+	return errors
+}
+
+// validateContingencyDate valida el formato del día de la caída y que solo lo indique
+// un comprobante de contingencia
+func (v *ValidationService) validateContingencyDate(doc *BusinessDocument) []ValidationError {
+	if doc.ContingencyDate == "" {
+		return nil
+	}
+	if !doc.Contingency {
+		return []ValidationError{{
+			Field:    "contingencyDate",
+			Expected: "contingency: true",
+			Received: doc.ContingencyDate,
+			Rule:     "contingency_series_validation",
+			Message:  "Only contingency documents declare an outage date",
+		}}
+	}
+	if !v.isValidDate(doc.ContingencyDate) {
+		return []ValidationError{{
+			Field:      "contingencyDate",
+			Expected:   "Valid date format YYYY-MM-DD",
+			Received:   doc.ContingencyDate,
+			Rule:       "date_validation",
+			Message:    "Contingency date format is invalid",
+			Suggestion: dateSuggestion(doc.ContingencyDate),
+		}}
+	}
+	return nil
+}
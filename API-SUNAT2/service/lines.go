@@ -0,0 +1,28 @@
+package service
+
+import (
+	"strconv"
+
+	. "API-SUNAT2/model"
+)
+
+// documentLine es un ítem emitido como línea del comprobante con su cbc:ID
+type documentLine struct {
+	ID   string
+	Item DocumentItem
+}
+
+// documentLines retorna los ítems que se emiten como líneas del comprobante,
+// numerados 1..N. Las líneas informativas con cantidad cero no se emiten. Es el
+// único lugar donde se filtran y numeran las líneas: LineCountNumeric y los cbc:ID
+// de línea se derivan de su resultado.
+func documentLines(doc *BusinessDocument) []documentLine {
+	lines := make([]documentLine, 0, len(doc.Items))
+	for _, item := range doc.Items {
+		if item.Informative && item.Quantity == 0 {
+			continue
+		}
+		lines = append(lines, documentLine{ID: strconv.Itoa(len(lines) + 1), Item: item})
+	}
+	return lines
+}
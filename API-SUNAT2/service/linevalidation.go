@@ -0,0 +1,163 @@
+package service
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	. "API-SUNAT2/model"
+)
+
+// ParallelLineThreshold es la cantidad de líneas desde la que la validación por línea se
+// reparte entre goroutines; por debajo el costo de coordinarlas supera la ganancia
+const ParallelLineThreshold = 512
+
+// SetLineWorkers configura la cantidad máxima de goroutines que validan las líneas de un
+// documento: 0 usa GOMAXPROCS y 1 valida en forma secuencial
+func (v *ValidationService) SetLineWorkers(workers int) {
+	if workers >= 0 {
+		v.lineWorkers = workers
+	}
+}
+
+// lineWorkerCount retorna las goroutines a usar para un documento con lines líneas
+func (v *ValidationService) lineWorkerCount(lines int) int {
+	workers := v.lineWorkers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if lines < ParallelLineThreshold || workers < 1 {
+		return 1
+	}
+	// Cada goroutine valida al menos la mitad del umbral
+	if limit := lines / (ParallelLineThreshold / 2); workers > limit {
+		workers = limit
+	}
+	return workers
+}
+
+// lineRange es un tramo contiguo [start, end) de las líneas de un documento
+type lineRange struct {
+	start, end int
+}
+
+// forEachLineRange parte las lines líneas en tramos contiguos, uno por goroutine, y
+// llama a validate con cada uno; retorna cuando terminaron todos. Hay a lo sumo
+// lineWorkerCount(lines) tramos; su índice permite a validate guardar su resultado para
+// combinarlo en el orden de las líneas, así el resultado es el mismo que el secuencial.
+func (v *ValidationService) forEachLineRange(lines int, validate func(chunk int, r lineRange)) {
+	workers := v.lineWorkerCount(lines)
+	if workers == 1 {
+		validate(0, lineRange{0, lines})
+		return
+	}
+
+	size := (lines + workers - 1) / workers
+	var wg sync.WaitGroup
+	chunks := 0
+	for start := 0; start < lines; start += size {
+		end := start + size
+		if end > lines {
+			end = lines
+		}
+		wg.Add(1)
+		go func(chunk int, r lineRange) {
+			defer wg.Done()
+			validate(chunk, r)
+		}(chunks, lineRange{start, end})
+		chunks++
+	}
+	wg.Wait()
+}
+
+// validateItems valida cada línea del documento, en paralelo si tiene muchas
+func (v *ValidationService) validateItems(doc *BusinessDocument) []ValidationError {
+	results := make([][]ValidationError, v.lineWorkerCount(len(doc.Items)))
+	v.forEachLineRange(len(doc.Items), func(chunk int, r lineRange) {
+		results[chunk] = v.validateItemRange(doc, r.start, r.end)
+	})
+	return concatErrors(results)
+}
+
+// concatErrors concatena los errores de cada tramo en el orden de los tramos
+func concatErrors(results [][]ValidationError) []ValidationError {
+	var errors []ValidationError
+	for _, result := range results {
+		errors = append(errors, result...)
+	}
+	return errors
+}
+
+// validateItemRange valida las líneas [start, end); solo lee el documento, así varios
+// tramos pueden validarse a la vez
+func (v *ValidationService) validateItemRange(doc *BusinessDocument, start, end int) []ValidationError {
+	var errors []ValidationError
+	for i := start; i < end; i++ {
+		errors = append(errors, v.validateItem(doc, i)...)
+	}
+	return errors
+}
+
+// validateItem valida la unidad, el tipo de afectación, la descripción, la cantidad y
+// el precio de una línea
+func (v *ValidationService) validateItem(doc *BusinessDocument, i int) []ValidationError {
+	var errors []ValidationError
+	item := &doc.Items[i]
+
+	// Las unidades ya vienen con el mapeo del emisor aplicado
+	if !isValidUnitCode(item.UnitCode) {
+		errors = append(errors, ValidationError{
+			Field:      fmt.Sprintf("items[%d].unitCode", i),
+			Expected:   "Unit code from catalog 03 (UN/ECE rec. 20)",
+			Received:   item.UnitCode,
+			Rule:       "unit_code_validation",
+			Message:    "Unit code is not valid and the issuer has no mapping for it",
+			Suggestion: unitCodeSuggestion(doc.Issuer.DocumentID, item.UnitCode),
+		})
+	}
+
+	errors = append(errors, v.validateAffectationCodes(*item, i)...)
+
+	if length := utf8.RuneCountInString(item.Description); length > MaxItemDescriptionLength {
+		errors = append(errors, ValidationError{
+			Field:    fmt.Sprintf("items[%d].description", i),
+			Expected: fmt.Sprintf("At most %d characters", MaxItemDescriptionLength),
+			Received: strconv.Itoa(length),
+			Rule:     "description_length_validation",
+			Message:  "Item description is too long",
+		})
+	}
+
+	// Las líneas informativas con cantidad cero no se emiten y no llevan precio
+	if item.Informative && item.Quantity == 0 {
+		return errors
+	}
+
+	// Las "líneas de descuento" de los ERP se rechazan sugiriendo el descuento equivalente
+	if isNegativeLine(*item) {
+		return append(errors, negativeLineError(i, *item))
+	}
+
+	if item.Quantity <= 0 {
+		errors = append(errors, ValidationError{
+			Field:    fmt.Sprintf("items[%d].quantity", i),
+			Expected: "Greater than 0",
+			Received: fmt.Sprintf("%.2f", item.Quantity),
+			Rule:     "quantity_validation",
+			Message:  "Quantity must be greater than 0 unless the item is informative",
+		})
+	}
+
+	if item.UnitPrice <= 0 {
+		errors = append(errors, ValidationError{
+			Field:    fmt.Sprintf("items[%d].unitPrice", i),
+			Expected: "Greater than 0",
+			Received: fmt.Sprintf("%.2f", item.UnitPrice),
+			Rule:     "price_validation",
+			Message:  "Unit price must be greater than 0",
+		})
+	}
+	return errors
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	. "API-SUNAT2/model"
+)
+
+// HistorySuffix es la extensión del historial de estados de un documento en el store
+const HistorySuffix = ".historial"
+
+// Estados del historial que no vienen de un envío a SUNAT
+const (
+	// DocumentGenerated es el documento firmado y guardado por el pipeline
+	DocumentGenerated = "GENERADO"
+	// DocumentVoided es el documento anulado localmente para el resumen diario
+	DocumentVoided = "ANULADO"
+	// SubmissionFailed es un envío que SUNAT respondió con error sin registrar el documento
+	SubmissionFailed = "ERROR_ENVIO"
+)
+
+var (
+	ErrInvalidDocumentKey = errors.New("ruc, type, series and number must identify a document (RUC-TIPO-SERIE-NUMERO)")
+	ErrDocumentNotFound   = errors.New("document not found")
+)
+
+// lookupEnvironments son los ambientes en que puede haber un envío registrado
+var lookupEnvironments = []string{EnvironmentBeta, EnvironmentHomologation, EnvironmentProduction, EnvironmentMock}
+
+// DocumentKey arma la clave compuesta RUC-TIPO-SERIE-NUMERO de un documento, la que
+// nombra todos sus archivos en el store. La serie se normaliza a mayúsculas y el
+// correlativo a su forma canónica, sin ceros a la izquierda.
+func DocumentKey(ruc, docType, series, number string) string {
+	return fmt.Sprintf("%s-%s-%s-%s", strings.TrimSpace(ruc), strings.TrimSpace(docType),
+		strings.ToUpper(strings.TrimSpace(series)), CanonicalNumber(number))
+}
+
+// FindDocument retorna el estado de un documento a partir de su clave compuesta. Los
+// archivos se leen directamente por nombre, sin recorrer el store.
+func (s *UBLConverterService) FindDocument(ruc, docType, series, number string) (*DocumentLookup, error) {
+	documentID := DocumentKey(ruc, docType, series, number)
+	if !documentIDPattern.MatchString(documentID) {
+		return nil, ErrInvalidDocumentKey
+	}
+	return s.findDocument(documentID)
+}
+
+// findDocument retorna el estado del documento con un identificador ya validado
+func (s *UBLConverterService) findDocument(documentID string) (*DocumentLookup, error) {
+	data, err := s.store.Read(RecordName(documentID))
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	lookup := &DocumentLookup{Artifacts: map[string]string{}, Submissions: []SubmissionRecord{}}
+	if err := json.Unmarshal(data, &lookup.Record); err != nil {
+		return nil, fmt.Errorf("invalid document record %s: %v", documentID, err)
+	}
+
+	for kind, name := range map[string]string{
+		"xml":       documentID + ".xml",
+		"zip":       documentID + ".zip",
+		"timestamp": documentID + ".tsr",
+		"record":    RecordName(documentID),
+	} {
+		if _, err := s.store.Read(name); err == nil {
+			lookup.Artifacts[kind] = s.store.Path(name)
+		}
+	}
+
+	var latest *SubmissionRecord
+	for _, environment := range lookupEnvironments {
+		data, err := s.store.Read(fmt.Sprintf("%s.%s.envio", documentID, environment))
+		if err != nil {
+			continue
+		}
+		var record SubmissionRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("invalid submission record %s: %v", documentID, err)
+		}
+		lookup.Submissions = append(lookup.Submissions, record)
+		if record.CDRFile != "" && (latest == nil || record.SentAt.After(latest.SentAt)) {
+			latest = &lookup.Submissions[len(lookup.Submissions)-1]
+		}
+	}
+	if latest != nil {
+		if content, err := s.store.Read(latest.CDRFile); err == nil {
+			lookup.Artifacts["cdr"] = s.store.Path(latest.CDRFile)
+			lookup.CDR = &DocumentCDR{Environment: latest.Environment, File: latest.CDRFile, Content: content}
+			if result, err := ParseCDR(content); err == nil {
+				lookup.CDR.CDRResult = *result
+			}
+		}
+	}
+
+	lookup.History = []StatusChange{{Status: DocumentGenerated, Detail: lookup.Record.Source, At: lookup.Record.CreatedAt}}
+	history, err := s.readStatusHistory(documentID)
+	if err != nil {
+		return nil, err
+	}
+	lookup.History = append(lookup.History, history...)
+	lookup.Status = lookup.History[len(lookup.History)-1].Status
+	return lookup, nil
+}
+
+// readStatusHistory retorna los cambios de estado registrados después de generar el documento
+func (s *UBLConverterService) readStatusHistory(documentID string) ([]StatusChange, error) {
+	data, err := s.store.Read(documentID + HistorySuffix)
+	if err != nil {
+		return nil, nil
+	}
+	var history []StatusChange
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("invalid status history %s: %v", documentID, err)
+	}
+	return history, nil
+}
+
+// recordStatusChange agrega un cambio de estado al historial del documento y publica su
+// evento. Un fallo solo se registra en el log: el historial no debe impedir el envío ni
+// la anulación.
+func (s *UBLConverterService) recordStatusChange(documentID, status, environment, detail string) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	change := StatusChange{Status: status, Environment: environment, Detail: detail, At: s.clock.Now()}
+	if eventType, ok := statusEventTypes[status]; ok {
+		s.emitDocumentEvent(eventType, documentID, change)
+	}
+
+	history, err := s.readStatusHistory(documentID)
+	if err == nil {
+		history = append(history, change)
+		var data []byte
+		if data, err = json.Marshal(history); err == nil {
+			_, err = s.store.Save(documentID+HistorySuffix, data)
+		}
+	}
+	if err != nil {
+		s.GetLogger().Warnf("No se pudo registrar el estado %s de %s: %v", status, documentID, err)
+	}
+}
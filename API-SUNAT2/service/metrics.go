@@ -0,0 +1,164 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"API-SUNAT2/storage"
+)
+
+// Límites por defecto del tamaño de los documentos
+const (
+	DefaultMaxItems    = 2000
+	DefaultMaxXMLBytes = 10 * 1024 * 1024
+)
+
+// MaxXMLSizeSamples es la cantidad de tamaños que se conservan por emisor y ambiente;
+// con más documentos los percentiles se calculan sobre una muestra uniforme
+const MaxXMLSizeSamples = 1000
+
+// XMLSizesSuffix es la extensión de los archivos de tamaños de XML
+const XMLSizesSuffix = ".tamanos"
+
+// XMLSizesName retorna el archivo de tamaños de un emisor: sin ambiente son los XML
+// generados y con ambiente los enviados a él
+func XMLSizesName(ruc, environment string) string {
+	if environment == "" {
+		return fmt.Sprintf("tamanos-%s%s", ruc, XMLSizesSuffix)
+	}
+	return fmt.Sprintf("tamanos-%s.%s%s", ruc, environment, XMLSizesSuffix)
+}
+
+// SizeStats resume los tamaños en bytes de los XML generados por un emisor
+type SizeStats struct {
+	Count int `json:"count"`
+	P50   int `json:"p50Bytes"`
+	P90   int `json:"p90Bytes"`
+	P99   int `json:"p99Bytes"`
+	Max   int `json:"maxBytes"`
+}
+
+// XMLSizeSample es la muestra de tamaños de un emisor y ambiente guardada en el store.
+// Count y Max son exactos; Sizes conserva a lo sumo MaxXMLSizeSamples tamaños elegidos
+// con reservoir sampling.
+type XMLSizeSample struct {
+	RUC         string `json:"ruc"`
+	Environment string `json:"environment,omitempty"`
+	Count       int    `json:"count"`
+	Max         int    `json:"maxBytes"`
+	Sizes       []int  `json:"sizes"`
+}
+
+// add suma un tamaño a la muestra; random(n) retorna un entero en [0, n)
+func (sample *XMLSizeSample) add(size int, random func(n int) int) {
+	sample.Count++
+	if size > sample.Max {
+		sample.Max = size
+	}
+	if len(sample.Sizes) < MaxXMLSizeSamples {
+		sample.Sizes = append(sample.Sizes, size)
+		return
+	}
+	if i := random(sample.Count); i < len(sample.Sizes) {
+		sample.Sizes[i] = size
+	}
+}
+
+// stats retorna los percentiles de la muestra
+func (sample XMLSizeSample) stats() SizeStats {
+	sorted := append([]int(nil), sample.Sizes...)
+	sort.Ints(sorted)
+	if len(sorted) == 0 {
+		return SizeStats{Count: sample.Count, Max: sample.Max}
+	}
+	percentile := func(p float64) int {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	return SizeStats{
+		Count: sample.Count,
+		P50:   percentile(0.50),
+		P90:   percentile(0.90),
+		P99:   percentile(0.99),
+		Max:   sample.Max,
+	}
+}
+
+// SizeRegistry registra el tamaño de cada XML en el store, agrupado por emisor y
+// ambiente, con una muestra acotada por grupo
+type SizeRegistry struct {
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+func NewSizeRegistry() *SizeRegistry {
+	return &SizeRegistry{random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Record suma el tamaño a la muestra del emisor y ambiente guardada en el store
+func (r *SizeRegistry) Record(store storage.DocumentStore, issuer, environment string, size int) error {
+	if !rucPattern.MatchString(issuer) {
+		issuer = unknownIssuer
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := XMLSizesName(issuer, environment)
+	sample := XMLSizeSample{RUC: issuer, Environment: environment}
+	if data, err := store.Read(name); err == nil {
+		if err := json.Unmarshal(data, &sample); err != nil {
+			return fmt.Errorf("invalid XML sizes %s: %v", name, err)
+		}
+	}
+	sample.add(size, r.random.Intn)
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	_, err = store.Save(name, data)
+	return err
+}
+
+// Report retorna los percentiles de tamaño por emisor de los XML generados (environment
+// vacío) o de los enviados al ambiente indicado
+func (r *SizeRegistry) Report(store storage.DocumentStore, environment string) (map[string]SizeStats, error) {
+	names, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	report := make(map[string]SizeStats)
+	for _, name := range names {
+		if !strings.HasPrefix(name, "tamanos-") || !strings.HasSuffix(name, XMLSizesSuffix) {
+			continue
+		}
+		data, err := store.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		var sample XMLSizeSample
+		if err := json.Unmarshal(data, &sample); err != nil {
+			return nil, fmt.Errorf("invalid XML sizes %s: %v", name, err)
+		}
+		if sample.Environment == environment {
+			report[sample.RUC] = sample.stats()
+		}
+	}
+	return report, nil
+}
+
+// recordXMLSize registra el tamaño de un XML; un error solo se advierte en el log
+func (s *UBLConverterService) recordXMLSize(issuer, environment string, size int) {
+	if err := s.sizes.Record(s.store, issuer, environment, size); err != nil {
+		s.GetLogger().Warnf("No se pudo registrar el tamaño del XML de %s: %v", issuer, err)
+	}
+}
+
+// XMLSizeReport retorna los percentiles de tamaño por emisor de los XML generados, o
+// de los enviados al ambiente si se indica
+func (s *UBLConverterService) XMLSizeReport(environment string) (map[string]SizeStats, error) {
+	return s.sizes.Report(s.store, environment)
+}
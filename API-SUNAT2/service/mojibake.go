@@ -0,0 +1,223 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	. "API-SUNAT2/model"
+)
+
+// ErrInvalidEncodingCode es el código con que se rechaza en modo estricto un documento
+// con texto mal codificado
+const ErrInvalidEncodingCode = "ERR_INVALID_ENCODING"
+
+// Modos de la corrección de mojibake
+const (
+	// MojibakeOff no revisa la codificación de los textos
+	MojibakeOff = "off"
+	// MojibakeFix corrige los textos doblemente codificados y lo reporta como warning
+	MojibakeFix = "fix"
+	// MojibakeStrict rechaza el documento con ERR_INVALID_ENCODING
+	MojibakeStrict = "strict"
+)
+
+// IsValidMojibakeMode indica si el modo de corrección de mojibake es conocido
+func IsValidMojibakeMode(mode string) bool {
+	return mode == MojibakeOff || mode == MojibakeFix || mode == MojibakeStrict
+}
+
+// maxMojibakePasses limita las correcciones sucesivas de un texto codificado más de
+// una vez (ÃƒÂ± → Ã± → ñ)
+const maxMojibakePasses = 3
+
+// cp1252 son los caracteres de Windows-1252 en 0x80-0x9F, que es como suele leerse
+// Latin-1 en el sistema de origen (â€œ por “)
+var cp1252 = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// latin1Byte retorna el byte con que el carácter se lee en Latin-1 o Windows-1252
+func latin1Byte(r rune) (byte, bool) {
+	if r >= 0x80 && r <= 0xFF {
+		return byte(r), true
+	}
+	b, ok := cp1252[r]
+	return b, ok
+}
+
+// plausibleRune indica si el carácter es uno que un texto en español codificado dos
+// veces puede haber tenido: letras latinas con tilde, signos y comillas tipográficas.
+// Descarta las lecturas que darían por ejemplo árabe ("Ú»" es U+06BB en UTF-8).
+func plausibleRune(r rune) bool {
+	return (r >= 0xA0 && r <= 0x17F) || (r >= 0x2010 && r <= 0x206F) || r == '€' || r == '™'
+}
+
+// mojibakeIssue es la primera secuencia mal codificada de un texto: su posición (en
+// caracteres) y el byte con que empieza
+type mojibakeIssue struct {
+	position  int
+	offending byte
+}
+
+// fixMojibake corrige un pase de doble codificación: cada tramo de caracteres de
+// Latin-1/Windows-1252 se vuelve a leer como UTF-8 y se reemplaza solo si el resultado
+// es UTF-8 válido y plausible. "SÃO PAULO" o "AÇÃO" no cambian porque sus bytes no
+// forman UTF-8 válido.
+func fixMojibake(text string) (string, *mojibakeIssue) {
+	runes := []rune(text)
+	var out strings.Builder
+	var issue *mojibakeIssue
+	for i := 0; i < len(runes); {
+		if _, ok := latin1Byte(runes[i]); !ok {
+			out.WriteRune(runes[i])
+			i++
+			continue
+		}
+		start := i
+		var raw []byte
+		for ; i < len(runes); i++ {
+			b, ok := latin1Byte(runes[i])
+			if !ok {
+				break
+			}
+			raw = append(raw, b)
+		}
+		decoded, ok := decodeMojibake(raw)
+		if !ok {
+			out.WriteString(string(runes[start:i]))
+			continue
+		}
+		if issue == nil {
+			issue = &mojibakeIssue{position: start, offending: raw[0]}
+		}
+		out.WriteString(decoded)
+	}
+	return out.String(), issue
+}
+
+// decodeMojibake lee los bytes como UTF-8; los bytes que no forman una secuencia
+// válida y plausible se conservan como el carácter original
+func decodeMojibake(raw []byte) (string, bool) {
+	var out strings.Builder
+	changed := false
+	for len(raw) > 0 {
+		r, size := utf8.DecodeRune(raw)
+		if size > 1 && r != utf8.RuneError && plausibleRune(r) {
+			out.WriteRune(r)
+			changed = true
+		} else {
+			out.WriteString(latin1Rune(raw[0]))
+			size = 1
+		}
+		raw = raw[size:]
+	}
+	return out.String(), changed
+}
+
+// latin1Rune es la inversa de latin1Byte
+func latin1Rune(b byte) string {
+	for r, cb := range cp1252 {
+		if cb == b {
+			return string(r)
+		}
+	}
+	return string(rune(b))
+}
+
+// FixMojibake corrige los textos doblemente codificados, también los codificados más
+// de una vez; retorna false si el texto no tenía secuencias mal codificadas
+func FixMojibake(text string) (string, bool) {
+	fixed, issue := repairMojibake(text)
+	return fixed, issue != nil
+}
+
+// repairMojibake aplica fixMojibake hasta que el texto no cambie y retorna la primera
+// secuencia mal codificada del original
+func repairMojibake(text string) (string, *mojibakeIssue) {
+	fixed, first := fixMojibake(text)
+	for pass := 1; pass < maxMojibakePasses && first != nil; pass++ {
+		next, issue := fixMojibake(fixed)
+		if issue == nil {
+			break
+		}
+		fixed = next
+	}
+	return fixed, first
+}
+
+// SetMojibakeMode configura la corrección de textos mal codificados (off, fix o
+// strict); valores desconocidos se ignoran
+func (s *UBLConverterService) SetMojibakeMode(mode string) {
+	if IsValidMojibakeMode(mode) {
+		s.mojibakeMode = mode
+	}
+}
+
+// checkMojibake revisa los campos de texto del documento. En modo fix corrige los mal
+// codificados y retorna un warning por campo; en modo strict retorna un error por campo
+// sin modificar el documento.
+func (s *UBLConverterService) checkMojibake(doc *BusinessDocument) (errors, warnings []ValidationError) {
+	if s.mojibakeMode != MojibakeFix && s.mojibakeMode != MojibakeStrict {
+		return nil, nil
+	}
+	walkText(reflect.ValueOf(doc).Elem(), "", func(path string, field reflect.Value) {
+		original := field.String()
+		fixed, issue := repairMojibake(original)
+		if issue == nil {
+			return
+		}
+		if s.mojibakeMode == MojibakeStrict {
+			errors = append(errors, ValidationError{
+				Field:      path,
+				Expected:   "UTF-8 text",
+				Received:   fmt.Sprintf("byte 0x%02X at position %d", issue.offending, issue.position),
+				Rule:       "invalid_encoding",
+				Message:    "Text looks double-encoded (Latin-1 read as UTF-8)",
+				Suggestion: fmt.Sprintf("Send %q encoded as UTF-8", fixed),
+			})
+			return
+		}
+		field.SetString(fixed)
+		warnings = append(warnings, ValidationError{
+			Field:    path,
+			Expected: fixed,
+			Received: original,
+			Rule:     "mojibake_fixed",
+			Message:  "Double-encoded text was corrected",
+		})
+	})
+	return errors, warnings
+}
+
+// walkText recorre los campos string del documento con su path JSON. Los mapas
+// (additional) no se recorren: sus valores no se emiten como texto libre.
+func walkText(v reflect.Value, path string, visit func(path string, field reflect.Value)) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			walkText(v.Elem(), path, visit)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			walkText(v.Field(i), joinPath(path, name), visit)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkText(v.Index(i), fmt.Sprintf("%s[%d]", path, i), visit)
+		}
+	case reflect.String:
+		if v.CanSet() {
+			visit(path, v)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+
+	. "API-SUNAT2/model"
+	"API-SUNAT2/util/httpclient"
+)
+
+// CertificateNotifier envía la alerta de un certificado próximo a vencer
+type CertificateNotifier interface {
+	NotifyCertificateExpiring(ctx context.Context, cert ExpiringCertificate) error
+}
+
+// Nombres de los eventos que reciben los webhooks
+const (
+	CertificateExpiringEvent = "certificate.expiring"
+	EndOfDayPendingEvent     = "end_of_day.pending"
+)
+
+// WebhookNotifier publica las alertas como JSON: POST {url} con
+// {"event": "certificate.expiring", "certificate": {...}} o
+// {"event": "end_of_day.pending", "report": {...}}
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier crea el notificador; si client es nil se usa el del pool
+// compartido del proceso
+func NewWebhookNotifier(url string, client *http.Client) *WebhookNotifier {
+	if client == nil {
+		client = httpclient.Default().Client(httpclient.DestinationWebhook)
+	}
+	return &WebhookNotifier{url: url, client: client}
+}
+
+func (n *WebhookNotifier) NotifyCertificateExpiring(ctx context.Context, cert ExpiringCertificate) error {
+	return n.post(ctx, map[string]interface{}{
+		"event":       CertificateExpiringEvent,
+		"certificate": cert,
+	})
+}
+
+func (n *WebhookNotifier) NotifyEndOfDay(ctx context.Context, report *EndOfDayReport) error {
+	return n.post(ctx, map[string]interface{}{
+		"event":  EndOfDayPendingEvent,
+		"report": report,
+	})
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPNotifier envía las alertas por correo a través de un servidor SMTP (host:puerto)
+type SMTPNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+// NewSMTPNotifier crea el notificador; sin usuario el servidor se usa sin autenticación
+func NewSMTPNotifier(addr, username, password, from string, to []string) *SMTPNotifier {
+	var auth smtp.Auth
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPNotifier{addr: addr, auth: auth, from: from, to: to}
+}
+
+func (n *SMTPNotifier) NotifyCertificateExpiring(ctx context.Context, cert ExpiringCertificate) error {
+	subject := fmt.Sprintf("Certificado de firma de %s vence en %d días", cert.IssuerRUC, cert.DaysLeft)
+	if cert.DaysLeft < 0 {
+		subject = fmt.Sprintf("Certificado de firma de %s vencido", cert.IssuerRUC)
+	}
+
+	body := fmt.Sprintf("RUC: %s\r\nCertificado: %s\r\nSerie: %s\r\nVence: %s\r\n",
+		cert.IssuerRUC, cert.Subject, cert.SerialNumber, cert.NotAfter.Format("2006-01-02 15:04:05 MST"))
+	return n.send(ctx, subject, body)
+}
+
+func (n *SMTPNotifier) NotifyEndOfDay(ctx context.Context, report *EndOfDayReport) error {
+	subject := fmt.Sprintf("Cierre del %s: %d comprobantes pendientes de envío", report.Date, report.Pending)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Emitidos: %d\r\nEnviados: %d\r\nAnulados o purgados: %d\r\nPendientes: %d\r\n",
+		report.Issued, report.Sent, report.Explained, report.Pending)
+	for _, issuer := range report.Issuers {
+		fmt.Fprintf(&body, "\r\nRUC %s: %d pendientes de %d\r\n", issuer.IssuerRUC, issuer.Pending, issuer.Issued)
+		for _, doc := range issuer.Documents {
+			fmt.Fprintf(&body, "  %s [%s] %s\r\n", doc.DocumentID, doc.Status, doc.Reason)
+		}
+	}
+	return n.send(ctx, subject, body.String())
+}
+
+func (n *SMTPNotifier) send(ctx context.Context, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprint(&msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(body)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(n.addr, n.auth, n.from, n.to, msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp send failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	. "API-SUNAT2/model"
+)
+
+// MaxDocumentNumberDigits es la longitud máxima del correlativo que admite SUNAT
+const MaxDocumentNumberDigits = 8
+
+// canonicalNumberPattern es un correlativo canónico: de 1 a 99999999 sin ceros a la
+// izquierda
+var canonicalNumberPattern = regexp.MustCompile(`^[1-9]\d{0,7}$`)
+
+// CanonicalNumber retorna el correlativo sin ceros a la izquierda: "00000123" y "123"
+// son el mismo comprobante. Es la forma con que se emite el cbc:ID del XML y se nombran
+// los archivos del store. Un valor que no es numérico se retorna sin cambios.
+func CanonicalNumber(number string) string {
+	number = strings.TrimSpace(number)
+	if number == "" || strings.Trim(number, "0123456789") != "" {
+		return number
+	}
+	if trimmed := strings.TrimLeft(number, "0"); trimmed != "" {
+		return trimmed
+	}
+	return "0"
+}
+
+// canonicalSeriesNumber normaliza el correlativo de un SERIE-NUMERO
+func canonicalSeriesNumber(id string) string {
+	i := strings.LastIndex(id, "-")
+	if i < 0 {
+		return id
+	}
+	return id[:i+1] + CanonicalNumber(id[i+1:])
+}
+
+// documentKeyPattern reconoce un RUC-TIPO-SERIE-NUMERO con el correlativo en cualquier
+// forma, incluso con más ceros a la izquierda de los que caben en 8 dígitos
+var documentKeyPattern = regexp.MustCompile(`^\d{11}-\d{2}-[A-Z0-9]{4}-\d+$`)
+
+// CanonicalDocumentID normaliza el correlativo de un RUC-TIPO-SERIE-NUMERO, para que
+// las búsquedas acepten el número con o sin ceros a la izquierda. Otros identificadores
+// (resúmenes, comunicaciones de baja) se retornan sin cambios.
+func CanonicalDocumentID(documentID string) string {
+	documentID = strings.TrimSpace(documentID)
+	if !documentKeyPattern.MatchString(documentID) {
+		return documentID
+	}
+	return canonicalSeriesNumber(documentID)
+}
+
+// normalizeNumbers lleva a la forma canónica el correlativo del documento y los de los
+// documentos que referencia. Retorna un warning por cada valor que cambió.
+func normalizeNumbers(doc *BusinessDocument) []ValidationError {
+	var warnings []ValidationError
+	normalize := func(field string, value *string, canonical func(string) string) {
+		if normalized := canonical(*value); normalized != *value {
+			warnings = append(warnings, ValidationError{
+				Field:    field,
+				Expected: normalized,
+				Received: *value,
+				Rule:     "number_normalized",
+				Message:  "Leading zeros were removed from the document number",
+			})
+			*value = normalized
+		}
+	}
+
+	normalize("number", &doc.Number, CanonicalNumber)
+	if doc.Reference != nil {
+		normalize("reference.documentId", &doc.Reference.DocumentID, canonicalSeriesNumber)
+	}
+	for i := range doc.References {
+		normalize(fmt.Sprintf("references[%d].documentId", i), &doc.References[i].DocumentID, canonicalSeriesNumber)
+	}
+	for i := range doc.ExchangedDocuments {
+		normalize(fmt.Sprintf("exchangedDocuments[%d].documentId", i), &doc.ExchangedDocuments[i].DocumentID, canonicalSeriesNumber)
+	}
+	for i := range doc.Advances {
+		normalize(fmt.Sprintf("advances[%d].documentId", i), &doc.Advances[i].DocumentID, canonicalSeriesNumber)
+	}
+	return warnings
+}
+
+// validateNumber verifica que el correlativo tenga a lo sumo 8 dígitos sin contar los
+// ceros a la izquierda y no sea cero
+func (v *ValidationService) validateNumber(doc *BusinessDocument) []ValidationError {
+	if canonicalNumberPattern.MatchString(CanonicalNumber(doc.Number)) {
+		return nil
+	}
+	return []ValidationError{{
+		Field:      "number",
+		Expected:   fmt.Sprintf("Number from 1 to %d digits", MaxDocumentNumberDigits),
+		Received:   doc.Number,
+		Rule:       "number_validation",
+		Message:    "Document number must be between 1 and 99999999",
+		Suggestion: "Send the correlative number without series, e.g. 123",
+	}}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	. "API-SUNAT2/model"
+)
+
+// Límites por defecto de las observaciones libres del emisor
+const (
+	DefaultMaxObservations      = 10
+	DefaultMaxObservationLength = 200
+)
+
+// SetObservationLimits configura la cantidad máxima de observaciones y su longitud
+func (v *ValidationService) SetObservationLimits(maxObservations, maxLength int) {
+	if maxObservations > 0 {
+		v.maxObservations = maxObservations
+	}
+	if maxLength > 0 {
+		v.maxObservationLength = maxLength
+	}
+}
+
+// validateObservations valida la cantidad y la longitud de las observaciones
+func (v *ValidationService) validateObservations(doc *BusinessDocument) []ValidationError {
+	var errors []ValidationError
+	if len(doc.Observations) > v.maxObservations {
+		errors = append(errors, ValidationError{
+			Field:    "observations",
+			Expected: fmt.Sprintf("At most %d observations", v.maxObservations),
+			Received: strconv.Itoa(len(doc.Observations)),
+			Rule:     "observations_count_validation",
+			Message:  "Too many observations",
+		})
+	}
+	for i, observation := range doc.Observations {
+		length := utf8.RuneCountInString(observation)
+		if strings.TrimSpace(observation) == "" || length > v.maxObservationLength {
+			errors = append(errors, ValidationError{
+				Field:    fmt.Sprintf("observations[%d]", i),
+				Expected: fmt.Sprintf("Between 1 and %d characters", v.maxObservationLength),
+				Received: strconv.Itoa(length),
+				Rule:     "observation_length_validation",
+				Message:  "Observation must not be empty or too long",
+			})
+		}
+	}
+	return errors
+}
+
+// observationNotes emite las observaciones como cbc:Note sin código de leyenda. Van
+// al final, después de las leyendas obligatorias; encoding/xml escapa su contenido.
+func observationNotes(doc *BusinessDocument) []UBLNote {
+	var notes []UBLNote
+	for _, observation := range doc.Observations {
+		notes = append(notes, UBLNote{Value: observation})
+	}
+	return notes
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	. "API-SUNAT2/model"
+)
+
+// DefaultOperationType es el tipo de operación del catálogo 51 de un documento que no
+// lo indica: venta interna
+const DefaultOperationType = "0101"
+
+// DetractionOperationType es el tipo de operación de las ventas sujetas a detracción
+const DetractionOperationType = "1001"
+
+// operationProfile describe un tipo de operación del catálogo 51 admitido como ProfileID
+type operationProfile struct {
+	description string
+	// export indica una exportación: sus líneas no pueden gravarse con IGV
+	export bool
+}
+
+// operationProfiles es la tabla de tipos de operación que el servicio sabe emitir
+var operationProfiles = map[string]operationProfile{
+	"0101":                  {description: "Venta interna"},
+	"0102":                  {description: "Venta interna - Itinerante"},
+	"0103":                  {description: "Venta interna - Anticipos"},
+	"0104":                  {description: "Venta interna - Sustenta gastos deducibles persona natural"},
+	"0200":                  {description: "Exportación de bienes", export: true},
+	"0201":                  {description: "Exportación de servicios - Prestación de servicios realizados íntegramente en el país", export: true},
+	"0202":                  {description: "Exportación de servicios - Prestación de servicios de hospedaje a no domiciliado", export: true},
+	"0203":                  {description: "Exportación de servicios - Transporte de navieras", export: true},
+	"0204":                  {description: "Exportación de servicios - Servicios a naves y aeronaves de bandera extranjera", export: true},
+	"0205":                  {description: "Exportación de servicios - Servicios que conformen un paquete turístico", export: true},
+	"0206":                  {description: "Exportación de servicios - Servicios complementarios al transporte de carga", export: true},
+	"0207":                  {description: "Exportación de servicios - Suministro de energía eléctrica a favor de sujetos domiciliados en ZED", export: true},
+	"0208":                  {description: "Exportación de servicios - Prestación de servicios realizados parcialmente en el extranjero", export: true},
+	"0401":                  {description: "Ventas no domiciliados que no califican como exportación"},
+	DetractionOperationType: {description: "Operación sujeta a detracción"},
+	PerceptionOperationType: {description: "Operación sujeta a percepción"},
+}
+
+// OperationTypes retorna los códigos del catálogo 51 admitidos, ordenados
+func OperationTypes() []string {
+	codes := make([]string, 0, len(operationProfiles))
+	for code := range operationProfiles {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// operationTypeOf retorna el tipo de operación con que se emite el documento: el
+// indicado o, sin indicar, percepción si la lleva y venta interna en los demás casos
+func operationTypeOf(doc *BusinessDocument) string {
+	if code := strings.TrimSpace(doc.OperationType); code != "" {
+		return code
+	}
+	if doc.Perception != nil {
+		return PerceptionOperationType
+	}
+	return DefaultOperationType
+}
+
+// validateOperationType verifica que el tipo de operación esté en la tabla y que sea
+// coherente con los tributos, la percepción y las cuentas del documento
+func (v *ValidationService) validateOperationType(doc *BusinessDocument) []ValidationError {
+	code := operationTypeOf(doc)
+	profile, ok := operationProfiles[code]
+	if !ok {
+		return []ValidationError{{
+			Field:    "operationType",
+			Expected: "Operation type from catalog 51 (" + strings.Join(OperationTypes(), ", ") + ")",
+			Received: doc.OperationType,
+			Rule:     "operation_type_validation",
+			Message:  "Operation type is not supported",
+		}}
+	}
+
+	var errors []ValidationError
+	if profile.export {
+		// Una exportación no está gravada con IGV: sus líneas van con el tributo 9995
+		for i, item := range doc.Items {
+			for j, tax := range item.Taxes {
+				if tax.TaxType == "1000" && tax.TaxAmount > 0 {
+					errors = append(errors, ValidationError{
+						Field:      fmt.Sprintf("items[%d].taxes[%d].taxType", i, j),
+						Expected:   "9995 (export) without IGV",
+						Received:   fmt.Sprintf("%s with amount %.2f", tax.TaxType, tax.TaxAmount),
+						Rule:       "operation_type_consistency",
+						Message:    "Export operations cannot charge IGV",
+						Suggestion: "Use tax type 9995 with amount 0 or change the operation type",
+					})
+				}
+			}
+		}
+		for i, tax := range doc.Taxes {
+			if tax.TaxType == "1000" && tax.TaxAmount > 0 {
+				errors = append(errors, ValidationError{
+					Field:    fmt.Sprintf("taxes[%d].taxType", i),
+					Expected: "9995 (export) without IGV",
+					Received: fmt.Sprintf("%s with amount %.2f", tax.TaxType, tax.TaxAmount),
+					Rule:     "operation_type_consistency",
+					Message:  "Export operations cannot charge IGV",
+				})
+			}
+		}
+	}
+
+	if doc.Perception != nil && code != PerceptionOperationType {
+		errors = append(errors, ValidationError{
+			Field:    "operationType",
+			Expected: PerceptionOperationType,
+			Received: code,
+			Rule:     "operation_type_consistency",
+			Message:  "Documents with perception must use operation type " + PerceptionOperationType,
+		})
+	}
+	if doc.Perception == nil && code == PerceptionOperationType {
+		errors = append(errors, ValidationError{
+			Field:    "perception",
+			Expected: "Perception for operation type " + PerceptionOperationType,
+			Received: "none",
+			Rule:     "operation_type_consistency",
+			Message:  "Operation type " + PerceptionOperationType + " requires a perception",
+		})
+	}
+	if code == DetractionOperationType && !hasDetractionAccount(doc) {
+		errors = append(errors, ValidationError{
+			Field:    "paymentMeans",
+			Expected: "Detraction account",
+			Received: "none",
+			Rule:     "operation_type_consistency",
+			Message:  "Operation type " + DetractionOperationType + " requires the issuer's detraction account",
+		})
+	}
+	return errors
+}
+
+// hasDetractionAccount indica si el documento informa la cuenta de detracciones
+func hasDetractionAccount(doc *BusinessDocument) bool {
+	for _, mean := range doc.PaymentMeans {
+		if mean.Detraction {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+	"API-SUNAT2/util/httpclient"
+)
+
+// PadronClient consulta el padrón RUC de SUNAT
+type PadronClient interface {
+	Lookup(ruc string) (*TaxpayerStatus, error)
+}
+
+// HTTPPadronClient consulta un servicio de padrón vía HTTP: GET {baseURL}/{ruc}
+type HTTPPadronClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPPadronClient crea el cliente del padrón; si client es nil se usa el del pool
+// compartido del proceso
+func NewHTTPPadronClient(baseURL string, client *http.Client) *HTTPPadronClient {
+	if client == nil {
+		client = httpclient.Default().Client(httpclient.DestinationPadron)
+	}
+	return &HTTPPadronClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  client,
+	}
+}
+
+func (c *HTTPPadronClient) Lookup(ruc string) (*TaxpayerStatus, error) {
+	resp, err := c.client.Get(fmt.Sprintf("%s/%s", c.baseURL, ruc))
+	if err != nil {
+		return nil, fmt.Errorf("padron request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("padron returned status %d", resp.StatusCode)
+	}
+
+	var status TaxpayerStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("invalid padron response: %v", err)
+	}
+	return &status, nil
+}
+
+type padronCacheEntry struct {
+	status    *TaxpayerStatus
+	expiresAt time.Time
+}
+
+// CachedPadronClient guarda en memoria las consultas exitosas al padrón durante un TTL
+type CachedPadronClient struct {
+	inner   PadronClient
+	ttl     time.Duration
+	clock   Clock
+	mu      sync.Mutex
+	entries map[string]padronCacheEntry
+}
+
+func NewCachedPadronClient(inner PadronClient, ttl time.Duration, clock Clock) *CachedPadronClient {
+	return &CachedPadronClient{
+		inner:   inner,
+		ttl:     ttl,
+		clock:   clock,
+		entries: make(map[string]padronCacheEntry),
+	}
+}
+
+func (c *CachedPadronClient) Lookup(ruc string) (*TaxpayerStatus, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[ruc]
+	c.mu.Unlock()
+	if ok && c.clock.Now().Before(entry.expiresAt) {
+		return entry.status, nil
+	}
+
+	status, err := c.inner.Lookup(ruc)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[ruc] = padronCacheEntry{status: status, expiresAt: c.clock.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return status, nil
+}
+
+// Modos del chequeo de estado del emisor
+const (
+	IssuerStatusWarning = "warning"
+	IssuerStatusError   = "error"
+)
+
+// checkIssuerStatus consulta el padrón para el RUC emisor. Retorna la observación
+// encontrada y si debe bloquear la emisión. Si el padrón falla se continúa con un warning.
+func (s *UBLConverterService) checkIssuerStatus(doc *BusinessDocument) (*ValidationError, bool) {
+	if s.padron == nil || s.issuerStatusMode == "" {
+		return nil, false
+	}
+
+	status, err := s.padron.Lookup(doc.Issuer.DocumentID)
+	if err != nil {
+		return &ValidationError{
+			Field:    "issuer.documentId",
+			Expected: "Padron lookup available",
+			Received: err.Error(),
+			Rule:     "issuer_status_unavailable",
+			Message:  "Issuer status could not be verified, processing continued",
+		}, false
+	}
+
+	if status.IsOperational() {
+		return nil, false
+	}
+	return &ValidationError{
+		Field:    "issuer.documentId",
+		Expected: "ACTIVO / HABIDO",
+		Received: fmt.Sprintf("%s / %s", status.State, status.Condition),
+		Rule:     "issuer_status",
+		Message:  "Issuer is not active or not located (no habido) in the SUNAT padron",
+	}, s.issuerStatusMode == IssuerStatusError
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// DetractionPaymentMeansID es el cbc:ID del cac:PaymentMeans de la cuenta de detracciones
+const DetractionPaymentMeansID = "Detraccion"
+
+// PaymentMeansTransfer es la transferencia de fondos, que se informa con el CCI
+const PaymentMeansTransfer = "003"
+
+// BancoDeLaNacionCode es el código de entidad del Banco de la Nación en el CCI, el banco
+// de las cuentas de detracciones
+const BancoDeLaNacionCode = "018"
+
+// normalizeAccountID quita los espacios y guiones con que suele escribirse una cuenta
+func normalizeAccountID(accountID string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(accountID)
+}
+
+// isDigits indica si el texto no vacío tiene solo dígitos
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return value != ""
+}
+
+// IsCCI indica si la cuenta es un Código de Cuenta Interbancario: 20 dígitos, con o sin
+// separadores
+func IsCCI(accountID string) bool {
+	normalized := normalizeAccountID(accountID)
+	return len(normalized) == 20 && isDigits(normalized)
+}
+
+// cciCheckDigit calcula el dígito de control del CCI de un tramo (entidad y oficina, o
+// cuenta) con el algoritmo de ASBANC: los dígitos se multiplican alternando 1 y 2, de
+// cada producto se suman sus cifras y el dígito completa la suma a la decena siguiente
+func cciCheckDigit(digits string) byte {
+	sum := 0
+	for i, r := range digits {
+		product := int(r-'0') * (1 + i%2)
+		sum += product/10 + product%10
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// CCIError es la parte inválida de un CCI: su estructura o uno de sus dígitos de control
+type CCIError struct {
+	Part     string
+	Expected string
+	Received string
+}
+
+func (e *CCIError) Error() string {
+	return fmt.Sprintf("CCI %s is %s, expected %s", e.Part, e.Received, e.Expected)
+}
+
+// CheckCCI verifica la estructura del CCI (entidad de 3 dígitos, oficina de 3, cuenta de
+// 12 y 2 dígitos de control) y sus dígitos de control: el primero sobre entidad y
+// oficina, el segundo sobre la cuenta. Los espacios y guiones se ignoran.
+func CheckCCI(accountID string) *CCIError {
+	normalized := normalizeAccountID(accountID)
+	if !isDigits(normalized) {
+		return &CCIError{Part: "format", Expected: "digits only", Received: normalized}
+	}
+	if len(normalized) != 20 {
+		return &CCIError{Part: "length", Expected: "20 digits", Received: fmt.Sprintf("%d digits", len(normalized))}
+	}
+	if check := cciCheckDigit(normalized[:6]); normalized[18] != check {
+		return &CCIError{
+			Part:     "check digit for bank " + normalized[:3] + " and branch " + normalized[3:6] + " (digit 19)",
+			Expected: string(check),
+			Received: string(normalized[18]),
+		}
+	}
+	if check := cciCheckDigit(normalized[6:18]); normalized[19] != check {
+		return &CCIError{
+			Part:     "check digit for account " + normalized[6:18] + " (digit 20)",
+			Expected: string(check),
+			Received: string(normalized[19]),
+		}
+	}
+	return nil
+}
+
+// IsDetractionAccount indica si la cuenta tiene la estructura de una cuenta de
+// detracciones del Banco de la Nación: 11 dígitos que comienzan con 00 (00-XXX-XXXXXX)
+func IsDetractionAccount(accountID string) bool {
+	normalized := normalizeAccountID(accountID)
+	return len(normalized) == 11 && isDigits(normalized) && strings.HasPrefix(normalized, "00")
+}
+
+// cciValidationError arma el error de un CCI inválido indicando la parte que falla
+func cciValidationError(field, accountID string, cciErr *CCIError, message string) ValidationError {
+	return ValidationError{
+		Field:      field,
+		Expected:   "20-digit CCI: 3-digit bank, 3-digit branch, 12-digit account and 2 check digits",
+		Received:   accountID,
+		Rule:       "cci_validation",
+		Message:    message,
+		Suggestion: fmt.Sprintf("The %s is %s, expected %s; use the CCI provided by the bank", cciErr.Part, cciErr.Received, cciErr.Expected),
+	}
+}
+
+// convertPaymentMeans arma un cac:PaymentMeans por cuenta del emisor, en el orden del
+// documento; la cuenta de detracciones lleva el ID "Detraccion"
+func (c *UBLConverter) convertPaymentMeans(doc *BusinessDocument) []UBLPaymentMeans {
+	var means []UBLPaymentMeans
+	for _, mean := range doc.PaymentMeans {
+		converted := UBLPaymentMeans{
+			PaymentMeansCode:      catalogAttr(mean.Code, catalog.PaymentMeans),
+			PayeeFinancialAccount: UBLFinancialAccount{ID: strings.TrimSpace(mean.AccountID)},
+		}
+		if mean.Detraction {
+			converted.ID = DetractionPaymentMeansID
+		}
+		if mean.FinancialInstitution != "" {
+			converted.PayeeFinancialAccount.FinancialInstitutionBranch = &UBLBranch{
+				FinancialInstitution: UBLFinancialInstitution{Name: mean.FinancialInstitution},
+			}
+		}
+		means = append(means, converted)
+	}
+	return means
+}
+
+// validatePaymentMeans valida el medio de pago de cada cuenta contra el catálogo 59, el
+// CCI de las transferencias y la cuenta de detracciones
+func (v *ValidationService) validatePaymentMeans(doc *BusinessDocument) []ValidationError {
+	if len(doc.PaymentMeans) == 0 {
+		return nil
+	}
+
+	var errors []ValidationError
+	if doc.Type != "01" && doc.Type != "03" {
+		errors = append(errors, ValidationError{
+			Field:    "paymentMeans",
+			Expected: "Document type 01 or 03",
+			Received: doc.Type,
+			Rule:     "payment_means_validation",
+			Message:  "Payment means are only supported on invoices and boletas",
+		})
+	}
+
+	detractions := 0
+	for i, mean := range doc.PaymentMeans {
+		field := fmt.Sprintf("paymentMeans[%d]", i)
+		if !catalog.HasCode(catalog.PaymentMeans, mean.Code) {
+			errors = append(errors, ValidationError{
+				Field:    field + ".code",
+				Expected: "Payment means code from catalog 59 (001-013, 101-108, 999)",
+				Received: mean.Code,
+				Rule:     "payment_means_validation",
+				Message:  "Payment means code is not valid",
+			})
+		}
+		if strings.TrimSpace(mean.AccountID) == "" {
+			errors = append(errors, ValidationError{
+				Field:    field + ".accountId",
+				Expected: "Account number",
+				Received: mean.AccountID,
+				Rule:     "payment_means_validation",
+				Message:  "Account number is required",
+			})
+		} else if mean.Detraction {
+			errors = append(errors, validateDetractionAccount(field+".accountId", mean.AccountID)...)
+		} else if mean.Code == PaymentMeansTransfer {
+			if cciErr := CheckCCI(mean.AccountID); cciErr != nil {
+				errors = append(errors, cciValidationError(field+".accountId", mean.AccountID, cciErr, "Fund transfers require a valid 20-digit interbank account code (CCI)"))
+			}
+		}
+		if mean.Detraction {
+			detractions++
+		}
+	}
+	if detractions > 1 {
+		errors = append(errors, ValidationError{
+			Field:    "paymentMeans",
+			Expected: "At most one detraction account",
+			Received: fmt.Sprintf("%d", detractions),
+			Rule:     "payment_means_validation",
+			Message:  "Only one detraction account can be informed",
+		})
+	}
+	return errors
+}
+
+// validateDetractionAccount valida la cuenta de detracciones: la cuenta del Banco de la
+// Nación de 11 dígitos o su CCI, que debe ser de esa entidad
+func validateDetractionAccount(field, accountID string) []ValidationError {
+	normalized := normalizeAccountID(accountID)
+	if len(normalized) == 20 {
+		if cciErr := CheckCCI(accountID); cciErr != nil {
+			return []ValidationError{cciValidationError(field, accountID, cciErr, "Detraction account CCI is not valid")}
+		}
+		if bank := normalized[:3]; bank != BancoDeLaNacionCode {
+			return []ValidationError{{
+				Field:      field,
+				Expected:   "CCI of Banco de la Nación (bank " + BancoDeLaNacionCode + ")",
+				Received:   accountID,
+				Rule:       "detraction_account_validation",
+				Message:    "Detraction accounts are held at Banco de la Nación",
+				Suggestion: "The CCI belongs to bank " + bank + "; use the Banco de la Nación detraction account",
+			}}
+		}
+		return nil
+	}
+	if IsDetractionAccount(accountID) {
+		return nil
+	}
+
+	part := fmt.Sprintf("it has %d digits", len(normalized))
+	switch {
+	case !isDigits(normalized):
+		part = "it has characters other than digits, spaces and hyphens"
+	case len(normalized) == 11:
+		part = "it starts with " + normalized[:2]
+	}
+	return []ValidationError{{
+		Field:      field,
+		Expected:   "11-digit Banco de la Nación account starting with 00 (00-XXX-XXXXXX) or its 20-digit CCI",
+		Received:   accountID,
+		Rule:       "detraction_account_validation",
+		Message:    "Detraction account is not a Banco de la Nación account",
+		Suggestion: "Invalid account: " + part,
+	}}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	. "API-SUNAT2/model"
+)
+
+// Formas de pago de cac:PaymentTerms
+const (
+	PaymentCash   = "Contado"
+	PaymentCredit = "Credito"
+)
+
+func paymentMethod(doc *BusinessDocument) string {
+	if doc.PaymentTerms == nil || doc.PaymentTerms.Method == "" {
+		return PaymentCash
+	}
+	return doc.PaymentTerms.Method
+}
+
+// lastInstallmentDate retorna el vencimiento más tardío de las cuotas, o "" si no hay
+func lastInstallmentDate(doc *BusinessDocument) string {
+	if doc.PaymentTerms == nil {
+		return ""
+	}
+	last := ""
+	for _, installment := range doc.PaymentTerms.Installments {
+		if installment.DueDate > last {
+			last = installment.DueDate
+		}
+	}
+	return last
+}
+
+// ResolveDueDate retorna el cbc:DueDate a emitir: el indicado en el documento o, si
+// falta y hay cuotas, el vencimiento de la última cuota
+func ResolveDueDate(doc *BusinessDocument) string {
+	if doc.DueDate != "" {
+		return doc.DueDate
+	}
+	return lastInstallmentDate(doc)
+}
+
+// convertPaymentTerms arma FormaPago y, al crédito, una entrada CuotaNNN por cuota
+func (c *UBLConverter) convertPaymentTerms(doc *BusinessDocument) []UBLPaymentTerms {
+	if paymentMethod(doc) != PaymentCredit {
+		return []UBLPaymentTerms{{ID: "FormaPago", PaymentMeansID: PaymentCash}}
+	}
+
+	amount := doc.PaymentTerms.Amount
+	if amount == 0 {
+		amount = doc.Totals.PayableAmount
+	}
+	terms := []UBLPaymentTerms{{
+		ID:             "FormaPago",
+		PaymentMeansID: PaymentCredit,
+		Amount:         &UBLAmountWithCurrency{CurrencyID: doc.Currency, Value: float64(amount)},
+	}}
+	for i, installment := range doc.PaymentTerms.Installments {
+		terms = append(terms, UBLPaymentTerms{
+			ID:             "FormaPago",
+			PaymentMeansID: fmt.Sprintf("Cuota%03d", i+1),
+			Amount:         &UBLAmountWithCurrency{CurrencyID: doc.Currency, Value: float64(installment.Amount)},
+			PaymentDueDate: installment.DueDate,
+		})
+	}
+	return terms
+}
+
+// validatePaymentTerms valida la forma de pago y su coherencia con DueDate
+func (v *ValidationService) validatePaymentTerms(doc *BusinessDocument) []ValidationError {
+	var errors []ValidationError
+
+	if doc.DueDate != "" {
+		if !v.isValidDate(doc.DueDate) {
+			errors = append(errors, ValidationError{
+				Field:    "dueDate",
+				Expected: "Valid date format YYYY-MM-DD",
+				Received: doc.DueDate,
+				Rule:     "due_date_validation",
+				Message:  "Due date format is invalid",
+			})
+		} else if v.isValidDate(doc.IssueDate) && doc.DueDate < doc.IssueDate {
+			errors = append(errors, ValidationError{
+				Field:    "dueDate",
+				Expected: fmt.Sprintf("On or after %s", doc.IssueDate),
+				Received: doc.DueDate,
+				Rule:     "due_date_validation",
+				Message:  "Due date cannot be before the issue date",
+			})
+		}
+	}
+
+	method := paymentMethod(doc)
+	switch method {
+	case PaymentCash:
+		if doc.PaymentTerms != nil && len(doc.PaymentTerms.Installments) > 0 {
+			errors = append(errors, ValidationError{
+				Field:    "paymentTerms.installments",
+				Expected: "No installments for cash payment",
+				Received: fmt.Sprintf("%d", len(doc.PaymentTerms.Installments)),
+				Rule:     "payment_terms_validation",
+				Message:  "Cash payments cannot have installments",
+			})
+		}
+		return errors
+	case PaymentCredit:
+	default:
+		return append(errors, ValidationError{
+			Field:    "paymentTerms.method",
+			Expected: "Contado or Credito",
+			Received: method,
+			Rule:     "payment_terms_validation",
+			Message:  "Payment method is not valid",
+		})
+	}
+
+	installments := doc.PaymentTerms.Installments
+	if len(installments) == 0 {
+		return append(errors, ValidationError{
+			Field:    "paymentTerms.installments",
+			Expected: "At least one installment",
+			Received: "0",
+			Rule:     "payment_terms_validation",
+			Message:  "Credit payments require installments",
+		})
+	}
+
+	var sum float64
+	for i, installment := range installments {
+		sum += float64(installment.Amount)
+		if installment.Amount <= 0 {
+			errors = append(errors, ValidationError{
+				Field:    fmt.Sprintf("paymentTerms.installments[%d].amount", i),
+				Expected: "Greater than 0",
+				Received: fmt.Sprintf("%.2f", installment.Amount),
+				Rule:     "payment_terms_validation",
+				Message:  "Installment amount must be greater than 0",
+			})
+		}
+		if !v.isValidDate(installment.DueDate) {
+			errors = append(errors, ValidationError{
+				Field:    fmt.Sprintf("paymentTerms.installments[%d].dueDate", i),
+				Expected: "Valid date format YYYY-MM-DD",
+				Received: installment.DueDate,
+				Rule:     "payment_terms_validation",
+				Message:  "Installment due date format is invalid",
+			})
+		} else if installment.DueDate <= doc.IssueDate {
+			errors = append(errors, ValidationError{
+				Field:    fmt.Sprintf("paymentTerms.installments[%d].dueDate", i),
+				Expected: fmt.Sprintf("After %s", doc.IssueDate),
+				Received: installment.DueDate,
+				Rule:     "payment_terms_validation",
+				Message:  "Installment due date must be after the issue date",
+			})
+		}
+	}
+
+	pending := doc.PaymentTerms.Amount
+	if pending == 0 {
+		pending = doc.Totals.PayableAmount
+	}
+	if math.Abs(sum-float64(pending)) > 0.01 {
+		errors = append(errors, ValidationError{
+			Field:    "paymentTerms.installments",
+			Expected: fmt.Sprintf("%.2f", pending),
+			Received: fmt.Sprintf("%.2f", sum),
+			Rule:     "payment_terms_validation",
+			Message:  "Installments must add up to the pending amount",
+		})
+	}
+
+	if last := lastInstallmentDate(doc); doc.DueDate != "" && doc.DueDate != last {
+		errors = append(errors, ValidationError{
+			Field:    "dueDate",
+			Expected: last,
+			Received: doc.DueDate,
+			Rule:     "due_date_installment_validation",
+			Message:  "Due date must match the last installment due date",
+		})
+	}
+	return errors
+}
+
+// cashDueDateWarning advierte de un DueDate en una venta al contado, donde no aplica
+func cashDueDateWarning(doc *BusinessDocument) []ValidationError {
+	if doc.DueDate == "" || paymentMethod(doc) != PaymentCash {
+		return nil
+	}
+	return []ValidationError{{
+		Field:    "dueDate",
+		Expected: "No due date for cash payment",
+		Received: doc.DueDate,
+		Rule:     "due_date_cash_payment",
+		Message:  "Cash payment documents should omit the due date",
+	}}
+}
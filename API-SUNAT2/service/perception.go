@@ -0,0 +1,126 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// PerceptionOperationType es el tipo de operación del catálogo 51 para ventas sujetas a percepción
+const PerceptionOperationType = "2001"
+
+// PerceptionLegendCode es el código de leyenda del catálogo 52 "COMPROBANTE DE PERCEPCIÓN"
+const PerceptionLegendCode = "2000"
+
+type perceptionRegime struct {
+	description string
+	rate        float64
+}
+
+// perceptionRegimes son los cargos de percepción del catálogo 53 con su tasa en porcentaje
+var perceptionRegimes = map[string]perceptionRegime{
+	"51": {"Percepción venta interna", 2},
+	"52": {"Percepción a la adquisición de combustible", 1},
+	"53": {"Percepción realizada al agente de percepción con tasa especial", 0.5},
+}
+
+// applyPerception agrega el cargo, el total cobrado y la leyenda de la percepción; el
+// tipo de operación 2001 lo emite operationTypeOf
+func (c *UBLConverter) applyPerception(invoice *UBLInvoice, doc *BusinessDocument) {
+	perception := doc.Perception
+	if perception == nil {
+		return
+	}
+
+	invoice.Notes = append(invoice.Notes, UBLNote{LanguageLocaleID: PerceptionLegendCode, Value: "COMPROBANTE DE PERCEPCIÓN"})
+	invoice.PaymentTerms = append(invoice.PaymentTerms, UBLPaymentTerms{
+		ID:     "Percepcion",
+		Amount: &UBLAmountWithCurrency{CurrencyID: doc.Currency, Value: float64(perception.TotalCharged)},
+	})
+	invoice.AllowanceCharge = append(invoice.AllowanceCharge, UBLAllowanceCharge{
+		ChargeIndicator:           true,
+		AllowanceChargeReasonCode: catalogAttr(perception.RegimeCode, catalog.AllowanceCharge),
+		MultiplierFactorNumeric:   float64(perception.Rate) / 100,
+		Amount:                    UBLAmountWithCurrency{CurrencyID: doc.Currency, Value: float64(perception.Amount)},
+		BaseAmount:                UBLAmountWithCurrency{CurrencyID: doc.Currency, Value: float64(perception.Base)},
+	})
+}
+
+// validatePerception valida el régimen, la tasa y los montos de la percepción
+func (v *ValidationService) validatePerception(doc *BusinessDocument) []ValidationError {
+	perception := doc.Perception
+	if perception == nil {
+		return nil
+	}
+
+	var errors []ValidationError
+	if doc.Type != "03" {
+		errors = append(errors, ValidationError{
+			Field:    "perception",
+			Expected: "Document type 03",
+			Received: doc.Type,
+			Rule:     "perception_validation",
+			Message:  "Perception is only supported on boletas",
+		})
+	}
+	if doc.Currency != "PEN" {
+		errors = append(errors, ValidationError{
+			Field:    "currency",
+			Expected: "PEN",
+			Received: doc.Currency,
+			Rule:     "perception_validation",
+			Message:  "Perception must be charged in PEN",
+		})
+	}
+
+	regime, ok := perceptionRegimes[perception.RegimeCode]
+	if !ok {
+		return append(errors, ValidationError{
+			Field:    "perception.regimeCode",
+			Expected: "51, 52 or 53 (catalog 53)",
+			Received: perception.RegimeCode,
+			Rule:     "perception_validation",
+			Message:  "Perception regime code is not valid",
+		})
+	}
+	if Decimal2(perception.Rate).Round() != regime.rate {
+		errors = append(errors, ValidationError{
+			Field:    "perception.rate",
+			Expected: fmt.Sprintf("%g", regime.rate),
+			Received: fmt.Sprintf("%g", perception.Rate),
+			Rule:     "perception_validation",
+			Message:  fmt.Sprintf("Rate does not match regime %s (%s)", perception.RegimeCode, regime.description),
+		})
+	}
+
+	if math.Abs(float64(perception.Base-doc.Totals.PayableAmount)) > 0.01 {
+		errors = append(errors, ValidationError{
+			Field:    "perception.base",
+			Expected: fmt.Sprintf("%.2f", doc.Totals.PayableAmount),
+			Received: fmt.Sprintf("%.2f", perception.Base),
+			Rule:     "perception_validation",
+			Message:  "Perception base must be the document total",
+		})
+	}
+	if expected := math.Round(float64(perception.Base*perception.Rate)) / 100; math.Abs(float64(perception.Amount)-expected) > 0.01 {
+		errors = append(errors, ValidationError{
+			Field:    "perception.amount",
+			Expected: fmt.Sprintf("%.2f", expected),
+			Received: fmt.Sprintf("%.2f", perception.Amount),
+			Rule:     "perception_amount_validation",
+			Message:  "Perception amount must be base × rate",
+		})
+	}
+	if expected := doc.Totals.PayableAmount + perception.Amount; math.Abs(float64(perception.TotalCharged-expected)) > 0.01 {
+		errors = append(errors, ValidationError{
+			Field:    "perception.totalCharged",
+			Expected: fmt.Sprintf("%.2f", expected),
+			Received: fmt.Sprintf("%.2f", perception.TotalCharged),
+			Rule:     "perception_total_validation",
+			Message:  "Total charged must be the document total plus perception",
+		})
+	}
+	return errors
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// Validator valida el documento antes de convertirlo
+type Validator interface {
+	Validate(ctx *PipelineContext) error
+}
+
+// Converter genera en ctx.XML el XML UBL sin firmar
+type Converter interface {
+	Convert(ctx *PipelineContext) error
+}
+
+// Signer firma ctx.XML y lo reemplaza por el XML firmado
+type Signer interface {
+	Sign(ctx *PipelineContext) error
+}
+
+// ArtifactWriter persiste el XML firmado y sus artefactos (ZIP, sello de tiempo, marcas)
+type ArtifactWriter interface {
+	Write(ctx *PipelineContext) error
+}
+
+// ArtifactCleaner es implementado por los ArtifactWriter que pueden deshacer lo que
+// escribieron; el pipeline lo invoca si la operación se cancela antes de que Write
+// termine. Lo que Write completó ya fue entregado y no se limpia.
+type ArtifactCleaner interface {
+	Cleanup(ctx *PipelineContext) error
+}
+
+// PipelineStep es un paso adicional que se ejecuta después de escribir, por ejemplo
+// el envío a SUNAT
+type PipelineStep interface {
+	Name() string
+	Run(ctx *PipelineContext) error
+}
+
+// StepError es el error de un paso del pipeline con el código y mensaje de la respuesta
+type StepError struct {
+	// Operation es la operación registrada en el log (VALIDATION_ERROR, CONVERSION_ERROR, ...)
+	Operation        string
+	Code             string
+	Message          string
+	ValidationErrors []ValidationError
+	Err              error
+}
+
+func (e *StepError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// ErrCancelledCode es el código de error de una operación cancelada por el cliente o
+// por timeout
+const ErrCancelledCode = "ERR_CANCELLED"
+
+// PipelineContext es el estado de un documento a lo largo del pipeline
+type PipelineContext struct {
+	// Context se cancela si el cliente corta la conexión o vence el timeout; los pasos
+	// largos deben consultarlo con Err
+	Context       context.Context
+	CorrelationID string
+	Document      *BusinessDocument
+	CertPEM       []byte
+	KeyPEM        []byte
+	// XML es el XML sin firmar después de convertir y el firmado después de firmar
+	XML        []byte
+	SignResult *SignatureResult
+	Warnings   []ValidationError
+	Timings    map[string]float64
+	// FileName y XMLPath los completa el ArtifactWriter
+	FileName string
+	XMLPath  string
+	Data     map[string]interface{}
+	// Artifacts son los nombres escritos en el store, para limpiarlos si se cancela
+	Artifacts []string
+
+	// replaced es el contenido anterior de los artefactos que la operación sobrescribió
+	replaced map[string][]byte
+	// written indica que el ArtifactWriter terminó; desde ahí lo escrito no se limpia
+	written  bool
+	pipeline *Pipeline
+}
+
+// Err retorna un *StepError si la operación fue cancelada
+func (ctx *PipelineContext) Err() error {
+	if err := ctx.Context.Err(); err != nil {
+		return &StepError{
+			Operation: "OPERATION_CANCELLED",
+			Code:      ErrCancelledCode,
+			Message:   fmt.Sprintf("La operación fue cancelada: %v", err),
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// DocumentID retorna el identificador RUC-TIPO-SERIE-NUMERO del documento
+func (ctx *PipelineContext) DocumentID() string {
+	return DocumentIDOf(ctx.Document)
+}
+
+// Now retorna la hora según el reloj del pipeline
+func (ctx *PipelineContext) Now() time.Time {
+	return ctx.pipeline.clock.Now()
+}
+
+// Observe registra la duración de una etapa en Timings (en milisegundos), la deja en
+// el log de la operación y la notifica al observador del pipeline si existe
+func (ctx *PipelineContext) Observe(stage string, start time.Time) {
+	p := ctx.pipeline
+	elapsed := p.clock.Now().Sub(start)
+	ctx.Timings[stage] = float64(elapsed.Microseconds()) / 1000
+	if p.logService != nil {
+		p.logService.LogOperation(OperationLog{
+			Timestamp:     p.clock.Now(),
+			CorrelationID: ctx.CorrelationID,
+			Level:         "INFO",
+			Operation:     strings.ToUpper(stage),
+			DocumentType:  ctx.Document.Type,
+			DocumentID:    fmt.Sprintf("%s-%s", ctx.Document.Series, ctx.Document.Number),
+			Duration:      elapsed.Milliseconds(),
+			Status:        "COMPLETED",
+		})
+	}
+	if p.observer != nil {
+		p.observer(stage, elapsed)
+	}
+}
+
+// pipelineStage asocia un paso con la operación y el código usados si falla con un
+// error que no es *StepError
+type pipelineStage struct {
+	name      string
+	operation string
+	code      string
+	fn        func(*PipelineContext) error
+}
+
+// Pipeline orquesta validación, conversión, firma, escritura y pasos adicionales.
+// Sin ArtifactWriter el pipeline solo genera: el XML firmado queda en ctx.XML.
+type Pipeline struct {
+	validator  Validator
+	converter  Converter
+	signer     Signer
+	writer     ArtifactWriter
+	steps      []PipelineStep
+	clock      Clock
+	logService *LogService
+	observer   func(stage string, duration time.Duration)
+	// hooks son las extensiones registradas con AddHook, en orden de registro
+	hooks       []registeredHook
+	hookMetrics *HookMetrics
+}
+
+func NewPipeline(validator Validator, converter Converter, signer Signer) *Pipeline {
+	return &Pipeline{
+		validator: validator,
+		converter: converter,
+		signer:    signer,
+		clock:     SystemClock{},
+	}
+}
+
+// SetWriter configura el ArtifactWriter; nil deja el pipeline sin escritura
+func (p *Pipeline) SetWriter(writer ArtifactWriter) {
+	p.writer = writer
+}
+
+// AddStep agrega un paso que se ejecuta después de escribir
+func (p *Pipeline) AddStep(step PipelineStep) {
+	p.steps = append(p.steps, step)
+}
+
+func (p *Pipeline) SetClock(clock Clock) {
+	p.clock = clock
+}
+
+// SetLogService registra el inicio, las etapas y los errores de cada ejecución
+func (p *Pipeline) SetLogService(logService *LogService) {
+	p.logService = logService
+}
+
+// SetStageObserver registra una función que recibe la duración de cada etapa
+func (p *Pipeline) SetStageObserver(observer func(stage string, duration time.Duration)) {
+	p.observer = observer
+}
+
+func (p *Pipeline) newContext(c context.Context, doc *BusinessDocument, certPEM, keyPEM []byte) *PipelineContext {
+	return &PipelineContext{
+		Context:       c,
+		CorrelationID: GenerateCorrelationID(),
+		Document:      doc,
+		CertPEM:       certPEM,
+		KeyPEM:        keyPEM,
+		Timings:       make(map[string]float64),
+		Data:          make(map[string]interface{}),
+		replaced:      make(map[string][]byte),
+		pipeline:      p,
+	}
+}
+
+// Validate ejecuta solo el Validator, con las mismas reglas que aplica Run antes de
+// convertir. Lo usa /validate para no divergir de /convert.
+func (p *Pipeline) Validate(c context.Context, doc *BusinessDocument) (*PipelineContext, error) {
+	ctx := p.newContext(c, doc, nil, nil)
+	if p.logService != nil {
+		p.logService.LogInfo(ctx.CorrelationID, "VALIDATE_DOCUMENT", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "Iniciando validación de documento")
+	}
+	run := p.hookStages(BeforeValidate)
+	run = append(run, pipelineStage{"validate", "VALIDATION_ERROR", ValidationFailedCode, p.validator.Validate})
+	return ctx, p.execute(ctx, run)
+}
+
+// Run ejecuta el pipeline sobre el documento. Si un paso falla se detiene y retorna
+// un *StepError junto con el contexto alcanzado hasta ese punto. La cancelación de c
+// se verifica entre etapas; si se cancela durante la escritura, lo escrito se deshace.
+func (p *Pipeline) Run(c context.Context, doc *BusinessDocument, certPEM, keyPEM []byte) (*PipelineContext, error) {
+	ctx := p.newContext(c, doc, certPEM, keyPEM)
+	docNumber := fmt.Sprintf("%s-%s", doc.Series, doc.Number)
+	if p.logService != nil {
+		p.logService.LogInfo(ctx.CorrelationID, "PROCESS_DOCUMENT", doc.Type, docNumber, "Iniciando procesamiento de documento")
+	}
+
+	run := p.hookStages(BeforeValidate)
+	run = append(run,
+		pipelineStage{"validate", "VALIDATION_ERROR", ValidationFailedCode, p.validator.Validate},
+		pipelineStage{"convert", "CONVERSION_ERROR", "CONVERSION_FAILED", p.converter.Convert},
+	)
+	run = append(run, p.hookStages(AfterConvert)...)
+	run = append(run, p.hookStages(BeforeSign)...)
+	run = append(run, pipelineStage{"sign", "DIGITAL_SIGNATURE_ERROR", "SIGNATURE_FAILED", p.signer.Sign})
+	if p.writer != nil {
+		run = append(run, pipelineStage{"write", "FILE_SAVE_ERROR", "SAVE_FAILED", p.write})
+		run = append(run, p.hookStages(AfterStore)...)
+	}
+	for _, step := range p.steps {
+		name := strings.ToUpper(step.Name())
+		run = append(run, pipelineStage{step.Name(), name + "_ERROR", name + "_FAILED", step.Run})
+	}
+
+	if err := p.execute(ctx, run); err != nil {
+		return ctx, err
+	}
+	if p.logService != nil {
+		p.logService.LogInfo(ctx.CorrelationID, "PROCESS_SUCCESS", doc.Type, docNumber, "Documento procesado exitosamente")
+	}
+	return ctx, nil
+}
+
+// execute corre las etapas en orden y se detiene en la primera que falla o cuando la
+// operación se cancela
+func (p *Pipeline) execute(ctx *PipelineContext, run []pipelineStage) error {
+	doc := ctx.Document
+	for _, step := range run {
+		err := ctx.Err()
+		if err == nil {
+			err = step.fn(ctx)
+		}
+		if err == nil {
+			continue
+		}
+		if ctx.Context.Err() != nil && !errors.Is(err, ctx.Context.Err()) {
+			// El paso falló a causa de la cancelación (por ejemplo, un request abortado)
+			err = ctx.Err()
+		}
+		stepErr, ok := err.(*StepError)
+		if !ok {
+			stepErr = &StepError{
+				Operation: step.operation,
+				Code:      step.code,
+				Message:   fmt.Sprintf("Error en el paso %s: %v", step.name, err),
+				Err:       err,
+			}
+		}
+		if p.logService != nil {
+			p.logService.LogError(ctx.CorrelationID, stepErr.Operation, doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), stepErr.Code, stepErr.Error())
+		}
+		if stepErr.Code == ErrCancelledCode {
+			p.cleanup(ctx)
+		}
+		return stepErr
+	}
+	return nil
+}
+
+// write ejecuta el ArtifactWriter y marca el contexto como escrito si termina
+func (p *Pipeline) write(ctx *PipelineContext) error {
+	if err := p.writer.Write(ctx); err != nil {
+		return err
+	}
+	ctx.written = true
+	return nil
+}
+
+// cleanup deshace la escritura de una operación cancelada antes de que terminara; los
+// pasos posteriores, como el envío a SUNAT, ya recibieron los artefactos escritos
+func (p *Pipeline) cleanup(ctx *PipelineContext) {
+	cleaner, ok := p.writer.(ArtifactCleaner)
+	if !ok || ctx.written || len(ctx.Artifacts) == 0 {
+		return
+	}
+	if err := cleaner.Cleanup(ctx); err != nil && p.logService != nil {
+		doc := ctx.Document
+		p.logService.LogError(ctx.CorrelationID, "CLEANUP_ERROR", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "CLEANUP_FAILED", err.Error())
+	}
+}
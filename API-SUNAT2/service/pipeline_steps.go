@@ -0,0 +1,510 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	. "API-SUNAT2/model"
+	"API-SUNAT2/storage"
+	. "API-SUNAT2/util"
+)
+
+// Pasos por defecto del pipeline, respaldados por la configuración del servicio
+
+type documentValidator struct {
+	s *UBLConverterService
+}
+
+func (v documentValidator) Validate(ctx *PipelineContext) error {
+	s, doc := v.s, ctx.Document
+
+	// Con el reloj desfasado las fechas de emisión saldrían mal: en modo estricto no se emite
+	if status, blocking := s.clockSkewBlocking(); blocking {
+		return &StepError{
+			Operation: "CLOCK_SKEW_ERROR",
+			Code:      ErrClockSkewCode,
+			Message:   fmt.Sprintf("El reloj del servidor está desfasado %d ms respecto de %s", status.DriftMs, status.Source),
+			Err:       errors.New("reloj desincronizado"),
+		}
+	}
+
+	// Rechazar documentos con demasiadas líneas antes de convertir
+	if len(doc.Items) > s.maxItems {
+		return &StepError{
+			Operation: "DOCUMENT_TOO_LARGE",
+			Code:      "ERR_DOCUMENT_TOO_LARGE",
+			Message:   fmt.Sprintf("El documento tiene %d líneas, el máximo permitido es %d", len(doc.Items), s.maxItems),
+			Err:       errors.New("Demasiadas líneas"),
+		}
+	}
+
+	// Corregir o rechazar los textos doblemente codificados antes de validar
+	encodingErrors, encodingWarnings := s.checkMojibake(doc)
+	if len(encodingErrors) > 0 {
+		return &StepError{
+			Operation:        "ENCODING_ERROR",
+			Code:             ErrInvalidEncodingCode,
+			Message:          fmt.Sprintf("El campo %s tiene texto mal codificado (%s)", encodingErrors[0].Field, encodingErrors[0].Received),
+			ValidationErrors: encodingErrors,
+			Err:              errors.New("texto mal codificado"),
+		}
+	}
+	ctx.Warnings = append(ctx.Warnings, encodingWarnings...)
+	// Un mismo comprobante con y sin ceros a la izquierda debe tener un solo documentId
+	ctx.Warnings = append(ctx.Warnings, normalizeNumbers(doc)...)
+	// Los RUC y series de prueba se marcan como tales aunque el request no lo indique
+	if s.markTestDocument(doc) {
+		s.logService.LogInfo(ctx.CorrelationID, "TEST_DOCUMENT", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "Documento de un emisor o serie de prueba")
+	}
+	if doc.Test {
+		ctx.Data["test"] = true
+	}
+
+	// Validar documento sobre las descripciones ya normalizadas
+	stageStart := ctx.Now()
+	s.NormalizeDescriptions(doc)
+	// Reemplazar las unidades del ERP por las del catálogo 03 según el mapeo del emisor
+	if applied := s.applyUnitMappings(doc); len(applied) > 0 {
+		ctx.Data["unitMappings"] = applied
+		s.logService.LogInfo(ctx.CorrelationID, "UNIT_MAPPING", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), fmt.Sprintf("%d unidades reemplazadas con el mapeo del emisor", len(applied)))
+	}
+	if len(doc.TemplateFields) > 0 {
+		ctx.Data["templateFields"] = doc.TemplateFields
+		s.logService.LogInfo(ctx.CorrelationID, "DOCUMENT_TEMPLATE", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), fmt.Sprintf("%d campos completados con la plantilla del emisor", len(doc.TemplateFields)))
+	}
+	var validationErrors []ValidationError
+	if doc.PricesIncludeTax {
+		// Derivar base, IGV y totales antes de validarlos
+		derived, errs := deriveTaxIncludedAmounts(doc, s.validator.IGVRateAt(doc.IssueDate))
+		if derived != nil {
+			ctx.Data["derivedAmounts"] = derived
+		}
+		validationErrors = append(validationErrors, errs...)
+	}
+	if s.ConvertsNegativeLines(doc) {
+		if converted := convertNegativeLines(doc); len(converted) > 0 {
+			ctx.Data["negativeLines"] = converted
+			s.logService.LogInfo(ctx.CorrelationID, "NEGATIVE_LINES", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), fmt.Sprintf("%d líneas negativas convertidas en descuentos", len(converted)))
+		}
+	}
+	validationErrors = append(validationErrors, s.validator.ValidateBusinessDocument(doc)...)
+	reasonErrors, warnings := s.checkCreditNoteReason(doc)
+	validationErrors = append(validationErrors, reasonErrors...)
+	balanceErrors, balanceWarnings := s.checkCreditNoteBalance(doc)
+	validationErrors = append(validationErrors, balanceErrors...)
+	validationErrors = append(validationErrors, s.checkReferencesCustomer(doc)...)
+	warnings = append(warnings, balanceWarnings...)
+	warnings = append(warnings, cashDueDateWarning(doc)...)
+	warnings = append(warnings, s.validator.IGVRateWarnings(doc)...)
+	warnings = append(warnings, s.validator.BoletaIdentificationWarnings(doc)...)
+	warnings = append(warnings, s.validator.IssueDateWarnings(doc)...)
+	warnings = append(warnings, s.validator.ClassificationWarnings(doc)...)
+	if len(doc.ExchangedDocuments) > 0 {
+		validationErrors = append(validationErrors, s.checkExchangedDocuments(doc)...)
+	}
+	if len(doc.Advances) > 0 {
+		validationErrors = append(validationErrors, s.checkAdvances(doc)...)
+	}
+	ctx.Observe("validate", stageStart)
+
+	// Verificar el estado del emisor en el padrón
+	if issue, blocking := s.checkIssuerStatus(doc); issue != nil {
+		if blocking {
+			return &StepError{
+				Operation:        "ISSUER_STATUS_ERROR",
+				Code:             "ERR_ISSUER_STATUS",
+				Message:          "El emisor está de baja o no habido en el padrón SUNAT",
+				ValidationErrors: []ValidationError{*issue},
+				Err:              errors.New(issue.Message),
+			}
+		}
+		warnings = append(warnings, *issue)
+	}
+	// La razón social del cliente solo se advierte, nunca bloquea la emisión
+	if issue := s.checkCustomerName(doc); issue != nil {
+		warnings = append(warnings, *issue)
+	}
+	ctx.Warnings = append(ctx.Warnings, warnings...)
+
+	if len(validationErrors) > 0 {
+		s.recordValidationErrors(doc.Issuer.DocumentID, validationErrors)
+		return &StepError{
+			Operation:        "VALIDATION_ERROR",
+			Code:             ValidationFailedCode,
+			Message:          "Documento no válido",
+			ValidationErrors: validationErrors,
+		}
+	}
+	return nil
+}
+
+type documentConverter struct {
+	s *UBLConverterService
+}
+
+func (c documentConverter) Convert(ctx *PipelineContext) error {
+	s, doc := c.s, ctx.Document
+
+	stageStart := ctx.Now()
+	xmlData, err := s.converter.ConvertToUBL(doc)
+	ctx.Observe("convert", stageStart)
+	if err != nil {
+		return &StepError{
+			Operation: "CONVERSION_ERROR",
+			Code:      "CONVERSION_FAILED",
+			Message:   fmt.Sprintf("Error en conversión UBL: %v", err),
+			Err:       err,
+		}
+	}
+
+	// Traza de la omisión de cac:PricingReference, por request o por emisor
+	if !s.emitsPricingReference(doc) {
+		ctx.Data["emitPricingReference"] = false
+		s.logService.LogInfo(ctx.CorrelationID, "PRICING_REFERENCE_OMITTED", doc.Type, fmt.Sprintf("%s-%s", doc.Series, doc.Number), "Líneas emitidas sin cac:PricingReference")
+	}
+
+	// Rechazar XML anormalmente grandes antes de firmar
+	if len(xmlData) > s.maxXMLBytes {
+		return &StepError{
+			Operation: "DOCUMENT_TOO_LARGE",
+			Code:      "ERR_DOCUMENT_TOO_LARGE",
+			Message:   fmt.Sprintf("El XML generado ocupa %d bytes, el máximo permitido es %d", len(xmlData), s.maxXMLBytes),
+			Err:       errors.New("XML demasiado grande"),
+		}
+	}
+
+	// Verificar invariantes estructurales del XML generado
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stageStart = ctx.Now()
+	invariantErrors := s.invariants.Check(xmlData, doc)
+	ctx.Observe("invariants", stageStart)
+	if len(invariantErrors) > 0 {
+		return &StepError{
+			Operation:        "POSTCONVERT_INVARIANT_ERROR",
+			Code:             "ERR_POSTCONVERT_INVARIANT",
+			Message:          "El XML generado no cumple los invariantes estructurales",
+			ValidationErrors: invariantErrors,
+			Err:              errors.New(invariantErrors[0].Message),
+		}
+	}
+
+	ctx.XML = xmlData
+	return nil
+}
+
+type documentSigner struct {
+	s *UBLConverterService
+}
+
+func (d documentSigner) Sign(ctx *PipelineContext) error {
+	s, doc := d.s, ctx.Document
+
+	// Agregar firma UBL al XML
+	stageStart := ctx.Now()
+	xmlData, err := s.addUBLSignature(ctx.XML, doc)
+	ctx.Observe("ubl_signature", stageStart)
+	if err != nil {
+		return &StepError{
+			Operation: "UBL_SIGNATURE_ERROR",
+			Code:      "UBL_SIGNATURE_FAILED",
+			Message:   fmt.Sprintf("Error al agregar firma UBL: %v", err),
+			Err:       err,
+		}
+	}
+
+	// Codificar antes de firmar para que el digest corresponda a los bytes que se escriben
+	xmlData, err = EncodeXML(xmlData, s.xmlEncoding)
+	if err != nil {
+		return &StepError{
+			Operation: "XML_ENCODING_ERROR",
+			Code:      "ERR_XML_ENCODING",
+			Message:   fmt.Sprintf("El XML no se puede codificar en %s: %v", s.xmlEncoding, err),
+			Err:       err,
+		}
+	}
+
+	// Firmar digitalmente
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Si el convertidor puso Id en el elemento raíz el emisor firma por referencia a él
+	referenceURI := ""
+	if id := RootElementID(xmlData); id != "" {
+		referenceURI = "#" + id
+	}
+	stageStart = ctx.Now()
+	signResult, err := s.signer.SignReference(xmlData, ctx.CertPEM, ctx.KeyPEM, referenceURI)
+	ctx.Observe("sign", stageStart)
+	if err != nil {
+		errorCode := "SIGNATURE_FAILED"
+		var keyErr *KeyValidationError
+		var tsaErr *TimestampError
+		if errors.As(err, &keyErr) {
+			errorCode = keyErr.Code
+		} else if errors.As(err, &tsaErr) {
+			errorCode = "ERR_TIMESTAMP_FAILED"
+		}
+		return &StepError{
+			Operation: "DIGITAL_SIGNATURE_ERROR",
+			Code:      errorCode,
+			Message:   fmt.Sprintf("Error en firma digital: %v", err),
+			Err:       err,
+		}
+	}
+
+	if signResult.TimestampError != nil {
+		ctx.Warnings = append(ctx.Warnings, ValidationError{
+			Field:    "signature.timestamp",
+			Expected: "RFC 3161 timestamp token",
+			Received: signResult.TimestampError.Error(),
+			Rule:     "timestamp_unavailable",
+			Message:  "Timestamp authority did not respond, document signed without timestamp",
+		})
+	}
+	if signResult.CertificateWarning != "" {
+		ctx.Warnings = append(ctx.Warnings, ValidationError{
+			Field:    "certificate",
+			Expected: "Certificate from an accredited CA",
+			Received: signResult.CertificateWarning,
+			Rule:     "certificate_not_accepted_in_production",
+			Message:  "Certificate would be rejected in production",
+		})
+	}
+	ctx.XML = signResult.SignedXML
+	ctx.SignResult = signResult
+	return nil
+}
+
+// storeWriter guarda el XML firmado, el ZIP, el sello de tiempo y las marcas del
+// documento en el store del servicio
+type storeWriter struct {
+	s *UBLConverterService
+}
+
+func saveFailed(operation, message string, err error) *StepError {
+	return &StepError{
+		Operation: operation,
+		Code:      "SAVE_FAILED",
+		Message:   fmt.Sprintf("%s: %v", message, err),
+		Err:       err,
+	}
+}
+
+// save guarda un artefacto si la operación sigue vigente y lo registra en ctx.Artifacts;
+// si ya existía (un documento reprocesado), conserva su contenido anterior en el contexto
+func (w storeWriter) save(ctx *PipelineContext, name string, data []byte) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	previous, readErr := w.s.store.Read(name)
+	path, err := w.s.store.Save(name, data)
+	if err == nil && !contains(ctx.Artifacts, name) {
+		ctx.Artifacts = append(ctx.Artifacts, name)
+		if readErr == nil {
+			ctx.replaced[name] = previous
+		}
+	}
+	return path, err
+}
+
+// Cleanup deshace la escritura de una operación cancelada: elimina los artefactos que
+// no existían antes de la operación y restaura el contenido de los que sobrescribió
+func (w storeWriter) Cleanup(ctx *PipelineContext) error {
+	var firstErr error
+	for _, name := range ctx.Artifacts {
+		var err error
+		if previous, ok := ctx.replaced[name]; ok {
+			_, err = w.s.store.Save(name, previous)
+		} else {
+			err = w.s.store.Delete(name)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	ctx.Artifacts, ctx.replaced = nil, map[string][]byte{}
+	return firstErr
+}
+
+// writeFailed retorna el error de cancelación tal cual y envuelve los demás
+func writeFailed(operation, message string, err error) error {
+	if stepErr, ok := err.(*StepError); ok && stepErr.Code == ErrCancelledCode {
+		return stepErr
+	}
+	return saveFailed(operation, message, err)
+}
+
+func (w storeWriter) Write(ctx *PipelineContext) error {
+	s, doc := w.s, ctx.Document
+	baseName := ctx.DocumentID()
+	fileName := baseName + ".xml"
+	save := func(name string, data []byte) (string, error) {
+		return w.save(ctx, name, data)
+	}
+
+	// Guardar XML firmado
+	stageStart := ctx.Now()
+	_, err := save(fileName, ctx.XML)
+	ctx.Observe("save", stageStart)
+	if err != nil {
+		return writeFailed("FILE_SAVE_ERROR", "Error al guardar archivo", err)
+	}
+
+	// Crear archivo ZIP
+	stageStart = ctx.Now()
+	zipData, err := ZipXMLBytes(fileName, ctx.XML)
+	zipPath := ""
+	if err == nil {
+		zipPath, err = save(baseName+".zip", zipData)
+	}
+	ctx.Observe("zip", stageStart)
+	if err != nil {
+		if stepErr, ok := err.(*StepError); ok {
+			return stepErr
+		}
+		return &StepError{
+			Operation: "ZIP_ERROR",
+			Code:      "ZIP_FAILED",
+			Message:   fmt.Sprintf("Error al crear ZIP: %v", err),
+			Err:       err,
+		}
+	}
+
+	// Guardar el sello de tiempo junto al documento
+	if ctx.SignResult != nil && ctx.SignResult.TimestampToken != nil {
+		if _, err := save(baseName+".tsr", ctx.SignResult.TimestampToken); err != nil {
+			return writeFailed("TIMESTAMP_SAVE_ERROR", "Error al guardar el sello de tiempo", err)
+		}
+		tsrHash := sha256.Sum256(ctx.SignResult.TimestampToken)
+		ctx.Data["timestampHash"] = hex.EncodeToString(tsrHash[:])
+	}
+
+	// Marcar los comprobantes de contingencia para incluirlos en el resumen
+	if doc.Contingency {
+		if _, err := save(baseName+".contingencia", []byte(doc.IssueDate)); err != nil {
+			return writeFailed("CONTINGENCY_MARK_ERROR", "Error al registrar el comprobante de contingencia", err)
+		}
+	}
+
+	// Marcar los documentos de prueba para impedir su envío a producción
+	if doc.Test {
+		if _, err := save(baseName+TestDocumentMarkSuffix, []byte(doc.IssueDate)); err != nil {
+			return writeFailed("TEST_MARK_ERROR", "Error al registrar el documento de prueba", err)
+		}
+	}
+
+	// Marcar las boletas canjeadas por esta factura
+	if err := s.markExchangedDocuments(doc, save); err != nil {
+		return writeFailed("EXCHANGE_MARK_ERROR", "Error al registrar el canje de boletas", err)
+	}
+
+	// Registrar los metadatos del documento
+	record, err := ExtractDocumentRecord(fileName, ctx.XML)
+	if err == nil {
+		zipHash := sha256.Sum256(zipData)
+		record.ZIPHash = hex.EncodeToString(zipHash[:])
+		record.ZIPSize = int64(len(zipData))
+		ctx.Data["zipHash"] = record.ZIPHash
+		record.Source = RecordSourcePipeline
+		record.CreatedAt = ctx.Now()
+		if applied, ok := ctx.Data["unitMappings"].([]AppliedUnitMapping); ok {
+			record.UnitMappings = applied
+		}
+		record.TemplateFields = doc.TemplateFields
+		if converted, ok := ctx.Data["negativeLines"].([]ConvertedNegativeLine); ok {
+			record.NegativeLines = converted
+		}
+		if doc.Interest != nil {
+			record.Interest = doc.Interest
+			ctx.Data["interest"] = doc.Interest
+		}
+		record.Test = doc.Test
+		record.PricingReferenceOmitted = !s.emitsPricingReference(doc)
+		record.AffectedDocuments = affectedDocuments(doc)
+		record.Advance = doc.Type == "01" && operationTypeOf(doc) == AdvanceOperationType
+		record.Advances = advanceDeductions(doc)
+		record.Breakdown = issuedBreakdown(doc)
+		engine := s.EngineVersion()
+		record.Engine = &engine
+		ctx.Data["engineVersion"] = engine
+		// Con el directorio principal caído el documento queda en el de contingencia
+		if location := s.storageLocation(fileName); location != storage.LocationPrimary {
+			record.StorageLocation = location
+			ctx.Data["storageLocation"] = location
+			ctx.Warnings = append(ctx.Warnings, ValidationError{
+				Field:    "storage",
+				Expected: storage.LocationPrimary,
+				Received: location,
+				Rule:     "storage_failover",
+				Message:  "Primary storage is unavailable, document saved to the contingency path",
+			})
+			s.GetLogger().Warnf("Documento %s guardado en el directorio de contingencia", baseName)
+		}
+		var recordJSON []byte
+		if recordJSON, err = json.Marshal(record); err == nil {
+			_, err = save(RecordName(baseName), recordJSON)
+		}
+	}
+	if err != nil {
+		return writeFailed("RECORD_SAVE_ERROR", "Error al registrar los metadatos del documento", err)
+	}
+
+	s.recordXMLSize(doc.Issuer.DocumentID, "", len(ctx.XML))
+
+	ctx.FileName = fileName
+	ctx.XMLPath = zipPath
+	ctx.Data["zipSize"] = int64(len(zipData))
+	return nil
+}
+
+// sunatSendStep envía el documento ya escrito al ambiente indicado
+type sunatSendStep struct {
+	s           *UBLConverterService
+	environment string
+}
+
+// SunatSendStep retorna un paso que envía el documento a SUNAT después de escribirlo;
+// el resultado del envío queda en ctx.Data["submission"]
+func (s *UBLConverterService) SunatSendStep(environment string) PipelineStep {
+	return sunatSendStep{s: s, environment: environment}
+}
+
+func (st sunatSendStep) Name() string {
+	return "send"
+}
+
+func (st sunatSendStep) Run(ctx *PipelineContext) error {
+	stageStart := ctx.Now()
+	resp, err := st.s.SendDocument(ctx.Context, ctx.DocumentID(), st.environment)
+	ctx.Observe("send", stageStart)
+	if err != nil {
+		return err
+	}
+	if resp.Status != "SUCCESS" {
+		return &StepError{
+			Operation: "SEND_DOCUMENT_ERROR",
+			Code:      resp.ErrorCode,
+			Message:   resp.ErrorMessage,
+		}
+	}
+	ctx.Data["submission"] = resp.Data
+	return nil
+}
+
+// NewDefaultPipeline retorna el pipeline de ProcessDocument: valida, convierte, firma
+// y escribe en el store con la configuración del servicio
+func (s *UBLConverterService) NewDefaultPipeline() *Pipeline {
+	pipeline := NewPipeline(documentValidator{s}, documentConverter{s}, documentSigner{s})
+	pipeline.SetWriter(storeWriter{s})
+	pipeline.SetClock(s.clock)
+	pipeline.SetLogService(s.logService)
+	pipeline.SetStageObserver(s.stageObserver)
+	pipeline.SetHookMetrics(s.hookMetrics)
+	pipeline.hooks = append(pipeline.hooks, s.hooks...)
+	return pipeline
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// DefaultRetentionYears es el período de conservación de los comprobantes exigido por
+// el Código Tributario, contado desde la fecha de emisión
+const DefaultRetentionYears = 5
+
+// PurgeAuditSuffix es la extensión del registro de auditoría de una purga en el store
+const PurgeAuditSuffix = ".purga"
+
+// DocumentPurged es el estado del historial de un documento anonimizado
+const DocumentPurged = "PURGADO"
+
+// PurgeAuditName retorna el nombre del registro de auditoría de una purga
+func PurgeAuditName(auditID string) string {
+	return "purga-" + auditID + PurgeAuditSuffix
+}
+
+// ErrInvalidPurgeRequest indica un filtro vacío, un modo desconocido o fechas inválidas
+type ErrInvalidPurgeRequest struct {
+	Message string
+}
+
+func (e *ErrInvalidPurgeRequest) Error() string {
+	return e.Message
+}
+
+// SetRetentionYears configura el período de conservación legal; los valores menores a
+// 1 se ignoran
+func (s *UBLConverterService) SetRetentionYears(years int) {
+	if years > 0 {
+		s.retentionYears = years
+	}
+}
+
+// GetRetentionYears retorna el período de conservación legal en años
+func (s *UBLConverterService) GetRetentionYears() int {
+	return s.retentionYears
+}
+
+// validatePurgeRequest normaliza el modo y verifica que el filtro tenga algún criterio
+func validatePurgeRequest(request *PurgeRequest) error {
+	if request.Mode == "" {
+		request.Mode = PurgeModeAnonymize
+	}
+	if request.Mode != PurgeModeAnonymize && request.Mode != PurgeModeDelete {
+		return &ErrInvalidPurgeRequest{Message: fmt.Sprintf("mode must be %s or %s", PurgeModeAnonymize, PurgeModeDelete)}
+	}
+	if strings.TrimSpace(request.RequestedBy) == "" {
+		return &ErrInvalidPurgeRequest{Message: "requestedBy is required"}
+	}
+	if request.CustomerDocumentID == "" && request.From == "" && request.To == "" && len(request.DocumentIDs) == 0 {
+		return &ErrInvalidPurgeRequest{Message: "filter requires customerDocumentId, from, to or documentIds"}
+	}
+	for _, date := range []string{request.From, request.To} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return &ErrInvalidPurgeRequest{Message: fmt.Sprintf("invalid date %q, expected YYYY-MM-DD", date)}
+		}
+	}
+	if request.From != "" && request.To != "" && request.From > request.To {
+		return &ErrInvalidPurgeRequest{Message: "from must not be after to"}
+	}
+	return nil
+}
+
+// purgeMatches indica si el registro cumple todos los criterios del filtro
+func purgeMatches(record *DocumentRecord, request *PurgeRequest, ids map[string]bool) bool {
+	if len(ids) > 0 && !ids[record.DocumentID] {
+		return false
+	}
+	if request.CustomerDocumentID != "" && record.CustomerDocumentID != request.CustomerDocumentID {
+		return false
+	}
+	if request.From != "" && record.IssueDate < request.From {
+		return false
+	}
+	if request.To != "" && record.IssueDate > request.To {
+		return false
+	}
+	return true
+}
+
+// retainUntil retorna la fecha hasta la que debe conservarse un documento emitido en
+// issueDate; ok es false si la fecha no se puede interpretar
+func (s *UBLConverterService) retainUntil(issueDate string) (time.Time, bool) {
+	issued, err := time.Parse("2006-01-02", issueDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return issued.AddDate(s.retentionYears, 0, 0), true
+}
+
+// purgeArtifacts retorna los archivos del store que se eliminan al purgar un documento:
+// en modo anonymize los que tienen datos personales del cliente (XML, ZIP, sello de
+// tiempo, CDR, request auditado y trazas SOAP) y en modo delete todos los del documento
+func purgeArtifacts(names []string, documentID, mode string) []string {
+	var artifacts []string
+	if mode == PurgeModeDelete {
+		for _, name := range names {
+			if strings.HasPrefix(name, documentID+".") || strings.HasPrefix(name, "R-"+documentID+".") {
+				artifacts = append(artifacts, name)
+			}
+		}
+		return artifacts
+	}
+
+	personal := map[string]bool{
+		documentID + ".xml":      true,
+		documentID + ".zip":      true,
+		documentID + ".tsr":      true,
+		documentID + AuditSuffix: true,
+	}
+	for _, name := range names {
+		isTrace := strings.HasPrefix(name, documentID+".") && strings.HasSuffix(name, SOAPTraceSuffix)
+		if personal[name] || isTrace || strings.HasPrefix(name, "R-"+documentID+".") {
+			artifacts = append(artifacts, name)
+		}
+	}
+	return artifacts
+}
+
+// readPurgeCandidate lee el registro de un documento; los registros anteriores al
+// documento del cliente lo toman del XML
+func (s *UBLConverterService) readPurgeCandidate(name string) (*DocumentRecord, error) {
+	data, err := s.store.Read(name)
+	if err != nil {
+		return nil, err
+	}
+	var record DocumentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid document record %s: %v", name, err)
+	}
+	if record.CustomerDocumentID == "" && record.PurgedAt == nil {
+		if xmlData, err := s.store.Read(record.XMLFile); err == nil {
+			if extracted, err := ExtractDocumentRecord(record.XMLFile, xmlData); err == nil {
+				record.CustomerDocumentID = extracted.CustomerDocumentID
+			}
+		}
+	}
+	return &record, nil
+}
+
+// PurgeDocuments elimina o anonimiza los datos personales de los documentos que cumplen
+// el filtro y que ya salieron del período de conservación legal; los que siguen dentro
+// se reportan en Retained y no se tocan. Salvo en dry-run, deja un registro de
+// auditoría en el store con el filtro, quién ordenó la purga y qué se eliminó.
+func (s *UBLConverterService) PurgeDocuments(request PurgeRequest) (*PurgeReport, error) {
+	if err := validatePurgeRequest(&request); err != nil {
+		return nil, err
+	}
+
+	s.purgeMu.Lock()
+	defer s.purgeMu.Unlock()
+
+	names, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, id := range request.DocumentIDs {
+		ids[strings.TrimSpace(id)] = true
+	}
+
+	now := s.clock.Now()
+	report := &PurgeReport{Mode: request.Mode, DryRun: request.DryRun, Documents: []PurgedDocument{}, Retained: []RetainedDocument{}}
+	for _, name := range names {
+		if !strings.HasSuffix(name, RecordSuffix) {
+			continue
+		}
+		record, err := s.readPurgeCandidate(name)
+		if err != nil {
+			return nil, err
+		}
+		// Un documento ya anonimizado solo puede volver a purgarse para borrarlo
+		if record.PurgedAt != nil && request.Mode == PurgeModeAnonymize {
+			continue
+		}
+		if !purgeMatches(record, &request, ids) {
+			continue
+		}
+		report.Matched++
+
+		until, ok := s.retainUntil(record.IssueDate)
+		if !ok || now.Before(until) {
+			retained := RetainedDocument{DocumentID: record.DocumentID, IssueDate: record.IssueDate}
+			if ok {
+				retained.RetainUntil = until.Format("2006-01-02")
+			}
+			report.Retained = append(report.Retained, retained)
+			continue
+		}
+
+		purged := PurgedDocument{
+			DocumentID: record.DocumentID,
+			IssueDate:  record.IssueDate,
+			Artifacts:  purgeArtifacts(names, record.DocumentID, request.Mode),
+		}
+		if !request.DryRun {
+			if err := s.purgeDocument(record, purged.Artifacts, request.Mode, now); err != nil {
+				return nil, fmt.Errorf("purge %s: %v", record.DocumentID, err)
+			}
+		}
+		report.Documents = append(report.Documents, purged)
+		report.Purged++
+		report.Artifacts += len(purged.Artifacts)
+	}
+
+	if request.DryRun {
+		return report, nil
+	}
+
+	report.AuditID = GenerateCorrelationID()
+	if err := s.savePurgeAudit(request, report, now); err != nil {
+		return nil, err
+	}
+	s.GetLogger().Infof("Purga %s ordenada por %s: %d documentos, %d archivos", report.AuditID, request.RequestedBy, report.Purged, report.Artifacts)
+	return report, nil
+}
+
+// purgeDocument elimina los archivos del documento y, al anonimizar, reescribe su
+// registro sin el cliente y con la fecha de purga
+func (s *UBLConverterService) purgeDocument(record *DocumentRecord, artifacts []string, mode string, now time.Time) error {
+	for _, name := range artifacts {
+		if err := s.store.Delete(name); err != nil {
+			return err
+		}
+	}
+	if mode == PurgeModeDelete {
+		return nil
+	}
+
+	record.CustomerDocumentID = ""
+	record.PurgedAt = &now
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := s.store.Save(RecordName(record.DocumentID), data); err != nil {
+		return err
+	}
+	s.recordStatusChange(record.DocumentID, DocumentPurged, "", "")
+	return nil
+}
+
+// maskDocumentID oculta el documento del cliente salvo sus últimos 4 dígitos, para que
+// la auditoría no conserve el dato que se purgó
+func maskDocumentID(id string) string {
+	if len(id) <= 4 {
+		return strings.Repeat("*", len(id))
+	}
+	return strings.Repeat("*", len(id)-4) + id[len(id)-4:]
+}
+
+// savePurgeAudit guarda el registro de auditoría de una purga
+func (s *UBLConverterService) savePurgeAudit(request PurgeRequest, report *PurgeReport, now time.Time) error {
+	request.CustomerDocumentID = maskDocumentID(request.CustomerDocumentID)
+	data, err := json.Marshal(PurgeAudit{
+		AuditID:        report.AuditID,
+		RequestedBy:    request.RequestedBy,
+		Reason:         request.Reason,
+		Filter:         request,
+		PurgedAt:       now,
+		RetentionYears: s.retentionYears,
+		Report:         *report,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := s.store.Save(PurgeAuditName(report.AuditID), data); err != nil {
+		return fmt.Errorf("failed to save purge audit: %v", err)
+	}
+	return nil
+}
+
+// ListPurgeAudits retorna los registros de auditoría de las purgas, del más antiguo al
+// más reciente
+func (s *UBLConverterService) ListPurgeAudits() ([]PurgeAudit, error) {
+	names, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	audits := []PurgeAudit{}
+	for _, name := range names {
+		if !strings.HasSuffix(name, PurgeAuditSuffix) {
+			continue
+		}
+		data, err := s.store.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		var audit PurgeAudit
+		if err := json.Unmarshal(data, &audit); err != nil {
+			return nil, fmt.Errorf("invalid purge audit %s: %v", name, err)
+		}
+		audits = append(audits, audit)
+	}
+	sort.SliceStable(audits, func(i, j int) bool {
+		return audits[i].PurgedAt.Before(audits[j].PurgedAt)
+	})
+	return audits, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	. "API-SUNAT2/model"
+)
+
+// EventQueueName es el nombre de la cola de eventos de documentos hacia el bus de mensajes
+const EventQueueName = "events"
+
+// Queue es la introspección y el control común de las colas en memoria del servicio
+type Queue interface {
+	Name() string
+	Stats() QueueStats
+	// Items retorna los elementos en proceso y pendientes, en el orden en que se procesan
+	Items(offset, limit int) []QueueItem
+	// Pause detiene la toma de elementos nuevos; el que está en proceso termina
+	Pause()
+	Resume()
+	// Drain procesa los pendientes aunque la cola esté pausada y espera a que quede
+	// vacía o a que se cancele ctx
+	Drain(ctx context.Context) error
+}
+
+// Queues retorna las colas en memoria activas del servicio, ordenadas por nombre
+func (s *UBLConverterService) Queues() []Queue {
+	var queues []Queue
+	if s.events != nil {
+		queues = append(queues, s.events)
+	}
+	sort.Slice(queues, func(i, j int) bool { return queues[i].Name() < queues[j].Name() })
+	return queues
+}
+
+// Queue retorna la cola activa con ese nombre
+func (s *UBLConverterService) Queue(name string) (Queue, bool) {
+	for _, queue := range s.Queues() {
+		if queue.Name() == name {
+			return queue, true
+		}
+	}
+	return nil, false
+}
+
+// processedWindow cuenta los elementos procesados en el último minuto
+type processedWindow struct {
+	times []time.Time
+}
+
+func (w *processedWindow) add(at time.Time) {
+	w.prune(at)
+	w.times = append(w.times, at)
+}
+
+func (w *processedWindow) count(now time.Time) int {
+	w.prune(now)
+	return len(w.times)
+}
+
+func (w *processedWindow) prune(now time.Time) {
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(w.times) && !w.times[i].After(cutoff) {
+		i++
+	}
+	w.times = w.times[i:]
+}
+
+// pageItems aplica offset y limit a los elementos de una cola
+func pageItems(items []QueueItem, offset, limit int) []QueueItem {
+	if offset >= len(items) {
+		return []QueueItem{}
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
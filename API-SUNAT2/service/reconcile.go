@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// Estados de un envío sin CDR
+const (
+	// SubmissionSent es un envío sin respuesta de SUNAT (timeout, caída de red o del proceso)
+	SubmissionSent = "ENVIADO"
+	// SubmissionResend es un envío que SUNAT no registra: debe reenviarse
+	SubmissionResend = "REENVIAR"
+)
+
+// SunatCdrNotFound es el código de getStatusCdr de un comprobante que SUNAT no tiene registrado
+const SunatCdrNotFound = "0011"
+
+// ErrReconcileRunning indica que ya hay una reconciliación en curso
+var ErrReconcileRunning = errors.New("reconciliation already running")
+
+// ReconcileOptions configura la reconciliación de envíos sin CDR
+type ReconcileOptions struct {
+	// MinAge es la antigüedad mínima de un envío para consultarlo
+	MinAge time.Duration
+	// BatchSize es la cantidad máxima de envíos consultados por ejecución
+	BatchSize int
+	// RequestInterval es la pausa entre consultas a SUNAT
+	RequestInterval time.Duration
+}
+
+// DefaultReconcileOptions consulta hasta 50 envíos de más de 2 horas, uno por segundo
+var DefaultReconcileOptions = ReconcileOptions{MinAge: 2 * time.Hour, BatchSize: 50, RequestInterval: time.Second}
+
+// ReconcileResult es el resultado de la consulta de un envío
+type ReconcileResult struct {
+	DocumentID  string `json:"documentId"`
+	Environment string `json:"environment"`
+	// Status es el nuevo estado del envío, o ENVIADO si la consulta falló
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// ReconcileReport resume una ejecución de la reconciliación
+type ReconcileReport struct {
+	// Pending son los envíos sin CDR con la antigüedad mínima; Remaining los que
+	// quedan para la próxima ejecución
+	Pending   int               `json:"pending"`
+	Checked   int               `json:"checked"`
+	Updated   int               `json:"updated"`
+	Resend    int               `json:"resend"`
+	Failed    int               `json:"failed"`
+	Remaining int               `json:"remaining"`
+	Results   []ReconcileResult `json:"results"`
+}
+
+// SetReconcileOptions configura la reconciliación; los valores en cero conservan el default
+func (s *UBLConverterService) SetReconcileOptions(opts ReconcileOptions) {
+	if opts.MinAge > 0 {
+		s.reconcile.MinAge = opts.MinAge
+	}
+	if opts.BatchSize > 0 {
+		s.reconcile.BatchSize = opts.BatchSize
+	}
+	if opts.RequestInterval > 0 {
+		s.reconcile.RequestInterval = opts.RequestInterval
+	}
+}
+
+// GetReconcileOptions retorna la configuración de la reconciliación
+func (s *UBLConverterService) GetReconcileOptions() ReconcileOptions {
+	return s.reconcile
+}
+
+// ReconcileSubmissions consulta con getStatusCdr los envíos que siguen en ENVIADO
+// después de opts.MinAge, del más antiguo al más reciente y a lo sumo opts.BatchSize
+// por ejecución, con opts.RequestInterval entre consultas. Si SUNAT tiene el CDR se
+// guarda y el envío toma su estado; si no tiene el comprobante, el envío queda en
+// REENVIAR. Solo puede haber una ejecución a la vez.
+func (s *UBLConverterService) ReconcileSubmissions(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	if !s.reconcileMu.TryLock() {
+		return nil, ErrReconcileRunning
+	}
+	defer s.reconcileMu.Unlock()
+
+	records, err := s.ListSubmissions("")
+	if err != nil {
+		return nil, err
+	}
+	cutoff := s.clock.Now().Add(-opts.MinAge)
+	var pending []SubmissionRecord
+	for _, record := range records {
+		if record.Status == SubmissionSent && !record.SentAt.After(cutoff) {
+			pending = append(pending, record)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].SentAt.Before(pending[j].SentAt)
+	})
+
+	report := &ReconcileReport{Pending: len(pending), Results: []ReconcileResult{}}
+	if opts.BatchSize > 0 && len(pending) > opts.BatchSize {
+		pending = pending[:opts.BatchSize]
+	}
+
+	correlationID := GenerateCorrelationID()
+	for i := range pending {
+		if i > 0 && opts.RequestInterval > 0 {
+			timer := time.NewTimer(opts.RequestInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		result := s.reconcileSubmission(ctx, correlationID, &pending[i])
+		report.Checked++
+		switch result.Status {
+		case SubmissionSent:
+			report.Failed++
+		case SubmissionResend:
+			report.Resend++
+		default:
+			report.Updated++
+		}
+		report.Results = append(report.Results, result)
+	}
+	report.Remaining = report.Pending - report.Checked
+	return report, nil
+}
+
+// reconcileSubmission consulta un envío y actualiza su registro con la respuesta de SUNAT
+func (s *UBLConverterService) reconcileSubmission(ctx context.Context, correlationID string, record *SubmissionRecord) ReconcileResult {
+	result := ReconcileResult{DocumentID: record.DocumentID, Environment: record.Environment, Status: SubmissionSent}
+	parts := documentIDPattern.FindStringSubmatch(record.DocumentID)
+	if parts == nil {
+		result.Message = "invalid document id"
+		return result
+	}
+	ruc, docType, series, number := parts[1], parts[2], parts[3], parts[4]
+	docNumber := series + "-" + number
+
+	fail := func(code, message string) ReconcileResult {
+		s.logService.LogError(correlationID, "RECONCILE_SUBMISSION_ERROR", docType, docNumber, code, message)
+		result.Message = message
+		return result
+	}
+
+	if s.validateOnly {
+		return fail(ErrValidateOnlyCode, "La consulta a SUNAT está deshabilitada en modo validate-only")
+	}
+	var client SunatClient
+	if record.Environment == EnvironmentMock {
+		client = s.sunatMock
+	} else if s.sunat != nil {
+		var err error
+		if client, err = s.sunat.ClientFor(ruc, record.Environment); err != nil {
+			return fail("ERR_SUNAT_CREDENTIALS", err.Error())
+		}
+	}
+	if client == nil {
+		return fail("ERR_SUNAT_NOT_CONFIGURED", fmt.Sprintf("No hay cliente SUNAT para el ambiente %s", record.Environment))
+	}
+
+	status, err := client.GetStatusCdr(ctx, ruc, docType, series, number)
+	if err != nil {
+		return fail("ERR_SUNAT_UNAVAILABLE", err.Error())
+	}
+
+	now := s.clock.Now()
+	switch {
+	case len(status.CDR) > 0:
+		cdr, err := ParseCDR(status.CDR)
+		if err != nil {
+			return fail("ERR_CDR_INVALID", err.Error())
+		}
+		record.CDRFile = fmt.Sprintf("R-%s.%s.zip", record.DocumentID, record.Environment)
+		if _, err := s.store.Save(record.CDRFile, status.CDR); err != nil {
+			return fail("SAVE_FAILED", fmt.Sprintf("Error al guardar el CDR: %v", err))
+		}
+		record.Status, record.ResponseCode, record.Description, record.Notes = cdr.Status, cdr.ResponseCode, cdr.Description, cdr.Notes
+		s.logService.LogInfo(correlationID, "RECONCILE_SUBMISSION", docType, docNumber, fmt.Sprintf("CDR recuperado de SUNAT: %s", cdr.Status))
+	case status.Code == SunatCdrNotFound:
+		record.Status, record.ResponseCode, record.Description = SubmissionResend, status.Code, status.Message
+		s.logService.LogError(correlationID, "RECONCILE_SUBMISSION_ALERT", docType, docNumber, "ERR_SUNAT_NOT_REGISTERED",
+			fmt.Sprintf("SUNAT no tiene registrado el comprobante enviado el %s: debe reenviarse", record.SentAt.Format(time.RFC3339)))
+	default:
+		return fail("ERR_SUNAT_STATUS", fmt.Sprintf("getStatusCdr %s: %s", status.Code, status.Message))
+	}
+
+	record.ReconciledAt = &now
+	data, _ := json.Marshal(record)
+	if _, err := s.store.Save(fmt.Sprintf("%s.%s.envio", record.DocumentID, record.Environment), data); err != nil {
+		return fail("SAVE_FAILED", fmt.Sprintf("Error al registrar el envío: %v", err))
+	}
+	s.recordStatusChange(record.DocumentID, record.Status, record.Environment, record.Description)
+	result.Status, result.Message = record.Status, record.Description
+	return result
+}
+
+// StartReconciler ejecuta la reconciliación cada interval en segundo plano con la
+// configuración del servicio, hasta que se llame a la función retornada
+func (s *UBLConverterService) StartReconciler(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := s.JobContext()
+			report, err := s.ReconcileSubmissions(ctx, s.reconcile)
+			cancel()
+			if err != nil {
+				if err != ErrReconcileRunning {
+					s.GetLogger().Errorf("Reconciliación de envíos falló: %v", err)
+				}
+				continue
+			}
+			if report.Checked > 0 {
+				s.GetLogger().Infof("Reconciliación de envíos: %d consultados, %d actualizados, %d para reenvío, %d fallidos, %d pendientes",
+					report.Checked, report.Updated, report.Resend, report.Failed, report.Remaining)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
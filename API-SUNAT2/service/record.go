@@ -0,0 +1,145 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// Origen de los registros de documentos
+const (
+	RecordSourcePipeline  = "pipeline"
+	RecordSourceMigration = "migration"
+)
+
+// RecordSuffix es la extensión del registro de metadatos de un documento en el store
+const RecordSuffix = ".meta"
+
+// documentFilePattern reconoce el nombre RUC-TIPO-SERIE-NUMERO.xml de un documento
+var documentFilePattern = regexp.MustCompile(`^(\d{11})-(01|03|07|08)-([A-Za-z0-9]{4})-(\d{1,8})\.xml$`)
+
+// RecordName retorna el nombre del registro de metadatos de un documento
+func RecordName(documentID string) string {
+	return documentID + RecordSuffix
+}
+
+// ExtractDocumentRecord arma el registro de un XML firmado a partir de su nombre
+// (RUC-TIPO-SERIE-NUMERO.xml) y de su contenido: fecha de emisión, moneda, totales,
+// digest de la firma y, en las notas, el documento afectado. El ID del XML debe
+// coincidir con la serie y número del nombre.
+func ExtractDocumentRecord(fileName string, xmlData []byte) (*DocumentRecord, error) {
+	match := documentFilePattern.FindStringSubmatch(fileName)
+	if match == nil {
+		return nil, fmt.Errorf("file name does not match RUC-TIPO-SERIE-NUMERO.xml")
+	}
+
+	// El registro usa el correlativo canónico aunque el archivo lleve ceros a la izquierda
+	record := &DocumentRecord{
+		DocumentID:   CanonicalDocumentID(strings.TrimSuffix(fileName, ".xml")),
+		IssuerRUC:    match[1],
+		DocumentType: match[2],
+		Series:       match[3],
+		Number:       CanonicalNumber(match[4]),
+		XMLFile:      fileName,
+	}
+
+	var documentID, payable, taxAmount, affectedID, affectedType string
+	var billingReferences int
+	decoder := NewXMLDecoder(bytes.NewReader(xmlData))
+	var path []xml.Name
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			switch {
+			case len(path) == 2 && path[1] == CAC("BillingReference"):
+				billingReferences++
+			case len(path) == 2 && IsUBLDocumentRoot(path[0]):
+				switch t.Name {
+				case CBC("ID"):
+					documentID = value
+				case CBC("IssueDate"):
+					record.IssueDate = value
+				case CBC("DocumentCurrencyCode"):
+					record.Currency = value
+				}
+			case len(path) == 5:
+				// Documento de identidad del cliente
+				if path[1] == CAC("AccountingCustomerParty") && path[3] == CAC("PartyIdentification") && t.Name == CBC("ID") {
+					record.CustomerDocumentID = value
+				}
+			case len(path) == 4:
+				// Documento afectado por una nota; en una consolidada, el primero
+				if path[1] == CAC("BillingReference") && path[2] == CAC("InvoiceDocumentReference") && billingReferences == 0 {
+					switch t.Name {
+					case CBC("ID"):
+						affectedID = value
+					case CBC("DocumentTypeCode"):
+						affectedType = value
+					}
+				}
+			case len(path) == 3:
+				switch {
+				case path[1] == CAC("TaxTotal") && t.Name == CBC("TaxAmount"):
+					taxAmount = value
+				case (path[1] == CAC("LegalMonetaryTotal") || path[1] == CAC("RequestedMonetaryTotal")) && t.Name == CBC("PayableAmount"):
+					payable = value
+				}
+			}
+			if t.Name == DS("DigestValue") && record.DigestValue == "" {
+				record.DigestValue = value
+			}
+			path = path[:len(path)-1]
+			text.Reset()
+		}
+	}
+
+	if expected := record.Series + "-" + record.Number; canonicalSeriesNumber(documentID) != expected {
+		return nil, fmt.Errorf("XML ID %q does not match file name %s", documentID, expected)
+	}
+	if record.IssueDate == "" {
+		return nil, fmt.Errorf("IssueDate not found")
+	}
+	if record.DigestValue == "" {
+		return nil, fmt.Errorf("signature DigestValue not found")
+	}
+	var err error
+	if record.PayableAmount, err = strconv.ParseFloat(payable, 64); err != nil {
+		return nil, fmt.Errorf("invalid PayableAmount %q", payable)
+	}
+	if taxAmount != "" {
+		if record.TaxAmount, err = strconv.ParseFloat(taxAmount, 64); err != nil {
+			return nil, fmt.Errorf("invalid TaxAmount %q", taxAmount)
+		}
+	}
+
+	if affectedID != "" && affectedType != "" {
+		record.AffectedDocumentID = fmt.Sprintf("%s-%s-%s", record.IssuerRUC, affectedType, affectedID)
+	}
+
+	hash := sha256.Sum256(xmlData)
+	record.XMLHash = hex.EncodeToString(hash[:])
+	return record, nil
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// ReversionDocumentType identifica a los resúmenes de reversiones en su nombre (RUC-RR-AAAAMMDD-N)
+const ReversionDocumentType = "RR"
+
+// DocumentReverted es el estado de un comprobante de retención o percepción revertido
+// por un resumen de reversiones aceptado por SUNAT
+const DocumentReverted = "REVERTIDO"
+
+// MaxReversionReasonLength es la longitud máxima del motivo de una reversión
+const MaxReversionReasonLength = 100
+
+// reversionSeriesPrefix es la letra con que empieza la serie de los comprobantes que se
+// revierten por resumen de reversiones: retención (20) y percepción (40)
+var reversionSeriesPrefix = map[string]string{"20": "R", "40": "P"}
+
+var reversionSeriesPattern = regexp.MustCompile(`^[A-Z0-9]{4}$`)
+
+var reversionNumberPattern = regexp.MustCompile(`^\d{1,8}$`)
+
+// GenerateReversion arma y firma el resumen de reversiones (RR) de los comprobantes de
+// retención y percepción del request, emitidos todos en su fecha de referencia. Los
+// comprobantes ya revertidos por un resumen aceptado, o con uno en proceso, se
+// rechazan. El resumen queda en el store listo para enviarse con SendDocument; al
+// aceptarlo SUNAT, los comprobantes pasan a REVERTIDO.
+func (s *UBLConverterService) GenerateReversion(ctx context.Context, request *ReversionRequest, certPEM, keyPEM []byte) (*APIResponse, error) {
+	startTime := s.clock.Now()
+	correlationID := GenerateCorrelationID()
+	if s.validateOnly {
+		certPEM, keyPEM = validateOnlyCertificate, validateOnlyKey
+	}
+
+	reversionError := func(code, message string) *APIResponse {
+		s.logService.LogError(correlationID, "GENERATE_REVERSION_ERROR", ReversionDocumentType, "", code, message)
+		return &APIResponse{
+			Status:        "ERROR",
+			CorrelationID: correlationID,
+			ProcessedAt:   s.clock.Now(),
+			ErrorCode:     code,
+			ErrorMessage:  message,
+		}
+	}
+
+	ruc := strings.TrimSpace(request.RUC)
+	if !rucPattern.MatchString(ruc) {
+		return reversionError("ERR_INVALID_RUC", "El ruc debe tener 11 dígitos"), nil
+	}
+	registrationName := strings.TrimSpace(request.RegistrationName)
+	if registrationName == "" {
+		return reversionError("ERR_INVALID_REVERSION", "Falta la razón social del emisor (registrationName)"), nil
+	}
+	referenceDate, err := time.Parse("2006-01-02", request.ReferenceDate)
+	if err != nil {
+		return reversionError("ERR_INVALID_DATE", "La fecha de referencia debe tener el formato AAAA-MM-DD"), nil
+	}
+	issueDate := s.clock.Now().Format("2006-01-02")
+	if referenceDate.Format("2006-01-02") > issueDate {
+		return reversionError("ERR_INVALID_DATE", fmt.Sprintf("La fecha %s es posterior a la fecha de generación %s", request.ReferenceDate, issueDate)), nil
+	}
+	if len(request.Documents) == 0 {
+		return reversionError("ERR_REVERSION_EMPTY", "No hay comprobantes que revertir"), nil
+	}
+
+	record := &SummaryRecord{
+		IssuerRUC:     ruc,
+		ReferenceDate: request.ReferenceDate,
+		IssueDate:     issueDate,
+		Status:        SummaryGenerated,
+	}
+	for i, document := range request.Documents {
+		series := strings.ToUpper(strings.TrimSpace(document.Series))
+		prefix, reversible := reversionSeriesPrefix[document.DocumentType]
+		reason := strings.TrimSpace(document.Reason)
+		switch {
+		case !reversible:
+			return reversionError("ERR_INVALID_REVERSION", fmt.Sprintf("documents[%d]: solo se revierten comprobantes de retención (20) o percepción (40)", i)), nil
+		case !reversionSeriesPattern.MatchString(series) || !strings.HasPrefix(series, prefix):
+			return reversionError("ERR_INVALID_REVERSION", fmt.Sprintf("documents[%d]: la serie de un comprobante %s tiene 4 caracteres y empieza con %s", i, document.DocumentType, prefix)), nil
+		case !reversionNumberPattern.MatchString(strings.TrimSpace(document.Number)):
+			return reversionError("ERR_INVALID_REVERSION", fmt.Sprintf("documents[%d]: el número debe tener de 1 a 8 dígitos", i)), nil
+		case reason == "":
+			return reversionError("ERR_INVALID_REVERSION", fmt.Sprintf("documents[%d]: falta el motivo de la reversión", i)), nil
+		case utf8.RuneCountInString(reason) > MaxReversionReasonLength:
+			return reversionError("ERR_INVALID_REVERSION", fmt.Sprintf("documents[%d]: el motivo supera los %d caracteres", i, MaxReversionReasonLength)), nil
+		}
+		number := CanonicalNumber(document.Number)
+		documentID := DocumentKey(ruc, document.DocumentType, series, number)
+		for _, line := range record.Lines {
+			if line.DocumentID == documentID {
+				return reversionError("ERR_INVALID_REVERSION", fmt.Sprintf("documents[%d]: %s está repetido", i, documentID)), nil
+			}
+		}
+		record.Lines = append(record.Lines, SummaryRecordLine{
+			DocumentID:   documentID,
+			DocumentType: document.DocumentType,
+			Number:       series + "-" + number,
+			Reason:       reason,
+		})
+	}
+
+	// Serializar la generación para que dos resúmenes no tomen el mismo correlativo
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+
+	// Comprobantes revertidos o en proceso de revertirse, y último correlativo del día
+	reverted := map[string]string{}
+	lastNumber := 0
+	prefix := fmt.Sprintf("%s-%s-%s-", ruc, ReversionDocumentType, strings.ReplaceAll(issueDate, "-", ""))
+	err = s.readJSONRecords(SummarySuffix, func(name string, data []byte) error {
+		summaryID := strings.TrimSuffix(name, SummarySuffix)
+		if !strings.HasPrefix(summaryID, ruc+"-"+ReversionDocumentType+"-") {
+			return nil
+		}
+		if strings.HasPrefix(summaryID, prefix) {
+			if number, err := strconv.Atoi(strings.TrimPrefix(summaryID, prefix)); err == nil && number > lastNumber {
+				lastNumber = number
+			}
+		}
+		var summary SummaryRecord
+		if err := json.Unmarshal(data, &summary); err != nil {
+			return fmt.Errorf("invalid summary record %s: %v", name, err)
+		}
+		if summary.Status != CDRAccepted && summary.Status != CDRObserved && summary.Status != SummaryInProcess {
+			return nil
+		}
+		for _, line := range summary.Lines {
+			reverted[line.DocumentID] = summary.SummaryID
+		}
+		return nil
+	})
+	if err != nil {
+		return reversionError("ERR_STORE_READ", err.Error()), nil
+	}
+	for _, line := range record.Lines {
+		if summaryID, ok := reverted[line.DocumentID]; ok {
+			return reversionError("ERR_ALREADY_REVERTED", fmt.Sprintf("El comprobante %s ya se revierte en el resumen %s", line.DocumentID, summaryID)), nil
+		}
+	}
+
+	record.SummaryID = fmt.Sprintf("%s%d", prefix, lastNumber+1)
+	reversionNumber := strings.TrimPrefix(record.SummaryID, ruc+"-")
+	reversion := &UBLVoidedDocuments{
+		Xmlns:           "urn:sunat:names:specification:ubl:peru:schema:xsd:VoidedDocuments-1",
+		XmlnsCac:        "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
+		XmlnsCbc:        "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
+		XmlnsDs:         "http://www.w3.org/2000/09/xmldsig#",
+		XmlnsExt:        "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2",
+		XmlnsSac:        "urn:sunat:names:specification:ubl:peru:schema:xsd:SunatAggregateComponents-1",
+		UBLVersionID:    "2.0",
+		CustomizationID: "1.0",
+		ID:              reversionNumber,
+		ReferenceDate:   request.ReferenceDate,
+		IssueDate:       issueDate,
+		Signature: &UBLSignature{
+			ID: reversionNumber,
+			SignatoryParty: UBLSignatoryParty{
+				PartyIdentification: UBLPartyIdentification{ID: UBLIDWithScheme{Value: ruc}},
+				PartyName:           UBLPartyName{Name: registrationName},
+			},
+			DigitalSignatureAttachment: UBLDigitalSignatureAttachment{
+				ExternalReference: UBLExternalReference{URI: "#SignatureSP"},
+			},
+		},
+		AccountingSupplierParty: UBLSummarySupplier{
+			CustomerAssignedAccountID: ruc,
+			AdditionalAccountID:       "6",
+			RegistrationName:          registrationName,
+		},
+	}
+	for i, line := range record.Lines {
+		series, number, _ := strings.Cut(line.Number, "-")
+		reversion.Lines = append(reversion.Lines, UBLVoidedLine{
+			LineID:                strconv.Itoa(i + 1),
+			DocumentTypeCode:      line.DocumentType,
+			DocumentSerialID:      series,
+			DocumentNumberID:      number,
+			VoidReasonDescription: line.Reason,
+		})
+	}
+
+	zipPath, signedXML, err := s.signSummary(ctx, record.SummaryID, reversion, certPEM, keyPEM)
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		return reversionError(stepErr.Code, stepErr.Message), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record.CreatedAt = s.clock.Now()
+	if err := s.saveSummaryRecord(record); err != nil {
+		return reversionError("SAVE_FAILED", fmt.Sprintf("Error al registrar el resumen de reversiones: %v", err)), nil
+	}
+	s.logService.LogInfo(correlationID, "GENERATE_REVERSION", ReversionDocumentType, reversionNumber, fmt.Sprintf("Resumen de reversiones con %d comprobantes del %s", len(record.Lines), request.ReferenceDate))
+
+	hash := sha256.Sum256(signedXML)
+	return &APIResponse{
+		Status:        "SUCCESS",
+		CorrelationID: correlationID,
+		DocumentID:    record.SummaryID,
+		XMLPath:       zipPath,
+		XMLHash:       hex.EncodeToString(hash[:]),
+		ProcessedAt:   s.clock.Now(),
+		Duration:      s.clock.Now().Sub(startTime).Milliseconds(),
+		Data: map[string]interface{}{
+			"reversionId":   reversionNumber,
+			"referenceDate": request.ReferenceDate,
+			"lines":         record.Lines,
+		},
+	}, nil
+}
+
+// recordReversion pasa a REVERTIDO cada comprobante del resumen de reversiones que SUNAT
+// aceptó; reenviar el resumen no repite el estado de los ya revertidos
+func (s *UBLConverterService) recordReversion(summary *SummaryRecord, environment string) {
+	if summary.Status != CDRAccepted && summary.Status != CDRObserved {
+		return
+	}
+	for _, line := range summary.Lines {
+		history, _ := s.readStatusHistory(line.DocumentID)
+		if len(history) > 0 && history[len(history)-1].Status == DocumentReverted {
+			continue
+		}
+		s.recordStatusChange(line.DocumentID, DocumentReverted, environment, line.Reason)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	. "API-SUNAT2/model"
+)
+
+// RedactedValue reemplaza los campos sensibles de un request saneado
+const RedactedValue = "[REDACTED]"
+
+// AuditSuffix es la extensión del request original guardado para auditoría
+const AuditSuffix = ".auditoria"
+
+// AuditRecord es el request de conversión guardado para auditoría, ya saneado
+type AuditRecord struct {
+	CorrelationID string          `json:"correlationId"`
+	DocumentID    string          `json:"documentId"`
+	ReceivedAt    time.Time       `json:"receivedAt"`
+	Request       *ConvertRequest `json:"request"`
+}
+
+// SanitizeConvertRequest retorna una copia del request sin el certificado ni la clave
+// privada, reemplazados por RedactedValue. Todo request que se persista, se registre
+// en los logs o se envíe a un webhook debe pasar antes por aquí.
+func SanitizeConvertRequest(request *ConvertRequest) *ConvertRequest {
+	sanitized := *request
+	sanitized.Certificate = redact(request.Certificate)
+	sanitized.PrivateKey = redact(request.PrivateKey)
+	return &sanitized
+}
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return RedactedValue
+}
+
+// DocumentIDOf retorna el identificador RUC-TIPO-SERIE-NUMERO del documento
+func DocumentIDOf(doc *BusinessDocument) string {
+	return fmt.Sprintf("%s-%s-%s-%s", doc.Issuer.DocumentID, doc.Type, doc.Series, doc.Number)
+}
+
+// SetAuditRequests habilita guardar en el store el request de conversión saneado
+func (s *UBLConverterService) SetAuditRequests(enabled bool) {
+	s.auditRequests = enabled
+}
+
+// AuditConvertRequest guarda el request saneado junto a los archivos del documento
+// si la auditoría está habilitada
+func (s *UBLConverterService) AuditConvertRequest(correlationID string, request *ConvertRequest) error {
+	if !s.auditRequests {
+		return nil
+	}
+
+	documentID := DocumentIDOf(&request.Document)
+	data, err := json.Marshal(AuditRecord{
+		CorrelationID: correlationID,
+		DocumentID:    documentID,
+		ReceivedAt:    s.clock.Now(),
+		Request:       SanitizeConvertRequest(request),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.store.Save(documentID+AuditSuffix, data)
+	return err
+}
+
+// ZeroBytes sobrescribe con ceros el contenido, para no dejar claves en memoria
+func ZeroBytes(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+// zeroPrivateKey sobrescribe con ceros los valores privados de la clave RSA
+func zeroPrivateKey(key *rsa.PrivateKey) {
+	zeroInts := func(values ...*big.Int) {
+		for _, value := range values {
+			if value == nil {
+				continue
+			}
+			words := value.Bits()
+			for i := range words {
+				words[i] = 0
+			}
+			value.SetInt64(0)
+		}
+	}
+	zeroInts(key.D, key.Precomputed.Dp, key.Precomputed.Dq, key.Precomputed.Qinv)
+	zeroInts(key.Primes...)
+}
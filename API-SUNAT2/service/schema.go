@@ -0,0 +1,521 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// JSONSchemaDraft es el dialecto de JSON Schema que publica el servicio
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaValidationRule es la regla de los errores estructurales sin regla de negocio equivalente
+const SchemaValidationRule = "schema_validation"
+
+// SchemaTypes son los tipos JSON admitidos por un nodo; uno solo se serializa como string
+type SchemaTypes []string
+
+func (t SchemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *SchemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaTypes{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// JSONSchema es el subconjunto de JSON Schema con que se describen los requests. El
+// mismo schema que se publica en /schema/document es el que valida la estructura del
+// request antes del binding.
+type JSONSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	ID          string                 `json:"$id,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Type        SchemaTypes            `json:"type,omitempty"`
+	Format      string                 `json:"format,omitempty"`
+	Pattern     string                 `json:"pattern,omitempty"`
+	Enum        []string               `json:"enum,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	Const       interface{}            `json:"const,omitempty"`
+	If          *JSONSchema            `json:"if,omitempty"`
+	Else        *JSONSchema            `json:"else,omitempty"`
+
+	// Los errores del nodo se reportan con la misma regla y mensajes que el validador
+	// de negocio, para que un documento inválido reciba la misma respuesta
+	rule     string
+	expected string
+	message  string
+	// relative hace que los paths del subárbol se reporten relativos a él (el
+	// documento dentro de ConvertRequest se reporta igual que en /validate)
+	relative bool
+	// openEnum publica el enum pero no lo exige en la validación estructural: el valor
+	// lo valida el validador de negocio con su propia regla. El enum debe ser todo lo
+	// que se acepta; un campo que admite otros códigos, como las unidades mapeadas por
+	// el emisor, no publica enum.
+	openEnum bool
+	// numeric marca los montos y cantidades (FlexFloat), que admiten un string numérico
+	numeric bool
+}
+
+// schemaConstraint son las restricciones de un path del documento que no se deducen del tipo Go
+type schemaConstraint struct {
+	description string
+	format      string
+	pattern     string
+	enum        []string
+	required    []string
+	rule        string
+	expected    string
+	message     string
+	openEnum    bool
+	conditional *conditionalRequired
+}
+
+// conditionalRequired son campos obligatorios salvo que el booleano flag sea true; se
+// publica como if/else
+type conditionalRequired struct {
+	flag   string
+	fields []string
+}
+
+// documentConstraints indexa las restricciones por path; los elementos de un arreglo usan "[]"
+var documentConstraints = map[string]schemaConstraint{
+	"": {
+		description: "Comprobante electrónico (factura, boleta, nota de crédito o débito)",
+		required:    []string{"type", "series", "number", "issueDate", "currency", "issuer", "customer", "items"},
+		// Con pricesIncludeTax el servicio deriva los totales de los precios
+		conditional: &conditionalRequired{flag: "pricesIncludeTax", fields: []string{"totals"}},
+	},
+	"type": {
+		description: "Tipo de comprobante del catálogo 01",
+		enum:        []string{"01", "03", "07", "08"},
+		rule:        "document_type_validation",
+		expected:    "Valid document type (01, 03, 07, 08)",
+		message:     "Document type is not valid",
+	},
+	"issueDate": {
+		format:   "date",
+		rule:     "date_validation",
+		expected: "Valid date format YYYY-MM-DD",
+		message:  "Issue date format is invalid",
+	},
+	"dueDate": {format: "date"},
+	"operationType": {
+		description: "Tipo de operación del catálogo 51 (ProfileID); por defecto 0101",
+		enum:        OperationTypes(),
+		rule:        "operation_type_validation",
+		expected:    "Operation type from catalog 51",
+		message:     "Operation type is not supported",
+	},
+	"exchangeRate": {
+		description: "Tipo de cambio a soles; en boletas en moneda extranjera decide el umbral de identificación del cliente",
+	},
+	"globalDiscount": {
+		description: "Descuento global que afecta la base imponible del IGV (catálogo 53, código 02); subTotal ya lo descuenta",
+	},
+	"convertNegativeLines": {
+		description: "Convierte las líneas con cantidad o precio negativo en descuentos; sin indicar decide la configuración",
+	},
+	"emitPricingReference": {
+		description: "Emite cac:PricingReference en las líneas; sin indicar decide la configuración del emisor",
+	},
+	"currency": {
+		description: "Moneda ISO 4217",
+		enum:        []string{"PEN", "USD", "EUR"},
+		rule:        "currency_validation",
+		expected:    "Valid currency code (PEN, USD, EUR)",
+		message:     "Currency code is not valid",
+	},
+	"issuer": {required: []string{"documentType", "documentId", "name", "address"}},
+	"issuer.documentId": {
+		description: "RUC del emisor",
+		pattern:     `^\d{11}$`,
+		rule:        "ruc_validation",
+		expected:    "Valid RUC format",
+		message:     "RUC format is invalid",
+	},
+	"issuer.address": {required: []string{"ubigeo"}},
+	"issuer.address.ubigeo": {
+		description: "Ubigeo INEI de 6 dígitos",
+		pattern:     `^\d{6}$`,
+		rule:        "ubigeo_validation",
+		expected:    "6-digit INEI ubigeo code",
+		message:     "Issuer ubigeo is required and must have 6 digits",
+	},
+	"issuer.email": {
+		description: "Correo de contacto del emisor (cac:Contact); se suele fijar en la plantilla",
+		pattern:     contactEmailPattern,
+		rule:        "contact_validation",
+		expected:    "Email address (user@domain.tld)",
+		message:     "Contact email format is invalid",
+	},
+	"issuer.telephone": {
+		description: "Teléfono de contacto del emisor (cac:Contact); se suele fijar en la plantilla",
+		pattern:     contactTelephonePattern,
+		rule:        "contact_validation",
+		expected:    "6 to 20 digits, optionally with +, spaces, dashes or parentheses",
+		message:     "Contact telephone format is invalid",
+	},
+	"customer": {required: []string{"documentType", "documentId", "name"}},
+	"customer.address.ubigeo": {
+		description: "Ubigeo INEI de 6 dígitos (opcional)",
+		pattern:     `^(\d{6})?$`,
+		rule:        "ubigeo_validation",
+		expected:    "6-digit INEI ubigeo code",
+		message:     "Customer ubigeo must have 6 digits",
+	},
+	"items[]": {required: []string{"description", "quantity", "unitCode", "unitPrice"}},
+	"items[].unitCode": {
+		description: "Unidad de medida del catálogo 03, o un código del emisor con mapeo en /api/v1/issuers/{ruc}/unit-mappings (sin enum: los códigos mapeados dependen del emisor)",
+	},
+	"items[].discount": {
+		description: "Descuento de la línea (catálogo 53, código 00); lineTotal es cantidad × precio menos el descuento",
+	},
+	"items[].classificationCode": {
+		description: "Código de producto SUNAT (catálogo 25, UNSPSC de 8 dígitos)",
+		pattern:     `^\d{8}$`,
+		rule:        "classification_code_validation",
+		expected:    "8-digit UNSPSC code",
+		message:     "Product code must have the 8 digits of the UNSPSC classification (catalog 25)",
+	},
+	"contingencyDate": {
+		format:      "date",
+		description: "Día de la caída declarada; un comprobante de contingencia no puede tener fecha posterior",
+	},
+	"items[].taxes[].affectationCode": {
+		description: "Tipo de afectación del IGV (catálogo 07); por defecto el que corresponde a taxType",
+		openEnum:    true,
+	},
+	"items[].taxes[]":                     {required: []string{"taxType", "taxAmount"}},
+	"items[].tourismDetail":               {required: []string{"passengerDocType", "passengerDocNumber", "passengerName", "serviceType", "startDate", "endDate"}},
+	"items[].tourismDetail.serviceType":   {enum: []string{TourismLodging, TourismPackage}},
+	"items[].tourismDetail.startDate":     {format: "date"},
+	"items[].tourismDetail.endDate":       {format: "date"},
+	"totals":                              {required: []string{"totalAmount", "payableAmount"}},
+	"taxes[]":                             {required: []string{"taxType", "taxAmount"}},
+	"reference":                           {required: []string{"documentType", "documentId"}},
+	"reference.issueDate":                 {format: "date"},
+	"exchangedDocuments[]":                {required: []string{"documentType", "documentId"}},
+	"paymentTerms":                        {required: []string{"method"}},
+	"paymentTerms.method":                 {enum: []string{PaymentCash, PaymentCredit}},
+	"paymentTerms.installments[]":         {required: []string{"amount", "dueDate"}},
+	"paymentTerms.installments[].dueDate": {format: "date"},
+	"perception":                          {required: []string{"regimeCode", "rate", "base", "amount", "totalCharged"}},
+	"paymentMeans[]":                      {required: []string{"code", "accountId"}},
+	"paymentMeans[].code":                 {description: "Medio de pago del catálogo 59"},
+}
+
+var (
+	schemaMu sync.Mutex
+	// schemaCatalogVersion es la versión de las listas de códigos con que se generaron
+	// los schemas; un override de catálogos los regenera
+	schemaCatalogVersion string
+	documentSchema       *JSONSchema
+	convertSchema        *JSONSchema
+)
+
+// DocumentSchema retorna el JSON Schema del BusinessDocument, generado a partir del
+// modelo y de las restricciones del validador
+func DocumentSchema() *JSONSchema {
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	return currentDocumentSchema()
+}
+
+// currentDocumentSchema retorna el schema del documento de las listas de códigos
+// activas; requiere schemaMu
+func currentDocumentSchema() *JSONSchema {
+	version := catalog.Version()
+	if documentSchema != nil && version == schemaCatalogVersion {
+		return documentSchema
+	}
+	documentSchema = buildSchema(reflect.TypeOf(BusinessDocument{}), "", documentConstraints, true)
+	documentSchema.Schema = JSONSchemaDraft
+	documentSchema.ID = "/api/v1/schema/document"
+	documentSchema.Title = "BusinessDocument"
+	// additional solo admite las claves registradas
+	documentSchema.Properties["additional"].Properties = additionalSchema()
+	// Los tipos de afectación publicados son los de la lista activa
+	items := documentSchema.Properties["items"].Items
+	items.Properties["taxes"].Items.Properties["affectationCode"].Enum = catalog.CodeValues(catalog.IGVAffectation)
+	schemaCatalogVersion, convertSchema = version, nil
+	return documentSchema
+}
+
+// ConvertRequestSchema retorna el JSON Schema del request de /convert
+func ConvertRequestSchema() *JSONSchema {
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	document := *currentDocumentSchema()
+	if convertSchema != nil {
+		return convertSchema
+	}
+	document.Schema, document.ID = "", ""
+	document.relative = true
+	convertSchema = &JSONSchema{
+		Schema:      JSONSchemaDraft,
+		ID:          "/api/v1/schema/document?request=convert",
+		Title:       "ConvertRequest",
+		Description: "Documento a convertir con el certificado y la clave privada en base64",
+		Type:        SchemaTypes{"object"},
+		Properties: map[string]*JSONSchema{
+			"document":    &document,
+			"certificate": {Type: SchemaTypes{"string"}, Description: "Certificado PEM codificado en base64"},
+			"privateKey":  {Type: SchemaTypes{"string"}, Description: "Clave privada PEM codificada en base64"},
+		},
+		// La falta del certificado o de la clave se reporta con sus propios códigos
+		Required: []string{"document"},
+	}
+	return convertSchema
+}
+
+// flexFloatType es el tipo de los montos y cantidades del modelo
+var flexFloatType = reflect.TypeOf(FlexFloat(0))
+
+// buildSchema deriva el schema de un tipo Go a partir de sus tags json. Los slices,
+// punteros y mapas admiten null salvo que el path sea obligatorio.
+func buildSchema(t reflect.Type, path string, constraints map[string]schemaConstraint, required bool) *JSONSchema {
+	schema := &JSONSchema{}
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		schema.Type = SchemaTypes{"object"}
+		schema.Properties = make(map[string]*JSONSchema)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			childPath := name
+			if path != "" {
+				childPath = path + "." + name
+			}
+			schema.Properties[name] = buildSchema(field.Type, childPath, constraints, contains(constraints[path].required, name))
+		}
+	case reflect.Slice:
+		schema.Type = SchemaTypes{"array"}
+		schema.Items = buildSchema(t.Elem(), path+"[]", constraints, true)
+		nullable = true
+	case reflect.Map:
+		schema.Type = SchemaTypes{"object"}
+		nullable = true
+	case reflect.String:
+		schema.Type = SchemaTypes{"string"}
+	case reflect.Bool:
+		schema.Type = SchemaTypes{"boolean"}
+	case reflect.Int, reflect.Int64:
+		schema.Type = SchemaTypes{"integer"}
+	case reflect.Float64:
+		schema.Type = SchemaTypes{"number"}
+		if t == flexFloatType {
+			schema.Type = append(schema.Type, "string")
+			schema.numeric = true
+		}
+	}
+	if nullable && !required {
+		schema.Type = append(schema.Type, "null")
+	}
+
+	c := constraints[path]
+	schema.Description = c.description
+	schema.Format = c.format
+	schema.Pattern = c.pattern
+	schema.Enum = c.enum
+	schema.Required = c.required
+	schema.rule, schema.expected, schema.message = c.rule, c.expected, c.message
+	schema.openEnum = c.openEnum
+	if c.conditional != nil {
+		schema.If = &JSONSchema{
+			Properties: map[string]*JSONSchema{c.conditional.flag: {Const: true}},
+			Required:   []string{c.conditional.flag},
+		}
+		schema.Else = &JSONSchema{Required: c.conditional.fields}
+	}
+	return schema
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate valida un valor JSON decodificado (map[string]interface{}, []interface{},
+// string, float64, bool o nil) y retorna un error por campo con su path JSON
+func (s *JSONSchema) Validate(value interface{}) []ValidationError {
+	var errors []ValidationError
+	s.validate(value, "", &errors)
+	return errors
+}
+
+func (s *JSONSchema) validate(value interface{}, path string, errors *[]ValidationError) {
+	if s.relative {
+		path = ""
+	}
+	if !s.acceptsType(value) {
+		*errors = append(*errors, s.fail(path, strings.Join(s.Type, " or "), jsonType(value), "Field has the wrong type"))
+		return
+	}
+	if s.Const != nil && value != s.Const {
+		*errors = append(*errors, s.fail(path, fmt.Sprint(s.Const), fmt.Sprint(value), "Value is not allowed"))
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		required := s.Required
+		if s.If != nil && s.Else != nil && len(s.If.Validate(v)) > 0 {
+			required = append(required[:len(required):len(required)], s.Else.Required...)
+		}
+		for _, name := range required {
+			if _, ok := v[name]; !ok {
+				child := s.Properties[name]
+				if child == nil {
+					child = &JSONSchema{}
+				}
+				*errors = append(*errors, child.fail(joinPath(path, name), "Required field", "", "Required field is missing"))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if child, ok := s.Properties[name]; ok {
+				child.validate(v[name], joinPath(path, name), errors)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), errors)
+			}
+		}
+	case string:
+		if s.numeric {
+			if _, err := ParseFlexFloat(v); err != nil {
+				*errors = append(*errors, s.fail(path, "Number or numeric string", v, "Value is not a number"))
+			}
+			return
+		}
+		if len(s.Enum) > 0 && !s.openEnum && !contains(s.Enum, v) {
+			*errors = append(*errors, s.fail(path, "One of "+strings.Join(s.Enum, ", "), v, "Value is not allowed"))
+		}
+		if s.Pattern != "" {
+			if matched, _ := regexp.MatchString(s.Pattern, v); !matched {
+				*errors = append(*errors, s.fail(path, "Value matching "+s.Pattern, v, "Value does not match the expected format"))
+			}
+		}
+		if s.Format == "date" {
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				*errors = append(*errors, s.fail(path, "Date YYYY-MM-DD", v, "Value is not a valid date"))
+			}
+		}
+	}
+}
+
+// acceptsType indica si el tipo JSON del valor es uno de los admitidos por el nodo
+func (s *JSONSchema) acceptsType(value interface{}) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+	actual := jsonType(value)
+	for _, t := range s.Type {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// fail arma el error del nodo; si el nodo corresponde a una regla del validador de
+// negocio, se usan su regla y sus mensajes
+func (s *JSONSchema) fail(path, expected, received, message string) ValidationError {
+	if s.rule != "" {
+		return ValidationError{Field: path, Expected: s.expected, Received: received, Rule: s.rule, Message: s.message}
+	}
+	return ValidationError{Field: path, Expected: expected, Received: received, Rule: SchemaValidationRule, Message: message}
+}
+
+// jsonType retorna el nombre JSON Schema del tipo de un valor decodificado
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// CheckStructure valida el cuerpo JSON de un request contra el schema antes del
+// binding. Retorna nil si el cuerpo es válido o si no es JSON (el binding reporta ese
+// error); en caso contrario, la misma respuesta VALIDATION_FAILED del pipeline.
+func (s *UBLConverterService) CheckStructure(schema *JSONSchema, body []byte) *APIResponse {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil
+	}
+	errs := schema.Validate(value)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	correlationID := GenerateCorrelationID()
+	stepErr := &StepError{
+		Operation:        "SCHEMA_VALIDATION_ERROR",
+		Code:             ValidationFailedCode,
+		Message:          "Documento no válido",
+		ValidationErrors: errs,
+	}
+	s.logService.LogError(correlationID, stepErr.Operation, "", "", stepErr.Code, fmt.Sprintf("%d errores de estructura en %s", len(errs), schema.Title))
+	return s.stepErrorResponse(correlationID, stepErr)
+}
@@ -0,0 +1,550 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	. "API-SUNAT2/util"
+)
+
+// Cada firma va en su propio ext:UBLExtension dentro del ext:UBLExtensions del
+// documento. El digest de una firma cubre el documento tal como estaba al firmar: con
+// las firmas anteriores y sin la propia ni las posteriores, de modo que agregar una
+// firma (por ejemplo la del OSE) no invalida las que ya estaban.
+//
+// Las extensiones y las firmas se ubican con el decoder, por namespace y nombre local:
+// un XML de otro proveedor puede usar namespaces por defecto u otros prefijos.
+const extensionsOpen = "<ext:UBLExtensions>"
+
+// SignatureVerification es el resultado de verificar una de las firmas del XML, en el
+// orden en que aparecen
+type SignatureVerification struct {
+	Index        int    `json:"index"`
+	Subject      string `json:"subject,omitempty"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+	Valid        bool   `json:"valid"`
+	Error        string `json:"error,omitempty"`
+}
+
+// signatureExtension ubica un ext:UBLExtension con firma; start incluye el espacio que
+// lo precede, para que quitarlo deje el XML como estaba antes de insertarlo. Guarda
+// también los valores de la firma que se necesitan para verificarla.
+type signatureExtension struct {
+	start, end      int
+	referenceURI    string
+	digestValue     string
+	signatureValue  string
+	x509Certificate string
+	// ordinal es la posición de su ds:Signature entre las del documento
+	ordinal int
+	// Algoritmos declarados en el ds:SignedInfo, para verificar firmas XMLDSig de otros facturadores
+	canonicalization string
+	signatureMethod  string
+	digestMethod     string
+	transforms       []string
+}
+
+// isPlaceholder indica si es la firma vacía que deja el convertidor para reemplazarla al firmar
+func (e signatureExtension) isPlaceholder() bool {
+	return e.signatureValue == ""
+}
+
+// extensionsBlock ubica el ext:UBLExtensions del documento: tagStart es el inicio de su
+// etiqueta de apertura, open el final de esa etiqueta y close el inicio de la de cierre
+// (igual a open si el elemento está vacío y sin etiqueta de cierre)
+type extensionsBlock struct {
+	tagStart, open, close int
+	extensions            []signatureExtension
+}
+
+func (b *extensionsBlock) selfClosing() bool {
+	return b.close == b.open
+}
+
+// offsetDecoder retorna un decoder cuyos InputOffset corresponden a los bytes de
+// xmlStr. Por eso el contenido no se convierte a UTF-8: los bytes no ASCII (texto en
+// ISO-8859-1) se enmascaran con el mismo largo, porque solo interesan las etiquetas,
+// los atributos ASCII y los valores en base64.
+func offsetDecoder(xmlStr string) *xml.Decoder {
+	masked := []byte(xmlStr)
+	for i, b := range masked {
+		if b >= utf8.RuneSelf {
+			masked[i] = '?'
+		}
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(masked))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder
+}
+
+// findExtensions ubica el ext:UBLExtensions hijo del elemento raíz y sus extensiones con
+// ds:Signature. Retorna nil si el documento no tiene UBLExtensions.
+func findExtensions(xmlStr string) (*extensionsBlock, error) {
+	decoder := offsetDecoder(xmlStr)
+	var block *extensionsBlock
+	var current *signatureExtension
+	blockClosed, hasSignature := false, false
+	var text strings.Builder
+	depth, signatures := 0, 0
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return block, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			text.Reset()
+			t.Name = ResolveName(t.Name)
+			switch {
+			case depth == 2 && block == nil && t.Name == Ext("UBLExtensions"):
+				block = &extensionsBlock{tagStart: offset, open: int(decoder.InputOffset())}
+			case depth == 3 && block != nil && !blockClosed && t.Name == Ext("UBLExtension"):
+				current = &signatureExtension{start: offset}
+				hasSignature = false
+			case current != nil && t.Name == DS("Signature"):
+				hasSignature = true
+				current.ordinal = signatures
+			case current != nil && t.Name == DS("Reference"):
+				current.referenceURI = xmlAttr(t, "URI")
+			case current != nil && t.Name == DS("CanonicalizationMethod"):
+				current.canonicalization = xmlAttr(t, "Algorithm")
+			case current != nil && t.Name == DS("SignatureMethod"):
+				current.signatureMethod = xmlAttr(t, "Algorithm")
+			case current != nil && t.Name == DS("DigestMethod"):
+				current.digestMethod = xmlAttr(t, "Algorithm")
+			case current != nil && t.Name == DS("Transform"):
+				current.transforms = append(current.transforms, xmlAttr(t, "Algorithm"))
+			}
+			if t.Name == DS("Signature") {
+				signatures++
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			t.Name = ResolveName(t.Name)
+			if current != nil {
+				value := strings.TrimSpace(text.String())
+				switch t.Name {
+				case DS("DigestValue"):
+					current.digestValue = value
+				case DS("SignatureValue"):
+					current.signatureValue = value
+				case DS("X509Certificate"):
+					current.x509Certificate = value
+				}
+			}
+			switch {
+			case depth == 3 && current != nil && t.Name == Ext("UBLExtension"):
+				current.end = int(decoder.InputOffset())
+				if hasSignature {
+					for current.start > block.open && isXMLSpace(xmlStr[current.start-1]) {
+						current.start--
+					}
+					block.extensions = append(block.extensions, *current)
+				}
+				current = nil
+			case depth == 2 && block != nil && !blockClosed && t.Name == Ext("UBLExtensions"):
+				block.close = offset
+				blockClosed = true
+			}
+			depth--
+			text.Reset()
+		}
+	}
+}
+
+// xmlAttr retorna el valor del atributo con ese nombre local, vacío si no está
+func xmlAttr(start xml.StartElement, local string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// signatureExtensions retorna las extensiones con ds:Signature del ext:UBLExtensions
+func signatureExtensions(xmlStr string) ([]signatureExtension, error) {
+	block, err := findExtensions(xmlStr)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	return block.extensions, nil
+}
+
+func isXMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// removeExtensions quita las extensiones indicadas, que deben estar en orden
+func removeExtensions(xmlStr string, extensions []signatureExtension) string {
+	for i := len(extensions) - 1; i >= 0; i-- {
+		xmlStr = xmlStr[:extensions[i].start] + xmlStr[extensions[i].end:]
+	}
+	return xmlStr
+}
+
+// prepareForSignature deja el XML listo para calcular el digest: con un bloque
+// ext:UBLExtensions (vacío si el documento no lo tenía) y sin la firma vacía del
+// convertidor. Con replace también quita las firmas existentes.
+func prepareForSignature(xmlContent []byte, replace bool) ([]byte, error) {
+	xmlStr := string(xmlContent)
+	block, err := findExtensions(xmlStr)
+	if err != nil {
+		return nil, malformedXMLError(xmlStr, err)
+	}
+	switch {
+	case block == nil:
+		// En los esquemas de todos los tipos (comprobantes, guías, resúmenes y
+		// comunicaciones de baja) ext:UBLExtensions es el primer hijo del elemento raíz
+		root, err := findRootElement(xmlStr)
+		if err != nil {
+			return nil, err
+		}
+		extensions := "\n  " + extensionsOpen + "\n  </ext:UBLExtensions>"
+		if root.empty {
+			// <DespatchAdvice/> se expande para poder agregar las extensiones dentro
+			xmlStr = xmlStr[:root.open-len("/>")] + ">" + extensions + "\n</" + root.name + ">" + xmlStr[root.open:]
+		} else {
+			xmlStr = xmlStr[:root.open] + extensions + xmlStr[root.open:]
+		}
+	case block.selfClosing():
+		// <UBLExtensions/> se expande para poder agregar la firma dentro
+		xmlStr = xmlStr[:block.open-len("/>")] + "></" + tagName(xmlStr[block.tagStart:block.open]) + ">" + xmlStr[block.open:]
+	default:
+		var remove []signatureExtension
+		for _, extension := range block.extensions {
+			if replace || extension.isPlaceholder() {
+				remove = append(remove, extension)
+			}
+		}
+		return []byte(removeExtensions(xmlStr, remove)), nil
+	}
+	return []byte(xmlStr), nil
+}
+
+// rootElement ubica la etiqueta de apertura del elemento raíz: name es su nombre con
+// el prefijo tal como aparece, open el final de la etiqueta y empty indica si es <Raiz/>
+type rootElement struct {
+	name  string
+	open  int
+	empty bool
+}
+
+// findRootElement ubica el elemento raíz con el decoder, saltando la declaración XML,
+// los comentarios y el DOCTYPE
+func findRootElement(xmlStr string) (*rootElement, error) {
+	decoder := offsetDecoder(xmlStr)
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("root element not found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML before the root element: %v", err)
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			open := int(decoder.InputOffset())
+			tag := xmlStr[offset:open]
+			return &rootElement{name: tagName(tag), open: open, empty: strings.HasSuffix(tag, "/>")}, nil
+		}
+	}
+}
+
+// tagName retorna el nombre con prefijo de una etiqueta de apertura
+func tagName(tag string) string {
+	fields := strings.FieldsFunc(strings.TrimPrefix(tag, "<"), func(r rune) bool {
+		return r == '/' || r == '>' || (r < utf8.RuneSelf && isXMLSpace(byte(r)))
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// malformedXMLError agrega al error el elemento raíz detectado, para saber qué tipo de
+// documento llegó malformado
+func malformedXMLError(xmlStr string, err error) error {
+	root, rootErr := findRootElement(xmlStr)
+	if rootErr != nil {
+		return fmt.Errorf("%v (root element not detected)", err)
+	}
+	return fmt.Errorf("%v (root element %s)", err, root.name)
+}
+
+// appendSignatureExtension agrega la extensión al final del ext:UBLExtensions del XML
+// ya preparado, con la indentación del bloque
+func appendSignatureExtension(prepared []byte, extension []byte) ([]byte, error) {
+	xmlStr := string(prepared)
+	block, err := findExtensions(xmlStr)
+	if err != nil {
+		return nil, malformedXMLError(xmlStr, err)
+	}
+	if block == nil || block.selfClosing() {
+		return nil, malformedXMLError(xmlStr, fmt.Errorf("UBL extensions not found"))
+	}
+
+	insertAt := block.close
+	for insertAt > block.open && isXMLSpace(xmlStr[insertAt-1]) {
+		insertAt--
+	}
+	return []byte(xmlStr[:insertAt] + "\n" + string(extension) + xmlStr[insertAt:]), nil
+}
+
+// extensionIndent retorna la indentación de los ext:UBLExtension del bloque
+func extensionIndent(xmlStr string) string {
+	block, err := findExtensions(xmlStr)
+	if err != nil || block == nil {
+		return "  "
+	}
+	lineStart := strings.LastIndex(xmlStr[:block.tagStart], "\n") + 1
+	return strings.Repeat(" ", block.tagStart-lineStart) + "  "
+}
+
+// referencedContent retorna lo que cubre el digest según el URI de la ds:Reference: el
+// documento completo con URI vacío, o el elemento con ese atributo Id con URI="#id"
+func referencedContent(xmlStr, uri string) (string, error) {
+	if uri == "" {
+		return xmlStr, nil
+	}
+	id := strings.TrimPrefix(uri, "#")
+	if id == uri || id == "" {
+		return "", fmt.Errorf("unsupported reference URI %q", uri)
+	}
+
+	decoder := offsetDecoder(xmlStr)
+	start, depth := -1, 0
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", fmt.Errorf("referenced element %q not found", uri)
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid XML: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if start >= 0 {
+				depth++
+				continue
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "Id" && attr.Name.Space == "" && attr.Value == id {
+					start = offset
+				}
+			}
+		case xml.EndElement:
+			if start < 0 {
+				continue
+			}
+			if depth == 0 {
+				return xmlStr[start:decoder.InputOffset()], nil
+			}
+			depth--
+		}
+	}
+}
+
+// RootElementID retorna el atributo Id del elemento raíz, vacío si no tiene
+func RootElementID(xmlContent []byte) string {
+	decoder := offsetDecoder(string(xmlContent))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "Id" && attr.Name.Space == "" {
+					return attr.Value
+				}
+			}
+			return ""
+		}
+	}
+}
+
+// VerifySignatures verifica cada firma del XML por separado: que el digest
+// corresponda al documento (o al elemento referenciado por Id) tal como estaba al firmar y que el SignatureValue
+// corresponda al certificado incluido. Retorna error si el XML no tiene firmas.
+func (s *DigitalSignatureService) VerifySignatures(xmlContent []byte) ([]SignatureVerification, error) {
+	xmlStr := string(xmlContent)
+	extensions, err := signatureExtensions(xmlStr)
+	if err != nil {
+		return nil, err
+	}
+	if len(extensions) == 0 {
+		return nil, fmt.Errorf("no signatures found")
+	}
+
+	results := make([]SignatureVerification, len(extensions))
+	for i, extension := range extensions {
+		results[i] = verifySignatureExtension(i, extension, removeExtensions(xmlStr, extensions[i:]))
+		// Las firmas de otros facturadores son XMLDSig estándar, sobre la forma canónica
+		if results[i].Error == errDigestMismatch {
+			if result, matched := s.verifyXMLDSig(i, extension, xmlContent); matched {
+				results[i] = result
+			}
+		}
+	}
+	return results, nil
+}
+
+const errDigestMismatch = "digest does not match the signed content"
+
+func verifySignatureExtension(index int, extension signatureExtension, signedContent string) SignatureVerification {
+	result := SignatureVerification{Index: index}
+	if extension.isPlaceholder() {
+		result.Error = "signature is empty"
+		return result
+	}
+	cert := signatureCertificate(&result, extension)
+	if cert == nil {
+		return result
+	}
+
+	referenced, err := referencedContent(signedContent, extension.referenceURI)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	hash := sha256.Sum256([]byte(referenced))
+	if base64.StdEncoding.EncodeToString(hash[:]) != extension.digestValue {
+		result.Error = errDigestMismatch
+		return result
+	}
+	checkSignatureValue(&result, cert, extension, crypto.SHA256, hash[:])
+	return result
+}
+
+// Algoritmos de digest y de firma de XMLDSig
+var (
+	xmldsigDigests = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmlenc#sha256": crypto.SHA256,
+		"http://www.w3.org/2000/09/xmldsig#sha1":  crypto.SHA1,
+	}
+	xmldsigSignatures = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256": crypto.SHA256,
+		"http://www.w3.org/2000/09/xmldsig#rsa-sha1":        crypto.SHA1,
+	}
+)
+
+// verifyXMLDSig verifica una firma XMLDSig estándar como las de otros facturadores: el
+// digest cubre la forma canónica de lo referenciado sin la propia ds:Signature y el
+// SignatureValue firma la forma canónica del ds:SignedInfo. matched indica si el
+// digest corresponde; si no, se conserva el resultado de la verificación propia.
+func (s *DigitalSignatureService) verifyXMLDSig(index int, extension signatureExtension, xmlContent []byte) (SignatureVerification, bool) {
+	result := SignatureVerification{Index: index}
+	digestHash, ok := xmldsigDigests[extension.digestMethod]
+	if !ok {
+		return result, false
+	}
+
+	target := c14nTarget{signedInfo: -1, enveloped: -1}
+	algorithm := C14NInclusive
+	for _, transform := range extension.transforms {
+		switch transform {
+		case TransformEnveloped:
+			target.enveloped = extension.ordinal
+		case C14NInclusive, C14NExclusive:
+			algorithm = transform
+		default:
+			return result, false
+		}
+	}
+	if extension.referenceURI != "" {
+		target.id = strings.TrimPrefix(extension.referenceURI, "#")
+		if target.id == extension.referenceURI || target.id == "" {
+			return result, false
+		}
+	}
+	referenced, err := canonicalize(xmlContent, algorithm, target)
+	if err != nil {
+		return result, false
+	}
+	digest := digestHash.New()
+	digest.Write(referenced)
+	if base64.StdEncoding.EncodeToString(digest.Sum(nil)) != extension.digestValue {
+		return result, false
+	}
+
+	cert := signatureCertificate(&result, extension)
+	if cert == nil {
+		return result, true
+	}
+	signatureHash, ok := xmldsigSignatures[extension.signatureMethod]
+	if !ok {
+		result.Error = fmt.Sprintf("unsupported signature method %q", extension.signatureMethod)
+		return result, true
+	}
+	if (digestHash == crypto.SHA1 || signatureHash == crypto.SHA1) && !s.compatibility.AllowSHA1 {
+		result.Error = "SHA-1 signatures are not accepted (see AllowSHA1)"
+		return result, true
+	}
+	signedInfo, err := canonicalize(xmlContent, extension.canonicalization, c14nTarget{signedInfo: extension.ordinal, enveloped: -1})
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to canonicalize SignedInfo: %v", err)
+		return result, true
+	}
+	hash := signatureHash.New()
+	hash.Write(signedInfo)
+	checkSignatureValue(&result, cert, extension, signatureHash, hash.Sum(nil))
+	return result, true
+}
+
+// signatureCertificate lee el certificado de la firma y completa sus datos en result;
+// retorna nil y deja el error en result si no se puede leer
+func signatureCertificate(result *SignatureVerification, extension signatureExtension) *x509.Certificate {
+	certDER, err := base64.StdEncoding.DecodeString(extension.x509Certificate)
+	if err != nil {
+		result.Error = "invalid X509Certificate encoding"
+		return nil
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to parse certificate: %v", err)
+		return nil
+	}
+	result.Subject = cert.Subject.String()
+	result.SerialNumber = cert.SerialNumber.String()
+	return cert
+}
+
+// checkSignatureValue verifica que el SignatureValue firme hashed con la clave del certificado
+func checkSignatureValue(result *SignatureVerification, cert *x509.Certificate, extension signatureExtension, hash crypto.Hash, hashed []byte) {
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		result.Error = fmt.Sprintf("unsupported public key type %T, RSA is required", cert.PublicKey)
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(extension.signatureValue)
+	if err != nil {
+		result.Error = "invalid SignatureValue encoding"
+		return
+	}
+	if err := rsa.VerifyPKCS1v15(publicKey, hash, hashed, signature); err != nil {
+		result.Error = "signature value does not match the certificate"
+		return
+	}
+	result.Valid = true
+}
@@ -10,21 +10,145 @@ import (
 	"encoding/pem"
 	"encoding/xml"
 	"fmt"
-	"strings"
 
 	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultMinRSABits es el tamaño mínimo de clave RSA exigido por SUNAT
+const DefaultMinRSABits = 2048
+
+// KeyValidationError indica que la clave privada no cumple los requisitos para firmar
+type KeyValidationError struct {
+	Code    string
+	Message string
+}
+
+func (e *KeyValidationError) Error() string {
+	return e.Message
+}
+
 type DigitalSignatureService struct {
-	logger *logrus.Logger
+	logger         *logrus.Logger
+	minRSABits     int
+	tsa            TimestampAuthority
+	failOnTSAError bool
+	// replaceSignatures quita las firmas existentes en lugar de agregar una nueva
+	replaceSignatures bool
+	// format es el fin de línea y la declaración del XML firmado (ver SetXMLFormat)
+	format XMLFormat
+	// environment y acceptedCAs definen qué certificados se aceptan (ver SetCertificatePolicy)
+	environment string
+	acceptedCAs []string
+	// deterministic son las credenciales fijas de las firmas de prueba (ver SetDeterministic)
+	deterministic *deterministicCredentials
+	// compatibility son las diferencias toleradas en las firmas de otros facturadores
+	compatibility CompatibilityOptions
+}
+
+// SignatureResult es el resultado de firmar un XML
+type SignatureResult struct {
+	SignedXML []byte
+	// TimestampToken es la respuesta TSR de la TSA, nil si no se solicitó sello
+	TimestampToken []byte
+	// TimestampError indica que la TSA falló y se continuó sin sello
+	TimestampError error
+	// CertificateWarning indica por qué el certificado no se aceptaría en producción
+	CertificateWarning string
 }
 
 func NewDigitalSignatureService(logger *logrus.Logger) *DigitalSignatureService {
-	return &DigitalSignatureService{logger: logger}
+	return &DigitalSignatureService{logger: logger, minRSABits: DefaultMinRSABits}
+}
+
+// SetMinRSABits configura el tamaño mínimo de clave RSA aceptado
+func (s *DigitalSignatureService) SetMinRSABits(bits int) {
+	if bits > 0 {
+		s.minRSABits = bits
+	}
+}
+
+// SetTimestampAuthority configura la TSA para sellar el SignatureValue. Si failOnError
+// es false, un fallo de la TSA no impide la firma y se reporta en SignatureResult.
+func (s *DigitalSignatureService) SetTimestampAuthority(tsa TimestampAuthority, failOnError bool) {
+	s.tsa = tsa
+	s.failOnTSAError = failOnError
+}
+
+// SetReplaceSignatures define si firmar un XML ya firmado reemplaza sus firmas (re-firmar
+// desde cero) o agrega una firma más conservando las existentes, que es lo por defecto
+func (s *DigitalSignatureService) SetReplaceSignatures(replace bool) {
+	s.replaceSignatures = replace
+}
+
+// SetXMLFormat configura el fin de línea y la declaración del XML firmado. El XML se
+// normaliza antes de calcular el digest, por lo que la firma corresponde a esos bytes.
+func (s *DigitalSignatureService) SetXMLFormat(format XMLFormat) {
+	s.format = format
+}
+
+// ValidatePrivateKey verifica que la clave sea RSA y tenga el tamaño mínimo configurado
+func (s *DigitalSignatureService) ValidatePrivateKey(key interface{}) error {
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return &KeyValidationError{
+			Code:    "ERR_KEY_TYPE_UNSUPPORTED",
+			Message: fmt.Sprintf("unsupported private key type %T, RSA is required", key),
+		}
+	}
+	if bits := rsaKey.N.BitLen(); bits < s.minRSABits {
+		return &KeyValidationError{
+			Code:    "ERR_KEY_TOO_SMALL",
+			Message: fmt.Sprintf("RSA key of %d bits is too small, at least %d bits are required", bits, s.minRSABits),
+		}
+	}
+	return nil
+}
+
+// parsePrivateKey decodifica la clave en formato PKCS1, PKCS8 o SEC1 (EC)
+func (s *DigitalSignatureService) parsePrivateKey(der []byte) (interface{}, error) {
+	// Intentar parsear como PKCS1 primero
+	key, err := x509.ParsePKCS1PrivateKey(der)
+	if err == nil {
+		return key, nil
+	}
+	// Si falla, intentar como PKCS8
+	pkcs8Key, err2 := x509.ParsePKCS8PrivateKey(der)
+	if err2 == nil {
+		return pkcs8Key, nil
+	}
+	// Claves EC en formato SEC1, se reportan como tipo no soportado
+	if ecKey, err3 := x509.ParseECPrivateKey(der); err3 == nil {
+		return ecKey, nil
+	}
+	return nil, fmt.Errorf("failed to parse private key (PKCS1: %v, PKCS8: %v)", err, err2)
 }
 
 func (s *DigitalSignatureService) SignXML(xmlContent []byte, certPEM []byte, keyPEM []byte) ([]byte, error) {
+	result, err := s.Sign(xmlContent, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return result.SignedXML, nil
+}
+
+// Sign firma el XML con una referencia vacía (enveloped sobre el documento completo) y,
+// si hay una TSA configurada, sella el SignatureValue
+func (s *DigitalSignatureService) Sign(xmlContent []byte, certPEM []byte, keyPEM []byte) (*SignatureResult, error) {
+	return s.SignReference(xmlContent, certPEM, keyPEM, "")
+}
+
+// SignReference firma el XML con la ds:Reference indicada: "" cubre el documento
+// completo y "#id" solo el elemento con ese atributo Id, que debe existir
+func (s *DigitalSignatureService) SignReference(xmlContent []byte, certPEM []byte, keyPEM []byte, referenceURI string) (*SignatureResult, error) {
+	if s.deterministic != nil {
+		if s.environment == EnvironmentProduction {
+			return nil, errDeterministicInProduction
+		}
+		certPEM, keyPEM = s.deterministic.certPEM, s.deterministic.keyPEM
+	}
+
 	// Decodificar certificado y clave privada
 	block, _ := pem.Decode(certPEM)
 	if block == nil {
@@ -36,30 +160,47 @@ func (s *DigitalSignatureService) SignXML(xmlContent []byte, certPEM []byte, key
 		return nil, fmt.Errorf("failed to parse certificate: %v", err)
 	}
 
+	// En producción SUNAT rechaza los certificados autofirmados o de CAs no acreditadas
+	certWarning, err := s.CheckCertificate(cert, s.environment)
+	if err != nil {
+		return nil, err
+	}
+
 	keyBlock, _ := pem.Decode(keyPEM)
 	if keyBlock == nil {
 		return nil, fmt.Errorf("failed to decode private key PEM")
 	}
 
-	// Intentar parsear como PKCS1 primero
-	privateKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	// La clave se descarta al terminar de firmar; el PEM del llamador no se modifica
+	defer ZeroBytes(keyBlock.Bytes)
+	key, err := s.parsePrivateKey(keyBlock.Bytes)
 	if err != nil {
-		// Si falla, intentar como PKCS8
-		key, err2 := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
-		if err2 != nil {
-			return nil, fmt.Errorf("failed to parse private key (PKCS1: %v, PKCS8: %v)", err, err2)
-		}
+		return nil, err
+	}
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		defer zeroPrivateKey(rsaKey)
+	}
 
-		// Convertir a *rsa.PrivateKey
-		rsaKey, ok := key.(*rsa.PrivateKey)
-		if !ok {
-			return nil, fmt.Errorf("private key is not RSA")
-		}
-		privateKey = rsaKey
+	// Validar tipo y tamaño de la clave antes de firmar
+	if err := s.ValidatePrivateKey(key); err != nil {
+		return nil, err
 	}
+	privateKey := key.(*rsa.PrivateKey)
 
-	// Generar hash SHA-256 del contenido XML
-	hash := sha256.Sum256(xmlContent)
+	// El digest cubre el XML sin la firma vacía del convertidor y con las firmas previas,
+	// normalizado antes y después de agregar el bloque de extensiones
+	prepared, err := prepareForSignature(NormalizeXML(xmlContent, s.format), s.replaceSignatures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare XML for signing: %v", err)
+	}
+	prepared = NormalizeXML(prepared, s.format)
+
+	// Generar hash SHA-256 del contenido referenciado
+	referenced, err := referencedContent(string(prepared), referenceURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve signature reference: %v", err)
+	}
+	hash := sha256.Sum256([]byte(referenced))
 
 	// Firmar el hash
 	signature, err := rsa.SignPKCS1v15(cryptorand.Reader, privateKey, crypto.SHA256, hash[:])
@@ -83,7 +224,7 @@ func (s *DigitalSignatureService) SignXML(xmlContent []byte, certPEM []byte, key
 				Algorithm: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256",
 			},
 			Reference: Reference{
-				URI: "",
+				URI: referenceURI,
 				Transforms: Transforms{
 					Transform: []Transform{
 						{Algorithm: "http://www.w3.org/2000/09/xmldsig#enveloped-signature"},
@@ -107,41 +248,55 @@ func (s *DigitalSignatureService) SignXML(xmlContent []byte, certPEM []byte, key
 	}
 
 	// Insertar la firma en el XML
-	signedXML, err := s.insertSignatureInXML(xmlContent, xmlSignature)
+	signedXML, err := s.insertSignatureInXML(prepared, xmlSignature)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert signature: %v", err)
 	}
+	// La firma insertada queda con el mismo fin de línea que el resto del documento
+	signedXML = NormalizeXML(signedXML, s.format)
+
+	result := &SignatureResult{SignedXML: signedXML, CertificateWarning: certWarning}
+	// El sello de tiempo cambia en cada firma: las firmas de prueba no lo solicitan
+	if s.tsa != nil && s.deterministic == nil {
+		token, err := s.tsa.Timestamp(signatureValueDigest(signature))
+		if err != nil {
+			if s.failOnTSAError {
+				return nil, &TimestampError{Err: err}
+			}
+			result.TimestampError = err
+		}
+		result.TimestampToken = token
+	}
+
+	return result, nil
+}
 
-	return signedXML, nil
+// TimestampError indica que no se pudo obtener el sello de tiempo de la TSA
+type TimestampError struct {
+	Err error
 }
 
+func (e *TimestampError) Error() string {
+	return fmt.Sprintf("timestamp authority failed: %v", e.Err)
+}
+
+// insertSignatureInXML agrega la firma en un ext:UBLExtension nuevo al final del
+// ext:UBLExtensions, sin tocar las extensiones existentes
 func (s *DigitalSignatureService) insertSignatureInXML(xmlContent []byte, xmlSignature *XMLSignature) ([]byte, error) {
-	// Convertir XML a string para manipulación
-	xmlStr := string(xmlContent)
-
-	// Crear UBLExtensions con la firma XMLDSig
-	ublExtensions := &UBLExtensions{
-		UBLExtension: UBLExtension{
-			ExtensionContent: ExtensionContent{
-				Signature: *xmlSignature,
-			},
+	extension := &UBLExtension{
+		ExtensionContent: ExtensionContent{
+			Signature: *xmlSignature,
 		},
 	}
 
-	// Insertar UBLExtensions después de la declaración XML
-	extensionsXML, err := xml.MarshalIndent(ublExtensions, "", "  ")
+	indent := extensionIndent(string(xmlContent))
+	extensionXML, err := xml.MarshalIndent(struct {
+		XMLName xml.Name `xml:"ext:UBLExtension"`
+		*UBLExtension
+	}{UBLExtension: extension}, indent, "  ")
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal UBL extensions: %v", err)
+		return nil, fmt.Errorf("failed to marshal UBL extension: %v", err)
 	}
 
-	// Buscar la posición después de la declaración XML
-	xmlDeclEnd := strings.Index(xmlStr, "?>")
-	if xmlDeclEnd == -1 {
-		return nil, fmt.Errorf("XML declaration not found")
-	}
-
-	// Insertar UBLExtensions después de la declaración XML
-	xmlStr = xmlStr[:xmlDeclEnd+2] + "\n" + string(extensionsXML) + xmlStr[xmlDeclEnd+2:]
-
-	return []byte(xmlStr), nil
-} 
\ No newline at end of file
+	return appendSignatureExtension(xmlContent, extensionXML)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// errDeterministicInProduction es el error de firmar en producción con las credenciales
+// fijas de prueba
+var errDeterministicInProduction = errors.New("deterministic test signing is not available in production")
+
+// deterministicCredentials son el certificado y la clave fijos de las firmas de prueba
+type deterministicCredentials struct {
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// SetDeterministic activa las firmas de prueba reproducibles para los golden tests del
+// XML firmado: se firma siempre con certPEM y keyPEM (los fijos de testdata) en lugar
+// de los del request y sin sello de tiempo, de modo que el mismo documento produce el
+// mismo XML byte a byte. RSA-PKCS1v15 ya es determinista; solo variaban las credenciales.
+// No se expone en la configuración y no está disponible en producción. Con certPEM nil
+// se desactiva.
+func (s *DigitalSignatureService) SetDeterministic(certPEM, keyPEM []byte) error {
+	if certPEM == nil {
+		s.deterministic = nil
+		return nil
+	}
+	if s.environment == EnvironmentProduction {
+		return errDeterministicInProduction
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return fmt.Errorf("failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return fmt.Errorf("failed to decode private key PEM")
+	}
+	key, err := s.parsePrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("deterministic signing requires an RSA key")
+	}
+	if publicKey, ok := cert.PublicKey.(*rsa.PublicKey); !ok || publicKey.N.Cmp(rsaKey.N) != 0 {
+		return fmt.Errorf("private key does not match the certificate")
+	}
+
+	s.deterministic = &deterministicCredentials{
+		certPEM: append([]byte(nil), certPEM...),
+		keyPEM:  append([]byte(nil), keyPEM...),
+	}
+	return nil
+}
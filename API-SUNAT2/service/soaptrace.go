@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// SOAPTraceSuffix es la extensión de las trazas SOAP de un documento en el store
+const SOAPTraceSuffix = ".soap"
+
+// Valores por defecto de las trazas SOAP: tamaño máximo de cada traza (petición más
+// respuesta) y cuánto se conservan
+const (
+	DefaultSOAPTraceMaxBytes  = 256 * 1024
+	DefaultSOAPTraceRetention = 7 * 24 * time.Hour
+)
+
+// maxSOAPTracesPerFile limita las trazas que se acumulan por documento y ambiente
+const maxSOAPTracesPerFile = 20
+
+// SOAPTraceName retorna el nombre de las trazas SOAP del documento en un ambiente
+func SOAPTraceName(documentID, environment string) string {
+	return documentID + "." + environment + SOAPTraceSuffix
+}
+
+// SOAPTraceOptions configura el guardado de las trazas SOAP; los valores en cero usan
+// los por defecto
+type SOAPTraceOptions struct {
+	Enabled   bool
+	MaxBytes  int
+	Retention time.Duration
+}
+
+// SetSOAPTrace habilita o deshabilita el guardado de la petición y la respuesta SOAP
+// crudas de cada envío
+func (s *UBLConverterService) SetSOAPTrace(opts SOAPTraceOptions) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultSOAPTraceMaxBytes
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultSOAPTraceRetention
+	}
+	s.soapTrace = opts
+}
+
+// soapCredentialPatterns reconocen el contenido de los elementos Username y Password
+// del UsernameToken, con cualquier prefijo de namespace
+var soapCredentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(<(?:[\w.-]+:)?Username(?:\s[^>]*)?>)[^<]*(</(?:[\w.-]+:)?Username>)`),
+	regexp.MustCompile(`(<(?:[\w.-]+:)?Password(?:\s[^>]*)?>)[^<]*(</(?:[\w.-]+:)?Password>)`),
+}
+
+// RedactSOAPCredentials reemplaza el usuario y la clave SOL del envelope
+func RedactSOAPCredentials(envelope []byte) string {
+	redacted := string(envelope)
+	for _, pattern := range soapCredentialPatterns {
+		redacted = pattern.ReplaceAllString(redacted, "${1}[REDACTED]${2}")
+	}
+	return redacted
+}
+
+type soapTraceKey struct{}
+
+// soapTraceRecorder acumula las llamadas SOAP hechas con un contexto
+type soapTraceRecorder struct {
+	mu       sync.Mutex
+	maxBytes int
+	clock    Clock
+	traces   []SOAPTrace
+}
+
+// withSOAPTraceRecorder retorna un contexto cuyas llamadas SOAP quedan en el recorder
+func withSOAPTraceRecorder(ctx context.Context, maxBytes int, clock Clock) (context.Context, *soapTraceRecorder) {
+	recorder := &soapTraceRecorder{maxBytes: maxBytes, clock: clock}
+	return context.WithValue(ctx, soapTraceKey{}, recorder), recorder
+}
+
+// recordSOAPTrace registra la llamada en el recorder del contexto, si lo hay. La
+// petición se guarda con las credenciales redactadas y la traza se recorta al límite.
+func recordSOAPTrace(ctx context.Context, action, url string, request, response []byte, status int, callErr error) {
+	recorder, _ := ctx.Value(soapTraceKey{}).(*soapTraceRecorder)
+	if recorder == nil {
+		return
+	}
+	trace := SOAPTrace{Operation: action, URL: url, RecordedAt: recorder.clock.Now(), HTTPStatus: status}
+	if callErr != nil {
+		trace.Error = callErr.Error()
+	}
+	trace.Request, trace.Response, trace.RequestTruncated, trace.ResponseTruncated =
+		limitSOAPTrace(RedactSOAPCredentials(request), string(response), recorder.maxBytes)
+
+	recorder.mu.Lock()
+	recorder.traces = append(recorder.traces, trace)
+	recorder.mu.Unlock()
+}
+
+// limitSOAPTrace recorta la petición y la respuesta para que juntas no superen limit.
+// Cada una tiene al menos la mitad; lo que una no usa queda para la otra.
+func limitSOAPTrace(request, response string, limit int) (string, string, bool, bool) {
+	if len(request)+len(response) <= limit {
+		return request, response, false, false
+	}
+	requestLimit, responseLimit := limit/2, limit-limit/2
+	if len(request) < requestLimit {
+		responseLimit = limit - len(request)
+	} else if len(response) < responseLimit {
+		requestLimit = limit - len(response)
+	}
+	request, requestTruncated := truncateTrace(request, requestLimit)
+	response, responseTruncated := truncateTrace(response, responseLimit)
+	return request, response, requestTruncated, responseTruncated
+}
+
+func truncateTrace(value string, limit int) (string, bool) {
+	if len(value) <= limit {
+		return value, false
+	}
+	return strings.ToValidUTF8(value[:limit], ""), true
+}
+
+// saveSOAPTraces agrega las trazas del envío a las del documento en el ambiente,
+// descartando las que ya superaron la retención
+func (s *UBLConverterService) saveSOAPTraces(documentID, environment string, recorder *soapTraceRecorder) {
+	if recorder == nil || len(recorder.traces) == 0 {
+		return
+	}
+	name := SOAPTraceName(documentID, environment)
+	traces := s.readSOAPTraces(name)
+	for _, trace := range recorder.traces {
+		trace.DocumentID, trace.Environment = documentID, environment
+		traces = append(traces, trace)
+	}
+	traces = s.unexpiredSOAPTraces(traces, s.clock.Now())
+	if len(traces) > maxSOAPTracesPerFile {
+		traces = traces[len(traces)-maxSOAPTracesPerFile:]
+	}
+	data, err := json.Marshal(traces)
+	if err == nil {
+		_, err = s.store.Save(name, data)
+	}
+	if err != nil {
+		s.GetLogger().Warnf("No se pudo guardar la traza SOAP de %s: %v", documentID, err)
+	}
+}
+
+func (s *UBLConverterService) readSOAPTraces(name string) []SOAPTrace {
+	var traces []SOAPTrace
+	if data, err := s.store.Read(name); err == nil {
+		json.Unmarshal(data, &traces)
+	}
+	return traces
+}
+
+func (s *UBLConverterService) unexpiredSOAPTraces(traces []SOAPTrace, now time.Time) []SOAPTrace {
+	kept := traces[:0]
+	for _, trace := range traces {
+		if now.Sub(trace.RecordedAt) < s.soapTrace.Retention {
+			kept = append(kept, trace)
+		}
+	}
+	return kept
+}
+
+// SOAPTraces retorna las trazas SOAP del documento en todos los ambientes, de la más
+// antigua a la más reciente
+func (s *UBLConverterService) SOAPTraces(documentID string) ([]SOAPTrace, error) {
+	documentID = CanonicalDocumentID(documentID)
+	names, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	traces := []SOAPTrace{}
+	for _, name := range names {
+		if strings.HasPrefix(name, documentID+".") && strings.HasSuffix(name, SOAPTraceSuffix) {
+			traces = append(traces, s.readSOAPTraces(name)...)
+		}
+	}
+	sort.SliceStable(traces, func(i, j int) bool { return traces[i].RecordedAt.Before(traces[j].RecordedAt) })
+	return traces, nil
+}
+
+// PurgeSOAPTraces elimina las trazas SOAP que superaron la retención y retorna cuántas
+// se eliminaron
+func (s *UBLConverterService) PurgeSOAPTraces() (int, error) {
+	names, err := s.store.List()
+	if err != nil {
+		return 0, err
+	}
+	now, purged := s.clock.Now(), 0
+	for _, name := range names {
+		if !strings.HasSuffix(name, SOAPTraceSuffix) {
+			continue
+		}
+		traces := s.readSOAPTraces(name)
+		kept := s.unexpiredSOAPTraces(append([]SOAPTrace(nil), traces...), now)
+		if len(kept) == len(traces) {
+			continue
+		}
+		purged += len(traces) - len(kept)
+		if len(kept) == 0 {
+			err = s.store.Delete(name)
+		} else {
+			var data []byte
+			if data, err = json.Marshal(kept); err == nil {
+				_, err = s.store.Save(name, data)
+			}
+		}
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// StartSOAPTracePurge elimina cada interval las trazas SOAP vencidas en segundo plano,
+// hasta que se llame a la función retornada
+func (s *UBLConverterService) StartSOAPTracePurge(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			if purged, err := s.PurgeSOAPTraces(); err != nil {
+				s.GetLogger().Errorf("Purga de trazas SOAP falló: %v", err)
+			} else if purged > 0 {
+				s.GetLogger().Infof("Trazas SOAP vencidas eliminadas: %d", purged)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
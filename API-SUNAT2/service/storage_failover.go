@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	. "API-SUNAT2/model"
+	"API-SUNAT2/storage"
+)
+
+// storageLocation retorna dónde quedó guardado un artefacto; los stores sin contingencia
+// siempre guardan en el principal
+func (s *UBLConverterService) storageLocation(name string) string {
+	if failover, ok := s.store.(*storage.FailoverStore); ok {
+		return failover.Location(name)
+	}
+	return storage.LocationPrimary
+}
+
+// StorageStatus retorna el modo del almacenamiento para el health del servicio
+func (s *UBLConverterService) StorageStatus() storage.FailoverStatus {
+	if failover, ok := s.store.(*storage.FailoverStore); ok {
+		return failover.Status()
+	}
+	return storage.FailoverStatus{Mode: storage.LocationPrimary}
+}
+
+// ResyncStorage mueve al principal los artefactos guardados en el directorio de
+// contingencia y quita la marca storageLocation de los registros movidos. Retorna
+// cuántos artefactos se movieron.
+func (s *UBLConverterService) ResyncStorage() (int, error) {
+	failover, ok := s.store.(*storage.FailoverStore)
+	if !ok {
+		return 0, nil
+	}
+	moved, err := failover.Resync()
+	for _, name := range moved {
+		if !strings.HasSuffix(name, RecordSuffix) {
+			continue
+		}
+		data, readErr := s.store.Read(name)
+		var record DocumentRecord
+		if readErr != nil || json.Unmarshal(data, &record) != nil || record.StorageLocation == "" {
+			continue
+		}
+		record.StorageLocation = ""
+		if data, marshalErr := json.Marshal(record); marshalErr == nil {
+			s.store.Save(name, data)
+		}
+	}
+	return len(moved), err
+}
+
+// StartStorageResync re-sincroniza el almacenamiento cada interval en segundo plano,
+// hasta que se llame a la función retornada
+func (s *UBLConverterService) StartStorageResync(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			if s.StorageStatus().Pending == 0 {
+				continue
+			}
+			moved, err := s.ResyncStorage()
+			if moved > 0 {
+				s.GetLogger().Infof("Re-sincronización del almacenamiento: %d artefactos movidos al directorio principal", moved)
+			}
+			if err != nil {
+				s.GetLogger().Warnf("El directorio principal sigue sin responder: %v", err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	. "API-SUNAT2/model"
+)
+
+// Las sugerencias acompañan a los errores de validación más frecuentes. Cada función
+// retorna "" cuando no puede proponer una corrección concreta.
+
+var nonDigits = regexp.MustCompile(`\D`)
+
+// rucSuggestion propone el RUC corregido: sin separadores, o con el dígito verificador
+// que corresponde a los 10 primeros dígitos
+func rucSuggestion(ruc string) string {
+	digits := nonDigits.ReplaceAllString(ruc, "")
+	switch {
+	case len(digits) == 10:
+		return fmt.Sprintf("The RUC is missing its check digit: the check digit for %s is %d (%s%d)",
+			digits, rucCheckDigit(digits), digits, rucCheckDigit(digits))
+	case len(digits) != 11:
+		return ""
+	}
+
+	expected := rucCheckDigit(digits[:10])
+	corrected := fmt.Sprintf("%s%d", digits[:10], expected)
+	if digits != ruc {
+		if corrected == digits {
+			return fmt.Sprintf("Remove the separators: %s", digits)
+		}
+		return fmt.Sprintf("Remove the separators; the expected check digit for %sX is %d (%s)", digits[:10], expected, corrected)
+	}
+	return fmt.Sprintf("The expected check digit for %sX is %d (%s)", digits[:10], expected, corrected)
+}
+
+// currencySuggestion propone el código ISO 4217 en mayúsculas y sin espacios
+func (v *ValidationService) currencySuggestion(currency string) string {
+	normalized := strings.ToUpper(strings.TrimSpace(currency))
+	if normalized == currency || !v.isValidCurrency(normalized) {
+		return ""
+	}
+	return fmt.Sprintf("Use the uppercase ISO 4217 code %s", normalized)
+}
+
+// suggestedDateLayouts son los formatos de fecha que se reciben por error; día/mes va
+// antes que mes/día porque es el formato local
+var suggestedDateLayouts = []string{
+	"02/01/2006",
+	"02-01-2006",
+	"2006/01/02",
+	"20060102",
+	"2006-1-2",
+	"2/1/2006",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// dateSuggestion propone la fecha en formato AAAA-MM-DD si se reconoce el formato recibido
+func dateSuggestion(date string) string {
+	date = strings.TrimSpace(date)
+	for _, layout := range suggestedDateLayouts {
+		if parsed, err := time.Parse(layout, date); err == nil {
+			return fmt.Sprintf("Use the YYYY-MM-DD format: %s", parsed.Format("2006-01-02"))
+		}
+	}
+	return ""
+}
+
+// totalSuggestion muestra la diferencia del total contra subTotal + tributos. Si el
+// total recibido cuadra con el IGV a la tasa vigente, el error está en el monto del
+// IGV y se indica el que corresponde.
+func (v *ValidationService) totalSuggestion(doc *BusinessDocument, calculated float64) string {
+	received := Decimal2(doc.Totals.TotalAmount).Round()
+	expected := Decimal2(calculated).Round()
+	difference := Decimal2(received - expected).Round()
+
+	for i, tax := range doc.Taxes {
+		if tax.TaxType != "1000" {
+			continue
+		}
+		rate := v.IGVRateAt(doc.IssueDate)
+		igv := Decimal2(float64(doc.Totals.SubTotal) * rate / 100).Round()
+		if igv != Decimal2(tax.TaxAmount).Round() && Decimal2(igv-float64(tax.TaxAmount)).Round() == difference {
+			return fmt.Sprintf("The IGV at %s%% of subTotal %s is %s: set taxes[%d].taxAmount to %s and the total of %s adds up",
+				Decimal2(rate), Decimal2(doc.Totals.SubTotal), Decimal2(igv), i, Decimal2(igv), Decimal2(received))
+		}
+	}
+
+	direction := "more"
+	if difference < 0 {
+		direction, difference = "less", -difference
+	}
+	return fmt.Sprintf("totalAmount is %s %s than subTotal + taxes (%s): set totals.totalAmount to %s",
+		Decimal2(difference), direction, Decimal2(expected), Decimal2(expected))
+}
+
+// seriesExpectation describe la serie esperada para el tipo de documento
+func seriesExpectation(docType string) string {
+	switch docType {
+	case "01":
+		return "4 alphanumeric characters starting with F (e.g. F001)"
+	case "03":
+		return "4 alphanumeric characters starting with B (e.g. B001)"
+	}
+	return "4 alphanumeric characters starting with F or B (e.g. FC01)"
+}
+
+// seriesSuggestion propone la serie corregida: en mayúsculas, con la letra del tipo
+// de documento o con 4 caracteres
+func seriesSuggestion(docType, series string) string {
+	normalized := strings.ToUpper(strings.TrimSpace(series))
+	prefix := map[string]string{"01": "F", "03": "B"}[docType]
+
+	switch {
+	case len(normalized) != 4:
+		if len(normalized) > 4 && (prefix == "" || strings.HasPrefix(normalized, prefix)) {
+			if candidate := normalized[:1] + normalized[len(normalized)-3:]; isSeriesFormat(candidate) {
+				return fmt.Sprintf("The series must have 4 characters, e.g. %s", candidate)
+			}
+		}
+		return ""
+	case prefix != "" && normalized[0] != prefix[0] && strings.ContainsRune("FB", rune(normalized[0])):
+		candidate := prefix + normalized[1:]
+		if !isSeriesFormat(candidate) {
+			return ""
+		}
+		name := map[string]string{"F": "Invoices", "B": "Boletas"}[prefix]
+		return fmt.Sprintf("%s use series starting with %s: %s", name, prefix, candidate)
+	case normalized != series && isSeriesFormat(normalized) && (prefix == "" || normalized[0] == prefix[0]):
+		return fmt.Sprintf("Use the series in uppercase: %s", normalized)
+	}
+	return ""
+}
+
+// isSeriesFormat verifica el formato de una serie electrónica: F o B y 3 alfanuméricos
+func isSeriesFormat(series string) bool {
+	matched, _ := regexp.MatchString(`^[FB][A-Z0-9]{3}$`, series)
+	return matched
+}
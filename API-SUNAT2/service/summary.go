@@ -0,0 +1,545 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+)
+
+// SummaryDocumentType identifica a los resúmenes diarios en su nombre (RUC-RC-AAAAMMDD-N)
+const SummaryDocumentType = "RC"
+
+// Estados de un comprobante en el resumen diario (catálogo 19)
+const (
+	SummaryStatusAdd  = "1"
+	SummaryStatusVoid = "3"
+)
+
+// Estados de un resumen diario antes de recibir el CDR
+const (
+	SummaryGenerated = "GENERADO"
+	SummaryInProcess = "EN_PROCESO"
+)
+
+// SummarySuffix es la extensión del registro de un resumen diario en el store
+const SummarySuffix = ".resumen"
+
+// VoidedSuffix marca un comprobante anulado localmente: el resumen lo informa con estado 3
+const VoidedSuffix = ".anulada"
+
+// summaryIDPattern reconoce los resúmenes que se envían con sendSummary: el resumen
+// diario (RC) y el resumen de reversiones (RR)
+var summaryIDPattern = regexp.MustCompile(`^(\d{11})-(RC|RR)-(\d{8})-(\d{1,5})$`)
+
+var rucPattern = regexp.MustCompile(`^\d{11}$`)
+
+// isSummarizedDocument indica si el comprobante se informa por resumen diario: las
+// boletas y las notas de crédito o débito que las modifican (serie B)
+func isSummarizedDocument(record *DocumentRecord) bool {
+	switch record.DocumentType {
+	case "03":
+		return true
+	case "07", "08":
+		return strings.HasPrefix(strings.ToUpper(record.Series), "B")
+	}
+	return false
+}
+
+// summarySource son los datos del XML firmado de un comprobante que el resumen informa
+type summarySource struct {
+	SupplierName string          `xml:"AccountingSupplierParty>Party>PartyLegalEntity>RegistrationName"`
+	Customer     UBLIDWithScheme `xml:"AccountingCustomerParty>Party>PartyIdentification>ID"`
+	References   []struct {
+		ID               string `xml:"InvoiceDocumentReference>ID"`
+		DocumentTypeCode string `xml:"InvoiceDocumentReference>DocumentTypeCode"`
+	} `xml:"BillingReference"`
+	TaxTotals []struct {
+		Subtotals []struct {
+			TaxableAmount float64 `xml:"TaxableAmount"`
+			TaxAmount     float64 `xml:"TaxAmount"`
+			TaxSchemeID   string  `xml:"TaxCategory>TaxScheme>ID"`
+		} `xml:"TaxSubtotal"`
+	} `xml:"TaxTotal"`
+}
+
+// readSummarySource decodifica el elemento raíz del comprobante; la firma puede ir
+// antes del elemento raíz, por eso se busca por nombre
+func readSummarySource(xmlData []byte) (*summarySource, error) {
+	decoder := NewXMLDecoder(bytes.NewReader(xmlData))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("document root element not found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || !IsUBLDocumentRoot(start.Name) {
+			continue
+		}
+		var source summarySource
+		if err := decoder.DecodeElement(&source, &start); err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		return &source, nil
+	}
+}
+
+func summaryAmount(currency string, value float64) UBLSummaryAmount {
+	return UBLSummaryAmount{CurrencyID: currency, Value: Decimal2(value).String()}
+}
+
+// summaryTaxTotal arma el TaxTotal de una línea del resumen para un tributo del catálogo 05
+func summaryTaxTotal(currency, id, name, typeCode string, amount float64) UBLSummaryTaxTotal {
+	return UBLSummaryTaxTotal{
+		TaxAmount: summaryAmount(currency, amount),
+		TaxSubtotal: UBLSummaryTaxSubtotal{
+			TaxAmount: summaryAmount(currency, amount),
+			TaxScheme: UBLTaxScheme{ID: UBLIDWithScheme{Value: id}, Name: name, TaxTypeCode: typeCode},
+		},
+	}
+}
+
+// summaryPaymentCodes mapea el tributo del subtotal al código del importe por afectación
+var summaryPaymentCodes = map[string]string{
+	"1000": "01", // Gravado
+	"9997": "02", // Exonerado
+	"9998": "03", // Inafecto
+	"9996": "05", // Gratuito
+}
+
+// buildSummaryLine arma la línea del resumen de un comprobante a partir de su registro y su XML
+func buildSummaryLine(lineID int, record *DocumentRecord, source *summarySource, status string) UBLSummaryLine {
+	line := UBLSummaryLine{
+		LineID:           strconv.Itoa(lineID),
+		DocumentTypeCode: record.DocumentType,
+		ID:               record.Series + "-" + record.Number,
+		ConditionCode:    status,
+		TotalAmount:      summaryAmount(record.Currency, record.PayableAmount),
+	}
+	if source.Customer.Value != "" {
+		line.AccountingCustomerParty = &UBLSummaryCustomer{
+			CustomerAssignedAccountID: source.Customer.Value,
+			AdditionalAccountID:       source.Customer.SchemeID,
+		}
+	}
+	if record.DocumentType != "03" && len(source.References) > 0 {
+		line.BillingReference = &UBLBillingReference{
+			InvoiceDocumentReference: UBLDocumentReference{
+				ID:               source.References[0].ID,
+				DocumentTypeCode: catalogAttr(source.References[0].DocumentTypeCode, catalog.DocumentType),
+			},
+		}
+	}
+
+	var igv, isc, others float64
+	payments := map[string]float64{}
+	for _, total := range source.TaxTotals {
+		for _, subtotal := range total.Subtotals {
+			if code, ok := summaryPaymentCodes[subtotal.TaxSchemeID]; ok {
+				payments[code] += subtotal.TaxableAmount
+			}
+			switch subtotal.TaxSchemeID {
+			case "1000":
+				igv += subtotal.TaxAmount
+			case "2000":
+				isc += subtotal.TaxAmount
+			case "9999":
+				others += subtotal.TaxAmount
+			}
+		}
+	}
+	codes := make([]string, 0, len(payments))
+	for code := range payments {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		line.BillingPayments = append(line.BillingPayments, UBLSummaryPayment{
+			PaidAmount:    summaryAmount(record.Currency, payments[code]),
+			InstructionID: code,
+		})
+	}
+
+	// El IGV se informa siempre, aunque sea cero; ISC y otros tributos solo si existen
+	line.TaxTotals = append(line.TaxTotals, summaryTaxTotal(record.Currency, "1000", "IGV", "VAT", igv))
+	if isc > 0 {
+		line.TaxTotals = append(line.TaxTotals, summaryTaxTotal(record.Currency, "2000", "ISC", "EXC", isc))
+	}
+	if others > 0 {
+		line.TaxTotals = append(line.TaxTotals, summaryTaxTotal(record.Currency, "9999", "OTROS", "OTH", others))
+	}
+	return line
+}
+
+// readJSONRecords lee los registros JSON del store con la extensión indicada
+func (s *UBLConverterService) readJSONRecords(suffix string, each func(name string, data []byte) error) error {
+	names, err := s.store.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		data, err := s.store.Read(name)
+		if err != nil {
+			return err
+		}
+		if err := each(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveSummaryRecord guarda el registro del resumen junto a su XML y ZIP
+func (s *UBLConverterService) saveSummaryRecord(record *SummaryRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.Save(record.SummaryID+SummarySuffix, data)
+	return err
+}
+
+// readSummaryRecord retorna el registro de un resumen generado por el servicio
+func (s *UBLConverterService) readSummaryRecord(summaryID string) (*SummaryRecord, error) {
+	data, err := s.store.Read(summaryID + SummarySuffix)
+	if err != nil {
+		return nil, err
+	}
+	var record SummaryRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid summary record %s: %v", summaryID, err)
+	}
+	return &record, nil
+}
+
+// GenerateSummary arma el resumen diario (RC) de las boletas y notas asociadas que el
+// emisor guardó en el store con fecha de emisión date. Cada comprobante se informa con
+// estado 1 (adicionar), o 3 (anular) si fue anulado localmente; los que ya figuran con
+// ese estado en un resumen aceptado por SUNAT no se vuelven a informar. El resumen se
+// firma y queda en el store listo para enviarse con SendDocument.
+func (s *UBLConverterService) GenerateSummary(ctx context.Context, ruc, date string, certPEM, keyPEM []byte) (*APIResponse, error) {
+	startTime := s.clock.Now()
+	correlationID := GenerateCorrelationID()
+	if s.validateOnly {
+		certPEM, keyPEM = validateOnlyCertificate, validateOnlyKey
+	}
+
+	summaryError := func(code, message string) *APIResponse {
+		s.logService.LogError(correlationID, "GENERATE_SUMMARY_ERROR", SummaryDocumentType, "", code, message)
+		return &APIResponse{
+			Status:        "ERROR",
+			CorrelationID: correlationID,
+			ProcessedAt:   s.clock.Now(),
+			ErrorCode:     code,
+			ErrorMessage:  message,
+		}
+	}
+
+	if !rucPattern.MatchString(ruc) {
+		return summaryError("ERR_INVALID_RUC", "El ruc debe tener 11 dígitos"), nil
+	}
+	referenceDate, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return summaryError("ERR_INVALID_DATE", "La fecha debe tener el formato AAAA-MM-DD"), nil
+	}
+	issueDate := s.clock.Now().Format("2006-01-02")
+	if referenceDate.Format("2006-01-02") > issueDate {
+		return summaryError("ERR_INVALID_DATE", fmt.Sprintf("La fecha %s es posterior a la fecha de generación %s", date, issueDate)), nil
+	}
+
+	// Serializar la generación para que dos resúmenes no tomen el mismo correlativo
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+
+	// Comprobantes ya informados por estado en resúmenes aceptados, y último correlativo del día
+	reported := map[string]map[string]bool{}
+	lastNumber := 0
+	prefix := fmt.Sprintf("%s-%s-%s-", ruc, SummaryDocumentType, strings.ReplaceAll(issueDate, "-", ""))
+	err = s.readJSONRecords(SummarySuffix, func(name string, data []byte) error {
+		summaryID := strings.TrimSuffix(name, SummarySuffix)
+		if strings.HasPrefix(summaryID, prefix) {
+			if number, err := strconv.Atoi(strings.TrimPrefix(summaryID, prefix)); err == nil && number > lastNumber {
+				lastNumber = number
+			}
+		}
+		var summary SummaryRecord
+		if err := json.Unmarshal(data, &summary); err != nil {
+			return fmt.Errorf("invalid summary record %s: %v", name, err)
+		}
+		if summary.IssuerRUC != ruc || (summary.Status != CDRAccepted && summary.Status != CDRObserved) {
+			return nil
+		}
+		for _, line := range summary.Lines {
+			if reported[line.DocumentID] == nil {
+				reported[line.DocumentID] = map[string]bool{}
+			}
+			reported[line.DocumentID][line.Status] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return summaryError("ERR_STORE_READ", err.Error()), nil
+	}
+
+	number := lastNumber + 1
+	summaryID := fmt.Sprintf("%s%d", prefix, number)
+	summaryNumber := strings.TrimPrefix(summaryID, ruc+"-")
+	summary := &UBLSummaryDocuments{
+		Xmlns:           "urn:sunat:names:specification:ubl:peru:schema:xsd:SummaryDocuments-1",
+		XmlnsCac:        "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
+		XmlnsCbc:        "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
+		XmlnsDs:         "http://www.w3.org/2000/09/xmldsig#",
+		XmlnsExt:        "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2",
+		XmlnsSac:        "urn:sunat:names:specification:ubl:peru:schema:xsd:SunatAggregateComponents-1",
+		UBLVersionID:    "2.0",
+		CustomizationID: "1.1",
+		ID:              summaryNumber,
+		ReferenceDate:   date,
+		IssueDate:       issueDate,
+		AccountingSupplierParty: UBLSummarySupplier{
+			CustomerAssignedAccountID: ruc,
+			AdditionalAccountID:       "6",
+		},
+	}
+	record := &SummaryRecord{
+		SummaryID:     summaryID,
+		IssuerRUC:     ruc,
+		ReferenceDate: date,
+		IssueDate:     issueDate,
+		Status:        SummaryGenerated,
+	}
+
+	skipped := 0
+	err = s.readJSONRecords(RecordSuffix, func(name string, data []byte) error {
+		var document DocumentRecord
+		if err := json.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("invalid document record %s: %v", name, err)
+		}
+		if document.IssuerRUC != ruc || document.IssueDate != date || !isSummarizedDocument(&document) {
+			return nil
+		}
+		// Los documentos de prueba nunca se informan a SUNAT
+		if s.isTestRecord(&document) {
+			return nil
+		}
+
+		status := SummaryStatusAdd
+		if _, err := s.store.Read(document.DocumentID + VoidedSuffix); err == nil {
+			status = SummaryStatusVoid
+		}
+		if reported[document.DocumentID][status] {
+			skipped++
+			return nil
+		}
+
+		xmlData, err := s.store.Read(document.XMLFile)
+		if err != nil {
+			return fmt.Errorf("document %s: %v", document.DocumentID, err)
+		}
+		source, err := readSummarySource(xmlData)
+		if err != nil {
+			return fmt.Errorf("document %s: %v", document.DocumentID, err)
+		}
+		if summary.AccountingSupplierParty.RegistrationName == "" {
+			summary.AccountingSupplierParty.RegistrationName = source.SupplierName
+		}
+		summary.Lines = append(summary.Lines, buildSummaryLine(len(summary.Lines)+1, &document, source, status))
+		record.Lines = append(record.Lines, SummaryRecordLine{
+			DocumentID:    document.DocumentID,
+			DocumentType:  document.DocumentType,
+			Number:        document.Series + "-" + document.Number,
+			Status:        status,
+			Currency:      document.Currency,
+			PayableAmount: document.PayableAmount,
+		})
+		return nil
+	})
+	if err != nil {
+		return summaryError("ERR_STORE_READ", err.Error()), nil
+	}
+	if len(summary.Lines) == 0 {
+		return summaryError("ERR_SUMMARY_EMPTY", fmt.Sprintf("No hay boletas pendientes de informar del emisor %s con fecha %s", ruc, date)), nil
+	}
+
+	summary.Signature = &UBLSignature{
+		ID: summaryNumber,
+		SignatoryParty: UBLSignatoryParty{
+			PartyIdentification: UBLPartyIdentification{ID: UBLIDWithScheme{Value: ruc}},
+			PartyName:           UBLPartyName{Name: summary.AccountingSupplierParty.RegistrationName},
+		},
+		DigitalSignatureAttachment: UBLDigitalSignatureAttachment{
+			ExternalReference: UBLExternalReference{URI: "#SignatureSP"},
+		},
+	}
+	zipPath, signedXML, err := s.signSummary(ctx, summaryID, summary, certPEM, keyPEM)
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		return summaryError(stepErr.Code, stepErr.Message), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record.CreatedAt = s.clock.Now()
+	if err := s.saveSummaryRecord(record); err != nil {
+		return summaryError("SAVE_FAILED", fmt.Sprintf("Error al registrar el resumen: %v", err)), nil
+	}
+
+	voided := 0
+	for _, line := range record.Lines {
+		if line.Status == SummaryStatusVoid {
+			voided++
+		}
+	}
+	s.logService.LogInfo(correlationID, "GENERATE_SUMMARY", SummaryDocumentType, summaryNumber, fmt.Sprintf("Resumen con %d comprobantes del %s", len(record.Lines), date))
+
+	hash := sha256.Sum256(signedXML)
+	return &APIResponse{
+		Status:        "SUCCESS",
+		CorrelationID: correlationID,
+		DocumentID:    summaryID,
+		XMLPath:       zipPath,
+		XMLHash:       hex.EncodeToString(hash[:]),
+		ProcessedAt:   s.clock.Now(),
+		Duration:      s.clock.Now().Sub(startTime).Milliseconds(),
+		Data: map[string]interface{}{
+			"summaryId":     summaryNumber,
+			"referenceDate": date,
+			"lines":         record.Lines,
+			"added":         len(record.Lines) - voided,
+			"voided":        voided,
+			"skipped":       skipped,
+		},
+	}, nil
+}
+
+// signSummary firma el resumen (RC o RR) y guarda su XML y su ZIP en el store con el
+// nombre summaryID. Retorna la ruta del ZIP y el XML firmado; los errores que se
+// responden al cliente son *StepError con el código de la respuesta.
+func (s *UBLConverterService) signSummary(ctx context.Context, summaryID string, document interface{}, certPEM, keyPEM []byte) (string, []byte, error) {
+	xmlData, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal summary: %v", err)
+	}
+	xmlData, err = EncodeXML(append([]byte(xml.Header), xmlData...), s.xmlEncoding)
+	if err != nil {
+		return "", nil, &StepError{Code: "ERR_XML_ENCODING", Message: fmt.Sprintf("El XML no se puede codificar en %s: %v", s.xmlEncoding, err)}
+	}
+	signResult, err := s.signer.Sign(xmlData, certPEM, keyPEM)
+	if err != nil {
+		return "", nil, &StepError{Code: "SIGNATURE_FAILED", Message: fmt.Sprintf("Error en firma digital: %v", err)}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", nil, &StepError{Code: ErrCancelledCode, Message: fmt.Sprintf("La generación fue cancelada: %v", err)}
+	}
+
+	fileName := summaryID + ".xml"
+	zipData, err := ZipXMLBytes(fileName, signResult.SignedXML)
+	if err != nil {
+		return "", nil, &StepError{Code: "ZIP_FAILED", Message: fmt.Sprintf("Error al crear ZIP: %v", err)}
+	}
+	if _, err := s.store.Save(fileName, signResult.SignedXML); err != nil {
+		return "", nil, &StepError{Code: "SAVE_FAILED", Message: fmt.Sprintf("Error al guardar el resumen: %v", err)}
+	}
+	zipPath, err := s.store.Save(summaryID+".zip", zipData)
+	if err != nil {
+		return "", nil, &StepError{Code: "SAVE_FAILED", Message: fmt.Sprintf("Error al guardar el ZIP del resumen: %v", err)}
+	}
+	return zipPath, signResult.SignedXML, nil
+}
+
+// sendSummary envía el resumen con sendSummary o, si ya tiene un ticket pendiente en
+// el mismo ambiente, consulta ese ticket. Retorna el CDR, o nil si SUNAT aún lo procesa.
+func (s *UBLConverterService) sendSummary(ctx context.Context, client SunatClient, summaryID string, zipData []byte, environment string) ([]byte, *SummaryRecord, error) {
+	record, err := s.readSummaryRecord(summaryID)
+	if err != nil {
+		// Resumen generado fuera del servicio: se envía sin registro
+		record = &SummaryRecord{SummaryID: summaryID}
+	}
+
+	if record.Status != SummaryInProcess || record.Environment != environment || record.Ticket == "" {
+		ticket, err := client.SendSummary(ctx, summaryID+".zip", zipData)
+		if err != nil {
+			return nil, nil, err
+		}
+		record.Ticket, record.Environment, record.Status = ticket, environment, SummaryInProcess
+		if err := s.saveSummaryRecord(record); err != nil {
+			return nil, nil, fmt.Errorf("failed to save summary ticket: %v", err)
+		}
+	}
+
+	cdr, err := client.GetStatus(ctx, record.Ticket)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cdr, record, nil
+}
+
+// VoidDocument marca una boleta o nota asociada como anulada localmente; el próximo
+// resumen diario de su fecha de emisión la informa con estado 3
+func (s *UBLConverterService) VoidDocument(documentID, reason string) (*APIResponse, error) {
+	correlationID := GenerateCorrelationID()
+	documentID = CanonicalDocumentID(documentID)
+	voidError := func(code, message string) *APIResponse {
+		s.logService.LogError(correlationID, "VOID_DOCUMENT_ERROR", "", "", code, message)
+		return &APIResponse{
+			Status:        "ERROR",
+			CorrelationID: correlationID,
+			DocumentID:    documentID,
+			ProcessedAt:   s.clock.Now(),
+			ErrorCode:     code,
+			ErrorMessage:  message,
+		}
+	}
+
+	if !documentIDPattern.MatchString(documentID) {
+		return voidError("ERR_INVALID_DOCUMENT_ID", "El documentId debe tener el formato RUC-TIPO-SERIE-NUMERO"), nil
+	}
+	data, err := s.store.Read(RecordName(documentID))
+	if err != nil {
+		return voidError("ERR_DOCUMENT_NOT_FOUND", fmt.Sprintf("No existe el documento %s", documentID)), nil
+	}
+	var record DocumentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid document record %s: %v", documentID, err)
+	}
+	if !isSummarizedDocument(&record) {
+		return voidError("ERR_NOT_SUMMARIZED", "Solo las boletas y sus notas asociadas se anulan por resumen diario"), nil
+	}
+
+	if _, err := s.store.Save(documentID+VoidedSuffix, []byte(reason)); err != nil {
+		return voidError("SAVE_FAILED", fmt.Sprintf("Error al registrar la anulación: %v", err)), nil
+	}
+	s.recordStatusChange(documentID, DocumentVoided, "", reason)
+	s.logService.LogInfo(correlationID, "VOID_DOCUMENT", record.DocumentType, record.Series+"-"+record.Number, "Comprobante anulado localmente")
+
+	return &APIResponse{
+		Status:        "SUCCESS",
+		CorrelationID: correlationID,
+		DocumentID:    documentID,
+		ProcessedAt:   s.clock.Now(),
+		Data: map[string]interface{}{
+			"issueDate": record.IssueDate,
+			"reason":    reason,
+		},
+	}, nil
+}
@@ -0,0 +1,629 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+	"API-SUNAT2/util/httpclient"
+)
+
+// Ambientes SUNAT a los que se puede enviar un documento
+const (
+	EnvironmentBeta         = "beta"
+	EnvironmentProduction   = "produccion"
+	EnvironmentHomologation = "homologacion"
+)
+
+// defaultSunatURLs son las URLs del billService por ambiente cuando las credenciales no indican una
+var defaultSunatURLs = map[string]string{
+	EnvironmentBeta:         "https://e-beta.sunat.gob.pe/ol-ti-itcpfegem-beta/billService",
+	EnvironmentProduction:   "https://e-factura.sunat.gob.pe/ol-ti-itcpfegem/billService",
+	EnvironmentHomologation: "https://www.sunat.gob.pe/ol-ti-itcpgem-sqa/billService",
+}
+
+// defaultSunatConsultURLs son las URLs del billConsultService (getStatusCdr) por ambiente;
+// SUNAT solo lo publica en producción
+var defaultSunatConsultURLs = map[string]string{
+	EnvironmentProduction: "https://e-factura.sunat.gob.pe/ol-it-wsconscpegem/billConsultService",
+}
+
+// IsValidEnvironment indica si el ambiente es uno de beta, produccion u homologacion
+func IsValidEnvironment(environment string) bool {
+	_, ok := defaultSunatURLs[environment]
+	return ok
+}
+
+// SunatClient envía comprobantes al billService de SUNAT y retorna el CDR (ZIP)
+type SunatClient interface {
+	SendBill(ctx context.Context, fileName string, zipData []byte) ([]byte, error)
+	// SendSummary envía un resumen diario; SUNAT lo atiende de forma asíncrona y
+	// retorna el ticket con que se consulta el resultado
+	SendSummary(ctx context.Context, fileName string, zipData []byte) (string, error)
+	// GetStatus consulta un ticket y retorna el CDR, o nil si SUNAT aún lo procesa
+	GetStatus(ctx context.Context, ticket string) ([]byte, error)
+	// GetStatusCdr consulta en el billConsultService el estado y el CDR de un
+	// comprobante por RUC, tipo, serie y número
+	GetStatusCdr(ctx context.Context, ruc, docType, series, number string) (*SunatCDRStatus, error)
+}
+
+// SunatFault es un SOAP Fault devuelto por SUNAT (credenciales inválidas, rechazo, etc.)
+type SunatFault struct {
+	Code    string
+	Message string
+}
+
+func (f *SunatFault) Error() string {
+	return fmt.Sprintf("sunat fault %s: %s", f.Code, f.Message)
+}
+
+// SOAPSunatClient llama a sendBill, sendSummary, getStatus y getStatusCdr con
+// autenticación WS-Security UsernameToken
+type SOAPSunatClient struct {
+	endpoint SunatEndpoint
+	client   *http.Client
+}
+
+// NewSOAPSunatClient crea el cliente SOAP; si client es nil se usa el del pool
+// compartido del proceso
+func NewSOAPSunatClient(endpoint SunatEndpoint, client *http.Client) *SOAPSunatClient {
+	if client == nil {
+		client = httpclient.Default().Client(httpclient.DestinationSunat)
+	}
+	return &SOAPSunatClient{
+		endpoint: endpoint,
+		client:   client,
+	}
+}
+
+// soapSecurity son los namespaces y el UsernameToken comunes a todas las operaciones
+type soapSecurity struct {
+	XmlnsSoap string `xml:"xmlns:soapenv,attr"`
+	XmlnsSer  string `xml:"xmlns:ser,attr"`
+	XmlnsWsse string `xml:"xmlns:wsse,attr"`
+	Username  string `xml:"soapenv:Header>wsse:Security>wsse:UsernameToken>wsse:Username"`
+	Password  string `xml:"soapenv:Header>wsse:Security>wsse:UsernameToken>wsse:Password"`
+}
+
+type soapSendBillEnvelope struct {
+	XMLName xml.Name `xml:"soapenv:Envelope"`
+	soapSecurity
+	FileName    string `xml:"soapenv:Body>ser:sendBill>fileName"`
+	ContentFile string `xml:"soapenv:Body>ser:sendBill>contentFile"`
+}
+
+type soapSendSummaryEnvelope struct {
+	XMLName xml.Name `xml:"soapenv:Envelope"`
+	soapSecurity
+	FileName    string `xml:"soapenv:Body>ser:sendSummary>fileName"`
+	ContentFile string `xml:"soapenv:Body>ser:sendSummary>contentFile"`
+}
+
+type soapGetStatusEnvelope struct {
+	XMLName xml.Name `xml:"soapenv:Envelope"`
+	soapSecurity
+	Ticket string `xml:"soapenv:Body>ser:getStatus>ticket"`
+}
+
+type soapGetStatusCdrEnvelope struct {
+	XMLName xml.Name `xml:"soapenv:Envelope"`
+	soapSecurity
+	RUC     string `xml:"soapenv:Body>ser:getStatusCdr>rucComprobante"`
+	DocType string `xml:"soapenv:Body>ser:getStatusCdr>tipoComprobante"`
+	Series  string `xml:"soapenv:Body>ser:getStatusCdr>serieComprobante"`
+	Number  string `xml:"soapenv:Body>ser:getStatusCdr>numeroComprobante"`
+}
+
+type soapFaultResponse struct {
+	Body struct {
+		Fault *struct {
+			Code   string `xml:"faultcode"`
+			String string `xml:"faultstring"`
+		} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+type soapSendBillResponse struct {
+	ApplicationResponse string `xml:"Body>sendBillResponse>applicationResponse"`
+}
+
+type soapSendSummaryResponse struct {
+	Ticket string `xml:"Body>sendSummaryResponse>ticket"`
+}
+
+type soapGetStatusResponse struct {
+	StatusCode string `xml:"Body>getStatusResponse>status>statusCode"`
+	Content    string `xml:"Body>getStatusResponse>status>content"`
+}
+
+type soapGetStatusCdrResponse struct {
+	StatusCode    string `xml:"Body>getStatusCdrResponse>statusCdr>statusCode"`
+	StatusMessage string `xml:"Body>getStatusCdrResponse>statusCdr>statusMessage"`
+	Content       string `xml:"Body>getStatusCdrResponse>statusCdr>content"`
+}
+
+// Códigos de getStatus: 0 procesado, 98 en proceso, 99 procesado con errores
+const sunatStatusInProcess = "98"
+
+func (c *SOAPSunatClient) security() soapSecurity {
+	return soapSecurity{
+		XmlnsSoap: "http://schemas.xmlsoap.org/soap/envelope/",
+		XmlnsSer:  "http://service.sunat.gob.pe",
+		XmlnsWsse: "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd",
+		Username:  c.endpoint.Username,
+		Password:  c.endpoint.Password,
+	}
+}
+
+// call envía el envelope a url con la acción SOAP indicada y decodifica la respuesta
+// en response; un SOAP Fault se retorna como *SunatFault
+func (c *SOAPSunatClient) call(ctx context.Context, url, action string, envelope, response interface{}) error {
+	payload, err := xml.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml;charset=UTF-8")
+	req.Header.Set("SOAPAction", "urn:"+action)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		recordSOAPTrace(ctx, action, url, payload, nil, 0, err)
+		return fmt.Errorf("sunat request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	recordSOAPTrace(ctx, action, url, payload, body, resp.StatusCode, err)
+	if err != nil {
+		return fmt.Errorf("sunat response read failed: %v", err)
+	}
+
+	// SUNAT devuelve los SOAP Fault con HTTP 500, por eso se parsea antes de ver el status
+	var fault soapFaultResponse
+	if err := xml.Unmarshal(body, &fault); err != nil {
+		return fmt.Errorf("sunat returned status %d with invalid SOAP response: %v", resp.StatusCode, err)
+	}
+	if fault.Body.Fault != nil {
+		return &SunatFault{Code: fault.Body.Fault.Code, Message: fault.Body.Fault.String}
+	}
+	if err := xml.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("sunat returned status %d with invalid SOAP response: %v", resp.StatusCode, err)
+	}
+	return nil
+}
+
+func (c *SOAPSunatClient) SendBill(ctx context.Context, fileName string, zipData []byte) ([]byte, error) {
+	var parsed soapSendBillResponse
+	err := c.call(ctx, c.endpoint.URL, "sendBill", soapSendBillEnvelope{
+		soapSecurity: c.security(),
+		FileName:     fileName,
+		ContentFile:  base64.StdEncoding.EncodeToString(zipData),
+	}, &parsed)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.ApplicationResponse == "" {
+		return nil, fmt.Errorf("sunat response without applicationResponse")
+	}
+
+	cdr, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parsed.ApplicationResponse))
+	if err != nil {
+		return nil, fmt.Errorf("invalid applicationResponse: %v", err)
+	}
+	return cdr, nil
+}
+
+func (c *SOAPSunatClient) SendSummary(ctx context.Context, fileName string, zipData []byte) (string, error) {
+	var parsed soapSendSummaryResponse
+	err := c.call(ctx, c.endpoint.URL, "sendSummary", soapSendSummaryEnvelope{
+		soapSecurity: c.security(),
+		FileName:     fileName,
+		ContentFile:  base64.StdEncoding.EncodeToString(zipData),
+	}, &parsed)
+	if err != nil {
+		return "", err
+	}
+	ticket := strings.TrimSpace(parsed.Ticket)
+	if ticket == "" {
+		return "", fmt.Errorf("sunat response without ticket")
+	}
+	return ticket, nil
+}
+
+func (c *SOAPSunatClient) GetStatus(ctx context.Context, ticket string) ([]byte, error) {
+	var parsed soapGetStatusResponse
+	err := c.call(ctx, c.endpoint.URL, "getStatus", soapGetStatusEnvelope{
+		soapSecurity: c.security(),
+		Ticket:       ticket,
+	}, &parsed)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(parsed.StatusCode) == sunatStatusInProcess {
+		return nil, nil
+	}
+	if parsed.Content == "" {
+		return nil, fmt.Errorf("sunat status %s without CDR", parsed.StatusCode)
+	}
+
+	cdr, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parsed.Content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid status content: %v", err)
+	}
+	return cdr, nil
+}
+
+func (c *SOAPSunatClient) GetStatusCdr(ctx context.Context, ruc, docType, series, number string) (*SunatCDRStatus, error) {
+	if c.endpoint.ConsultURL == "" {
+		return nil, fmt.Errorf("getStatusCdr is not available: no consult URL configured")
+	}
+
+	var parsed soapGetStatusCdrResponse
+	err := c.call(ctx, c.endpoint.ConsultURL, "getStatusCdr", soapGetStatusCdrEnvelope{
+		soapSecurity: c.security(),
+		RUC:          ruc,
+		DocType:      docType,
+		Series:       series,
+		Number:       number,
+	}, &parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SunatCDRStatus{
+		Code:    strings.TrimSpace(parsed.StatusCode),
+		Message: strings.TrimSpace(parsed.StatusMessage),
+	}
+	if content := strings.TrimSpace(parsed.Content); content != "" {
+		status.CDR, err = base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid statusCdr content: %v", err)
+		}
+	}
+	return status, nil
+}
+
+// SunatCredentials mapea RUC emisor -> ambiente -> endpoint. La clave "*" aplica a
+// los emisores sin entrada propia.
+type SunatCredentials map[string]map[string]SunatEndpoint
+
+// LoadSunatCredentials lee las credenciales por emisor y ambiente desde un archivo JSON
+func LoadSunatCredentials(path string) (SunatCredentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var credentials SunatCredentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("invalid sunat credentials file: %v", err)
+	}
+	for issuer, environments := range credentials {
+		for environment := range environments {
+			if !IsValidEnvironment(environment) {
+				return nil, fmt.Errorf("unknown environment %q for issuer %s", environment, issuer)
+			}
+			if _, err := NewZIPFileNamer(environments[environment].ZIPFileName); err != nil {
+				return nil, fmt.Errorf("issuer %s, environment %s: %v", issuer, environment, err)
+			}
+		}
+	}
+	return credentials, nil
+}
+
+// SunatRouter resuelve el cliente SOAP para cada combinación emisor + ambiente
+type SunatRouter struct {
+	credentials SunatCredentials
+	newClient   func(SunatEndpoint) SunatClient
+}
+
+// NewSunatRouter crea el router de ambientes. newClient permite sustituir el cliente
+// SOAP (por ejemplo, por mocks); si es nil se usa SOAPSunatClient con el cliente HTTP
+// del pool compartido del proceso.
+func NewSunatRouter(credentials SunatCredentials, newClient func(SunatEndpoint) SunatClient) *SunatRouter {
+	if newClient == nil {
+		newClient = func(endpoint SunatEndpoint) SunatClient {
+			return NewSOAPSunatClient(endpoint, nil)
+		}
+	}
+	return &SunatRouter{credentials: credentials, newClient: newClient}
+}
+
+// ClientFor retorna el cliente para el emisor y ambiente indicados
+func (r *SunatRouter) ClientFor(ruc, environment string) (SunatClient, error) {
+	endpoint, err := r.endpointFor(ruc, environment)
+	if err != nil {
+		return nil, err
+	}
+	return r.newClient(endpoint), nil
+}
+
+// ZIPFileNamerFor retorna el nombrado del ZIP enviado al proveedor del emisor y ambiente;
+// sin plantilla propia, o si no hay credenciales, el nombre estándar
+func (r *SunatRouter) ZIPFileNamerFor(ruc, environment string) *ZIPFileNamer {
+	endpoint, _ := r.endpointFor(ruc, environment)
+	namer, err := NewZIPFileNamer(endpoint.ZIPFileName)
+	if err != nil {
+		// Las plantillas se validan al cargar las credenciales; una inválida no cambia el nombre
+		namer, _ = NewZIPFileNamer("")
+	}
+	return namer
+}
+
+func (r *SunatRouter) endpointFor(ruc, environment string) (SunatEndpoint, error) {
+	if !IsValidEnvironment(environment) {
+		return SunatEndpoint{}, fmt.Errorf("unknown environment %q", environment)
+	}
+
+	endpoint, ok := r.credentials[ruc][environment]
+	if !ok {
+		endpoint, ok = r.credentials["*"][environment]
+	}
+	if !ok {
+		return SunatEndpoint{}, fmt.Errorf("no credentials for issuer %s in environment %s", ruc, environment)
+	}
+	if endpoint.URL == "" {
+		endpoint.URL = defaultSunatURLs[environment]
+	}
+	if endpoint.ConsultURL == "" {
+		endpoint.ConsultURL = defaultSunatConsultURLs[environment]
+	}
+	return endpoint, nil
+}
+
+var documentIDPattern = regexp.MustCompile(`^(\d{11})-(\d{2})-([A-Z0-9]{4})-(\d{1,8})$`)
+
+// SendDocument envía a SUNAT el ZIP guardado del documento (RUC-TIPO-SERIE-NUMERO) al
+// ambiente indicado, o al ambiente por defecto si viene vacío, y registra el envío. Si
+// ctx se cancela antes de recibir el CDR el envío se aborta. Un resumen diario
+// (RUC-RC-AAAAMMDD-N) o de reversiones (RUC-RR-AAAAMMDD-N) se envía con sendSummary;
+// si SUNAT aún procesa el ticket, la respuesta lo indica y un nuevo envío consulta el
+// mismo ticket.
+func (s *UBLConverterService) SendDocument(ctx context.Context, documentID, environment string) (*APIResponse, error) {
+	correlationID := GenerateCorrelationID()
+	documentID = CanonicalDocumentID(documentID)
+	if environment == "" {
+		environment = s.defaultEnvironment
+	}
+
+	sendError := func(docType, docNumber, code, message string) *APIResponse {
+		s.logService.LogError(correlationID, "SEND_DOCUMENT_ERROR", docType, docNumber, code, message)
+		return &APIResponse{
+			Status:        "ERROR",
+			CorrelationID: correlationID,
+			DocumentID:    documentID,
+			ProcessedAt:   s.clock.Now(),
+			ErrorCode:     code,
+			ErrorMessage:  message,
+		}
+	}
+
+	// En modo validate-only ningún documento llega a un cliente SUNAT, ni al simulado
+	if s.validateOnly {
+		return sendError("", "", ErrValidateOnlyCode, "El envío a SUNAT está deshabilitado en modo validate-only"), nil
+	}
+
+	// Los resúmenes diarios y de reversiones se envían con sendSummary
+	summaryParts := summaryIDPattern.FindStringSubmatch(documentID)
+	parts := documentIDPattern.FindStringSubmatch(documentID)
+	if parts == nil && summaryParts == nil {
+		return sendError("", "", "ERR_INVALID_DOCUMENT_ID", "El documentId debe tener el formato RUC-TIPO-SERIE-NUMERO"), nil
+	}
+	var ruc, docType, docNumber string
+	if summaryParts != nil {
+		ruc, docType, docNumber = summaryParts[1], summaryParts[2], strings.TrimPrefix(documentID, summaryParts[1]+"-")
+	} else {
+		ruc, docType, docNumber = parts[1], parts[2], fmt.Sprintf("%s-%s", parts[3], parts[4])
+	}
+
+	var client SunatClient
+	if s.sunatMock != nil {
+		// En modo mock nunca se llama a SUNAT: todo envío queda registrado como "mock"
+		environment = EnvironmentMock
+		client = s.sunatMock
+	} else {
+		if !IsValidEnvironment(environment) {
+			return sendError(docType, docNumber, "ERR_INVALID_ENVIRONMENT", fmt.Sprintf("Ambiente no válido: %q (beta, produccion, homologacion)", environment)), nil
+		}
+		if s.sunat == nil {
+			return sendError(docType, docNumber, "ERR_SUNAT_NOT_CONFIGURED", "El envío a SUNAT no está configurado"), nil
+		}
+	}
+
+	// El ZIP se archiva con el nombre estándar; el proveedor puede exigir otro al enviarlo
+	zipFile, sentFileName := documentID+".zip", documentID+".zip"
+	zipData, err := s.store.Read(zipFile)
+	if err != nil {
+		return sendError(docType, docNumber, "ERR_DOCUMENT_NOT_FOUND", fmt.Sprintf("No existe el ZIP del documento %s", documentID)), nil
+	}
+	// Hash y tamaño del ZIP tal como se adjunta al SOAP, para disputar discrepancias con SUNAT
+	zipHash := sha256.Sum256(zipData)
+	sentHash, sentSize := hex.EncodeToString(zipHash[:]), int64(len(zipData))
+
+	if client == nil {
+		// Los documentos marcados como de prueba nunca se envían a producción
+		if environment == EnvironmentProduction {
+			if _, err := s.store.Read(documentID + TestDocumentMarkSuffix); err == nil {
+				return sendError(docType, docNumber, ErrTestDocumentProdCode, "Un documento de prueba no puede enviarse a producción"), nil
+			}
+		}
+
+		client, err = s.sunat.ClientFor(ruc, environment)
+		if err != nil {
+			return sendError(docType, docNumber, "ERR_SUNAT_CREDENTIALS", err.Error()), nil
+		}
+		if summaryParts == nil {
+			sentFileName = s.sunat.ZIPFileNamerFor(ruc, environment).Name(documentID, s.clock.Now())
+		}
+		s.logService.LogInfo(correlationID, "SEND_DOCUMENT", docType, docNumber, fmt.Sprintf("Enviando documento al ambiente %s", environment))
+	} else {
+		s.logService.LogInfo(correlationID, "SEND_DOCUMENT_MOCK", docType, docNumber, "Modo mock: se simula el CDR sin llamar a SUNAT")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return sendError(docType, docNumber, ErrCancelledCode, fmt.Sprintf("El envío fue cancelado: %v", err)), nil
+	}
+	if s.soapTrace.Enabled && s.sunatMock == nil {
+		// La petición y la respuesta SOAP crudas quedan para diagnóstico, sin credenciales
+		var traces *soapTraceRecorder
+		ctx, traces = withSOAPTraceRecorder(ctx, s.soapTrace.MaxBytes, s.clock)
+		defer s.saveSOAPTraces(documentID, environment, traces)
+	}
+	var cdr, previous []byte
+	var summary *SummaryRecord
+	submissionName := fmt.Sprintf("%s.%s.envio", documentID, environment)
+	if summaryParts != nil {
+		cdr, summary, err = s.sendSummary(ctx, client, documentID, zipData, environment)
+	} else {
+		// El envío queda como ENVIADO hasta recibir el CDR: si la respuesta se pierde,
+		// la reconciliación lo consulta después con getStatusCdr
+		previous, _ = s.store.Read(submissionName)
+		pending, _ := json.Marshal(SubmissionRecord{DocumentID: documentID, Environment: environment, SentAt: s.clock.Now(), Status: SubmissionSent, ZIPHash: sentHash, ZIPSize: sentSize, ZIPFile: zipFile, SentFileName: sentFileName})
+		if _, err := s.store.Save(submissionName, pending); err != nil {
+			return sendError(docType, docNumber, "SAVE_FAILED", fmt.Sprintf("Error al registrar el envío: %v", err)), nil
+		}
+		s.recordStatusChange(documentID, SubmissionSent, environment, "")
+		cdr, err = client.SendBill(ctx, sentFileName, zipData)
+		if fault, ok := err.(*SunatFault); ok {
+			// SUNAT respondió sin registrar el comprobante: no queda nada que reconciliar
+			s.recordStatusChange(documentID, SubmissionFailed, environment, fault.Error())
+			if previous != nil {
+				s.store.Save(submissionName, previous)
+			} else {
+				s.store.Delete(submissionName)
+			}
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return sendError(docType, docNumber, ErrCancelledCode, fmt.Sprintf("El envío fue cancelado: %v", ctx.Err())), nil
+		}
+		if fault, ok := err.(*SunatFault); ok {
+			return sendError(docType, docNumber, "ERR_SUNAT_REJECTED", fault.Error()), nil
+		}
+		return sendError(docType, docNumber, "ERR_SUNAT_UNAVAILABLE", err.Error()), nil
+	}
+
+	if summary != nil && cdr == nil {
+		return &APIResponse{
+			Status:        "SUCCESS",
+			CorrelationID: correlationID,
+			DocumentID:    documentID,
+			ProcessedAt:   s.clock.Now(),
+			Data: map[string]interface{}{
+				"environment": environment,
+				"ticket":      summary.Ticket,
+				"cdrStatus":   summary.Status,
+				"zipHash":     sentHash,
+				"zipSize":     sentSize,
+			},
+		}, nil
+	}
+
+	result, err := ParseCDR(cdr)
+	if err != nil {
+		return sendError(docType, docNumber, "ERR_CDR_INVALID", err.Error()), nil
+	}
+
+	// El CDR y el registro se guardan por ambiente para no mezclar pruebas con emisión real
+	record := SubmissionRecord{
+		DocumentID:   documentID,
+		Environment:  environment,
+		SentAt:       s.clock.Now(),
+		CDRFile:      fmt.Sprintf("R-%s.%s.zip", documentID, environment),
+		Status:       result.Status,
+		ResponseCode: result.ResponseCode,
+		Description:  result.Description,
+		Notes:        result.Notes,
+		ZIPHash:      sentHash,
+		ZIPSize:      sentSize,
+		ZIPFile:      zipFile,
+		SentFileName: sentFileName,
+	}
+	if _, err := s.store.Save(record.CDRFile, cdr); err != nil {
+		return sendError(docType, docNumber, "SAVE_FAILED", fmt.Sprintf("Error al guardar el CDR: %v", err)), nil
+	}
+	recordData, _ := json.Marshal(record)
+	if _, err := s.store.Save(submissionName, recordData); err != nil {
+		return sendError(docType, docNumber, "SAVE_FAILED", fmt.Sprintf("Error al registrar el envío: %v", err)), nil
+	}
+	s.recordStatusChange(documentID, result.Status, environment, result.Description)
+	// El tamaño del XML se registra en el ambiente la primera vez que se envía a él
+	if summary == nil && previous == nil {
+		if content, err := s.store.Read(documentID + ".xml"); err == nil {
+			s.recordXMLSize(ruc, environment, len(content))
+		}
+	}
+	if summary != nil {
+		summary.Status = result.Status
+		if err := s.saveSummaryRecord(summary); err != nil {
+			return sendError(docType, docNumber, "SAVE_FAILED", fmt.Sprintf("Error al registrar el resumen: %v", err)), nil
+		}
+		if docType == ReversionDocumentType {
+			s.recordReversion(summary, environment)
+		}
+	}
+
+	return &APIResponse{
+		Status:        "SUCCESS",
+		CorrelationID: correlationID,
+		DocumentID:    documentID,
+		ProcessedAt:   s.clock.Now(),
+		Data: map[string]interface{}{
+			"environment":  environment,
+			"cdrFile":      record.CDRFile,
+			"cdrSize":      len(cdr),
+			"cdrStatus":    result.Status,
+			"responseCode": result.ResponseCode,
+			"description":  result.Description,
+			"notes":        result.Notes,
+			"zipHash":      sentHash,
+			"zipSize":      sentSize,
+			"zipFile":      zipFile,
+			"sentFileName": sentFileName,
+		},
+	}, nil
+}
+
+// ListSubmissions retorna los envíos registrados, filtrados por ambiente si se indica
+func (s *UBLConverterService) ListSubmissions(environment string) ([]SubmissionRecord, error) {
+	names, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []SubmissionRecord{}
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".envio") {
+			continue
+		}
+		data, err := s.store.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		var record SubmissionRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("invalid submission record %s: %v", name, err)
+		}
+		if environment == "" || record.Environment == environment {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	. "API-SUNAT2/model"
+)
+
+// DerivedLine son los montos calculados de una línea a partir de su precio con IGV
+type DerivedLine struct {
+	ID           string  `json:"id"`
+	PriceWithTax float64 `json:"priceWithTax"`
+	UnitPrice    float64 `json:"unitPrice"`
+	LineTotal    float64 `json:"lineTotal"`
+	TaxAmount    float64 `json:"taxAmount"`
+}
+
+// DerivedAmounts son los montos que el servicio calculó en modo pricesIncludeTax
+type DerivedAmounts struct {
+	Lines       []DerivedLine `json:"lines"`
+	SubTotal    float64       `json:"subTotal"`
+	TotalTaxes  float64       `json:"totalTaxes"`
+	TotalAmount float64       `json:"totalAmount"`
+}
+
+// cents convierte un monto a céntimos redondeando al más cercano
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// deriveTaxIncludedAmounts reemplaza los montos de un documento cuyos precios incluyen
+// IGV. La base de cada línea es su importe con IGV entre (1 + tasa) y el IGV de la línea
+// la diferencia, de modo que cada línea cuadra con su importe cobrado. La base del
+// documento se calcula sobre el total; el céntimo que difiera la suma de bases se
+// ajusta en la línea de mayor importe.
+func deriveTaxIncludedAmounts(doc *BusinessDocument, igvRate float64) (*DerivedAmounts, []ValidationError) {
+	var errors []ValidationError
+	for i, item := range doc.Items {
+		for j, tax := range item.Taxes {
+			if tax.TaxType != "1000" {
+				errors = append(errors, ValidationError{
+					Field:    fmt.Sprintf("items[%d].taxes[%d].taxType", i, j),
+					Expected: "1000",
+					Received: tax.TaxType,
+					Rule:     "prices_include_tax_validation",
+					Message:  "Prices including tax are only supported for IGV taxed items",
+				})
+			}
+		}
+	}
+	if len(errors) > 0 {
+		return nil, errors
+	}
+
+	factor := 1 + igvRate/100
+	var indexes []int
+	var gross, base []int64
+	var totalCents int64
+	largest := -1
+	for i, item := range doc.Items {
+		if item.Informative && item.Quantity == 0 {
+			continue
+		}
+		lineGross := cents(float64(item.UnitPrice * item.Quantity))
+		if largest == -1 || lineGross > gross[largest] {
+			largest = len(indexes)
+		}
+		indexes = append(indexes, i)
+		gross = append(gross, lineGross)
+		base = append(base, int64(math.Round(float64(lineGross)/factor)))
+		totalCents += lineGross
+	}
+
+	baseCents := int64(math.Round(float64(totalCents) / factor))
+	if largest != -1 {
+		var sum int64
+		for _, lineBase := range base {
+			sum += lineBase
+		}
+		base[largest] += baseCents - sum
+	}
+
+	derived := &DerivedAmounts{Lines: []DerivedLine{}}
+	for n, i := range indexes {
+		item := &doc.Items[i]
+		lineTotal := float64(base[n]) / 100
+		taxAmount := float64(gross[n]-base[n]) / 100
+		line := DerivedLine{
+			ID:           item.ID,
+			PriceWithTax: float64(item.UnitPrice),
+			UnitPrice:    math.Round(float64(item.UnitPrice)/factor*1e10) / 1e10,
+			LineTotal:    lineTotal,
+			TaxAmount:    taxAmount,
+		}
+		item.UnitPrice = FlexFloat(line.UnitPrice)
+		item.LineTotal = FlexFloat(lineTotal)
+		item.Taxes = []Tax{{TaxType: "1000", TaxAmount: FlexFloat(taxAmount), TaxRate: FlexFloat(igvRate), TaxBase: FlexFloat(lineTotal)}}
+		derived.Lines = append(derived.Lines, line)
+	}
+
+	derived.SubTotal = float64(baseCents) / 100
+	derived.TotalTaxes = float64(totalCents-baseCents) / 100
+	derived.TotalAmount = float64(totalCents) / 100
+	doc.Totals = DocumentTotals{
+		SubTotal:      FlexFloat(derived.SubTotal),
+		TotalTaxes:    FlexFloat(derived.TotalTaxes),
+		TotalAmount:   FlexFloat(derived.TotalAmount),
+		PayableAmount: FlexFloat(derived.TotalAmount),
+	}
+	doc.Taxes = []TaxTotal{{TaxType: "1000", TaxAmount: FlexFloat(derived.TotalTaxes), TaxRate: FlexFloat(igvRate), TaxBase: FlexFloat(derived.SubTotal)}}
+	return derived, nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	. "API-SUNAT2/model"
+)
+
+// DocumentTemplateSuffix es la extensión de la plantilla de documentos de cada emisor en el store
+const DocumentTemplateSuffix = ".plantilla"
+
+// DocumentTemplateName retorna el nombre de la plantilla del emisor en el store
+func DocumentTemplateName(ruc string) string {
+	return ruc + DocumentTemplateSuffix
+}
+
+// ErrInvalidDocumentTemplate indica una plantilla que no describe un documento: un campo
+// que el schema no declara, un valor del tipo equivocado o el RUC de otro emisor
+type ErrInvalidDocumentTemplate struct {
+	Field  string
+	Reason string
+}
+
+func (e *ErrInvalidDocumentTemplate) Error() string {
+	if e.Field == "" {
+		return "document template: " + e.Reason
+	}
+	return fmt.Sprintf("document template field %s: %s", e.Field, e.Reason)
+}
+
+// documentTemplateCache guarda en memoria la plantilla de cada emisor leída del store; se
+// reemplaza al modificarse con SetDocumentTemplate
+type documentTemplateCache struct {
+	mu       sync.RWMutex
+	byIssuer map[string]map[string]interface{}
+}
+
+// SetDocumentTemplate reemplaza la plantilla del emisor; una plantilla vacía la desactiva.
+// Los valores deben decodificarse como un BusinessDocument y, si indican el emisor, debe
+// ser el mismo RUC.
+func (s *UBLConverterService) SetDocumentTemplate(ruc string, defaults map[string]interface{}) (*DocumentTemplate, error) {
+	if defaults == nil {
+		defaults = map[string]interface{}{}
+	}
+	if unknown := DocumentSchema().UnknownFields(defaults); len(unknown) > 0 {
+		return nil, &ErrInvalidDocumentTemplate{Field: unknown[0].Field, Reason: unknown[0].Message}
+	}
+	data, err := json.Marshal(defaults)
+	if err != nil {
+		return nil, &ErrInvalidDocumentTemplate{Reason: err.Error()}
+	}
+	var doc BusinessDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, &ErrInvalidDocumentTemplate{Reason: err.Error()}
+	}
+	if doc.Issuer.DocumentID != "" && doc.Issuer.DocumentID != ruc {
+		return nil, &ErrInvalidDocumentTemplate{Field: "issuer.documentId", Reason: "must be the template issuer " + ruc}
+	}
+	// Los datos de contacto se validan al registrarlos, no en cada documento que los toma
+	if errs := validateContact("issuer", doc.Issuer); len(errs) > 0 {
+		return nil, &ErrInvalidDocumentTemplate{Field: errs[0].Field, Reason: errs[0].Message}
+	}
+
+	template := &DocumentTemplate{IssuerRUC: ruc, Defaults: defaults, UpdatedAt: s.clock.Now()}
+	if data, err = json.Marshal(template); err != nil {
+		return nil, err
+	}
+
+	s.templates.mu.Lock()
+	defer s.templates.mu.Unlock()
+	if _, err := s.store.Save(DocumentTemplateName(ruc), data); err != nil {
+		return nil, err
+	}
+	if s.templates.byIssuer == nil {
+		s.templates.byIssuer = make(map[string]map[string]interface{})
+	}
+	s.templates.byIssuer[ruc] = defaults
+	return template, nil
+}
+
+// DocumentTemplateDefaults retorna los valores por defecto del emisor, vacío si no tiene
+// plantilla. Se lee del store la primera vez y después se sirve desde memoria.
+func (s *UBLConverterService) DocumentTemplateDefaults(ruc string) map[string]interface{} {
+	s.templates.mu.RLock()
+	defaults, ok := s.templates.byIssuer[ruc]
+	s.templates.mu.RUnlock()
+	if ok {
+		return defaults
+	}
+
+	s.templates.mu.Lock()
+	defer s.templates.mu.Unlock()
+	if defaults, ok := s.templates.byIssuer[ruc]; ok {
+		return defaults
+	}
+	defaults = map[string]interface{}{}
+	if data, err := s.store.Read(DocumentTemplateName(ruc)); err == nil {
+		var template DocumentTemplate
+		if err := json.Unmarshal(data, &template); err != nil {
+			s.GetLogger().Warnf("Plantilla de documentos de %s inválida: %v", ruc, err)
+		} else if template.Defaults != nil {
+			defaults = template.Defaults
+		}
+	}
+	if s.templates.byIssuer == nil {
+		s.templates.byIssuer = make(map[string]map[string]interface{})
+	}
+	s.templates.byIssuer[ruc] = defaults
+	return defaults
+}
+
+// MergeDocumentTemplate completa el documento JSON con la plantilla de su emisor
+// (issuer.documentId) y retorna los campos completados, ordenados. El request siempre
+// gana: la plantilla solo llena los campos ausentes o null. Los objetos se combinan
+// campo a campo; los arrays se toman completos de uno u otro, nunca se mezclan sus
+// elementos, así un request con "observations": [] emite sin las de la plantilla.
+func (s *UBLConverterService) MergeDocumentTemplate(document map[string]interface{}) []string {
+	issuer, _ := document["issuer"].(map[string]interface{})
+	ruc, _ := issuer["documentId"].(string)
+	if ruc == "" {
+		return nil
+	}
+	defaults := s.DocumentTemplateDefaults(ruc)
+	if len(defaults) == 0 {
+		return nil
+	}
+	var fields []string
+	mergeDefaults(document, defaults, "", &fields)
+	sort.Strings(fields)
+	return fields
+}
+
+func mergeDefaults(target, defaults map[string]interface{}, path string, fields *[]string) {
+	for name, value := range defaults {
+		current, present := target[name]
+		if !present || current == nil {
+			target[name] = cloneJSON(value)
+			*fields = append(*fields, joinPath(path, name))
+			continue
+		}
+		nestedTarget, targetIsObject := current.(map[string]interface{})
+		nestedDefaults, defaultIsObject := value.(map[string]interface{})
+		if targetIsObject && defaultIsObject {
+			mergeDefaults(nestedTarget, nestedDefaults, joinPath(path, name), fields)
+		}
+	}
+}
+
+// cloneJSON copia un valor JSON decodificado para que el documento no comparta mapas ni
+// slices con la plantilla en memoria
+func cloneJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			clone[key] = cloneJSON(item)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = cloneJSON(item)
+		}
+		return clone
+	}
+	return value
+}
+
+// applyDocumentTemplate completa con la plantilla del emisor el documento del cuerpo de
+// /validate o /convert. Retorna el cuerpo a decodificar y los campos completados; sin
+// plantilla el cuerpo no cambia.
+func (s *UBLConverterService) applyDocumentTemplate(body []byte, target interface{}) ([]byte, []string) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Los números se conservan tal como llegaron al volver a serializar el cuerpo
+	decoder.UseNumber()
+	var value map[string]interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return body, nil
+	}
+
+	document := value
+	switch target.(type) {
+	case *BusinessDocument:
+	case *ConvertRequest:
+		if document, _ = value["document"].(map[string]interface{}); document == nil {
+			return body, nil
+		}
+	default:
+		return body, nil
+	}
+
+	fields := s.MergeDocumentTemplate(document)
+	if len(fields) == 0 {
+		return body, nil
+	}
+	merged, err := json.Marshal(value)
+	if err != nil {
+		return body, nil
+	}
+	return merged, fields
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"strings"
+
+	. "API-SUNAT2/model"
+)
+
+// TestDocumentMarkSuffix es la marca en el store de un documento de prueba
+const TestDocumentMarkSuffix = ".prueba"
+
+// ErrTestDocumentProdCode es el código del envío de un documento de prueba a producción
+const ErrTestDocumentProdCode = "ERR_TEST_DOCUMENT_PROD"
+
+// TestStorePrefix es el subdirectorio del store donde se guardan los artefactos de los
+// emisores y series de prueba, separados de los de producción
+const TestStorePrefix = "prueba"
+
+// testDocumentRules son los RUC y las series cuyos documentos son siempre de prueba
+type testDocumentRules struct {
+	issuers map[string]bool
+	series  map[string]bool
+}
+
+// SetTestDocuments configura los RUC y las series (de cualquier emisor) cuyos documentos
+// se marcan como de prueba aunque el request no indique "test"
+func (s *UBLConverterService) SetTestDocuments(issuers, series []string) {
+	rules := testDocumentRules{issuers: make(map[string]bool, len(issuers)), series: make(map[string]bool, len(series))}
+	for _, ruc := range issuers {
+		rules.issuers[ruc] = true
+	}
+	for _, serie := range series {
+		rules.series[strings.ToUpper(serie)] = true
+	}
+	s.testDocuments = rules
+}
+
+// IsTestDocument indica si el RUC o la serie están configurados como de prueba
+func (s *UBLConverterService) IsTestDocument(ruc, series string) bool {
+	return s.testDocuments.issuers[ruc] || s.testDocuments.series[strings.ToUpper(series)]
+}
+
+// IsTestArtifact indica si el artefacto del store pertenece a un documento de un emisor
+// o serie de prueba, por su nombre RUC-tipo-serie-número
+func (s *UBLConverterService) IsTestArtifact(name string) bool {
+	parts := strings.SplitN(name, "-", 4)
+	return len(parts) == 4 && s.IsTestDocument(parts[0], parts[2])
+}
+
+// markTestDocument marca como de prueba el documento de un emisor o serie de prueba
+func (s *UBLConverterService) markTestDocument(doc *BusinessDocument) bool {
+	if doc.Test || !s.IsTestDocument(doc.Issuer.DocumentID, doc.Series) {
+		return false
+	}
+	doc.Test = true
+	return true
+}
+
+// isTestRecord indica si el documento registrado es de prueba; los registros anteriores
+// al campo test se reconocen por su marca en el store
+func (s *UBLConverterService) isTestRecord(record *DocumentRecord) bool {
+	if record.Test {
+		return true
+	}
+	_, err := s.store.Read(record.DocumentID + TestDocumentMarkSuffix)
+	return err == nil
+}
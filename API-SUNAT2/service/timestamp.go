@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"API-SUNAT2/util/httpclient"
+)
+
+// TimestampAuthority obtiene un sello de tiempo RFC 3161 sobre un digest SHA-256
+type TimestampAuthority interface {
+	Timestamp(digest []byte) ([]byte, error)
+}
+
+var oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+type tsaMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tsaRequest struct {
+	Version        int
+	MessageImprint tsaMessageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type tsaStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type tsaResponse struct {
+	Status         tsaStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type cmsEncapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo cmsEncapContentInfo
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint tsaMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// HTTPTimestampAuthority solicita sellos de tiempo a una TSA vía HTTP (RFC 3161)
+type HTTPTimestampAuthority struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPTimestampAuthority crea el cliente de la TSA; si client es nil se usa el del
+// pool compartido del proceso
+func NewHTTPTimestampAuthority(url string, client *http.Client) *HTTPTimestampAuthority {
+	if client == nil {
+		client = httpclient.Default().Client(httpclient.DestinationTSA)
+	}
+	return &HTTPTimestampAuthority{url: url, client: client}
+}
+
+func (t *HTTPTimestampAuthority) Timestamp(digest []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	request, err := asn1.Marshal(tsaRequest{
+		Version: 1,
+		MessageImprint: tsaMessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode timestamp request: %v", err)
+	}
+
+	resp, err := t.client.Post(t.url, "application/timestamp-query", bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("TSA request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA returned status %d", resp.StatusCode)
+	}
+
+	token, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TSA response: %v", err)
+	}
+	if _, err := VerifyTimestamp(token, digest); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// VerifyTimestamp verifica que la respuesta TSR haya sido concedida y que su
+// messageImprint corresponda al digest indicado. Retorna la hora del sello.
+// No valida la cadena de certificados de la TSA.
+func VerifyTimestamp(token []byte, digest []byte) (time.Time, error) {
+	var response tsaResponse
+	if _, err := asn1.Unmarshal(token, &response); err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp response: %v", err)
+	}
+	// 0 = granted, 1 = grantedWithMods
+	if response.Status.Status > 1 {
+		return time.Time{}, fmt.Errorf("timestamp request rejected by TSA (status %d)", response.Status.Status)
+	}
+
+	var contentInfo cmsContentInfo
+	if _, err := asn1.Unmarshal(response.TimeStampToken.FullBytes, &contentInfo); err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp token: %v", err)
+	}
+	var signedData cmsSignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp signed data: %v", err)
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(signedData.EncapContentInfo.EContent, &info); err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp info: %v", err)
+	}
+
+	if !bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return time.Time{}, fmt.Errorf("timestamp imprint does not match the signature value")
+	}
+	return info.GenTime, nil
+}
+
+// signatureValueDigest es el digest SHA-256 del SignatureValue sobre el que se sella
+func signatureValueDigest(signature []byte) []byte {
+	digest := sha256.Sum256(signature)
+	return digest[:]
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// Servicios turísticos de TourismDetail.ServiceType
+const (
+	TourismLodging = "hospedaje"
+	TourismPackage = "paquete"
+)
+
+// tourismPassengerDocTypes son los documentos del catálogo 06 de un pasajero no
+// domiciliado, con el largo máximo del número
+var tourismPassengerDocTypes = map[string]int{
+	"0": 15, // Documento tributario no domiciliado sin RUC
+	"4": 12, // Carné de extranjería
+	"7": 12, // Pasaporte
+	"A": 15, // Cédula diplomática de identidad
+	"B": 15, // Documento de identidad del país de residencia
+}
+
+// tourismProperty arma una propiedad del ítem del catálogo 55
+func tourismProperty(name, code string) UBLAdditionalItemProperty {
+	return UBLAdditionalItemProperty{
+		Name:     name,
+		NameCode: catalogAttr(code, catalog.ItemProperty),
+	}
+}
+
+// convertTourismDetail emite el pasajero y el servicio como propiedades del ítem
+// (catálogo 55: 4003-4005 fechas y permanencia del hospedaje, 4007-4009 huésped)
+func (c *UBLConverter) convertTourismDetail(detail *TourismDetail) []UBLAdditionalItemProperty {
+	if detail == nil {
+		return nil
+	}
+
+	prefix := "Beneficio Hospedajes"
+	if detail.ServiceType == TourismPackage {
+		prefix = "Paquete turístico"
+	}
+
+	name := tourismProperty(prefix+": Nombres y Apellidos del Huésped", "4007")
+	name.Value = detail.PassengerName
+	docType := tourismProperty(prefix+": Tipo documento identidad del huésped", "4008")
+	docType.Value = detail.PassengerDocType
+	docNumber := tourismProperty(prefix+": Número de documento identidad del huésped", "4009")
+	docNumber.Value = detail.PassengerDocNumber
+	start := tourismProperty(prefix+": Fecha de Ingreso al Establecimiento", "4003")
+	start.UsabilityPeriod = &UBLUsabilityPeriod{StartDate: detail.StartDate}
+	end := tourismProperty(prefix+": Fecha de Salida del Establecimiento", "4004")
+	end.UsabilityPeriod = &UBLUsabilityPeriod{EndDate: detail.EndDate}
+	properties := []UBLAdditionalItemProperty{name, docType, docNumber, start, end}
+
+	if detail.ServiceType == TourismLodging {
+		stay := tourismProperty(prefix+": Número de Días de Permanencia", "4005")
+		stay.UsabilityPeriod = &UBLUsabilityPeriod{DurationMeasure: &UBLQuantityWithUnit{UnitCode: "DAY", Value: float64(tourismStayDays(detail))}}
+		properties = append(properties, stay)
+	}
+	return properties
+}
+
+// tourismStayDays retorna los días entre el ingreso y la salida (0 si las fechas no son válidas)
+func tourismStayDays(detail *TourismDetail) int {
+	start, err := time.Parse("2006-01-02", detail.StartDate)
+	if err != nil {
+		return 0
+	}
+	end, err := time.Parse("2006-01-02", detail.EndDate)
+	if err != nil {
+		return 0
+	}
+	return int(end.Sub(start).Hours() / 24)
+}
+
+// validateTourismDetails valida el pasajero, el tipo de servicio y las fechas de las
+// líneas con detalle turístico; las demás líneas del comprobante no se ven afectadas
+func (v *ValidationService) validateTourismDetails(doc *BusinessDocument) []ValidationError {
+	var errors []ValidationError
+	for i, item := range doc.Items {
+		detail := item.TourismDetail
+		if detail == nil {
+			continue
+		}
+		field := fmt.Sprintf("items[%d].tourismDetail", i)
+		fail := func(name, expected, received, message string) {
+			errors = append(errors, ValidationError{
+				Field:    field + "." + name,
+				Expected: expected,
+				Received: received,
+				Rule:     "tourism_detail_validation",
+				Message:  message,
+			})
+		}
+
+		maxLength, ok := tourismPassengerDocTypes[detail.PassengerDocType]
+		if !ok {
+			fail("passengerDocType", "Non-resident document type from catalog 06 (0, 4, 7, A, B)", detail.PassengerDocType, "Passenger document type is not valid")
+		} else if matched, _ := regexp.MatchString(fmt.Sprintf(`^[A-Za-z0-9]{1,%d}$`, maxLength), detail.PassengerDocNumber); !matched {
+			fail("passengerDocNumber", fmt.Sprintf("Up to %d alphanumeric characters", maxLength), detail.PassengerDocNumber, "Passenger document number is not valid")
+		}
+		if strings.TrimSpace(detail.PassengerName) == "" {
+			fail("passengerName", "Passenger full name", detail.PassengerName, "Passenger name is required")
+		}
+		if detail.ServiceType != TourismLodging && detail.ServiceType != TourismPackage {
+			fail("serviceType", fmt.Sprintf("%s or %s", TourismLodging, TourismPackage), detail.ServiceType, "Tourism service type is not valid")
+		}
+
+		startValid, endValid := v.isValidDate(detail.StartDate), v.isValidDate(detail.EndDate)
+		if !startValid {
+			fail("startDate", "Valid date format YYYY-MM-DD", detail.StartDate, "Service start date is invalid")
+		}
+		if !endValid {
+			fail("endDate", "Valid date format YYYY-MM-DD", detail.EndDate, "Service end date is invalid")
+		}
+		if startValid && endValid && detail.EndDate < detail.StartDate {
+			fail("endDate", fmt.Sprintf("On or after %s", detail.StartDate), detail.EndDate, "Service ends before it starts")
+		}
+	}
+	return errors
+}
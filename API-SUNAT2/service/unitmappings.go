@@ -0,0 +1,143 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+)
+
+// UnitMappingSuffix es la extensión del mapeo de unidades de cada emisor en el store
+const UnitMappingSuffix = ".unidades"
+
+// UnitMappingName retorna el nombre del mapeo de unidades del emisor en el store
+func UnitMappingName(ruc string) string {
+	return ruc + UnitMappingSuffix
+}
+
+// ErrInvalidUnitMapping indica un mapeo con un código vacío o un destino fuera del catálogo 03
+type ErrInvalidUnitMapping struct {
+	From, To string
+}
+
+func (e *ErrInvalidUnitMapping) Error() string {
+	if e.From == "" {
+		return "unit mapping source code is empty"
+	}
+	return fmt.Sprintf("unit mapping %s -> %s: target is not a catalog 03 (UN/ECE rec. 20) unit code", e.From, e.To)
+}
+
+// unitMappingCache guarda en memoria el mapeo de cada emisor leído del store; se
+// reemplaza al modificarse con SetUnitMappings
+type unitMappingCache struct {
+	mu       sync.RWMutex
+	byIssuer map[string]map[string]string
+}
+
+// isValidUnitCode indica si el código es una unidad de medida del catálogo 03
+func isValidUnitCode(code string) bool {
+	return catalog.HasCode(catalog.UnitOfMeasure, code)
+}
+
+// normalizeUnitCode es la forma en que se comparan los códigos del ERP con el mapeo
+func normalizeUnitCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// SetUnitMappings reemplaza el mapeo de unidades del emisor. Los códigos de origen se
+// guardan en mayúsculas; cada destino debe ser una unidad del catálogo 03.
+func (s *UBLConverterService) SetUnitMappings(ruc string, mappings map[string]string) (*UnitMappingSet, error) {
+	normalized := make(map[string]string, len(mappings))
+	for from, to := range mappings {
+		from, to = normalizeUnitCode(from), normalizeUnitCode(to)
+		if from == "" || !isValidUnitCode(to) {
+			return nil, &ErrInvalidUnitMapping{From: from, To: to}
+		}
+		normalized[from] = to
+	}
+
+	set := &UnitMappingSet{IssuerRUC: ruc, Mappings: normalized, UpdatedAt: s.clock.Now()}
+	data, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+
+	s.unitMappings.mu.Lock()
+	defer s.unitMappings.mu.Unlock()
+	if _, err := s.store.Save(UnitMappingName(ruc), data); err != nil {
+		return nil, err
+	}
+	if s.unitMappings.byIssuer == nil {
+		s.unitMappings.byIssuer = make(map[string]map[string]string)
+	}
+	s.unitMappings.byIssuer[ruc] = normalized
+	return set, nil
+}
+
+// UnitMappings retorna el mapeo de unidades del emisor, vacío si no tiene uno. Se lee
+// del store la primera vez y después se sirve desde memoria.
+func (s *UBLConverterService) UnitMappings(ruc string) map[string]string {
+	s.unitMappings.mu.RLock()
+	mappings, ok := s.unitMappings.byIssuer[ruc]
+	s.unitMappings.mu.RUnlock()
+	if ok {
+		return mappings
+	}
+
+	s.unitMappings.mu.Lock()
+	defer s.unitMappings.mu.Unlock()
+	if mappings, ok := s.unitMappings.byIssuer[ruc]; ok {
+		return mappings
+	}
+	mappings = map[string]string{}
+	if data, err := s.store.Read(UnitMappingName(ruc)); err == nil {
+		var set UnitMappingSet
+		if err := json.Unmarshal(data, &set); err != nil {
+			s.GetLogger().Warnf("Mapeo de unidades de %s inválido: %v", ruc, err)
+		} else if set.Mappings != nil {
+			mappings = set.Mappings
+		}
+	}
+	if s.unitMappings.byIssuer == nil {
+		s.unitMappings.byIssuer = make(map[string]map[string]string)
+	}
+	s.unitMappings.byIssuer[ruc] = mappings
+	return mappings
+}
+
+// applyUnitMappings reemplaza las unidades de las líneas que el emisor tiene mapeadas y
+// retorna los reemplazos hechos. Los códigos válidos del catálogo 03 no se tocan.
+func (s *UBLConverterService) applyUnitMappings(doc *BusinessDocument) []AppliedUnitMapping {
+	mappings := s.UnitMappings(doc.Issuer.DocumentID)
+	if len(mappings) == 0 {
+		return nil
+	}
+	var applied []AppliedUnitMapping
+	for i := range doc.Items {
+		item := &doc.Items[i]
+		if isValidUnitCode(item.UnitCode) {
+			continue
+		}
+		if to, ok := mappings[normalizeUnitCode(item.UnitCode)]; ok {
+			applied = append(applied, AppliedUnitMapping{
+				Field: fmt.Sprintf("items[%d].unitCode", i),
+				From:  item.UnitCode,
+				To:    to,
+			})
+			item.UnitCode = to
+		}
+	}
+	return applied
+}
+
+// unitCodeSuggestion propone el código en mayúsculas si ese es el error, o registrar un
+// mapeo para el código del ERP
+func unitCodeSuggestion(ruc, code string) string {
+	if normalized := normalizeUnitCode(code); normalized != code && isValidUnitCode(normalized) {
+		return fmt.Sprintf("Use the catalog 03 code %s", normalized)
+	}
+	return fmt.Sprintf("Use a catalog 03 (UN/ECE rec. 20) code such as NIU, ZZ, BX or KGM, or map %q to one with PUT /api/v1/issuers/%s/unit-mappings", code, ruc)
+}
@@ -0,0 +1,61 @@
+package service
+
+import _ "embed"
+
+// Modos de operación del servicio
+const (
+	// ModeFull valida, firma con el certificado del emisor y envía a SUNAT
+	ModeFull = "full"
+	// ModeValidateOnly valida y convierte para QA: firma con el certificado de prueba
+	// embebido, marca el XML como no válido y nunca envía a SUNAT
+	ModeValidateOnly = "validate-only"
+)
+
+// ErrValidateOnlyCode es el código de una operación con SUNAT en modo validate-only
+const ErrValidateOnlyCode = "ERR_VALIDATE_ONLY"
+
+// ValidateOnlyNote es el cbc:Note que marca los documentos generados en modo validate-only
+const ValidateOnlyNote = "NO VÁLIDO - PRUEBA"
+
+// ValidateOnlyStorePrefix es el subdirectorio del store donde se guardan los documentos
+// del modo validate-only, separados de los de producción
+const ValidateOnlyStorePrefix = "validate-only"
+
+// validateOnlyCertificate y validateOnlyKey son el certificado autofirmado de prueba
+// (CN "NO VALIDO - PRUEBA") con que se firma en modo validate-only
+var (
+	//go:embed qa/cert.pem
+	validateOnlyCertificate []byte
+	//go:embed qa/key.pem
+	validateOnlyKey []byte
+)
+
+// IsValidMode indica si el modo de operación es conocido
+func IsValidMode(mode string) bool {
+	return mode == ModeFull || mode == ModeValidateOnly
+}
+
+// SetValidateOnly activa el modo validate-only: los documentos se firman con el
+// certificado de prueba, llevan la nota ValidateOnlyNote y no pueden enviarse a SUNAT
+func (s *UBLConverterService) SetValidateOnly(enabled bool) {
+	s.validateOnly = enabled
+	if converter, ok := s.converter.(*UBLConverter); ok {
+		converter.watermark = ""
+		if enabled {
+			converter.watermark = ValidateOnlyNote
+		}
+	}
+}
+
+// IsValidateOnly indica si el servicio está en modo validate-only
+func (s *UBLConverterService) IsValidateOnly() bool {
+	return s.validateOnly
+}
+
+// Mode retorna el modo de operación del servicio
+func (s *UBLConverterService) Mode() string {
+	if s.validateOnly {
+		return ModeValidateOnly
+	}
+	return ModeFull
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	. "API-SUNAT2/model"
+)
+
+// Valores por defecto de las estadísticas de validación
+const (
+	DefaultValidationStatsInterval = time.Minute
+	DefaultValidationStatsBuffer   = 1000
+	// maxValidationExamples es la cantidad de ejemplos distintos que se conservan por regla
+	maxValidationExamples = 5
+	// maxExampleLength es la longitud máxima de un ejemplo anonimizado
+	maxExampleLength = 40
+)
+
+// ValidationStatsSuffix es la extensión de los archivos diarios de estadísticas
+const ValidationStatsSuffix = ".validacion"
+
+// unknownIssuer agrupa los fallos de documentos sin un RUC válido, que no puede usarse
+// como nombre de archivo
+const unknownIssuer = "sin-ruc"
+
+// ErrInvalidReportRange es el error de un rango de fechas inválido en un reporte
+type ErrInvalidReportRange struct {
+	Message string
+}
+
+func (e *ErrInvalidReportRange) Error() string {
+	return e.Message
+}
+
+// ValidationStatsName retorna el nombre del archivo de estadísticas de un emisor y día
+func ValidationStatsName(ruc, date string) string {
+	return fmt.Sprintf("estadisticas-%s-%s%s", ruc, date, ValidationStatsSuffix)
+}
+
+// parseValidationStatsName retorna el RUC y el día de un archivo de estadísticas
+func parseValidationStatsName(name string) (ruc, date string, ok bool) {
+	if !strings.HasPrefix(name, "estadisticas-") || !strings.HasSuffix(name, ValidationStatsSuffix) {
+		return "", "", false
+	}
+	key := strings.TrimSuffix(strings.TrimPrefix(name, "estadisticas-"), ValidationStatsSuffix)
+	// El día ocupa los últimos 10 caracteres: RUC-AAAA-MM-DD
+	if len(key) < 12 || key[len(key)-11] != '-' {
+		return "", "", false
+	}
+	return key[:len(key)-11], key[len(key)-10:], true
+}
+
+// validationSample son los errores de una validación fallida, pendientes de agregar
+type validationSample struct {
+	ruc    string
+	date   string
+	errors []ValidationError
+}
+
+// validationStatsAggregator agrega en memoria los errores de validación y los escribe
+// en el store periódicamente. El pipeline solo encola: si el buffer está lleno la
+// muestra se descarta en lugar de demorar la respuesta.
+type validationStatsAggregator struct {
+	mu      sync.RWMutex
+	queue   chan validationSample
+	flushes chan chan error
+	done    chan struct{}
+	closed  bool
+	dropped int64
+}
+
+// StartValidationStats contabiliza los errores de validación de /validate y /convert
+// por regla, emisor y día. Los conteos se agregan en memoria y se escriben en el store
+// cada interval; la función retornada escribe lo pendiente y detiene el agregador.
+func (s *UBLConverterService) StartValidationStats(interval time.Duration, bufferSize int) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultValidationStatsInterval
+	}
+	if bufferSize <= 0 {
+		bufferSize = DefaultValidationStatsBuffer
+	}
+	aggregator := &validationStatsAggregator{
+		queue:   make(chan validationSample, bufferSize),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+	}
+	s.validationStats = aggregator
+
+	go func() {
+		defer close(aggregator.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		pending := make(map[string]*ValidationStatsDay)
+		for {
+			select {
+			case sample, ok := <-aggregator.queue:
+				if !ok {
+					if err := s.writeValidationStats(pending); err != nil {
+						s.GetLogger().Warnf("No se pudieron guardar las estadísticas de validación: %v", err)
+					}
+					return
+				}
+				aggregateValidationSample(pending, sample)
+			case <-ticker.C:
+				if err := s.writeValidationStats(pending); err != nil {
+					s.GetLogger().Warnf("No se pudieron guardar las estadísticas de validación: %v", err)
+				}
+			case reply := <-aggregator.flushes:
+				for len(aggregator.queue) > 0 {
+					aggregateValidationSample(pending, <-aggregator.queue)
+				}
+				reply <- s.writeValidationStats(pending)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			aggregator.mu.Lock()
+			aggregator.closed = true
+			close(aggregator.queue)
+			aggregator.mu.Unlock()
+			<-aggregator.done
+		})
+	}
+}
+
+// recordValidationErrors encola los errores de una validación fallida sin bloquear;
+// sin agregador configurado no hace nada
+func (s *UBLConverterService) recordValidationErrors(ruc string, errors []ValidationError) {
+	aggregator := s.validationStats
+	if aggregator == nil || len(errors) == 0 {
+		return
+	}
+	if !rucPattern.MatchString(ruc) {
+		ruc = unknownIssuer
+	}
+	sample := validationSample{ruc: ruc, date: s.clock.Now().Format("2006-01-02"), errors: errors}
+
+	aggregator.mu.RLock()
+	defer aggregator.mu.RUnlock()
+	if aggregator.closed {
+		return
+	}
+	select {
+	case aggregator.queue <- sample:
+	default:
+		atomic.AddInt64(&aggregator.dropped, 1)
+	}
+}
+
+// FlushValidationStats escribe en el store los conteos que aún están en memoria
+func (s *UBLConverterService) FlushValidationStats() error {
+	aggregator := s.validationStats
+	if aggregator == nil {
+		return nil
+	}
+	reply := make(chan error, 1)
+	select {
+	case aggregator.flushes <- reply:
+		return <-reply
+	case <-aggregator.done:
+		return nil
+	}
+}
+
+// aggregateValidationSample suma la muestra a los conteos pendientes del emisor y día
+func aggregateValidationSample(pending map[string]*ValidationStatsDay, sample validationSample) {
+	key := sample.ruc + "|" + sample.date
+	day, ok := pending[key]
+	if !ok {
+		day = &ValidationStatsDay{RUC: sample.ruc, Date: sample.date, Rules: make(map[string]*ValidationRuleStats)}
+		pending[key] = day
+	}
+	for _, validationErr := range sample.errors {
+		example := ValidationExample{Field: validationErr.Field, Received: anonymizeValue(validationErr.Received)}
+		mergeRuleStats(day.Rules, ValidationRuleStats{Rule: validationErr.Rule, Count: 1, Examples: []ValidationExample{example}})
+	}
+}
+
+// mergeRuleStats suma los conteos de stats a los de la regla y agrega sus ejemplos que
+// aún no estén, hasta maxValidationExamples
+func mergeRuleStats(rules map[string]*ValidationRuleStats, stats ValidationRuleStats) {
+	rule, ok := rules[stats.Rule]
+	if !ok {
+		rule = &ValidationRuleStats{Rule: stats.Rule}
+		rules[stats.Rule] = rule
+	}
+	rule.Count += stats.Count
+	for _, example := range stats.Examples {
+		if len(rule.Examples) >= maxValidationExamples {
+			break
+		}
+		duplicate := false
+		for _, existing := range rule.Examples {
+			duplicate = duplicate || existing == example
+		}
+		if !duplicate {
+			rule.Examples = append(rule.Examples, example)
+		}
+	}
+}
+
+// writeValidationStats suma los conteos pendientes a los archivos diarios del store.
+// Lo que no se pudo escribir queda pendiente para el siguiente intento.
+func (s *UBLConverterService) writeValidationStats(pending map[string]*ValidationStatsDay) error {
+	var firstErr error
+	for key, day := range pending {
+		name := ValidationStatsName(day.RUC, day.Date)
+		stored := ValidationStatsDay{RUC: day.RUC, Date: day.Date, Rules: make(map[string]*ValidationRuleStats)}
+		if data, err := s.store.Read(name); err == nil {
+			if err := json.Unmarshal(data, &stored); err != nil {
+				s.GetLogger().Warnf("Estadísticas de validación ilegibles en %s, se reemplazan: %v", name, err)
+				stored.Rules = make(map[string]*ValidationRuleStats)
+			}
+		}
+		for _, rule := range day.Rules {
+			mergeRuleStats(stored.Rules, *rule)
+		}
+		data, err := json.Marshal(stored)
+		if err == nil {
+			_, err = s.store.Save(name, data)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(pending, key)
+	}
+	return firstErr
+}
+
+// anonymizeValue conserva el formato del valor recibido sin sus datos: los dígitos se
+// reemplazan por 9, las letras por X o x, y el resto de caracteres se mantiene
+func anonymizeValue(value string) string {
+	var b strings.Builder
+	length := 0
+	for _, r := range value {
+		if length == maxExampleLength {
+			b.WriteString("…")
+			break
+		}
+		switch {
+		case unicode.IsDigit(r):
+			b.WriteRune('9')
+		case unicode.IsUpper(r):
+			b.WriteRune('X')
+		case unicode.IsLetter(r):
+			b.WriteRune('x')
+		default:
+			b.WriteRune(r)
+		}
+		length++
+	}
+	return b.String()
+}
+
+// ValidationReport retorna el ranking de las reglas de validación que más fallan, de
+// mayor a menor cantidad, para el emisor (todos si ruc es vacío) entre from y to
+// (YYYY-MM-DD, ambos opcionales e inclusive). Antes escribe lo pendiente en memoria.
+func (s *UBLConverterService) ValidationReport(ruc, from, to string) (*ValidationReport, error) {
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return nil, &ErrInvalidReportRange{Message: fmt.Sprintf("invalid date %q, expected YYYY-MM-DD", date)}
+		}
+	}
+	if from != "" && to != "" && from > to {
+		return nil, &ErrInvalidReportRange{Message: "from must not be after to"}
+	}
+	if err := s.FlushValidationStats(); err != nil {
+		s.GetLogger().Warnf("No se pudieron guardar las estadísticas de validación: %v", err)
+	}
+
+	names, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	rules := make(map[string]*ValidationRuleStats)
+	for _, name := range names {
+		fileRUC, date, ok := parseValidationStatsName(name)
+		if !ok || (ruc != "" && fileRUC != ruc) || (from != "" && date < from) || (to != "" && date > to) {
+			continue
+		}
+		data, err := s.store.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		var day ValidationStatsDay
+		if err := json.Unmarshal(data, &day); err != nil {
+			s.GetLogger().Warnf("Estadísticas de validación ilegibles en %s: %v", name, err)
+			continue
+		}
+		for _, rule := range day.Rules {
+			mergeRuleStats(rules, *rule)
+		}
+	}
+
+	report := &ValidationReport{RUC: ruc, From: from, To: to, Rules: []ValidationRuleStats{}}
+	for _, rule := range rules {
+		report.Total += rule.Count
+		report.Rules = append(report.Rules, *rule)
+	}
+	sort.Slice(report.Rules, func(i, j int) bool {
+		if report.Rules[i].Count != report.Rules[j].Count {
+			return report.Rules[i].Count > report.Rules[j].Count
+		}
+		return report.Rules[i].Rule < report.Rules[j].Rule
+	})
+	return report, nil
+}
+
+// WriteValidationStatsMetrics escribe en formato de texto de Prometheus las muestras de
+// validación descartadas por buffer lleno
+func (s *UBLConverterService) WriteValidationStatsMetrics(w io.Writer) {
+	var dropped int64
+	if s.validationStats != nil {
+		dropped = atomic.LoadInt64(&s.validationStats.dropped)
+	}
+	fmt.Fprintln(w, "# HELP validation_stats_dropped_total Validaciones fallidas que no se contabilizaron por buffer lleno")
+	fmt.Fprintln(w, "# TYPE validation_stats_dropped_total counter")
+	fmt.Fprintf(w, "validation_stats_dropped_total %d\n", dropped)
+}
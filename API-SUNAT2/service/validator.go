@@ -4,18 +4,86 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"API-SUNAT2/catalog"
 	. "API-SUNAT2/model"
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultIGVRate es la tasa de IGV vigente en porcentaje
+const DefaultIGVRate = 18.0
+
+// Modos de la verificación de la tasa de IGV vigente en la fecha de emisión
+const (
+	IGVRateCheckError   = "error"
+	IGVRateCheckWarning = "warning"
+)
+
 type ValidationService struct {
-	logger *logrus.Logger
+	logger               *logrus.Logger
+	igvRates             []catalog.IGVRate
+	igvRateCheck         string
+	maxObservations      int
+	maxObservationLength int
+	// classificationIssuers son los emisores obligados a indicar el código de producto
+	classificationIssuers map[string]bool
+	// lineWorkers es la cantidad de goroutines que validan las líneas; 0 usa GOMAXPROCS
+	lineWorkers int
+	// boletaIdentificationCheck es error, warning u off para las boletas sobre el umbral
+	// sin cliente identificado
+	boletaIdentificationCheck string
+	boletaThresholds          []catalog.BoletaIdentificationThreshold
+	// issueDateCheck es error, warning u off para las fechas de emisión incoherentes con
+	// el documento modificado o la caída declarada; noteMaxDays es el plazo de las notas
+	issueDateCheck string
+	noteMaxDays    int
 }
 
 func NewValidationService(logger *logrus.Logger) *ValidationService {
-	return &ValidationService{logger: logger}
+	return &ValidationService{
+		logger:               logger,
+		igvRates:             catalog.IGVRates,
+		igvRateCheck:         IGVRateCheckError,
+		maxObservations:      DefaultMaxObservations,
+		maxObservationLength: DefaultMaxObservationLength,
+		boletaIdentificationCheck: BoletaIdentificationError,
+		boletaThresholds:          catalog.BoletaIdentificationThresholds,
+		issueDateCheck:            IssueDateCheckError,
+		noteMaxDays:               DefaultNoteMaxDays,
+	}
+}
+
+// SetIGVRate fija la tasa de IGV admitida para cualquier fecha de emisión, en lugar
+// de la tabla de tasas vigentes
+func (v *ValidationService) SetIGVRate(rate float64) {
+	if rate > 0 {
+		v.igvRates = []catalog.IGVRate{{From: "0001-01-01", Rate: rate}}
+	}
+}
+
+// SetIGVRates configura la tabla de tasas de IGV por fecha de inicio de vigencia
+func (v *ValidationService) SetIGVRates(rates []catalog.IGVRate) {
+	if len(rates) == 0 {
+		return
+	}
+	sorted := append([]catalog.IGVRate(nil), rates...)
+	catalog.SortIGVRates(sorted)
+	v.igvRates = sorted
+}
+
+// SetIGVRateCheck configura si una tasa de IGV distinta a la vigente es un error o
+// un warning; valores desconocidos se ignoran
+func (v *ValidationService) SetIGVRateCheck(mode string) {
+	if mode == IGVRateCheckError || mode == IGVRateCheckWarning {
+		v.igvRateCheck = mode
+	}
+}
+
+// IGVRateAt retorna la tasa de IGV vigente en la fecha de emisión
+func (v *ValidationService) IGVRateAt(issueDate string) float64 {
+	return catalog.IGVRateAt(v.igvRates, issueDate)
 }
 
 func (v *ValidationService) ValidateBusinessDocument(doc *BusinessDocument) []ValidationError {
@@ -24,14 +92,128 @@ func (v *ValidationService) ValidateBusinessDocument(doc *BusinessDocument) []Va
 	// Validar RUC
 	if !v.isValidRUC(doc.Issuer.DocumentID) {
 		errors = append(errors, ValidationError{
-			Field:    "issuer.documentId",
-			Expected: "Valid RUC format",
-			Received: doc.Issuer.DocumentID,
-			Rule:     "ruc_validation",
-			Message:  "RUC format is invalid",
+			Field:      "issuer.documentId",
+			Expected:   "Valid RUC format",
+			Received:   doc.Issuer.DocumentID,
+			Rule:       "ruc_validation",
+			Message:    "RUC format is invalid",
+			Suggestion: rucSuggestion(doc.Issuer.DocumentID),
+		})
+	}
+
+	// Validar ubigeo: obligatorio para el emisor, opcional para el cliente
+	if !v.isValidUbigeo(doc.Issuer.Address.Ubigeo) {
+		errors = append(errors, ValidationError{
+			Field:    "issuer.address.ubigeo",
+			Expected: "6-digit INEI ubigeo code",
+			Received: doc.Issuer.Address.Ubigeo,
+			Rule:     "ubigeo_validation",
+			Message:  "Issuer ubigeo is required and must have 6 digits",
+		})
+	}
+	if doc.Customer.Address.Ubigeo != "" && !v.isValidUbigeo(doc.Customer.Address.Ubigeo) {
+		errors = append(errors, ValidationError{
+			Field:    "customer.address.ubigeo",
+			Expected: "6-digit INEI ubigeo code",
+			Received: doc.Customer.Address.Ubigeo,
+			Rule:     "ubigeo_validation",
+			Message:  "Customer ubigeo must have 6 digits",
 		})
 	}
 
+	// Validar los datos de contacto, opcionales en ambas partes
+	errors = append(errors, validateContact("issuer", doc.Issuer)...)
+	errors = append(errors, validateContact("customer", doc.Customer)...)
+
+	// Validar placa vehicular
+	if doc.VehiclePlate != "" && !v.isValidVehiclePlate(doc.VehiclePlate) {
+		errors = append(errors, ValidationError{
+			Field:    "vehiclePlate",
+			Expected: "Peruvian plate format (ABC-123, A1B-123 or 1234-AB)",
+			Received: doc.VehiclePlate,
+			Rule:     "vehicle_plate_validation",
+			Message:  "Vehicle plate format is invalid",
+		})
+	}
+
+	// Validar boletas canjeadas
+	if len(doc.ExchangedDocuments) > 0 && doc.Type != "01" {
+		errors = append(errors, ValidationError{
+			Field:    "exchangedDocuments",
+			Expected: "Document type 01",
+			Received: doc.Type,
+			Rule:     "exchange_validation",
+			Message:  "Only invoices can exchange boletas",
+		})
+	}
+	seenExchanged := make(map[string]bool)
+	for i, exchanged := range doc.ExchangedDocuments {
+		if exchanged.DocumentType != "03" {
+			errors = append(errors, ValidationError{
+				Field:    fmt.Sprintf("exchangedDocuments[%d].documentType", i),
+				Expected: "03",
+				Received: exchanged.DocumentType,
+				Rule:     "exchange_validation",
+				Message:  "Only boletas (03) can be exchanged",
+			})
+		}
+		if !v.isValidSeriesNumber(exchanged.DocumentID) {
+			errors = append(errors, ValidationError{
+				Field:    fmt.Sprintf("exchangedDocuments[%d].documentId", i),
+				Expected: "SERIE-NUMERO",
+				Received: exchanged.DocumentID,
+				Rule:     "exchange_validation",
+				Message:  "Exchanged document ID must have the series-number format",
+			})
+		}
+		if seenExchanged[exchanged.DocumentID] {
+			errors = append(errors, ValidationError{
+				Field:    fmt.Sprintf("exchangedDocuments[%d].documentId", i),
+				Expected: "Unique document",
+				Received: exchanged.DocumentID,
+				Rule:     "exchange_validation",
+				Message:  "Exchanged document is duplicated",
+			})
+		}
+		seenExchanged[exchanged.DocumentID] = true
+	}
+
+	// Validar serie: numérica solo para comprobantes de contingencia
+	isNumericSeries := v.isContingencySeries(doc.Series)
+	if doc.Contingency && !isNumericSeries {
+		errors = append(errors, ValidationError{
+			Field:    "series",
+			Expected: "4-digit numeric contingency series (e.g. 0001)",
+			Received: doc.Series,
+			Rule:     "contingency_series_validation",
+			Message:  "Contingency documents must use a numeric series",
+		})
+	}
+	if !doc.Contingency && isNumericSeries {
+		errors = append(errors, ValidationError{
+			Field:    "contingency",
+			Expected: "true for numeric series",
+			Received: "false",
+			Rule:     "contingency_series_validation",
+			Message:  "Numeric series are reserved for contingency documents",
+		})
+	}
+
+	// Validar el formato de la serie según el tipo de documento
+	if !isNumericSeries && v.isValidDocumentType(doc.Type) && !v.isValidSeries(doc.Type, doc.Series) {
+		errors = append(errors, ValidationError{
+			Field:      "series",
+			Expected:   seriesExpectation(doc.Type),
+			Received:   doc.Series,
+			Rule:       "series_validation",
+			Message:    "Series format is invalid for the document type",
+			Suggestion: seriesSuggestion(doc.Type, doc.Series),
+		})
+	}
+
+	// Validar el correlativo
+	errors = append(errors, v.validateNumber(doc)...)
+
 	// Validar tipo de documento
 	if !v.isValidDocumentType(doc.Type) {
 		errors = append(errors, ValidationError{
@@ -43,63 +225,134 @@ func (v *ValidationService) ValidateBusinessDocument(doc *BusinessDocument) []Va
 		})
 	}
 
+	// Validar motivo de la nota contra el catálogo 09 (crédito) o 10 (débito)
+	if doc.Type == "07" || doc.Type == "08" {
+		catalogName := "catalog 09"
+		if doc.Type == "08" {
+			catalogName = "catalog 10"
+		}
+		for i, ref := range noteReferences(doc) {
+			if _, ok := lookupNoteReason(doc.Type, noteReasonCode(&ref)); !ok {
+				errors = append(errors, ValidationError{
+					Field:    referenceField(doc, i) + ".reasonCode",
+					Expected: fmt.Sprintf("Reason code from %s", catalogName),
+					Received: ref.ReasonCode,
+					Rule:     "note_reason_validation",
+					Message:  "Note reason code is not valid",
+				})
+			}
+		}
+	}
+
+	// Validar las referencias de una nota consolidada
+	errors = append(errors, v.validateNoteReferences(doc)...)
+
+	// Validar los anticipos que regulariza la factura
+	errors = append(errors, v.validateAdvances(doc)...)
+
 	// Validar moneda
 	if !v.isValidCurrency(doc.Currency) {
 		errors = append(errors, ValidationError{
-			Field:    "currency",
-			Expected: "Valid currency code (PEN, USD, EUR)",
-			Received: doc.Currency,
-			Rule:     "currency_validation",
-			Message:  "Currency code is not valid",
+			Field:      "currency",
+			Expected:   "Valid currency code (PEN, USD, EUR)",
+			Received:   doc.Currency,
+			Rule:       "currency_validation",
+			Message:    "Currency code is not valid",
+			Suggestion: v.currencySuggestion(doc.Currency),
 		})
 	}
 
 	// Validar totales
 	calculatedTotal := v.calculateTotal(doc)
-	if calculatedTotal != doc.Totals.TotalAmount {
+	if Decimal2(calculatedTotal).Round() != Decimal2(doc.Totals.TotalAmount).Round() {
 		errors = append(errors, ValidationError{
-			Field:    "totals.totalAmount",
-			Expected: fmt.Sprintf("%.2f", calculatedTotal),
-			Received: fmt.Sprintf("%.2f", doc.Totals.TotalAmount),
-			Rule:     "sum_validation",
-			Message:  "Total amount calculation mismatch",
+			Field:      "totals.totalAmount",
+			Expected:   fmt.Sprintf("%.2f", calculatedTotal),
+			Received:   fmt.Sprintf("%.2f", doc.Totals.TotalAmount),
+			Rule:       "sum_validation",
+			Message:    "Total amount calculation mismatch",
+			Suggestion: v.totalSuggestion(doc, calculatedTotal),
 		})
 	}
 
 	// Validar fecha
 	if !v.isValidDate(doc.IssueDate) {
 		errors = append(errors, ValidationError{
-			Field:    "issueDate",
-			Expected: "Valid date format YYYY-MM-DD",
-			Received: doc.IssueDate,
-			Rule:     "date_validation",
-			Message:  "Issue date format is invalid",
+			Field:      "issueDate",
+			Expected:   "Valid date format YYYY-MM-DD",
+			Received:   doc.IssueDate,
+			Rule:       "date_validation",
+			Message:    "Issue date format is invalid",
+			Suggestion: dateSuggestion(doc.IssueDate),
 		})
 	}
 
-	// Validar items
-	for i, item := range doc.Items {
-		if item.Quantity <= 0 {
-			errors = append(errors, ValidationError{
-				Field:    fmt.Sprintf("items[%d].quantity", i),
-				Expected: "Greater than 0",
-				Received: fmt.Sprintf("%.2f", item.Quantity),
-				Rule:     "quantity_validation",
-				Message:  "Quantity must be greater than 0",
-			})
-		}
+	// Validar el día de la caída y la coherencia de la fecha de emisión con el documento
+	// modificado y la caída; en modo warning la coherencia se advierte aparte
+	errors = append(errors, v.validateContingencyDate(doc)...)
+	if v.issueDateCheck == IssueDateCheckError {
+		errors = append(errors, v.checkIssueDateCoherence(doc)...)
+	}
 
-		if item.UnitPrice <= 0 {
-			errors = append(errors, ValidationError{
-				Field:    fmt.Sprintf("items[%d].unitPrice", i),
-				Expected: "Greater than 0",
-				Received: fmt.Sprintf("%.2f", item.UnitPrice),
-				Rule:     "price_validation",
-				Message:  "Unit price must be greater than 0",
-			})
-		}
+	// Validar vencimiento y forma de pago
+	errors = append(errors, v.validatePaymentTerms(doc)...)
+
+	// Validar las cuentas del emisor
+	errors = append(errors, v.validatePaymentMeans(doc)...)
+
+	// Validar la percepción
+	errors = append(errors, v.validatePerception(doc)...)
+
+	// Validar el tipo de operación contra los tributos, la percepción y las cuentas
+	errors = append(errors, v.validateOperationType(doc)...)
+
+	// Validar el cálculo del ISC según su sistema
+	errors = append(errors, v.validateISC(doc)...)
+
+	// Validar los descuentos de línea y global
+	errors = append(errors, v.validateDiscounts(doc)...)
+
+	// Validar los valores de las claves de additional
+	errors = append(errors, v.validateAdditional(doc)...)
+
+	// Validar que las líneas gratuitas no sumen al total a pagar
+	errors = append(errors, v.validateFreeLines(doc)...)
+
+	// Validar el detalle turístico de las líneas
+	errors = append(errors, v.validateTourismDetails(doc)...)
+
+	// Validar el código de producto SUNAT de las líneas
+	errors = append(errors, v.validateClassificationCodes(doc)...)
+
+	// Validar las observaciones libres
+	errors = append(errors, v.validateObservations(doc)...)
+
+	// Validar porcentajes de los tributos; en modo warning la tasa de IGV se advierte aparte
+	rateErrors, igvIssues := v.validateTaxRates(doc)
+	errors = append(errors, rateErrors...)
+	if v.igvRateCheck != IGVRateCheckWarning {
+		errors = append(errors, igvIssues...)
+	}
+
+	// Validar que la boleta sobre el umbral identifique al cliente; en modo warning se advierte aparte
+	if v.boletaIdentificationCheck == BoletaIdentificationError {
+		errors = append(errors, v.checkBoletaIdentification(doc)...)
+	}
+
+	// Validar que el comprobante tenga al menos una línea a emitir
+	if len(documentLines(doc)) == 0 {
+		errors = append(errors, ValidationError{
+			Field:    "items",
+			Expected: "At least one non-informative item",
+			Received: strconv.Itoa(len(doc.Items)),
+			Rule:     "items_required_validation",
+			Message:  "Document must have at least one line",
+		})
 	}
 
+	// Validar items; con muchas líneas se reparten entre varias goroutines
+	errors = append(errors, v.validateItems(doc)...)
+
 	return errors
 }
 
@@ -110,10 +363,16 @@ func (v *ValidationService) isValidRUC(ruc string) bool {
 	if matched, _ := regexp.MatchString(`^\d{11}$`, ruc); !matched {
 		return false
 	}
+	lastDigit, _ := strconv.Atoi(string(ruc[10]))
+	return rucCheckDigit(ruc[:10]) == lastDigit
+}
+
+// rucCheckDigit calcula el dígito verificador (módulo 11) de los 10 primeros dígitos del RUC
+func rucCheckDigit(digits string) int {
 	weights := []int{5, 4, 3, 2, 7, 6, 5, 4, 3, 2}
 	sum := 0
 	for i := 0; i < 10; i++ {
-		digit, _ := strconv.Atoi(string(ruc[i]))
+		digit, _ := strconv.Atoi(string(digits[i]))
 		sum += digit * weights[i]
 	}
 	remainder := sum % 11
@@ -123,8 +382,147 @@ func (v *ValidationService) isValidRUC(ruc string) bool {
 	} else if checkDigit == 10 {
 		checkDigit = 1
 	}
-	lastDigit, _ := strconv.Atoi(string(ruc[10]))
-	return checkDigit == lastDigit
+	return checkDigit
+}
+
+func (v *ValidationService) isValidUbigeo(ubigeo string) bool {
+	matched, _ := regexp.MatchString(`^\d{6}$`, ubigeo)
+	return matched
+}
+
+// contactEmailPattern y contactTelephonePattern son los formatos del correo y el
+// teléfono de contacto de una parte
+const (
+	contactEmailPattern     = `^[^@\s]+@[^@\s]+\.[^@\s]+$`
+	contactTelephonePattern = `^\+?[0-9][0-9 ()-]{5,19}$`
+)
+
+// validateContact valida el formato del correo y el teléfono de contacto de la parte
+// indicada en field ("issuer" o "customer")
+func validateContact(field string, party Party) []ValidationError {
+	var errors []ValidationError
+	if party.Email != "" {
+		if matched, _ := regexp.MatchString(contactEmailPattern, party.Email); !matched {
+			errors = append(errors, ValidationError{
+				Field:    field + ".email",
+				Expected: "Email address (user@domain.tld)",
+				Received: party.Email,
+				Rule:     "contact_validation",
+				Message:  "Contact email format is invalid",
+			})
+		}
+	}
+	if party.Telephone != "" {
+		if matched, _ := regexp.MatchString(contactTelephonePattern, party.Telephone); !matched {
+			errors = append(errors, ValidationError{
+				Field:    field + ".telephone",
+				Expected: "6 to 20 digits, optionally with +, spaces, dashes or parentheses",
+				Received: party.Telephone,
+				Rule:     "contact_validation",
+				Message:  "Contact telephone format is invalid",
+			})
+		}
+	}
+	return errors
+}
+
+func (v *ValidationService) isValidVehiclePlate(plate string) bool {
+	plate = strings.ToUpper(plate)
+	if matched, _ := regexp.MatchString(`^[A-Z][A-Z0-9]{2}-?\d{3}$`, plate); matched {
+		return true
+	}
+	matched, _ := regexp.MatchString(`^\d{4}-?[A-Z]{2}$`, plate)
+	return matched
+}
+
+func (v *ValidationService) isContingencySeries(series string) bool {
+	matched, _ := regexp.MatchString(`^\d{4}$`, series)
+	return matched
+}
+
+// isValidSeries verifica la serie electrónica: 4 caracteres alfanuméricos que empiezan
+// con F para facturas, B para boletas y F o B para las notas
+func (v *ValidationService) isValidSeries(docType, series string) bool {
+	if !isSeriesFormat(series) {
+		return false
+	}
+	switch docType {
+	case "01":
+		return series[0] == 'F'
+	case "03":
+		return series[0] == 'B'
+	}
+	return true
+}
+
+func (v *ValidationService) isValidSeriesNumber(id string) bool {
+	matched, _ := regexp.MatchString(`^[A-Z0-9]{4}-\d{1,8}$`, id)
+	return matched
+}
+
+// IGVRateWarnings retorna como warnings las tasas de IGV distintas a la vigente en la
+// fecha de emisión cuando la verificación está en modo warning
+func (v *ValidationService) IGVRateWarnings(doc *BusinessDocument) []ValidationError {
+	if v.igvRateCheck != IGVRateCheckWarning {
+		return nil
+	}
+	_, igvIssues := v.validateTaxRates(doc)
+	return igvIssues
+}
+
+// validateTaxRates valida los porcentajes de los tributos del documento y de sus líneas.
+// Retorna por separado las tasas de IGV que no son la vigente en la fecha de emisión.
+func (v *ValidationService) validateTaxRates(doc *BusinessDocument) (errors, igvIssues []ValidationError) {
+	for i, tax := range doc.Taxes {
+		v.checkTaxRate(doc, func() string { return fmt.Sprintf("taxes[%d].taxRate", i) }, tax.TaxType, float64(tax.TaxRate), &errors, &igvIssues)
+	}
+
+	// Las tasas de las líneas se verifican por tramos, como el resto de la validación por línea
+	lineErrors := make([][]ValidationError, v.lineWorkerCount(len(doc.Items)))
+	lineIGVIssues := make([][]ValidationError, len(lineErrors))
+	v.forEachLineRange(len(doc.Items), func(chunk int, r lineRange) {
+		for i := r.start; i < r.end; i++ {
+			for j, tax := range doc.Items[i].Taxes {
+				i, j := i, j
+				field := func() string { return fmt.Sprintf("items[%d].taxes[%d].taxRate", i, j) }
+				v.checkTaxRate(doc, field, tax.TaxType, float64(tax.TaxRate), &lineErrors[chunk], &lineIGVIssues[chunk])
+			}
+		}
+	})
+	return append(errors, concatErrors(lineErrors)...), append(igvIssues, concatErrors(lineIGVIssues)...)
+}
+
+// checkTaxRate verifica la tasa de un tributo; la de IGV se reporta en igvIssues para
+// poder advertirla en lugar de rechazar. El campo se arma solo si hay error.
+func (v *ValidationService) checkTaxRate(doc *BusinessDocument, field func() string, taxType string, rate float64, errors, igvIssues *[]ValidationError) {
+	expected, ok := v.allowedTaxRate(taxType, doc.IssueDate)
+	if !ok || Decimal2(rate).Round() == expected {
+		return
+	}
+	issue := ValidationError{
+		Field:    field(),
+		Expected: Decimal2(expected).String(),
+		Received: Decimal2(rate).String(),
+		Rule:     "tax_rate_validation",
+		Message:  "Tax rate is not allowed for the tax type",
+	}
+	if taxType == "1000" {
+		issue.Message = fmt.Sprintf("IGV rate is not the one in force on %s", doc.IssueDate)
+		*igvIssues = append(*igvIssues, issue)
+		return
+	}
+	*errors = append(*errors, issue)
+}
+
+func (v *ValidationService) allowedTaxRate(taxType, issueDate string) (float64, bool) {
+	switch taxType {
+	case "1000": // IGV
+		return Decimal2(v.IGVRateAt(issueDate)).Round(), true
+	case "9995", "9996", "9997", "9998": // Exportación, gratuito, exonerado, inafecto
+		return 0, true
+	default:
+		return 0, false
+	}
 }
 
 func (v *ValidationService) isValidDocumentType(docType string) bool {
@@ -154,7 +552,10 @@ func (v *ValidationService) isValidDate(dateStr string) bool {
 func (v *ValidationService) calculateTotal(doc *BusinessDocument) float64 {
 	total := doc.Totals.SubTotal
 	for _, tax := range doc.Taxes {
-		total += tax.TaxAmount
+		// El tributo de las gratuitas no suma al total
+		if tax.TaxType != FreeTaxType {
+			total += tax.TaxAmount
+		}
 	}
-	return total
+	return float64(total)
 } 
\ No newline at end of file
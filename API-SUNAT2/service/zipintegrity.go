@@ -0,0 +1,82 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	. "API-SUNAT2/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ZIPReferenceGenerated identifica el hash registrado al generar el documento
+const ZIPReferenceGenerated = "generated"
+
+// CheckZIPIntegrity compara el ZIP en disco de cada documento o resumen (o solo el de
+// documentID si no viene vacío) con el hash registrado al generarlo y con el de cada
+// envío a SUNAT, y registra un error por cada discrepancia. Los documentos purgados no
+// tienen ZIP y se omiten.
+func (s *UBLConverterService) CheckZIPIntegrity(documentID string) (*ZIPIntegrityReport, error) {
+	if documentID != "" {
+		documentID = CanonicalDocumentID(documentID)
+	}
+	report := &ZIPIntegrityReport{Issues: []ZIPIntegrityIssue{}}
+	purged := map[string]bool{}
+
+	check := func(id, reference, expectedHash string, expectedSize int64) {
+		if expectedHash == "" || purged[id] || (documentID != "" && id != documentID) {
+			return
+		}
+		report.Checked++
+		issue := ZIPIntegrityIssue{DocumentID: id, Reference: reference, ExpectedHash: expectedHash, ExpectedSize: expectedSize}
+		zipData, err := s.store.Read(id + ".zip")
+		if err != nil {
+			issue.Message = "ZIP file is missing"
+		} else {
+			hash := sha256.Sum256(zipData)
+			issue.ActualHash, issue.ActualSize = hex.EncodeToString(hash[:]), int64(len(zipData))
+			if issue.ActualHash == expectedHash {
+				return
+			}
+			issue.Message = "ZIP file changed after it was registered"
+		}
+		report.Issues = append(report.Issues, issue)
+		s.GetLogger().WithFields(logrus.Fields{
+			"document_id": id,
+			"reference":   reference,
+			"expected":    expectedHash,
+			"actual":      issue.ActualHash,
+		}).Errorf("El ZIP de %s no corresponde al hash registrado (%s)", id, reference)
+	}
+
+	err := s.readJSONRecords(RecordSuffix, func(name string, data []byte) error {
+		var record DocumentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("invalid document record %s: %v", name, err)
+		}
+		if record.PurgedAt != nil {
+			purged[record.DocumentID] = true
+			return nil
+		}
+		check(record.DocumentID, ZIPReferenceGenerated, record.ZIPHash, record.ZIPSize)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.readJSONRecords(".envio", func(name string, data []byte) error {
+		var submission SubmissionRecord
+		if err := json.Unmarshal(data, &submission); err != nil {
+			return fmt.Errorf("invalid submission record %s: %v", name, err)
+		}
+		check(submission.DocumentID, submission.Environment, submission.ZIPHash, submission.ZIPSize)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
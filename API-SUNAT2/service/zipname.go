@@ -0,0 +1,72 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// StandardZIPFileName es la plantilla del nombre del ZIP que exige SUNAT; es también el
+// nombre con que se archiva el ZIP en el store
+const StandardZIPFileName = "{ruc}-{tipo}-{serie}-{numero}.zip"
+
+// ZIPTimestampLayout es el formato del placeholder {timestamp}, en hora de Lima
+const ZIPTimestampLayout = "20060102T150405"
+
+var zipNamePlaceholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// zipNamePlaceholders son los placeholders que acepta la plantilla del nombre del ZIP
+var zipNamePlaceholders = map[string]bool{
+	"ruc": true, "tipo": true, "serie": true, "numero": true, "timestamp": true,
+}
+
+// ZIPFileNamer es la estrategia de nombrado del ZIP que se envía a un proveedor (SUNAT
+// u OSE). Solo cambia el nombre del archivo adjunto al SOAP: el ZIP archivado y el XML
+// que contiene conservan el nombre estándar.
+type ZIPFileNamer struct {
+	template string
+}
+
+// NewZIPFileNamer valida la plantilla, con los placeholders {ruc}, {tipo}, {serie},
+// {numero} y {timestamp}. Vacía usa el nombre estándar; si no termina en .zip se agrega.
+func NewZIPFileNamer(template string) (*ZIPFileNamer, error) {
+	template = strings.TrimSpace(template)
+	if template == "" {
+		template = StandardZIPFileName
+	}
+	if strings.ContainsAny(template, `/\`) {
+		return nil, fmt.Errorf("zip file name template %q must not contain a path", template)
+	}
+	for _, match := range zipNamePlaceholderPattern.FindAllStringSubmatch(template, -1) {
+		if !zipNamePlaceholders[match[1]] {
+			return nil, fmt.Errorf("zip file name template %q has unknown placeholder {%s}", template, match[1])
+		}
+	}
+	if rest := zipNamePlaceholderPattern.ReplaceAllString(template, ""); strings.ContainsAny(rest, "{}") {
+		return nil, fmt.Errorf("zip file name template %q has an unclosed placeholder", template)
+	}
+	if !strings.HasSuffix(strings.ToLower(template), ".zip") {
+		template += ".zip"
+	}
+	return &ZIPFileNamer{template: template}, nil
+}
+
+// Name retorna el nombre del ZIP del documento (RUC-TIPO-SERIE-NUMERO) enviado en at.
+// Un identificador con otro formato se retorna con la extensión .zip.
+func (n *ZIPFileNamer) Name(documentID string, at time.Time) string {
+	parts := documentIDPattern.FindStringSubmatch(documentID)
+	if n == nil || parts == nil {
+		return documentID + ".zip"
+	}
+	values := map[string]string{
+		"ruc":       parts[1],
+		"tipo":      parts[2],
+		"serie":     parts[3],
+		"numero":    parts[4],
+		"timestamp": at.In(LimaLocation).Format(ZIPTimestampLayout),
+	}
+	return zipNamePlaceholderPattern.ReplaceAllStringFunc(n.template, func(placeholder string) string {
+		return values[strings.Trim(placeholder, "{}")]
+	})
+}
@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"API-SUNAT2/kms"
+)
+
+// DefaultDataKeyRotation es la antigüedad desde la que una data key deja de usarse para
+// cifrar y lo cifrado con ella se re-cifra al leerse
+const DefaultDataKeyRotation = 24 * time.Hour
+
+// encryptedMagic encabeza los artefactos cifrados; lo que no lo lleva es un artefacto en
+// claro de antes de activar el cifrado
+var encryptedMagic = []byte("SUNATENC1")
+
+// EncryptedPathPrefix antecede al nombre en las rutas que retorna EncryptedStore
+const EncryptedPathPrefix = "encrypted://"
+
+// ErrCorruptEncrypted es el error de un artefacto cifrado cuyo encabezado no se puede leer
+var ErrCorruptEncrypted = errors.New("corrupt encrypted artifact")
+
+// EncryptionStatus son los contadores del cifrado en reposo para las métricas
+type EncryptionStatus struct {
+	KeyID string `json:"keyId"`
+	// Reencrypted son los artefactos re-cifrados al leerse con una data key vigente
+	Reencrypted int64 `json:"reencrypted"`
+	// Rotations son las data keys generadas
+	Rotations int64 `json:"rotations"`
+}
+
+// dataKey es una data key en claro junto a su versión cifrada con la clave maestra
+type dataKey struct {
+	plaintext []byte
+	wrapped   []byte
+	keyID     string
+	created   time.Time
+}
+
+// EncryptedStore cifra los artefactos con AES-256-GCM antes de guardarlos en el store
+// envuelto. Cada artefacto lleva la data key con que se cifró, cifrada a su vez por el
+// KeyProvider (envelope encryption). La data key vigente se rota cada rotation; al leer
+// un artefacto cifrado con una data key vencida, con otra clave maestra o en claro, se
+// vuelve a guardar cifrado con la vigente.
+type EncryptedStore struct {
+	store    DocumentStore
+	keys     kms.KeyProvider
+	rotation time.Duration
+	now      func() time.Time
+
+	// writes serializa las escrituras para que un re-cifrado no pise una escritura
+	// concurrente del mismo artefacto
+	writes sync.Mutex
+
+	mu      sync.Mutex
+	current *dataKey
+	// unwrapped son las data keys ya descifradas por el proveedor, por su versión cifrada
+	unwrapped map[string][]byte
+
+	reencrypted int64
+	rotations   int64
+}
+
+// NewEncryptedStore envuelve el store; rotation <= 0 usa DefaultDataKeyRotation
+func NewEncryptedStore(store DocumentStore, keys kms.KeyProvider, rotation time.Duration) *EncryptedStore {
+	if rotation <= 0 {
+		rotation = DefaultDataKeyRotation
+	}
+	return &EncryptedStore{store: store, keys: keys, rotation: rotation, now: time.Now, unwrapped: make(map[string][]byte)}
+}
+
+// SetClock reemplaza la hora con que se vencen las data keys
+func (s *EncryptedStore) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Unwrap retorna el store envuelto
+func (s *EncryptedStore) Unwrap() DocumentStore {
+	return s.store
+}
+
+// RotateDataKey descarta la data key vigente: el siguiente artefacto se cifra con una nueva
+func (s *EncryptedStore) RotateDataKey() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = nil
+}
+
+// Status retorna los contadores del cifrado
+func (s *EncryptedStore) Status() EncryptionStatus {
+	return EncryptionStatus{
+		KeyID:       s.keys.KeyID(),
+		Reencrypted: atomic.LoadInt64(&s.reencrypted),
+		Rotations:   atomic.LoadInt64(&s.rotations),
+	}
+}
+
+func (s *EncryptedStore) Save(name string, data []byte) (string, error) {
+	encrypted, err := s.encrypt(data)
+	if err != nil {
+		return "", err
+	}
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	if _, err := s.store.Save(name, encrypted); err != nil {
+		return "", err
+	}
+	return s.Path(name), nil
+}
+
+func (s *EncryptedStore) Read(name string) ([]byte, error) {
+	raw, err := s.store.Read(name)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(raw, encryptedMagic) {
+		s.reencrypt(name, raw, raw)
+		return raw, nil
+	}
+	header, err := parseEncrypted(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	key, err := s.unwrap(header.wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	data, err := openAESGCM(key, header.nonce, header.ciphertext, raw[:header.aadLength])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if s.expired(header.keyID, header.created) {
+		s.reencrypt(name, raw, data)
+	}
+	return data, nil
+}
+
+func (s *EncryptedStore) List() ([]string, error) {
+	return s.store.List()
+}
+
+func (s *EncryptedStore) Delete(name string) error {
+	return s.store.Delete(name)
+}
+
+// Path retorna una referencia encrypted://nombre y no la ruta del store envuelto: en
+// esa ruta está el contenido cifrado, que solo se obtiene en claro con Read
+func (s *EncryptedStore) Path(name string) string {
+	return EncryptedPathPrefix + name
+}
+
+// reencrypt vuelve a guardar el artefacto con la data key vigente, salvo que haya
+// cambiado desde que se leyó raw. Es un best effort: si falla, el artefacto sigue
+// legible y se intenta en la siguiente lectura.
+func (s *EncryptedStore) reencrypt(name string, raw, data []byte) {
+	encrypted, err := s.encrypt(data)
+	if err != nil {
+		return
+	}
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	if current, err := s.store.Read(name); err != nil || !bytes.Equal(current, raw) {
+		return
+	}
+	if _, err := s.store.Save(name, encrypted); err == nil {
+		atomic.AddInt64(&s.reencrypted, 1)
+	}
+}
+
+// expired indica si la data key de un artefacto ya no es la que se usaría para cifrar:
+// es de otra clave maestra o superó la rotación
+func (s *EncryptedStore) expired(keyID string, created time.Time) bool {
+	return keyID != s.keys.KeyID() || s.now().Sub(created) >= s.rotation
+}
+
+// dataKey retorna la data key vigente, generando una nueva si no hay o venció
+func (s *EncryptedStore) dataKey() (*dataKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && !s.expired(s.current.keyID, s.current.created) {
+		return s.current, nil
+	}
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, err
+	}
+	keyID := s.keys.KeyID()
+	wrapped, err := s.keys.Encrypt(context.Background(), plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt data key: %v", err)
+	}
+	s.current = &dataKey{plaintext: plaintext, wrapped: wrapped, keyID: keyID, created: s.now()}
+	s.unwrapped[string(wrapped)] = plaintext
+	atomic.AddInt64(&s.rotations, 1)
+	return s.current, nil
+}
+
+// unwrap descifra la data key de un artefacto, consultando al proveedor solo la primera vez
+func (s *EncryptedStore) unwrap(wrapped []byte) ([]byte, error) {
+	s.mu.Lock()
+	key, ok := s.unwrapped[string(wrapped)]
+	s.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	key, err := s.keys.Decrypt(context.Background(), wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt data key: %v", err)
+	}
+	s.mu.Lock()
+	s.unwrapped[string(wrapped)] = key
+	s.mu.Unlock()
+	return key, nil
+}
+
+// encrypt arma el artefacto cifrado: encabezado (magic, creación de la data key, id de la
+// clave maestra y data key cifrada), nonce y datos cifrados. El encabezado se autentica
+// como datos adicionales.
+func (s *EncryptedStore) encrypt(data []byte) ([]byte, error) {
+	key, err := s.dataKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(key.keyID) > 0xFFFF || len(key.wrapped) > 0xFFFF {
+		return nil, errors.New("encrypted data key is too long")
+	}
+	var out bytes.Buffer
+	out.Write(encryptedMagic)
+	binary.Write(&out, binary.BigEndian, key.created.Unix())
+	binary.Write(&out, binary.BigEndian, uint16(len(key.keyID)))
+	out.WriteString(key.keyID)
+	binary.Write(&out, binary.BigEndian, uint16(len(key.wrapped)))
+	out.Write(key.wrapped)
+	aad := append([]byte(nil), out.Bytes()...)
+
+	aead, err := newAESGCM(key.plaintext)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out.Write(nonce)
+	out.Write(aead.Seal(nil, nonce, data, aad))
+	return out.Bytes(), nil
+}
+
+// encryptedArtifact es el encabezado de un artefacto cifrado
+type encryptedArtifact struct {
+	created    time.Time
+	keyID      string
+	wrapped    []byte
+	nonce      []byte
+	ciphertext []byte
+	// aadLength es la longitud del encabezado autenticado
+	aadLength int
+}
+
+func parseEncrypted(raw []byte) (*encryptedArtifact, error) {
+	r := bytes.NewReader(raw[len(encryptedMagic):])
+	var created int64
+	var keyIDLength, wrappedLength uint16
+	if err := binary.Read(r, binary.BigEndian, &created); err != nil {
+		return nil, ErrCorruptEncrypted
+	}
+	if err := binary.Read(r, binary.BigEndian, &keyIDLength); err != nil || r.Len() < int(keyIDLength) {
+		return nil, ErrCorruptEncrypted
+	}
+	keyID := make([]byte, keyIDLength)
+	r.Read(keyID)
+	if err := binary.Read(r, binary.BigEndian, &wrappedLength); err != nil || r.Len() < int(wrappedLength) {
+		return nil, ErrCorruptEncrypted
+	}
+	wrapped := make([]byte, wrappedLength)
+	r.Read(wrapped)
+	aadLength := len(raw) - r.Len()
+
+	nonceSize := 12
+	if r.Len() < nonceSize {
+		return nil, ErrCorruptEncrypted
+	}
+	rest := raw[aadLength:]
+	return &encryptedArtifact{
+		created:    time.Unix(created, 0),
+		keyID:      string(keyID),
+		wrapped:    wrapped,
+		nonce:      rest[:nonceSize],
+		ciphertext: rest[nonceSize:],
+		aadLength:  aadLength,
+	}, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func openAESGCM(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
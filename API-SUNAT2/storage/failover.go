@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// Ubicaciones de los artefactos de un FailoverStore, que también son sus modos: en
+// modo secondary las escrituras van al directorio de contingencia
+const (
+	LocationPrimary   = "primary"
+	LocationSecondary = "secondary"
+)
+
+// FailoverStatus es el estado de un FailoverStore para el health del servicio
+type FailoverStatus struct {
+	Mode string `json:"mode"`
+	// Pending son los artefactos en el secundario que esperan volver al principal
+	Pending   int    `json:"pending"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// FailoverStore escribe en el store principal y, si este falla con un error de I/O
+// (por ejemplo un volumen NFS desmontado), en el secundario de contingencia. Mientras
+// haya artefactos en el secundario las escrituras siguen yendo ahí; Resync los mueve al
+// principal cuando vuelve a responder.
+type FailoverStore struct {
+	primary, secondary DocumentStore
+
+	mu        sync.RWMutex
+	pending   map[string]bool
+	lastError string
+}
+
+// NewFailoverStore crea el store con contingencia; lo que ya hay en el secundario (de una
+// ejecución anterior) queda pendiente de re-sincronizar
+func NewFailoverStore(primary, secondary DocumentStore) *FailoverStore {
+	s := &FailoverStore{primary: primary, secondary: secondary, pending: make(map[string]bool)}
+	if names, err := secondary.List(); err == nil {
+		for _, name := range names {
+			s.pending[name] = true
+		}
+	}
+	return s
+}
+
+// IsIOError indica si el error es del sistema de archivos (escritura, apertura o un
+// errno) y no un error del contenido o de la operación
+func IsIOError(err error) bool {
+	var pathErr *fs.PathError
+	var syscallErr *os.SyscallError
+	var errno syscall.Errno
+	return errors.As(err, &pathErr) || errors.As(err, &syscallErr) || errors.As(err, &errno)
+}
+
+func (s *FailoverStore) Save(name string, data []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		path, err := s.primary.Save(name, data)
+		if err == nil || !IsIOError(err) {
+			return path, err
+		}
+		s.lastError = err.Error()
+	}
+
+	path, err := s.secondary.Save(name, data)
+	if err != nil {
+		return "", err
+	}
+	s.pending[name] = true
+	return path, nil
+}
+
+// Location retorna dónde está el artefacto: LocationPrimary o LocationSecondary
+func (s *FailoverStore) Location(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.pending[name] {
+		return LocationSecondary
+	}
+	return LocationPrimary
+}
+
+func (s *FailoverStore) Path(name string) string {
+	if s.Location(name) == LocationSecondary {
+		return s.secondary.Path(name)
+	}
+	return s.primary.Path(name)
+}
+
+func (s *FailoverStore) Read(name string) ([]byte, error) {
+	if s.Location(name) == LocationSecondary {
+		return s.secondary.Read(name)
+	}
+	return s.primary.Read(name)
+}
+
+// List retorna los artefactos de ambos directorios; con el principal caído, solo los
+// del secundario
+func (s *FailoverStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names, err := s.primary.List()
+	if err != nil && len(s.pending) == 0 {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	for name := range s.pending {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *FailoverStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending[name] {
+		if err := s.secondary.Delete(name); err != nil {
+			return err
+		}
+		delete(s.pending, name)
+	}
+	return s.primary.Delete(name)
+}
+
+// Status retorna el modo del store y los artefactos pendientes de re-sincronizar
+func (s *FailoverStore) Status() FailoverStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := FailoverStatus{Mode: LocationPrimary, Pending: len(s.pending)}
+	if len(s.pending) > 0 {
+		status.Mode = LocationSecondary
+		status.LastError = s.lastError
+	}
+	return status
+}
+
+// Resync mueve los artefactos del secundario al principal y retorna los nombres movidos.
+// Se detiene en el primer error del principal, que sigue caído; el store vuelve al modo
+// primary cuando no quedan pendientes.
+func (s *FailoverStore) Resync() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.pending))
+	for name := range s.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var moved []string
+	for _, name := range names {
+		data, err := s.secondary.Read(name)
+		if err != nil {
+			return moved, err
+		}
+		if _, err := s.primary.Save(name, data); err != nil {
+			s.lastError = err.Error()
+			return moved, err
+		}
+		if err := s.secondary.Delete(name); err != nil {
+			return moved, err
+		}
+		delete(s.pending, name)
+		moved = append(moved, name)
+	}
+	s.lastError = ""
+	return moved, nil
+}
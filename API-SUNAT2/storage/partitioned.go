@@ -0,0 +1,56 @@
+package storage
+
+import "sort"
+
+// PartitionedStore separa en otro store los artefactos que cumplen un criterio, p. ej.
+// los de los documentos de prueba, sin que el resto del servicio lo note: cada nombre
+// se lee, guarda y elimina siempre en el store que le corresponde.
+type PartitionedStore struct {
+	main        DocumentStore
+	separated   DocumentStore
+	isSeparated func(name string) bool
+}
+
+// NewPartitionedStore guarda en separated los artefactos cuyo nombre cumple isSeparated
+// y el resto en main
+func NewPartitionedStore(main, separated DocumentStore, isSeparated func(name string) bool) *PartitionedStore {
+	return &PartitionedStore{main: main, separated: separated, isSeparated: isSeparated}
+}
+
+func (s *PartitionedStore) storeFor(name string) DocumentStore {
+	if s.isSeparated(name) {
+		return s.separated
+	}
+	return s.main
+}
+
+func (s *PartitionedStore) Save(name string, data []byte) (string, error) {
+	return s.storeFor(name).Save(name, data)
+}
+
+func (s *PartitionedStore) Read(name string) ([]byte, error) {
+	return s.storeFor(name).Read(name)
+}
+
+func (s *PartitionedStore) Delete(name string) error {
+	return s.storeFor(name).Delete(name)
+}
+
+func (s *PartitionedStore) Path(name string) string {
+	return s.storeFor(name).Path(name)
+}
+
+// List retorna los artefactos de ambos stores; un store separado que todavía no existe
+// no es un error
+func (s *PartitionedStore) List() ([]string, error) {
+	names, err := s.main.List()
+	if err != nil {
+		return nil, err
+	}
+	separated, err := s.separated.List()
+	if err == nil {
+		names = append(names, separated...)
+	}
+	sort.Strings(names)
+	return names, nil
+}
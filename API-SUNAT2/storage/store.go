@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DocumentStore persiste los artefactos generados (XML firmado y ZIP)
+type DocumentStore interface {
+	// Save guarda el contenido con el nombre indicado y retorna su ruta
+	Save(name string, data []byte) (string, error)
+	// Read retorna el contenido guardado con el nombre indicado
+	Read(name string) ([]byte, error)
+	// List retorna los nombres de los artefactos guardados en orden alfabético
+	List() ([]string, error)
+	// Delete elimina el artefacto; no es un error si no existe
+	Delete(name string) error
+	// Path retorna la ruta del artefacto, la misma que retorna Save
+	Path(name string) string
+}
+
+// FileStore guarda los artefactos en un directorio del disco
+type FileStore struct {
+	basePath string
+}
+
+func NewFileStore(basePath string) *FileStore {
+	return &FileStore{basePath: basePath}
+}
+
+// Save guarda el archivo en basePath con el último elemento de name, como Read, Path y
+// Delete: un nombre con separadores no escribe fuera del directorio
+func (s *FileStore) Save(name string, data []byte) (string, error) {
+	path := s.Path(name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (s *FileStore) Path(name string) string {
+	return filepath.Join(s.basePath, filepath.Base(name))
+}
+
+func (s *FileStore) Read(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.basePath, filepath.Base(name)))
+}
+
+func (s *FileStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.basePath)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *FileStore) Delete(name string) error {
+	err := os.Remove(filepath.Join(s.basePath, filepath.Base(name)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// MemoryStore guarda los artefactos en memoria, útil para pruebas y benchmarks
+type MemoryStore struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{files: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Save(name string, data []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = append([]byte(nil), data...)
+	return s.Path(name), nil
+}
+
+func (s *MemoryStore) Path(name string) string {
+	return "mem://" + name
+}
+
+func (s *MemoryStore) Read(name string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.files[name]
+	if !ok {
+		return nil, fmt.Errorf("file not found: %s", name)
+	}
+	return data, nil
+}
+
+func (s *MemoryStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemoryStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, name)
+	return nil
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+)
+
+const accountingDir = "testdata/accounting"
+
+// accountingFixture es un comprobante de testdata/accounting, descrito como los campos
+// que cambian sobre el documento de ejemplo, con el desglose y el asiento esperados
+type accountingFixture struct {
+	Description string          `json:"description"`
+	Document    json.RawMessage `json:"document"`
+	Expected    struct {
+		Breakdown AccountingBreakdown `json:"breakdown"`
+		Lines     []AccountingLine    `json:"lines"`
+	} `json:"expected"`
+}
+
+func loadAccountingFixtures(t *testing.T) map[string]accountingFixture {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(accountingDir, "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no hay fixtures en %s: %v", accountingDir, err)
+	}
+	fixtures := map[string]accountingFixture{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fixture accountingFixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		fixtures[strings.TrimSuffix(filepath.Base(file), ".json")] = fixture
+	}
+	return fixtures
+}
+
+// documentAccounting consulta el asiento del documento con la API key de admin
+func documentAccounting(t *testing.T, router http.Handler, documentID string) AccountingEntry {
+	t.Helper()
+	rec := doRequest(router, http.MethodGet, "/api/v1/documents/"+documentID+"/accounting", map[string]string{"X-Admin-API-Key": "secreto"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("se esperaba 200, obtenido %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp APIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var entry AccountingEntry
+	if err := json.Unmarshal([]byte(mustJSON(t, resp.Data["accounting"])), &entry); err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestAccountingFixtures(t *testing.T) {
+	for name, fixture := range loadAccountingFixtures(t) {
+		fixture := fixture
+		t.Run(name, func(t *testing.T) {
+			doc := sampleDocument()
+			if err := json.Unmarshal(fixture.Document, doc); err != nil {
+				t.Fatal(err)
+			}
+			service := newMemoryService()
+			router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+			documentID := processForSending(t, service, doc)
+
+			entry := documentAccounting(t, router, documentID)
+			if entry.Breakdown != fixture.Expected.Breakdown {
+				t.Errorf("%s: desglose\n  esperado %+v\n  obtenido %+v", fixture.Description, fixture.Expected.Breakdown, entry.Breakdown)
+			}
+			if !reflect.DeepEqual(entry.Lines, fixture.Expected.Lines) {
+				t.Errorf("%s: asiento\n  esperado %+v\n  obtenido %+v", fixture.Description, fixture.Expected.Lines, entry.Lines)
+			}
+			if !entry.Balanced || entry.TotalDebit != fixture.Expected.Breakdown.Total {
+				t.Errorf("%s: el asiento debe cuadrar en %.2f: debe %.2f, haber %.2f", fixture.Description, fixture.Expected.Breakdown.Total, entry.TotalDebit, entry.TotalCredit)
+			}
+			if !entry.Verified || len(entry.Divergences) != 0 {
+				t.Errorf("%s: el XML debe coincidir con el desglose de la emisión: %+v", fixture.Description, entry.Divergences)
+			}
+		})
+	}
+}
+
+func TestAccountingDetectsXMLDivergence(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+	documentID := processForSending(t, service, sampleDocument())
+
+	// El asiento sale del XML guardado, no del registro: un IGV alterado se detecta
+	xmlData, err := service.GetStore().Read(documentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.ReplaceAll(string(xmlData), `<cbc:TaxAmount currencyID="PEN">18</cbc:TaxAmount>`, `<cbc:TaxAmount currencyID="PEN">20</cbc:TaxAmount>`)
+	if tampered == string(xmlData) {
+		t.Fatal("el XML de ejemplo no tiene el IGV esperado")
+	}
+	service.GetStore().Save(documentID+".xml", []byte(tampered))
+
+	entry := documentAccounting(t, router, documentID)
+	want := []AccountingDivergence{{Concept: "igv", Issued: 18, XML: 20}}
+	if !reflect.DeepEqual(entry.Divergences, want) || entry.Balanced {
+		t.Errorf("se esperaba la divergencia del IGV y el asiento descuadrado: %+v", entry)
+	}
+}
+
+func putAccountingAccounts(t *testing.T, router http.Handler, accounts map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/issuers/20123456786/accounts",
+		strings.NewReader(mustJSON(t, map[string]interface{}{"accounts": accounts})))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-API-Key", "secreto")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAccountingAccountsPerIssuer(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+	headers := map[string]string{"X-Admin-API-Key": "secreto"}
+
+	rec := putAccountingAccounts(t, router, map[string]string{"1000": "40112", "receivable": "1213"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("se esperaba 200, obtenido %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = putAccountingAccounts(t, router, map[string]string{"descuentos": "6591"})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_ACCOUNTING_ACCOUNT") {
+		t.Errorf("un concepto desconocido: se esperaba 400, obtenido %d: %s", rec.Code, rec.Body.String())
+	}
+
+	documentID := processForSending(t, service, sampleDocument())
+	entry := documentAccounting(t, router, documentID)
+	want := []AccountingLine{
+		{Account: "1213", Concept: "receivable", Debit: 118},
+		{Account: "70111", Concept: "taxable", Credit: 100},
+		{Account: "40112", Concept: "igv", Credit: 18},
+	}
+	if !reflect.DeepEqual(entry.Lines, want) {
+		t.Errorf("las cuentas del emisor deben reemplazar a las por defecto: %+v", entry.Lines)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/v1/documents/20123456786-01-F003-999/accounting", headers)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("un documento inexistente: se esperaba 404, obtenido %d", rec.Code)
+	}
+}
@@ -0,0 +1,127 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func TestAdditionalKeysMapped(t *testing.T) {
+	doc := sampleDocument()
+	doc.Additional = map[string]interface{}{
+		"ubigeoEmisor":          "150122",
+		"codigoEstablecimiento": "0001",
+		"ordenCompra":           "OC-2024-0457",
+		"observaciones":         []interface{}{"Entrega en almacén 3", "Pedido urgente"},
+	}
+	if errs := NewValidationService(nil).ValidateBusinessDocument(doc); len(errs) > 0 {
+		t.Fatalf("las claves registradas deben aceptarse: %+v", errs)
+	}
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(xmlData)
+	for fragment, count := range map[string]int{
+		"<cac:OrderReference>\n    <cbc:ID>OC-2024-0457</cbc:ID>":                                 1,
+		`schemeAgencyName="PE:INEI" schemeName="Ubigeos">150122</cbc:ID>`:                         2,
+		`listAgencyName="PE:SUNAT" listName="Establecimientos anexos">0001</cbc:AddressTypeCode>`: 2,
+		"<cbc:Note>Entrega en almacén 3</cbc:Note>\n  <cbc:Note>Pedido urgente</cbc:Note>":        1,
+	} {
+		if n := strings.Count(xml, fragment); n != count {
+			t.Errorf("se esperaba %d veces %s, obtenido %d en:\n%s", count, fragment, n, xml)
+		}
+	}
+	// La orden de compra va antes de la firma, como exige el orden de UBL
+	if strings.Index(xml, "<cac:OrderReference>") > strings.Index(xml, "<cac:Signature>") {
+		t.Error("cac:OrderReference debe ir antes de cac:Signature")
+	}
+
+	// En las notas la orden de compra va entre DiscrepancyResponse y BillingReference
+	note := sampleCreditNote("01", 1)
+	note.Additional = map[string]interface{}{"ordenCompra": "OC-1"}
+	xmlData, err = NewUBLConverter(nil).ConvertToUBL(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml = string(xmlData)
+	order := strings.Index(xml, "<cac:OrderReference>")
+	if order < strings.Index(xml, "<cac:DiscrepancyResponse>") || order > strings.Index(xml, "<cac:BillingReference>") {
+		t.Errorf("cac:OrderReference fuera de lugar en la nota:\n%s", xml)
+	}
+}
+
+func TestAdditionalWrongType(t *testing.T) {
+	// Con el documento armado en Go el validador de negocio revisa el tipo y el formato
+	doc := sampleDocument()
+	doc.Additional = map[string]interface{}{
+		"codigoEstablecimiento": "1",
+		"ordenCompra":           []string{"OC-1", "OC-2"},
+		"observaciones":         []interface{}{"Texto", 3.0},
+	}
+	errs := NewValidationService(nil).ValidateBusinessDocument(doc)
+	fields := map[string]bool{}
+	for _, err := range errs {
+		if err.Rule == AdditionalValidationRule {
+			fields[err.Field] = true
+		}
+	}
+	if len(fields) != 3 || !fields["additional.codigoEstablecimiento"] || !fields["additional.ordenCompra"] || !fields["additional.observaciones"] {
+		t.Errorf("se esperaba un error por clave inválida: %+v", errs)
+	}
+
+	// En el request lo rechaza la validación estructural con la misma regla
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+	body := documentJSON(t, sampleDocument()).(map[string]interface{})
+	body["additional"] = map[string]interface{}{"ordenCompra": 457, "ubigeoEmisor": "15012"}
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/validate", body)
+	var resp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code == http.StatusOK || len(resp.ValidationErrors) != 2 {
+		t.Fatalf("se esperaban dos errores de additional: %d %s", rec.Code, rec.Body.String())
+	}
+	for _, err := range resp.ValidationErrors {
+		if err.Rule != AdditionalValidationRule || !strings.HasPrefix(err.Field, "additional.") {
+			t.Errorf("error inesperado: %+v", err)
+		}
+	}
+}
+
+func TestAdditionalUnknownKeys(t *testing.T) {
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+	body := documentJSON(t, sampleDocument()).(map[string]interface{})
+	body["additional"] = map[string]interface{}{"ordenCompra": "OC-1", "centroCosto": "CC-9"}
+
+	// En modo estándar la clave desconocida se ignora con un warning
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/validate", body)
+	var resp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Warnings) != 1 || resp.Warnings[0].Rule != UnknownFieldRule || resp.Warnings[0].Field != "additional.centroCosto" {
+		t.Fatalf("se esperaba un warning por la clave desconocida: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// En modo estricto se rechaza
+	rec = doJSONRequest(router, http.MethodPost, "/api/v1/validate?strictParsing=true", body)
+	resp = APIResponse{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusBadRequest || resp.ErrorCode != UnknownFieldCode || resp.ValidationErrors[0].Field != "additional.centroCosto" {
+		t.Errorf("se esperaba %s: %d %s", UnknownFieldCode, rec.Code, rec.Body.String())
+	}
+
+	// La clave desconocida no llega al XML
+	doc := sampleDocument()
+	doc.Additional = map[string]interface{}{"centroCosto": "CC-9"}
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(xmlData), "CC-9") {
+		t.Error("una clave desconocida no debe emitirse")
+	}
+}
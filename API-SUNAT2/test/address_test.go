@@ -0,0 +1,53 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+)
+
+func TestCustomerUbigeoSerialization(t *testing.T) {
+	converter := NewUBLConverter(nil)
+
+	doc := sampleDocument()
+	xmlData, err := converter.ConvertToUBL(doc)
+	if err != nil {
+		t.Fatalf("conversión falló: %v", err)
+	}
+	if count := strings.Count(string(xmlData), `schemeName="Ubigeos"`); count != 2 {
+		t.Fatalf("sin ubigeo del cliente solo el emisor debe emitirlo (2 direcciones), se obtuvo %d", count)
+	}
+
+	doc.Customer.Address.Ubigeo = "150140"
+	xmlData, err = converter.ConvertToUBL(doc)
+	if err != nil {
+		t.Fatalf("conversión falló: %v", err)
+	}
+	if !strings.Contains(string(xmlData), ">150140</cbc:ID>") {
+		t.Fatalf("se esperaba el ubigeo del cliente en el XML")
+	}
+	if strings.Contains(string(xmlData), "SURCO - LIMA") {
+		t.Fatalf("AddressLine no debe duplicar distrito/provincia")
+	}
+}
+
+func TestUbigeoValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	doc := sampleDocument()
+	if errs := validator.ValidateBusinessDocument(doc); len(errs) > 0 {
+		t.Fatalf("cliente sin ubigeo debe ser válido: %+v", errs)
+	}
+
+	doc.Customer.Address.Ubigeo = "15014"
+	if !hasRule(validator.ValidateBusinessDocument(doc), "ubigeo_validation") {
+		t.Fatalf("se esperaba error por ubigeo del cliente mal formado")
+	}
+
+	doc = sampleDocument()
+	doc.Issuer.Address.Ubigeo = ""
+	if !hasRule(validator.ValidateBusinessDocument(doc), "ubigeo_validation") {
+		t.Fatalf("se esperaba error por ubigeo del emisor ausente")
+	}
+}
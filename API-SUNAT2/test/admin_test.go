@@ -0,0 +1,67 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+)
+
+func doRequest(handler http.Handler, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminRoutesDisabledByDefault(t *testing.T) {
+	router, adminRouter := api.NewRouter(&config.Config{XMLStorePath: t.TempDir()})
+	if adminRouter != nil {
+		t.Fatalf("no se esperaba router de administración")
+	}
+	for _, path := range []string{"/debug/pprof/", "/api/v1/admin/runtime"} {
+		if rec := doRequest(router, http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: se esperaba 404, se obtuvo %d", path, rec.Code)
+		}
+	}
+}
+
+func TestAdminRoutesEnabled(t *testing.T) {
+	cfg := &config.Config{XMLStorePath: t.TempDir(), EnablePprof: true, AdminAPIKey: "secreto"}
+	router, _ := api.NewRouter(cfg)
+
+	for _, path := range []string{"/debug/pprof/", "/api/v1/admin/runtime"} {
+		if rec := doRequest(router, http.MethodGet, path, nil); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s sin API key: se esperaba 401, se obtuvo %d", path, rec.Code)
+		}
+		if rec := doRequest(router, http.MethodGet, path, map[string]string{"X-Admin-API-Key": "otra"}); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s con API key errónea: se esperaba 401, se obtuvo %d", path, rec.Code)
+		}
+		if rec := doRequest(router, http.MethodGet, path, map[string]string{"X-Admin-API-Key": "secreto"}); rec.Code != http.StatusOK {
+			t.Fatalf("%s con API key: se esperaba 200, se obtuvo %d", path, rec.Code)
+		}
+	}
+}
+
+func TestPprofOnSeparateAdminPort(t *testing.T) {
+	cfg := &config.Config{XMLStorePath: t.TempDir(), EnablePprof: true, AdminAPIKey: "secreto", AdminPort: "6060"}
+	router, adminRouter := api.NewRouter(cfg)
+	if adminRouter == nil {
+		t.Fatalf("se esperaba router de administración")
+	}
+	headers := map[string]string{"X-Admin-API-Key": "secreto"}
+	if rec := doRequest(router, http.MethodGet, "/debug/pprof/", headers); rec.Code != http.StatusNotFound {
+		t.Fatalf("pprof no debe montarse en el puerto principal, se obtuvo %d", rec.Code)
+	}
+	if rec := doRequest(adminRouter, http.MethodGet, "/debug/pprof/", headers); rec.Code != http.StatusOK {
+		t.Fatalf("pprof en puerto administrativo: se esperaba 200, se obtuvo %d", rec.Code)
+	}
+	if rec := doRequest(adminRouter, http.MethodGet, "/debug/pprof/", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("pprof sin API key: se esperaba 401, se obtuvo %d", rec.Code)
+	}
+}
@@ -0,0 +1,201 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// sampleAdvance retorna una factura de anticipo por 118 al cliente de ejemplo
+func sampleAdvance(number string) *BusinessDocument {
+	doc := sampleDocument()
+	doc.Series = "F001"
+	doc.Number = number
+	doc.OperationType = AdvanceOperationType
+	return doc
+}
+
+// regularizingInvoice retorna una factura por 118 que deduce amount del anticipo F001-1
+func regularizingInvoice(number string, amount FlexFloat) *BusinessDocument {
+	doc := sampleDocument()
+	doc.Number = number
+	doc.Advances = []DocumentReference{{DocumentType: "01", DocumentID: "F001-1", Amount: amount}}
+	doc.Totals.PayableAmount = 118 - amount
+	return doc
+}
+
+func advanceBalance(t *testing.T, service *UBLConverterService, documentID string) AdvanceBalance {
+	t.Helper()
+	balances, err := service.AdvanceBalances("20123456786", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, balance := range balances {
+		if balance.DocumentID == documentID {
+			return balance
+		}
+	}
+	t.Fatalf("anticipo %s no listado: %+v", documentID, balances)
+	return AdvanceBalance{}
+}
+
+func TestAdvancePartialAndTotalApplication(t *testing.T) {
+	service := newMemoryService()
+	advanceID := processForSending(t, service, sampleAdvance("1"))
+	if balance := advanceBalance(t, service, advanceID); balance.Amount != 118 || balance.Balance != 118 {
+		t.Fatalf("anticipo recién emitido: %+v", balance)
+	}
+
+	// Regularización parcial
+	partialID := processForSending(t, service, regularizingInvoice("2", 50))
+	content, _ := service.GetStore().Read(partialID + ".xml")
+	for _, fragment := range []string{
+		`<cbc:DocumentTypeCode listAgencyName="PE:SUNAT" listName="Documento Relacionado" listURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo12">02</cbc:DocumentTypeCode>`,
+		`<cbc:DocumentStatusCode listAgencyName="PE:SUNAT" listName="Anticipo">1</cbc:DocumentStatusCode>`,
+		`<cbc:PaidAmount currencyID="PEN">50</cbc:PaidAmount>`,
+		`<cbc:PrepaidAmount currencyID="PEN">50</cbc:PrepaidAmount>`,
+		`<cbc:PayableAmount currencyID="PEN">68</cbc:PayableAmount>`,
+	} {
+		if !strings.Contains(string(content), fragment) {
+			t.Errorf("falta %s en el XML", fragment)
+		}
+	}
+	if balance := advanceBalance(t, service, advanceID); balance.Applied != 50 || balance.Balance != 68 {
+		t.Errorf("saldo tras la regularización parcial: %+v", balance)
+	}
+
+	// Regularización del saldo restante
+	totalID := processForSending(t, service, regularizingInvoice("3", 68))
+	balance := advanceBalance(t, service, advanceID)
+	if balance.Balance != 0 || len(balance.Applications) != 2 || balance.Applications[1] != (AffectedDocument{DocumentID: totalID, Amount: 68}) {
+		t.Errorf("saldo tras la regularización total: %+v", balance)
+	}
+
+	// Sin saldo no se puede deducir más
+	resp, err := service.ProcessDocument(context.Background(), regularizingInvoice("4", 1), nil, nil)
+	if err != nil || !hasRule(resp.ValidationErrors, "advance_balance_exceeded") {
+		t.Fatalf("se esperaba advance_balance_exceeded: %v %+v", err, resp)
+	}
+
+	// Anular una factura devuelve su monto al saldo
+	service.GetStore().Save(partialID+VoidedSuffix, []byte("Error en el monto"))
+	if balance := advanceBalance(t, service, advanceID); balance.Balance != 50 {
+		t.Errorf("saldo tras anular la regularización parcial: %+v", balance)
+	}
+
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "admin"}, service)
+	for customer, want := range map[string]int{"12345678": 1, "87654321": 0} {
+		rec := doRequest(router, http.MethodGet, "/api/v1/advances?ruc=20123456786&customer="+customer, map[string]string{"X-Admin-API-Key": "admin"})
+		var body struct {
+			Data struct {
+				Advances []AdvanceBalance `json:"advances"`
+			} `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusOK || len(body.Data.Advances) != want {
+			t.Errorf("cliente %s: %d %s", customer, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestAdvanceValidation(t *testing.T) {
+	service := newMemoryService()
+	processForSending(t, service, sampleAdvance("1"))
+	processForSending(t, service, sampleDocument())
+
+	cases := map[string]func(doc *BusinessDocument){
+		"advance_totals_mismatch": func(doc *BusinessDocument) { doc.Totals.PayableAmount = 118 },
+		"advance_not_found": func(doc *BusinessDocument) {
+			// Una factura que no es de anticipo no tiene saldo que regularizar
+			doc.Advances[0].DocumentID = "F003-123456"
+		},
+		"advance_customer_mismatch": func(doc *BusinessDocument) {
+			doc.Customer.DocumentType, doc.Customer.DocumentID = "6", "20123456794"
+		},
+		"advance_currency_mismatch": func(doc *BusinessDocument) { doc.Currency = "USD" },
+		"advance_validation": func(doc *BusinessDocument) {
+			doc.Advances = append(doc.Advances, doc.Advances[0])
+			doc.Totals.PayableAmount = 18
+		},
+	}
+	for rule, mutate := range cases {
+		doc := regularizingInvoice("2", 50)
+		mutate(doc)
+		resp, err := service.ProcessDocument(context.Background(), doc, nil, nil)
+		if err != nil || !hasRule(resp.ValidationErrors, rule) {
+			t.Errorf("%s: %v %+v", rule, err, resp.ValidationErrors)
+		}
+	}
+}
+
+func TestAdvanceConcurrentApplication(t *testing.T) {
+	service := newMemoryService()
+	advanceID := processForSending(t, service, sampleAdvance("1"))
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	// Cinco facturas de 50 compiten por un saldo de 118: solo dos pueden aplicarse
+	var wg sync.WaitGroup
+	results := make([]*APIResponse, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = service.ProcessDocument(context.Background(), regularizingInvoice(fmt.Sprint(10+i), 50), certPEM, keyPEM)
+		}(i)
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, resp := range results {
+		switch {
+		case resp != nil && resp.Status == "SUCCESS":
+			accepted++
+		case resp == nil || !hasRule(resp.ValidationErrors, "advance_balance_exceeded"):
+			t.Errorf("resultado inesperado: %+v", resp)
+		}
+	}
+	if balance := advanceBalance(t, service, advanceID); accepted != 2 || balance.Balance != 18 {
+		t.Errorf("aceptadas %d, saldo %+v", accepted, balance)
+	}
+}
+
+func TestAdvanceOperationTypeListed(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "admin"}, service)
+
+	// Una factura con tipo de operación 0103 es un anticipo; una itinerante (0102) no
+	for number, operationType := range map[string]string{"1": "0103", "2": "0102"} {
+		doc := sampleDocument()
+		doc.Series, doc.Number, doc.OperationType = "F001", number, operationType
+		rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", convertRequest(t, doc))
+		var resp APIResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != http.StatusOK || resp.Status != "SUCCESS" {
+			t.Fatalf("factura %s: %d %s", operationType, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(router, http.MethodGet, "/api/v1/advances?ruc=20123456786", map[string]string{"X-Admin-API-Key": "admin"})
+	var body struct {
+		Data struct {
+			Advances []AdvanceBalance `json:"advances"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	advances := body.Data.Advances
+	if rec.Code != http.StatusOK || len(advances) != 1 {
+		t.Fatalf("se esperaba solo el anticipo 0103: %d %s", rec.Code, rec.Body.String())
+	}
+	if advances[0].DocumentID != "20123456786-01-F001-1" || advances[0].Amount != 118 || advances[0].Balance != 118 {
+		t.Errorf("anticipo inesperado: %+v", advances[0])
+	}
+}
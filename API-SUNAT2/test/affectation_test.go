@@ -0,0 +1,155 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// affectationDocument retorna una factura con una línea gravada (100.00), una
+// exonerada (50.00), una inafecta (20.00) y una bonificación gravada de valor
+// referencial 10.00 marcada solo por su tipo de afectación
+func affectationDocument() *BusinessDocument {
+	doc := sampleDocument()
+	doc.Items = append(doc.Items,
+		DocumentItem{
+			ID:          "2",
+			Description: "Libro",
+			Quantity:    1,
+			UnitCode:    "NIU",
+			UnitPrice:   50,
+			LineTotal:   50,
+			Taxes:       []Tax{{TaxType: "9997", TaxBase: 50, AffectationCode: "20"}},
+		},
+		DocumentItem{
+			ID:          "3",
+			Description: "Servicio de transporte",
+			Quantity:    1,
+			UnitCode:    "ZZ",
+			UnitPrice:   20,
+			LineTotal:   20,
+			Taxes:       []Tax{{TaxType: "9998", TaxBase: 20}},
+		},
+		DocumentItem{
+			ID:          "4",
+			Description: "Bonificación",
+			Quantity:    1,
+			UnitCode:    "NIU",
+			UnitPrice:   10,
+			LineTotal:   10,
+			Taxes:       []Tax{{TaxType: "1000", TaxAmount: 1.8, TaxRate: 18, TaxBase: 10, AffectationCode: "15"}},
+		},
+	)
+	doc.Taxes = []TaxTotal{
+		{TaxType: "1000", TaxAmount: 18, TaxRate: 18, TaxBase: 100},
+		{TaxType: "9997", TaxBase: 50},
+		{TaxType: "9998", TaxBase: 20},
+	}
+	doc.Totals = DocumentTotals{SubTotal: 170, TotalTaxes: 18, TotalAmount: 188, PayableAmount: 188}
+	return doc
+}
+
+func TestAffectationCodesConversion(t *testing.T) {
+	doc := affectationDocument()
+	if errs := NewValidationService(nil).ValidateBusinessDocument(doc); len(errs) > 0 {
+		t.Fatalf("no se esperaban errores: %+v", errs)
+	}
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(xmlData), "<cac:InvoiceLine>")
+	if len(lines) != 5 {
+		t.Fatalf("se esperaban 4 líneas, se obtuvieron %d", len(lines)-1)
+	}
+
+	category := func(id string) string { return `schemeName="Tax Category Identifier">` + id + `</cbc:ID>` }
+	reason := func(code string) string {
+		return `listURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo07">` + code + `</cbc:TaxExemptionReasonCode>`
+	}
+	scheme := func(taxType string) string { return `catalogo05">` + taxType + `</cbc:ID>` }
+	cases := []struct {
+		name      string
+		line      string
+		fragments []string
+	}{
+		{"gravada", lines[1], []string{category("S"), reason("10"), scheme("1000"), "<cbc:Name>IGV</cbc:Name>", ">01</cbc:PriceTypeCode>"}},
+		{"exonerada", lines[2], []string{category("E"), reason("20"), scheme("9997"), "<cbc:Name>EXO</cbc:Name>", "<cbc:TaxTypeCode>VAT</cbc:TaxTypeCode>"}},
+		// Sin tipo de afectación se usa el de la operación onerosa del tributo
+		{"inafecta", lines[3], []string{category("O"), reason("30"), scheme("9998"), "<cbc:Name>INA</cbc:Name>", "<cbc:TaxTypeCode>FRE</cbc:TaxTypeCode>"}},
+		// La bonificación se declara en el 9996 con precio cero y valor referencial
+		{"bonificación", lines[4], []string{category("Z"), reason("15"), scheme("9996"), "<cbc:Name>GRA</cbc:Name>", ">02</cbc:PriceTypeCode>", `<cbc:PriceAmount currencyID="PEN">0</cbc:PriceAmount>`}},
+	}
+	for _, tc := range cases {
+		for _, fragment := range tc.fragments {
+			if !strings.Contains(tc.line, fragment) {
+				t.Errorf("%s: falta %s en:\n%s", tc.name, fragment, tc.line)
+			}
+		}
+	}
+
+	// Los tributos del documento usan la categoría y el código de cada tributo
+	header := lines[0]
+	for _, fragment := range []string{category("E"), reason("20"), category("O"), reason("30"), scheme("9996"), `<cbc:Note languageLocaleID="1002">`} {
+		if !strings.Contains(header, fragment) {
+			t.Errorf("falta %s en los tributos del documento:\n%s", fragment, header)
+		}
+	}
+}
+
+func TestAffectationCodesValidation(t *testing.T) {
+	cases := []struct {
+		name   string
+		tax    Tax
+		free   bool
+		reason string
+	}{
+		{"fuera del catálogo", Tax{TaxType: "1000", TaxAmount: 1.8, TaxRate: 18, TaxBase: 10, AffectationCode: "19"}, false, "not valid"},
+		{"de otro tributo", Tax{TaxType: "1000", TaxAmount: 1.8, TaxRate: 18, TaxBase: 10, AffectationCode: "20"}, false, "belongs to tax 9997"},
+		{"tributo sin afectación", Tax{TaxType: "2000", TaxAmount: 1, TaxRate: 10, TaxBase: 10, IscSystem: "01", AffectationCode: "10"}, false, "does not take"},
+		{"onerosa en línea gratuita", Tax{TaxType: "1000", TaxAmount: 1.8, TaxRate: 18, TaxBase: 10, AffectationCode: "10"}, true, "Free lines"},
+	}
+	for _, tc := range cases {
+		doc := affectationDocument()
+		doc.Items[3].Taxes = []Tax{tc.tax}
+		doc.Items[3].Free = tc.free
+		var found []ValidationError
+		for _, err := range NewValidationService(nil).ValidateBusinessDocument(doc) {
+			if err.Rule == AffectationValidationRule {
+				found = append(found, err)
+			}
+		}
+		if len(found) != 1 || found[0].Field != "items[3].taxes[0].affectationCode" || !strings.Contains(found[0].Message, tc.reason) {
+			t.Errorf("%s: se esperaba un error %q: %+v", tc.name, tc.reason, found)
+		}
+	}
+
+	// Un código gratuito admite el 9996 como tributo
+	doc := affectationDocument()
+	doc.Items[3].Taxes[0].TaxType = FreeTaxType
+	doc.Items[3].Taxes[0].TaxRate, doc.Items[3].Taxes[0].TaxAmount = 0, 0
+	if errs := NewValidationService(nil).ValidateBusinessDocument(doc); len(errs) > 0 {
+		t.Errorf("no se esperaban errores con el 9996: %+v", errs)
+	}
+
+	// En el request el schema publica el catálogo 07 y el error es el de la regla de negocio
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+	body := documentJSON(t, affectationDocument()).(map[string]interface{})
+	body["items"].([]interface{})[1].(map[string]interface{})["taxes"].([]interface{})[0].(map[string]interface{})["affectationCode"] = "99"
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/validate", body)
+	var resp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code == http.StatusOK || len(resp.ValidationErrors) != 1 || resp.ValidationErrors[0].Rule != AffectationValidationRule {
+		t.Errorf("se esperaba %s: %d %s", AffectationValidationRule, rec.Code, rec.Body.String())
+	}
+	enum := DocumentSchema().Properties["items"].Items.Properties["taxes"].Items.Properties["affectationCode"].Enum
+	if len(enum) != 19 || enum[0] != "10" || enum[18] != "40" {
+		t.Errorf("enum de affectationCode: %v", enum)
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+	. "API-SUNAT2/util"
+)
+
+func TestAmountToWords(t *testing.T) {
+	cases := []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{0, "PEN", "CERO CON 00/100 SOLES"},
+		{0.5, "PEN", "CERO CON 50/100 SOLES"},
+		{1, "PEN", "UNO CON 00/100 SOLES"},
+		{1.01, "PEN", "UNO CON 01/100 SOLES"},
+		{2.99, "PEN", "DOS CON 99/100 SOLES"},
+		{10, "PEN", "DIEZ CON 00/100 SOLES"},
+		{11, "PEN", "ONCE CON 00/100 SOLES"},
+		{15, "PEN", "QUINCE CON 00/100 SOLES"},
+		{16, "PEN", "DIECISÉIS CON 00/100 SOLES"},
+		{20, "PEN", "VEINTE CON 00/100 SOLES"},
+		{21, "PEN", "VEINTIUNO CON 00/100 SOLES"},
+		{22, "PEN", "VEINTIDÓS CON 00/100 SOLES"},
+		{23, "PEN", "VEINTITRÉS CON 00/100 SOLES"},
+		{26, "PEN", "VEINTISÉIS CON 00/100 SOLES"},
+		{30, "PEN", "TREINTA CON 00/100 SOLES"},
+		{31, "PEN", "TREINTA Y UNO CON 00/100 SOLES"},
+		{45.75, "PEN", "CUARENTA Y CINCO CON 75/100 SOLES"},
+		{59, "PEN", "CINCUENTA Y NUEVE CON 00/100 SOLES"},
+		{99.99, "PEN", "NOVENTA Y NUEVE CON 99/100 SOLES"},
+		{100, "PEN", "CIEN CON 00/100 SOLES"},
+		{101, "PEN", "CIENTO UNO CON 00/100 SOLES"},
+		{118, "PEN", "CIENTO DIECIOCHO CON 00/100 SOLES"},
+		{121, "PEN", "CIENTO VEINTIUNO CON 00/100 SOLES"},
+		{200, "PEN", "DOSCIENTOS CON 00/100 SOLES"},
+		{500, "PEN", "QUINIENTOS CON 00/100 SOLES"},
+		{555.55, "PEN", "QUINIENTOS CINCUENTA Y CINCO CON 55/100 SOLES"},
+		{700, "PEN", "SETECIENTOS CON 00/100 SOLES"},
+		{999, "PEN", "NOVECIENTOS NOVENTA Y NUEVE CON 00/100 SOLES"},
+		{1000, "PEN", "MIL CON 00/100 SOLES"},
+		{1001, "PEN", "MIL UNO CON 00/100 SOLES"},
+		{1100, "PEN", "MIL CIEN CON 00/100 SOLES"},
+		{1250.5, "PEN", "MIL DOSCIENTOS CINCUENTA CON 50/100 SOLES"},
+		{2000, "PEN", "DOS MIL CON 00/100 SOLES"},
+		{21000, "USD", "VEINTIÚN MIL CON 00/100 DÓLARES AMERICANOS"},
+		{21021, "PEN", "VEINTIÚN MIL VEINTIUNO CON 00/100 SOLES"},
+		{31000, "PEN", "TREINTA Y UN MIL CON 00/100 SOLES"},
+		{100000, "PEN", "CIEN MIL CON 00/100 SOLES"},
+		{101000, "PEN", "CIENTO UN MIL CON 00/100 SOLES"},
+		{999999.99, "PEN", "NOVECIENTOS NOVENTA Y NUEVE MIL NOVECIENTOS NOVENTA Y NUEVE CON 99/100 SOLES"},
+		{1000000, "PEN", "UN MILLÓN CON 00/100 SOLES"},
+		{1000001, "PEN", "UN MILLÓN UNO CON 00/100 SOLES"},
+		{2500000, "EUR", "DOS MILLONES QUINIENTOS MIL CON 00/100 EUROS"},
+		{21000000, "PEN", "VEINTIÚN MILLONES CON 00/100 SOLES"},
+		{100000000, "PEN", "CIEN MILLONES CON 00/100 SOLES"},
+		{101000000, "PEN", "CIENTO UN MILLONES CON 00/100 SOLES"},
+		{1000000000, "PEN", "MIL MILLONES CON 00/100 SOLES"},
+		{1200000000, "USD", "MIL DOSCIENTOS MILLONES CON 00/100 DÓLARES AMERICANOS"},
+		{21000000001, "PEN", "VEINTIÚN MIL MILLONES UNO CON 00/100 SOLES"},
+		{999999999999.99, "PEN", "NOVECIENTOS NOVENTA Y NUEVE MIL NOVECIENTOS NOVENTA Y NUEVE MILLONES NOVECIENTOS NOVENTA Y NUEVE MIL NOVECIENTOS NOVENTA Y NUEVE CON 99/100 SOLES"},
+		{1234.567, "USD", "MIL DOSCIENTOS TREINTA Y CUATRO CON 57/100 DÓLARES AMERICANOS"},
+		{0.1 + 0.2, "EUR", "CERO CON 30/100 EUROS"},
+		{-59, "PEN", "CINCUENTA Y NUEVE CON 00/100 SOLES"},
+		{10, "GBP", "DIEZ CON 00/100 GBP"},
+	}
+
+	for _, tc := range cases {
+		if got := AmountToWords(tc.amount, tc.currency); got != tc.want {
+			t.Errorf("AmountToWords(%v, %s) = %q, esperado %q", tc.amount, tc.currency, got, tc.want)
+		}
+	}
+}
+
+func TestAmountToWordsCurrencyTable(t *testing.T) {
+	RegisterCurrencyName("clp", "pesos chilenos")
+	if got := AmountToWords(1500, "CLP"); got != "MIL QUINIENTOS CON 00/100 PESOS CHILENOS" {
+		t.Errorf("moneda registrada: %q", got)
+	}
+	if got := RemoveAccents("VEINTIÚN MIL CON 00/100 DÓLARES AMERICANOS, AÑO"); got != "VEINTIUN MIL CON 00/100 DOLARES AMERICANOS, AÑO" {
+		t.Errorf("sin tildes: %q", got)
+	}
+}
+
+func TestAmountInWordsLegend(t *testing.T) {
+	doc := sampleDocument()
+	doc.Currency = "USD"
+	doc.Totals.PayableAmount = 1216.26
+
+	converter := NewUBLConverter(nil)
+	xmlData, err := converter.ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<cbc:Note languageLocaleID="1000">MIL DOSCIENTOS DIECISÉIS CON 26/100 DÓLARES AMERICANOS</cbc:Note>`
+	if !strings.Contains(string(xmlData), want) {
+		t.Errorf("falta la leyenda 1000 en dólares: %s", emittedNotes(xmlData))
+	}
+
+	converter.SetAmountWordsAccents(false)
+	note := sampleCreditNote("07", 1)
+	note.Currency = "EUR"
+	note.Totals.PayableAmount = 21
+	if xmlData, _ = converter.ConvertToUBL(note); !strings.Contains(string(xmlData), `<cbc:Note languageLocaleID="1000">VEINTIUNO CON 00/100 EUROS</cbc:Note>`) {
+		t.Errorf("falta la leyenda 1000 en la nota de crédito: %s", emittedNotes(xmlData))
+	}
+	doc.Totals.PayableAmount = 21000
+	if xmlData, _ = converter.ConvertToUBL(doc); !strings.Contains(string(xmlData), ">VEINTIUN MIL CON 00/100 DOLARES AMERICANOS</cbc:Note>") {
+		t.Errorf("la leyenda debe emitirse sin tildes: %s", emittedNotes(xmlData))
+	}
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/audit"
+	. "API-SUNAT2/model"
+)
+
+// auditFixtures crea un directorio con XML firmados válidos (uno en un subdirectorio y
+// otro con ceros a la izquierda), firmas rotas, nombres que no corresponden al contenido
+// y archivos corruptos
+func auditFixtures(t *testing.T) string {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	dir := t.TempDir()
+	for _, sub := range []string{"2024", "alterado", "firma"} {
+		os.Mkdir(filepath.Join(dir, sub), 0755)
+	}
+
+	pipeline := newMemoryService().NewDefaultPipeline()
+	pipeline.SetWriter(nil)
+	boleta := sampleDocument()
+	boleta.Type, boleta.Series = "03", "B001"
+	signed := make(map[string][]byte)
+	for _, doc := range []*BusinessDocument{sampleDocument(), boleta} {
+		ctx, err := pipeline.Run(context.Background(), doc, certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed[doc.Type] = ctx.XML
+	}
+	invoice := string(signed["01"])
+
+	files := map[string]string{
+		"20123456786-01-F003-123456.xml":      invoice,
+		"2024/20123456786-03-B001-123456.xml": string(signed["03"]),
+		"20123456786-01-F003-00123456.xml":    invoice,
+		// Firmas rotas: contenido alterado y firma vaciada
+		"alterado/20123456786-01-F003-123456.xml": strings.Replace(invoice, "RODRIGO S.A.C", "OTRO S.A.C", 1),
+		"firma/20123456786-01-F003-123456.xml":    strings.Replace(invoice, "<ds:SignatureValue>", "<ds:SignatureValue>AAAA", 1),
+		// Nombres que no corresponden al contenido
+		"20100000001-01-F003-123456.xml": invoice,
+		"20123456786-03-F003-123456.xml": invoice,
+		"20123456786-01-F003-999999.xml": invoice,
+		"factura-final.xml":              invoice,
+		// Corruptos
+		"20123456786-01-F003-000001.xml": invoice[:len(invoice)/2],
+		"20123456786-01-F003-000002.xml": "\x00\x01PK no es un XML",
+		// Ignorados
+		"R-20123456786-01-F003-123456.xml": "<ApplicationResponse/>",
+		"notas.txt":                        "no es un XML",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestAuditDirectory(t *testing.T) {
+	dir := auditFixtures(t)
+	report, err := audit.Run(audit.Options{Dir: dir, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 11 || report.OK != 3 || report.Failed != 8 {
+		t.Fatalf("reporte inesperado: %+v", report)
+	}
+
+	want := map[string][]string{
+		"20123456786-01-F003-123456.xml":          nil,
+		"2024/20123456786-03-B001-123456.xml":     nil,
+		"20123456786-01-F003-00123456.xml":        nil,
+		"alterado/20123456786-01-F003-123456.xml": {audit.CheckSignature},
+		"firma/20123456786-01-F003-123456.xml":    {audit.CheckSignature},
+		"20100000001-01-F003-123456.xml":          {audit.CheckFileName},
+		"20123456786-03-F003-123456.xml":          {audit.CheckFileName},
+		"20123456786-01-F003-999999.xml":          {audit.CheckFileName},
+		"factura-final.xml":                       {audit.CheckFileName},
+		"20123456786-01-F003-000001.xml":          {audit.CheckRead},
+		"20123456786-01-F003-000002.xml":          {audit.CheckRead},
+	}
+	for _, result := range report.Files {
+		name, _ := filepath.Rel(dir, result.File)
+		checks, ok := want[filepath.ToSlash(name)]
+		if !ok {
+			t.Errorf("%s no debe verificarse", name)
+			continue
+		}
+		if !reflect.DeepEqual(result.Checks, checks) || result.OK != (checks == nil) || (result.Reason == "") == !result.OK {
+			t.Errorf("%s: se esperaba %v, obtenido %+v", name, checks, result)
+		}
+	}
+	if report.ByCheck[audit.CheckSignature] != 2 || report.ByCheck[audit.CheckFileName] != 4 || report.ByCheck[audit.CheckRead] != 2 {
+		t.Errorf("resumen por verificación inesperado: %v", report.ByCheck)
+	}
+	for _, result := range report.Files {
+		if strings.HasSuffix(result.File, "20100000001-01-F003-123456.xml") && !strings.Contains(result.Reason, "RUC 20100000001 in name") {
+			t.Errorf("el motivo debe indicar el RUC que no corresponde: %s", result.Reason)
+		}
+	}
+
+	// El CSV tiene una fila por archivo
+	path := filepath.Join(t.TempDir(), "reporte.csv")
+	if err := report.WriteCSV(path); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 12 || !reflect.DeepEqual(rows[0], []string{"file", "result", "checks", "reason"}) {
+		t.Fatalf("CSV inesperado: %v", rows)
+	}
+	failed := 0
+	for _, row := range rows[1:] {
+		if row[1] == "failed" {
+			failed++
+		}
+	}
+	if failed != 8 {
+		t.Errorf("el CSV debe marcar 8 archivos con fallas: %v", rows)
+	}
+}
+
+func TestAuditRequiresWorkers(t *testing.T) {
+	if _, err := audit.Run(audit.Options{Dir: t.TempDir()}); err == nil {
+		t.Error("sin workers la verificación debe fallar")
+	}
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// mixedBatch arma un lote de 6 documentos con 3 que fallan: moneda inválida (1), un
+// tipo equivocado en la estructura (3) y el número repetido del primero (4)
+func mixedBatch(t *testing.T, onError string) map[string]interface{} {
+	t.Helper()
+	documents := make([]interface{}, 6)
+	for i, number := range []string{"000001", "000002", "000003", "000004", "000001", "000006"} {
+		doc := sampleDocument()
+		doc.Number = number
+		documents[i] = doc
+	}
+	documents[1].(*BusinessDocument).Currency = "XXX"
+	broken := documentJSON(t, sampleDocument()).(map[string]interface{})
+	broken["number"] = "000004"
+	broken["items"] = "ninguno"
+	documents[3] = broken
+
+	request := convertRequest(t, sampleDocument())
+	delete(request, "document")
+	request["documents"] = documents
+	request["onError"] = onError
+	return request
+}
+
+func decodeBatch(t *testing.T, body []byte) (APIResponse, BatchResult) {
+	t.Helper()
+	var resp APIResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	var result BatchResult
+	if err := json.Unmarshal([]byte(mustJSON(t, resp.Data["summary"])), &result.Summary); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(mustJSON(t, resp.Data["items"])), &result.Items); err != nil {
+		t.Fatal(err)
+	}
+	return resp, result
+}
+
+func batchStatuses(items []BatchItemResult) []string {
+	statuses := make([]string, len(items))
+	for i, item := range items {
+		statuses[i] = item.Status
+	}
+	return statuses
+}
+
+func TestBatchAbortEmitsNothing(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert/batch", mixedBatch(t, BatchOnErrorAbort))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("se esperaba 422, obtenido %d: %s", rec.Code, rec.Body.String())
+	}
+	resp, result := decodeBatch(t, rec.Body.Bytes())
+	if resp.ErrorCode != ValidationFailedCode || !result.Summary.Aborted {
+		t.Errorf("un lote abortado por validación responde VALIDATION_FAILED: %s %v", resp.ErrorCode, result.Summary.Aborted)
+	}
+
+	want := []string{"SKIPPED", "ERROR", "SKIPPED", "ERROR", "ERROR", "SKIPPED"}
+	if got := batchStatuses(result.Items); !reflect.DeepEqual(got, want) {
+		t.Errorf("resultados: se esperaba %v, obtenido %v", want, got)
+	}
+	if !reflect.DeepEqual(result.Summary.FailedIndices, []int{1, 3, 4}) || result.Summary.Skipped != 3 || result.Summary.Succeeded != 0 {
+		t.Errorf("resumen inesperado: %+v", result.Summary)
+	}
+	if !hasRule(result.Summary.Failures[0].ValidationErrors, "currency_validation") ||
+		!hasRule(result.Summary.Failures[2].ValidationErrors, BatchDuplicateRule) {
+		t.Errorf("el resumen debe listar los errores de cada índice fallido: %+v", result.Summary.Failures)
+	}
+
+	// La validación previa no firma ni guarda nada
+	for _, number := range []string{"000001", "000003", "000006"} {
+		if _, err := service.GetStore().Read("20123456786-01-F003-" + number + ".xml"); err == nil {
+			t.Errorf("con abort no debe emitirse el documento %s", number)
+		}
+	}
+}
+
+func TestBatchContinueEmitsValid(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert/batch", mixedBatch(t, BatchOnErrorContinue))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("se esperaba 200, obtenido %d: %s", rec.Code, rec.Body.String())
+	}
+	resp, result := decodeBatch(t, rec.Body.Bytes())
+	if resp.Status != "SUCCESS" || result.Summary.Aborted {
+		t.Errorf("un lote con documentos emitidos responde SUCCESS: %s", rec.Body.String())
+	}
+
+	want := []string{"SUCCESS", "ERROR", "SUCCESS", "ERROR", "ERROR", "SUCCESS"}
+	if got := batchStatuses(result.Items); !reflect.DeepEqual(got, want) {
+		t.Errorf("resultados: se esperaba %v, obtenido %v", want, got)
+	}
+	if !reflect.DeepEqual(result.Summary.FailedIndices, []int{1, 3, 4}) || result.Summary.Succeeded != 3 || result.Summary.Skipped != 0 {
+		t.Errorf("resumen inesperado: %+v", result.Summary)
+	}
+	if result.Items[3].ErrorCode == "" || result.Items[3].ValidationErrors[0].Field != "items" {
+		t.Errorf("el documento mal formado debe fallar solo, con su error de estructura: %+v", result.Items[3])
+	}
+	for _, i := range []int{0, 2, 5} {
+		item := result.Items[i]
+		if _, err := service.GetStore().Read(item.DocumentID + ".xml"); err != nil || item.XMLHash == "" {
+			t.Errorf("el documento %d debe emitirse: %+v", i, item)
+		}
+	}
+	if result.Items[4].DocumentID != result.Items[0].DocumentID || result.Items[4].XMLHash != "" {
+		t.Errorf("el número repetido no debe reemplazar al documento emitido: %+v", result.Items[4])
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	service := newMemoryService()
+	service.SetBatchLimit(2)
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+
+	rec := doJSONRequest(router, http.MethodPost, "/api/v2/convert/batch", mixedBatch(t, BatchOnErrorContinue))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("un lote mayor al límite: se esperaba 413, obtenido %d", rec.Code)
+	}
+
+	request := mixedBatch(t, "ignore")
+	request["documents"] = request["documents"].([]interface{})[:1]
+	if rec := doJSONRequest(router, http.MethodPost, "/api/v2/convert/batch", request); rec.Code != http.StatusBadRequest {
+		t.Errorf("un onError desconocido: se esperaba 400, obtenido %d", rec.Code)
+	}
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"API-SUNAT2/bench"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+func BenchmarkProcessDocument(b *testing.B) {
+	certPEM, keyPEM := loadTestCredentials(b)
+	for _, lines := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("lines=%d", lines), func(b *testing.B) {
+			service := NewUBLConverterService("")
+			service.SetStore(storage.NewMemoryStore())
+			service.GetLogger().SetOutput(io.Discard)
+			doc := bench.SyntheticDocument(lines)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				response, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+				if err != nil || response.Status != "SUCCESS" {
+					b.Fatalf("procesamiento falló: %v %+v", err, response)
+				}
+			}
+		})
+	}
+}
+
+func TestBenchRunReportsStages(t *testing.T) {
+	report, err := bench.Run(bench.Options{Docs: 4, Concurrency: 2, Lines: 3})
+	if err != nil {
+		t.Fatalf("bench falló: %v", err)
+	}
+	if report.Errors != 0 {
+		t.Fatalf("no se esperaban errores, se obtuvo %d", report.Errors)
+	}
+	for _, stage := range []string{"validate", "convert", "sign", "save", "zip", "total"} {
+		if report.Stages[stage].Count != 4 {
+			t.Fatalf("etapa %s: se esperaban 4 muestras, se obtuvo %d", stage, report.Stages[stage].Count)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// anonymousBoleta es una boleta a "CLIENTES VARIOS" por el importe total indicado
+func anonymousBoleta(total float64) *BusinessDocument {
+	doc := sampleBoleta("1")
+	doc.Customer.DocumentType = "0"
+	doc.Customer.DocumentID = "00000000"
+	doc.Customer.Name = "CLIENTES VARIOS"
+	doc.Totals.TotalAmount = FlexFloat(total)
+	return doc
+}
+
+func TestBoletaIdentificationThreshold(t *testing.T) {
+	validator := newMemoryService().GetValidator()
+
+	cases := []struct {
+		name    string
+		doc     func() *BusinessDocument
+		flagged bool
+	}{
+		{"justo en el umbral", func() *BusinessDocument { return anonymousBoleta(700) }, false},
+		{"un céntimo sobre el umbral", func() *BusinessDocument { return anonymousBoleta(700.01) }, true},
+		{"S/ 5000 a clientes varios", func() *BusinessDocument { return anonymousBoleta(5000) }, true},
+		{"con DNI", func() *BusinessDocument {
+			doc := anonymousBoleta(5000)
+			doc.Customer.DocumentType, doc.Customer.DocumentID = "1", "12345678"
+			return doc
+		}, false},
+		{"DNI con formato inválido", func() *BusinessDocument {
+			doc := anonymousBoleta(5000)
+			doc.Customer.DocumentType, doc.Customer.DocumentID = "1", "1234"
+			return doc
+		}, true},
+		{"factura", func() *BusinessDocument {
+			doc := anonymousBoleta(5000)
+			doc.Type, doc.Series = "01", "F003"
+			return doc
+		}, false},
+		{"antes de la vigencia", func() *BusinessDocument {
+			doc := anonymousBoleta(5000)
+			doc.IssueDate = "2015-12-31"
+			return doc
+		}, false},
+	}
+	for _, tc := range cases {
+		errors := validator.ValidateBusinessDocument(tc.doc())
+		if hasRule(errors, BoletaIdentificationRule) != tc.flagged {
+			t.Errorf("%s: se esperaba marcada=%v, errores %v", tc.name, tc.flagged, errors)
+		}
+	}
+
+	// Un umbral nuevo aplica solo desde su fecha de vigencia
+	thresholds, err := catalog.ParseBoletaIdentificationThresholds("2016-01-01:700,2025-01-01:1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator.SetBoletaIdentificationThresholds(thresholds)
+	doc := anonymousBoleta(800)
+	if !hasRule(validator.ValidateBusinessDocument(doc), BoletaIdentificationRule) {
+		t.Errorf("en 2024 el umbral vigente es S/ 700")
+	}
+	doc.IssueDate = "2025-02-01"
+	if hasRule(validator.ValidateBusinessDocument(doc), BoletaIdentificationRule) {
+		t.Errorf("desde 2025-01-01 el umbral vigente es S/ 1000")
+	}
+}
+
+func TestBoletaIdentificationForeignCurrency(t *testing.T) {
+	validator := newMemoryService().GetValidator()
+
+	doc := anonymousBoleta(200)
+	doc.Currency = "USD"
+	doc.ExchangeRate = 3.5
+	if hasRule(validator.ValidateBusinessDocument(doc), BoletaIdentificationRule) {
+		t.Errorf("USD 200 a 3.50 son S/ 700, no superan el umbral")
+	}
+	doc.ExchangeRate = 3.51
+	if !hasRule(validator.ValidateBusinessDocument(doc), BoletaIdentificationRule) {
+		t.Errorf("USD 200 a 3.51 son S/ 702, superan el umbral")
+	}
+
+	doc.ExchangeRate = 0
+	errors := validator.ValidateBusinessDocument(doc)
+	found := false
+	for _, e := range errors {
+		found = found || (e.Rule == BoletaIdentificationRule && e.Field == "exchangeRate")
+	}
+	if !found {
+		t.Errorf("sin tipo de cambio la boleta en USD sin cliente debe reportar exchangeRate: %v", errors)
+	}
+}
+
+func TestBoletaIdentificationWarningMode(t *testing.T) {
+	service := newMemoryService()
+	service.GetValidator().SetBoletaIdentificationCheck(BoletaIdentificationWarning)
+
+	doc := anonymousBoleta(5000)
+	if hasRule(service.GetValidator().ValidateBusinessDocument(doc), BoletaIdentificationRule) {
+		t.Errorf("en modo warning la regla no debe ser un error")
+	}
+	ctx, _ := service.ValidateDocument(context.Background(), doc)
+	if !hasRule(ctx.Warnings, BoletaIdentificationRule) {
+		t.Errorf("en modo warning la boleta sin cliente debe advertirse: %v", ctx.Warnings)
+	}
+
+	service.GetValidator().SetBoletaIdentificationCheck(BoletaIdentificationOff)
+	ctx, _ = service.ValidateDocument(context.Background(), anonymousBoleta(5000))
+	if hasRule(ctx.Warnings, BoletaIdentificationRule) {
+		t.Errorf("con la regla desactivada no se advierte")
+	}
+}
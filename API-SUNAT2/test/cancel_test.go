@@ -0,0 +1,181 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+// cancellingStore cancela la operación después de la primera escritura
+type cancellingStore struct {
+	*storage.MemoryStore
+	cancel context.CancelFunc
+}
+
+func (s cancellingStore) Save(name string, data []byte) (string, error) {
+	path, err := s.MemoryStore.Save(name, data)
+	s.cancel()
+	return path, err
+}
+
+// cancelStep cancela la operación al ejecutarse
+type cancelStep struct {
+	cancel context.CancelFunc
+}
+
+func (c cancelStep) Name() string                   { return "cancel" }
+func (c cancelStep) Run(ctx *PipelineContext) error { c.cancel(); return nil }
+
+// assertCancelled verifica el código ERR_CANCELLED y que el store quedó vacío
+func assertCancelled(t *testing.T, name string, err error, store storage.DocumentStore) {
+	t.Helper()
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Code != ErrCancelledCode {
+		t.Errorf("%s: se esperaba %s, obtenido %v", name, ErrCancelledCode, err)
+	}
+	if names, _ := store.List(); len(names) != 0 {
+		t.Errorf("%s: quedaron archivos huérfanos: %v", name, names)
+	}
+}
+
+func TestPipelineCancelledBetweenStages(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	for _, stage := range []string{"validate", "convert", "sign", "save", "zip"} {
+		service := newMemoryService()
+		ctx, cancel := context.WithCancel(context.Background())
+		pipeline := service.NewDefaultPipeline()
+		pipeline.SetStageObserver(func(name string, _ time.Duration) {
+			if name == stage {
+				cancel()
+			}
+		})
+
+		_, err := pipeline.Run(ctx, sampleDocument(), certPEM, keyPEM)
+		cancel()
+		assertCancelled(t, "cancelado en "+stage, err, service.GetStore())
+	}
+}
+
+func TestProcessDocumentAlreadyCancelled(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	resp, err := service.ProcessDocument(ctx, sampleDocument(), certPEM, keyPEM)
+	if err != nil || resp.Status != "ERROR" || resp.ErrorCode != ErrCancelledCode {
+		t.Errorf("se esperaba %s, obtenido %v %+v", ErrCancelledCode, err, resp)
+	}
+	if names, _ := service.GetStore().List(); len(names) != 0 {
+		t.Errorf("quedaron archivos huérfanos: %v", names)
+	}
+}
+
+func TestCancelledWriteCleansPartialArtifacts(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := cancellingStore{MemoryStore: storage.NewMemoryStore(), cancel: cancel}
+	service.SetStore(store)
+
+	_, err := service.NewDefaultPipeline().Run(ctx, sampleDocument(), certPEM, keyPEM)
+	assertCancelled(t, "cancelado durante la escritura", err, store)
+}
+
+func TestCancelledStepKeepsWrittenArtifacts(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Un paso posterior a la escritura, como el envío a SUNAT, ya recibió los artefactos
+	var calls []string
+	pipeline := service.NewDefaultPipeline()
+	pipeline.AddStep(cancelStep{cancel: cancel})
+	pipeline.AddStep(recordingStep{calls: &calls})
+
+	result, err := pipeline.Run(ctx, sampleDocument(), certPEM, keyPEM)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Code != ErrCancelledCode {
+		t.Errorf("se esperaba %s, obtenido %v", ErrCancelledCode, err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("no se esperaba ejecutar pasos después de cancelar: %v", calls)
+	}
+	for _, name := range result.Artifacts {
+		if _, err := service.GetStore().Read(name); err != nil {
+			t.Errorf("la cancelación posterior a la escritura eliminó %s: %v", name, err)
+		}
+	}
+	if len(result.Artifacts) == 0 {
+		t.Error("se esperaban los artefactos escritos en el contexto")
+	}
+}
+
+func TestCancelledReprocessRestoresArtifacts(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	memory := storage.NewMemoryStore()
+	service.SetStore(memory)
+	first, err := service.NewDefaultPipeline().Run(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := map[string][]byte{}
+	for _, name := range first.Artifacts {
+		issued[name], _ = memory.Read(name)
+	}
+
+	// El reproceso sobrescribe el XML y se cancela antes de terminar de escribir
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service.SetStore(cancellingStore{MemoryStore: memory, cancel: cancel})
+	doc := sampleDocument()
+	doc.Items[0].Description = "Producto A reprocesado"
+	_, err = service.NewDefaultPipeline().Run(ctx, doc, certPEM, keyPEM)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Code != ErrCancelledCode {
+		t.Fatalf("se esperaba %s, obtenido %v", ErrCancelledCode, err)
+	}
+
+	// El registro de tamaños del emisor no es un artefacto del documento
+	var names []string
+	all, _ := memory.List()
+	for _, name := range all {
+		if !strings.HasSuffix(name, XMLSizesSuffix) {
+			names = append(names, name)
+		}
+	}
+	if len(names) != len(issued) {
+		t.Errorf("se esperaban solo los artefactos emitidos %d, quedaron %v", len(issued), names)
+	}
+	for name, data := range issued {
+		if current, err := memory.Read(name); err != nil || !bytes.Equal(current, data) {
+			t.Errorf("%s no se restauró al contenido emitido: %v", name, err)
+		}
+	}
+}
+
+func TestJobContextTimeout(t *testing.T) {
+	service := newMemoryService()
+	service.SetJobTimeout(50 * time.Millisecond)
+
+	ctx, cancel := service.JobContext()
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > 50*time.Millisecond {
+		t.Errorf("se esperaba un vencimiento de 50ms, obtenido %v", deadline)
+	}
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("se esperaba DeadlineExceeded, obtenido %v", ctx.Err())
+	}
+}
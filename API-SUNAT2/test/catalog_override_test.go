@@ -0,0 +1,194 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/catalog"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/service"
+)
+
+// writeCodeList escribe una lista de códigos en el directorio de overrides
+func writeCodeList(t *testing.T, dir, name string, list interface{}) {
+	t.Helper()
+	data, ok := list.(string)
+	if !ok {
+		encoded, err := json.Marshal(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = string(encoded)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// unitsOverride es el catálogo 03 embebido con la unidad KT agregada
+func unitsOverride(version, validFrom string) catalog.CodeList {
+	var codes []catalog.Code
+	for _, code := range catalog.Codes(catalog.UnitOfMeasure) {
+		if code.Code != "KT" {
+			codes = append(codes, code)
+		}
+	}
+	codes = append(codes, catalog.Code{Code: "KT", Description: "Kit"})
+	return catalog.CodeList{ID: catalog.UnitOfMeasure, Name: "Unidades de medida", Version: version, ValidFrom: validFrom, Codes: codes}
+}
+
+func TestCatalogOverrideApplied(t *testing.T) {
+	defer catalog.ResetOverrides()
+	dir := t.TempDir()
+	writeCodeList(t, dir, "03.json", unitsOverride("2025.01", "2025-01-01"))
+
+	service := newMemoryService()
+	service.SetClock(&fixedClock{now: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)})
+	doc := sampleDocument()
+	doc.Items[0].UnitCode = "KT"
+	if errs := service.GetValidator().ValidateBusinessDocument(doc); len(errs) == 0 {
+		t.Fatal("KT no es una unidad del catálogo embebido")
+	}
+	rulesHash := service.RulesHash()
+
+	overrides, err := service.LoadCatalogOverrides(dir)
+	if err != nil || len(overrides) != 1 || !overrides[0].Active || overrides[0].Source != catalog.SourceOverride {
+		t.Fatalf("el override debió aplicarse: %v %+v", err, overrides)
+	}
+	if version := catalog.Version(); version != "2024.06+03@2025.01" {
+		t.Errorf("versión de catálogos: %s", version)
+	}
+	if service.RulesHash() == rulesHash {
+		t.Error("el hash de las reglas debe cambiar con el override")
+	}
+	if errs := DocumentSchema().Validate(documentJSON(t, doc)); len(errs) > 0 {
+		t.Errorf("el schema debe aceptar la unidad del override: %+v", errs)
+	}
+
+	// El documento con la unidad nueva se procesa y registra la versión de catálogos
+	documentID := processForSending(t, service, doc)
+	record := readDocumentRecord(t, service.GetStore(), documentID)
+	if record.Engine == nil || record.Engine.CatalogVersion != "2024.06+03@2025.01" {
+		t.Errorf("versión registrada: %+v", record.Engine)
+	}
+
+	catalog.ResetOverrides()
+	if catalog.HasCode(catalog.UnitOfMeasure, "KT") || catalog.Version() != "2024.06" {
+		t.Error("ResetOverrides debe volver a los catálogos embebidos")
+	}
+}
+
+func TestCatalogOverrideInvalid(t *testing.T) {
+	defer catalog.ResetOverrides()
+	valid := t.TempDir()
+	writeCodeList(t, valid, "03.json", unitsOverride("2025.01", "2025-01-01"))
+	if _, err := catalog.LoadOverrides(valid, "2025-03-01"); err != nil {
+		t.Fatal(err)
+	}
+
+	means := `{"id":"59","name":"Medios de pago","version":"2025.01","validFrom":"2025-01-01","codes":[%s]}`
+	cases := []struct {
+		name  string
+		file  string
+		error string
+	}{
+		{"campo desconocido", `{"id":"59","version":"2025.01","validFrom":"2025-01-01","vigente":true,"codes":[{"code":"001","description":"Depósito en cuenta"}]}`, "unknown field"},
+		{"catálogo desconocido", `{"id":"99","version":"2025.01","validFrom":"2025-01-01","codes":[{"code":"001","description":"Otro"}]}`, `unknown catalog "99"`},
+		{"sin versión", `{"id":"59","validFrom":"2025-01-01","codes":[{"code":"001","description":"Depósito en cuenta"}]}`, "version is required"},
+		{"fecha inválida", `{"id":"59","version":"2025.01","validFrom":"01/01/2025","codes":[{"code":"001","description":"Depósito en cuenta"}]}`, "validFrom"},
+		{"sin códigos", strings.Replace(means, "%s", "", 1), "codes is empty"},
+		{"código fuera de formato", strings.Replace(means, "%s", `{"code":"1","description":"Depósito en cuenta"}`, 1), "does not match"},
+		{"sin descripción", strings.Replace(means, "%s", `{"code":"001","description":" "}`, 1), "has no description"},
+		{"código repetido", strings.Replace(means, "%s", `{"code":"001","description":"A"},{"code":"001","description":"B"}`, 1), "code 001 is repeated"},
+		{"JSON inválido", `{"id":"59"`, "invalid JSON"},
+	}
+	for _, tc := range cases {
+		dir := t.TempDir()
+		writeCodeList(t, dir, "03.json", unitsOverride("2025.02", "2025-02-01"))
+		writeCodeList(t, dir, "59.json", tc.file)
+		_, err := catalog.LoadOverrides(dir, "2025-03-01")
+		if err == nil || !strings.Contains(err.Error(), tc.error) || !strings.Contains(err.Error(), "59.json") {
+			t.Errorf("%s: se esperaba un error con %q, obtenido %v", tc.name, tc.error, err)
+		}
+		// Un archivo inválido invalida la carga completa: sigue el override anterior
+		if version := catalog.Version(); version != "2024.06+03@2025.01" {
+			t.Errorf("%s: la carga inválida cambió los catálogos activos: %s", tc.name, version)
+		}
+	}
+
+	// El mismo catálogo en dos archivos es ambiguo
+	dir := t.TempDir()
+	writeCodeList(t, dir, "03.json", unitsOverride("2025.02", "2025-02-01"))
+	writeCodeList(t, dir, "units.json", unitsOverride("2025.03", "2025-02-15"))
+	if _, err := catalog.LoadOverrides(dir, "2025-03-01"); err == nil || !strings.Contains(err.Error(), "defined twice") {
+		t.Errorf("se esperaba un error por catálogo duplicado: %v", err)
+	}
+
+	// Al arrancar con un directorio inválido se usan los catálogos embebidos
+	catalog.ResetOverrides()
+	invalid := t.TempDir()
+	writeCodeList(t, invalid, "59.json", `{"id":"59"`)
+	router, _ := api.NewRouter(&config.Config{XMLStorePath: t.TempDir(), CatalogOverridePath: invalid})
+	rec := doRequest(router, http.MethodGet, "/api/v1/version", nil)
+	if !strings.Contains(rec.Body.String(), `"catalogVersion":"2024.06"`) {
+		t.Errorf("se esperaban los catálogos embebidos: %s", rec.Body.String())
+	}
+}
+
+func TestCatalogOverridePrecedence(t *testing.T) {
+	defer catalog.ResetOverrides()
+	dir := t.TempDir()
+	writeCodeList(t, dir, "03.json", unitsOverride("2025.01", "2025-01-01"))
+	// Rige desde una fecha futura: todavía no se aplica
+	writeCodeList(t, dir, "59.json", catalog.CodeList{ID: catalog.PaymentMeans, Version: "2099.01", ValidFrom: "2099-01-01", Codes: []catalog.Code{{Code: "001", Description: "Depósito en cuenta"}}})
+	// Es anterior a la lista embebida: no la reemplaza
+	writeCodeList(t, dir, "09.json", catalog.CodeList{ID: catalog.CreditNoteReason, Version: "2023.01", ValidFrom: "2023-01-01", Codes: []catalog.Code{{Code: "01", Description: "Anulación de la operación"}}})
+
+	router, _ := api.NewRouter(&config.Config{XMLStorePath: t.TempDir(), CatalogOverridePath: dir})
+	rec := doRequest(router, http.MethodGet, "/api/v1/version", nil)
+	var info VersionInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("código %d: %s", rec.Code, rec.Body.String())
+	}
+	if info.CatalogVersion != "2024.06+03@2025.01" {
+		t.Errorf("versión de catálogos: %s", info.CatalogVersion)
+	}
+	sources := map[string]string{}
+	for _, list := range info.CatalogLists {
+		sources[list.ID] = list.Source + "@" + list.Version
+	}
+	want := map[string]string{
+		catalog.UnitOfMeasure:      "override@2025.01",
+		catalog.CreditNoteReason:   "embedded@2024.06",
+		catalog.DebitNoteReason:    "embedded@2024.06",
+		catalog.ItemClassification: "embedded@2024.06",
+		catalog.PaymentMeans:       "embedded@2024.06",
+	}
+	for id, source := range want {
+		if sources[id] != source {
+			t.Errorf("catálogo %s: se esperaba %s, obtenido %s", id, source, sources[id])
+		}
+	}
+	// Los códigos que el override anterior no trae siguen vigentes
+	if !catalog.HasCode(catalog.CreditNoteReason, "13") || !catalog.HasCode(catalog.PaymentMeans, "003") {
+		t.Error("las listas no aplicadas deben seguir siendo las embebidas")
+	}
+
+	overrides, err := catalog.LoadOverrides(dir, "2099-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]string{}
+	for _, override := range overrides {
+		reasons[override.ID] = override.Reason
+	}
+	if !strings.Contains(reasons[catalog.CreditNoteReason], "more recent") || reasons[catalog.PaymentMeans] != "" || catalog.HasCode(catalog.PaymentMeans, "003") {
+		t.Errorf("al llegar su vigencia el override 59 debe aplicarse: %+v", overrides)
+	}
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// codedElements lista los elementos con atributos de catálogo del XML, uno por línea
+// con sus atributos en orden y su valor
+func codedElements(t *testing.T, xmlData []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	decoder := xml.NewDecoder(bytes.NewReader(xmlData))
+	var current *xml.StartElement
+	var value string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("XML inválido: %v", err)
+		}
+		switch tok := token.(type) {
+		case xml.StartElement:
+			current, value = nil, ""
+			if !hasCatalogAttr(tok) {
+				continue
+			}
+			start := tok.Copy()
+			current = &start
+		case xml.CharData:
+			value += string(tok)
+		case xml.EndElement:
+			if current == nil {
+				continue
+			}
+			fmt.Fprint(&out, current.Name.Local)
+			for _, attr := range current.Attr {
+				fmt.Fprintf(&out, " %s=%q", attr.Name.Local, attr.Value)
+			}
+			fmt.Fprintf(&out, " = %s\n", strings.TrimSpace(value))
+			current = nil
+		}
+	}
+	return out.Bytes()
+}
+
+// hasCatalogAttr indica si el elemento tiene atributos de lista, de esquema o de unidad
+func hasCatalogAttr(start xml.StartElement) bool {
+	for _, attr := range start.Attr {
+		for _, prefix := range []string{"list", "scheme", "unitCode"} {
+			if strings.HasPrefix(attr.Name.Local, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// assertCatalogGolden compara los elementos codificados del XML contra testdata/golden
+func assertCatalogGolden(t *testing.T, name string, doc *BusinessDocument) {
+	t.Helper()
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := codedElements(t, xmlData)
+
+	path := filepath.Join("testdata", "golden", name+".txt")
+	if *updateGolden {
+		if err := os.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("no se pudo leer el golden file %s (ejecutar con -update para crearlo): %v", path, err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("los atributos de catálogo de %s cambiaron.\nesperado:\n%s\nobtenido:\n%s", name, expected, actual)
+	}
+}
+
+// referenceInvoice retorna la factura de ejemplo con los campos opcionales que emiten
+// códigos de catálogo
+func referenceInvoice() *BusinessDocument {
+	doc := sampleDocument()
+	doc.VehiclePlate = "ABC-123"
+	doc.ExchangedDocuments = []DocumentReference{{DocumentType: "03", DocumentID: "B001-1"}}
+	return doc
+}
+
+func TestCatalogAttributesInvoice(t *testing.T) {
+	assertCatalogGolden(t, "invoice_catalog_attributes", referenceInvoice())
+}
+
+func TestCatalogAttributesCreditNote(t *testing.T) {
+	assertCatalogGolden(t, "credit_note_catalog_attributes", sampleCreditNote("07", 1))
+}
+
+// catalogURIs retorna, por cada elemento con un catálogo SUNAT nombrado, su URI de
+// lista o de esquema (vacío si no lo lleva)
+func catalogURIs(t *testing.T, xmlData []byte) map[string][]string {
+	t.Helper()
+	uris := make(map[string][]string)
+	decoder := xml.NewDecoder(bytes.NewReader(xmlData))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return uris
+		}
+		if err != nil {
+			t.Fatalf("XML inválido: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		attrs := make(map[string]string)
+		for _, attr := range start.Attr {
+			attrs[attr.Name.Local] = attr.Value
+		}
+		for _, kind := range []string{"list", "scheme"} {
+			if attrs[kind+"AgencyName"] == catalog.AgencySunat && attrs[kind+"Name"] != "" {
+				key := start.Name.Local + " " + attrs[kind+"Name"]
+				uris[key] = append(uris[key], attrs[kind+"URI"])
+			}
+		}
+	}
+}
+
+func TestCatalogURICoverage(t *testing.T) {
+	// Establecimientos anexos no tiene un catálogo oficial con URI
+	establishment, _ := catalog.Lookup(catalog.Establishment)
+	for name, doc := range map[string]*BusinessDocument{"factura": referenceInvoice(), "nota de crédito": sampleCreditNote("07", 1)} {
+		xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uris := catalogURIs(t, xmlData)
+		if len(uris) == 0 {
+			t.Fatalf("%s: no se encontraron códigos de catálogo", name)
+		}
+		for element, values := range uris {
+			if strings.HasSuffix(element, " "+establishment.Name) {
+				continue
+			}
+			for _, uri := range values {
+				if !strings.HasPrefix(uri, catalog.URIPrefix) {
+					t.Errorf("%s: %s sin URI de catálogo (%q)", name, element, uri)
+				}
+			}
+		}
+	}
+}
+
+func TestCatalogURIsDisabled(t *testing.T) {
+	converter := NewUBLConverter(nil)
+	converter.SetCatalogURIs(false)
+	xmlData, err := converter.ConvertToUBL(referenceInvoice())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(xmlData), catalog.URIPrefix) {
+		t.Errorf("no se esperaban URI de catálogos:\n%s", xmlData)
+	}
+	// El resto de atributos del catálogo se conserva
+	enabled, _ := NewUBLConverter(nil).ConvertToUBL(referenceInvoice())
+	if got, want := len(catalogURIs(t, xmlData)), len(catalogURIs(t, enabled)); got != want || !strings.Contains(string(xmlData), `listAgencyName="PE:SUNAT"`) {
+		t.Errorf("se esperaban los mismos %d elementos codificados, se obtuvieron %d", want, got)
+	}
+
+	// Desde el servicio la opción también aplica al XML firmado
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetCatalogURIs(false)
+	if signed := signedXML(t, service, referenceInvoice(), certPEM, keyPEM); strings.Contains(string(signed), catalog.URIPrefix) {
+		t.Error("el XML firmado no debe llevar URI de catálogos")
+	}
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"github.com/gin-gonic/gin"
+)
+
+// cdrImportResponse es la respuesta de POST /api/v1/cdr/parse
+type cdrImportResponse struct {
+	DocumentID string            `json:"documentId"`
+	Warnings   []ValidationError `json:"warnings"`
+	Data       struct {
+		CDR              CDRResult            `json:"cdr"`
+		Associated       bool                 `json:"associated"`
+		Environment      string               `json:"environment"`
+		CDRFile          string               `json:"cdrFile"`
+		LineCountNumeric int                  `json:"lineCountNumeric"`
+		Currency         string               `json:"currency"`
+		Totals           *AccountingBreakdown `json:"totals"`
+	} `json:"data"`
+}
+
+// newCDRImportRouter emite la factura de ejemplo sin enviarla y retorna el router, el
+// servicio y un simulador que genera CDR firmados como los de SUNAT
+func newCDRImportRouter(t *testing.T) (*gin.Engine, *UBLConverterService, *MockSunatClient) {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newMemoryService()
+	service.SetClock(clock)
+	processForSending(t, service, sampleDocument())
+	router, _ := api.NewRouterWithService(&config.Config{
+		AdminAPIKey:   "secreto",
+		IssuerAPIKeys: "clave-emisor:20123456786",
+	}, service)
+	return router, service, NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{RejectSeries: []string{"F003"}}, clock)
+}
+
+// mockCDR genera el CDR del simulador para el ZIP de la factura de ejemplo enviado con
+// el nombre del documento indicado
+func mockCDR(t *testing.T, service *UBLConverterService, sunat *MockSunatClient, documentID string) []byte {
+	t.Helper()
+	zipData, err := service.GetStore().Read("20123456786-01-F003-123456.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdr, err := sunat.SendBill(context.Background(), documentID+".zip", zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cdr
+}
+
+func postCDR(t *testing.T, router http.Handler, cdr []byte, headers map[string]string) (*httptest.ResponseRecorder, cdrImportResponse) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"cdr": base64.StdEncoding.EncodeToString(cdr)})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/cdr/parse", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var resp cdrImportResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func TestCDRParseAssociatesDocument(t *testing.T) {
+	router, service, sunat := newCDRImportRouter(t)
+	publisher := &memoryPublisher{}
+	stop := service.StartEventPublisher(publisher, 10)
+
+	const documentID = "20123456786-01-F003-123456"
+	rec, resp := postCDR(t, router, mockCDR(t, service, sunat, documentID), map[string]string{"X-API-Key": "clave-emisor"})
+	stop()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código %d: %s", rec.Code, rec.Body.String())
+	}
+	if !resp.Data.Associated || resp.DocumentID != documentID || resp.Data.CDR.Status != CDRRejected || len(resp.Warnings) != 0 {
+		t.Fatalf("el CDR debe asociarse al documento: %s", rec.Body.String())
+	}
+	if resp.Data.LineCountNumeric != 1 || resp.Data.Currency != "PEN" || resp.Data.Totals == nil || resp.Data.Totals.Total != 118 || resp.Data.Totals.IGV != 18 {
+		t.Errorf("se esperaban las líneas, la moneda y los totales del XML emitido: %s", rec.Body.String())
+	}
+
+	// El documento queda como si el CDR hubiera llegado por el envío
+	lookup, err := service.FindDocument("20123456786", "01", "F003", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookup.Status != CDRRejected || lookup.CDR == nil || lookup.CDR.Environment != EnvironmentBeta || lookup.Artifacts["cdr"] == "" {
+		t.Errorf("el estado y el CDR del documento deben actualizarse: %+v", lookup)
+	}
+	events := publisher.published()
+	if len(events) != 1 || events[0].Type != DocumentRejectedEvent || events[0].DocumentID != documentID {
+		t.Errorf("se esperaba el evento de rechazo: %+v", events)
+	}
+}
+
+func TestCDRParseDocumentNotInStore(t *testing.T) {
+	router, service, sunat := newCDRImportRouter(t)
+	cdr := mockCDR(t, service, sunat, "20123456786-01-F003-999")
+	before, _ := service.GetStore().List()
+
+	rec, resp := postCDR(t, router, cdr, map[string]string{"X-API-Key": "clave-emisor"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código %d: %s", rec.Code, rec.Body.String())
+	}
+	if resp.Data.Associated || resp.Data.CDR.ReferenceID != "F003-999" || !hasRule(resp.Warnings, CDRDocumentNotFoundRule) {
+		t.Errorf("se esperaba solo el parseo con un warning: %s", rec.Body.String())
+	}
+	if names, _ := service.GetStore().List(); len(names) != len(before) {
+		t.Errorf("un CDR sin documento no debe guardarse: %v", names)
+	}
+}
+
+func TestCDRParseOtherIssuer(t *testing.T) {
+	router, service, sunat := newCDRImportRouter(t)
+	// Misma serie y número que la factura emitida, pero de otro RUC
+	cdr := mockCDR(t, service, sunat, "20100000001-01-F003-123456")
+
+	if rec, _ := postCDR(t, router, cdr, map[string]string{"X-API-Key": "clave-emisor"}); rec.Code != http.StatusForbidden {
+		t.Errorf("un emisor no debe importar el CDR de otro RUC: %d %s", rec.Code, rec.Body.String())
+	}
+	rec, resp := postCDR(t, router, cdr, map[string]string{"X-Admin-API-Key": "secreto"})
+	if rec.Code != http.StatusOK || resp.Data.Associated || resp.DocumentID != "20100000001-01-F003-123456" || !hasRule(resp.Warnings, CDRDocumentNotFoundRule) {
+		t.Errorf("el CDR de otro RUC no debe asociarse a la factura: %s", rec.Body.String())
+	}
+	if lookup, _ := service.FindDocument("20123456786", "01", "F003", "123456"); lookup.Status != DocumentGenerated {
+		t.Errorf("la factura del emisor no debe cambiar de estado: %s", lookup.Status)
+	}
+}
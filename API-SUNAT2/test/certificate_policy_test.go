@@ -0,0 +1,115 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func TestSelfSignedCertificateRejectedInProduction(t *testing.T) {
+	_, keyPEM := loadTestCredentials(t)
+	selfSigned := testCertificate(t, 7001, time.Now().AddDate(1, 0, 0))
+
+	service := newMemoryService()
+	service.GetSigner().SetCertificatePolicy(EnvironmentProduction, nil)
+	resp, err := service.ProcessDocument(context.Background(), sampleDocument(), selfSigned, keyPEM)
+	if err != nil || resp.ErrorCode != ErrCertNotAcceptedInProdCode {
+		t.Fatalf("se esperaba %s, obtenido %v %+v", ErrCertNotAcceptedInProdCode, err, resp)
+	}
+	if names, _ := service.GetStore().List(); len(names) != 0 {
+		t.Errorf("no se debe guardar nada con un certificado rechazado: %v", names)
+	}
+
+	// En beta el mismo certificado firma, con una advertencia
+	service = newMemoryService()
+	service.GetSigner().SetCertificatePolicy(EnvironmentBeta, nil)
+	resp, err = service.ProcessDocument(context.Background(), sampleDocument(), selfSigned, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("en beta debe firmar: %v %+v", err, resp)
+	}
+	if !hasRule(resp.Warnings, "certificate_not_accepted_in_production") {
+		t.Errorf("se esperaba la advertencia del certificado: %+v", resp.Warnings)
+	}
+}
+
+func TestCertificatePolicyAcceptedCAs(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	signer := NewDigitalSignatureService(nil)
+	signer.SetCertificatePolicy(EnvironmentProduction, nil)
+	if _, err := signer.SignXML([]byte(unsignedXML), certPEM, keyPEM); err != nil {
+		t.Fatalf("el certificado emitido por una CA debe aceptarse: %v", err)
+	}
+
+	signer.SetCertificatePolicy(EnvironmentProduction, []string{"llama.pe sha256 standard ca"})
+	if _, err := signer.SignXML([]byte(unsignedXML), certPEM, keyPEM); err != nil {
+		t.Fatalf("la CA acreditada se compara sin distinguir mayúsculas: %v", err)
+	}
+
+	signer.SetCertificatePolicy(EnvironmentProduction, []string{"Otra CA Acreditada"})
+	_, err := signer.SignXML([]byte(unsignedXML), certPEM, keyPEM)
+	var keyErr *KeyValidationError
+	if !errors.As(err, &keyErr) || keyErr.Code != ErrCertNotAcceptedInProdCode {
+		t.Fatalf("se esperaba %s con una CA no acreditada, se obtuvo %v", ErrCertNotAcceptedInProdCode, err)
+	}
+}
+
+func TestRegisterCertificateEndpoint(t *testing.T) {
+	selfSigned := testCertificate(t, 7002, time.Now().AddDate(1, 0, 0))
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+
+	register := func(environment string, certPEM []byte) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(CertificateRegistrationRequest{
+			RUC:         "20123456786",
+			Certificate: base64.StdEncoding.EncodeToString(certPEM),
+			Environment: environment,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/certificates", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin-API-Key", "secreto")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := register("desarrollo", selfSigned); rec.Code != http.StatusBadRequest {
+		t.Errorf("ambiente inválido: código %d", rec.Code)
+	}
+
+	rec := register(EnvironmentProduction, selfSigned)
+	var errResp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &errResp)
+	if rec.Code != http.StatusUnprocessableEntity || errResp.ErrorCode != ErrCertNotAcceptedInProdCode {
+		t.Fatalf("producción: código %d: %s", rec.Code, rec.Body.String())
+	}
+	if certificates, _ := service.ExpiringCertificates(3650); len(certificates) != 0 {
+		t.Errorf("el certificado rechazado no debe registrarse: %+v", certificates)
+	}
+
+	rec = register(EnvironmentBeta, selfSigned)
+	var resp struct {
+		Warnings []ValidationError `json:"warnings"`
+		Data     struct {
+			Certificate CertificateRecord `json:"certificate"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp.Data.Certificate.Environment != EnvironmentBeta {
+		t.Fatalf("beta: código %d: %s", rec.Code, rec.Body.String())
+	}
+	if !hasRule(resp.Warnings, "certificate_not_accepted_in_production") {
+		t.Errorf("se esperaba la advertencia del certificado: %+v", resp.Warnings)
+	}
+}
@@ -0,0 +1,244 @@
+package test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// testCertificate crea un certificado autofirmado con la clave de prueba que vence en notAfter
+func testCertificate(t *testing.T, serial int64, notAfter time.Time) []byte {
+	t.Helper()
+	_, keyPEM := loadTestCredentials(t)
+	block, _ := pem.Decode(keyPEM)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: fmt.Sprintf("Certificado de prueba %d", serial)},
+		NotBefore:    notAfter.AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.(crypto.Signer).Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// recordingNotifier registra las alertas recibidas; mientras fail no es nil las rechaza
+type recordingNotifier struct {
+	sent []ExpiringCertificate
+	fail error
+}
+
+func (n *recordingNotifier) NotifyCertificateExpiring(ctx context.Context, cert ExpiringCertificate) error {
+	if n.fail != nil {
+		return n.fail
+	}
+	n.sent = append(n.sent, cert)
+	return nil
+}
+
+// notified resume las alertas como "ruc:umbral"
+func (n *recordingNotifier) notified() []string {
+	var out []string
+	for _, cert := range n.sent {
+		out = append(out, fmt.Sprintf("%s:%d", cert.IssuerRUC, cert.Threshold))
+	}
+	return out
+}
+
+// newCertificateService registra certificados que vencen a distintos días del reloj simulado
+func newCertificateService(t *testing.T, clock *fixedClock) *UBLConverterService {
+	service := newMemoryService()
+	service.SetClock(clock)
+	for i, days := range []int{45, 20, 10, 3, -1} {
+		ruc := fmt.Sprintf("2010000000%d", i)
+		if _, err := service.RegisterCertificate(ruc, testCertificate(t, int64(i+1), clock.now.AddDate(0, 0, days))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return service
+}
+
+func TestCertificateExpiryAlerts(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newCertificateService(t, clock)
+	notifier := &recordingNotifier{}
+	service.SetCertificateNotifiers(notifier)
+	hook := logtest.NewLocal(service.GetLogger())
+
+	expiring, err := service.CheckCertificates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiring) != 4 || expiring[0].DaysLeft != -1 || expiring[3].DaysLeft != 20 {
+		t.Fatalf("se esperaban los 4 certificados dentro de 30 días ordenados por vencimiento: %+v", expiring)
+	}
+	want := "20100000004:0 20100000003:7 20100000002:15 20100000001:30"
+	if got := strings.Join(notifier.notified(), " "); got != want {
+		t.Errorf("alertas: %s, esperado %s", got, want)
+	}
+
+	levels := map[string]logrus.Level{}
+	for _, entry := range hook.AllEntries() {
+		levels[entry.Data["ruc"].(string)] = entry.Level
+	}
+	for ruc, level := range map[string]logrus.Level{
+		"20100000001": logrus.WarnLevel,
+		"20100000002": logrus.WarnLevel,
+		"20100000003": logrus.ErrorLevel,
+		"20100000004": logrus.ErrorLevel,
+	} {
+		if levels[ruc] != level {
+			t.Errorf("%s: nivel de log %v, esperado %v", ruc, levels[ruc], level)
+		}
+	}
+
+	// Al día siguiente no se repite ninguna alerta
+	clock.now = clock.now.AddDate(0, 0, 1)
+	notifier.sent = nil
+	service.CheckCertificates(context.Background())
+	if len(notifier.sent) != 0 {
+		t.Errorf("cada umbral se notifica una sola vez: %v", notifier.notified())
+	}
+
+	// Seis días después cada certificado alcanza el siguiente umbral
+	clock.now = clock.now.AddDate(0, 0, 6)
+	service.CheckCertificates(context.Background())
+	want = "20100000003:0 20100000002:7 20100000001:15"
+	if got := strings.Join(notifier.notified(), " "); got != want {
+		t.Errorf("alertas: %s, esperado %s", got, want)
+	}
+	records, _ := service.ListCertificates()
+	if fmt.Sprint(records[len(records)-2].NotifiedThresholds) != "[30 15]" {
+		t.Errorf("se esperaba registrar los umbrales notificados: %+v", records[len(records)-2])
+	}
+}
+
+func TestCertificateNotificationRetry(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newCertificateService(t, clock)
+	notifier := &recordingNotifier{fail: errors.New("webhook caído")}
+	service.SetCertificateNotifiers(notifier)
+
+	service.CheckCertificates(context.Background())
+	notifier.fail = nil
+	service.CheckCertificates(context.Background())
+	if len(notifier.sent) != 4 {
+		t.Errorf("las alertas no enviadas se reintentan en la siguiente revisión: %v", notifier.notified())
+	}
+}
+
+func TestCertificateRegisteredOnSigning(t *testing.T) {
+	_, keyPEM := loadTestCredentials(t)
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newMemoryService()
+	service.SetClock(clock)
+	notifier := &recordingNotifier{}
+	service.SetCertificateNotifiers(notifier)
+
+	doc := sampleDocument()
+	resp, err := service.ProcessDocument(context.Background(), doc, testCertificate(t, 100, clock.now.AddDate(0, 0, 10)), keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("%v %+v", err, resp)
+	}
+	service.CheckCertificates(context.Background())
+	if got := notifier.notified(); len(got) != 1 || got[0] != "20123456786:15" {
+		t.Fatalf("se esperaba alertar el certificado con que firmó el emisor: %v", got)
+	}
+
+	// Al renovar el certificado se reinician los umbrales notificados
+	doc.Number = "123457"
+	service.ProcessDocument(context.Background(), doc, testCertificate(t, 101, clock.now.AddDate(0, 0, 5)), keyPEM)
+	service.CheckCertificates(context.Background())
+	if got := notifier.notified(); len(got) != 2 || got[1] != "20123456786:7" {
+		t.Errorf("el certificado nuevo debe notificarse desde cero: %v", got)
+	}
+}
+
+func TestExpiringCertificatesEndpoint(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newCertificateService(t, clock)
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+	headers := map[string]string{"X-Admin-API-Key": "secreto"}
+
+	if rec := doRequest(router, http.MethodGet, "/api/v1/certificates/expiring", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("sin API key: código %d", rec.Code)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/certificates/expiring?days=-1", headers); rec.Code != http.StatusBadRequest {
+		t.Errorf("days inválido: código %d", rec.Code)
+	}
+
+	var resp struct {
+		Data struct {
+			Certificates []ExpiringCertificate `json:"certificates"`
+		} `json:"data"`
+	}
+	rec := doRequest(router, http.MethodGet, "/api/v1/certificates/expiring?days=15", headers)
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Data.Certificates) != 3 || resp.Data.Certificates[2].IssuerRUC != "20100000002" {
+		t.Errorf("se esperaban los 3 certificados dentro de 15 días: %d %s", rec.Code, rec.Body.String())
+	}
+
+	service.CheckCertificates(context.Background())
+	rec = doRequest(router, http.MethodGet, "/api/v1/admin/metrics", headers)
+	for _, line := range []string{
+		`certificates_expiring{ruc="20100000001",days="30"} 1`,
+		`certificates_expiring{ruc="20100000003",days="7"} 1`,
+		`certificates_expiring{ruc="20100000004",days="0"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Errorf("falta %s en las métricas:\n%s", line, rec.Body.String())
+		}
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var event struct {
+		Event       string              `json:"event"`
+		Certificate ExpiringCertificate `json:"certificate"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&event)
+		if event.Certificate.IssuerRUC == "20100000009" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL, nil)
+	cert := ExpiringCertificate{CertificateRecord: CertificateRecord{IssuerRUC: "20123456786"}, DaysLeft: 6, Threshold: 7}
+	if err := notifier.NotifyCertificateExpiring(context.Background(), cert); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != CertificateExpiringEvent || event.Certificate.Threshold != 7 {
+		t.Errorf("evento recibido: %+v", event)
+	}
+	cert.IssuerRUC = "20100000009"
+	if err := notifier.NotifyCertificateExpiring(context.Background(), cert); err == nil {
+		t.Error("un status distinto de 2xx debe ser error")
+	}
+}
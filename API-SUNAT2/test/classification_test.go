@@ -0,0 +1,81 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+)
+
+func TestClassificationCodeEmitted(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	doc := sampleDocument()
+	doc.Items[0].ClassificationCode = "43211503"
+	resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("procesamiento falló: %v %+v", err, resp)
+	}
+	content, _ := service.GetStore().Read(resp.DocumentID + ".xml")
+	expected := `<cbc:ItemClassificationCode listAgencyName="GS1 US" listID="UNSPSC" listName="Item Classification">43211503</cbc:ItemClassificationCode>`
+	if !strings.Contains(string(content), expected) {
+		t.Errorf("falta %s en el XML", expected)
+	}
+}
+
+func TestClassificationCodeValidation(t *testing.T) {
+	service := newMemoryService()
+	for _, code := range []string{"4321150", "432115030", "4321150A", "99111500"} {
+		doc := sampleDocument()
+		doc.Items[0].ClassificationCode = code
+		resp, err := service.ProcessDocument(context.Background(), doc, nil, nil)
+		if err != nil || !hasRule(resp.ValidationErrors, "classification_code_validation") {
+			t.Errorf("%s: se esperaba classification_code_validation: %v %+v", code, err, resp.ValidationErrors)
+		}
+	}
+
+	// Por HTTP el formato lo rechaza el schema con la misma regla
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+	doc := sampleDocument()
+	doc.Items[0].ClassificationCode = "4321-1503"
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/validate", doc)
+	var httpResp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &httpResp)
+	if rec.Code != http.StatusBadRequest || !hasRule(httpResp.ValidationErrors, "classification_code_validation") {
+		t.Errorf("se esperaba 400 con classification_code_validation, obtenido %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestClassificationCodeMissing(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	doc := sampleDocument()
+	doc.Items[0].ClassificationCode = ""
+
+	// Sin código la línea no lleva CommodityClassification y solo se advierte a los obligados
+	resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" || hasRule(resp.Warnings, "classification_code_missing") {
+		t.Fatalf("emisor no obligado: %v %+v", err, resp)
+	}
+	content, _ := service.GetStore().Read(resp.DocumentID + ".xml")
+	if strings.Contains(string(content), "CommodityClassification") {
+		t.Error("una línea sin código no debe emitir cac:CommodityClassification")
+	}
+
+	service.GetValidator().SetClassificationIssuers([]string{"20123456786"})
+	doc.Number = "123457"
+	resp, err = service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" || !hasRule(resp.Warnings, "classification_code_missing") {
+		t.Fatalf("emisor obligado: se esperaba el warning classification_code_missing: %v %+v", err, resp)
+	}
+	for _, warning := range resp.Warnings {
+		if warning.Rule == "classification_code_missing" && warning.Field != "items[0].classificationCode" {
+			t.Errorf("campo del warning: %+v", warning)
+		}
+	}
+}
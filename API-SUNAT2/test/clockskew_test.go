@@ -0,0 +1,192 @@
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/service"
+)
+
+// mockTimeSource es una fuente de hora que reporta un desvío fijo o un error
+type mockTimeSource struct {
+	offset time.Duration
+	err    error
+}
+
+func (m *mockTimeSource) Offset(ctx context.Context) (time.Duration, error) {
+	return m.offset, m.err
+}
+
+func (m *mockTimeSource) String() string {
+	return "mock"
+}
+
+func TestClockSkewLevels(t *testing.T) {
+	cases := []struct {
+		name   string
+		mode   string
+		offset time.Duration
+		status string
+	}{
+		{"desvío menor al umbral", ClockSkewWarning, 5 * time.Second, ClockOK},
+		{"reloj adelantado sobre el umbral", ClockSkewWarning, -45 * time.Second, ClockDrifting},
+		{"sobre el máximo en modo warning", ClockSkewWarning, 3 * time.Minute, ClockDrifting},
+		{"entre umbral y máximo en modo estricto", ClockSkewStrict, 90 * time.Second, ClockDrifting},
+		{"atrasado sobre el máximo en modo estricto", ClockSkewStrict, 3 * time.Minute, ClockBlocking},
+		{"adelantado sobre el máximo en modo estricto", ClockSkewStrict, -3 * time.Minute, ClockBlocking},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := newMemoryService()
+			service.SetClockSkewCheck(&mockTimeSource{offset: tc.offset}, ClockSkewOptions{Mode: tc.mode})
+			status, err := service.CheckClockSkew(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Status != tc.status || status.DriftMs != tc.offset.Milliseconds() {
+				t.Errorf("se esperaba %s con %v: %+v", tc.status, tc.offset, status)
+			}
+		})
+	}
+}
+
+func TestClockSkewBlocksEmission(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	source := &mockTimeSource{offset: 5 * time.Minute}
+	service.SetClockSkewCheck(source, ClockSkewOptions{Mode: ClockSkewStrict, MaxSkew: time.Minute})
+
+	process := func(number string) string {
+		doc := sampleDocument()
+		doc.Number = number
+		response, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.ErrorCode
+	}
+
+	// Antes del primer chequeo no se bloquea
+	if code := process("1"); code != "" {
+		t.Fatalf("sin chequeo no debe bloquearse: %s", code)
+	}
+
+	service.CheckClockSkew(context.Background())
+	if code := process("2"); code != ErrClockSkewCode {
+		t.Fatalf("se esperaba %s, se obtuvo %q", ErrClockSkewCode, code)
+	}
+
+	// Una fuente caída no bloquea la emisión
+	source.err = errors.New("timeout")
+	if status, err := service.CheckClockSkew(context.Background()); err == nil || status.Status != ClockUnknown || status.ConsecutiveFailures != 1 {
+		t.Fatalf("se esperaba el estado unknown: %+v %v", status, err)
+	}
+	if code := process("3"); code != "" {
+		t.Errorf("con la fuente caída no debe bloquearse: %s", code)
+	}
+
+	// Corregido el reloj se vuelve a emitir
+	source.err, source.offset = nil, 200*time.Millisecond
+	service.CheckClockSkew(context.Background())
+	if code := process("4"); code != "" {
+		t.Errorf("con el reloj corregido no debe bloquearse: %s", code)
+	}
+}
+
+func TestClockSkewReadinessAndMetrics(t *testing.T) {
+	service := newMemoryService()
+	source := &mockTimeSource{offset: -10 * time.Second}
+	service.SetClockSkewCheck(source, ClockSkewOptions{Mode: ClockSkewStrict})
+	service.CheckClockSkew(context.Background())
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+
+	rec := doRequest(router, http.MethodGet, "/health/ready", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"driftMs":-10000`) {
+		t.Fatalf("se esperaba ready con el desvío: %d %s", rec.Code, rec.Body.String())
+	}
+
+	source.offset = 10 * time.Minute
+	service.CheckClockSkew(context.Background())
+	rec = doRequest(router, http.MethodGet, "/health/ready", nil)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"status":"blocking"`) {
+		t.Errorf("se esperaba 503 con la emisión bloqueada: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/v1/admin/metrics", map[string]string{"X-Admin-API-Key": "secreto"})
+	if !strings.Contains(rec.Body.String(), `clock_drift_seconds{source="mock"} 600.000`) {
+		t.Errorf("se esperaba la métrica del desvío:\n%s", rec.Body.String())
+	}
+}
+
+// fakeNTPServer responde las peticiones SNTP con la hora local desplazada en offset
+func fakeNTPServer(t *testing.T, offset time.Duration) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no se pudo abrir un puerto UDP: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	putTime := func(b []byte, at time.Time) {
+		binary.BigEndian.PutUint32(b[0:4], uint32(at.Unix()+2208988800))
+		binary.BigEndian.PutUint32(b[4:8], uint32((int64(at.Nanosecond())<<32)/1e9))
+	}
+	go func() {
+		request := make([]byte, 48)
+		for {
+			_, addr, err := conn.ReadFrom(request)
+			if err != nil {
+				return
+			}
+			response := make([]byte, 48)
+			response[0] = 0x24 // versión 4, modo 4 (servidor)
+			response[1] = 2
+			now := time.Now().Add(offset)
+			putTime(response[32:40], now)
+			putTime(response[40:48], now)
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNTPTimeSource(t *testing.T) {
+	source := NewNTPTimeSource(fakeNTPServer(t, 90*time.Second))
+	offset, err := source.Offset(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs((offset - 90*time.Second).Seconds()) > 0.5 {
+		t.Errorf("se esperaba un desvío de 90s, se obtuvo %v", offset)
+	}
+	if !strings.HasPrefix(NewTimeSource("ntp://time.example.pe", nil).String(), "ntp://time.example.pe:123") {
+		t.Error("sin puerto debe usarse el 123")
+	}
+}
+
+func TestHTTPDateTimeSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-2*time.Minute).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	source := NewTimeSource(server.URL, server.Client())
+	offset, err := source.Offset(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// La cabecera Date tiene resolución de segundos
+	if math.Abs((offset + 2*time.Minute).Seconds()) > 1 {
+		t.Errorf("se esperaba un desvío de -2m, se obtuvo %v", offset)
+	}
+}
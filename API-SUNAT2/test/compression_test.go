@@ -0,0 +1,167 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/util"
+	"github.com/gin-gonic/gin"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gunzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("la respuesta no es gzip válido: %v", err)
+	}
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plain
+}
+
+func TestGzipRoundTrip(t *testing.T) {
+	cfg := &config.Config{AdminAPIKey: "admin-key"}
+	router, _ := api.NewRouterWithService(cfg, newMemoryService())
+	body, _ := json.Marshal(sampleDocument())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/validate", bytes.NewReader(gzipBytes(t, body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("se esperaba 200, obtenido %d: %s", rec.Code, rec.Body.String())
+	}
+	// La respuesta de /validate es chica: no llega al mínimo y se envía sin comprimir
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("una respuesta menor a GZIP_MIN_SIZE no debería comprimirse")
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp["status"] != "success" {
+		t.Fatalf("respuesta inesperada: %s", rec.Body.String())
+	}
+
+	// /schema/document supera el mínimo y se comprime
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/schema/document", nil)
+	req.Header.Set("Accept-Encoding", "br;q=1.0, gzip;q=0.8")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("se esperaba la respuesta comprimida, cabeceras %v", rec.Header())
+	}
+	if !json.Valid(gunzipBytes(t, rec.Body.Bytes())) {
+		t.Errorf("la respuesta descomprimida no es JSON válido")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/admin/metrics", nil)
+	req.Header.Set("X-Admin-API-Key", "admin-key")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	for _, metric := range []string{`http_gzip_requests_total{result="decompressed"} 1`, "http_gzip_responses_total 1", "http_gzip_response_ratio 0."} {
+		if !strings.Contains(rec.Body.String(), metric) {
+			t.Errorf("falta la métrica %q en %s", metric, rec.Body.String())
+		}
+	}
+}
+
+func TestGzipWithoutAcceptEncoding(t *testing.T) {
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+
+	rec := doJSONRequest(router, http.MethodGet, "/api/v1/schema/document", nil)
+	if rec.Header().Get("Content-Encoding") != "" || !json.Valid(rec.Body.Bytes()) {
+		t.Errorf("sin Accept-Encoding la respuesta no debería comprimirse")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/schema/document", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("gzip;q=0 rechaza gzip, la respuesta no debería comprimirse")
+	}
+}
+
+func TestGzipRejectsZipBomb(t *testing.T) {
+	cfg := &config.Config{GzipMaxDecompressedBytes: 1024 * 1024}
+	router, _ := api.NewRouterWithService(cfg, newMemoryService())
+
+	// 64 MB de espacios se comprimen en unos pocos KB
+	bomb := gzipBytes(t, bytes.Repeat([]byte(" "), 64*1024*1024))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/validate", bytes.NewReader(bomb))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "ERR_PAYLOAD_TOO_LARGE") {
+		t.Fatalf("se esperaba 413 ERR_PAYLOAD_TOO_LARGE, obtenido %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Justo en el límite se acepta
+	exact := gzipBytes(t, bytes.Repeat([]byte(" "), 1024*1024))
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/validate", bytes.NewReader(exact))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code == http.StatusRequestEntityTooLarge {
+		t.Errorf("un body expandido igual al límite no debería rechazarse")
+	}
+}
+
+func TestGzipInvalidEncodings(t *testing.T) {
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+
+	for encoding, status := range map[string]int{"gzip": http.StatusBadRequest, "br": http.StatusUnsupportedMediaType} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/validate", strings.NewReader(`{"type":"01"}`))
+		req.Header.Set("Content-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != status {
+			t.Errorf("Content-Encoding %s: se esperaba %d, obtenido %d", encoding, status, rec.Code)
+		}
+	}
+}
+
+func TestGzipSkipsZIPDownloads(t *testing.T) {
+	metrics := NewCompressionMetrics()
+	router := gin.New()
+	router.Use(GzipMiddleware(GzipOptions{MinSize: 10}, metrics))
+	payload := bytes.Repeat([]byte("PK"), 4096)
+	router.GET("/zip", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/zip", payload)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/zip", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" || !bytes.Equal(rec.Body.Bytes(), payload) {
+		t.Errorf("un ZIP no debería recomprimirse")
+	}
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+// consolidatedCreditNote retorna una nota de crédito de 118.00 que ajusta las facturas
+// F003-1, F003-2 y F003-3 con los montos indicados
+func consolidatedCreditNote(amounts ...float64) *BusinessDocument {
+	doc := sampleCreditNote("07", 2)
+	doc.Reference = nil
+	for i, amount := range amounts {
+		doc.References = append(doc.References, DocumentReference{
+			DocumentType: "01",
+			DocumentID:   "F003-" + string(rune('1'+i)),
+			IssueDate:    "2024-06-07",
+			Reason:       "Devolución parcial",
+			ReasonCode:   "07",
+			Amount:       FlexFloat(amount),
+		})
+	}
+	return doc
+}
+
+// issueInvoices emite las facturas F003-1 a F003-n de 118.00
+func issueInvoices(t *testing.T, service *UBLConverterService, n int) {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	for i := 1; i <= n; i++ {
+		invoice := sampleDocument()
+		invoice.Number = string(rune('0' + i))
+		if resp, _ := service.ProcessDocument(context.Background(), invoice, certPEM, keyPEM); resp.Status != "SUCCESS" {
+			t.Fatalf("factura %s no emitida: %+v", invoice.Number, resp)
+		}
+	}
+}
+
+func TestConsolidatedNoteXML(t *testing.T) {
+	for _, docType := range []string{"07", "08"} {
+		note := consolidatedCreditNote(40, 40, 38)
+		note.Type = docType
+		if docType == "08" {
+			note.Series = "FD01"
+			for i := range note.References {
+				note.References[i].ReasonCode = "02"
+			}
+		}
+		if errs := NewValidationService(nil).ValidateBusinessDocument(note); len(errs) > 0 {
+			t.Fatalf("tipo %s: nota consolidada inválida: %+v", docType, errs)
+		}
+		xmlData, err := NewUBLConverter(nil).ConvertToUBL(note)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xml := string(xmlData)
+		if n := strings.Count(xml, "<cac:BillingReference>"); n != 3 {
+			t.Errorf("tipo %s: se esperaban 3 cac:BillingReference, obtenido %d", docType, n)
+		}
+		if n := strings.Count(xml, "<cac:DiscrepancyResponse>"); n != 3 {
+			t.Errorf("tipo %s: se esperaban 3 cac:DiscrepancyResponse, obtenido %d", docType, n)
+		}
+		for _, id := range []string{"F003-1", "F003-2", "F003-3"} {
+			if !strings.Contains(xml, "<cbc:ReferenceID>"+id+"</cbc:ReferenceID>") {
+				t.Errorf("tipo %s: falta la discrepancia de %s", docType, id)
+			}
+		}
+	}
+}
+
+func TestConsolidatedNoteAmountsMismatch(t *testing.T) {
+	errs := NewValidationService(nil).ValidateBusinessDocument(consolidatedCreditNote(40, 40, 30))
+	if !hasRule(errs, "note_references_total") {
+		t.Fatalf("se esperaba note_references_total: %+v", errs)
+	}
+	for _, ve := range errs {
+		if ve.Rule == "note_references_total" && (ve.Expected != "118.00" || ve.Received != "110.00") {
+			t.Errorf("suma de referencias: %+v", ve)
+		}
+	}
+
+	note := consolidatedCreditNote(40, 40, 38)
+	note.References[1].Amount = 0
+	note.References[2].Amount = 78
+	if errs := NewValidationService(nil).ValidateBusinessDocument(note); !hasRule(errs, "note_references_validation") {
+		t.Errorf("una referencia sin monto debe fallar: %+v", errs)
+	}
+
+	note = consolidatedCreditNote(40, 40, 38)
+	note.Reference = &DocumentReference{DocumentType: "01", DocumentID: "F003-1"}
+	if errs := NewValidationService(nil).ValidateBusinessDocument(note); !hasRule(errs, "note_references_validation") {
+		t.Errorf("reference y references juntos deben fallar: %+v", errs)
+	}
+}
+
+func TestConsolidatedNoteCustomer(t *testing.T) {
+	note := consolidatedCreditNote(40, 40, 38)
+	note.References[2].CustomerDocumentID = "87654321"
+	errs := NewValidationService(nil).ValidateBusinessDocument(note)
+	if !hasRule(errs, "note_references_customer") {
+		t.Fatalf("se esperaba note_references_customer: %+v", errs)
+	}
+
+	// Contra el store: la tercera factura es de otro cliente
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	issueInvoices(t, service, 2)
+	other := sampleDocument()
+	other.Number = "3"
+	other.Customer.DocumentID = "87654321"
+	if resp, _ := service.ProcessDocument(context.Background(), other, certPEM, keyPEM); resp.Status != "SUCCESS" {
+		t.Fatalf("factura de otro cliente no emitida: %+v", resp)
+	}
+	resp, err := service.ProcessDocument(context.Background(), consolidatedCreditNote(40, 40, 38), certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, ve := range resp.ValidationErrors {
+		if ve.Rule == "note_references_customer" {
+			found = ve.Field == "references[2].documentId"
+		}
+	}
+	if !found {
+		t.Errorf("se esperaba note_references_customer en references[2]: %+v", resp.ValidationErrors)
+	}
+}
+
+func TestConsolidatedNoteBalance(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	store := storage.NewMemoryStore()
+	service := newMemoryService()
+	service.SetStore(store)
+	service.SetCheckNoteBalance(true)
+	issueInvoices(t, service, 3)
+
+	resp, err := service.ProcessDocument(context.Background(), consolidatedCreditNote(40, 40, 38), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("nota consolidada: %v %+v", err, resp)
+	}
+	data, err := store.Read(RecordName("20123456786-07-FC01-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record DocumentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.AffectedDocumentID != "20123456786-01-F003-1" || len(record.AffectedDocuments) != 3 || record.AffectedDocuments[2].Amount != 38 {
+		t.Errorf("registro de la nota consolidada: %+v %+v", record.AffectedDocumentID, record.AffectedDocuments)
+	}
+
+	// A F003-1 le quedan 78.00: una nota de 118.00 lo excede, una de 59.00 no
+	note := sampleCreditNote("07", 2)
+	note.Number = "2"
+	note.Reference.DocumentID = "F003-1"
+	resp, _ = service.ProcessDocument(context.Background(), note, certPEM, keyPEM)
+	if !hasRule(resp.ValidationErrors, "credit_note_balance_exceeded") {
+		t.Fatalf("se esperaba credit_note_balance_exceeded: %+v", resp)
+	}
+	for _, ve := range resp.ValidationErrors {
+		if ve.Rule == "credit_note_balance_exceeded" && ve.Expected != "At most 78.00" {
+			t.Errorf("saldo de F003-1: %+v", ve)
+		}
+	}
+	note = sampleCreditNote("07", 1)
+	note.Number = "3"
+	note.Reference.DocumentID = "F003-1"
+	if resp, _ := service.ProcessDocument(context.Background(), note, certPEM, keyPEM); resp.Status != "SUCCESS" {
+		t.Errorf("nota dentro del saldo: %+v", resp.ValidationErrors)
+	}
+
+	// Una referencia que excede el saldo de su factura se reporta en su monto
+	over := consolidatedCreditNote(20, 60, 38)
+	over.Number = "4"
+	resp, _ = service.ProcessDocument(context.Background(), over, certPEM, keyPEM)
+	found := false
+	for _, ve := range resp.ValidationErrors {
+		if ve.Rule == "credit_note_balance_exceeded" {
+			found = ve.Field == "references[0].amount" && ve.Expected == "At most 19.00"
+		}
+	}
+	if !found {
+		t.Errorf("se esperaba el exceso de F003-1 en references[0].amount: %+v", resp.ValidationErrors)
+	}
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+)
+
+func TestContingencyInvoice(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+
+	doc := sampleDocument()
+	doc.Series = "0001"
+	doc.Number = "125"
+	doc.Contingency = true
+
+	response, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil || response.Status != "SUCCESS" {
+		t.Fatalf("emisión de contingencia falló: %v %+v", err, response)
+	}
+
+	content, err := service.GetStore().Read("20123456786-01-0001-125.xml")
+	if err != nil {
+		t.Fatalf("no se encontró el XML: %v", err)
+	}
+	for _, want := range []string{"<cbc:ID>0001-125</cbc:ID>", "<cbc:Note>COMPROBANTE DE CONTINGENCIA</cbc:Note>"} {
+		if !strings.Contains(string(content), want) {
+			t.Fatalf("se esperaba %q en el XML", want)
+		}
+	}
+	if marker, err := service.GetStore().Read("20123456786-01-0001-125.contingencia"); err != nil || string(marker) != doc.IssueDate {
+		t.Fatalf("se esperaba la marca de contingencia en el store: %v", err)
+	}
+}
+
+func TestContingencySeriesValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	doc := sampleDocument()
+	doc.Contingency = true
+	if !hasRule(validator.ValidateBusinessDocument(doc), "contingency_series_validation") {
+		t.Fatalf("se esperaba rechazo de contingencia con serie electrónica F003")
+	}
+
+	doc = sampleDocument()
+	doc.Series = "0001"
+	if !hasRule(validator.ValidateBusinessDocument(doc), "contingency_series_validation") {
+		t.Fatalf("se esperaba rechazo de serie numérica sin indicar contingencia")
+	}
+}
@@ -0,0 +1,273 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	"github.com/gin-gonic/gin"
+)
+
+var updateGolden = flag.Bool("update", false, "regenera los golden files de contrato")
+
+// volatileFields son los campos que cambian entre ejecuciones y se reemplazan antes de comparar
+var volatileFields = []string{"correlationId", "processedAt", "duration", "xmlHash", "fileSize", "zipSize", "zipHash", "rulesHash"}
+
+func doJSONRequest(handler http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	switch b := body.(type) {
+	case nil:
+	case string:
+		payload = []byte(b)
+	default:
+		payload, _ = json.Marshal(b)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func newContractRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	service := newMemoryService()
+	service.SetClock(&fixedClock{now: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)})
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+	return router
+}
+
+func convertRequest(t *testing.T, doc *BusinessDocument) map[string]interface{} {
+	certPEM, keyPEM := loadTestCredentials(t)
+	return map[string]interface{}{
+		"document":    doc,
+		"certificate": base64.StdEncoding.EncodeToString(certPEM),
+		"privateKey":  base64.StdEncoding.EncodeToString(keyPEM),
+	}
+}
+
+// normalizeVolatile reemplaza recursivamente los valores que no son parte del contrato
+func normalizeVolatile(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			normalizeVolatile(inner)
+			for _, field := range volatileFields {
+				if key == field {
+					v[key] = "<" + field + ">"
+				}
+			}
+		}
+	case []interface{}:
+		for _, inner := range v {
+			normalizeVolatile(inner)
+		}
+	}
+}
+
+// assertGolden compara el código HTTP y el cuerpo JSON normalizado contra testdata/golden
+func assertGolden(t *testing.T, name string, rec *httptest.ResponseRecorder) {
+	t.Helper()
+
+	var body interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("respuesta no es JSON: %v: %s", err, rec.Body.String())
+	}
+	normalizeVolatile(body)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(map[string]interface{}{
+		"httpStatus": rec.Code,
+		"body":       body,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	actual := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("no se pudo leer el golden file %s (ejecutar con -update para crearlo): %v", path, err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("el contrato de %s cambió.\nesperado:\n%s\nobtenido:\n%s", name, expected, actual)
+	}
+}
+
+func TestV1ContractGolden(t *testing.T) {
+	router := newContractRouter(t)
+
+	invalidDoc := sampleDocument()
+	invalidDoc.Currency = "XXX"
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"v1_convert_success", http.MethodPost, "/api/v1/convert", convertRequest(t, sampleDocument())},
+		{"v1_convert_validation_error", http.MethodPost, "/api/v1/convert", convertRequest(t, invalidDoc)},
+		{"v1_convert_invalid_certificate", http.MethodPost, "/api/v1/convert", map[string]interface{}{
+			"document":    sampleDocument(),
+			"certificate": "%%%",
+		}},
+		{"v1_convert_invalid_request", http.MethodPost, "/api/v1/convert", "{"},
+		{"v1_validate_success", http.MethodPost, "/api/v1/validate", sampleDocument()},
+		{"v1_validate_failure", http.MethodPost, "/api/v1/validate", invalidDoc},
+		{"v1_status", http.MethodGet, "/api/v1/status/abc-123", nil},
+		{"v1_xml_not_found", http.MethodGet, "/api/v1/xml/missing.xml", nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertGolden(t, tc.name, doJSONRequest(router, tc.method, tc.path, tc.body))
+		})
+	}
+
+	// El estado de un documento procesado, con su correlationId
+	t.Run("v1_status_success", func(t *testing.T) {
+		var converted APIResponse
+		rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", convertRequest(t, sampleDocument()))
+		if err := json.Unmarshal(rec.Body.Bytes(), &converted); err != nil || converted.CorrelationID == "" {
+			t.Fatalf("conversión sin correlationId: %v %s", err, rec.Body.String())
+		}
+		assertGolden(t, "v1_status_success", doJSONRequest(router, http.MethodGet, "/api/v1/status/"+converted.CorrelationID, nil))
+	})
+}
+
+func TestV2Contract(t *testing.T) {
+	router := newContractRouter(t)
+
+	rec := doJSONRequest(router, http.MethodPost, "/api/v2/convert", convertRequest(t, sampleDocument()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código HTTP = %d, esperado 200: %s", rec.Code, rec.Body.String())
+	}
+	var resp api.V2Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != api.V2StatusSuccess {
+		t.Errorf("status = %q, esperado %q", resp.Status, api.V2StatusSuccess)
+	}
+	if resp.Document == nil || resp.Document.ID != "20123456786-01-F003-123456" {
+		t.Errorf("document inesperado: %+v", resp.Document)
+	}
+	if resp.Timings == nil {
+		t.Fatal("se esperaban timings por etapa")
+	}
+	if _, ok := resp.Timings.Stages["sign"]; !ok {
+		t.Errorf("falta la etapa sign en timings: %v", resp.Timings.Stages)
+	}
+
+	// Ambas versiones comparten el servicio: el XML generado por v2 se lee desde v1
+	fileName, _ := resp.Data["fileName"].(string)
+	if rec := doJSONRequest(router, http.MethodGet, "/api/v1/xml/"+fileName, nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /api/v1/xml/%s = %d, esperado 200", fileName, rec.Code)
+	}
+
+	invalidDoc := sampleDocument()
+	invalidDoc.Currency = "XXX"
+	rec = doJSONRequest(router, http.MethodPost, "/api/v2/convert", convertRequest(t, invalidDoc))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("código HTTP = %d, esperado 422", rec.Code)
+	}
+	resp = api.V2Response{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != api.V2StatusError || resp.Error == nil || resp.Error.Code != "VALIDATION_FAILED" {
+		t.Errorf("error inesperado: status=%q error=%+v", resp.Status, resp.Error)
+	}
+	if len(resp.Error.Details) == 0 {
+		t.Error("se esperaban detalles de validación")
+	}
+}
+
+// normalizedBody decodifica la respuesta y reemplaza los campos volátiles
+func normalizedBody(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("respuesta no es JSON: %v: %s", err, rec.Body.String())
+	}
+	normalizeVolatile(body)
+	return body
+}
+
+func TestValidationResponseConsistency(t *testing.T) {
+	invalidDoc := sampleDocument()
+	invalidDoc.Currency = "XXX"
+	invalidDoc.Issuer.DocumentID = "123"
+
+	// v1 solo unifica las respuestas si se activa explícitamente
+	cases := []struct {
+		name    string
+		version string
+		cfg     *config.Config
+		status  int
+	}{
+		{"default", "v2", &config.Config{}, http.StatusUnprocessableEntity},
+		{"configurado", "v2", &config.Config{ValidationErrorStatus: http.StatusBadRequest}, http.StatusBadRequest},
+		{"unificado", "v1", &config.Config{V1UnifiedValidation: true}, http.StatusUnprocessableEntity},
+		{"unificado configurado", "v1", &config.Config{V1UnifiedValidation: true, ValidationErrorStatus: http.StatusBadRequest}, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name+"/"+tc.version, func(t *testing.T) {
+			router, _ := api.NewRouterWithService(tc.cfg, newMemoryService())
+
+			validate := doJSONRequest(router, http.MethodPost, "/api/"+tc.version+"/validate", invalidDoc)
+			convert := doJSONRequest(router, http.MethodPost, "/api/"+tc.version+"/convert", convertRequest(t, invalidDoc))
+
+			if validate.Code != tc.status || convert.Code != tc.status {
+				t.Fatalf("códigos HTTP validate=%d convert=%d, esperado %d", validate.Code, convert.Code, tc.status)
+			}
+
+			validateBody, convertBody := normalizedBody(t, validate), normalizedBody(t, convert)
+			for field, value := range validateBody {
+				if !reflect.DeepEqual(value, convertBody[field]) {
+					t.Errorf("campo %s: validate=%v convert=%v", field, value, convertBody[field])
+				}
+			}
+			for field := range convertBody {
+				if _, ok := validateBody[field]; !ok {
+					t.Errorf("campo %s solo está en /convert", field)
+				}
+			}
+		})
+	}
+
+	// Sin activarlo, v1 conserva el contrato congelado: /validate responde 400 y /convert 200
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+	if rec := doJSONRequest(router, http.MethodPost, "/api/v1/validate", invalidDoc); rec.Code != http.StatusBadRequest || normalizedBody(t, rec)["errorCode"] != "ERR_VALIDATION_FAILED" {
+		t.Errorf("v1 /validate: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", convertRequest(t, invalidDoc)); rec.Code != http.StatusOK || normalizedBody(t, rec)["errorCode"] != "VALIDATION_FAILED" {
+		t.Errorf("v1 /convert: %d %s", rec.Code, rec.Body.String())
+	}
+}
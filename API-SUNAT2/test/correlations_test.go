@@ -0,0 +1,128 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+)
+
+func TestDocumentReprocessedCorrelations(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newMemoryService()
+	service.SetClock(clock)
+
+	// El documento se procesa, un reintento falla la validación y se reprocesa corregido
+	invalid := sampleDocument()
+	invalid.Currency = "XXX"
+	var responses []*APIResponse
+	for _, doc := range []*BusinessDocument{sampleDocument(), invalid, sampleDocument()} {
+		resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+		clock.now = clock.now.Add(time.Minute)
+	}
+	if responses[0].Status != "SUCCESS" || responses[1].Status == "SUCCESS" || responses[2].Status != "SUCCESS" {
+		t.Fatalf("resultados inesperados: %s %s %s", responses[0].Status, responses[1].Status, responses[2].Status)
+	}
+
+	router, _ := api.NewRouterWithService(&config.Config{
+		AdminAPIKey:   "secreto",
+		IssuerAPIKeys: "clave-emisor:20123456786, clave-otro:20100000001",
+	}, service)
+	const documentID = "20123456786-01-F003-123456"
+
+	// Cada correlationId lleva al documento y a sus artefactos actuales
+	issuerKey := map[string]string{"X-API-Key": "clave-emisor"}
+	for i, processed := range responses {
+		rec := doRequest(router, http.MethodGet, "/api/v1/status/"+processed.CorrelationID, issuerKey)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: código %d %s", i, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			DocumentID string `json:"documentId"`
+			Data       struct {
+				Result    string            `json:"result"`
+				ErrorCode string            `json:"errorCode"`
+				Artifacts map[string]string `json:"artifacts"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.DocumentID != documentID || resp.Data.Result != processed.Status || resp.Data.ErrorCode != processed.ErrorCode {
+			t.Errorf("status %d inesperado: %s", i, rec.Body.String())
+		}
+		if resp.Data.Artifacts["xml"] == "" || resp.Data.Artifacts["record"] == "" {
+			t.Errorf("status %d: faltan artefactos: %v", i, resp.Data.Artifacts)
+		}
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/status/desconocido", issuerKey); rec.Code != http.StatusNotFound {
+		t.Errorf("un correlationId desconocido debe responder 404, obtenido %d", rec.Code)
+	}
+
+	// Con API keys de emisor el estado solo lo consultan el emisor del documento y admin
+	status := "/api/v1/status/" + responses[0].CorrelationID
+	for _, tc := range []struct {
+		headers map[string]string
+		code    int
+	}{
+		{nil, http.StatusUnauthorized},
+		{map[string]string{"X-API-Key": "clave-otro"}, http.StatusForbidden},
+		{map[string]string{"X-Admin-API-Key": "secreto"}, http.StatusOK},
+	} {
+		for _, version := range []string{"v1", "v2"} {
+			path := "/api/" + version + "/status/" + responses[0].CorrelationID
+			if rec := doRequest(router, http.MethodGet, path, tc.headers); rec.Code != tc.code {
+				t.Errorf("%s con %v: se esperaba %d, obtenido %d %s", path, tc.headers, tc.code, rec.Code, rec.Body.String())
+			}
+		}
+	}
+	if rec := doRequest(router, http.MethodGet, status, map[string]string{"X-API-Key": "clave-otro"}); strings.Contains(rec.Body.String(), documentID) {
+		t.Errorf("la respuesta prohibida no debe revelar el documento: %s", rec.Body.String())
+	}
+
+	// El documento lista sus tres procesamientos en orden cronológico
+	path := "/api/v1/correlations/" + documentID
+	if rec := doRequest(router, http.MethodGet, path, map[string]string{"X-API-Key": "clave-otro"}); rec.Code != http.StatusForbidden {
+		t.Errorf("otro emisor no debe ver las correlaciones, obtenido %d", rec.Code)
+	}
+	rec := doRequest(router, http.MethodGet, path, map[string]string{"X-API-Key": "clave-emisor"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Correlations []CorrelationRecord `json:"correlations"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Correlations) != 3 {
+		t.Fatalf("se esperaban 3 procesamientos: %s", rec.Body.String())
+	}
+	for i, correlation := range resp.Data.Correlations {
+		if correlation.CorrelationID != responses[i].CorrelationID || correlation.Status != responses[i].Status || correlation.XMLHash != responses[i].XMLHash {
+			t.Errorf("procesamiento %d inesperado: %+v", i, correlation)
+		}
+		if i > 0 && !correlation.ProcessedAt.After(resp.Data.Correlations[i-1].ProcessedAt) {
+			t.Errorf("los procesamientos deben estar en orden cronológico: %+v", resp.Data.Correlations)
+		}
+	}
+	if resp.Data.Correlations[1].ErrorCode != "VALIDATION_FAILED" {
+		t.Errorf("el reintento fallido debe conservar su código: %+v", resp.Data.Correlations[1])
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/correlations/20123456786-01-F003-999", map[string]string{"X-API-Key": "clave-emisor"}); rec.Code != http.StatusNotFound {
+		t.Errorf("un documento sin procesamientos debe responder 404, obtenido %d", rec.Code)
+	}
+}
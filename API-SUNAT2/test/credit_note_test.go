@@ -0,0 +1,256 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// sampleCreditNote retorna una nota de crédito sobre la factura F003-123456 de
+// sampleDocument (total 118.00) con el motivo indicado y 59.00 por unidad
+func sampleCreditNote(reasonCode string, quantity float64) *BusinessDocument {
+	doc := sampleDocument()
+	doc.Type = "07"
+	doc.Series = "FC01"
+	doc.Number = "1"
+	doc.Reference = &DocumentReference{
+		DocumentType: "01",
+		DocumentID:   "F003-123456",
+		IssueDate:    "2024-06-07",
+		Reason:       "Motivo de prueba",
+		ReasonCode:   reasonCode,
+	}
+
+	subTotal, tax := 50*quantity, 9*quantity
+	doc.Items[0].Quantity = FlexFloat(quantity)
+	doc.Items[0].LineTotal = FlexFloat(subTotal)
+	doc.Items[0].Taxes = []Tax{{TaxType: "1000", TaxAmount: FlexFloat(tax), TaxRate: 18, TaxBase: FlexFloat(subTotal)}}
+	doc.Totals = DocumentTotals{SubTotal: FlexFloat(subTotal), TotalTaxes: FlexFloat(tax), TotalAmount: FlexFloat(subTotal + tax), PayableAmount: FlexFloat(subTotal + tax)}
+	doc.Taxes = []TaxTotal{{TaxType: "1000", TaxAmount: FlexFloat(tax), TaxRate: 18, TaxBase: FlexFloat(subTotal)}}
+	return doc
+}
+
+func TestCreditNoteReasonRules(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	cases := []struct {
+		reason   string
+		quantity float64
+		rule     string
+	}{
+		{"01", 2, ""},
+		{"01", 1, "reason_total_equal"},
+		{"02", 2, ""},
+		{"02", 1, "reason_total_equal"},
+		{"04", 1, ""},
+		{"04", 2, ""},
+		{"04", 3, "reason_total_not_exceed"},
+		{"06", 2, ""},
+		{"06", 3, "reason_total_equal"},
+		{"13", 2, ""},
+		{"13", 1, "reason_total_equal"},
+		{"07", 1, ""},
+		// Sin motivo se emite con el 01, pero una nota parcial no se rechaza
+		{"", 1, ""},
+	}
+
+	for _, tc := range cases {
+		service := newMemoryService()
+		if resp, _ := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM); resp.Status != "SUCCESS" {
+			t.Fatalf("factura afectada no emitida: %+v", resp)
+		}
+
+		resp, err := service.ProcessDocument(context.Background(), sampleCreditNote(tc.reason, tc.quantity), certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.rule == "" {
+			if resp.Status != "SUCCESS" {
+				t.Errorf("motivo %s x%.0f: se esperaba éxito, obtenido %+v", tc.reason, tc.quantity, resp.ValidationErrors)
+			}
+			continue
+		}
+		if !hasRule(resp.ValidationErrors, tc.rule) {
+			t.Errorf("motivo %s x%.0f: se esperaba la regla %s, obtenido %+v", tc.reason, tc.quantity, tc.rule, resp.ValidationErrors)
+			continue
+		}
+		for _, ve := range resp.ValidationErrors {
+			if ve.Rule == tc.rule && !strings.HasPrefix(ve.Message, "Motivo "+tc.reason) {
+				t.Errorf("el error debe citar el motivo %s: %q", tc.reason, ve.Message)
+			}
+		}
+	}
+}
+
+func TestCreditNoteReasonUnverifiedWarning(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+
+	// Sin la factura afectada en el store la regla no se puede verificar
+	resp, err := service.ProcessDocument(context.Background(), sampleCreditNote("01", 1), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("se esperaba éxito con warning: %v %+v", err, resp)
+	}
+	if !hasRule(resp.Warnings, "credit_note_reason_unverified") {
+		t.Errorf("se esperaba el warning credit_note_reason_unverified, obtenido %+v", resp.Warnings)
+	}
+}
+
+func TestNoteReasonCatalogValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	cases := []struct {
+		docType string
+		reason  string
+		valid   bool
+	}{
+		{"07", "", true},
+		{"07", "13", true},
+		{"07", "14", false},
+		{"08", "03", true},
+		{"08", "04", false},
+	}
+	for _, tc := range cases {
+		doc := sampleCreditNote(tc.reason, 2)
+		doc.Type = tc.docType
+		invalid := hasRule(validator.ValidateBusinessDocument(doc), "note_reason_validation")
+		if invalid == tc.valid {
+			t.Errorf("tipo %s motivo %q: válido esperado %v", tc.docType, tc.reason, tc.valid)
+		}
+	}
+}
+
+func TestNoteReasonCodeSerialized(t *testing.T) {
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(sampleCreditNote("04", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(xmlData), ">04</cbc:ResponseCode>") {
+		t.Error("se esperaba el motivo 04 en cbc:ResponseCode")
+	}
+}
+
+// warningRules retorna las reglas de los warnings de la respuesta
+func warningRules(resp *APIResponse) []string {
+	var rules []string
+	for _, w := range resp.Warnings {
+		rules = append(rules, w.Rule)
+	}
+	return rules
+}
+
+func TestCreditNoteBalance(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetCheckNoteBalance(true)
+	if resp, _ := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM); resp.Status != "SUCCESS" {
+		t.Fatalf("factura afectada no emitida: %+v", resp)
+	}
+
+	// Dos devoluciones por ítem de 59.00 agotan el total de 118.00
+	for _, number := range []string{"1", "2", "2"} {
+		note := sampleCreditNote("07", 1)
+		note.Number = number
+		resp, err := service.ProcessDocument(context.Background(), note, certPEM, keyPEM)
+		if err != nil || resp.Status != "SUCCESS" {
+			t.Fatalf("nota %s: %v %+v", number, err, resp.ValidationErrors)
+		}
+	}
+
+	note := sampleCreditNote("07", 1)
+	note.Number = "3"
+	resp, err := service.ProcessDocument(context.Background(), note, certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasRule(resp.ValidationErrors, "credit_note_balance_exceeded") {
+		t.Fatalf("se esperaba credit_note_balance_exceeded: %+v", resp)
+	}
+	for _, ve := range resp.ValidationErrors {
+		if ve.Rule == "credit_note_balance_exceeded" && (ve.Expected != "At most 0.00" || ve.Suggestion == "") {
+			t.Errorf("saldo disponible: %+v", ve)
+		}
+	}
+}
+
+func TestCreditNoteBalanceUnknownReference(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetCheckNoteBalance(true)
+
+	resp, err := service.ProcessDocument(context.Background(), sampleCreditNote("07", 1), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("una referencia desconocida no debe impedir la emisión: %v %+v", err, resp)
+	}
+	if !hasRule(resp.Warnings, "credit_note_affected_unknown") {
+		t.Errorf("se esperaba el warning credit_note_affected_unknown: %v", warningRules(resp))
+	}
+
+	// Sin la regla habilitada no se consulta el store
+	service = newMemoryService()
+	resp, _ = service.ProcessDocument(context.Background(), sampleCreditNote("07", 1), certPEM, keyPEM)
+	if hasRule(resp.Warnings, "credit_note_affected_unknown") {
+		t.Errorf("la regla es opcional: %v", warningRules(resp))
+	}
+}
+
+func TestCreditNoteOnVoidedDocument(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetCheckNoteBalance(true)
+	boleta := sampleBoleta("1")
+	if resp, _ := service.ProcessDocument(context.Background(), boleta, certPEM, keyPEM); resp.Status != "SUCCESS" {
+		t.Fatalf("boleta no emitida: %+v", resp)
+	}
+	if resp, _ := service.VoidDocument(DocumentIDOf(boleta), "Error en la venta"); resp.Status != "SUCCESS" {
+		t.Fatalf("boleta no anulada: %+v", resp)
+	}
+
+	note := sampleCreditNote("07", 1)
+	note.Series = "BC01"
+	note.Reference.DocumentType = "03"
+	note.Reference.DocumentID = "B001-1"
+	resp, err := service.ProcessDocument(context.Background(), note, certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasRule(resp.ValidationErrors, "credit_note_affected_voided") {
+		t.Errorf("se esperaba credit_note_affected_voided: %+v", resp)
+	}
+}
+
+func TestCreditNoteSignedAndZipped(t *testing.T) {
+	service := newMemoryService()
+	documentID := processForSending(t, service, sampleCreditNote("01", 1))
+	if documentID != "20123456786-07-FC01-1" {
+		t.Fatalf("documento inesperado: %s", documentID)
+	}
+	xmlData, err := service.GetStore().Read(documentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(xmlData)
+	for _, fragment := range []string{
+		`xmlns="urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"`,
+		"<cbc:ID>FC01-1</cbc:ID>",
+		"<cac:DiscrepancyResponse>",
+		"<cbc:ReferenceID>F003-123456</cbc:ReferenceID>",
+		"<cac:InvoiceDocumentReference>",
+		"<cac:CreditNoteLine>",
+		"<ds:SignatureValue>",
+	} {
+		if !strings.Contains(xml, fragment) {
+			t.Errorf("falta %s en:\n%s", fragment, xml)
+		}
+	}
+	results, err := service.GetSigner().VerifySignatures(xmlData)
+	if err != nil || len(results) != 1 || !results[0].Valid {
+		t.Errorf("la firma de la nota debe ser válida: %v %+v", err, results)
+	}
+	if _, err := service.GetStore().Read(documentID + ".zip"); err != nil {
+		t.Errorf("la nota debe empaquetarse: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func TestTaxpayerNameSimilarity(t *testing.T) {
+	const official = "COMERCIALIZADORA ANDINA DEL PERÚ SOCIEDAD ANONIMA CERRADA"
+	cases := []struct {
+		name     string
+		sent     string
+		matching bool
+	}{
+		{"idéntica", official, true},
+		{"abreviatura S.A.C.", "Comercializadora Andina del Perú S.A.C.", true},
+		{"abreviatura SAC sin tildes", "COMERCIALIZADORA ANDINA DEL PERU SAC", true},
+		{"sigla con espacios", "Comercializadora Andina del Peru S. A. C.", true},
+		{"error de tipeo", "COMERCIALISADORA ANDINA DEL PERU SAC", true},
+		{"otro orden de palabras", "ANDINA DEL PERU COMERCIALIZADORA SAC", true},
+		{"otra empresa", "DISTRIBUIDORA LIMEÑA EIRL", false},
+		{"nombre incompleto", "ANDINA SAC", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			similarity := TaxpayerNameSimilarity(tc.sent, official)
+			if matching := similarity >= DefaultCustomerNameSimilarity; matching != tc.matching {
+				t.Errorf("similitud %.2f de %q, se esperaba coincidencia=%v", similarity, tc.sent, tc.matching)
+			}
+		})
+	}
+
+	if similarity := TaxpayerNameSimilarity("PEREZ GOMEZ JUAN CARLOS", "Juan Carlos Pérez Gómez"); similarity != 1 {
+		t.Errorf("el orden de las palabras no debe importar: %.2f", similarity)
+	}
+	if similarity := TaxpayerNameSimilarity("Servicios Generales E.I.R.L.", "SERVICIOS GENERALES EMPRESA INDIVIDUAL DE RESPONSABILIDAD LIMITADA"); similarity != 1 {
+		t.Errorf("E.I.R.L. debe equivaler a la forma completa: %.2f", similarity)
+	}
+}
+
+func TestCustomerNameMismatchWarning(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	padron := &mockPadron{status: &TaxpayerStatus{Name: "COMERCIALIZADORA ANDINA DEL PERU S.A.C.", State: "ACTIVO", Condition: "HABIDO"}}
+
+	service := newMemoryService()
+	service.SetPadronClient(NewCachedPadronClient(padron, time.Hour, &fixedClock{now: time.Now()}))
+	service.SetCustomerNameCheck(DefaultCustomerNameSimilarity)
+
+	process := func(number, name string) *APIResponse {
+		doc := sampleDocument()
+		doc.Number = number
+		doc.Customer.DocumentType = CustomerDocumentRUC
+		doc.Customer.DocumentID = "20123456794"
+		doc.Customer.Name = name
+		response, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	// Una razón social distinta se advierte, pero el documento se emite
+	response := process("1", "DISTRIBUIDORA LIMEÑA EIRL")
+	if response.Status != "SUCCESS" {
+		t.Fatalf("la razón social no debe bloquear la emisión: %+v", response)
+	}
+	var warning *ValidationError
+	for i := range response.Warnings {
+		if response.Warnings[i].Rule == "customer_name_mismatch" {
+			warning = &response.Warnings[i]
+		}
+	}
+	if warning == nil || warning.Expected != padron.status.Name || warning.Suggestion == "" {
+		t.Fatalf("se esperaba el warning con la razón social oficial: %+v", response.Warnings)
+	}
+
+	// Una variación tolerable no se advierte, y el padrón se consulta una sola vez
+	if response := process("2", "Comercializadora Andina del Perú SAC"); hasRule(response.Warnings, "customer_name_mismatch") {
+		t.Errorf("no se esperaba warning: %+v", response.Warnings)
+	}
+	if padron.calls != 1 {
+		t.Errorf("la consulta al padrón debe cachearse: %d consultas", padron.calls)
+	}
+
+	// Con un umbral más exigente la misma variación sí se advierte
+	service.SetCustomerNameCheck(1)
+	if response := process("3", "Comercialisadora Andina del Peru SAC"); !hasRule(response.Warnings, "customer_name_mismatch") {
+		t.Errorf("se esperaba warning con umbral 1: %+v", response.Warnings)
+	}
+
+	// Los clientes con DNI no se consultan
+	service.SetCustomerNameCheck(DefaultCustomerNameSimilarity)
+	doc := sampleDocument()
+	doc.Number = "4"
+	if response, _ := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM); hasRule(response.Warnings, "customer_name_mismatch") || padron.calls != 1 {
+		t.Errorf("un cliente con DNI no debe compararse: %+v", response.Warnings)
+	}
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+)
+
+func TestDescriptionWhitespacePolicies(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	multiline := "Servicio de mantenimiento\r\n\t- Revisión general\n\t- Cambio de filtros"
+
+	cases := []struct {
+		policy string
+		want   string
+	}{
+		{DescriptionPreserve, "<cbc:Description><![CDATA[Servicio de mantenimiento\n\t- Revisión general\n\t- Cambio de filtros]]></cbc:Description>"},
+		{DescriptionCollapse, "<cbc:Description>Servicio de mantenimiento - Revisión general - Cambio de filtros</cbc:Description>"},
+		{DescriptionStrip, "<cbc:Description>Servicio de mantenimiento- Revisión general- Cambio de filtros</cbc:Description>"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			service := newMemoryService()
+			service.SetDescriptionPolicy(tc.policy)
+
+			doc := sampleDocument()
+			doc.Items[0].Description = multiline
+			resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+			if err != nil || resp.Status != "SUCCESS" {
+				t.Fatalf("procesamiento falló: %v %+v", err, resp)
+			}
+
+			xmlData, err := service.GetStore().Read(resp.Data["fileName"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(xmlData), tc.want) {
+				t.Errorf("se esperaba %q en el XML", tc.want)
+			}
+		})
+	}
+}
+
+func TestDescriptionLengthValidatedOnFinalText(t *testing.T) {
+	// 498 caracteres + saltos de línea: 503 en crudo, 500 tras collapse y 499 tras strip
+	description := strings.Repeat("a", 498) + "\n\n\n\n" + "b"
+
+	cases := []struct {
+		policy string
+		valid  bool
+	}{
+		{DescriptionPreserve, false},
+		{DescriptionCollapse, true},
+		{DescriptionStrip, true},
+	}
+
+	for _, tc := range cases {
+		service := newMemoryService()
+		service.SetDescriptionPolicy(tc.policy)
+
+		doc := sampleDocument()
+		doc.Items[0].Description = description
+		service.NormalizeDescriptions(doc)
+		invalid := hasRule(service.GetValidator().ValidateBusinessDocument(doc), "description_length_validation")
+		if invalid == tc.valid {
+			t.Errorf("política %s: válida esperada %v (longitud %d)", tc.policy, tc.valid, len(doc.Items[0].Description))
+		}
+	}
+}
+
+func TestDescriptionPolicyIgnoresUnknownValue(t *testing.T) {
+	service := newMemoryService()
+	service.SetDescriptionPolicy("trim")
+
+	doc := sampleDocument()
+	doc.Items[0].Description = "línea 1\nlínea 2"
+	service.NormalizeDescriptions(doc)
+	if doc.Items[0].Description != "línea 1\nlínea 2" {
+		t.Errorf("una política desconocida debe conservar preserve, obtenido %q", doc.Items[0].Description)
+	}
+}
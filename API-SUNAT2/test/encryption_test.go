@@ -0,0 +1,347 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	"API-SUNAT2/kms"
+	"API-SUNAT2/storage"
+)
+
+// fakeKMS es un KMS en memoria: cada versión de la clave maestra es un byte que se
+// aplica con XOR, y el texto cifrado lleva la versión con que se cifró
+type fakeKMS struct {
+	mu       sync.Mutex
+	version  byte
+	encrypts int
+	decrypts int
+}
+
+func (k *fakeKMS) KeyID() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return fmt.Sprintf("fake/v%d", k.version)
+}
+
+// Rotate cambia la versión primaria; las anteriores siguen descifrando
+func (k *fakeKMS) Rotate() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.version++
+}
+
+func (k *fakeKMS) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.encrypts++
+	out := []byte{k.version}
+	for _, b := range plaintext {
+		out = append(out, b^(0xA5+k.version))
+	}
+	return out, nil
+}
+
+func (k *fakeKMS) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.decrypts++
+	if len(ciphertext) == 0 || ciphertext[0] > k.version {
+		return nil, errors.New("unknown key version")
+	}
+	var out []byte
+	for _, b := range ciphertext[1:] {
+		out = append(out, b^(0xA5+ciphertext[0]))
+	}
+	return out, nil
+}
+
+// encryptedStore retorna un store cifrado en memoria con rotación diaria y el reloj fijo
+func encryptedStore(keys kms.KeyProvider, clock *fixedClock) (*storage.EncryptedStore, *storage.MemoryStore) {
+	raw := storage.NewMemoryStore()
+	store := storage.NewEncryptedStore(raw, keys, 24*time.Hour)
+	store.SetClock(clock.Now)
+	return store, raw
+}
+
+func TestEncryptedStoreRoundTrip(t *testing.T) {
+	keys := &fakeKMS{}
+	store, raw := encryptedStore(keys, &fixedClock{now: time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)})
+
+	plaintext := []byte("<Invoice>20123456786-01-F003-123456</Invoice>")
+	for i := 0; i < 3; i++ {
+		if _, err := store.Save(fmt.Sprintf("doc-%d.xml", i), plaintext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := raw.Read("doc-0.xml")
+	if bytes.Contains(data, []byte("20123456786")) {
+		t.Error("el artefacto no debe guardarse en claro")
+	}
+	read, err := store.Read("doc-0.xml")
+	if err != nil || !bytes.Equal(read, plaintext) {
+		t.Fatalf("se esperaba el contenido original: %q %v", read, err)
+	}
+	// La data key se reutiliza: el KMS se llama una vez para cifrarla y ninguna para
+	// descifrarla mientras esté en memoria
+	if keys.encrypts != 1 || keys.decrypts != 0 {
+		t.Errorf("llamadas al KMS: %d encrypt, %d decrypt", keys.encrypts, keys.decrypts)
+	}
+
+	// Otra instancia (un reinicio) descifra con el KMS
+	restarted := storage.NewEncryptedStore(raw, keys, 24*time.Hour)
+	if read, err := restarted.Read("doc-1.xml"); err != nil || !bytes.Equal(read, plaintext) {
+		t.Errorf("tras reiniciar: %q %v", read, err)
+	}
+	if keys.decrypts != 1 {
+		t.Errorf("se esperaba un decrypt, hubo %d", keys.decrypts)
+	}
+
+	// Un artefacto alterado no se descifra
+	data[len(data)-1] ^= 1
+	raw.Save("doc-2.xml", data)
+	if _, err := store.Read("doc-2.xml"); err == nil {
+		t.Error("se esperaba error con el artefacto alterado")
+	}
+}
+
+func TestEncryptedStoreRotation(t *testing.T) {
+	keys := &fakeKMS{}
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)}
+	store, raw := encryptedStore(keys, clock)
+	store.Save("a.xml", []byte("documento A"))
+	store.Save("b.xml", []byte("documento B"))
+	before, _ := raw.Read("a.xml")
+
+	// Dentro de la rotación la lectura no re-cifra
+	clock.now = clock.now.Add(time.Hour)
+	store.Read("a.xml")
+	if after, _ := raw.Read("a.xml"); !bytes.Equal(before, after) || store.Status().Reencrypted != 0 {
+		t.Fatal("no se esperaba re-cifrado con la data key vigente")
+	}
+
+	// Vencida la data key, la lectura re-cifra con una nueva y solo una vez
+	clock.now = clock.now.Add(24 * time.Hour)
+	if data, err := store.Read("a.xml"); err != nil || string(data) != "documento A" {
+		t.Fatalf("lectura con data key vencida: %q %v", data, err)
+	}
+	after, _ := raw.Read("a.xml")
+	if bytes.Equal(before, after) || store.Status().Reencrypted != 1 || store.Status().Rotations != 2 {
+		t.Errorf("se esperaba el re-cifrado con una data key nueva: %+v", store.Status())
+	}
+	store.Read("a.xml")
+	if store.Status().Reencrypted != 1 {
+		t.Error("un artefacto ya re-cifrado no se vuelve a re-cifrar")
+	}
+
+	// Con la clave maestra rotada, lo cifrado con la anterior se lee y se re-cifra
+	keys.Rotate()
+	if data, err := store.Read("b.xml"); err != nil || string(data) != "documento B" {
+		t.Fatalf("lectura tras rotar la clave maestra: %q %v", data, err)
+	}
+	rewrapped, _ := raw.Read("b.xml")
+	if !bytes.Contains(rewrapped, []byte("fake/v1")) || store.Status().Reencrypted != 2 {
+		t.Errorf("se esperaba la data key cifrada con fake/v1: %+v", store.Status())
+	}
+
+	// RotateDataKey fuerza una data key nueva para lo siguiente que se guarde
+	rotations := store.Status().Rotations
+	store.RotateDataKey()
+	store.Save("c.xml", []byte("documento C"))
+	if store.Status().Rotations != rotations+1 {
+		t.Error("se esperaba una data key nueva")
+	}
+}
+
+func TestEncryptedStorePlaintextMigration(t *testing.T) {
+	store, raw := encryptedStore(&fakeKMS{}, &fixedClock{now: time.Now()})
+	raw.Save("legado.xml", []byte("<Invoice/>"))
+
+	// Un artefacto de antes de activar el cifrado se lee y queda cifrado
+	if data, err := store.Read("legado.xml"); err != nil || string(data) != "<Invoice/>" {
+		t.Fatalf("lectura del artefacto en claro: %q %v", data, err)
+	}
+	if data, _ := raw.Read("legado.xml"); bytes.Contains(data, []byte("<Invoice/>")) {
+		t.Error("el artefacto en claro debe re-cifrarse al leerse")
+	}
+}
+
+func TestEncryptedStoreUnavailableProvider(t *testing.T) {
+	store, raw := encryptedStore(kms.Unavailable(errors.New("sin credenciales")), &fixedClock{now: time.Now()})
+	if _, err := store.Save("a.xml", []byte("documento")); err == nil {
+		t.Error("sin proveedor no se debe guardar")
+	}
+	if names, _ := raw.List(); len(names) != 0 {
+		t.Errorf("no se debe guardar nada en claro: %v", names)
+	}
+}
+
+func TestStaticKeyProvider(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	old, _ := kms.NewStaticProvider(oldKey)
+	wrapped, _ := old.Encrypt(context.Background(), []byte("data key"))
+
+	// La clave anterior solo descifra
+	rotated, err := kms.NewStaticProvider(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := rotated.Decrypt(context.Background(), wrapped); err != nil || string(plaintext) != "data key" {
+		t.Errorf("se esperaba descifrar con la clave anterior: %q %v", plaintext, err)
+	}
+	if rotated.KeyID() == old.KeyID() {
+		t.Error("la clave vigente cambió, el id también")
+	}
+	current, _ := kms.NewStaticProvider(newKey)
+	if _, err := current.Decrypt(context.Background(), wrapped); err == nil {
+		t.Error("sin la clave anterior no se debe descifrar")
+	}
+
+	if _, err := kms.New(kms.Options{Provider: kms.ProviderStatic, MasterKey: "corta"}, nil); err == nil {
+		t.Error("se esperaba error con una clave inválida")
+	}
+
+	// El archivo de la clave no puede ser legible por otros
+	path := filepath.Join(t.TempDir(), "master.key")
+	os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(newKey)), 0644)
+	if _, err := kms.NewFileProvider(path); err == nil {
+		t.Error("se esperaba error con un archivo legible por otros")
+	}
+	os.Chmod(path, 0600)
+	file, err := kms.NewFileProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := file.Decrypt(context.Background(), mustEncrypt(t, current, "data key")); err != nil || string(plaintext) != "data key" {
+		t.Errorf("el archivo debe tener la misma clave: %q %v", plaintext, err)
+	}
+}
+
+func mustEncrypt(t *testing.T, keys kms.KeyProvider, plaintext string) []byte {
+	t.Helper()
+	ciphertext, err := keys.Encrypt(context.Background(), []byte(plaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ciphertext
+}
+
+// kmsServer expone el KMS falso con el API de AWS KMS y el de GCP KMS
+func kmsServer(t *testing.T, keys *fakeKMS) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string][]byte
+		json.NewDecoder(r.Body).Decode(&in)
+		var out map[string][]byte
+		switch {
+		case r.Header.Get("X-Amz-Target") == "TrentService.Encrypt" && strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"):
+			ciphertext, _ := keys.Encrypt(r.Context(), in["Plaintext"])
+			out = map[string][]byte{"CiphertextBlob": ciphertext}
+		case r.Header.Get("X-Amz-Target") == "TrentService.Decrypt":
+			plaintext, _ := keys.Decrypt(r.Context(), in["CiphertextBlob"])
+			out = map[string][]byte{"Plaintext": plaintext}
+		case strings.HasSuffix(r.URL.Path, ":encrypt") && r.Header.Get("Authorization") == "Bearer token-gcp":
+			ciphertext, _ := keys.Encrypt(r.Context(), in["plaintext"])
+			out = map[string][]byte{"ciphertext": ciphertext}
+		case strings.HasSuffix(r.URL.Path, ":decrypt"):
+			plaintext, _ := keys.Decrypt(r.Context(), in["ciphertext"])
+			out = map[string][]byte{"plaintext": plaintext}
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRemoteKeyProviders(t *testing.T) {
+	keys := &fakeKMS{}
+	server := kmsServer(t, keys)
+	providers := map[string]kms.Options{
+		"aws": {Provider: kms.ProviderAWS, KeyID: "alias/sunat", Region: "us-east-1", Endpoint: server.URL,
+			AWS: kms.AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secreto"}},
+		"gcp": {Provider: kms.ProviderGCP, KeyID: "projects/p/locations/global/keyRings/r/cryptoKeys/sunat", Endpoint: server.URL,
+			GCPAccessToken: "token-gcp"},
+	}
+	for name, opts := range providers {
+		provider, err := kms.New(opts, server.Client())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		store, _ := encryptedStore(provider, &fixedClock{now: time.Now()})
+		if _, err := store.Save("a.xml", []byte("documento")); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		restarted := storage.NewEncryptedStore(store.Unwrap(), provider, 0)
+		if data, err := restarted.Read("a.xml"); err != nil || string(data) != "documento" {
+			t.Errorf("%s: %q %v", name, data, err)
+		}
+	}
+
+	// Credenciales que el KMS rechaza
+	opts := providers["gcp"]
+	opts.GCPAccessToken = "otro"
+	provider, _ := kms.New(opts, server.Client())
+	if _, err := provider.Encrypt(context.Background(), []byte("data key")); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("se esperaba el rechazo del KMS: %v", err)
+	}
+}
+
+func TestEncryptionRouter(t *testing.T) {
+	storePath := t.TempDir()
+	masterKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	router, _ := api.NewRouter(&config.Config{
+		XMLStorePath:          storePath,
+		EncryptionKeyProvider: kms.ProviderStatic,
+		EncryptionMasterKey:   masterKey,
+	})
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", convertRequest(t, sampleDocument()))
+	var converted struct {
+		DocumentID    string `json:"documentId"`
+		CorrelationID string `json:"correlationId"`
+		XMLPath       string `json:"xmlPath"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &converted); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("convert: código %d: %s", rec.Code, rec.Body.String())
+	}
+	// Las respuestas no exponen las rutas del disco, que tienen el contenido cifrado
+	if converted.XMLPath != storage.EncryptedPathPrefix+converted.DocumentID+".zip" {
+		t.Errorf("xmlPath: %s", converted.XMLPath)
+	}
+	rec = doRequest(router, http.MethodGet, "/api/v1/status/"+converted.CorrelationID, nil)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), storePath) || !strings.Contains(rec.Body.String(), `"xml":"encrypted://`+converted.DocumentID+`.xml"`) {
+		t.Errorf("artefactos del estado: código %d: %s", rec.Code, rec.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(storePath, converted.DocumentID+".xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("<Invoice")) {
+		t.Error("el XML debe guardarse cifrado")
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/xml/"+converted.DocumentID+".xml", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "F003-123456") {
+		t.Errorf("lectura del XML: código %d", rec.Code)
+	}
+
+	// Un proveedor mal configurado no guarda en claro
+	router, _ = api.NewRouter(&config.Config{XMLStorePath: t.TempDir(), EncryptionKeyProvider: kms.ProviderAWS})
+	rec = doJSONRequest(router, http.MethodPost, "/api/v1/convert", convertRequest(t, sampleDocument()))
+	if !strings.Contains(rec.Body.String(), `"errorCode":"SAVE_FAILED"`) {
+		t.Errorf("se esperaba el rechazo de la escritura: %s", rec.Body.String())
+	}
+}
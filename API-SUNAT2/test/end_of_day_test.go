@@ -0,0 +1,197 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// recordingEndOfDayNotifier guarda los reportes notificados; si release no es nil,
+// cada notificación espera a que se cierre
+type recordingEndOfDayNotifier struct {
+	reports []*EndOfDayReport
+	started chan struct{}
+	release chan struct{}
+}
+
+func (n *recordingEndOfDayNotifier) NotifyEndOfDay(ctx context.Context, report *EndOfDayReport) error {
+	n.reports = append(n.reports, report)
+	if n.release != nil {
+		close(n.started)
+		<-n.release
+	}
+	return nil
+}
+
+// newEndOfDayService siembra comprobantes del 2024-06-07 en distintos estados. El reloj
+// marca las 22:00 de Lima, ya 2024-06-08 en UTC.
+func newEndOfDayService(t *testing.T) *UBLConverterService {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	clock := &fixedClock{now: time.Date(2024, 6, 8, 3, 0, 0, 0, time.UTC)}
+	service := newMemoryService()
+	service.SetClock(clock)
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{}, clock))
+	ctx := context.Background()
+
+	process := func(doc *BusinessDocument) string {
+		resp, err := service.ProcessDocument(ctx, doc, certPEM, keyPEM)
+		if err != nil || resp.Status != "SUCCESS" {
+			t.Fatalf("%s-%s: %v %+v", doc.Series, doc.Number, err, resp)
+		}
+		return resp.DocumentID
+	}
+	invoice := func(number string) *BusinessDocument {
+		doc := sampleDocument()
+		doc.Number = number
+		return doc
+	}
+
+	// Generada y nunca enviada
+	process(invoice("1"))
+	// Enviada y aceptada
+	if sent, err := service.SendDocument(ctx, process(invoice("2")), ""); err != nil || sent.Status != "SUCCESS" {
+		t.Fatalf("%v %+v", err, sent)
+	}
+	// Envío fallido
+	failed := process(invoice("3"))
+	history, _ := json.Marshal([]StatusChange{{Status: SubmissionFailed, Detail: "SOAP fault 0109", At: clock.Now()}})
+	service.GetStore().Save(failed+HistorySuffix, history)
+
+	// Boleta en un resumen generado que no se envió, boleta fuera de todo resumen y
+	// boleta anulada
+	process(sampleBoleta("1"))
+	if resp, err := service.GenerateSummary(ctx, "20123456786", "2024-06-07", certPEM, keyPEM); err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("%v %+v", err, resp)
+	}
+	process(sampleBoleta("2"))
+	if resp, _ := service.VoidDocument(process(sampleBoleta("3")), "Error en el monto"); resp.Status != "SUCCESS" {
+		t.Fatalf("%+v", resp)
+	}
+
+	// Otro emisor, y un comprobante de otro día que no entra en el cierre
+	other := invoice("1")
+	other.Series = "F001"
+	other.Issuer.DocumentID = "20123456794"
+	process(other)
+	previous := invoice("4")
+	previous.IssueDate = "2024-06-06"
+	process(previous)
+	return service
+}
+
+func TestEndOfDayReport(t *testing.T) {
+	service := newEndOfDayService(t)
+
+	// Sin fecha se toma el día de Lima, no el de UTC
+	report, err := service.EndOfDayReport("", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Date != "2024-06-07" || report.Issued != 7 || report.Sent != 1 || report.Explained != 1 || report.Pending != 5 {
+		t.Fatalf("totales: %+v", report)
+	}
+	if len(report.Issuers) != 2 || report.Issuers[0].IssuerRUC != "20123456786" || report.Issuers[0].Issued != 6 || report.Issuers[0].Pending != 4 {
+		t.Fatalf("emisores: %+v", report.Issuers)
+	}
+
+	reasons := map[string]EndOfDayPending{}
+	for _, doc := range report.Issuers[0].Documents {
+		reasons[doc.DocumentID] = doc
+	}
+	expected := map[string]string{
+		"20123456786-01-F003-1": "Not sent to SUNAT",
+		"20123456786-01-F003-3": "Submission failed: SOAP fault 0109",
+		"20123456786-03-B001-1": "Included in summary 20123456786-RC-20240608-1",
+		"20123456786-03-B001-2": "Not included in a daily summary",
+	}
+	for documentID, reason := range expected {
+		if !strings.HasPrefix(reasons[documentID].Reason, reason) {
+			t.Errorf("%s: motivo %q, se esperaba %q", documentID, reasons[documentID].Reason, reason)
+		}
+	}
+	if status := reasons["20123456786-01-F003-3"].Status; status != SubmissionFailed {
+		t.Errorf("estado del envío fallido: %s", status)
+	}
+
+	// Filtrado por emisor
+	report, _ = service.EndOfDayReport("20123456794", "2024-06-07", false)
+	if report.Issued != 1 || report.Pending != 1 || len(report.Issuers) != 1 {
+		t.Errorf("reporte del emisor: %+v", report)
+	}
+	if _, err := service.EndOfDayReport("", "07/06/2024", false); err == nil {
+		t.Error("se esperaba error por fecha inválida")
+	}
+}
+
+func TestCloseDayNotifications(t *testing.T) {
+	service := newEndOfDayService(t)
+	notifier := &recordingEndOfDayNotifier{}
+
+	// Por debajo del umbral no se notifica
+	service.SetEndOfDayAlerts(5, notifier)
+	if _, err := service.CloseDay(context.Background(), "2024-06-07"); err != nil || len(notifier.reports) != 0 {
+		t.Fatalf("no se esperaba notificación: %v %d", err, len(notifier.reports))
+	}
+	service.SetEndOfDayAlerts(4, notifier)
+	if _, err := service.CloseDay(context.Background(), "2024-06-07"); err != nil || len(notifier.reports) != 1 || notifier.reports[0].Pending != 5 {
+		t.Fatalf("se esperaba una notificación: %v %+v", err, notifier.reports)
+	}
+
+	// Un cierre no se solapa con el que sigue en curso
+	blocking := &recordingEndOfDayNotifier{started: make(chan struct{}), release: make(chan struct{})}
+	service.SetEndOfDayAlerts(0, blocking)
+	done := make(chan error)
+	go func() {
+		_, err := service.CloseDay(context.Background(), "2024-06-07")
+		done <- err
+	}()
+	<-blocking.started
+	if _, err := service.CloseDay(context.Background(), "2024-06-07"); err != ErrEndOfDayRunning {
+		t.Errorf("se esperaba ErrEndOfDayRunning, obtenido %v", err)
+	}
+	close(blocking.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEndOfDayEndpoint(t *testing.T) {
+	service := newEndOfDayService(t)
+	router, _ := api.NewRouterWithService(&config.Config{
+		AdminAPIKey:   "secreto",
+		IssuerAPIKeys: "clave-emisor:20123456786",
+	}, service)
+
+	rec := doRequest(router, http.MethodGet, "/api/v1/reports/end-of-day?date=2024-06-07&ruc=20123456786", map[string]string{"X-API-Key": "clave-emisor"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			EndOfDay EndOfDayReport `json:"endOfDay"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if report := resp.Data.EndOfDay; report.Issued != 6 || report.Pending != 4 {
+		t.Errorf("reporte: %+v", report)
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/v1/reports/end-of-day?date=2024-06-07", map[string]string{"X-API-Key": "clave-emisor"}); rec.Code != http.StatusForbidden {
+		t.Errorf("sin ruc una API key de emisor no ve a todos: código %d", rec.Code)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/reports/end-of-day?date=ayer", map[string]string{"X-Admin-API-Key": "secreto"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("fecha inválida: código %d", rec.Code)
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/v1/admin/end-of-day?date=2024-06-07", map[string]string{"X-Admin-API-Key": "secreto"}); rec.Code != http.StatusOK {
+		t.Errorf("cierre bajo demanda: código %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,141 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/catalog"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+	"API-SUNAT2/version"
+)
+
+// withVersion fija la versión del binario durante la prueba, como lo haría -ldflags
+func withVersion(t *testing.T, v, commit string) {
+	previous, previousCommit := version.Version, version.Commit
+	version.Version, version.Commit = v, commit
+	t.Cleanup(func() { version.Version, version.Commit = previous, previousCommit })
+}
+
+func readRecord(t *testing.T, store storage.DocumentStore, documentID string) DocumentRecord {
+	t.Helper()
+	data, err := store.Read(RecordName(documentID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record DocumentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestEngineVersionRecorded(t *testing.T) {
+	withVersion(t, "1.7.0", "abc1234")
+	certPEM, keyPEM := loadTestCredentials(t)
+	store := storage.NewMemoryStore()
+	service := newMemoryService()
+	service.SetStore(store)
+
+	resp, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("%v %+v", err, resp)
+	}
+	engine, ok := resp.Data["engineVersion"].(EngineVersion)
+	if !ok || engine.Version != "1.7.0" || engine.Commit != "abc1234" || len(engine.RulesHash) != 16 {
+		t.Fatalf("engineVersion en la respuesta: %+v", resp.Data["engineVersion"])
+	}
+	record := readRecord(t, store, "20123456786-01-F003-123456")
+	if record.Engine == nil || *record.Engine != engine {
+		t.Errorf("engine en el registro: %+v, esperado %+v", record.Engine, engine)
+	}
+}
+
+func TestRulesHashTracksRules(t *testing.T) {
+	service := newMemoryService()
+	base := service.RulesHash()
+	if again := service.RulesHash(); again != base {
+		t.Fatalf("el hash debe ser estable: %s %s", base, again)
+	}
+	service.SetCatalogURIs(false)
+	if changed := service.RulesHash(); changed == base {
+		t.Error("desactivar los URIs de catálogo debe cambiar el hash de reglas")
+	}
+
+	igv := newMemoryService()
+	before := igv.CatalogVersions()
+	igv.GetValidator().SetIGVRate(16)
+	after := igv.CatalogVersions()
+	if before["igv"] == after["igv"] || before["01"] != after["01"] {
+		t.Errorf("solo la versión de igv debe cambiar: %v %v", before, after)
+	}
+}
+
+func TestEngineVersionReport(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	for _, tc := range []struct{ version, number string }{{"1.6.0", "1"}, {"1.7.0", "2"}, {"1.7.0", "3"}} {
+		withVersion(t, tc.version, "abc1234")
+		doc := sampleDocument()
+		doc.Number = tc.number
+		if resp, _ := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM); resp.Status != "SUCCESS" {
+			t.Fatalf("documento %s: %+v", tc.number, resp)
+		}
+	}
+
+	report, err := service.EngineVersionReport("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Versions) != 2 || report.Versions[0].Version != "1.7.0" || report.Versions[0].Documents != 2 || len(report.Documents) != 0 {
+		t.Fatalf("reporte sin filtro: %+v", report)
+	}
+	report, err = service.EngineVersionReport("20123456786", "1.6.0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Versions) != 1 || len(report.Documents) != 1 || report.Documents[0] != "20123456786-01-F003-1" {
+		t.Errorf("reporte de 1.6.0: %+v", report)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	withVersion(t, "1.7.0", "abc1234")
+	router, _ := api.NewRouter(&config.Config{XMLStorePath: t.TempDir(), AdminAPIKey: "secreto"})
+
+	rec := doRequest(router, http.MethodGet, "/api/v1/version", nil)
+	var info VersionInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("código %d: %s", rec.Code, rec.Body.String())
+	}
+	if info.Version != "1.7.0" || info.Commit != "abc1234" || info.BuildDate == "" || info.RulesHash == "" || info.CatalogVersion != catalog.Version() || len(info.CatalogLists) != 6 {
+		t.Errorf("versión: %+v", info)
+	}
+	for _, id := range []string{"01", "09", "59", "igv"} {
+		if info.Catalogs[id] == "" {
+			t.Errorf("falta la versión del catálogo %s: %v", id, info.Catalogs)
+		}
+	}
+
+	// La versión viaja en la respuesta de la conversión
+	rec = doJSONRequest(router, http.MethodPost, "/api/v1/convert", convertRequest(t, sampleDocument()))
+	if !strings.Contains(rec.Body.String(), `"engineVersion":{"version":"1.7.0","commit":"abc1234","rulesHash":"`+info.RulesHash+`","catalogVersion":"`+info.CatalogVersion+`"}`) {
+		t.Errorf("engineVersion en la respuesta: %s", rec.Body.String())
+	}
+
+	headers := map[string]string{"X-Admin-API-Key": "secreto"}
+	rec = doRequest(router, http.MethodGet, "/api/v1/admin/reports/engine-versions?engineVersion=1.7.0", headers)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"documents":["20123456786-01-F003-123456"]`) {
+		t.Errorf("reporte por versión: código %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(router, http.MethodGet, "/api/v1/admin/reports/engine-versions?engineVersion=1.6.0", headers)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "F003-123456") {
+		t.Errorf("reporte de otra versión: código %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,307 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// memoryPublisher guarda los eventos publicados; con release sin cerrar simula un
+// broker caído que no responde
+type memoryPublisher struct {
+	mu      sync.Mutex
+	events  []DocumentEvent
+	release chan struct{}
+	calls   int32
+}
+
+func (p *memoryPublisher) Publish(ctx context.Context, event DocumentEvent) error {
+	atomic.AddInt32(&p.calls, 1)
+	if p.release != nil {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return errors.New("broker unavailable")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *memoryPublisher) published() []DocumentEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]DocumentEvent(nil), p.events...)
+}
+
+func TestDocumentEvents(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newMemoryService()
+	service.SetClock(clock)
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{RejectSeries: []string{"F004"}}, clock))
+	publisher := &memoryPublisher{}
+	stop := service.StartEventPublisher(publisher, 10)
+
+	ctx := context.Background()
+	resp, _ := service.ProcessDocument(ctx, sampleDocument(), certPEM, keyPEM)
+	service.SendDocument(ctx, resp.DocumentID, "")
+	rejected := sampleDocument()
+	rejected.Series = "F004"
+	resp, _ = service.ProcessDocument(ctx, rejected, certPEM, keyPEM)
+	service.SendDocument(ctx, resp.DocumentID, "")
+	boleta := sampleBoleta("1")
+	resp, _ = service.ProcessDocument(ctx, boleta, certPEM, keyPEM)
+	service.VoidDocument(resp.DocumentID, "Error en la venta")
+	stop()
+
+	want := []struct{ eventType, documentID, status string }{
+		{DocumentProcessedEvent, "20123456786-01-F003-123456", DocumentGenerated},
+		{DocumentSentEvent, "20123456786-01-F003-123456", SubmissionSent},
+		{DocumentAcceptedEvent, "20123456786-01-F003-123456", CDRAccepted},
+		{DocumentProcessedEvent, "20123456786-01-F004-123456", DocumentGenerated},
+		{DocumentSentEvent, "20123456786-01-F004-123456", SubmissionSent},
+		{DocumentRejectedEvent, "20123456786-01-F004-123456", CDRRejected},
+		{DocumentProcessedEvent, "20123456786-03-B001-1", DocumentGenerated},
+		{DocumentVoidedEvent, "20123456786-03-B001-1", DocumentVoided},
+	}
+	events := publisher.published()
+	if len(events) != len(want) {
+		t.Fatalf("se esperaban %d eventos, hay %d: %+v", len(want), len(events), events)
+	}
+	for i, w := range want {
+		event := events[i]
+		if event.Type != w.eventType || event.DocumentID != w.documentID || event.Status != w.status {
+			t.Errorf("evento %d: %s %s %s, esperado %+v", i, event.Type, event.DocumentID, event.Status, w)
+		}
+		if event.Version != EventSchemaVersion || event.ID == "" || event.XMLHash == "" || event.ZIPHash == "" || event.IssuerRUC != "20123456786" {
+			t.Errorf("evento %d incompleto: %+v", i, event)
+		}
+	}
+	if first := events[0]; first.PayableAmount != 118 || first.TaxAmount != 18 || first.Currency != "PEN" || !first.OccurredAt.Equal(clock.now) {
+		t.Errorf("montos del evento: %+v", first)
+	}
+	if events[2].Environment != EnvironmentMock || events[7].Detail != "Error en la venta" {
+		t.Errorf("ambiente y detalle: %+v %+v", events[2], events[7])
+	}
+}
+
+func TestDocumentEventsDoNotBlockWhenBrokerIsDown(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	publisher := &memoryPublisher{release: make(chan struct{})}
+	stop := service.StartEventPublisher(publisher, 1)
+
+	// El primer evento queda esperando al broker; los siguientes llenan el buffer
+	service.ProcessDocument(context.Background(), sampleBoleta("1"), certPEM, keyPEM)
+	for atomic.LoadInt32(&publisher.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 2; i <= 4; i++ {
+			service.ProcessDocument(context.Background(), sampleBoleta(strconv.Itoa(i)), certPEM, keyPEM)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("el pipeline no debe bloquearse con el broker caído")
+	}
+	close(publisher.release)
+	stop()
+
+	var metrics strings.Builder
+	service.WriteEventMetrics(&metrics)
+	// Uno en publicación, uno en el buffer y dos descartados por buffer lleno
+	for _, line := range []string{
+		`document_events_published_total 0`,
+		`document_events_dropped_total{reason="buffer_full"} 2`,
+		`document_events_dropped_total{reason="publish_failed"} 2`,
+	} {
+		if !strings.Contains(metrics.String(), line) {
+			t.Errorf("falta %s en las métricas:\n%s", line, metrics.String())
+		}
+	}
+}
+
+func TestKafkaRESTPublisher(t *testing.T) {
+	var body struct {
+		Records []struct {
+			Key   string        `json:"key"`
+			Value DocumentEvent `json:"value"`
+		} `json:"records"`
+	}
+	var path, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer server.Close()
+
+	// El primer broker no responde: se usa el siguiente
+	publisher := NewKafkaRESTPublisher([]string{"http://127.0.0.1:1", server.URL}, "sunat.documents", nil)
+	event := DocumentEvent{Version: EventSchemaVersion, Type: DocumentProcessedEvent, DocumentID: "20123456786-01-F003-123456"}
+	if err := publisher.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/topics/sunat.documents" || contentType != "application/vnd.kafka.json.v2+json" {
+		t.Errorf("request: %s %s", path, contentType)
+	}
+	if len(body.Records) != 1 || body.Records[0].Key != event.DocumentID || body.Records[0].Value.Type != DocumentProcessedEvent {
+		t.Errorf("records: %+v", body.Records)
+	}
+}
+
+// serveNATS atiende una conexión como un servidor NATS mínimo: INFO, CONNECT, PUB y
+// PING/PONG. Con certificates exige TLS; con password rechaza el CONNECT que no la trae.
+// Reenvía a received el subject y el payload de cada PUB.
+func serveNATS(listener net.Listener, certificates []tls.Certificate, password string, received chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if certificates == nil {
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+	} else {
+		conn.Write([]byte("INFO {\"server_id\":\"test\",\"tls_required\":true,\"auth_required\":true}\r\n"))
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: certificates})
+		defer tlsConn.Close()
+		conn = tlsConn
+	}
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch fields := strings.Fields(line); fields[0] {
+		case "CONNECT":
+			var connect struct {
+				User string `json:"user"`
+				Pass string `json:"pass"`
+			}
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &connect)
+			if password != "" && (connect.User != "eventos" || connect.Pass != password) {
+				conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+				return
+			}
+		case "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			io.ReadFull(reader, payload)
+			received <- fields[1] + " " + string(payload[:size])
+		case "PING":
+			conn.Write([]byte("PONG\r\n"))
+		}
+	}
+}
+
+func TestNATSPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 2)
+	go serveNATS(listener, nil, "", received)
+
+	publisher := NewNATSPublisher([]string{"nats://" + listener.Addr().String()}, "sunat.documents", NATSOptions{})
+	for _, documentID := range []string{"20123456786-01-F003-1", "20123456786-01-F003-2"} {
+		if err := publisher.Publish(context.Background(), DocumentEvent{Type: DocumentSentEvent, DocumentID: documentID}); err != nil {
+			t.Fatal(err)
+		}
+		msg := <-received
+		if !strings.HasPrefix(msg, "sunat.documents {") || !strings.Contains(msg, documentID) {
+			t.Errorf("mensaje recibido: %s", msg)
+		}
+	}
+}
+
+func TestNATSPublisherAuthAndTLS(t *testing.T) {
+	// El certificado de httptest es válido para 127.0.0.1 y su cliente confía en él
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	roots := tlsServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	servers := []string{"nats://" + listener.Addr().String()}
+	event := DocumentEvent{Type: DocumentSentEvent, DocumentID: "20123456786-01-F003-1"}
+
+	// El servidor exige TLS: sin la CA no se confía en su certificado
+	go serveNATS(listener, tlsServer.TLS.Certificates, "secreto", received)
+	err = NewNATSPublisher(servers, "sunat.documents", NATSOptions{User: "eventos", Password: "secreto"}).Publish(context.Background(), event)
+	if err == nil || !strings.Contains(err.Error(), "TLS handshake failed") {
+		t.Errorf("se esperaba un error de TLS: %v", err)
+	}
+
+	// Con TLS pero otra contraseña el servidor rechaza el CONNECT
+	tlsConfig := &tls.Config{RootCAs: roots}
+	go serveNATS(listener, tlsServer.TLS.Certificates, "secreto", received)
+	err = NewNATSPublisher(servers, "sunat.documents", NATSOptions{User: "eventos", Password: "otra", TLS: tlsConfig}).Publish(context.Background(), event)
+	if err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Errorf("se esperaba un error de autorización: %v", err)
+	}
+
+	go serveNATS(listener, tlsServer.TLS.Certificates, "secreto", received)
+	if err := NewNATSPublisher(servers, "sunat.documents", NATSOptions{User: "eventos", Password: "secreto", TLS: tlsConfig}).Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-received; !strings.Contains(msg, event.DocumentID) {
+		t.Errorf("mensaje recibido: %s", msg)
+	}
+}
+
+func TestEventsFlushedOnShutdown(t *testing.T) {
+	var mu sync.Mutex
+	var published []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// El proxy responde lento: el evento sigue en el buffer al apagar
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, r.URL.Path)
+	}))
+	defer proxy.Close()
+
+	cfg := &config.Config{XMLStorePath: t.TempDir(), EventsDriver: "kafka-rest", EventsURLs: proxy.URL, EventsTopic: "sunat.documents"}
+	router, _, shutdown := api.NewRouterWithShutdown(cfg)
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", convertRequest(t, sampleDocument()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("conversión falló: %d %s", rec.Code, rec.Body.String())
+	}
+	shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(published) != 1 || published[0] != "/topics/sunat.documents" {
+		t.Errorf("el apagado debe publicar los eventos pendientes: %v", published)
+	}
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+func newMemoryService() *UBLConverterService {
+	service := NewUBLConverterService("")
+	service.SetStore(storage.NewMemoryStore())
+	service.GetLogger().SetOutput(io.Discard)
+	return service
+}
+
+func sampleBoleta(number string) *BusinessDocument {
+	doc := sampleDocument()
+	doc.Type = "03"
+	doc.Series = "B001"
+	doc.Number = number
+	return doc
+}
+
+func TestBoletaExchange(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+
+	for _, number := range []string{"1", "2"} {
+		response, err := service.ProcessDocument(context.Background(), sampleBoleta(number), certPEM, keyPEM)
+		if err != nil || response.Status != "SUCCESS" {
+			t.Fatalf("emisión de boleta falló: %v %+v", err, response)
+		}
+	}
+
+	invoice := sampleDocument()
+	invoice.Items[0].Quantity = 4
+	invoice.Items[0].LineTotal = 200
+	invoice.Items[0].Taxes[0] = Tax{TaxType: "1000", TaxAmount: 36, TaxRate: 18, TaxBase: 200}
+	invoice.Taxes[0] = TaxTotal{TaxType: "1000", TaxAmount: 36, TaxRate: 18, TaxBase: 200}
+	invoice.Totals = DocumentTotals{SubTotal: 200, TotalTaxes: 36, TotalAmount: 236, PayableAmount: 236}
+	invoice.ExchangedDocuments = []DocumentReference{
+		{DocumentType: "03", DocumentID: "B001-1"},
+		{DocumentType: "03", DocumentID: "B001-2"},
+	}
+
+	response, err := service.ProcessDocument(context.Background(), invoice, certPEM, keyPEM)
+	if err != nil || response.Status != "SUCCESS" {
+		t.Fatalf("canje falló: %v %+v", err, response)
+	}
+	content, err := service.GetStore().Read("20123456786-01-F003-123456.xml")
+	if err != nil {
+		t.Fatalf("no se encontró la factura en el store: %v", err)
+	}
+	if strings.Count(string(content), "<cac:AdditionalDocumentReference>") != 2 || !strings.Contains(string(content), "catalogo12") {
+		t.Fatalf("se esperaban dos AdditionalDocumentReference del catálogo 12")
+	}
+
+	// Segundo canje de la misma boleta
+	second := sampleDocument()
+	second.Number = "123457"
+	second.ExchangedDocuments = []DocumentReference{{DocumentType: "03", DocumentID: "B001-1"}}
+	response, err = service.ProcessDocument(context.Background(), second, certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if !hasRule(response.ValidationErrors, "exchange_already_used") {
+		t.Fatalf("se esperaba rechazo por doble canje, se obtuvo %+v", response)
+	}
+}
+
+func TestBoletaExchangeTotalsMismatch(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+
+	if response, err := service.ProcessDocument(context.Background(), sampleBoleta("1"), certPEM, keyPEM); err != nil || response.Status != "SUCCESS" {
+		t.Fatalf("emisión de boleta falló: %v %+v", err, response)
+	}
+
+	invoice := sampleDocument()
+	invoice.ExchangedDocuments = []DocumentReference{
+		{DocumentType: "03", DocumentID: "B001-1"},
+		{DocumentType: "03", DocumentID: "B001-1"},
+	}
+	response, err := service.ProcessDocument(context.Background(), invoice, certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if !hasRule(response.ValidationErrors, "exchange_validation") || !hasRule(response.ValidationErrors, "exchange_totals_mismatch") {
+		t.Fatalf("se esperaba error de duplicado y de cuadre, se obtuvo %+v", response.ValidationErrors)
+	}
+}
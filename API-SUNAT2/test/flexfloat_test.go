@@ -0,0 +1,108 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+)
+
+// stringAmounts retorna el documento de ejemplo como JSON genérico con algunos montos y
+// cantidades serializados como strings, como los envían varios ERPs
+func stringAmounts(t *testing.T, unitPrice, quantity, payable string) map[string]interface{} {
+	t.Helper()
+	doc := documentJSON(t, sampleDocument()).(map[string]interface{})
+	item := doc["items"].([]interface{})[0].(map[string]interface{})
+	item["unitPrice"] = unitPrice
+	item["quantity"] = quantity
+	doc["totals"].(map[string]interface{})["payableAmount"] = payable
+	return doc
+}
+
+func TestFlexFloatMixedPayload(t *testing.T) {
+	body, _ := json.Marshal(stringAmounts(t, "100.00", " 1 ", "118"))
+	var doc BusinessDocument
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Items[0].UnitPrice != 100 || doc.Items[0].Quantity != 1 || doc.Totals.PayableAmount != 118 {
+		t.Fatalf("montos: %+v %+v", doc.Items[0], doc.Totals)
+	}
+
+	// La salida no cambia: los montos se serializan como números
+	output, _ := json.Marshal(&doc)
+	if !strings.Contains(string(output), `"unitPrice":100,`) || !strings.Contains(string(output), `"payableAmount":118`) {
+		t.Errorf("serialización de salida: %s", output)
+	}
+
+	for _, invalid := range []string{`"diez"`, `"NaN"`, `"Inf"`, `"0x10"`, `""`, `true`} {
+		var amount FlexFloat
+		if err := json.Unmarshal([]byte(invalid), &amount); err == nil {
+			t.Errorf("%s: se esperaba error, obtenido %v", invalid, amount)
+		}
+	}
+}
+
+func TestFlexFloatDecimalComma(t *testing.T) {
+	SetDecimalSeparator(DecimalComma)
+	defer SetDecimalSeparator(DecimalPoint)
+
+	cases := map[string]FlexFloat{
+		`"10,50"`:    10.5,
+		`"1.234,50"`: 1234.5,
+		`"-0,5"`:     -0.5,
+		`12.75`:      12.75,
+	}
+	for input, want := range cases {
+		var amount FlexFloat
+		if err := json.Unmarshal([]byte(input), &amount); err != nil || amount != want {
+			t.Errorf("%s: obtenido %v %v, esperado %v", input, amount, err, want)
+		}
+	}
+
+	// Un separador desconocido se ignora
+	SetDecimalSeparator(";")
+	if GetDecimalSeparator() != DecimalComma {
+		t.Errorf("separador: %q", GetDecimalSeparator())
+	}
+}
+
+func TestNumericStringsEndpoint(t *testing.T) {
+	// Con las respuestas de validación unificadas /validate y /convert de v1 responden igual
+	router, _ := api.NewRouterWithService(&config.Config{V1UnifiedValidation: true}, newMemoryService())
+
+	for path, build := range map[string]func(doc map[string]interface{}) interface{}{
+		"/api/v1/validate": func(doc map[string]interface{}) interface{} { return doc },
+		"/api/v1/convert": func(doc map[string]interface{}) interface{} {
+			request := convertRequest(t, sampleDocument())
+			request["document"] = doc
+			return request
+		},
+	} {
+		rec := doJSONRequest(router, http.MethodPost, path, build(stringAmounts(t, "100.00", "1", "118.00")))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: código %d %s", path, rec.Code, rec.Body.String())
+		}
+
+		// Un string no numérico se reporta con el path exacto del campo
+		rec = doJSONRequest(router, http.MethodPost, path, build(stringAmounts(t, "cien", "1", "118")))
+		var resp APIResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != http.StatusUnprocessableEntity || len(resp.ValidationErrors) != 1 {
+			t.Fatalf("%s: código %d %+v", path, rec.Code, resp.ValidationErrors)
+		}
+		if e := resp.ValidationErrors[0]; e.Field != "items[0].unitPrice" || e.Received != "cien" {
+			t.Errorf("%s: error %+v", path, e)
+		}
+	}
+
+	SetDecimalSeparator(DecimalComma)
+	defer SetDecimalSeparator(DecimalPoint)
+	if rec := doJSONRequest(router, http.MethodPost, "/api/v1/validate", stringAmounts(t, "100,00", "1", "118,00")); rec.Code != http.StatusOK {
+		t.Errorf("separador coma: código %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// mixedFreeDocument retorna una factura con dos líneas onerosas (100.00 y 50.00) y una
+// gratuita de valor referencial 30.00 con su IGV de 5.40, que no suman al total
+func mixedFreeDocument() *BusinessDocument {
+	doc := sampleDocument()
+	doc.Items = append(doc.Items,
+		DocumentItem{
+			ID:          "2",
+			Description: "Producto B",
+			Quantity:    1,
+			UnitCode:    "NIU",
+			UnitPrice:   50,
+			LineTotal:   50,
+			Taxes:       []Tax{{TaxType: "1000", TaxAmount: 9, TaxRate: 18, TaxBase: 50}},
+		},
+		DocumentItem{
+			ID:          "3",
+			Description: "Muestra gratuita",
+			Quantity:    3,
+			UnitCode:    "NIU",
+			UnitPrice:   10,
+			LineTotal:   30,
+			Taxes:       []Tax{{TaxType: "1000", TaxAmount: 5.4, TaxRate: 18, TaxBase: 30}},
+			Free:        true,
+		},
+	)
+	doc.Taxes = []TaxTotal{{TaxType: "1000", TaxAmount: 27, TaxRate: 18, TaxBase: 150}}
+	doc.Totals = DocumentTotals{SubTotal: 150, TotalTaxes: 27, TotalAmount: 177, PayableAmount: 177}
+	return doc
+}
+
+func TestFreeLinesConversion(t *testing.T) {
+	doc := mixedFreeDocument()
+	if errs := NewValidationService(nil).ValidateBusinessDocument(doc); len(errs) > 0 {
+		t.Fatalf("no se esperaban errores: %+v", errs)
+	}
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(xmlData)
+
+	for _, fragment := range []string{
+		// Leyenda 1002 generada
+		`<cbc:Note languageLocaleID="1002">` + FreeTransferLegend + `</cbc:Note>`,
+		// El total de tributos solo lleva el IGV de las onerosas
+		`<cbc:TaxAmount currencyID="PEN">27</cbc:TaxAmount>`,
+		// El valor referencial y el IGV de la gratuita van en el tributo 9996
+		`<cbc:TaxableAmount currencyID="PEN">30</cbc:TaxableAmount>`,
+		`schemeName="Codigo de tributos" schemeURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo05">9996</cbc:ID>`,
+		"<cbc:Name>GRA</cbc:Name>",
+		"<cbc:TaxTypeCode>FRE</cbc:TaxTypeCode>",
+		`<cbc:PayableAmount currencyID="PEN">177</cbc:PayableAmount>`,
+	} {
+		if !strings.Contains(xml, fragment) {
+			t.Errorf("falta %s en:\n%s", fragment, xml)
+		}
+	}
+
+	// La línea gratuita lleva precio cero y el valor referencial con tipo 02
+	lines := strings.Split(xml, "<cac:InvoiceLine>")
+	if len(lines) != 4 {
+		t.Fatalf("se esperaban 3 líneas, se obtuvieron %d", len(lines)-1)
+	}
+	free := lines[3]
+	if !strings.Contains(free, `<cbc:PriceAmount currencyID="PEN">0</cbc:PriceAmount>`) || !strings.Contains(free, ">02</cbc:PriceTypeCode>") {
+		t.Errorf("línea gratuita inesperada:\n%s", free)
+	}
+	for _, onerous := range lines[1:3] {
+		if strings.Contains(onerous, "9996") || !strings.Contains(onerous, ">01</cbc:PriceTypeCode>") {
+			t.Errorf("la línea onerosa no debe tratarse como gratuita:\n%s", onerous)
+		}
+	}
+
+	// Si la leyenda ya viene en las observaciones no se repite
+	doc.Observations = []string{FreeTransferLegend}
+	xmlData, _ = NewUBLConverter(nil).ConvertToUBL(doc)
+	if n := strings.Count(string(xmlData), FreeTransferLegend); n != 1 {
+		t.Errorf("la leyenda aparece %d veces", n)
+	}
+
+	// Sin líneas gratuitas no hay leyenda ni tributo 9996
+	xmlData, _ = NewUBLConverter(nil).ConvertToUBL(sampleDocument())
+	if strings.Contains(string(xmlData), FreeTransferLegend) || strings.Contains(string(xmlData), ">9996<") {
+		t.Error("sin líneas gratuitas no se esperaba la leyenda 1002 ni el tributo 9996")
+	}
+}
+
+func TestFreeLinesValidation(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(doc *BusinessDocument)
+		field  string
+	}{
+		{"subtotal con la gratuita", func(doc *BusinessDocument) {
+			doc.Totals = DocumentTotals{SubTotal: 180, TotalTaxes: 27, TotalAmount: 207, PayableAmount: 207}
+		}, "totals.subTotal"},
+		{"IGV con el de la gratuita", func(doc *BusinessDocument) {
+			doc.Taxes[0].TaxAmount = 32.4
+			doc.Totals = DocumentTotals{SubTotal: 150, TotalTaxes: 32.4, TotalAmount: 182.4, PayableAmount: 182.4}
+		}, "taxes[0].taxAmount"},
+		{"total a pagar con la gratuita", func(doc *BusinessDocument) {
+			doc.Totals.PayableAmount = 212.4
+		}, "totals.payableAmount"},
+	}
+	for _, tc := range cases {
+		doc := mixedFreeDocument()
+		tc.modify(doc)
+		found := false
+		for _, validationErr := range NewValidationService(nil).ValidateBusinessDocument(doc) {
+			found = found || (validationErr.Rule == "free_lines_validation" && validationErr.Field == tc.field)
+		}
+		if !found {
+			t.Errorf("%s: se esperaba free_lines_validation en %s", tc.name, tc.field)
+		}
+	}
+
+	// El 9996 del documento no suma al total
+	doc := mixedFreeDocument()
+	doc.Taxes = append(doc.Taxes, TaxTotal{TaxType: FreeTaxType, TaxBase: 30, TaxAmount: 5.4})
+	if errs := NewValidationService(nil).ValidateBusinessDocument(doc); len(errs) > 0 {
+		t.Errorf("no se esperaban errores con el 9996 declarado: %+v", errs)
+	}
+}
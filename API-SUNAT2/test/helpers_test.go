@@ -0,0 +1,93 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	. "API-SUNAT2/model"
+)
+
+// sampleDocument retorna una factura válida equivalente a factura-ejemplo.json
+func sampleDocument() *BusinessDocument {
+	return &BusinessDocument{
+		Type:      "01",
+		Series:    "F003",
+		Number:    "123456",
+		IssueDate: "2024-06-07",
+		Currency:  "PEN",
+		Issuer: Party{
+			DocumentType: "6",
+			DocumentID:   "20123456786",
+			Name:         "RODRIGO S.A.C",
+			Address: Address{
+				Street:     "Av. Principal 123",
+				City:       "LIMA",
+				District:   "MIRAFLORES",
+				Province:   "LIMA",
+				Department: "LIMA",
+				Country:    "PE",
+				Ubigeo:     "150122",
+			},
+		},
+		Customer: Party{
+			DocumentType: "1",
+			DocumentID:   "12345678",
+			Name:         "JUAN PEREZ",
+			Address: Address{
+				Street:     "Calle Secundaria 456",
+				City:       "LIMA",
+				District:   "SURCO",
+				Province:   "LIMA",
+				Department: "LIMA",
+				Country:    "PE",
+			},
+		},
+		Items: []DocumentItem{
+			{
+				ID:          "1",
+				Description: "Producto A",
+				Quantity:    2,
+				UnitCode:    "NIU",
+				UnitPrice:   50,
+				LineTotal:   100,
+				Taxes: []Tax{
+					{TaxType: "1000", TaxAmount: 18, TaxRate: 18, TaxBase: 100},
+				},
+				ClassificationCode: "10191509",
+			},
+		},
+		Totals: DocumentTotals{
+			SubTotal:      100,
+			TotalTaxes:    18,
+			TotalAmount:   118,
+			PayableAmount: 118,
+		},
+		Taxes: []TaxTotal{
+			{TaxType: "1000", TaxAmount: 18, TaxRate: 18, TaxBase: 100},
+		},
+	}
+}
+
+// loadTestCredentials lee el certificado y la clave de prueba del repositorio
+func loadTestCredentials(t testing.TB) ([]byte, []byte) {
+	t.Helper()
+	certPEM, err := os.ReadFile("../cert.pem")
+	if err != nil {
+		t.Fatalf("no se pudo leer cert.pem: %v", err)
+	}
+	keyPEM, err := os.ReadFile("../key.pem")
+	if err != nil {
+		t.Fatalf("no se pudo leer key.pem: %v", err)
+	}
+	return certPEM, keyPEM
+}
+
+// hasRule indica si alguno de los errores corresponde a la regla indicada
+func hasRule(errs []ValidationError, rule string) bool {
+	for _, ve := range errs {
+		if ve.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
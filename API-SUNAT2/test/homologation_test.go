@@ -0,0 +1,152 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func TestHomologationCasesMatchDeclaredCharacteristics(t *testing.T) {
+	cases := DefaultHomologationCases()
+	docs, err := BuildHomologationDocuments("20123456786", "2024-06-07", cases, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != len(cases) {
+		t.Fatalf("se esperaban %d documentos, hay %d", len(cases), len(docs))
+	}
+
+	byCase := make(map[string]*BusinessDocument)
+	numbers := make(map[string]bool)
+	for i, c := range cases {
+		doc := docs[i]
+		byCase[c.ID] = doc
+		id := doc.Series + "-" + doc.Number
+		if numbers[id] {
+			t.Errorf("caso %s: número repetido %s", c.ID, id)
+		}
+		numbers[id] = true
+
+		if doc.Type != c.DocumentType || doc.Series != c.Series || doc.Issuer.DocumentID != "20123456786" || !doc.Test {
+			t.Errorf("caso %s: documento %s %s emisor %s", c.ID, doc.Type, doc.Series, doc.Issuer.DocumentID)
+		}
+		if len(doc.Items) != len(c.Items) {
+			t.Errorf("caso %s: %d ítems, declarados %d", c.ID, len(doc.Items), len(c.Items))
+			continue
+		}
+
+		var subTotal, taxes FlexFloat
+		for j, item := range doc.Items {
+			if len(item.Taxes) != 1 || item.Taxes[0].TaxType != c.Items[j] {
+				t.Errorf("caso %s ítem %d: tributos %+v, declarado %s", c.ID, j, item.Taxes, c.Items[j])
+				continue
+			}
+			if c.Items[j] == "9996" {
+				continue
+			}
+			subTotal += item.LineTotal
+			taxes += item.Taxes[0].TaxAmount
+		}
+		// Los ítems gratuitos no suman al total del comprobante
+		if doc.Totals.SubTotal != subTotal || doc.Totals.PayableAmount != subTotal+taxes {
+			t.Errorf("caso %s: totales %+v, esperado subtotal %.2f e IGV %.2f", c.ID, doc.Totals, subTotal, taxes)
+		}
+
+		if c.Reference == "" {
+			if doc.Reference != nil {
+				t.Errorf("caso %s: referencia inesperada %+v", c.ID, doc.Reference)
+			}
+			continue
+		}
+		affected := byCase[c.Reference]
+		if doc.Reference == nil || affected == nil || doc.Reference.DocumentID != affected.Series+"-"+affected.Number ||
+			doc.Reference.DocumentType != affected.Type || doc.Reference.ReasonCode != c.ReasonCode {
+			t.Errorf("caso %s: referencia %+v al caso %s", c.ID, doc.Reference, c.Reference)
+		}
+	}
+}
+
+func TestHomologationCaseReferenceMustComeFirst(t *testing.T) {
+	cases := []HomologationCase{
+		{ID: "1", DocumentType: "07", Series: "FF11", Items: []string{"1000"}, Reference: "2", ReasonCode: "07"},
+		{ID: "2", DocumentType: "01", Series: "FF11", Items: []string{"1000"}},
+	}
+	if _, err := BuildHomologationDocuments("20123456786", "2024-06-07", cases, 1); err == nil {
+		t.Error("se esperaba error por la referencia a un caso posterior")
+	}
+}
+
+func TestHomologationEndpoint(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newMemoryService()
+	service.SetClock(clock)
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{RejectSeries: []string{"BB11"}}, clock))
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+
+	request := HomologationRequest{
+		RUC:         "20123456786",
+		Certificate: base64.StdEncoding.EncodeToString(certPEM),
+		PrivateKey:  base64.StdEncoding.EncodeToString(keyPEM),
+		Send:        true,
+	}
+	body, _ := json.Marshal(request)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/homologation", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-API-Key", "secreto")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Homologation HomologationReport `json:"homologation"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	report := resp.Data.Homologation
+	total := len(DefaultHomologationCases())
+	if report.Total != total || report.Succeeded+report.Failed != total || len(report.Cases) != total {
+		t.Fatalf("reporte: %+v", report)
+	}
+	// El mock rechaza la serie de boletas: esos casos quedan como error con su CDR
+	for _, result := range report.Cases {
+		rejected := strings.Contains(result.DocumentID, "-BB11-")
+		switch {
+		case rejected && (result.Status != "ERROR" || result.CDRStatus != CDRRejected):
+			t.Errorf("caso %s: se esperaba rechazo: %+v", result.CaseID, result)
+		case !rejected && (result.Status != "SUCCESS" || result.CDRStatus != CDRAccepted):
+			t.Errorf("caso %s: %+v", result.CaseID, result)
+		}
+	}
+	if report.Failed != 4 {
+		t.Errorf("se esperaban 4 casos rechazados, hay %d", report.Failed)
+	}
+
+	// Un RUC inválido o un caso inexistente se rechazan antes de generar documentos
+	for _, invalid := range []HomologationRequest{
+		{RUC: "123", Certificate: request.Certificate, PrivateKey: request.PrivateKey},
+		{RUC: "20123456786", Certificate: request.Certificate, PrivateKey: request.PrivateKey, CaseIDs: []string{"99"}},
+	} {
+		body, _ := json.Marshal(invalid)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/homologation", bytes.NewReader(body))
+		req.Header.Set("X-Admin-API-Key", "secreto")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%+v: código %d", invalid.CaseIDs, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func TestPipelineHooksModifyAndObserve(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+
+	var calls []string
+	record := func(name string) Hook {
+		return func(ctx *PipelineContext) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	// Se registran fuera de orden: cada punto corre en su momento y, dentro del punto,
+	// en orden de registro
+	for _, h := range []struct {
+		point HookPoint
+		name  string
+		hook  Hook
+	}{
+		{AfterStore, "after_store", record("after_store")},
+		{BeforeSign, "before_sign", func(ctx *PipelineContext) error {
+			if ctx.SignResult != nil || len(ctx.XML) == 0 {
+				t.Error("BeforeSign debe recibir el XML sin firmar")
+			}
+			calls = append(calls, "before_sign")
+			return nil
+		}},
+		{AfterConvert, "after_convert", record("after_convert")},
+		{BeforeValidate, "industria", func(ctx *PipelineContext) error {
+			ctx.Document.Observations = append(ctx.Document.Observations, "Registro sanitario 123")
+			calls = append(calls, "before_validate_1")
+			return nil
+		}},
+		{BeforeValidate, "segundo", record("before_validate_2")},
+		{AfterStore, "datalake", func(ctx *PipelineContext) error {
+			if ctx.SignResult == nil || len(ctx.Artifacts) == 0 {
+				t.Error("AfterStore debe recibir el XML firmado y los artefactos escritos")
+			}
+			ctx.Data["datalake"] = ctx.XMLPath
+			return nil
+		}},
+	} {
+		if err := service.RegisterHook(h.point, h.name, h.hook); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("procesamiento falló: %v %+v", err, resp)
+	}
+	want := "before_validate_1,before_validate_2,after_convert,before_sign,after_store"
+	if got := strings.Join(calls, ","); got != want {
+		t.Errorf("orden de los hooks = %s, esperado %s", got, want)
+	}
+	xmlData, _ := service.GetStore().Read(resp.DocumentID + ".xml")
+	if !strings.Contains(string(xmlData), "Registro sanitario 123") {
+		t.Error("el cambio del hook BeforeValidate debe llegar al XML")
+	}
+	if resp.Data["datalake"] != resp.XMLPath {
+		t.Errorf("ctx.Data del hook debe llegar a la respuesta: %v", resp.Data["datalake"])
+	}
+	if _, ok := resp.Timings["hook_datalake"]; !ok {
+		t.Errorf("se esperaba la duración del hook en timings: %v", resp.Timings)
+	}
+
+	report := service.HookMetrics().Report()
+	if len(report) != 6 {
+		t.Fatalf("se esperaban métricas de 6 hooks: %+v", report)
+	}
+	for _, stats := range report {
+		if stats.Count != 1 || stats.Failures != 0 {
+			t.Errorf("métricas inesperadas: %+v", stats)
+		}
+	}
+
+	// /validate ejecuta solo los hooks BeforeValidate
+	calls = nil
+	if _, failed := service.ValidateDocument(context.Background(), sampleDocument()); failed != nil {
+		t.Fatalf("validación falló: %+v", failed)
+	}
+	if got := strings.Join(calls, ","); got != "before_validate_1,before_validate_2" {
+		t.Errorf("/validate ejecutó %s", got)
+	}
+}
+
+func TestPipelineHookAborts(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	service := newMemoryService()
+	service.RegisterHook(BeforeSign, "industria", func(ctx *PipelineContext) error {
+		return &HookError{
+			Code:    "ERR_INDUSTRY_RULE",
+			Message: "falta el registro sanitario",
+			ValidationErrors: []ValidationError{{
+				Field: "observations", Rule: "industry_rule", Message: "Sanitary registration is required",
+			}},
+		}
+	})
+	resp, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ErrorCode != "ERR_INDUSTRY_RULE" || !strings.Contains(resp.ErrorMessage, "industria") || !hasRule(resp.ValidationErrors, "industry_rule") {
+		t.Errorf("el error del hook debe mapearse a la respuesta: %+v", resp)
+	}
+	if names, _ := service.GetStore().List(); len(names) != 0 {
+		t.Errorf("un hook que aborta antes de firmar no debe dejar artefactos: %v", names)
+	}
+	if report := service.HookMetrics().Report(); len(report) != 1 || report[0].Failures != 1 {
+		t.Errorf("el fallo debe registrarse en las métricas: %+v", report)
+	}
+
+	// Sin código se usa ERR_HOOK_ABORTED, que v2 responde con 422; un error cualquiera
+	// es ERR_HOOK_FAILED
+	service = newMemoryService()
+	service.RegisterHook(AfterConvert, "abortar", func(ctx *PipelineContext) error {
+		return &HookError{Message: "no permitido"}
+	})
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+	if rec := doJSONRequest(router, http.MethodPost, "/api/v2/convert", convertRequest(t, sampleDocument())); rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), ErrHookAbortedCode) {
+		t.Errorf("v2 debe responder 422 %s: %d %s", ErrHookAbortedCode, rec.Code, rec.Body.String())
+	}
+
+	service = newMemoryService()
+	service.RegisterHook(AfterConvert, "datalake", func(ctx *PipelineContext) error {
+		return errors.New("sin conexión")
+	})
+	if resp, _ := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM); resp.ErrorCode != ErrHookFailedCode {
+		t.Errorf("se esperaba %s, obtenido %+v", ErrHookFailedCode, resp)
+	}
+
+	if err := service.RegisterHook("after_send", "x", func(*PipelineContext) error { return nil }); err == nil {
+		t.Error("un punto desconocido debe rechazarse")
+	}
+}
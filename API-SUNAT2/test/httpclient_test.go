@@ -0,0 +1,99 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/util/httpclient"
+)
+
+func TestHTTPPoolTimeoutPerDestination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	opts := httpclient.DefaultOptions()
+	opts.Timeouts[httpclient.DestinationPadron] = 50 * time.Millisecond
+	pool, err := httpclient.NewPool(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = pool.Client(httpclient.DestinationPadron).Get(server.URL)
+	if err == nil {
+		t.Fatal("se esperaba un error de timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("el request duró %v, el timeout del padrón es 50ms", elapsed)
+	}
+
+	// El timeout de SUNAT es independiente y deja terminar el request
+	resp, err := pool.Client(httpclient.DestinationSunat).Get(server.URL)
+	if err != nil {
+		t.Fatalf("el cliente de SUNAT no debía expirar: %v", err)
+	}
+	resp.Body.Close()
+
+	report := pool.Metrics().Report()
+	if stats := report[httpclient.DestinationPadron]; stats.Count != 1 || stats.Errors != 1 {
+		t.Errorf("métricas del padrón = %+v, esperado 1 request con error", stats)
+	}
+	if stats := report[httpclient.DestinationSunat]; stats.Count != 1 || stats.Errors != 0 || stats.MaxMs < 250 {
+		t.Errorf("métricas de SUNAT = %+v, esperado 1 request de ~300ms", stats)
+	}
+}
+
+func TestHTTPPoolProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A través de un proxy el request llega con la URL absoluta del destino
+		proxied = append(proxied, r.URL.String())
+		json.NewEncoder(w).Encode(TaxpayerStatus{RUC: "20123456786", State: "ACTIVO", Condition: "HABIDO"})
+	}))
+	defer proxy.Close()
+
+	opts := httpclient.DefaultOptions()
+	opts.ProxyURL = proxy.URL
+	pool, err := httpclient.NewPool(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// El padrón recibe el cliente del pool por inyección
+	padron := NewHTTPPadronClient("http://padron.sunat.invalid/ruc", pool.Client(httpclient.DestinationPadron))
+	status, err := padron.Lookup("20123456786")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsOperational() {
+		t.Errorf("estado inesperado: %+v", status)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://padron.sunat.invalid/ruc/20123456786" {
+		t.Errorf("el proxy recibió %v", proxied)
+	}
+
+	if _, err := httpclient.NewPool(httpclient.Options{ProxyURL: "://proxy"}); err == nil {
+		t.Error("se esperaba un error con un proxy inválido")
+	}
+}
+
+func TestHTTPPoolReusesClients(t *testing.T) {
+	pool, err := httpclient.NewPool(httpclient.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Client(httpclient.DestinationSunat) != pool.Client(httpclient.DestinationSunat) {
+		t.Error("se esperaba el mismo cliente para el mismo destino")
+	}
+	if timeout := pool.Client(httpclient.DestinationWebhook).Timeout; timeout != 30*time.Second {
+		t.Errorf("timeout por defecto = %v, esperado 30s", timeout)
+	}
+}
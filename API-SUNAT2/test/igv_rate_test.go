@@ -0,0 +1,119 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"API-SUNAT2/catalog"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// simulatedIGVRates baja el IGV al 17% desde el 2024-06-08, el día siguiente a la factura de ejemplo
+const simulatedIGVRates = "2011-03-01:18,2024-06-08:17"
+
+// withIGVRate retorna la factura de ejemplo emitida en la fecha indicada con la tasa de IGV dada
+func withIGVRate(issueDate string, rate float64) *BusinessDocument {
+	doc := sampleDocument()
+	doc.IssueDate = issueDate
+	doc.Items[0].Taxes[0].TaxRate = FlexFloat(rate)
+	doc.Taxes[0].TaxRate = FlexFloat(rate)
+	return doc
+}
+
+func TestIGVRateHistory(t *testing.T) {
+	validator := NewValidationService(nil)
+	cases := []struct {
+		date  string
+		rate  float64
+		valid bool
+	}{
+		{"2011-02-28", 19, true},
+		{"2011-02-28", 18, false},
+		{"2011-03-01", 18, true},
+		{"2011-03-01", 19, false},
+	}
+	for _, tc := range cases {
+		errs := validator.ValidateBusinessDocument(withIGVRate(tc.date, tc.rate))
+		if hasRule(errs, "tax_rate_validation") == tc.valid {
+			t.Errorf("IGV %v%% el %s: válido = %v, errores %+v", tc.rate, tc.date, tc.valid, errs)
+		}
+	}
+}
+
+func TestIGVRateSimulatedChange(t *testing.T) {
+	rates, err := catalog.ParseIGVRates(simulatedIGVRates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator := NewValidationService(nil)
+	validator.SetIGVRates(rates)
+
+	if errs := validator.ValidateBusinessDocument(withIGVRate("2024-06-07", 18)); len(errs) > 0 {
+		t.Errorf("antes del cambio el 18%% es el vigente: %+v", errs)
+	}
+	errs := validator.ValidateBusinessDocument(withIGVRate("2024-06-08", 18))
+	if len(errs) != 2 || errs[0].Expected != "17.00" || errs[1].Field != "items[0].taxes[0].taxRate" {
+		t.Errorf("desde el cambio se esperaba el 17%% en documento y línea, obtenido %+v", errs)
+	}
+	if errs := validator.ValidateBusinessDocument(withIGVRate("2024-06-08", 17)); len(errs) > 0 {
+		t.Errorf("desde el cambio el 17%% es el vigente: %+v", errs)
+	}
+
+	for _, invalid := range []string{"", "2024-06-08", "2024-13-01:17", "2024-06-08:-1"} {
+		if _, err := catalog.ParseIGVRates(invalid); err == nil {
+			t.Errorf("se esperaba error al leer la tabla %q", invalid)
+		}
+	}
+}
+
+func TestIGVRateWarningMode(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	rates, _ := catalog.ParseIGVRates(simulatedIGVRates)
+	service.GetValidator().SetIGVRates(rates)
+	service.GetValidator().SetIGVRateCheck(IGVRateCheckWarning)
+
+	resp, err := service.ProcessDocument(context.Background(), withIGVRate("2024-06-08", 18), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("en modo warning la tasa no vigente no debe bloquear: %v %+v", err, resp)
+	}
+	if !hasRule(resp.Warnings, "tax_rate_validation") || len(resp.Warnings) != 2 {
+		t.Errorf("se esperaba advertir la tasa de documento y línea, obtenido %+v", resp.Warnings)
+	}
+
+	// Las demás tasas siguen siendo errores
+	doc := withIGVRate("2024-06-08", 17)
+	doc.Items[0].Taxes = append(doc.Items[0].Taxes, Tax{TaxType: "9997", TaxRate: 18})
+	if resp, _ := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM); resp.Status == "SUCCESS" {
+		t.Errorf("una tasa de exonerado distinta de 0 debe seguir siendo error: %+v", resp)
+	}
+}
+
+func TestPricesIncludeTaxUsesRateInForce(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	rates, _ := catalog.ParseIGVRates(simulatedIGVRates)
+	service.GetValidator().SetIGVRates(rates)
+
+	cases := []struct {
+		date      string
+		rate      FlexFloat
+		lineTotal FlexFloat
+	}{
+		{"2024-06-07", 18, 100},
+		{"2024-06-08", 17, 100.85},
+	}
+	for _, tc := range cases {
+		doc := taxIncludedDocument(118)
+		doc.Number = tc.date[8:]
+		doc.IssueDate = tc.date
+		resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+		if err != nil || resp.Status != "SUCCESS" {
+			t.Fatalf("%s: %v %+v", tc.date, err, resp)
+		}
+		if doc.Taxes[0].TaxRate != tc.rate || doc.Items[0].LineTotal != tc.lineTotal {
+			t.Errorf("%s: tasa %v y base %.2f, esperado %v y %.2f", tc.date, doc.Taxes[0].TaxRate, doc.Items[0].LineTotal, tc.rate, tc.lineTotal)
+		}
+	}
+}
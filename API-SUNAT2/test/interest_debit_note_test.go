@@ -0,0 +1,183 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func TestCalculateInterest(t *testing.T) {
+	cases := []struct {
+		balance float64
+		rate    float64
+		days    int
+		method  string
+		want    float64
+	}{
+		{1000, 12, 360, InterestMethodEffective, 120},
+		{1000, 12, 360, InterestMethodSimple, 120},
+		{1000, 12, 30, InterestMethodEffective, 9.49},
+		{1000, 12, 30, InterestMethodSimple, 10},
+		{2500.5, 18, 45, InterestMethodEffective, 52.27},
+		{2500.5, 18, 45, InterestMethodSimple, 56.26},
+		// Saldo parcial tras una nota de crédito
+		{59, 24, 30, InterestMethodEffective, 1.07},
+		{59, 24, 30, InterestMethodSimple, 1.18},
+		{1000, 12, 0, InterestMethodEffective, 0},
+		{0, 12, 30, InterestMethodSimple, 0},
+	}
+	for _, tc := range cases {
+		if got := CalculateInterest(tc.balance, tc.rate, tc.days, tc.method); got != tc.want {
+			t.Errorf("%.2f al %.0f%% por %d días (%s): se esperaba %.2f, obtenido %.2f", tc.balance, tc.rate, tc.days, tc.method, tc.want, got)
+		}
+	}
+}
+
+// overdueInvoice procesa la factura de ejemplo con vencimiento al 2024-07-07 y una nota
+// de crédito de 59.00 sobre ella; el saldo queda en 59.00
+func overdueInvoice(t *testing.T, service *UBLConverterService) string {
+	t.Helper()
+	invoice := sampleDocument()
+	invoice.DueDate = "2024-07-07"
+	documentID := processForSending(t, service, invoice)
+	processForSending(t, service, sampleCreditNote("07", 1))
+	return documentID
+}
+
+func interestRequest(t *testing.T, rate float64, date, method string) InterestDebitNoteRequest {
+	certPEM, keyPEM := loadTestCredentials(t)
+	return InterestDebitNoteRequest{
+		AnnualRate:      rate,
+		CalculationDate: date,
+		Method:          method,
+		Series:          "FD01",
+		Number:          "1",
+		Certificate:     base64.StdEncoding.EncodeToString(certPEM),
+		PrivateKey:      base64.StdEncoding.EncodeToString(keyPEM),
+	}
+}
+
+func TestInterestDebitNoteOnBalance(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	documentID := overdueInvoice(t, service)
+
+	resp, err := service.IssueInterestDebitNote(context.Background(), documentID, interestRequest(t, 24, "2024-08-06", ""), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("la nota de débito debió emitirse: %v %+v", err, resp)
+	}
+	if resp.DocumentID != "20123456786-08-FD01-1" {
+		t.Errorf("documento inesperado: %s", resp.DocumentID)
+	}
+
+	// El cálculo queda registrado con sus parámetros
+	record := readDocumentRecord(t, service.GetStore(), resp.DocumentID)
+	want := InterestCalculation{
+		AffectedDocumentID: documentID,
+		InvoiceTotal:       118,
+		CreditedAmount:     59,
+		Balance:            59,
+		DueDate:            "2024-07-07",
+		CalculationDate:    "2024-08-06",
+		Days:               30,
+		AnnualRate:         24,
+		Method:             InterestMethodEffective,
+		DayBase:            360,
+		Interest:           1.07,
+	}
+	if record.Interest == nil || *record.Interest != want {
+		t.Fatalf("cálculo registrado inesperado: %+v", record.Interest)
+	}
+	if record.AffectedDocumentID != documentID || record.PayableAmount != 1.07 {
+		t.Errorf("registro inesperado: %+v", record)
+	}
+	if _, ok := resp.Data["interest"]; !ok {
+		t.Error("la respuesta debe incluir el cálculo")
+	}
+
+	xmlData, err := service.GetStore().Read(resp.DocumentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(xmlData)
+	for _, fragment := range []string{
+		`listName="Tipo de nota de debito" listURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo10">01</cbc:ResponseCode>`,
+		"<cbc:Description>Intereses por mora</cbc:Description>",
+		"<cbc:ID>F003-123456</cbc:ID>",
+		"Intereses moratorios de la factura F003-123456 del 2024-07-07 al 2024-08-06 (30 días)",
+		`<cbc:PayableAmount currencyID="PEN">1.07</cbc:PayableAmount>`,
+		">9998</cbc:ID>",
+		"<cbc:RegistrationName>JUAN PEREZ</cbc:RegistrationName>",
+	} {
+		if !strings.Contains(xml, fragment) {
+			t.Errorf("falta %s en:\n%s", fragment, xml)
+		}
+	}
+}
+
+func TestInterestDebitNoteTaxedViaAPI(t *testing.T) {
+	service := newMemoryService()
+	documentID := overdueInvoice(t, service)
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+
+	request := interestRequest(t, 12, "2024-08-06", InterestMethodSimple)
+	request.Taxed = true
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/documents/"+documentID+"/debit-note", request)
+	var resp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp.Status != "SUCCESS" {
+		t.Fatalf("la nota gravada debió emitirse: %d %s", rec.Code, rec.Body.String())
+	}
+	// 59.00 × 12 % × 30/360 = 0.59 más IGV 0.11
+	record := readDocumentRecord(t, service.GetStore(), resp.DocumentID)
+	if record.Interest == nil || record.Interest.Interest != 0.59 || !record.Interest.Taxed || record.Interest.TaxAmount != 0.11 || record.PayableAmount != 0.7 {
+		t.Errorf("cálculo gravado inesperado: %+v %+v", record.Interest, record)
+	}
+}
+
+func TestInterestDebitNoteErrors(t *testing.T) {
+	service := newMemoryService()
+	documentID := overdueInvoice(t, service)
+	boleta := sampleDocument()
+	boleta.Type, boleta.Series = "03", "B001"
+	boletaID := processForSending(t, service, boleta)
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+
+	cases := []struct {
+		name       string
+		documentID string
+		request    InterestDebitNoteRequest
+		status     int
+		code       string
+	}{
+		{"no vencida", documentID, interestRequest(t, 12, "2024-07-07", ""), http.StatusConflict, "ERR_DOCUMENT_NOT_OVERDUE"},
+		{"no es factura", boletaID, interestRequest(t, 12, "2024-08-06", ""), http.StatusConflict, "ERR_NOT_AN_INVOICE"},
+		{"no existe", "20123456786-01-F003-999", interestRequest(t, 12, "2024-08-06", ""), http.StatusNotFound, "ERR_DOCUMENT_NOT_FOUND"},
+		{"tasa inválida", documentID, interestRequest(t, 0, "2024-08-06", ""), http.StatusBadRequest, "ERR_INVALID_INTEREST_REQUEST"},
+		{"método inválido", documentID, interestRequest(t, 12, "2024-08-06", "compuesto"), http.StatusBadRequest, "ERR_INVALID_INTEREST_REQUEST"},
+	}
+	for _, tc := range cases {
+		rec := doJSONRequest(router, http.MethodPost, "/api/v2/documents/"+tc.documentID+"/debit-note", tc.request)
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.code) {
+			t.Errorf("%s: se esperaba %d %s, obtenido %d %s", tc.name, tc.status, tc.code, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Con el saldo cubierto por notas de crédito no hay intereses
+	note := sampleCreditNote("07", 1)
+	note.Number = "2"
+	processForSending(t, service, note)
+	certPEM, keyPEM := loadTestCredentials(t)
+	resp, err := service.IssueInterestDebitNote(context.Background(), documentID, interestRequest(t, 12, "2024-08-06", ""), certPEM, keyPEM)
+	if err != nil || resp.ErrorCode != "ERR_NO_BALANCE" {
+		t.Errorf("se esperaba ERR_NO_BALANCE: %v %+v", err, resp)
+	}
+}
@@ -0,0 +1,130 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+)
+
+// interopSample describe un XML de otro facturador de testdata/interop y lo que se
+// espera leer de él
+type interopSample struct {
+	File               string               `json:"file"`
+	Issuer             string               `json:"issuer"`
+	Compatibility      CompatibilityOptions `json:"compatibility"`
+	IssueDate          string               `json:"issueDate"`
+	Currency           string               `json:"currency"`
+	PayableAmount      float64              `json:"payableAmount"`
+	TaxAmount          float64              `json:"taxAmount"`
+	CustomerDocumentID string               `json:"customerDocumentId"`
+	AffectedDocumentID string               `json:"affectedDocumentId"`
+}
+
+const interopDir = "testdata/interop"
+
+// loadInteropSamples lee el manifiesto y exige que cada XML del catálogo tenga su
+// entrada y viceversa, para que una muestra nueva no quede sin probar
+func loadInteropSamples(t *testing.T) []interopSample {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(interopDir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []interopSample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		t.Fatal(err)
+	}
+
+	listed := map[string]bool{}
+	for _, sample := range samples {
+		listed[sample.File] = true
+	}
+	found := map[string]bool{}
+	err = filepath.Walk(interopDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".xml" {
+			return err
+		}
+		name, _ := filepath.Rel(interopDir, path)
+		name = filepath.ToSlash(name)
+		found[name] = true
+		if !listed[name] {
+			t.Errorf("%s no está en manifest.json", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range listed {
+		if !found[name] {
+			t.Errorf("%s está en manifest.json pero no existe", name)
+		}
+	}
+	issuers := map[string]bool{}
+	for _, sample := range samples {
+		issuers[sample.Issuer] = true
+	}
+	if len(issuers) < 3 {
+		t.Errorf("el catálogo debe cubrir al menos 3 facturadores, tiene %d", len(issuers))
+	}
+	return samples
+}
+
+func TestInteropSamples(t *testing.T) {
+	for _, sample := range loadInteropSamples(t) {
+		sample := sample
+		t.Run(sample.Issuer, func(t *testing.T) {
+			xmlData, err := os.ReadFile(filepath.Join(interopDir, sample.File))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signer := NewDigitalSignatureService(nil)
+			signer.SetCompatibility(sample.Compatibility)
+			results, err := signer.VerifySignatures(xmlData)
+			if err != nil || len(results) != 1 || !results[0].Valid {
+				t.Fatalf("firma: %+v %v", results, err)
+			}
+			if !strings.Contains(results[0].Subject, "SERIALNUMBER=20123456786") {
+				t.Errorf("certificado: %+v", results[0])
+			}
+
+			// Sin las opciones de compatibilidad las diferencias conocidas se reportan
+			strict := NewInvariantChecker()
+			if sample.Compatibility.AllowSHA1 {
+				results, _ := NewDigitalSignatureService(nil).VerifySignatures(xmlData)
+				if len(results) != 1 || results[0].Valid || !strings.Contains(results[0].Error, "SHA-1") {
+					t.Errorf("SHA-1 sin AllowSHA1: %+v", results)
+				}
+			}
+			if sample.Compatibility.AllowMissingLineCount {
+				if errs := strict.CheckReceived(xmlData, CompatibilityOptions{}); !hasRule(errs, "line_count_invariant") {
+					t.Errorf("sin AllowMissingLineCount: %+v", errs)
+				}
+			}
+			if errs := strict.CheckReceived(xmlData, sample.Compatibility); len(errs) > 0 {
+				t.Errorf("invariantes: %+v", errs)
+			}
+
+			record, err := ExtractDocumentRecord(filepath.Base(sample.File), xmlData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.IssueDate != sample.IssueDate || record.Currency != sample.Currency ||
+				record.PayableAmount != sample.PayableAmount || record.TaxAmount != sample.TaxAmount ||
+				record.CustomerDocumentID != sample.CustomerDocumentID || record.AffectedDocumentID != sample.AffectedDocumentID {
+				t.Errorf("registro: %+v", record)
+			}
+
+			// Cualquier cambio en el contenido firmado invalida la firma
+			tampered := strings.Replace(string(xmlData), "<cbc:IssueDate>"+sample.IssueDate, "<cbc:IssueDate>2024-01-01", 1)
+			if results, _ := signer.VerifySignatures([]byte(tampered)); len(results) != 1 || results[0].Valid {
+				t.Errorf("XML alterado aceptado: %+v", results)
+			}
+		})
+	}
+}
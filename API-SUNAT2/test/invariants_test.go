@@ -0,0 +1,100 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// faultyConverter simula un convertidor que altera el XML generado
+type faultyConverter struct {
+	inner  DocumentConverter
+	mutate func(string) string
+}
+
+func (f *faultyConverter) ConvertToUBL(doc *BusinessDocument) ([]byte, error) {
+	xmlData, err := f.inner.ConvertToUBL(doc)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(f.mutate(string(xmlData))), nil
+}
+
+func TestInvariantsPassForGeneratedXML(t *testing.T) {
+	doc := sampleDocument()
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+	if err != nil {
+		t.Fatalf("conversión falló: %v", err)
+	}
+	if errs := NewInvariantChecker().Check(xmlData, doc); len(errs) > 0 {
+		t.Fatalf("no se esperaban errores, se obtuvo %+v", errs)
+	}
+}
+
+func TestInvariantsRejectFaultyConverter(t *testing.T) {
+	cases := []struct {
+		name   string
+		rule   string
+		mutate func(string) string
+	}{
+		{
+			name: "dos TaxTotal raíz",
+			rule: "single_root_taxtotal_invariant",
+			mutate: func(s string) string {
+				start := strings.Index(s, "\n  <cac:TaxTotal>")
+				end := strings.Index(s, "</cac:TaxTotal>\n  <cac:LegalMonetaryTotal>") + len("</cac:TaxTotal>")
+				return s[:end] + s[start:end] + s[end:]
+			},
+		},
+		{
+			name: "LineCountNumeric incorrecto",
+			rule: "line_count_invariant",
+			mutate: func(s string) string {
+				return strings.Replace(s, "<cbc:LineCountNumeric>1<", "<cbc:LineCountNumeric>3<", 1)
+			},
+		},
+		{
+			name: "ID de documento inconsistente",
+			rule: "document_id_invariant",
+			mutate: func(s string) string {
+				return strings.Replace(s, "<cbc:ID>F003-123456</cbc:ID>\n  <cbc:IssueDate>", "<cbc:ID>F999-1</cbc:ID>\n  <cbc:IssueDate>", 1)
+			},
+		},
+		{
+			name: "moneda mezclada",
+			rule: "uniform_currency_invariant",
+			mutate: func(s string) string {
+				return strings.Replace(s, `currencyID="PEN"`, `currencyID="USD"`, 1)
+			},
+		},
+		{
+			name: "línea sin numeración 1..N",
+			rule: "line_id_sequence_invariant",
+			mutate: func(s string) string {
+				return strings.Replace(s, "<cac:InvoiceLine>\n    <cbc:ID>1</cbc:ID>", "<cac:InvoiceLine>\n    <cbc:ID>7</cbc:ID>", 1)
+			},
+		},
+	}
+
+	certPEM, keyPEM := loadTestCredentials(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := NewUBLConverterService(t.TempDir())
+			service.SetConverter(&faultyConverter{inner: NewUBLConverter(nil), mutate: tc.mutate})
+
+			response, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+			if err != nil {
+				t.Fatalf("error inesperado: %v", err)
+			}
+			if response.ErrorCode != "ERR_POSTCONVERT_INVARIANT" {
+				t.Fatalf("se esperaba ERR_POSTCONVERT_INVARIANT, se obtuvo %q", response.ErrorCode)
+			}
+			if !hasRule(response.ValidationErrors, tc.rule) {
+				t.Fatalf("se esperaba la regla %s en %+v", tc.rule, response.ValidationErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// iscDocument retorna la factura de ejemplo (2 unidades, valor de venta 100.00) con el
+// ISC del sistema indicado y el IGV calculado sobre el valor de venta más el ISC
+func iscDocument(isc Tax) *BusinessDocument {
+	doc := sampleDocument()
+	item := &doc.Items[0]
+	igvBase := item.LineTotal + isc.TaxAmount
+	igv := Tax{TaxType: "1000", TaxRate: 18, TaxBase: igvBase, TaxAmount: FlexFloat(Decimal2(igvBase * 0.18).Round())}
+	item.Taxes = []Tax{isc, igv}
+
+	doc.Taxes = []TaxTotal{
+		{TaxType: "1000", TaxAmount: igv.TaxAmount, TaxRate: 18, TaxBase: igv.TaxBase},
+		{TaxType: "2000", TaxAmount: isc.TaxAmount, TaxRate: isc.TaxRate, TaxBase: isc.TaxBase},
+	}
+	taxes := Decimal2(isc.TaxAmount + igv.TaxAmount).Round()
+	doc.Totals = DocumentTotals{SubTotal: 100, TotalTaxes: FlexFloat(taxes), TotalAmount: FlexFloat(100 + taxes), PayableAmount: FlexFloat(100 + taxes)}
+	return doc
+}
+
+func TestISCSystems(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	cases := []struct {
+		name      string
+		isc       Tax
+		fragments []string
+	}{
+		{"al valor: 30% del valor de venta", Tax{TaxType: "2000", IscSystem: "01", TaxRate: 30, TaxBase: 100, TaxAmount: 30},
+			[]string{"<cbc:TierRange>01</cbc:TierRange>", `<cbc:TaxAmount currencyID="PEN">53.4</cbc:TaxAmount>`}},
+		{"específico: 2.50 por unidad", Tax{TaxType: "2000", IscSystem: "02", IscAmountPerUnit: 2.5, TaxBase: 100, TaxAmount: 5},
+			[]string{"<cbc:TierRange>02</cbc:TierRange>", `<cbc:PerUnitAmount currencyID="PEN">2.5</cbc:PerUnitAmount>`}},
+		// 2 × 70.00 sin IGV es 118.64; el 10% es 11.86
+		{"precio de venta al público: 10%", Tax{TaxType: "2000", IscSystem: "03", TaxRate: 10, RetailPrice: 70, TaxBase: 118.64, TaxAmount: 11.86},
+			[]string{"<cbc:TierRange>03</cbc:TierRange>"}},
+	}
+
+	for _, tc := range cases {
+		doc := iscDocument(tc.isc)
+		if errs := NewValidationService(nil).ValidateBusinessDocument(doc); len(errs) > 0 {
+			t.Errorf("%s: no se esperaban errores: %+v", tc.name, errs)
+			continue
+		}
+
+		pipeline := newMemoryService().NewDefaultPipeline()
+		pipeline.SetWriter(nil)
+		ctx, err := pipeline.Run(context.Background(), doc, certPEM, keyPEM)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		xml := string(ctx.XML)
+		for _, fragment := range append(tc.fragments, "<cbc:TaxTypeCode>EXC</cbc:TaxTypeCode>") {
+			if !strings.Contains(xml, fragment) {
+				t.Errorf("%s: falta %s", tc.name, fragment)
+			}
+		}
+		// El TaxTotal del documento acumula el ISC en su propio subtotal, aparte del IGV
+		root := xml[:strings.Index(xml, "<cac:LegalMonetaryTotal>")]
+		root = root[strings.LastIndex(root, "<cac:TaxTotal>"):]
+		if n := strings.Count(root, "<cac:TaxSubtotal>"); n != 2 {
+			t.Errorf("%s: se esperaban 2 subtotales en el TaxTotal del documento, hay %d", tc.name, n)
+		}
+	}
+}
+
+func TestISCValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+	valueISC := Tax{TaxType: "2000", IscSystem: "01", TaxRate: 30, TaxBase: 100, TaxAmount: 30}
+
+	cases := []struct {
+		name  string
+		doc   func() *BusinessDocument
+		field string
+	}{
+		{"monto distinto de la tasa sobre el valor", func() *BusinessDocument {
+			doc := iscDocument(valueISC)
+			doc.Items[0].Taxes[0].TaxAmount = 25
+			return doc
+		}, "items[0].taxes[0].taxAmount"},
+		{"IGV sobre el valor de venta sin el ISC", func() *BusinessDocument {
+			doc := iscDocument(valueISC)
+			doc.Items[0].Taxes[1].TaxBase, doc.Items[0].Taxes[1].TaxAmount = 100, 18
+			return doc
+		}, "items[0].taxes[1].taxBase"},
+		{"sistema fuera del catálogo", func() *BusinessDocument {
+			isc := valueISC
+			isc.IscSystem = "04"
+			return iscDocument(isc)
+		}, "items[0].taxes[0].iscSystem"},
+		{"específico sin monto por unidad", func() *BusinessDocument {
+			return iscDocument(Tax{TaxType: "2000", IscSystem: "02", TaxBase: 100, TaxAmount: 5})
+		}, "items[0].taxes[0].iscAmountPerUnit"},
+		{"precio al público con la tasa sobre el precio con IGV", func() *BusinessDocument {
+			return iscDocument(Tax{TaxType: "2000", IscSystem: "03", TaxRate: 10, RetailPrice: 70, TaxBase: 140, TaxAmount: 14})
+		}, "items[0].taxes[0].taxBase"},
+		{"ISC del documento distinto del de las líneas", func() *BusinessDocument {
+			doc := iscDocument(valueISC)
+			doc.Taxes[1].TaxAmount = 20
+			return doc
+		}, "taxes"},
+		{"sistema en un tributo que no es ISC", func() *BusinessDocument {
+			doc := sampleDocument()
+			doc.Items[0].Taxes[0].IscSystem = "01"
+			return doc
+		}, "items[0].taxes[0].iscSystem"},
+	}
+
+	for _, tc := range cases {
+		errs := validator.ValidateBusinessDocument(tc.doc())
+		found := false
+		for _, err := range errs {
+			if err.Rule == "isc_validation" && err.Field == tc.field {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: se esperaba error isc_validation en %s, obtenido %+v", tc.name, tc.field, errs)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// issueDateErrors retorna los errores de coherencia de la fecha de emisión
+func issueDateErrors(errs []ValidationError) []ValidationError {
+	var found []ValidationError
+	for _, err := range errs {
+		if err.Rule == IssueDateCoherenceRule {
+			found = append(found, err)
+		}
+	}
+	return found
+}
+
+func TestNoteIssueDateCoherence(t *testing.T) {
+	validator := NewValidationService(nil)
+	validator.SetNoteMaxDays(30)
+
+	// La nota referencia una factura del 2024-06-07
+	cases := []struct {
+		name      string
+		docType   string
+		issueDate string
+		field     string
+	}{
+		{"crédito el mismo día", "07", "2024-06-07", ""},
+		{"crédito un día antes", "07", "2024-06-06", "reference.issueDate"},
+		{"débito un día antes", "08", "2024-06-06", "reference.issueDate"},
+		{"crédito en el último día del plazo", "07", "2024-07-07", ""},
+		{"crédito un día después del plazo", "07", "2024-07-08", "issueDate"},
+		{"débito un día después del plazo", "08", "2024-07-08", "issueDate"},
+	}
+	for _, tc := range cases {
+		doc := sampleCreditNote("01", 2)
+		doc.Type, doc.IssueDate = tc.docType, tc.issueDate
+		if tc.docType == "08" {
+			doc.Series = "FD01"
+		}
+		errs := issueDateErrors(validator.ValidateBusinessDocument(doc))
+		if tc.field == "" {
+			if len(errs) != 0 {
+				t.Errorf("%s: no se esperaban errores: %+v", tc.name, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Field != tc.field {
+			t.Errorf("%s: se esperaba un error en %s: %+v", tc.name, tc.field, errs)
+			continue
+		}
+		// El mensaje explica la regla con las dos fechas
+		if !strings.Contains(errs[0].Message, tc.issueDate) || !strings.Contains(errs[0].Message, "2024-06-07") {
+			t.Errorf("%s: el mensaje debe indicar ambas fechas: %s", tc.name, errs[0].Message)
+		}
+	}
+
+	// Con plazo 0 la nota no tiene límite
+	validator.SetNoteMaxDays(0)
+	doc := sampleCreditNote("01", 2)
+	doc.IssueDate = "2030-01-01"
+	if errs := issueDateErrors(validator.ValidateBusinessDocument(doc)); len(errs) != 0 {
+		t.Errorf("sin plazo no debe haber error: %+v", errs)
+	}
+
+	// En una nota consolidada cada referencia se verifica por separado
+	doc = sampleCreditNote("01", 2)
+	doc.Reference = nil
+	doc.References = []DocumentReference{
+		{DocumentType: "01", DocumentID: "F003-1", IssueDate: "2024-06-01", ReasonCode: "01", Amount: 59},
+		{DocumentType: "01", DocumentID: "F003-2", IssueDate: "2024-06-08", ReasonCode: "01", Amount: 59},
+	}
+	errs := issueDateErrors(validator.ValidateBusinessDocument(doc))
+	if len(errs) != 1 || errs[0].Field != "references[1].issueDate" || !strings.Contains(errs[0].Message, "F003-2") {
+		t.Errorf("se esperaba el error solo en la segunda referencia: %+v", errs)
+	}
+}
+
+func TestContingencyIssueDateCoherence(t *testing.T) {
+	validator := NewValidationService(nil)
+	contingency := func(issueDate, outage string) *BusinessDocument {
+		doc := sampleDocument()
+		doc.Series, doc.Contingency = "0001", true
+		doc.IssueDate, doc.ContingencyDate = issueDate, outage
+		return doc
+	}
+
+	if errs := issueDateErrors(validator.ValidateBusinessDocument(contingency("2024-06-07", "2024-06-07"))); len(errs) != 0 {
+		t.Errorf("el día de la caída es válido: %+v", errs)
+	}
+	if errs := issueDateErrors(validator.ValidateBusinessDocument(contingency("2024-06-06", "2024-06-07"))); len(errs) != 0 {
+		t.Errorf("una fecha anterior a la caída es válida: %+v", errs)
+	}
+	errs := issueDateErrors(validator.ValidateBusinessDocument(contingency("2024-06-08", "2024-06-07")))
+	if len(errs) != 1 || errs[0].Field != "issueDate" || !strings.Contains(errs[0].Message, "2024-06-08") || !strings.Contains(errs[0].Message, "2024-06-07") {
+		t.Errorf("una fecha posterior a la caída debe rechazarse con ambas fechas: %+v", errs)
+	}
+
+	// El día de la caída solo lo declara un comprobante de contingencia, con fecha válida
+	if !hasRule(validator.ValidateBusinessDocument(contingency("2024-06-07", "07/06/2024")), "date_validation") {
+		t.Error("se esperaba rechazo del formato de contingencyDate")
+	}
+	doc := sampleDocument()
+	doc.ContingencyDate = "2024-06-07"
+	if !hasRule(validator.ValidateBusinessDocument(doc), "contingency_series_validation") {
+		t.Error("contingencyDate sin contingency debe rechazarse")
+	}
+}
+
+func TestIssueDateCheckSeverity(t *testing.T) {
+	validator := NewValidationService(nil)
+	doc := sampleCreditNote("01", 2)
+	doc.IssueDate = "2024-06-06"
+
+	validator.SetIssueDateCheck(IssueDateCheckWarning)
+	if errs := issueDateErrors(validator.ValidateBusinessDocument(doc)); len(errs) != 0 {
+		t.Errorf("en modo warning no debe haber errores: %+v", errs)
+	}
+	if warnings := validator.IssueDateWarnings(doc); len(warnings) != 1 || warnings[0].Rule != IssueDateCoherenceRule {
+		t.Errorf("en modo warning debe advertirse: %+v", warnings)
+	}
+
+	validator.SetIssueDateCheck(IssueDateCheckOff)
+	if errs := issueDateErrors(validator.ValidateBusinessDocument(doc)); len(errs) != 0 || len(validator.IssueDateWarnings(doc)) != 0 {
+		t.Error("en modo off no debe verificarse")
+	}
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/bench"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+func TestDocumentTooLargeByItems(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetLimits(5, 0)
+
+	response, err := service.ProcessDocument(context.Background(), bench.SyntheticDocument(6), certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if response.ErrorCode != "ERR_DOCUMENT_TOO_LARGE" {
+		t.Fatalf("se esperaba ERR_DOCUMENT_TOO_LARGE, se obtuvo %+v", response)
+	}
+}
+
+func TestDocumentTooLargeByBytes(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetLimits(0, 4096)
+
+	response, err := service.ProcessDocument(context.Background(), bench.SyntheticDocument(10), certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if response.ErrorCode != "ERR_DOCUMENT_TOO_LARGE" {
+		t.Fatalf("se esperaba ERR_DOCUMENT_TOO_LARGE, se obtuvo %+v", response)
+	}
+}
+
+func TestXMLSizeRegistry(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	store := storage.NewMemoryStore()
+	service := newMemoryService()
+	service.SetStore(store)
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{}, clock))
+
+	var sent string
+	for _, lines := range []int{1, 5} {
+		response, err := service.ProcessDocument(context.Background(), bench.SyntheticDocument(lines), certPEM, keyPEM)
+		if err != nil || response.Status != "SUCCESS" {
+			t.Fatalf("procesamiento falló: %v %+v", err, response)
+		}
+		sent = response.DocumentID
+	}
+	// Solo el segundo documento se envía; un reenvío no vuelve a contarse
+	for i := 0; i < 2; i++ {
+		if resp, err := service.SendDocument(context.Background(), sent, ""); err != nil || resp.Status != "SUCCESS" {
+			t.Fatalf("envío falló: %v %+v", err, resp)
+		}
+	}
+
+	// Los tamaños se leen del store: sobreviven a un reinicio del servicio
+	restarted := newMemoryService()
+	restarted.SetStore(store)
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, restarted)
+	report := func(query string) map[string]SizeStats {
+		rec := doRequest(router, http.MethodGet, "/api/v1/admin/reports/xml-sizes"+query, map[string]string{"X-Admin-API-Key": "secreto"})
+		var resp struct {
+			Data struct {
+				Issuers map[string]SizeStats `json:"issuers"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", query, rec.Code, rec.Body.String())
+		}
+		return resp.Data.Issuers
+	}
+
+	generated := report("")["20123456786"]
+	if generated.Count != 2 || generated.Max <= generated.P50 {
+		t.Fatalf("estadísticas inesperadas: %+v", generated)
+	}
+	if mock := report("?environment=" + EnvironmentMock)["20123456786"]; mock.Count != 1 || mock.Max != generated.Max {
+		t.Errorf("tamaños enviados al ambiente mock: %+v", mock)
+	}
+	if beta := report("?environment=beta"); len(beta) != 0 {
+		t.Errorf("no se enviaron documentos a beta: %+v", beta)
+	}
+	rec := doRequest(router, http.MethodGet, "/api/v1/admin/reports/xml-sizes?environment=test", map[string]string{"X-Admin-API-Key": "secreto"})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_ENVIRONMENT") {
+		t.Errorf("ambiente inválido: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestXMLSizeSampleBounded(t *testing.T) {
+	registry := NewSizeRegistry()
+	store := storage.NewMemoryStore()
+	for size := 1; size <= 3*MaxXMLSizeSamples; size++ {
+		if err := registry.Record(store, "20123456786", "", size); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := store.Read(XMLSizesName("20123456786", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sample XMLSizeSample
+	if err := json.Unmarshal(data, &sample); err != nil {
+		t.Fatal(err)
+	}
+	if len(sample.Sizes) != MaxXMLSizeSamples || sample.Count != 3*MaxXMLSizeSamples || sample.Max != 3*MaxXMLSizeSamples {
+		t.Fatalf("la muestra debe estar acotada: %d tamaños, count %d, max %d", len(sample.Sizes), sample.Count, sample.Max)
+	}
+
+	// La muestra uniforme aproxima la mediana de 1..3000
+	report, _ := registry.Report(store, "")
+	if p50 := report["20123456786"].P50; p50 < 1200 || p50 > 1800 {
+		t.Errorf("mediana fuera de rango: %d", p50)
+	}
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/bench"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// invalidLinesDocument genera una factura de lines líneas con errores repartidos en
+// todo el documento, para que cada tramo de la validación en paralelo reporte alguno
+func invalidLinesDocument(lines int) *BusinessDocument {
+	doc := bench.SyntheticDocument(lines)
+	for i := range doc.Items {
+		switch i % 97 {
+		case 0:
+			doc.Items[i].UnitCode = "CAJ"
+		case 13:
+			doc.Items[i].Description = strings.Repeat("x", MaxItemDescriptionLength+1)
+		case 42:
+			doc.Items[i].UnitPrice = 0
+			doc.Items[i].Quantity = -1
+		}
+	}
+	return doc
+}
+
+func TestParallelLineValidationMatchesSequential(t *testing.T) {
+	doc := invalidLinesDocument(5000)
+
+	sequential := NewValidationService(nil)
+	sequential.SetLineWorkers(1)
+	want := sequential.ValidateBusinessDocument(doc)
+	if len(want) == 0 {
+		t.Fatal("se esperaban errores de línea")
+	}
+
+	for _, workers := range []int{0, 2, 3, 8, 64} {
+		parallel := NewValidationService(nil)
+		parallel.SetLineWorkers(workers)
+		// El resultado es determinista: igual en cada ejecución
+		for run := 0; run < 5; run++ {
+			if got := parallel.ValidateBusinessDocument(doc); !reflect.DeepEqual(got, want) {
+				t.Fatalf("workers=%d: los errores difieren de la validación secuencial (%d vs %d)", workers, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestParallelLineValidationPreservesLineOrder(t *testing.T) {
+	validator := NewValidationService(nil)
+	validator.SetLineWorkers(4)
+	doc := invalidLinesDocument(2000)
+
+	last := -1
+	for _, err := range validator.ValidateBusinessDocument(doc) {
+		if !strings.HasPrefix(err.Field, "items[") {
+			continue
+		}
+		var index int
+		if _, scanErr := fmt.Sscanf(err.Field, "items[%d]", &index); scanErr != nil {
+			t.Fatal(scanErr)
+		}
+		if index < last {
+			t.Fatalf("el error de %s aparece después del de la línea %d", err.Field, last)
+		}
+		last = index
+	}
+	if last < 1900 {
+		t.Errorf("se esperaban errores hasta el final del documento, el último es de la línea %d", last)
+	}
+}
+
+func BenchmarkValidateBusinessDocument(b *testing.B) {
+	for _, lines := range []int{100, 1000, 10000} {
+		doc := bench.SyntheticDocument(lines)
+		for _, mode := range []struct {
+			name    string
+			workers int
+		}{{"sequential", 1}, {"parallel", 0}} {
+			b.Run(fmt.Sprintf("lines=%d/%s", lines, mode.name), func(b *testing.B) {
+				validator := NewValidationService(nil)
+				validator.SetLineWorkers(mode.workers)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					validator.ValidateBusinessDocument(doc)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// withInformativeLine agrega antes del ítem de ejemplo una línea informativa con cantidad cero
+func withInformativeLine(doc *BusinessDocument) *BusinessDocument {
+	informative := DocumentItem{ID: "INFO", Description: "Garantía de 12 meses", UnitCode: "ZZ", Informative: true}
+	doc.Items = append([]DocumentItem{informative}, doc.Items...)
+	return doc
+}
+
+func TestItemsRequired(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	empty := sampleDocument()
+	empty.Items = nil
+	if !hasRule(validator.ValidateBusinessDocument(empty), "items_required_validation") {
+		t.Error("un documento sin ítems debe rechazarse")
+	}
+
+	// Solo líneas informativas: no queda ninguna línea que emitir
+	onlyInformative := withInformativeLine(sampleDocument())
+	onlyInformative.Items = onlyInformative.Items[:1]
+	if !hasRule(validator.ValidateBusinessDocument(onlyInformative), "items_required_validation") {
+		t.Error("un documento solo con líneas informativas debe rechazarse")
+	}
+}
+
+func TestZeroQuantityItems(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	if errs := validator.ValidateBusinessDocument(withInformativeLine(sampleDocument())); len(errs) > 0 {
+		t.Errorf("la línea informativa con cantidad cero debe admitirse: %+v", errs)
+	}
+
+	doc := withInformativeLine(sampleDocument())
+	doc.Items[0].Informative = false
+	if !hasRule(validator.ValidateBusinessDocument(doc), "quantity_validation") {
+		t.Error("un ítem no informativo con cantidad cero debe rechazarse")
+	}
+}
+
+func TestFilteredLinesNumbering(t *testing.T) {
+	doc := withInformativeLine(sampleDocument())
+	second := doc.Items[1]
+	second.ID = "P-2"
+	doc.Items = append(doc.Items, second)
+
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmlStr := string(xmlData)
+	if !strings.Contains(xmlStr, "<cbc:LineCountNumeric>2</cbc:LineCountNumeric>") {
+		t.Error("LineCountNumeric debe contar solo las líneas emitidas")
+	}
+	if strings.Contains(xmlStr, "Garantía") {
+		t.Error("la línea informativa con cantidad cero no debe emitirse")
+	}
+	lineIDs := regexp.MustCompile(`<cac:InvoiceLine>\s*<cbc:ID>([^<]*)</cbc:ID>`).FindAllStringSubmatch(xmlStr, -1)
+	if len(lineIDs) != 2 || lineIDs[0][1] != "1" || lineIDs[1][1] != "2" {
+		t.Errorf("las líneas emitidas deben numerarse 1..N: %v", lineIDs)
+	}
+	if errs := NewInvariantChecker().Check(xmlData, doc); len(errs) > 0 {
+		t.Errorf("no se esperaban errores de invariantes: %+v", errs)
+	}
+}
+
+func TestLineCountInvariantAgainstDocument(t *testing.T) {
+	// XML de un documento con una línea verificado contra uno con dos
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(sampleDocument())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := sampleDocument()
+	doc.Items = append(doc.Items, doc.Items[0])
+	if !hasRule(NewInvariantChecker().Check(xmlData, doc), "document_lines_invariant") {
+		t.Error("se esperaba document_lines_invariant")
+	}
+}
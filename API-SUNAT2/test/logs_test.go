@@ -0,0 +1,90 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/util"
+	"github.com/sirupsen/logrus"
+)
+
+// failingConverter simula un error del convertidor UBL
+type failingConverter struct{}
+
+func (failingConverter) ConvertToUBL(doc *BusinessDocument) ([]byte, error) {
+	return nil, errors.New("plantilla UBL inválida")
+}
+
+func TestAdminLogsForFailedConversion(t *testing.T) {
+	service := newMemoryService()
+	service.SetConverter(failingConverter{})
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secret"}, service)
+
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", convertRequest(t, sampleDocument()))
+	var converted APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &converted)
+	if converted.ErrorCode != "CONVERSION_FAILED" || converted.CorrelationID == "" {
+		t.Fatalf("se esperaba CONVERSION_FAILED con correlationId: %s", rec.Body.String())
+	}
+
+	headers := map[string]string{"X-Admin-API-Key": "secret"}
+	rec = doRequest(router, http.MethodGet, "/api/v1/admin/logs?correlationId="+converted.CorrelationID, headers)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("logs = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Entries []LogEntry `json:"entries"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+
+	var operations []string
+	for _, entry := range resp.Data.Entries {
+		operations = append(operations, entry.Fields["operation"].(string))
+	}
+	want := []string{"PROCESS_DOCUMENT", "VALIDATE", "CONVERT", "CONVERSION_ERROR"}
+	if len(operations) != len(want) {
+		t.Fatalf("operaciones = %v, esperadas %v", operations, want)
+	}
+	for i := range want {
+		if operations[i] != want[i] {
+			t.Fatalf("operaciones = %v, esperadas %v", operations, want)
+		}
+	}
+	if last := resp.Data.Entries[len(want)-1]; last.Level != "error" || last.Message != "plantilla UBL inválida" {
+		t.Errorf("entrada de error inesperada: %+v", last)
+	}
+
+	for query, code := range map[string]int{"": http.StatusBadRequest, "?correlationId=desconocido": http.StatusNotFound} {
+		if rec := doRequest(router, http.MethodGet, "/api/v1/admin/logs"+query, headers); rec.Code != code {
+			t.Errorf("logs%s = %d, esperado %d", query, rec.Code, code)
+		}
+	}
+}
+
+func TestLogBufferEviction(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	buffer := NewLogBuffer(3)
+	logger.AddHook(buffer)
+
+	logger.WithField("correlationId", "a").Info("a1")
+	logger.WithField("correlationId", "b").Info("b1")
+	logger.Info("sin correlationId")
+	logger.WithField("correlationId", "a").Info("a2")
+	logger.WithField("correlationId", "b").Info("b2")
+
+	if got := buffer.Get("a"); len(got) != 1 || got[0].Message != "a2" {
+		t.Errorf("a = %+v, se esperaba solo a2", got)
+	}
+	if got := buffer.Get("b"); len(got) != 2 || got[0].Message != "b1" || got[1].Message != "b2" {
+		t.Errorf("b = %+v, se esperaba b1, b2", got)
+	}
+}
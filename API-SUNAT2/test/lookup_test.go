@@ -0,0 +1,144 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"github.com/gin-gonic/gin"
+)
+
+const lookupPath = "/api/v1/documents/by-number?ruc=20123456786&type=01&series=F003&number=123456"
+
+// newLookupRouter emite y envía al mock de SUNAT la factura de ejemplo
+func newLookupRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newMemoryService()
+	service.SetClock(clock)
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{}, clock))
+
+	resp, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("%v %+v", err, resp)
+	}
+	if sent, err := service.SendDocument(context.Background(), resp.DocumentID, ""); err != nil || sent.Status != "SUCCESS" {
+		t.Fatalf("%v %+v", err, sent)
+	}
+
+	router, _ := api.NewRouterWithService(&config.Config{
+		AdminAPIKey:   "secreto",
+		IssuerAPIKeys: "clave-emisor:20123456786, clave-otro:20100000001",
+	}, service)
+	return router
+}
+
+func TestDocumentByNumber(t *testing.T) {
+	router := newLookupRouter(t)
+
+	for _, headers := range []map[string]string{
+		{"X-Admin-API-Key": "secreto"},
+		{"X-API-Key": "clave-emisor"},
+	} {
+		rec := doRequest(router, http.MethodGet, lookupPath, headers)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%v: código %d %s", headers, rec.Code, rec.Body.String())
+		}
+
+		var resp struct {
+			DocumentID string `json:"documentId"`
+			XMLHash    string `json:"xmlHash"`
+			Data       struct {
+				Status      string             `json:"status"`
+				Record      DocumentRecord     `json:"record"`
+				Artifacts   map[string]string  `json:"artifacts"`
+				Submissions []SubmissionRecord `json:"submissions"`
+				CDR         *DocumentCDR       `json:"cdr"`
+				History     []StatusChange     `json:"history"`
+			} `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		data := resp.Data
+		if resp.DocumentID != "20123456786-01-F003-123456" || resp.XMLHash == "" || data.Record.ZIPHash == "" {
+			t.Errorf("registro y hashes: %s", rec.Body.String())
+		}
+		if data.Status != CDRAccepted || len(data.Submissions) != 1 || data.Submissions[0].Environment != EnvironmentMock {
+			t.Errorf("estado y envíos: %+v", data)
+		}
+		if data.CDR == nil || data.CDR.ResponseCode != "0" || data.CDR.ReferenceID != "F003-123456" || len(data.CDR.Content) == 0 {
+			t.Errorf("se esperaba el CDR: %+v", data.CDR)
+		}
+		for _, kind := range []string{"xml", "zip", "record", "cdr"} {
+			if data.Artifacts[kind] == "" {
+				t.Errorf("falta el artefacto %s: %v", kind, data.Artifacts)
+			}
+		}
+		var statuses []string
+		for _, change := range data.History {
+			statuses = append(statuses, change.Status)
+		}
+		if len(statuses) != 3 || statuses[0] != DocumentGenerated || statuses[1] != SubmissionSent || statuses[2] != CDRAccepted {
+			t.Errorf("historial: %v", statuses)
+		}
+	}
+
+	// La serie se normaliza al armar la clave compuesta
+	rec := doRequest(router, http.MethodGet, "/api/v1/documents/by-number?ruc=20123456786&type=01&series=f003&number=123456", map[string]string{"X-API-Key": "clave-emisor"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("serie en minúsculas: código %d", rec.Code)
+	}
+}
+
+func TestDocumentByNumberNotFound(t *testing.T) {
+	router := newLookupRouter(t)
+	headers := map[string]string{"X-API-Key": "clave-emisor"}
+
+	rec := doRequest(router, http.MethodGet, "/api/v1/documents/by-number?ruc=20123456786&type=01&series=F003&number=999", headers)
+	var resp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusNotFound || resp.ErrorCode != "ERR_DOCUMENT_NOT_FOUND" || resp.DocumentID != "20123456786-01-F003-999" {
+		t.Errorf("se esperaba 404 estructurado: %d %s", rec.Code, rec.Body.String())
+	}
+
+	for path, code := range map[string]int{
+		"/api/v1/documents/by-number?ruc=20123456786&type=01&series=F003":                http.StatusBadRequest,
+		"/api/v1/documents/by-number?ruc=20123456786&type=01&series=F0003&number=123456": http.StatusBadRequest,
+	} {
+		if rec := doRequest(router, http.MethodGet, path, headers); rec.Code != code {
+			t.Errorf("%s: código %d, esperado %d", path, rec.Code, code)
+		}
+	}
+}
+
+func TestDocumentByNumberAuthorization(t *testing.T) {
+	router := newLookupRouter(t)
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		code    int
+	}{
+		{"sin API key", nil, http.StatusUnauthorized},
+		{"API key inválida", map[string]string{"X-API-Key": "otra"}, http.StatusUnauthorized},
+		{"API key de otro emisor", map[string]string{"X-API-Key": "clave-otro"}, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		rec := doRequest(router, http.MethodGet, lookupPath, tc.headers)
+		if rec.Code != tc.code {
+			t.Errorf("%s: código %d, esperado %d", tc.name, rec.Code, tc.code)
+		}
+	}
+
+	// La respuesta sin permisos no revela si el documento existe
+	rec := doRequest(router, http.MethodGet, "/api/v1/documents/by-number?ruc=20123456786&type=01&series=F003&number=999", map[string]string{"X-API-Key": "clave-otro"})
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("documento inexistente de otro emisor: código %d", rec.Code)
+	}
+}
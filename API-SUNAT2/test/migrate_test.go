@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/migrate"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+// migrationFixtures crea un directorio plano con dos XML firmados válidos (uno con su
+// ZIP) y archivos que la migración no debe poder interpretar
+func migrationFixtures(t *testing.T) string {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	dir := t.TempDir()
+
+	pipeline := newMemoryService().NewDefaultPipeline()
+	pipeline.SetWriter(nil)
+	boleta := sampleDocument()
+	boleta.Type, boleta.Series = "03", "B001"
+	for _, doc := range []*BusinessDocument{sampleDocument(), boleta} {
+		ctx, err := pipeline.Run(context.Background(), doc, certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(dir, ctx.DocumentID()+".xml"), ctx.XML, 0644)
+	}
+	os.WriteFile(filepath.Join(dir, "20123456786-01-F003-123456.zip"), []byte("zip"), 0644)
+
+	signed, _ := os.ReadFile(filepath.Join(dir, "20123456786-01-F003-123456.xml"))
+	unsigned, _ := NewUBLConverter(nil).ConvertToUBL(sampleDocument())
+	invalid := map[string][]byte{
+		"factura-final.xml":              signed,
+		"20123456786-01-F003-999999.xml": signed,
+		"20123456786-01-F003-000001.xml": []byte("<Invoice><cbc:ID>F003-000001"),
+		"20123456786-01-F003-123457.xml": []byte(strings.Replace(string(unsigned), "F003-123456", "F003-123457", 1)),
+	}
+	for name, data := range invalid {
+		os.WriteFile(filepath.Join(dir, name), data, 0644)
+	}
+	os.WriteFile(filepath.Join(dir, "notas.txt"), []byte("no es un XML"), 0644)
+	return dir
+}
+
+func TestMigrateStore(t *testing.T) {
+	dir := migrationFixtures(t)
+	store := storage.NewMemoryStore()
+	clock := &fixedClock{now: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)}
+
+	report, err := migrate.Run(migrate.Options{From: dir}, store, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 6 || report.Migrated != 2 || len(report.Failed) != 4 {
+		t.Fatalf("reporte inesperado: %+v", report)
+	}
+
+	data, err := store.Read(RecordName("20123456786-01-F003-123456"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record DocumentRecord
+	json.Unmarshal(data, &record)
+	if record.IssueDate != "2024-06-07" || record.PayableAmount != 118 || record.TaxAmount != 18 || record.Currency != "PEN" {
+		t.Errorf("metadatos inesperados: %+v", record)
+	}
+	if record.DigestValue == "" || len(record.XMLHash) != 64 || len(record.ZIPHash) != 64 || record.Source != RecordSourceMigration {
+		t.Errorf("digest, hashes u origen inesperados: %+v", record)
+	}
+	if _, err := store.Read("20123456786-03-B001-123456.xml"); err != nil {
+		t.Errorf("el XML debe copiarse al store: %v", err)
+	}
+
+	// Re-ejecutar no duplica ni reescribe
+	before, _ := store.List()
+	report, _ = migrate.Run(migrate.Options{From: dir}, store, clock)
+	after, _ := store.List()
+	if report.Migrated != 0 || report.Skipped != 2 || len(after) != len(before) {
+		t.Errorf("la migración debe ser idempotente: %+v, %d -> %d archivos", report, len(before), len(after))
+	}
+}
+
+func TestMigrateStoreDryRun(t *testing.T) {
+	dir := migrationFixtures(t)
+	store := storage.NewMemoryStore()
+
+	report, err := migrate.Run(migrate.Options{From: dir, DryRun: true}, store, &fixedClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Migrated != 2 || len(report.Failed) != 4 {
+		t.Errorf("reporte inesperado: %+v", report)
+	}
+	if names, _ := store.List(); len(names) != 0 {
+		t.Errorf("dry-run no debe escribir en el store: %v", names)
+	}
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+func TestFixMojibakeFixtures(t *testing.T) {
+	// Textos reales recibidos de sistemas que mandan Latin-1 declarando UTF-8
+	cases := map[string]string{
+		"PEÃ‘A HERMANOS S.A.C.":           "PEÑA HERMANOS S.A.C.",
+		"CompaÃ±Ã­a Minera":               "Compañía Minera",
+		"Servicio de instalaciÃ³n":        "Servicio de instalación",
+		"CAÃ‘ETE - SAN VICENTE":           "CAÑETE - SAN VICENTE",
+		"Ã\u0081REA DE ALMACÃ‰N":          "ÁREA DE ALMACÉN",
+		"â€œPromociÃ³nâ€\u009d de verano": "“Promoción” de verano",
+		"NiÃ±o ÃƒÂ±":                      "Niño ñ",
+	}
+	for input, expected := range cases {
+		fixed, changed := FixMojibake(input)
+		if !changed || fixed != expected {
+			t.Errorf("%q: se esperaba %q, obtenido %q (%v)", input, expected, fixed, changed)
+		}
+	}
+}
+
+func TestFixMojibakeLegitimateText(t *testing.T) {
+	// Textos válidos que contienen los mismos caracteres de una secuencia mal codificada
+	for _, text := range []string{
+		"SÃO PAULO",
+		"AÇÃO COMERCIAL",
+		"ÂNGULO RECTO",
+		"Nº 123 - 25°C",
+		"¡Oferta! ¿Válido?",
+		"PERÚ» ESPAÑA«",
+		"MÜLLER & CÍA",
+		"Ñª edición",
+		"Jirón Ayacucho",
+	} {
+		if fixed, changed := FixMojibake(text); changed || fixed != text {
+			t.Errorf("%q no debe corregirse, obtenido %q", text, fixed)
+		}
+	}
+}
+
+func TestMojibakeModes(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	corrupt := func() *BusinessDocument {
+		doc := sampleDocument()
+		doc.Customer.Name = "PEÃ‘A HERMANOS S.A.C."
+		doc.Items[0].Description = "Servicio de instalaciÃ³n"
+		return doc
+	}
+
+	// Sin corrección el texto pasa tal cual
+	service := newMemoryService()
+	resp, err := service.ProcessDocument(context.Background(), corrupt(), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" || hasRule(resp.Warnings, "mojibake_fixed") {
+		t.Fatalf("modo off: %v %+v", err, resp)
+	}
+
+	// fix corrige antes de validar y reporta cada campo
+	store := storage.NewMemoryStore()
+	service = newMemoryService()
+	service.SetStore(store)
+	service.SetMojibakeMode(MojibakeFix)
+	resp, err = service.ProcessDocument(context.Background(), corrupt(), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("modo fix: %v %+v", err, resp)
+	}
+	fields := map[string]bool{}
+	for _, w := range resp.Warnings {
+		if w.Rule == "mojibake_fixed" {
+			fields[w.Field] = true
+		}
+	}
+	if len(fields) != 2 || !fields["customer.name"] || !fields["items[0].description"] {
+		t.Errorf("campos corregidos: %v", fields)
+	}
+	xmlData, err := store.Read("20123456786-01-F003-123456.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(xmlData), "PEÑA HERMANOS") || strings.Contains(string(xmlData), "Ã") {
+		t.Error("el XML debe llevar el texto corregido")
+	}
+
+	// strict rechaza indicando el campo y el byte ofensivo
+	service = newMemoryService()
+	service.SetMojibakeMode(MojibakeStrict)
+	resp, err = service.ProcessDocument(context.Background(), corrupt(), certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ErrorCode != ErrInvalidEncodingCode || len(resp.ValidationErrors) != 2 {
+		t.Fatalf("se esperaba %s: %+v", ErrInvalidEncodingCode, resp)
+	}
+	first := resp.ValidationErrors[0]
+	if first.Field != "customer.name" || first.Received != "byte 0xC3 at position 2" {
+		t.Errorf("campo y byte ofensivo: %+v", first)
+	}
+
+	// Un texto legítimo no se rechaza en modo estricto
+	doc := sampleDocument()
+	doc.Customer.Name = "SÃO PAULO COMÉRCIO LTDA"
+	if resp, _ := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM); resp.Status != "SUCCESS" {
+		t.Errorf("texto legítimo rechazado: %+v", resp)
+	}
+}
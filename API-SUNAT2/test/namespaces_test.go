@@ -0,0 +1,99 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+	. "API-SUNAT2/util"
+)
+
+// invoiceInPrefixStyle arma la misma factura con los prefijos indicados para la raíz,
+// cac y cbc. Un prefijo vacío usa namespace por defecto en cada elemento.
+func invoiceInPrefixStyle(root, cac, cbc string) string {
+	name := func(prefix, local, namespace string) (string, string) {
+		if prefix == "" {
+			return local + ` xmlns="` + namespace + `"`, local
+		}
+		return prefix + ":" + local, prefix + ":" + local
+	}
+	element := func(prefix, local, namespace, content string) string {
+		open, close := name(prefix, local, namespace)
+		return "<" + open + ">" + content + "</" + close + ">"
+	}
+	cacElement := func(local, content string) string { return element(cac, local, NamespaceCAC, content) }
+	cbcElement := func(local, content string) string { return element(cbc, local, NamespaceCBC, content) }
+
+	declarations := ` xmlns:ext="` + NamespaceExt + `" xmlns:ds="` + NamespaceDS + `"`
+	for _, prefix := range []struct{ prefix, namespace string }{{root, NamespaceInvoice}, {cac, NamespaceCAC}, {cbc, NamespaceCBC}} {
+		if prefix.prefix != "" {
+			declarations += ` xmlns:` + prefix.prefix + `="` + prefix.namespace + `"`
+		}
+	}
+	rootOpen, rootClose := name(root, "Invoice", NamespaceInvoice)
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<` + rootOpen + declarations + `>
+  ` + cbcElement("ID", "F001-25") + `
+  ` + cbcElement("IssueDate", "2024-06-07") + `
+  ` + cbcElement("DocumentCurrencyCode", "PEN") + `
+  ` + cacElement("TaxTotal", cbcElement("TaxAmount", "18.00")) + `
+  ` + cacElement("LegalMonetaryTotal", cbcElement("PayableAmount", "118.00")) + `
+</` + rootClose + `>`
+}
+
+func TestReadDocumentsWithAnyNamespacePrefix(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	signer := NewDigitalSignatureService(nil)
+
+	styles := map[string]string{
+		"prefijos cac/cbc":       invoiceInPrefixStyle("", "cac", "cbc"),
+		"namespaces por defecto": invoiceInPrefixStyle("", "", ""),
+		"prefijos inv/n1/n2":     invoiceInPrefixStyle("inv", "n2", "n1"),
+	}
+	for style, invoice := range styles {
+		signed, err := signer.SignXML([]byte(invoice), certPEM, keyPEM)
+		if err != nil {
+			t.Errorf("%s: firma: %v", style, err)
+			continue
+		}
+
+		record, err := ExtractDocumentRecord("20123456786-01-F001-25.xml", signed)
+		if err != nil {
+			t.Errorf("%s: %v", style, err)
+			continue
+		}
+		if record.IssueDate != "2024-06-07" || record.Currency != "PEN" || record.PayableAmount != 118 || record.DigestValue == "" {
+			t.Errorf("%s: registro %+v", style, record)
+		}
+
+		results, err := signer.VerifySignatures(signed)
+		if err != nil || len(results) != 1 || !results[0].Valid {
+			t.Errorf("%s: verificación %v %+v", style, err, results)
+		}
+		tampered := strings.Replace(string(signed), "118.00", "218.00", 1)
+		if results, _ := signer.VerifySignatures([]byte(tampered)); len(results) != 1 || results[0].Valid {
+			t.Errorf("%s: la modificación debe invalidar la firma: %+v", style, results)
+		}
+	}
+}
+
+func TestParseCDRWithOtherPrefixes(t *testing.T) {
+	cdr, _ := ZipXMLBytes("R-cdr.xml", []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ApplicationResponse xmlns="urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2" xmlns:n1="urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2" xmlns:n2="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">
+<n2:Note>4252 - El dato ingresado como atributo no cumple con el formato establecido</n2:Note>
+<n1:DocumentResponse><n1:Response><n2:ReferenceID>F001-25</n2:ReferenceID><n2:ResponseCode>0</n2:ResponseCode><n2:Description>La Factura numero F001-25, ha sido aceptada</n2:Description></n1:Response></n1:DocumentResponse>
+</ApplicationResponse>`))
+	result, err := ParseCDR(cdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ReferenceID != "F001-25" || result.ResponseCode != "0" || result.Status != CDRObserved || len(result.Notes) != 1 {
+		t.Errorf("CDR: %+v", result)
+	}
+
+	// Otro elemento raíz con el mismo nombre local no es un CDR
+	other, _ := ZipXMLBytes("R-cdr.xml", []byte(`<ApplicationResponse xmlns="urn:otro"><ResponseCode>0</ResponseCode></ApplicationResponse>`))
+	if _, err := ParseCDR(other); err == nil {
+		t.Error("se esperaba error por el namespace del elemento raíz")
+	}
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+)
+
+// negativeLineDocument retorna la factura de ejemplo con una "línea de descuento" de
+// 20.00 gravada con el id indicado; los totales y el IGV del documento ya vienen netos
+func negativeLineDocument(id string) *BusinessDocument {
+	doc := sampleDocument()
+	doc.Items = append(doc.Items, DocumentItem{
+		ID:          id,
+		Description: "Descuento",
+		Quantity:    1,
+		UnitCode:    "NIU",
+		UnitPrice:   -20,
+		LineTotal:   -20,
+		Taxes:       []Tax{{TaxType: "1000", TaxAmount: -3.6, TaxRate: 18, TaxBase: -20}},
+	})
+	doc.Taxes = []TaxTotal{{TaxType: "1000", TaxAmount: 14.4, TaxRate: 18, TaxBase: 80}}
+	doc.Totals = DocumentTotals{SubTotal: 80, TotalTaxes: 14.4, TotalAmount: 94.4, PayableAmount: 94.4}
+	return doc
+}
+
+func TestNegativeLinesRejected(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	resp, _ := newMemoryService().ProcessDocument(context.Background(), negativeLineDocument("DSCTO"), certPEM, keyPEM)
+	if resp.Status == "SUCCESS" || len(resp.ValidationErrors) != 1 {
+		t.Fatalf("la línea negativa debe rechazarse: %+v", resp)
+	}
+	err := resp.ValidationErrors[0]
+	if err.Rule != "negative_line_validation" || err.Field != "items[1]" || !strings.Contains(err.Suggestion, "globalDiscount") {
+		t.Errorf("el error debe sugerir usar descuentos: %+v", err)
+	}
+}
+
+func TestNegativeLineConvertedToGlobalDiscount(t *testing.T) {
+	service := newMemoryService()
+	doc := negativeLineDocument("DSCTO")
+	convert := true
+	doc.ConvertNegativeLines = &convert
+	documentID := processForSending(t, service, doc)
+
+	xmlData, err := service.GetStore().Read(documentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(xmlData)
+	if n := strings.Count(xml, "<cac:InvoiceLine>"); n != 1 {
+		t.Errorf("la línea negativa no debe emitirse: %d líneas", n)
+	}
+	for _, fragment := range []string{
+		"<cbc:ChargeIndicator>false</cbc:ChargeIndicator>",
+		`listURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo53">02</cbc:AllowanceChargeReasonCode>`,
+		"<cbc:MultiplierFactorNumeric>0.2</cbc:MultiplierFactorNumeric>",
+		`<cbc:Amount currencyID="PEN">20</cbc:Amount>`,
+		`<cbc:BaseAmount currencyID="PEN">100</cbc:BaseAmount>`,
+		`<cbc:PayableAmount currencyID="PEN">94.4</cbc:PayableAmount>`,
+	} {
+		if !strings.Contains(xml, fragment) {
+			t.Errorf("falta %s en:\n%s", fragment, xml)
+		}
+	}
+
+	record := readDocumentRecord(t, service.GetStore(), documentID)
+	want := []ConvertedNegativeLine{{Field: "items[1]", Description: "Descuento", Amount: 20, Target: NegativeLineToGlobal}}
+	if !reflect.DeepEqual(record.NegativeLines, want) {
+		t.Errorf("el registro debe conservar la conversión: %+v", record.NegativeLines)
+	}
+
+	// El asiento sale del XML con la base gravada neta del descuento
+	entry, err := service.DocumentAccounting(documentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Breakdown.Taxable != 80 || !entry.Balanced || !entry.Verified {
+		t.Errorf("el descuento global debe rebajar la base gravada: %+v", entry)
+	}
+}
+
+func TestNegativeLineConvertedToLineDiscount(t *testing.T) {
+	service := newMemoryService()
+	service.SetConvertNegativeLines(true)
+	// La línea de descuento repite el id del producto que rebaja
+	documentID := processForSending(t, service, negativeLineDocument("1"))
+
+	xmlData, err := service.GetStore().Read(documentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(xmlData), "<cac:InvoiceLine>")
+	if len(lines) != 2 {
+		t.Fatalf("se esperaba una línea, se obtuvieron %d", len(lines)-1)
+	}
+	for _, fragment := range []string{
+		`<cbc:LineExtensionAmount currencyID="PEN">80</cbc:LineExtensionAmount>`,
+		`listURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo53">00</cbc:AllowanceChargeReasonCode>`,
+		`<cbc:Amount currencyID="PEN">20</cbc:Amount>`,
+		`<cbc:BaseAmount currencyID="PEN">100</cbc:BaseAmount>`,
+		`<cbc:TaxableAmount currencyID="PEN">80</cbc:TaxableAmount>`,
+		`<cbc:TaxAmount currencyID="PEN">14.4</cbc:TaxAmount>`,
+	} {
+		if !strings.Contains(lines[1], fragment) {
+			t.Errorf("falta %s en la línea:\n%s", fragment, lines[1])
+		}
+	}
+	if strings.Contains(lines[0], "AllowanceCharge") {
+		t.Error("un descuento de línea no debe emitirse como global")
+	}
+	record := readDocumentRecord(t, service.GetStore(), documentID)
+	if len(record.NegativeLines) != 1 || record.NegativeLines[0].Target != NegativeLineToLine || record.NegativeLines[0].ItemID != "1" {
+		t.Errorf("el registro debe conservar la conversión: %+v", record.NegativeLines)
+	}
+
+	// El request prevalece sobre la configuración
+	doc := negativeLineDocument("DSCTO")
+	doc.Number = "123457"
+	convert := false
+	doc.ConvertNegativeLines = &convert
+	certPEM, keyPEM := loadTestCredentials(t)
+	if resp, _ := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM); resp.Status == "SUCCESS" {
+		t.Error("con convertNegativeLines: false la línea negativa debe rechazarse")
+	}
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/migrate"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+func TestCanonicalNumber(t *testing.T) {
+	cases := map[string]string{
+		"123":                        "123",
+		"00000123":                   "123",
+		"000000000123":               "123",
+		"0000":                       "0",
+		"A12":                        "A12",
+		"20123456786-01-F003-000123": "20123456786-01-F003-000123",
+	}
+	for input, expected := range cases {
+		if got := CanonicalNumber(input); got != expected {
+			t.Errorf("CanonicalNumber(%q) = %q, se esperaba %q", input, got, expected)
+		}
+	}
+	if got := CanonicalDocumentID("20123456786-01-F003-00000123"); got != "20123456786-01-F003-123" {
+		t.Errorf("CanonicalDocumentID: %q", got)
+	}
+	if got := CanonicalDocumentID("20123456786-RC-20240607-1"); got != "20123456786-RC-20240607-1" {
+		t.Errorf("un resumen no debe modificarse: %q", got)
+	}
+}
+
+func TestLeadingZerosSameDocument(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	store := storage.NewMemoryStore()
+	service := newMemoryService()
+	service.SetStore(store)
+
+	// El mismo comprobante con y sin ceros a la izquierda converge en un solo documentId
+	for _, number := range []string{"00123456", "123456", "000000123456"} {
+		doc := sampleDocument()
+		doc.Number = number
+		resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+		if err != nil || resp.Status != "SUCCESS" {
+			t.Fatalf("%s: %v %+v", number, err, resp)
+		}
+		if resp.DocumentID != "20123456786-01-F003-123456" {
+			t.Errorf("%s: documentId %s", number, resp.DocumentID)
+		}
+		if normalized := hasRule(resp.Warnings, "number_normalized"); normalized != (number != "123456") {
+			t.Errorf("%s: warning number_normalized = %v", number, normalized)
+		}
+	}
+
+	names, _ := store.List()
+	var records []string
+	for _, name := range names {
+		if strings.HasSuffix(name, RecordSuffix) {
+			records = append(records, name)
+		}
+	}
+	if len(records) != 1 || records[0] != RecordName("20123456786-01-F003-123456") {
+		t.Errorf("se esperaba un solo registro: %v", records)
+	}
+	xmlData, _ := store.Read("20123456786-01-F003-123456.xml")
+	if !strings.Contains(string(xmlData), "<cbc:ID>F003-123456</cbc:ID>") {
+		t.Error("el cbc:ID debe llevar el correlativo canónico")
+	}
+}
+
+func TestNumberValidation(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+
+	for _, number := range []string{"123456789", "0", "00000000", "12A"} {
+		doc := sampleDocument()
+		doc.Number = number
+		resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status == "SUCCESS" || !hasRule(resp.ValidationErrors, "number_validation") {
+			t.Errorf("%s: se esperaba number_validation: %+v", number, resp)
+		}
+	}
+
+	// Los ceros a la izquierda no cuentan para el máximo de 8 dígitos
+	doc := sampleDocument()
+	doc.Number = "0099999999"
+	if resp, _ := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM); resp.Status != "SUCCESS" {
+		t.Errorf("correlativo de 8 dígitos con ceros: %+v", resp)
+	}
+}
+
+func TestDocumentByNumberLeadingZeros(t *testing.T) {
+	router := newLookupRouter(t)
+
+	for _, number := range []string{"123456", "00123456"} {
+		rec := doRequest(router, http.MethodGet, "/api/v1/documents/by-number?ruc=20123456786&type=01&series=F003&number="+number, map[string]string{"X-API-Key": "clave-emisor"})
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: código %d %s", number, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/xml/20123456786-01-F003-00123456.xml", nil); rec.Code != http.StatusOK {
+		t.Errorf("descarga con ceros a la izquierda: código %d", rec.Code)
+	}
+}
+
+func TestMigrateNormalizesLeadingZeros(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	dir := t.TempDir()
+
+	// Un XML histórico nombrado con ceros a la izquierda
+	pipeline := newMemoryService().NewDefaultPipeline()
+	pipeline.SetWriter(nil)
+	doc := sampleDocument()
+	doc.Number = "123"
+	ctx, err := pipeline.Run(context.Background(), doc, certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "20123456786-01-F003-00000123.xml"), ctx.XML, 0644)
+	os.WriteFile(filepath.Join(dir, "20123456786-01-F003-00000123.zip"), []byte("zip"), 0644)
+
+	store := storage.NewMemoryStore()
+	store.Save(RecordName("20123456786-01-F003-00000123"), []byte(`{}`))
+	clock := &fixedClock{now: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)}
+	report, err := migrate.Run(migrate.Options{From: dir}, store, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Migrated != 1 || report.Normalized != 1 || len(report.Failed) != 0 {
+		t.Fatalf("reporte inesperado: %+v", report)
+	}
+
+	data, err := store.Read(RecordName("20123456786-01-F003-123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record DocumentRecord
+	json.Unmarshal(data, &record)
+	if record.DocumentID != "20123456786-01-F003-123" || record.Number != "123" || record.XMLFile != "20123456786-01-F003-123.xml" {
+		t.Errorf("registro sin normalizar: %+v", record)
+	}
+	for _, name := range []string{"20123456786-01-F003-123.xml", "20123456786-01-F003-123.zip"} {
+		if _, err := store.Read(name); err != nil {
+			t.Errorf("falta %s en el store", name)
+		}
+	}
+	if _, err := store.Read(RecordName("20123456786-01-F003-00000123")); err == nil {
+		t.Error("el registro con ceros a la izquierda debe eliminarse")
+	}
+
+	// Re-ejecutar no duplica
+	report, _ = migrate.Run(migrate.Options{From: dir}, store, clock)
+	if report.Migrated != 0 || report.Skipped != 1 {
+		t.Errorf("la migración debe ser idempotente: %+v", report)
+	}
+}
@@ -0,0 +1,110 @@
+package test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+var notePattern = regexp.MustCompile(`<cbc:Note[^>]*>([^<]*)</cbc:Note>`)
+
+// emittedNotes retorna el contenido de los cbc:Note del XML en orden de emisión
+func emittedNotes(xmlData []byte) []string {
+	var notes []string
+	for _, match := range notePattern.FindAllStringSubmatch(string(xmlData), -1) {
+		notes = append(notes, match[1])
+	}
+	return notes
+}
+
+func TestObservationsAfterLegends(t *testing.T) {
+	observations := []string{"Cuenta BCP: 191-12345678-0-01", "Gracias por su compra"}
+
+	boleta := perceptionBoleta("51", 2, 2.36)
+	boleta.Observations = observations
+	creditNote := sampleCreditNote("01", 1)
+	creditNote.Observations = observations
+
+	cases := []struct {
+		name string
+		doc  *BusinessDocument
+		want []string
+	}{
+		{"boleta con percepción", boleta, []string{
+			"TRANSFERENCIA GRATUITA DE UN BIEN Y/O SERVICIO PRESTADO GRATUITAMENTE",
+			"CIENTO DIECIOCHO CON 00/100 SOLES",
+			"COMPROBANTE DE PERCEPCIÓN",
+			observations[0],
+			observations[1],
+		}},
+		{"nota de crédito", creditNote, append([]string{"CINCUENTA Y NUEVE CON 00/100 SOLES"}, observations...)},
+	}
+
+	for _, tc := range cases {
+		xmlData, err := NewUBLConverter(nil).ConvertToUBL(tc.doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes := emittedNotes(xmlData)
+		if strings.Join(notes, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%s: notas = %q, esperado %q", tc.name, notes, tc.want)
+		}
+		if strings.Contains(string(xmlData), `languageLocaleID="`+observations[0]) {
+			t.Errorf("%s: las observaciones no llevan código de leyenda", tc.name)
+		}
+	}
+}
+
+func TestObservationsEscaped(t *testing.T) {
+	doc := sampleDocument()
+	doc.Observations = []string{`Pago a "R&G" <sin detracción>`}
+
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<cbc:Note>Pago a &#34;R&amp;G&#34; &lt;sin detracción&gt;</cbc:Note>"
+	if !strings.Contains(string(xmlData), want) {
+		t.Errorf("falta %s en el XML", want)
+	}
+
+	// El documento firmado con la observación escapada sigue siendo válido
+	certPEM, keyPEM := loadTestCredentials(t)
+	resp, err := newMemoryService().ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("se esperaba éxito: %v %+v", err, resp)
+	}
+}
+
+func TestObservationLimits(t *testing.T) {
+	validator := NewValidationService(nil)
+	validator.SetObservationLimits(2, 20)
+
+	cases := []struct {
+		name         string
+		observations []string
+		rule         string
+	}{
+		{"dentro de los límites", []string{"Gracias por comprar", "Vuelva pronto"}, ""},
+		{"longitud exacta", []string{strings.Repeat("ñ", 20)}, ""},
+		{"demasiadas", []string{"uno", "dos", "tres"}, "observations_count_validation"},
+		{"demasiado larga", []string{strings.Repeat("a", 21)}, "observation_length_validation"},
+		{"vacía", []string{"  "}, "observation_length_validation"},
+	}
+
+	for _, tc := range cases {
+		doc := sampleDocument()
+		doc.Observations = tc.observations
+		errs := validator.ValidateBusinessDocument(doc)
+		if tc.rule == "" && len(errs) > 0 {
+			t.Errorf("%s: no se esperaban errores, obtenido %+v", tc.name, errs)
+		}
+		if tc.rule != "" && !hasRule(errs, tc.rule) {
+			t.Errorf("%s: se esperaba la regla %s, obtenido %+v", tc.name, tc.rule, errs)
+		}
+	}
+}
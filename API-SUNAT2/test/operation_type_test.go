@@ -0,0 +1,89 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+// exportDocument retorna la factura de ejemplo como exportación de bienes, sin IGV
+func exportDocument() *BusinessDocument {
+	doc := sampleDocument()
+	doc.OperationType = "0200"
+	doc.Items[0].Taxes = []Tax{{TaxType: "9995", TaxBase: 100}}
+	doc.Taxes = []TaxTotal{{TaxType: "9995", TaxBase: 100}}
+	doc.Totals = DocumentTotals{SubTotal: 100, TotalAmount: 100, PayableAmount: 100}
+	return doc
+}
+
+func TestOperationTypeProfiles(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	itinerant := sampleDocument()
+	itinerant.OperationType = "0102"
+	cases := []struct {
+		name    string
+		doc     *BusinessDocument
+		profile string
+	}{
+		{"venta interna por defecto", sampleDocument(), "0101"},
+		{"venta itinerante", itinerant, "0102"},
+		{"exportación", exportDocument(), "0200"},
+	}
+	for _, c := range cases {
+		store := storage.NewMemoryStore()
+		service := newMemoryService()
+		service.SetStore(store)
+		resp, err := service.ProcessDocument(context.Background(), c.doc, certPEM, keyPEM)
+		if err != nil || resp.Status != "SUCCESS" {
+			t.Fatalf("%s: %v %+v", c.name, err, resp)
+		}
+		xmlData, _ := store.Read(resp.DocumentID + ".xml")
+		xmlText := string(xmlData)
+		profile := `<cbc:ProfileID schemeAgencyName="PE:SUNAT" schemeName="Tipo de Operacion" schemeURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo51">` + c.profile + `</cbc:ProfileID>`
+		if !strings.Contains(xmlText, profile) {
+			t.Errorf("%s: se esperaba %s", c.name, profile)
+		}
+		if !strings.Contains(xmlText, `listID="`+c.profile+`"`) {
+			t.Errorf("%s: el InvoiceTypeCode debe llevar listID %s", c.name, c.profile)
+		}
+	}
+}
+
+func TestOperationTypeValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	// Una exportación no puede gravarse con IGV
+	doc := sampleDocument()
+	doc.OperationType = "0200"
+	errs := validator.ValidateBusinessDocument(doc)
+	if !hasRule(errs, "operation_type_consistency") {
+		t.Errorf("exportación con IGV: %+v", errs)
+	}
+
+	doc = sampleDocument()
+	doc.OperationType = "9999"
+	if errs := validator.ValidateBusinessDocument(doc); !hasRule(errs, "operation_type_validation") {
+		t.Errorf("tipo de operación desconocido: %+v", errs)
+	}
+
+	// Percepción y detracción exigen su tipo de operación y sus datos
+	doc = sampleDocument()
+	doc.OperationType = PerceptionOperationType
+	if errs := validator.ValidateBusinessDocument(doc); !hasRule(errs, "operation_type_consistency") {
+		t.Errorf("percepción sin datos: %+v", errs)
+	}
+	doc = sampleDocument()
+	doc.OperationType = DetractionOperationType
+	if errs := validator.ValidateBusinessDocument(doc); !hasRule(errs, "operation_type_consistency") {
+		t.Errorf("detracción sin cuenta: %+v", errs)
+	}
+
+	if errs := validator.ValidateBusinessDocument(exportDocument()); len(errs) != 0 {
+		t.Errorf("exportación válida: %+v", errs)
+	}
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"github.com/gin-gonic/gin"
+)
+
+// mockPadron devuelve un estado fijo o un error y cuenta las consultas
+type mockPadron struct {
+	status *TaxpayerStatus
+	err    error
+	calls  int
+}
+
+func (m *mockPadron) Lookup(ruc string) (*TaxpayerStatus, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	status := *m.status
+	status.RUC = ruc
+	return &status, nil
+}
+
+// fixedClock es un reloj controlable para pruebas
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestIssuerStatusCheck(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	cases := []struct {
+		name      string
+		padron    *mockPadron
+		mode      string
+		errorCode string
+		warning   string
+	}{
+		{"activo habido", &mockPadron{status: &TaxpayerStatus{State: "ACTIVO", Condition: "HABIDO"}}, IssuerStatusError, "", ""},
+		{"baja en modo error", &mockPadron{status: &TaxpayerStatus{State: "BAJA DE OFICIO", Condition: "HABIDO"}}, IssuerStatusError, "ERR_ISSUER_STATUS", ""},
+		{"no habido en modo error", &mockPadron{status: &TaxpayerStatus{State: "ACTIVO", Condition: "NO HABIDO"}}, IssuerStatusError, "ERR_ISSUER_STATUS", ""},
+		{"no habido en modo warning", &mockPadron{status: &TaxpayerStatus{State: "ACTIVO", Condition: "NO HABIDO"}}, IssuerStatusWarning, "", "issuer_status"},
+		{"padrón caído", &mockPadron{err: errors.New("timeout")}, IssuerStatusError, "", "issuer_status_unavailable"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := newMemoryService()
+			service.SetPadronClient(tc.padron)
+			service.SetIssuerStatusCheck(tc.mode)
+
+			response, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+			if err != nil {
+				t.Fatalf("error inesperado: %v", err)
+			}
+			if tc.errorCode != "" {
+				if response.ErrorCode != tc.errorCode {
+					t.Fatalf("se esperaba %s, se obtuvo %+v", tc.errorCode, response)
+				}
+				return
+			}
+			if response.Status != "SUCCESS" {
+				t.Fatalf("se esperaba emisión exitosa, se obtuvo %+v", response)
+			}
+			if tc.warning != "" && !hasRule(response.Warnings, tc.warning) {
+				t.Fatalf("se esperaba warning %s, se obtuvo %+v", tc.warning, response.Warnings)
+			}
+			if tc.warning == "" && len(response.Warnings) > 0 {
+				t.Fatalf("no se esperaban warnings: %+v", response.Warnings)
+			}
+		})
+	}
+}
+
+func TestCachedPadronClient(t *testing.T) {
+	inner := &mockPadron{status: &TaxpayerStatus{State: "ACTIVO", Condition: "HABIDO"}}
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)}
+	client := NewCachedPadronClient(inner, time.Hour, clock)
+
+	client.Lookup("20123456786")
+	client.Lookup("20123456786")
+	if inner.calls != 1 {
+		t.Fatalf("se esperaba una consulta dentro del TTL, se obtuvo %d", inner.calls)
+	}
+	clock.now = clock.now.Add(61 * time.Minute)
+	client.Lookup("20123456786")
+	if inner.calls != 2 {
+		t.Fatalf("se esperaba nueva consulta tras expirar el cache, se obtuvo %d", inner.calls)
+	}
+}
+
+func TestIssuerStatusEndpoint(t *testing.T) {
+	service := newMemoryService()
+	service.SetPadronClient(&mockPadron{status: &TaxpayerStatus{State: "ACTIVO", Condition: "NO HABIDO"}})
+
+	router := gin.New()
+	router.GET("/api/v1/issuers/:ruc/status", api.NewAdminController(service).IssuerStatus)
+
+	rec := doRequest(router, http.MethodGet, "/api/v1/issuers/20123456786/status", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("se esperaba 200, se obtuvo %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"operational":false`) || !strings.Contains(body, `"condition":"NO HABIDO"`) {
+		t.Fatalf("respuesta inesperada: %s", body)
+	}
+}
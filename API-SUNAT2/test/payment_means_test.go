@@ -0,0 +1,164 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// paymentMeansInvoice retorna la factura de ejemplo con la cuenta de detracciones del
+// Banco de la Nación y dos cuentas comerciales
+func paymentMeansInvoice() *BusinessDocument {
+	doc := sampleDocument()
+	doc.PaymentMeans = []PaymentMean{
+		{Code: "001", AccountID: "00-000-123456", FinancialInstitution: "Banco de la Nación", Detraction: true},
+		{Code: "003", AccountID: "002-193-001234567890-13", FinancialInstitution: "BCP"},
+		{Code: "001", AccountID: "0011-0175-0100012345", FinancialInstitution: "BBVA"},
+	}
+	return doc
+}
+
+func TestPaymentMeansValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	cases := []struct {
+		name   string
+		modify func(doc *BusinessDocument)
+		rule   string
+	}{
+		{"detracción y dos cuentas comerciales", func(doc *BusinessDocument) {}, ""},
+		{"código fuera del catálogo 59", func(doc *BusinessDocument) { doc.PaymentMeans[2].Code = "050" }, "payment_means_validation"},
+		{"transferencia sin CCI", func(doc *BusinessDocument) { doc.PaymentMeans[1].AccountID = "193-1234567-0-12" }, "cci_validation"},
+		{"CCI con letras", func(doc *BusinessDocument) { doc.PaymentMeans[1].AccountID = "002-193-00123456789A-12" }, "cci_validation"},
+		{"cuenta vacía", func(doc *BusinessDocument) { doc.PaymentMeans[2].AccountID = " " }, "payment_means_validation"},
+		{"dos cuentas de detracción", func(doc *BusinessDocument) { doc.PaymentMeans[2].Detraction = true }, "payment_means_validation"},
+		{"en una nota de crédito", func(doc *BusinessDocument) {
+			doc.Type, doc.Series = "07", "FC01"
+			doc.Reference = &DocumentReference{DocumentType: "01", DocumentID: "F003-1", Reason: "Anulación"}
+		}, "payment_means_validation"},
+	}
+	for _, tc := range cases {
+		doc := paymentMeansInvoice()
+		tc.modify(doc)
+		errs := validator.ValidateBusinessDocument(doc)
+		if tc.rule == "" && len(errs) > 0 {
+			t.Errorf("%s: no se esperaban errores, obtenido %+v", tc.name, errs)
+		}
+		if tc.rule != "" && !hasRule(errs, tc.rule) {
+			t.Errorf("%s: se esperaba la regla %s, obtenido %+v", tc.name, tc.rule, errs)
+		}
+	}
+
+	if !IsCCI("00219300123456789012") || IsCCI("0021930012345678901") {
+		t.Error("el CCI debe tener exactamente 20 dígitos")
+	}
+}
+
+func TestPaymentMeansConversion(t *testing.T) {
+	converter := NewUBLConverter(nil)
+	xmlData, err := converter.ConvertToUBL(paymentMeansInvoice())
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmlStr := string(xmlData)
+
+	if strings.Count(xmlStr, "<cac:PaymentMeans>") != 3 {
+		t.Fatalf("se esperaban tres cac:PaymentMeans:\n%s", xmlStr)
+	}
+	for _, expected := range []string{
+		`<cbc:ID>Detraccion</cbc:ID>`,
+		`listURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo59">001</cbc:PaymentMeansCode>`,
+		`<cac:PayeeFinancialAccount>`,
+		`<cbc:ID>00-000-123456</cbc:ID>`,
+		`<cbc:ID>002-193-001234567890-13</cbc:ID>`,
+		`<cbc:Name>BBVA</cbc:Name>`,
+	} {
+		if !strings.Contains(xmlStr, expected) {
+			t.Errorf("no se encontró %s", expected)
+		}
+	}
+
+	// El esquema UBL exige PaymentMeans después del cliente y antes de PaymentTerms,
+	// en el orden de las cuentas del documento
+	customer := strings.Index(xmlStr, "</cac:AccountingCustomerParty>")
+	means := strings.Index(xmlStr, "<cac:PaymentMeans>")
+	terms := strings.Index(xmlStr, "<cac:PaymentTerms>")
+	if customer < 0 || means < customer || terms < means || strings.LastIndex(xmlStr, "</cac:PaymentMeans>") > terms {
+		t.Error("cac:PaymentMeans debe ir entre el cliente y cac:PaymentTerms")
+	}
+	if strings.Index(xmlStr, "Detraccion") > strings.Index(xmlStr, "BCP") || strings.Index(xmlStr, "BCP") > strings.Index(xmlStr, "BBVA") {
+		t.Error("las cuentas deben emitirse en el orden del documento")
+	}
+
+	// Sin cuentas no se emite el elemento
+	xmlData, _ = converter.ConvertToUBL(sampleDocument())
+	if strings.Contains(string(xmlData), "PaymentMeans>") {
+		t.Error("no se esperaba cac:PaymentMeans sin cuentas")
+	}
+}
+
+func TestCCICheckDigits(t *testing.T) {
+	// CCI anonimizados con la estructura y los dígitos de control de cada banco
+	for _, cci := range []string{
+		"002-191-193456789012-53", // BCP
+		"011-814-000201234567-10", // BBVA
+		"003 200 300012345678 39", // Interbank
+		"009-170-000098765432-24", // Scotiabank
+		"01800000012345678907",    // Banco de la Nación
+	} {
+		if err := CheckCCI(cci); err != nil {
+			t.Errorf("%s: CCI válido rechazado: %v", cci, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		cci  string
+		part string
+	}{
+		{"002-191-193456789012-5", "length"},
+		{"002-191-193456789012-533", "length"},
+		{"002-191-19345678901A-53", "format"},
+		{"002-191-193456789012-63", "check digit for bank 002 and branch 191 (digit 19)"},
+		{"002-191-193456789013-53", "check digit for account 193456789013 (digit 20)"},
+	} {
+		err := CheckCCI(tc.cci)
+		if err == nil || err.Part != tc.part {
+			t.Errorf("%s: se esperaba el error en %q, obtenido %v", tc.cci, tc.part, err)
+		}
+	}
+}
+
+func TestDetractionAccountValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	for _, tc := range []struct {
+		account string
+		rule    string
+	}{
+		{"00-741-123456", ""},
+		{"00 741 123456", ""},
+		{"018-000-000123456789-07", ""},
+		{"00-741-12345", "detraction_account_validation"},
+		{"10-741-123456", "detraction_account_validation"},
+		{"00-741-12345X", "detraction_account_validation"},
+		{"002-191-193456789012-53", "detraction_account_validation"},
+		{"018-000-000123456789-08", "cci_validation"},
+	} {
+		doc := paymentMeansInvoice()
+		doc.PaymentMeans[0].AccountID = tc.account
+		errs := validator.ValidateBusinessDocument(doc)
+		if tc.rule == "" && len(errs) > 0 {
+			t.Errorf("%s: no se esperaban errores, obtenido %+v", tc.account, errs)
+		}
+		if tc.rule != "" && !hasRule(errs, tc.rule) {
+			t.Errorf("%s: se esperaba la regla %s, obtenido %+v", tc.account, tc.rule, errs)
+		}
+		for _, err := range errs {
+			if err.Field != "paymentMeans[0].accountId" || err.Expected == "" || err.Suggestion == "" {
+				t.Errorf("%s: el error debe indicar el formato esperado y la parte inválida: %+v", tc.account, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// creditDocument retorna la factura de ejemplo al crédito en dos cuotas de 59.00
+func creditDocument(dueDate string) *BusinessDocument {
+	doc := sampleDocument()
+	doc.DueDate = dueDate
+	doc.PaymentTerms = &PaymentTerms{
+		Method: PaymentCredit,
+		Installments: []Installment{
+			{Amount: 59, DueDate: "2024-07-07"},
+			{Amount: 59, DueDate: "2024-08-07"},
+		},
+	}
+	return doc
+}
+
+func TestDueDateValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	cases := []struct {
+		name string
+		doc  func() *BusinessDocument
+		rule string
+	}{
+		{"crédito consistente", func() *BusinessDocument { return creditDocument("2024-08-07") }, ""},
+		{"crédito sin dueDate", func() *BusinessDocument { return creditDocument("") }, ""},
+		{"crédito inconsistente", func() *BusinessDocument { return creditDocument("2024-07-07") }, "due_date_installment_validation"},
+		{"vencimiento anterior a la emisión", func() *BusinessDocument {
+			doc := sampleDocument()
+			doc.DueDate = "2000-01-01"
+			return doc
+		}, "due_date_validation"},
+		{"crédito sin cuotas", func() *BusinessDocument {
+			doc := creditDocument("")
+			doc.PaymentTerms.Installments = nil
+			return doc
+		}, "payment_terms_validation"},
+		{"cuotas que no suman el total", func() *BusinessDocument {
+			doc := creditDocument("")
+			doc.PaymentTerms.Installments[1].Amount = 10
+			return doc
+		}, "payment_terms_validation"},
+		{"contado con cuotas", func() *BusinessDocument {
+			doc := creditDocument("")
+			doc.PaymentTerms.Method = PaymentCash
+			return doc
+		}, "payment_terms_validation"},
+	}
+
+	for _, tc := range cases {
+		errs := validator.ValidateBusinessDocument(tc.doc())
+		if tc.rule == "" && len(errs) > 0 {
+			t.Errorf("%s: no se esperaban errores, obtenido %+v", tc.name, errs)
+		}
+		if tc.rule != "" && !hasRule(errs, tc.rule) {
+			t.Errorf("%s: se esperaba la regla %s, obtenido %+v", tc.name, tc.rule, errs)
+		}
+	}
+}
+
+func TestCashDueDateWarning(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	doc := sampleDocument()
+	doc.DueDate = doc.IssueDate
+
+	resp, err := newMemoryService().ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("se esperaba éxito con warning: %v %+v", err, resp)
+	}
+	if !hasRule(resp.Warnings, "due_date_cash_payment") {
+		t.Errorf("se esperaba el warning due_date_cash_payment, obtenido %+v", resp.Warnings)
+	}
+}
+
+func TestCreditPaymentTermsSerialized(t *testing.T) {
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(creditDocument(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmlStr := string(xmlData)
+
+	// El DueDate se deriva de la última cuota
+	for _, want := range []string{
+		"<cbc:DueDate>2024-08-07</cbc:DueDate>",
+		"<cbc:PaymentMeansID>Credito</cbc:PaymentMeansID>",
+		"<cbc:PaymentMeansID>Cuota002</cbc:PaymentMeansID>",
+		"<cbc:PaymentDueDate>2024-07-07</cbc:PaymentDueDate>",
+	} {
+		if !strings.Contains(xmlStr, want) {
+			t.Errorf("falta %s en el XML", want)
+		}
+	}
+
+	xmlData, _ = NewUBLConverter(nil).ConvertToUBL(sampleDocument())
+	if strings.Contains(string(xmlData), "<cbc:DueDate>") {
+		t.Error("una factura al contado sin dueDate no debe emitir cbc:DueDate")
+	}
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func TestTaxPercentSerialization(t *testing.T) {
+	cases := []struct {
+		name    string
+		taxType string
+		rate    float64
+		want    string
+	}{
+		{"IGV 18", "1000", 18, "<cbc:Percent>18.00</cbc:Percent>"},
+		{"exonerado 0", "9997", 0, "<cbc:Percent>0.00</cbc:Percent>"},
+		{"arrastre de float", "1000", 17.999999999999996, "<cbc:Percent>18.00</cbc:Percent>"},
+	}
+	validator := NewValidationService(nil)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := sampleDocument()
+			doc.Items[0].Taxes[0].TaxType = tc.taxType
+			doc.Items[0].Taxes[0].TaxRate = FlexFloat(tc.rate)
+			doc.Taxes[0].TaxType = tc.taxType
+			doc.Taxes[0].TaxRate = FlexFloat(tc.rate)
+
+			xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+			if err != nil {
+				t.Fatalf("conversión falló: %v", err)
+			}
+			if count := strings.Count(string(xmlData), tc.want); count != 2 {
+				t.Fatalf("se esperaba %s en documento y línea, se obtuvo %d", tc.want, count)
+			}
+			if hasRule(validator.ValidateBusinessDocument(doc), "tax_rate_validation") {
+				t.Fatalf("la tasa %v debe ser admitida para %s", tc.rate, tc.taxType)
+			}
+		})
+	}
+}
+
+func TestTaxRateValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	doc := sampleDocument()
+	doc.Taxes[0].TaxRate = 16
+	if !hasRule(validator.ValidateBusinessDocument(doc), "tax_rate_validation") {
+		t.Fatalf("se esperaba rechazo de IGV al 16%%")
+	}
+
+	validator.SetIGVRate(16)
+	doc.Items[0].Taxes[0].TaxRate = 16
+	if hasRule(validator.ValidateBusinessDocument(doc), "tax_rate_validation") {
+		t.Fatalf("con tasa configurada a 16%% no debe haber error")
+	}
+}
+
+func TestDecimal2Rounding(t *testing.T) {
+	if got := Decimal2(17.999999999999996).String(); got != "18.00" {
+		t.Fatalf("se esperaba 18.00, se obtuvo %s", got)
+	}
+	if got := Decimal2(0).String(); got != "0.00" {
+		t.Fatalf("se esperaba 0.00, se obtuvo %s", got)
+	}
+}
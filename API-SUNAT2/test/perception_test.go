@@ -0,0 +1,106 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// perceptionBoleta retorna la boleta de ejemplo (total 118.00) con la percepción indicada
+func perceptionBoleta(regimeCode string, rate, amount float64) *BusinessDocument {
+	doc := sampleDocument()
+	doc.Type = "03"
+	doc.Series = "B001"
+	doc.Perception = &Perception{
+		RegimeCode:   regimeCode,
+		Rate:         FlexFloat(rate),
+		Base:         118,
+		Amount:       FlexFloat(amount),
+		TotalCharged: FlexFloat(118 + amount),
+	}
+	return doc
+}
+
+func TestPerceptionValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	cases := []struct {
+		name string
+		doc  func() *BusinessDocument
+		rule string
+	}{
+		{"2% venta interna", func() *BusinessDocument { return perceptionBoleta("51", 2, 2.36) }, ""},
+		{"0.5% tasa especial", func() *BusinessDocument { return perceptionBoleta("53", 0.5, 0.59) }, ""},
+		{"monto distinto de base × tasa", func() *BusinessDocument { return perceptionBoleta("51", 2, 2.50) }, "perception_amount_validation"},
+		{"total cobrado sin percepción", func() *BusinessDocument {
+			doc := perceptionBoleta("51", 2, 2.36)
+			doc.Perception.TotalCharged = 118
+			return doc
+		}, "perception_total_validation"},
+		{"tasa que no corresponde al régimen", func() *BusinessDocument { return perceptionBoleta("51", 0.5, 0.59) }, "perception_validation"},
+		{"régimen fuera del catálogo", func() *BusinessDocument { return perceptionBoleta("99", 2, 2.36) }, "perception_validation"},
+		{"percepción en factura", func() *BusinessDocument {
+			doc := perceptionBoleta("51", 2, 2.36)
+			doc.Type, doc.Series = "01", "F003"
+			return doc
+		}, "perception_validation"},
+	}
+
+	for _, tc := range cases {
+		errs := validator.ValidateBusinessDocument(tc.doc())
+		if tc.rule == "" && len(errs) > 0 {
+			t.Errorf("%s: no se esperaban errores, obtenido %+v", tc.name, errs)
+		}
+		if tc.rule != "" && !hasRule(errs, tc.rule) {
+			t.Errorf("%s: se esperaba la regla %s, obtenido %+v", tc.name, tc.rule, errs)
+		}
+	}
+}
+
+func TestPerceptionSerialized(t *testing.T) {
+	cases := []struct {
+		doc  *BusinessDocument
+		want []string
+	}{
+		{perceptionBoleta("51", 2, 2.36), []string{
+			`listName="Cargo/descuento" listURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo53">51</cbc:AllowanceChargeReasonCode>`,
+			"<cbc:MultiplierFactorNumeric>0.02</cbc:MultiplierFactorNumeric>",
+			`<cbc:Amount currencyID="PEN">2.36</cbc:Amount>`,
+			`<cbc:Amount currencyID="PEN">120.36</cbc:Amount>`,
+		}},
+		{perceptionBoleta("53", 0.5, 0.59), []string{
+			`listName="Cargo/descuento" listURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo53">53</cbc:AllowanceChargeReasonCode>`,
+			"<cbc:MultiplierFactorNumeric>0.005</cbc:MultiplierFactorNumeric>",
+			`<cbc:Amount currencyID="PEN">118.59</cbc:Amount>`,
+		}},
+	}
+
+	for _, tc := range cases {
+		xmlData, err := NewUBLConverter(nil).ConvertToUBL(tc.doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xmlStr := string(xmlData)
+		want := append(tc.want,
+			`<cbc:Note languageLocaleID="2000">COMPROBANTE DE PERCEPCIÓN</cbc:Note>`,
+			">2001</cbc:ProfileID>",
+			"<cbc:ID>Percepcion</cbc:ID>",
+		)
+		for _, fragment := range want {
+			if !strings.Contains(xmlStr, fragment) {
+				t.Errorf("régimen %s: falta %s en el XML", tc.doc.Perception.RegimeCode, fragment)
+			}
+		}
+	}
+}
+
+func TestPerceptionBoletaProcessed(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	resp, err := newMemoryService().ProcessDocument(context.Background(), perceptionBoleta("51", 2, 2.36), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("se esperaba éxito: %v %+v", err, resp)
+	}
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+)
+
+// recordingStep implementa todos los pasos del pipeline, registra las llamadas en
+// calls y falla con err en el paso indicado por failAt
+type recordingStep struct {
+	calls  *[]string
+	failAt string
+	err    error
+}
+
+func (r recordingStep) record(step string) error {
+	*r.calls = append(*r.calls, step)
+	if step == r.failAt {
+		return r.err
+	}
+	return nil
+}
+
+func (r recordingStep) Validate(ctx *PipelineContext) error { return r.record("validate") }
+func (r recordingStep) Convert(ctx *PipelineContext) error {
+	ctx.XML = []byte("<Invoice/>")
+	return r.record("convert")
+}
+func (r recordingStep) Sign(ctx *PipelineContext) error  { return r.record("sign") }
+func (r recordingStep) Write(ctx *PipelineContext) error { return r.record("write") }
+func (r recordingStep) Name() string                     { return "notify" }
+func (r recordingStep) Run(ctx *PipelineContext) error   { return r.record("notify") }
+
+func TestPipelineStopsAtFailingStep(t *testing.T) {
+	all := []string{"validate", "convert", "sign", "write", "notify"}
+	cases := []struct {
+		failAt   string
+		err      error
+		wantCode string
+	}{
+		{"", nil, ""},
+		{"validate", &StepError{Code: "VALIDATION_FAILED", Message: "Documento no válido"}, "VALIDATION_FAILED"},
+		{"convert", errors.New("plantilla inválida"), "CONVERSION_FAILED"},
+		{"sign", &StepError{Code: "ERR_KEY_MISMATCH", Message: "clave"}, "ERR_KEY_MISMATCH"},
+		{"write", errors.New("disco lleno"), "SAVE_FAILED"},
+		{"notify", errors.New("sin red"), "NOTIFY_FAILED"},
+	}
+
+	for _, tc := range cases {
+		var calls []string
+		step := recordingStep{calls: &calls, failAt: tc.failAt, err: tc.err}
+		pipeline := NewPipeline(step, step, step)
+		pipeline.SetWriter(step)
+		pipeline.AddStep(step)
+
+		ctx, err := pipeline.Run(context.Background(), sampleDocument(), nil, nil)
+
+		want := all
+		if tc.failAt != "" {
+			for i, name := range all {
+				if name == tc.failAt {
+					want = all[:i+1]
+				}
+			}
+		}
+		if strings.Join(calls, ",") != strings.Join(want, ",") {
+			t.Errorf("falla en %q: pasos ejecutados %v, esperados %v", tc.failAt, calls, want)
+		}
+		if ctx == nil || ctx.CorrelationID == "" {
+			t.Errorf("falla en %q: se esperaba el contexto con correlationId", tc.failAt)
+		}
+
+		if tc.wantCode == "" {
+			if err != nil {
+				t.Errorf("no se esperaba error: %v", err)
+			}
+			continue
+		}
+		var stepErr *StepError
+		if !errors.As(err, &stepErr) || stepErr.Code != tc.wantCode {
+			t.Errorf("falla en %q: se esperaba el código %s, obtenido %v", tc.failAt, tc.wantCode, err)
+		}
+	}
+}
+
+func TestPipelineWithoutWriter(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+
+	pipeline := service.NewDefaultPipeline()
+	pipeline.SetWriter(nil)
+	ctx, err := pipeline.Run(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("pipeline sin escritura falló: %v", err)
+	}
+	if !strings.Contains(string(ctx.XML), "SignatureValue") {
+		t.Error("se esperaba el XML firmado en el contexto")
+	}
+	if names, _ := service.GetStore().List(); len(names) != 0 {
+		t.Errorf("el pipeline sin escritura no debe guardar archivos: %v", names)
+	}
+}
+
+func TestPipelineDefaultStepErrors(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+
+	invalid := sampleDocument()
+	invalid.Currency = "XXX"
+	_, err := service.NewDefaultPipeline().Run(context.Background(), invalid, certPEM, keyPEM)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Code != "VALIDATION_FAILED" || !hasRule(stepErr.ValidationErrors, "currency_validation") {
+		t.Errorf("se esperaba VALIDATION_FAILED con currency_validation, obtenido %v", err)
+	}
+
+	service.SetConverter(failingConverter{})
+	_, err = service.NewDefaultPipeline().Run(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if !errors.As(err, &stepErr) || stepErr.Code != "CONVERSION_FAILED" {
+		t.Errorf("se esperaba CONVERSION_FAILED, obtenido %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// taxIncludedDocument retorna la factura de ejemplo con una línea por precio con IGV
+// incluido y sin montos calculados
+func taxIncludedDocument(prices ...float64) *BusinessDocument {
+	doc := sampleDocument()
+	doc.PricesIncludeTax = true
+	doc.Items = nil
+	for i, price := range prices {
+		doc.Items = append(doc.Items, DocumentItem{
+			ID:          strconv.Itoa(i + 1),
+			Description: "Producto " + strconv.Itoa(i+1),
+			Quantity:    1,
+			UnitCode:    "NIU",
+			UnitPrice:   FlexFloat(price),
+		})
+	}
+	doc.Totals = DocumentTotals{}
+	doc.Taxes = nil
+	return doc
+}
+
+func TestPricesIncludeTaxDerivesAmounts(t *testing.T) {
+	cases := []struct {
+		name      string
+		prices    []float64
+		lineTotal []float64
+		subTotal  float64
+		igv       float64
+		total     float64
+	}{
+		{"10.00", []float64{10}, []float64{8.47}, 8.47, 1.53, 10},
+		// 3 × 8.47 = 25.41, pero 30.00 / 1.18 = 25.42: el céntimo va a la primera línea mayor
+		{"3 × 10.00", []float64{10, 10, 10}, []float64{8.48, 8.47, 8.47}, 25.42, 4.58, 30},
+		{"céntimo en la línea mayor", []float64{1, 1, 1, 15}, []float64{0.85, 0.85, 0.85, 12.70}, 15.25, 2.75, 18},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			certPEM, keyPEM := loadTestCredentials(t)
+			doc := taxIncludedDocument(tc.prices...)
+			service := newMemoryService()
+			resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != "SUCCESS" {
+				t.Fatalf("status %s: %s %+v", resp.Status, resp.ErrorMessage, resp.ValidationErrors)
+			}
+
+			derived, ok := resp.Data["derivedAmounts"].(*DerivedAmounts)
+			if !ok {
+				t.Fatalf("la respuesta no reporta los montos derivados: %v", resp.Data)
+			}
+			if derived.SubTotal != tc.subTotal || derived.TotalTaxes != tc.igv || derived.TotalAmount != tc.total {
+				t.Errorf("totales = %.2f + %.2f = %.2f, esperado %.2f + %.2f = %.2f",
+					derived.SubTotal, derived.TotalTaxes, derived.TotalAmount, tc.subTotal, tc.igv, tc.total)
+			}
+
+			var sumBase, sumIGV float64
+			for i, line := range derived.Lines {
+				if line.LineTotal != tc.lineTotal[i] {
+					t.Errorf("línea %s: lineTotal = %.2f, esperado %.2f", line.ID, line.LineTotal, tc.lineTotal[i])
+				}
+				if math.Abs(line.LineTotal+line.TaxAmount-tc.prices[i]) > 1e-9 {
+					t.Errorf("línea %s: %.2f + %.2f no cuadra con %.2f", line.ID, line.LineTotal, line.TaxAmount, tc.prices[i])
+				}
+				sumBase += line.LineTotal
+				sumIGV += line.TaxAmount
+			}
+			if Decimal2(sumBase).Round() != tc.subTotal || Decimal2(sumIGV).Round() != tc.igv {
+				t.Errorf("la suma de líneas %.2f + %.2f no cuadra con el documento", sumBase, sumIGV)
+			}
+
+			// Los totales derivados llegan al XML sin residuos de punto flotante
+			xml, err := service.GetStore().Read(resp.Data["fileName"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			amount := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+			for _, want := range []string{
+				`<cbc:TaxableAmount currencyID="PEN">` + amount(tc.subTotal) + `</cbc:TaxableAmount>`,
+				`<cbc:TaxAmount currencyID="PEN">` + amount(tc.igv) + `</cbc:TaxAmount>`,
+				`<cbc:PayableAmount currencyID="PEN">` + amount(tc.total) + `</cbc:PayableAmount>`,
+			} {
+				if !strings.Contains(string(xml), want) {
+					t.Errorf("falta %s en el XML", want)
+				}
+			}
+		})
+	}
+}
+
+func TestPricesIncludeTaxRejectsNonIGVItems(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	doc := taxIncludedDocument(10)
+	doc.Items[0].Taxes = []Tax{{TaxType: "9997"}}
+
+	resp, err := newMemoryService().ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ErrorCode != ValidationFailedCode || !hasRule(resp.ValidationErrors, "prices_include_tax_validation") {
+		t.Errorf("se esperaba prices_include_tax_validation, obtenido %s %+v", resp.ErrorCode, resp.ValidationErrors)
+	}
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func TestPricingReferenceOmission(t *testing.T) {
+	converter := NewUBLConverter(nil)
+
+	// Por defecto cada línea lleva el precio de referencia con el tipo según su carácter
+	xmlData, err := converter.ConvertToUBL(mixedFreeDocument())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(xmlData), "<cac:InvoiceLine>")
+	if len(lines) != 4 {
+		t.Fatalf("se esperaban 3 líneas, se obtuvieron %d", len(lines)-1)
+	}
+	for i, want := range []string{"01", "01", "02"} {
+		if !strings.Contains(lines[i+1], "<cac:PricingReference>") || !strings.Contains(lines[i+1], ">"+want+"</cbc:PriceTypeCode>") {
+			t.Errorf("línea %d: se esperaba PricingReference con tipo %s:\n%s", i+1, want, lines[i+1])
+		}
+	}
+
+	// El request lo omite, también en la gratuita, que conserva precio cero y el 9996
+	doc := mixedFreeDocument()
+	emit := false
+	doc.EmitPricingReference = &emit
+	xmlData, err = converter.ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := string(xmlData)
+	if strings.Contains(xml, "PricingReference") || strings.Contains(xml, "PriceTypeCode") {
+		t.Errorf("no se esperaba PricingReference:\n%s", xml)
+	}
+	free := strings.Split(xml, "<cac:InvoiceLine>")[3]
+	if !strings.Contains(free, `<cbc:PriceAmount currencyID="PEN">0</cbc:PriceAmount>`) || !strings.Contains(free, "9996") {
+		t.Errorf("la línea gratuita debe seguir declarándose como tal:\n%s", free)
+	}
+
+	// Por emisor, salvo que el request pida el bloque
+	converter.SetPricingReferenceOmitIssuers([]string{"20123456786"})
+	xmlData, _ = converter.ConvertToUBL(sampleDocument())
+	if strings.Contains(string(xmlData), "PricingReference") {
+		t.Error("el emisor configurado no debe emitir PricingReference")
+	}
+	doc = sampleDocument()
+	emit = true
+	doc.EmitPricingReference = &emit
+	xmlData, _ = converter.ConvertToUBL(doc)
+	if !strings.Contains(string(xmlData), "<cac:PricingReference>") {
+		t.Error("emitPricingReference del request debe prevalecer sobre el emisor")
+	}
+}
+
+func TestPricingReferenceOmissionTraced(t *testing.T) {
+	service := newMemoryService()
+	service.SetPricingReferenceOmitIssuers([]string{"20123456786"})
+	documentID := processForSending(t, service, sampleDocument())
+
+	data, err := service.GetStore().Read(RecordName(documentID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record DocumentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	if !record.PricingReferenceOmitted {
+		t.Error("el registro debe indicar que se omitió PricingReference")
+	}
+	xmlData, _ := service.GetStore().Read(documentID + ".xml")
+	if strings.Contains(string(xmlData), "PricingReference") {
+		t.Error("el XML guardado no debe llevar PricingReference")
+	}
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"github.com/gin-gonic/gin"
+)
+
+// doProblemRequest envía el request con Accept: application/problem+json y decodifica
+// el Problem Details de la respuesta
+func doProblemRequest(t *testing.T, handler http.Handler, method, path string, body interface{}) (*httptest.ResponseRecorder, api.ProblemDetails) {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/problem+json, application/json;q=0.9")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var problem api.ProblemDetails
+	if contentType := rec.Header().Get("Content-Type"); contentType != api.ProblemJSONContentType {
+		t.Fatalf("%s %s: Content-Type %q: %d %s", method, path, contentType, rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("%s %s: %v: %s", method, path, err, rec.Body.String())
+	}
+	if problem.Status != rec.Code || problem.Title != http.StatusText(rec.Code) {
+		t.Errorf("%s %s: status %d y title %q con HTTP %d", method, path, problem.Status, problem.Title, rec.Code)
+	}
+	return rec, problem
+}
+
+func TestProblemDetailsValidationError(t *testing.T) {
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+	invalid := sampleDocument()
+	invalid.Currency = "XXX"
+
+	for _, path := range []string{"/api/v1/convert", "/api/v2/convert"} {
+		rec, problem := doProblemRequest(t, router, http.MethodPost, path, convertRequest(t, invalid))
+		if rec.Code != http.StatusUnprocessableEntity || problem.Type != "/problems/validation-failed" || problem.Code != ValidationFailedCode {
+			t.Errorf("%s: problema inesperado: %d %+v", path, rec.Code, problem)
+		}
+		if len(problem.ValidationErrors) == 0 || problem.ValidationErrors[0].Field != "currency" {
+			t.Errorf("%s: faltan los errores por campo: %+v", path, problem.ValidationErrors)
+		}
+		if problem.CorrelationID == "" || problem.Instance != "urn:uuid:"+problem.CorrelationID {
+			t.Errorf("%s: instance %q con correlationId %q", path, problem.Instance, problem.CorrelationID)
+		}
+	}
+
+	// Sin el header se mantiene el formato actual
+	rec := doJSONRequest(router, http.MethodPost, "/api/v2/convert", convertRequest(t, invalid))
+	var resp api.V2Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == nil || resp.Error.Code != ValidationFailedCode {
+		t.Errorf("sin negociación debe responder el contrato v2: %s", rec.Body.String())
+	}
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), api.ProblemJSONContentType) {
+		t.Error("sin negociación no se espera application/problem+json")
+	}
+
+	// Con q=0 el cliente rechaza el formato
+	headers := map[string]string{"Accept": "application/problem+json;q=0, application/json"}
+	rec = doRequest(router, http.MethodGet, "/api/v1/xml/missing.xml", headers)
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), api.ProblemJSONContentType) {
+		t.Error("con q=0 no se espera application/problem+json")
+	}
+}
+
+func TestProblemDetailsNotFound(t *testing.T) {
+	cfg := &config.Config{ProblemTypeBaseURI: "https://errores.example.com/"}
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(cfg, service)
+
+	// Ruta inexistente: el 404 de gin no tiene código interno
+	rec, problem := doProblemRequest(t, router, http.MethodGet, "/api/v1/no-existe", nil)
+	if rec.Code != http.StatusNotFound || problem.Type != "about:blank" || problem.Code != "" {
+		t.Errorf("ruta inexistente: %d %+v", rec.Code, problem)
+	}
+
+	// Documento inexistente: v1 responde los errores del servicio con HTTP 200, pero
+	// Problem Details exige el status de error
+	request := interestRequest(t, 12, "2024-08-06", "")
+	rec, problem = doProblemRequest(t, router, http.MethodPost, "/api/v1/documents/20123456786-01-F003-999/debit-note", request)
+	if rec.Code != http.StatusNotFound || problem.Type != "https://errores.example.com/document-not-found" || problem.Code != "ERR_DOCUMENT_NOT_FOUND" {
+		t.Errorf("documento inexistente: %d %+v", rec.Code, problem)
+	}
+	if problem.DocumentID != "20123456786-01-F003-999" || !strings.Contains(problem.Detail, "No existe el documento") {
+		t.Errorf("detalle del documento inexistente: %+v", problem)
+	}
+
+	// Los errores de los middlewares también se negocian
+	rec, problem = doProblemRequest(t, router, http.MethodGet, "/api/v1/admin/metrics", nil)
+	if rec.Code != http.StatusUnauthorized || problem.Code != "ERR_UNAUTHORIZED" || problem.Type != "https://errores.example.com/unauthorized" {
+		t.Errorf("sin API key: %d %+v", rec.Code, problem)
+	}
+}
+
+func TestProblemDetailsServerError(t *testing.T) {
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+	router.GET("/test/store-error", func(c *gin.Context) {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Status:       "error",
+			ErrorCode:    "ERR_STORE_UNAVAILABLE",
+			ErrorMessage: "disk full",
+			ProcessedAt:  time.Now(),
+		})
+	})
+	router.GET("/test/panic", func(c *gin.Context) {
+		panic("handler roto")
+	})
+
+	rec, problem := doProblemRequest(t, router, http.MethodGet, "/test/store-error", nil)
+	if rec.Code != http.StatusInternalServerError || problem.Type != "/problems/store-unavailable" || problem.Detail != "disk full" {
+		t.Errorf("error del store: %d %+v", rec.Code, problem)
+	}
+	// Sin correlationId en la respuesta, la instancia es el X-Request-ID del request
+	if problem.CorrelationID == "" || problem.CorrelationID != rec.Header().Get("X-Request-ID") || problem.Instance != "urn:uuid:"+problem.CorrelationID {
+		t.Errorf("correlación del error: %+v, X-Request-ID %s", problem, rec.Header().Get("X-Request-ID"))
+	}
+
+	// Un X-Request-ID que no es un UUID también identifica la instancia
+	req := httptest.NewRequest(http.MethodGet, "/test/store-error", nil)
+	req.Header.Set("Accept", api.ProblemJSONContentType)
+	req.Header.Set("X-Request-ID", "erp/pedido 42")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var custom api.ProblemDetails
+	json.Unmarshal(rec.Body.Bytes(), &custom)
+	if custom.CorrelationID != "erp/pedido 42" || custom.Instance != "urn:correlation:erp%2Fpedido%2042" {
+		t.Errorf("instancia con un X-Request-ID propio: %+v", custom)
+	}
+
+	// El 500 sin cuerpo de gin.Recovery
+	rec, problem = doProblemRequest(t, router, http.MethodGet, "/test/panic", nil)
+	if rec.Code != http.StatusInternalServerError || problem.Type != "about:blank" {
+		t.Errorf("pánico: %d %+v", rec.Code, problem)
+	}
+
+	// Las respuestas exitosas no cambian con la negociación
+	headers := map[string]string{"Accept": api.ProblemJSONContentType}
+	if rec := doRequest(router, http.MethodGet, "/health", headers); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status"`) || rec.Header().Get("Content-Type") == api.ProblemJSONContentType {
+		t.Errorf("health con negociación: %d %s", rec.Code, rec.Body.String())
+	}
+}
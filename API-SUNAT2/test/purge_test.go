@@ -0,0 +1,224 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// purgeFixture emite boletas de dos clientes, una de ellas reciente, y deja el reloj
+// del servicio en 2030 para que las de 2024 ya estén fuera del período de conservación
+func purgeFixture(t *testing.T) *UBLConverterService {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetAuditRequests(true)
+
+	for _, tc := range []struct{ number, date, customer string }{
+		{"1", "2024-06-07", "45678912"},
+		{"2", "2024-06-08", "45678912"},
+		{"3", "2024-06-08", "87654321"},
+		{"4", "2025-12-01", "45678912"},
+	} {
+		doc := sampleBoleta(tc.number)
+		doc.IssueDate = tc.date
+		doc.Customer.DocumentID = tc.customer
+		response, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+		if err != nil || response.Status != "SUCCESS" {
+			t.Fatalf("boleta %s: %+v %v", tc.number, response, err)
+		}
+		if err := service.AuditConvertRequest("c-"+tc.number, &ConvertRequest{Document: *doc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service.SetClock(&fixedClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)})
+	return service
+}
+
+func TestPurgeByCustomer(t *testing.T) {
+	service := purgeFixture(t)
+	store := service.GetStore()
+	const purged = "20123456786-03-B001-1"
+
+	// El dry-run cuenta sin tocar el store ni auditar
+	request := PurgeRequest{CustomerDocumentID: "45678912", RequestedBy: "dpo@empresa.pe", DryRun: true}
+	report, err := service.PurgeDocuments(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Matched != 3 || report.Purged != 2 || len(report.Retained) != 1 || report.AuditID != "" {
+		t.Fatalf("dry-run inesperado: %+v", report)
+	}
+	if _, err := store.Read(purged + ".xml"); err != nil {
+		t.Fatal("el dry-run no debe eliminar archivos")
+	}
+	if audits, _ := service.ListPurgeAudits(); len(audits) != 0 {
+		t.Fatalf("el dry-run no debe auditarse: %+v", audits)
+	}
+
+	request.DryRun = false
+	report, err = service.PurgeDocuments(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Purged != 2 || report.Artifacts != 2*3 {
+		t.Fatalf("se esperaban 2 documentos con XML, ZIP y auditoría: %+v", report)
+	}
+	for _, suffix := range []string{".xml", ".zip", AuditSuffix} {
+		if _, err := store.Read(purged + suffix); err == nil {
+			t.Errorf("%s%s debe eliminarse", purged, suffix)
+		}
+	}
+
+	// El registro queda sin el cliente y el historial registra la purga
+	record := readDocumentRecord(t, store, purged)
+	if record.CustomerDocumentID != "" || record.PurgedAt == nil || record.PayableAmount != 118 {
+		t.Errorf("registro anonimizado inesperado: %+v", record)
+	}
+	lookup, err := service.FindDocument("20123456786", "03", "B001", "1")
+	if err != nil || lookup.Status != DocumentPurged {
+		t.Errorf("se esperaba el estado %s: %+v %v", DocumentPurged, lookup, err)
+	}
+
+	// Los demás clientes no se tocan
+	if record := readDocumentRecord(t, store, "20123456786-03-B001-3"); record.CustomerDocumentID != "87654321" {
+		t.Errorf("el documento de otro cliente no debe purgarse: %+v", record)
+	}
+
+	// Repetir la purga no encuentra nada nuevo que anonimizar
+	if report, err := service.PurgeDocuments(request); err != nil || report.Purged != 0 {
+		t.Errorf("se esperaba una purga vacía: %+v %v", report, err)
+	}
+}
+
+func TestPurgeRetentionPeriod(t *testing.T) {
+	service := purgeFixture(t)
+	store := service.GetStore()
+
+	// La boleta de 2025 sigue dentro del período aunque se pida por su ID
+	request := PurgeRequest{DocumentIDs: []string{"20123456786-03-B001-4"}, Mode: PurgeModeDelete, RequestedBy: "dpo@empresa.pe"}
+	report, err := service.PurgeDocuments(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Purged != 0 || len(report.Retained) != 1 || report.Retained[0].RetainUntil != "2030-12-01" {
+		t.Fatalf("se esperaba el documento retenido: %+v", report)
+	}
+	if _, err := store.Read("20123456786-03-B001-4.xml"); err != nil {
+		t.Error("un documento dentro del período no debe eliminarse")
+	}
+
+	// Con un período más largo tampoco se purgan las de 2024
+	service.SetRetentionYears(10)
+	report, err = service.PurgeDocuments(PurgeRequest{From: "2024-01-01", To: "2024-12-31", RequestedBy: "dpo@empresa.pe"})
+	if err != nil || report.Purged != 0 || len(report.Retained) != 3 {
+		t.Fatalf("con 10 años no debe purgarse nada: %+v %v", report, err)
+	}
+
+	// Borrado completo una vez vencido el período
+	service.SetRetentionYears(5)
+	request.DocumentIDs = []string{"20123456786-03-B001-2"}
+	if report, err = service.PurgeDocuments(request); err != nil || report.Purged != 1 {
+		t.Fatalf("se esperaba el borrado: %+v %v", report, err)
+	}
+	names, _ := store.List()
+	for _, name := range names {
+		if strings.HasPrefix(name, "20123456786-03-B001-2.") {
+			t.Errorf("%s debe eliminarse en modo delete", name)
+		}
+	}
+
+	for _, invalid := range []PurgeRequest{
+		{RequestedBy: "dpo@empresa.pe"},
+		{CustomerDocumentID: "45678912"},
+		{CustomerDocumentID: "45678912", RequestedBy: "dpo@empresa.pe", Mode: "shred"},
+		{From: "07/06/2024", RequestedBy: "dpo@empresa.pe"},
+	} {
+		if _, err := service.PurgeDocuments(invalid); err == nil {
+			t.Errorf("se esperaba error con %+v", invalid)
+		}
+	}
+}
+
+func TestPurgeAudit(t *testing.T) {
+	service := purgeFixture(t)
+	report, err := service.PurgeDocuments(PurgeRequest{
+		CustomerDocumentID: "45678912",
+		To:                 "2024-06-07",
+		RequestedBy:        "dpo@empresa.pe",
+		Reason:             "Solicitud de supresión 2029-118",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audits, err := service.ListPurgeAudits()
+	if err != nil || len(audits) != 1 {
+		t.Fatalf("se esperaba un registro de auditoría: %+v %v", audits, err)
+	}
+	audit := audits[0]
+	if audit.AuditID != report.AuditID || audit.RequestedBy != "dpo@empresa.pe" || audit.Reason == "" || audit.RetentionYears != 5 {
+		t.Errorf("auditoría inesperada: %+v", audit)
+	}
+	if !audit.PurgedAt.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("la auditoría debe registrar cuándo se purgó: %v", audit.PurgedAt)
+	}
+	if len(audit.Report.Documents) != 1 || audit.Report.Documents[0].DocumentID != "20123456786-03-B001-1" {
+		t.Errorf("la auditoría debe listar lo purgado: %+v", audit.Report)
+	}
+	// La auditoría no conserva el documento del cliente que se purgó
+	if audit.Filter.CustomerDocumentID != "****8912" {
+		t.Errorf("el documento del cliente debe enmascararse: %q", audit.Filter.CustomerDocumentID)
+	}
+}
+
+func TestPurgeEndpoint(t *testing.T) {
+	service := purgeFixture(t)
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+	purge := func(key string, body PurgeRequest) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/purge", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin-API-Key", key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	valid := PurgeRequest{CustomerDocumentID: "45678912", RequestedBy: "dpo@empresa.pe", DryRun: true}
+	if rec := purge("otra", valid); rec.Code != http.StatusUnauthorized {
+		t.Errorf("sin API key válida: se esperaba 401, se obtuvo %d", rec.Code)
+	}
+	if rec := purge("secreto", PurgeRequest{CustomerDocumentID: "45678912"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("sin requestedBy: se esperaba 400, se obtuvo %d", rec.Code)
+	}
+	rec := purge("secreto", PurgeRequest{RequestedBy: "dpo@empresa.pe"})
+	var errResp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &errResp)
+	if rec.Code != http.StatusBadRequest || errResp.ErrorCode != "ERR_INVALID_PURGE_REQUEST" {
+		t.Errorf("sin filtro: código %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = purge("secreto", valid)
+	var resp struct {
+		Data struct {
+			Purge PurgeReport `json:"purge"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("dry-run: código %d: %s", rec.Code, rec.Body.String())
+	}
+	if report := resp.Data.Purge; !report.DryRun || report.Purged != 2 || len(report.Retained) != 1 {
+		t.Errorf("dry-run inesperado: %+v", report)
+	}
+}
@@ -0,0 +1,209 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// gatedPublisher publica un evento por cada señal de gate, para tener un evento en
+// vuelo mientras se opera la cola
+type gatedPublisher struct {
+	gate chan struct{}
+
+	mu     sync.Mutex
+	events []DocumentEvent
+	calls  int
+}
+
+func (p *gatedPublisher) Publish(ctx context.Context, event DocumentEvent) error {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	select {
+	case <-p.gate:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *gatedPublisher) counts() (calls, published int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls, len(p.events)
+}
+
+// waitUntil espera hasta que la condición se cumpla
+func waitUntil(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("no se cumplió: %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type queuesResponse struct {
+	Data struct {
+		Queues []QueueDetail `json:"queues"`
+		Queue  QueueStats    `json:"queue"`
+	} `json:"data"`
+	ErrorCode string `json:"errorCode"`
+}
+
+func queuesRequest(t *testing.T, router http.Handler, method, path string) (*httptest.ResponseRecorder, queuesResponse) {
+	t.Helper()
+	rec := doRequest(router, method, "/api/v1/admin"+path, map[string]string{"X-Admin-API-Key": "admin"})
+	var body queuesResponse
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec, body
+}
+
+// queueWithEventInFlight emite tres boletas con el publicador bloqueado en la primera:
+// un evento queda en vuelo y dos pendientes
+func queueWithEventInFlight(t *testing.T) (*UBLConverterService, *gatedPublisher, http.Handler, func()) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	publisher := &gatedPublisher{gate: make(chan struct{})}
+	stop := service.StartEventPublisher(publisher, 10)
+	for i := 1; i <= 3; i++ {
+		if resp, err := service.ProcessDocument(context.Background(), sampleBoleta(strconv.Itoa(i)), certPEM, keyPEM); err != nil || resp.Status != "SUCCESS" {
+			t.Fatalf("procesamiento falló: %v %+v", err, resp)
+		}
+	}
+	waitUntil(t, "primer evento en vuelo", func() bool {
+		calls, _ := publisher.counts()
+		return calls == 1
+	})
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "admin"}, service)
+	return service, publisher, router, stop
+}
+
+func TestQueuePauseWithEventInFlight(t *testing.T) {
+	service, publisher, router, stop := queueWithEventInFlight(t)
+	defer stop()
+
+	rec, body := queuesRequest(t, router, http.MethodPost, "/queues/events/pause")
+	if rec.Code != http.StatusOK || !body.Data.Queue.Paused || body.Data.Queue.InFlight != 1 || body.Data.Queue.Depth != 2 {
+		t.Fatalf("pausa: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// El evento en vuelo termina; los pendientes esperan mientras la cola está pausada
+	publisher.gate <- struct{}{}
+	queue, _ := service.Queue(EventQueueName)
+	waitUntil(t, "evento en vuelo publicado", func() bool { return queue.Stats().InFlight == 0 })
+	time.Sleep(20 * time.Millisecond)
+	if calls, published := publisher.counts(); calls != 1 || published != 1 {
+		t.Fatalf("la cola pausada no debe tomar eventos: %d llamadas, %d publicados", calls, published)
+	}
+
+	rec, body = queuesRequest(t, router, http.MethodGet, "/queues?offset=1&limit=1")
+	if rec.Code != http.StatusOK || len(body.Data.Queues) != 1 {
+		t.Fatalf("listado: %d %s", rec.Code, rec.Body.String())
+	}
+	stats := body.Data.Queues[0]
+	if stats.Name != EventQueueName || stats.Depth != 2 || stats.ProcessedLastMinute != 1 || stats.OldestAgeSeconds <= 0 || stats.Capacity != 10 {
+		t.Errorf("estado de la cola pausada: %+v", stats.QueueStats)
+	}
+	if len(stats.Items) != 1 || stats.Items[0].InFlight || stats.Items[0].DocumentID == "" || stats.Items[0].Kind != DocumentProcessedEvent {
+		t.Errorf("página de elementos: %+v", stats.Items)
+	}
+
+	// Al reanudar se publican los pendientes
+	rec, _ = queuesRequest(t, router, http.MethodPost, "/queues/events/resume")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reanudar: %d %s", rec.Code, rec.Body.String())
+	}
+	publisher.gate <- struct{}{}
+	publisher.gate <- struct{}{}
+	waitUntil(t, "pendientes publicados", func() bool {
+		_, published := publisher.counts()
+		return published == 3
+	})
+}
+
+func TestQueueDrainWithEventInFlight(t *testing.T) {
+	service, publisher, router, stop := queueWithEventInFlight(t)
+	defer stop()
+	queue, _ := service.Queue(EventQueueName)
+	queue.Pause()
+
+	// El drenado procesa los pendientes aunque la cola esté pausada y espera al que está en vuelo
+	type result struct {
+		rec  *httptest.ResponseRecorder
+		body queuesResponse
+	}
+	drained := make(chan result, 1)
+	go func() {
+		rec, body := queuesRequest(t, router, http.MethodPost, "/queues/events/drain")
+		drained <- result{rec, body}
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-drained:
+			t.Fatalf("el drenado respondió con %d eventos sin publicar", 3-i)
+		case <-time.After(10 * time.Millisecond):
+		}
+		publisher.gate <- struct{}{}
+	}
+
+	select {
+	case res := <-drained:
+		stats := res.body.Data.Queue
+		if res.rec.Code != http.StatusOK || stats.Depth != 0 || stats.InFlight != 0 || !stats.Paused || stats.ProcessedLastMinute != 3 {
+			t.Errorf("drenado: %d %s", res.rec.Code, res.rec.Body.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("el drenado no terminó")
+	}
+	if _, published := publisher.counts(); published != 3 {
+		t.Errorf("publicados %d de 3", published)
+	}
+
+	// Drenado cancelado: el evento queda en vuelo esperando al broker
+	certPEM, keyPEM := loadTestCredentials(t)
+	service.ProcessDocument(context.Background(), sampleBoleta("4"), certPEM, keyPEM)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := queue.Drain(ctx); err == nil {
+		t.Error("el drenado debe fallar al cancelarse con un evento en vuelo")
+	}
+	close(publisher.gate)
+}
+
+func TestQueueEndpointErrors(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "admin"}, service)
+
+	// Sin publicador de eventos no hay colas activas
+	if rec, body := queuesRequest(t, router, http.MethodGet, "/queues"); rec.Code != http.StatusOK || len(body.Data.Queues) != 0 {
+		t.Errorf("sin colas: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec, body := queuesRequest(t, router, http.MethodPost, "/queues/events/pause"); rec.Code != http.StatusNotFound || body.ErrorCode != "ERR_QUEUE_NOT_FOUND" {
+		t.Errorf("cola inexistente: %d %s", rec.Code, rec.Body.String())
+	}
+
+	stop := service.StartEventPublisher(&memoryPublisher{}, 1)
+	defer stop()
+	for _, query := range []string{"offset=-1", "limit=0", "limit=x"} {
+		if rec, body := queuesRequest(t, router, http.MethodGet, "/queues?"+query); rec.Code != http.StatusBadRequest || body.ErrorCode != "ERR_INVALID_PAGINATION" {
+			t.Errorf("%s: %d %s", query, rec.Code, rec.Body.String())
+		}
+	}
+}
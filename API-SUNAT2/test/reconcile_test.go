@@ -0,0 +1,232 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// reconcileClient simula un SUNAT que no responde sendBill (el envío queda en ENVIADO)
+// y responde getStatusCdr según el escenario de cada comprobante (serie-número)
+type reconcileClient struct {
+	sendErr  error
+	statuses map[string]*SunatCDRStatus
+	errs     map[string]error
+	queried  []string
+}
+
+func (m *reconcileClient) SendBill(ctx context.Context, fileName string, zipData []byte) ([]byte, error) {
+	return nil, m.sendErr
+}
+
+func (m *reconcileClient) SendSummary(ctx context.Context, fileName string, zipData []byte) (string, error) {
+	return "", m.sendErr
+}
+
+func (m *reconcileClient) GetStatus(ctx context.Context, ticket string) ([]byte, error) {
+	return nil, m.sendErr
+}
+
+func (m *reconcileClient) GetStatusCdr(ctx context.Context, ruc, docType, series, number string) (*SunatCDRStatus, error) {
+	key := series + "-" + number
+	m.queried = append(m.queried, key)
+	if err := m.errs[key]; err != nil {
+		return nil, err
+	}
+	if status, ok := m.statuses[key]; ok {
+		return status, nil
+	}
+	return &SunatCDRStatus{Code: SunatCdrNotFound, Message: "El comprobante de pago electrónico no existe."}, nil
+}
+
+// sendLost emite y envía la factura con el número indicado; el envío queda sin CDR
+func sendLost(t *testing.T, service *UBLConverterService, number string) string {
+	t.Helper()
+	doc := sampleDocument()
+	doc.Number = number
+	documentID := processForSending(t, service, doc)
+	if resp, _ := service.SendDocument(context.Background(), documentID, EnvironmentBeta); resp.ErrorCode != "ERR_SUNAT_UNAVAILABLE" {
+		t.Fatalf("se esperaba ERR_SUNAT_UNAVAILABLE, obtenido %+v", resp)
+	}
+	return documentID
+}
+
+func newReconcileService(client *reconcileClient, clock *fixedClock) *UBLConverterService {
+	service := newMemoryService()
+	service.SetClock(clock)
+	service.SetSunatRouter(NewSunatRouter(SunatCredentials{
+		"*": {EnvironmentBeta: {Username: "u", Password: "p"}},
+	}, func(SunatEndpoint) SunatClient { return client }), EnvironmentBeta)
+	return service
+}
+
+func submissionStatus(t *testing.T, service *UBLConverterService, documentID string) SubmissionRecord {
+	t.Helper()
+	records, _ := service.ListSubmissions(EnvironmentBeta)
+	for _, record := range records {
+		if record.DocumentID == documentID {
+			return record
+		}
+	}
+	t.Fatalf("no hay envío registrado de %s", documentID)
+	return SubmissionRecord{}
+}
+
+func TestReconcileScenarios(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	client := &reconcileClient{
+		sendErr: errors.New("read: connection reset by peer"),
+		statuses: map[string]*SunatCDRStatus{
+			"F003-1": {Code: "0001", Message: "El comprobante existe y está aceptado.", CDR: buildCDR("0", "La Factura numero F003-1, ha sido aceptada")},
+			"F003-2": {Code: "0002", Message: "El comprobante existe y está rechazado.", CDR: buildCDR("2800", "El dato ingresado en el tipo de documento de identidad del receptor no esta permitido.")},
+			"F003-4": {Code: "0004", Message: "Formato de RUC no es válido."},
+		},
+		errs: map[string]error{"F003-5": errors.New("sunat request failed: timeout")},
+	}
+	service := newReconcileService(client, clock)
+
+	accepted := sendLost(t, service, "1")
+	rejected := sendLost(t, service, "2")
+	missing := sendLost(t, service, "3")
+	sendLost(t, service, "4")
+	sendLost(t, service, "5")
+	clock.now = clock.now.Add(3 * time.Hour)
+	recent := sendLost(t, service, "6")
+
+	if record := submissionStatus(t, service, accepted); record.Status != SubmissionSent || record.CDRFile != "" {
+		t.Fatalf("el envío sin respuesta debe quedar en ENVIADO: %+v", record)
+	}
+
+	report, err := service.ReconcileSubmissions(context.Background(), ReconcileOptions{MinAge: 2 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Pending != 5 || report.Checked != 5 || report.Updated != 2 || report.Resend != 1 || report.Failed != 2 || report.Remaining != 0 {
+		t.Errorf("reporte inesperado: %+v", report)
+	}
+	for _, key := range client.queried {
+		if key == "F003-6" {
+			t.Error("un envío más reciente que minAge no debe consultarse")
+		}
+	}
+
+	record := submissionStatus(t, service, accepted)
+	if record.Status != CDRAccepted || record.ReconciledAt == nil || !record.ReconciledAt.Equal(clock.now) {
+		t.Errorf("envío aceptado no actualizado: %+v", record)
+	}
+	if _, err := service.GetStore().Read(record.CDRFile); err != nil {
+		t.Errorf("CDR recuperado no guardado: %v", err)
+	}
+	if record := submissionStatus(t, service, rejected); record.Status != CDRRejected || record.ResponseCode != "2800" {
+		t.Errorf("envío rechazado no actualizado: %+v", record)
+	}
+	if record := submissionStatus(t, service, missing); record.Status != SubmissionResend || record.ResponseCode != SunatCdrNotFound {
+		t.Errorf("el comprobante inexistente debe quedar para reenvío: %+v", record)
+	}
+	if record := submissionStatus(t, service, recent); record.Status != SubmissionSent {
+		t.Errorf("el envío reciente no debe cambiar: %+v", record)
+	}
+
+	// Los que fallaron siguen en ENVIADO y se vuelven a consultar
+	client.queried = nil
+	report, _ = service.ReconcileSubmissions(context.Background(), ReconcileOptions{MinAge: 2 * time.Hour})
+	if report.Pending != 2 || len(client.queried) != 2 {
+		t.Errorf("se esperaba reintentar los 2 fallidos, obtenido %+v %v", report, client.queried)
+	}
+
+	// Un reenvío del comprobante inexistente con respuesta lo saca de REENVIAR
+	client.sendErr = &SunatFault{Code: "soap-env:Client.0111", Message: "No tiene el perfil para enviar comprobantes electronicos"}
+	if resp, _ := service.SendDocument(context.Background(), missing, EnvironmentBeta); resp.ErrorCode != "ERR_SUNAT_REJECTED" {
+		t.Fatalf("se esperaba ERR_SUNAT_REJECTED, obtenido %+v", resp)
+	}
+	if record := submissionStatus(t, service, missing); record.Status != SubmissionResend {
+		t.Errorf("un SOAP Fault debe conservar el registro anterior: %+v", record)
+	}
+}
+
+func TestReconcileBatchAndRate(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	client := &reconcileClient{sendErr: errors.New("timeout"), statuses: map[string]*SunatCDRStatus{}}
+	service := newReconcileService(client, clock)
+
+	// Se envían en orden inverso de número para verificar que se consulta el más antiguo primero
+	for _, number := range []string{"4", "3", "2", "1"} {
+		sendLost(t, service, number)
+		client.statuses["F003-"+number] = &SunatCDRStatus{Code: "0001", CDR: buildCDR("0", "aceptada")}
+		clock.now = clock.now.Add(time.Minute)
+	}
+	clock.now = clock.now.Add(24 * time.Hour)
+
+	start := time.Now()
+	report, err := service.ReconcileSubmissions(context.Background(), ReconcileOptions{MinAge: time.Hour, BatchSize: 3, RequestInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 consultas con 20ms de intervalo tardaron %v", elapsed)
+	}
+	if report.Checked != 3 || report.Remaining != 1 || len(client.queried) != 3 || client.queried[0] != "F003-4" || client.queried[2] != "F003-2" {
+		t.Errorf("lote inesperado: %+v %v", report, client.queried)
+	}
+
+	report, _ = service.ReconcileSubmissions(context.Background(), ReconcileOptions{MinAge: time.Hour, BatchSize: 3})
+	if report.Checked != 1 || report.Remaining != 0 || client.queried[3] != "F003-1" {
+		t.Errorf("el segundo lote debe consultar el pendiente: %+v %v", report, client.queried)
+	}
+
+	// Una ejecución cancelada se detiene entre consultas
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report, _ := service.ReconcileSubmissions(ctx, ReconcileOptions{}); report.Checked != 0 {
+		t.Errorf("una ejecución cancelada no debe consultar: %+v", report)
+	}
+}
+
+func TestReconcileAdminEndpoint(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 8, 0, 0, 0, time.UTC)}
+	service := newMemoryService()
+	service.SetClock(clock)
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{}, clock))
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+	headers := map[string]string{"X-Admin-API-Key": "secreto"}
+
+	// El simulador recibió el comprobante pero la respuesta se perdió
+	documentID := processForSending(t, service, sampleDocument())
+	if resp, _ := service.SendDocument(context.Background(), documentID, ""); resp.Status != "SUCCESS" {
+		t.Fatalf("envío falló: %+v", resp)
+	}
+	lost, _ := json.Marshal(SubmissionRecord{DocumentID: documentID, Environment: EnvironmentMock, SentAt: clock.now, Status: SubmissionSent})
+	service.GetStore().Save(documentID+".mock.envio", lost)
+	clock.now = clock.now.Add(30 * time.Minute)
+
+	if rec := doRequest(router, http.MethodPost, "/api/v1/admin/reconcile?minAge=ayer", headers); rec.Code != http.StatusBadRequest {
+		t.Errorf("minAge inválido: código %d", rec.Code)
+	}
+
+	var resp struct {
+		Data struct {
+			Reconciliation ReconcileReport `json:"reconciliation"`
+		} `json:"data"`
+	}
+	rec := doRequest(router, http.MethodPost, "/api/v1/admin/reconcile", headers)
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp.Data.Reconciliation.Pending != 0 {
+		t.Fatalf("con el minAge por defecto el envío aún no se consulta: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(router, http.MethodPost, "/api/v1/admin/reconcile?minAge=10m&batchSize=5", headers)
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	results := resp.Data.Reconciliation.Results
+	if rec.Code != http.StatusOK || len(results) != 1 || results[0].DocumentID != documentID || results[0].Status != CDRAccepted {
+		t.Fatalf("se esperaba recuperar el CDR del simulador: %d %s", rec.Code, rec.Body.String())
+	}
+}
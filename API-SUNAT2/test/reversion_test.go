@@ -0,0 +1,225 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// reversionLine es una línea del resumen de reversiones firmado, decodificada para las pruebas
+type reversionLine struct {
+	LineID           string `xml:"LineID"`
+	DocumentTypeCode string `xml:"DocumentTypeCode"`
+	Series           string `xml:"DocumentSerialID"`
+	Number           string `xml:"DocumentNumberID"`
+	Reason           string `xml:"VoidReasonDescription"`
+}
+
+func sampleReversion() *ReversionRequest {
+	return &ReversionRequest{
+		RUC:              "20123456786",
+		RegistrationName: "EMPRESA DE PRUEBA SAC",
+		ReferenceDate:    "2024-06-07",
+		Documents: []ReversionDocument{
+			{DocumentType: "20", Series: "R001", Number: "00015", Reason: "Error en el importe retenido"},
+			{DocumentType: "40", Series: "p001", Number: "3", Reason: "Percepción duplicada"},
+		},
+	}
+}
+
+// newReversionService usa un reloj fijo al 2024-06-08 y el mock de SUNAT
+func newReversionService(t *testing.T) *UBLConverterService {
+	t.Helper()
+	clock := &fixedClock{now: time.Date(2024, 6, 8, 9, 0, 0, 0, time.UTC)}
+	service := newMemoryService()
+	service.SetClock(clock)
+	certPEM, keyPEM := loadTestCredentials(t)
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{}, clock))
+	return service
+}
+
+func generateReversion(t *testing.T, service *UBLConverterService, request *ReversionRequest) *APIResponse {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	resp, err := service.GenerateReversion(context.Background(), request, certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("generación del resumen de reversiones falló: %v", err)
+	}
+	return resp
+}
+
+// statusHistory retorna los cambios de estado registrados de un documento
+func statusHistory(t *testing.T, service *UBLConverterService, documentID string) []StatusChange {
+	t.Helper()
+	data, err := service.GetStore().Read(documentID + HistorySuffix)
+	if err != nil {
+		return nil
+	}
+	var history []StatusChange
+	if err := json.Unmarshal(data, &history); err != nil {
+		t.Fatalf("historial inválido de %s: %v", documentID, err)
+	}
+	return history
+}
+
+func TestGenerateReversion(t *testing.T) {
+	service := newReversionService(t)
+
+	resp := generateReversion(t, service, sampleReversion())
+	if resp.Status != "SUCCESS" || resp.DocumentID != "20123456786-RR-20240608-1" || resp.Data["reversionId"] != "RR-20240608-1" {
+		t.Fatalf("resumen de reversiones inesperado: %+v", resp)
+	}
+	if _, err := service.GetStore().Read(resp.DocumentID + ".zip"); err != nil {
+		t.Errorf("no se guardó el ZIP del resumen de reversiones: %v", err)
+	}
+
+	xmlData, err := service.GetStore().Read(resp.DocumentID + ".xml")
+	if err != nil {
+		t.Fatalf("no se guardó el XML del resumen de reversiones: %v", err)
+	}
+	var reversion struct {
+		ID            string          `xml:"ID"`
+		ReferenceDate string          `xml:"ReferenceDate"`
+		IssueDate     string          `xml:"IssueDate"`
+		Lines         []reversionLine `xml:"VoidedDocumentsLine"`
+	}
+	// La firma va antes del elemento raíz: se decodifica desde VoidedDocuments
+	start := strings.Index(string(xmlData), "<VoidedDocuments")
+	if start < 0 || xml.Unmarshal(xmlData[start:], &reversion) != nil {
+		t.Fatalf("XML del resumen de reversiones inválido: %s", xmlData)
+	}
+	if reversion.ID != "RR-20240608-1" || reversion.ReferenceDate != "2024-06-07" || reversion.IssueDate != "2024-06-08" {
+		t.Errorf("cabecera inesperada: %+v", reversion)
+	}
+	want := []reversionLine{
+		{LineID: "1", DocumentTypeCode: "20", Series: "R001", Number: "15", Reason: "Error en el importe retenido"},
+		{LineID: "2", DocumentTypeCode: "40", Series: "P001", Number: "3", Reason: "Percepción duplicada"},
+	}
+	if len(reversion.Lines) != len(want) {
+		t.Fatalf("se esperaban %d líneas, obtenido %+v", len(want), reversion.Lines)
+	}
+	for i, line := range reversion.Lines {
+		if line != want[i] {
+			t.Errorf("línea %d = %+v, esperado %+v", i+1, line, want[i])
+		}
+	}
+
+	// Un resumen que aún no se envía no bloquea a los siguientes
+	if again := generateReversion(t, service, sampleReversion()); again.DocumentID != "20123456786-RR-20240608-2" {
+		t.Errorf("se esperaba un segundo resumen con correlativo 2, obtenido %+v", again)
+	}
+}
+
+func TestGenerateReversionValidation(t *testing.T) {
+	service := newReversionService(t)
+
+	tests := []struct {
+		name   string
+		modify func(*ReversionRequest)
+		code   string
+	}{
+		{"ruc inválido", func(r *ReversionRequest) { r.RUC = "2012345678" }, "ERR_INVALID_RUC"},
+		{"sin razón social", func(r *ReversionRequest) { r.RegistrationName = " " }, "ERR_INVALID_REVERSION"},
+		{"fecha inválida", func(r *ReversionRequest) { r.ReferenceDate = "07/06/2024" }, "ERR_INVALID_DATE"},
+		{"fecha futura", func(r *ReversionRequest) { r.ReferenceDate = "2024-06-09" }, "ERR_INVALID_DATE"},
+		{"sin comprobantes", func(r *ReversionRequest) { r.Documents = nil }, "ERR_REVERSION_EMPTY"},
+		{"factura", func(r *ReversionRequest) { r.Documents[0].DocumentType = "01" }, "ERR_INVALID_REVERSION"},
+		{"serie de percepción en una retención", func(r *ReversionRequest) { r.Documents[0].Series = "P001" }, "ERR_INVALID_REVERSION"},
+		{"número inválido", func(r *ReversionRequest) { r.Documents[0].Number = "123456789" }, "ERR_INVALID_REVERSION"},
+		{"sin motivo", func(r *ReversionRequest) { r.Documents[0].Reason = "" }, "ERR_INVALID_REVERSION"},
+		{"motivo largo", func(r *ReversionRequest) { r.Documents[0].Reason = strings.Repeat("a", MaxReversionReasonLength+1) }, "ERR_INVALID_REVERSION"},
+		{"repetido", func(r *ReversionRequest) { r.Documents[1] = r.Documents[0]; r.Documents[1].Number = "15" }, "ERR_INVALID_REVERSION"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := sampleReversion()
+			tt.modify(request)
+			if resp := generateReversion(t, service, request); resp.ErrorCode != tt.code {
+				t.Errorf("se esperaba %s, obtenido %+v", tt.code, resp)
+			}
+		})
+	}
+}
+
+func TestSendReversionUpdatesStatus(t *testing.T) {
+	service := newReversionService(t)
+	resp := generateReversion(t, service, sampleReversion())
+
+	sent, err := service.SendDocument(context.Background(), resp.DocumentID, "")
+	if err != nil || sent.Status != "SUCCESS" || sent.Data["cdrStatus"] != CDRAccepted || sent.Data["ticket"] == "" {
+		t.Fatalf("envío del resumen de reversiones falló: %v %+v", err, sent)
+	}
+	if !strings.Contains(sent.Data["description"].(string), "Resumen de Reversiones RR-20240608-1") {
+		t.Errorf("descripción del CDR: %v", sent.Data["description"])
+	}
+
+	for documentID, reason := range map[string]string{
+		"20123456786-20-R001-15": "Error en el importe retenido",
+		"20123456786-40-P001-3":  "Percepción duplicada",
+	} {
+		history := statusHistory(t, service, documentID)
+		if len(history) != 1 || history[0].Status != DocumentReverted || history[0].Detail != reason || history[0].Environment != EnvironmentMock {
+			t.Errorf("%s: se esperaba REVERTIDO con el motivo, obtenido %+v", documentID, history)
+		}
+	}
+
+	// Reenviar el resumen no repite el estado
+	service.SendDocument(context.Background(), resp.DocumentID, "")
+	if history := statusHistory(t, service, "20123456786-20-R001-15"); len(history) != 1 {
+		t.Errorf("el reenvío repitió el estado: %+v", history)
+	}
+
+	// Un comprobante revertido no se vuelve a revertir
+	again := sampleReversion()
+	again.Documents = again.Documents[:1]
+	again.Documents[0].Number = "15"
+	if resp := generateReversion(t, service, again); resp.ErrorCode != "ERR_ALREADY_REVERTED" || !strings.Contains(resp.ErrorMessage, "20123456786-RR-20240608-1") {
+		t.Errorf("se esperaba ERR_ALREADY_REVERTED, obtenido %+v", resp)
+	}
+}
+
+func TestGenerateReversionAutoSend(t *testing.T) {
+	service := newReversionService(t)
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+
+	body := convertRequest(t, sampleDocument())
+	delete(body, "document")
+	request := sampleReversion()
+	body["ruc"], body["registrationName"], body["referenceDate"] = request.RUC, request.RegistrationName, request.ReferenceDate
+	body["documents"] = request.Documents
+	body["autoSend"] = true
+
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/reversions", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código HTTP = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	submission, _ := resp.Data["submission"].(map[string]interface{})
+	if resp.Status != "SUCCESS" || resp.DocumentID != "20123456786-RR-20240608-1" || submission["cdrStatus"] != CDRAccepted {
+		t.Fatalf("se esperaba el resumen de reversiones enviado y aceptado, obtenido %s", rec.Body.String())
+	}
+	if history := statusHistory(t, service, "20123456786-40-P001-3"); len(history) != 1 || history[0].Status != DocumentReverted {
+		t.Errorf("el comprobante no quedó revertido: %+v", history)
+	}
+
+	// En v2 los errores de la reversión tienen su código HTTP
+	rec = doJSONRequest(router, http.MethodPost, "/api/v2/reversions", body)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "ERR_ALREADY_REVERTED") {
+		t.Errorf("reversión repetida: código HTTP = %d, esperado 409: %s", rec.Code, rec.Body.String())
+	}
+	body["documents"] = []ReversionDocument{{DocumentType: "01", Series: "F001", Number: "1", Reason: "Error"}}
+	rec = doJSONRequest(router, http.MethodPost, "/api/v2/reversions", body)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_REVERSION") {
+		t.Errorf("factura: código HTTP = %d, esperado 400: %s", rec.Code, rec.Body.String())
+	}
+}
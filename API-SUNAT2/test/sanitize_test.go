@@ -0,0 +1,139 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func TestSanitizeConvertRequest(t *testing.T) {
+	request := &ConvertRequest{Document: *sampleDocument(), Certificate: "Y2VydA==", PrivateKey: "a2V5"}
+	sanitized := SanitizeConvertRequest(request)
+	if sanitized.Certificate != RedactedValue || sanitized.PrivateKey != RedactedValue {
+		t.Errorf("se esperaban los campos sensibles reemplazados: %+v", sanitized)
+	}
+	if request.Certificate != "Y2VydA==" || request.PrivateKey != "a2V5" {
+		t.Error("el request original no debe modificarse")
+	}
+	if sanitized.Document.Issuer.DocumentID != request.Document.Issuer.DocumentID {
+		t.Error("el documento debe conservarse")
+	}
+	if empty := SanitizeConvertRequest(&ConvertRequest{}); empty.Certificate != "" || empty.PrivateKey != "" {
+		t.Errorf("los campos vacíos no se marcan: %+v", empty)
+	}
+}
+
+// TestPrivateKeyCanary envía una conversión con auditoría habilitada y busca el
+// certificado y la clave privada en todo lo que el servicio persiste, registra o envía
+func TestPrivateKeyCanary(t *testing.T) {
+	_, keyPEM := loadTestCredentials(t)
+	certPEM := testCertificate(t, 300, time.Now().AddDate(0, 0, 5))
+
+	var mu sync.Mutex
+	var payloads [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		payloads = append(payloads, body)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	service := newMemoryService()
+	var logs bytes.Buffer
+	service.GetLogger().SetOutput(&logs)
+	service.SetAuditRequests(true)
+	service.SetCertificateNotifiers(NewWebhookNotifier(server.URL, nil))
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+
+	request := map[string]interface{}{
+		"document":    sampleDocument(),
+		"certificate": base64.StdEncoding.EncodeToString(certPEM),
+		"privateKey":  base64.StdEncoding.EncodeToString(keyPEM),
+	}
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", request)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("conversión fallida: %d %s", rec.Code, rec.Body.String())
+	}
+	// Un request inválido también pasa por los logs
+	doJSONRequest(router, http.MethodPost, "/api/v1/convert", map[string]interface{}{
+		"document":   map[string]string{"type": "01"},
+		"privateKey": request["privateKey"],
+	})
+	service.CheckCertificates(context.Background())
+
+	var audit AuditRecord
+	data, err := service.GetStore().Read("20123456786-01-F003-123456" + AuditSuffix)
+	if err != nil {
+		t.Fatalf("se esperaba el request auditado: %v", err)
+	}
+	json.Unmarshal(data, &audit)
+	if audit.Request.PrivateKey != RedactedValue || audit.Request.Certificate != RedactedValue || audit.CorrelationID == "" {
+		t.Errorf("auditoría sin sanear: %s", data)
+	}
+
+	sources := map[string]string{"logs": logs.String()}
+	names, _ := service.GetStore().List()
+	for _, name := range names {
+		content, _ := service.GetStore().Read(name)
+		sources["store:"+name] = string(content)
+	}
+	mu.Lock()
+	if len(payloads) == 0 {
+		t.Error("se esperaba la alerta del certificado por webhook")
+	}
+	for i, payload := range payloads {
+		sources["webhook:"+string(rune('0'+i))] = string(payload)
+	}
+	mu.Unlock()
+
+	// El certificado DER en base64 aparece legítimamente en el KeyInfo de la firma; se
+	// buscan el PEM completo y los valores recibidos en el request
+	canaries := map[string]string{
+		"PRIVATE KEY":             "PRIVATE KEY",
+		"BEGIN CERTIFICATE":       "BEGIN CERTIFICATE",
+		"privateKey del request":  request["privateKey"].(string),
+		"certificate del request": request["certificate"].(string),
+	}
+	for _, line := range strings.Split(string(keyPEM), "\n") {
+		if len(line) >= 32 && !strings.HasPrefix(line, "-----") {
+			canaries["línea de la clave"] = line
+			break
+		}
+	}
+	for source, content := range sources {
+		for name, canary := range canaries {
+			if strings.Contains(content, canary) {
+				t.Errorf("%s contiene %s", source, name)
+			}
+		}
+	}
+}
+
+func TestSigningKeepsCallerKey(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	original := append([]byte(nil), keyPEM...)
+	signer := NewDigitalSignatureService(nil)
+	if _, err := signer.SignXML([]byte(unsignedXML), certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keyPEM, original) {
+		t.Fatal("firmar no debe modificar el PEM del llamador")
+	}
+	if _, err := signer.SignXML([]byte(unsignedXML), certPEM, keyPEM); err != nil {
+		t.Errorf("la clave debe poder reutilizarse: %v", err)
+	}
+}
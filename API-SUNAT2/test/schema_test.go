@@ -0,0 +1,235 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// documentJSON retorna el documento decodificado como JSON genérico, tal como llega al
+// validador estructural
+func documentJSON(t *testing.T, doc interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// publishedSchema descarga el schema desde el endpoint
+func publishedSchema(t *testing.T, query string) *JSONSchema {
+	t.Helper()
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+	rec := doJSONRequest(router, http.MethodGet, "/api/v1/schema/document"+query, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/schema/document%s = %d", query, rec.Code)
+	}
+	var schema JSONSchema
+	if err := json.Unmarshal(rec.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("el schema publicado no es JSON válido: %v", err)
+	}
+	return &schema
+}
+
+func TestDocumentSchemaPublished(t *testing.T) {
+	schema := publishedSchema(t, "")
+	if schema.Schema != JSONSchemaDraft || schema.Title != "BusinessDocument" {
+		t.Errorf("cabecera inesperada: $schema=%q title=%q", schema.Schema, schema.Title)
+	}
+
+	currency := schema.Properties["currency"]
+	if currency == nil || len(currency.Enum) != 3 {
+		t.Errorf("se esperaba el enum de monedas, obtenido %+v", currency)
+	}
+	if ruc := schema.Properties["issuer"].Properties["documentId"]; ruc.Pattern == "" {
+		t.Error("se esperaba el pattern del RUC del emisor")
+	}
+	if date := schema.Properties["issueDate"]; date.Format != "date" {
+		t.Errorf("issueDate.format = %q, esperado date", date.Format)
+	}
+	// Las unidades admiten los códigos mapeados por el emisor: no se publica el enum
+	if unit := schema.Properties["items"].Items.Properties["unitCode"]; len(unit.Enum) != 0 || !strings.Contains(unit.Description, "catálogo 03") {
+		t.Errorf("unitCode publicado: %+v", unit)
+	}
+	if affectation := schema.Properties["items"].Items.Properties["taxes"].Items.Properties["affectationCode"]; len(affectation.Enum) == 0 {
+		t.Error("se esperaba el enum de tipos de afectación del catálogo 07")
+	}
+
+	request := publishedSchema(t, "?request=convert")
+	if request.Title != "ConvertRequest" || request.Properties["document"] == nil {
+		t.Errorf("schema de ConvertRequest inesperado: %+v", request)
+	}
+}
+
+func TestSchemaAgreesWithValidator(t *testing.T) {
+	validator := NewValidationService(nil)
+	published := publishedSchema(t, "")
+
+	cases := []struct {
+		name string
+		edit func(doc *BusinessDocument)
+		rule string
+	}{
+		{"documento válido", func(doc *BusinessDocument) {}, ""},
+		{"boleta con cliente con ubigeo", func(doc *BusinessDocument) {
+			doc.Type, doc.Series = "03", "B001"
+			doc.Customer.Address.Ubigeo = "150101"
+		}, ""},
+		{"moneda fuera del catálogo", func(doc *BusinessDocument) { doc.Currency = "XXX" }, "currency_validation"},
+		{"tipo fuera del catálogo", func(doc *BusinessDocument) { doc.Type = "05" }, "document_type_validation"},
+		{"fecha con otro formato", func(doc *BusinessDocument) { doc.IssueDate = "07/06/2024" }, "date_validation"},
+		{"RUC de otro largo", func(doc *BusinessDocument) { doc.Issuer.DocumentID = "123" }, "ruc_validation"},
+		{"emisor sin ubigeo", func(doc *BusinessDocument) { doc.Issuer.Address.Ubigeo = "" }, "ubigeo_validation"},
+		{"ubigeo del cliente incompleto", func(doc *BusinessDocument) { doc.Customer.Address.Ubigeo = "1501" }, "ubigeo_validation"},
+	}
+
+	for _, tc := range cases {
+		doc := sampleDocument()
+		tc.edit(doc)
+		value := documentJSON(t, doc)
+
+		validatorErrs := validator.ValidateBusinessDocument(doc)
+		for name, schema := range map[string]*JSONSchema{"generado": DocumentSchema(), "publicado": published} {
+			schemaErrs := schema.Validate(value)
+			if tc.rule == "" {
+				if len(schemaErrs) > 0 || len(validatorErrs) > 0 {
+					t.Errorf("%s (%s): se esperaba aceptado, schema=%+v validador=%+v", tc.name, name, schemaErrs, validatorErrs)
+				}
+				continue
+			}
+			if !hasRule(validatorErrs, tc.rule) {
+				t.Errorf("%s: el validador no reportó %s: %+v", tc.name, tc.rule, validatorErrs)
+			}
+			// El schema publicado no lleva las reglas de negocio: basta con que rechace
+			if len(schemaErrs) == 0 || (name == "generado" && !hasRule(schemaErrs, tc.rule)) {
+				t.Errorf("%s (%s): se esperaba rechazo con %s, obtenido %+v", tc.name, name, tc.rule, schemaErrs)
+			}
+		}
+	}
+}
+
+func TestSchemaAcceptsPricesIncludeTax(t *testing.T) {
+	doc := documentJSON(t, sampleDocument()).(map[string]interface{})
+	doc["pricesIncludeTax"] = true
+	delete(doc, "totals")
+	delete(doc, "taxes")
+	doc["items"] = []interface{}{map[string]interface{}{
+		"id": "1", "description": "Producto A", "quantity": 3.0, "unitCode": "NIU", "unitPrice": 10.0,
+	}}
+
+	if errs := DocumentSchema().Validate(doc); len(errs) > 0 {
+		t.Errorf("el schema debe aceptar un documento sin totales con pricesIncludeTax: %+v", errs)
+	}
+
+	// Sin pricesIncludeTax, o con false, los totales siguen siendo obligatorios
+	for _, flag := range []interface{}{nil, false} {
+		if flag == nil {
+			delete(doc, "pricesIncludeTax")
+		} else {
+			doc["pricesIncludeTax"] = flag
+		}
+		errs := DocumentSchema().Validate(doc)
+		if len(errs) != 1 || errs[0].Field != "totals" || errs[0].Message != "Required field is missing" {
+			t.Errorf("pricesIncludeTax=%v: se esperaba el error de totals: %+v", flag, errs)
+		}
+	}
+
+	// El schema publicado declara la condición
+	schema := publishedSchema(t, "")
+	for _, name := range schema.Required {
+		if name == "totals" {
+			t.Error("totals no debe ser obligatorio sin condición")
+		}
+	}
+	if schema.If == nil {
+		t.Fatal("el schema publicado no declara la condición de pricesIncludeTax")
+	}
+	flag := schema.If.Properties["pricesIncludeTax"]
+	if flag == nil || flag.Const != true || schema.Else == nil || len(schema.Else.Required) != 1 || schema.Else.Required[0] != "totals" {
+		t.Errorf("se esperaba totals obligatorio salvo con pricesIncludeTax: if=%+v else=%+v", schema.If, schema.Else)
+	}
+}
+
+func TestStructuralValidationPaths(t *testing.T) {
+	// Con las respuestas de validación unificadas /validate y /convert de v1 responden igual
+	router, _ := api.NewRouterWithService(&config.Config{V1UnifiedValidation: true}, newMemoryService())
+
+	doc := documentJSON(t, sampleDocument()).(map[string]interface{})
+	items := doc["items"].([]interface{})
+	for len(items) < 4 {
+		items = append(items, documentJSON(t, sampleDocument().Items[0]))
+	}
+	items[0].(map[string]interface{})["quantity"] = "dos"
+	delete(doc["totals"].(map[string]interface{}), "payableAmount")
+	doc["items"] = items
+
+	want := map[string]string{
+		"items[0].quantity":    SchemaValidationRule,
+		"totals.payableAmount": SchemaValidationRule,
+	}
+
+	request := convertRequest(t, sampleDocument())
+	request["document"] = doc
+	for path, body := range map[string]interface{}{"/api/v1/validate": doc, "/api/v1/convert": request} {
+		rec := doJSONRequest(router, http.MethodPost, path, body)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: código HTTP = %d, esperado 422: %s", path, rec.Code, rec.Body.String())
+		}
+		var resp APIResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.ErrorCode != ValidationFailedCode || len(resp.ValidationErrors) != len(want) {
+			t.Errorf("%s: se esperaban %d errores, obtenido %+v", path, len(want), resp.ValidationErrors)
+		}
+		for _, e := range resp.ValidationErrors {
+			if want[e.Field] != e.Rule {
+				t.Errorf("%s: error inesperado %+v", path, e)
+			}
+		}
+	}
+
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", map[string]interface{}{"certificate": "", "privateKey": ""})
+	var resp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if len(resp.ValidationErrors) != 1 || resp.ValidationErrors[0].Field != "document" {
+		t.Errorf("se esperaba el error del documento faltante, obtenido %d %+v", rec.Code, resp.ValidationErrors)
+	}
+}
+
+func TestPublishedSchemaAcceptsMappedUnits(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+	if rec := putUnitMappings(t, router, "20123456786", map[string]string{"CAJ": "BX"}); rec.Code != http.StatusOK {
+		t.Fatalf("registro del mapeo: código %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// El servicio acepta la unidad del ERP mapeada por el emisor...
+	doc := sampleDocument()
+	doc.Items[0].UnitCode = "CAJ"
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/validate", doc)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/validate con la unidad mapeada: código %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// ...y el schema publicado, con que el integrador valida antes de enviar, también
+	rec = doJSONRequest(router, http.MethodGet, "/api/v1/schema/document", nil)
+	var published JSONSchema
+	if err := json.Unmarshal(rec.Body.Bytes(), &published); err != nil {
+		t.Fatal(err)
+	}
+	if errs := published.Validate(documentJSON(t, doc)); len(errs) > 0 {
+		t.Errorf("el schema publicado rechaza la unidad mapeada: %+v", errs)
+	}
+}
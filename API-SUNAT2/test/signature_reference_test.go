@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "API-SUNAT2/service"
+)
+
+func TestSignatureReferenceStyles(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	unsigned := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Invoice Id=\"F001-1\"><ID>F001-1</ID></Invoice>"
+	signer := NewDigitalSignatureService(nil)
+
+	cases := []struct {
+		name, uri string
+	}{
+		{"documento completo", ""},
+		{"referencia por Id", "#F001-1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := signer.SignReference([]byte(unsigned), certPEM, keyPEM, tc.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed := string(result.SignedXML)
+			if !strings.Contains(signed, `<ds:Reference URI="`+tc.uri+`">`) {
+				t.Fatalf("se esperaba la referencia %q", tc.uri)
+			}
+			results, err := signer.VerifySignatures(result.SignedXML)
+			if err != nil || len(results) != 1 || !results[0].Valid {
+				t.Fatalf("la firma debe verificarse: %+v %v", results, err)
+			}
+			tampered := strings.Replace(signed, "<ID>F001-1</ID>", "<ID>F001-2</ID>", 1)
+			if results, _ := signer.VerifySignatures([]byte(tampered)); results[0].Valid {
+				t.Error("alterar el elemento firmado debe invalidar la firma")
+			}
+		})
+	}
+
+	if _, err := signer.SignReference([]byte(unsigned), certPEM, keyPEM, "#F001-9"); err == nil {
+		t.Error("se esperaba error con un Id inexistente")
+	}
+}
+
+func TestPipelineSignsByRootID(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetIDReferenceIssuers([]string{"20123456786"})
+	pipeline := service.NewDefaultPipeline()
+	pipeline.SetWriter(nil)
+
+	doc := sampleDocument()
+	id := doc.Series + "-" + doc.Number
+	ctx, err := pipeline.Run(context.Background(), doc, certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := string(ctx.XML)
+	if RootElementID(ctx.XML) != id || !strings.Contains(signed, `<ds:Reference URI="#`+id+`">`) {
+		t.Fatalf("se esperaba el Id en el elemento raíz y la referencia a él")
+	}
+
+	signer := service.GetSigner()
+	if results, err := signer.VerifySignatures(ctx.XML); err != nil || !results[0].Valid {
+		t.Fatalf("la firma por Id debe verificarse: %+v %v", results, err)
+	}
+
+	// El OSE puede agregar su firma sobre el documento completo; ambas se verifican
+	operator, err := signer.SignXML(ctx.XML, testCertificate(t, 79, time.Now().AddDate(1, 0, 0)), keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := signer.VerifySignatures(operator)
+	if err != nil || len(results) != 2 || !results[0].Valid || !results[1].Valid {
+		t.Fatalf("se esperaban ambas firmas válidas: %+v %v", results, err)
+	}
+
+	// Los demás emisores siguen firmando sobre el documento completo
+	doc = sampleDocument()
+	doc.Issuer.DocumentID = "20123456794"
+	ctx, err = pipeline.Run(context.Background(), doc, certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if RootElementID(ctx.XML) != "" || !strings.Contains(string(ctx.XML), `<ds:Reference URI="">`) {
+		t.Error("un emisor sin configurar debe firmar con la referencia vacía")
+	}
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "API-SUNAT2/service"
+)
+
+// signedByIssuer retorna el XML de la factura de ejemplo firmado por el emisor
+func signedByIssuer(t *testing.T) []byte {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	pipeline := newMemoryService().NewDefaultPipeline()
+	pipeline.SetWriter(nil)
+	ctx, err := pipeline.Run(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx.XML
+}
+
+func TestSecondSignatureKeepsOriginal(t *testing.T) {
+	_, keyPEM := loadTestCredentials(t)
+	issuerXML := signedByIssuer(t)
+	operatorCert := testCertificate(t, 77, time.Now().AddDate(1, 0, 0))
+
+	signer := NewDigitalSignatureService(nil)
+	signed, err := signer.SignXML(issuerXML, operatorCert, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(signed), string(issuerXML[:strings.Index(string(issuerXML), "</ext:UBLExtension>")])) {
+		t.Error("la firma del emisor debe conservarse sin cambios")
+	}
+	if n := strings.Count(string(signed), "<ext:UBLExtension>"); n != 2 {
+		t.Fatalf("se esperaban 2 extensiones de firma, hay %d", n)
+	}
+
+	results, err := signer.VerifySignatures(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || !results[0].Valid || !results[1].Valid {
+		t.Fatalf("se esperaban ambas firmas válidas: %+v", results)
+	}
+	if results[0].SerialNumber == results[1].SerialNumber || results[1].SerialNumber != "77" {
+		t.Errorf("cada firma debe reportar su certificado: %+v", results)
+	}
+
+	// Alterar la segunda firma no afecta a la del emisor
+	tampered := strings.Replace(string(signed), "<ds:SignatureValue>", "<ds:SignatureValue>AAAA", 2)
+	tampered = strings.Replace(tampered, "<ds:SignatureValue>AAAA", "<ds:SignatureValue>", 1)
+	results, _ = signer.VerifySignatures([]byte(tampered))
+	if !results[0].Valid || results[1].Valid {
+		t.Errorf("solo la segunda firma debe ser inválida: %+v", results)
+	}
+
+	// Alterar el contenido invalida ambas
+	results, _ = signer.VerifySignatures([]byte(strings.Replace(string(signed), "RODRIGO S.A.C", "OTRO S.A.C", 1)))
+	if results[0].Valid || results[1].Valid || results[0].Error != "digest does not match the signed content" {
+		t.Errorf("alterar el documento debe invalidar ambas firmas: %+v", results)
+	}
+}
+
+func TestReplaceSignatures(t *testing.T) {
+	_, keyPEM := loadTestCredentials(t)
+	signer := NewDigitalSignatureService(nil)
+	signer.SetReplaceSignatures(true)
+
+	signed, err := signer.SignXML(signedByIssuer(t), testCertificate(t, 78, time.Now().AddDate(1, 0, 0)), keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := signer.VerifySignatures(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].Valid || results[0].SerialNumber != "78" {
+		t.Errorf("re-firmar debe dejar solo la firma nueva: %+v", results)
+	}
+}
+
+func TestSignDocumentWithoutExtensions(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	signer := NewDigitalSignatureService(nil)
+	signed, err := signer.SignXML([]byte(unsignedXML), certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(signed), "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Invoice>\n  <ext:UBLExtensions>") {
+		t.Errorf("las extensiones deben ir dentro del elemento raíz:\n%s", signed[:120])
+	}
+	if results, err := signer.VerifySignatures(signed); err != nil || !results[0].Valid {
+		t.Errorf("firma inválida: %v %+v", err, results)
+	}
+	if _, err := signer.VerifySignatures([]byte(unsignedXML)); err == nil {
+		t.Error("un XML sin firmas debe ser error")
+	}
+}
+
+func TestSignInsertsExtensionsInEachRoot(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	signer := NewDigitalSignatureService(nil)
+
+	roots := map[string]string{
+		"Invoice":          "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2",
+		"CreditNote":       "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2",
+		"DebitNote":        "urn:oasis:names:specification:ubl:schema:xsd:DebitNote-2",
+		"DespatchAdvice":   "urn:oasis:names:specification:ubl:schema:xsd:DespatchAdvice-2",
+		"SummaryDocuments": "urn:sunat:names:specification:ubl:peru:schema:xsd:SummaryDocuments-1",
+		"VoidedDocuments":  "urn:sunat:names:specification:ubl:peru:schema:xsd:VoidedDocuments-1",
+	}
+	for root, namespace := range roots {
+		open := `<` + root + ` xmlns="` + namespace + `" xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">`
+		bodies := map[string]string{
+			"con contenido":  open + "\n  <cbc:ID>1</cbc:ID>\n</" + root + ">",
+			"vacío":          strings.TrimSuffix(open, ">") + "/>",
+			"con comentario": "<!-- generado por el ERP -->\n" + open + "<cbc:ID>1</cbc:ID></" + root + ">",
+		}
+		for name, body := range bodies {
+			signed, err := signer.SignXML([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"+body), certPEM, keyPEM)
+			if err != nil {
+				t.Errorf("%s %s: %v", root, name, err)
+				continue
+			}
+			// El bloque de extensiones es el primer hijo del elemento raíz
+			rest := string(signed)[strings.Index(string(signed), open[:len(open)-1]):]
+			rest = strings.TrimLeft(rest[strings.Index(rest, ">")+1:], " \n")
+			if !strings.HasPrefix(rest, "<ext:UBLExtensions>") || !strings.HasSuffix(string(signed), "</"+root+">") {
+				t.Errorf("%s %s: extensiones fuera de lugar:\n%s", root, name, signed)
+			}
+			if results, err := signer.VerifySignatures(signed); err != nil || !results[0].Valid {
+				t.Errorf("%s %s: firma inválida: %v %+v", root, name, err, results)
+			}
+		}
+	}
+
+	// Un XML realmente malformado reporta el elemento raíz detectado
+	_, err := signer.SignXML([]byte("<DespatchAdvice><cbc:ID>1</DespatchAdvice>"), certPEM, keyPEM)
+	if err == nil || !strings.Contains(err.Error(), "root element DespatchAdvice") {
+		t.Errorf("se esperaba el elemento raíz en el error: %v", err)
+	}
+	if _, err := signer.SignXML([]byte("<?xml version=\"1.0\"?>\n<!-- vacío -->"), certPEM, keyPEM); err == nil || !strings.Contains(err.Error(), "root element not") {
+		t.Errorf("se esperaba error por falta de elemento raíz: %v", err)
+	}
+}
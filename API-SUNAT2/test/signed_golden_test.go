@@ -0,0 +1,133 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// deterministicService retorna un servicio que firma con las credenciales fijas de
+// testdata/signing y con el reloj fijo
+func deterministicService(t *testing.T) *UBLConverterService {
+	t.Helper()
+	certPEM, err := os.ReadFile(filepath.Join("testdata", "signing", "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := os.ReadFile(filepath.Join("testdata", "signing", "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := newMemoryService()
+	service.SetClock(&fixedClock{now: time.Date(2024, 6, 7, 10, 30, 0, 0, time.UTC)})
+	if err := service.GetSigner().SetDeterministic(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+// signedXML procesa el documento y retorna el XML firmado que quedó en el store
+func signedXML(t *testing.T, service *UBLConverterService, doc *BusinessDocument, certPEM, keyPEM []byte) []byte {
+	t.Helper()
+	response, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil || response.Status != "SUCCESS" {
+		t.Fatalf("procesamiento falló: %+v %v", response, err)
+	}
+	xmlData, err := service.GetStore().Read(response.DocumentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return xmlData
+}
+
+// assertSignedGolden compara el XML firmado completo contra testdata/golden; con
+// -update lo regenera
+func assertSignedGolden(t *testing.T, name string, actual []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name+".xml")
+	if *updateGolden {
+		if err := os.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("no se pudo leer el golden file %s (ejecutar con -update para crearlo): %v", path, err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("el XML firmado de %s cambió (ejecutar con -update si el cambio es intencional).\nesperado:\n%s\nobtenido:\n%s", name, expected, actual)
+	}
+}
+
+func TestSignedXMLGolden(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	cases := []struct {
+		name string
+		doc  *BusinessDocument
+	}{
+		{"signed_invoice", sampleDocument()},
+		{"signed_boleta", sampleBoleta("1")},
+		{"signed_credit_note", sampleCreditNote("07", 1)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertSignedGolden(t, tc.name, signedXML(t, deterministicService(t), tc.doc, certPEM, keyPEM))
+		})
+	}
+}
+
+func TestDeterministicSigning(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	first := signedXML(t, deterministicService(t), sampleDocument(), certPEM, keyPEM)
+
+	// Un certificado regenerado en el request no cambia el resultado
+	regenerated := testCertificate(t, 99, time.Now().AddDate(1, 0, 0))
+	if second := signedXML(t, deterministicService(t), sampleDocument(), regenerated, keyPEM); !bytes.Equal(first, second) {
+		t.Error("el XML firmado debe ser idéntico byte a byte")
+	}
+
+	// La TSA no se consulta: su sello cambiaría en cada firma
+	service := deterministicService(t)
+	service.GetSigner().SetTimestampAuthority(&mockTSA{t: t, fail: true}, true)
+	if third := signedXML(t, service, sampleDocument(), certPEM, keyPEM); !bytes.Equal(first, third) {
+		t.Error("con TSA configurada el XML firmado debe ser el mismo")
+	}
+
+	// Desactivado se vuelve a firmar con el certificado del request
+	service = deterministicService(t)
+	service.GetSigner().SetDeterministic(nil, nil)
+	if cert := signingCertificate(t, signedXML(t, service, sampleDocument(), regenerated, keyPEM)); cert.Subject.CommonName != "Certificado de prueba 99" {
+		t.Errorf("se esperaba el certificado del request, se firmó con %q", cert.Subject.CommonName)
+	}
+}
+
+func TestDeterministicSigningNotInProduction(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	signer := NewDigitalSignatureService(nil)
+	signer.SetCertificatePolicy(EnvironmentProduction, nil)
+	if err := signer.SetDeterministic(certPEM, keyPEM); err == nil {
+		t.Error("no se debe activar en producción")
+	}
+
+	// Activado antes de cambiar a producción tampoco firma
+	signer = NewDigitalSignatureService(nil)
+	if err := signer.SetDeterministic(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	signer.SetCertificatePolicy(EnvironmentProduction, nil)
+	xmlData, _ := NewUBLConverter(nil).ConvertToUBL(sampleDocument())
+	if _, err := signer.Sign(xmlData, certPEM, keyPEM); err == nil {
+		t.Error("no se debe firmar en producción con las credenciales de prueba")
+	}
+
+	if err := NewDigitalSignatureService(nil).SetDeterministic(testCertificate(t, 1, time.Now().AddDate(1, 0, 0)), []byte("no es PEM")); err == nil {
+		t.Error("se esperaba error con una clave inválida")
+	}
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+)
+
+const unsignedXML = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Invoice></Invoice>"
+
+func TestSignerKeyValidation(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		keyPEM   []byte
+		code     string
+		contains string
+	}{
+		{"RSA 2048", keyPEM, "", ""},
+		{"RSA 1024", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsa1024)}), "ERR_KEY_TOO_SMALL", "1024 bits"},
+		{"EC P-256", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}), "ERR_KEY_TYPE_UNSUPPORTED", "ecdsa"},
+	}
+
+	signer := NewDigitalSignatureService(nil)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := signer.SignXML([]byte(unsignedXML), certPEM, tc.keyPEM)
+			if tc.code == "" {
+				if err != nil {
+					t.Fatalf("no se esperaba error: %v", err)
+				}
+				return
+			}
+			var keyErr *KeyValidationError
+			if !errors.As(err, &keyErr) || keyErr.Code != tc.code {
+				t.Fatalf("se esperaba %s, se obtuvo %v", tc.code, err)
+			}
+			if !strings.Contains(keyErr.Message, tc.contains) {
+				t.Fatalf("el mensaje debe indicar %q: %s", tc.contains, keyErr.Message)
+			}
+		})
+	}
+}
+
+func TestSignerMinRSABitsConfigurable(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	signer := NewDigitalSignatureService(nil)
+	signer.SetMinRSABits(4096)
+
+	_, err := signer.SignXML([]byte(unsignedXML), certPEM, keyPEM)
+	var keyErr *KeyValidationError
+	if !errors.As(err, &keyErr) || keyErr.Code != "ERR_KEY_TOO_SMALL" {
+		t.Fatalf("se esperaba ERR_KEY_TOO_SMALL con mínimo 4096, se obtuvo %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// newSOAPTraceService retorna un servicio que envía por SOAP a un servidor de prueba
+// que responde con un CDR aceptado
+func newSOAPTraceService(t *testing.T, opts SOAPTraceOptions) *UBLConverterService {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/"><soap-env:Body><br:sendBillResponse xmlns:br="http://service.sunat.gob.pe"><applicationResponse>`+
+			base64.StdEncoding.EncodeToString(buildCDR("0", "aceptado"))+`</applicationResponse></br:sendBillResponse></soap-env:Body></soap-env:Envelope>`)
+	}))
+	t.Cleanup(server.Close)
+
+	service := newMemoryService()
+	service.SetSunatRouter(NewSunatRouter(SunatCredentials{
+		"*": {EnvironmentBeta: {URL: server.URL, Username: "20123456786MODDATOS", Password: "clave-sol-secreta"}},
+	}, func(endpoint SunatEndpoint) SunatClient {
+		return NewSOAPSunatClient(endpoint, nil)
+	}), EnvironmentBeta)
+	opts.Enabled = true
+	service.SetSOAPTrace(opts)
+	return service
+}
+
+func decodeSOAPTraces(t *testing.T, body []byte) []SOAPTrace {
+	t.Helper()
+	var resp APIResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	var traces []SOAPTrace
+	if err := json.Unmarshal([]byte(mustJSON(t, resp.Data["traces"])), &traces); err != nil {
+		t.Fatal(err)
+	}
+	return traces
+}
+
+func TestSOAPTraceRedactsCredentials(t *testing.T) {
+	service := newSOAPTraceService(t, SOAPTraceOptions{})
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+
+	documentID := processForSending(t, service, sampleDocument())
+	if resp, err := service.SendDocument(context.Background(), documentID, ""); err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("envío falló: %v %+v", err, resp)
+	}
+
+	path := "/api/v1/documents/" + documentID + "/soap-trace"
+	if rec := doRequest(router, http.MethodGet, path, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("sin API key de admin: se esperaba 401, obtenido %d", rec.Code)
+	}
+	rec := doRequest(router, http.MethodGet, path, map[string]string{"X-Admin-API-Key": "secreto"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("se esperaba 200, obtenido %d: %s", rec.Code, rec.Body.String())
+	}
+	traces := decodeSOAPTraces(t, rec.Body.Bytes())
+	if len(traces) != 1 {
+		t.Fatalf("se esperaba una traza, obtenido %+v", traces)
+	}
+	trace := traces[0]
+	if trace.Operation != "sendBill" || trace.Environment != EnvironmentBeta || trace.HTTPStatus != http.StatusOK {
+		t.Errorf("traza inesperada: %+v", trace)
+	}
+	if strings.Contains(trace.Request, "clave-sol-secreta") || strings.Contains(trace.Request, "20123456786MODDATOS") {
+		t.Errorf("la traza no debe contener las credenciales: %s", trace.Request)
+	}
+	if !strings.Contains(trace.Request, "<wsse:Password>[REDACTED]</wsse:Password>") || !strings.Contains(trace.Request, "<fileName>"+documentID+".zip</fileName>") {
+		t.Errorf("la petición debe conservarse con las credenciales redactadas: %s", trace.Request)
+	}
+	if !strings.Contains(trace.Response, "<applicationResponse>") || trace.RequestTruncated || trace.ResponseTruncated {
+		t.Errorf("la respuesta debe guardarse completa: %+v", trace)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/v1/documents/20123456786-01-F003-999999/soap-trace", map[string]string{"X-Admin-API-Key": "secreto"})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("un documento sin trazas: se esperaba 404, obtenido %d", rec.Code)
+	}
+}
+
+func TestRedactSOAPCredentialsAnyPrefix(t *testing.T) {
+	redacted := RedactSOAPCredentials([]byte(`<o:UsernameToken><o:Username>USUARIO</o:Username><o:Password Type="PasswordText">clave</o:Password></o:UsernameToken>`))
+	if redacted != `<o:UsernameToken><o:Username>[REDACTED]</o:Username><o:Password Type="PasswordText">[REDACTED]</o:Password></o:UsernameToken>` {
+		t.Errorf("credenciales sin redactar: %s", redacted)
+	}
+}
+
+func TestSOAPTraceSizeLimitAndRetention(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	service := newSOAPTraceService(t, SOAPTraceOptions{MaxBytes: 600, Retention: 24 * time.Hour})
+	service.SetClock(clock)
+
+	documentID := processForSending(t, service, sampleDocument())
+	if resp, err := service.SendDocument(context.Background(), documentID, ""); err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("envío falló: %v %+v", err, resp)
+	}
+	traces, err := service.SOAPTraces(documentID)
+	if err != nil || len(traces) != 1 {
+		t.Fatalf("se esperaba una traza: %+v %v", traces, err)
+	}
+	trace := traces[0]
+	if len(trace.Request)+len(trace.Response) > 600 || !trace.RequestTruncated || !trace.ResponseTruncated {
+		t.Errorf("la traza debe recortarse a 600 bytes: %d+%d %+v", len(trace.Request), len(trace.Response), trace)
+	}
+	if strings.Contains(trace.Request, "clave-sol-secreta") {
+		t.Errorf("el recorte no debe exponer las credenciales: %s", trace.Request)
+	}
+
+	clock.now = clock.now.Add(25 * time.Hour)
+	if purged, err := service.PurgeSOAPTraces(); err != nil || purged != 1 {
+		t.Fatalf("la traza vencida debe purgarse: %d %v", purged, err)
+	}
+	if _, err := service.GetStore().Read(SOAPTraceName(documentID, EnvironmentBeta)); err == nil {
+		t.Error("el archivo de trazas vacío debe eliminarse")
+	}
+}
@@ -0,0 +1,175 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	"API-SUNAT2/storage"
+)
+
+// unmountedStore simula un volumen que se desmonta: mientras down está activo todas
+// las operaciones fallan con EIO, como el FileStore sobre un NFS caído
+type unmountedStore struct {
+	*storage.MemoryStore
+	down atomic.Bool
+}
+
+func newUnmountedStore() *unmountedStore {
+	return &unmountedStore{MemoryStore: storage.NewMemoryStore()}
+}
+
+func (s *unmountedStore) fail(op, name string) error {
+	return &fs.PathError{Op: op, Path: "/mnt/nfs/xml_output/" + name, Err: syscall.EIO}
+}
+
+func (s *unmountedStore) Save(name string, data []byte) (string, error) {
+	if s.down.Load() {
+		return "", s.fail("open", name)
+	}
+	return s.MemoryStore.Save(name, data)
+}
+
+func (s *unmountedStore) Read(name string) ([]byte, error) {
+	if s.down.Load() {
+		return nil, s.fail("open", name)
+	}
+	return s.MemoryStore.Read(name)
+}
+
+func (s *unmountedStore) List() ([]string, error) {
+	if s.down.Load() {
+		return nil, s.fail("readdirent", ".")
+	}
+	return s.MemoryStore.List()
+}
+
+// rejectingStore falla con un error que no es de I/O
+type rejectingStore struct{ *storage.MemoryStore }
+
+func (s rejectingStore) Save(name string, data []byte) (string, error) {
+	return "", errors.New("artifact name not allowed")
+}
+
+func TestFailoverStoreWritesToSecondaryWhilePrimaryIsDown(t *testing.T) {
+	primary, secondary := newUnmountedStore(), storage.NewMemoryStore()
+	store := storage.NewFailoverStore(primary, secondary)
+
+	if _, err := store.Save("a.xml", []byte("a")); err != nil || store.Location("a.xml") != storage.LocationPrimary {
+		t.Fatalf("con el principal disponible se escribe ahí: %v", err)
+	}
+
+	primary.down.Store(true)
+	if _, err := store.Save("b.xml", []byte("b")); err != nil {
+		t.Fatalf("la escritura debe ir al secundario: %v", err)
+	}
+	if store.Location("b.xml") != storage.LocationSecondary {
+		t.Error("b.xml debe quedar en el secundario")
+	}
+	if data, err := store.Read("b.xml"); err != nil || string(data) != "b" {
+		t.Errorf("lectura desde el secundario: %q %v", data, err)
+	}
+	if names, err := store.List(); err != nil || len(names) != 1 || names[0] != "b.xml" {
+		t.Errorf("con el principal caído se listan los del secundario: %v %v", names, err)
+	}
+	status := store.Status()
+	if status.Mode != storage.LocationSecondary || status.Pending != 1 || status.LastError == "" {
+		t.Errorf("estado: %+v", status)
+	}
+
+	// Mientras el principal siga caído la re-sincronización no mueve nada
+	if moved, err := store.Resync(); err == nil || len(moved) != 0 {
+		t.Errorf("se esperaba error con el principal caído: %v %v", moved, err)
+	}
+
+	primary.down.Store(false)
+	if moved, err := store.Resync(); err != nil || len(moved) != 1 {
+		t.Fatalf("re-sincronización: %v %v", moved, err)
+	}
+	if data, err := primary.Read("b.xml"); err != nil || string(data) != "b" {
+		t.Errorf("b.xml debe estar en el principal: %q %v", data, err)
+	}
+	if names, _ := secondary.List(); len(names) != 0 {
+		t.Errorf("el secundario debe quedar vacío: %v", names)
+	}
+	if status := store.Status(); status.Mode != storage.LocationPrimary || status.Pending != 0 {
+		t.Errorf("estado después de re-sincronizar: %+v", status)
+	}
+
+	// Un error que no es de I/O no activa la contingencia
+	strict := storage.NewFailoverStore(rejectingStore{storage.NewMemoryStore()}, secondary)
+	if _, err := strict.Save("c.xml", []byte("c")); err == nil || strict.Status().Mode != storage.LocationPrimary {
+		t.Errorf("se esperaba el error del principal: %v %+v", err, strict.Status())
+	}
+}
+
+func TestConvertDuringStorageOutage(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	primary := newUnmountedStore()
+	service := newMemoryService()
+	service.SetStore(storage.NewFailoverStore(primary, storage.NewMemoryStore()))
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+
+	storageMode := func() string {
+		var health struct {
+			Storage storage.FailoverStatus `json:"storage"`
+		}
+		rec := doRequest(router, http.MethodGet, "/health", nil)
+		json.Unmarshal(rec.Body.Bytes(), &health)
+		return health.Storage.Mode
+	}
+	if mode := storageMode(); mode != storage.LocationPrimary {
+		t.Errorf("modo inicial: %s", mode)
+	}
+
+	primary.down.Store(true)
+	resp, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("el documento debe guardarse en contingencia: %v %+v", err, resp)
+	}
+	if !hasRule(resp.Warnings, "storage_failover") || resp.Data["storageLocation"] != storage.LocationSecondary {
+		t.Errorf("se esperaba la alerta de contingencia: %+v %v", resp.Warnings, resp.Data)
+	}
+	record := readDocumentRecord(t, service.GetStore(), resp.DocumentID)
+	if record.StorageLocation != storage.LocationSecondary {
+		t.Errorf("el registro debe indicar el directorio de contingencia: %+v", record)
+	}
+	if mode := storageMode(); mode != storage.LocationSecondary {
+		t.Errorf("el health debe reportar el modo de contingencia: %s", mode)
+	}
+
+	primary.down.Store(false)
+	if moved, err := service.ResyncStorage(); err != nil || moved == 0 {
+		t.Fatalf("re-sincronización: %d %v", moved, err)
+	}
+	if _, err := primary.Read(resp.DocumentID + ".xml"); err != nil {
+		t.Errorf("el XML debe estar en el principal: %v", err)
+	}
+	if record := readDocumentRecord(t, primary, resp.DocumentID); record.StorageLocation != "" {
+		t.Errorf("la marca de contingencia debe quitarse al re-sincronizar: %+v", record)
+	}
+	if mode := storageMode(); mode != storage.LocationPrimary {
+		t.Errorf("modo después de re-sincronizar: %s", mode)
+	}
+}
+
+func readDocumentRecord(t *testing.T, store storage.DocumentStore, documentID string) DocumentRecord {
+	t.Helper()
+	var record DocumentRecord
+	data, err := store.Read(documentID + ".meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
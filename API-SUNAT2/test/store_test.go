@@ -0,0 +1,41 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"API-SUNAT2/storage"
+)
+
+func TestFileStoreNamesWithSeparators(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "store")
+	if err := os.Mkdir(basePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewFileStore(basePath)
+
+	name := "../20123456786-01-F001-1.xml"
+	path, err := store.Save(name, []byte("<Invoice/>"))
+	if err != nil {
+		t.Fatalf("Save falló: %v", err)
+	}
+	if want := filepath.Join(basePath, "20123456786-01-F001-1.xml"); path != want || store.Path(name) != want {
+		t.Errorf("ruta %s, esperado %s", path, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20123456786-01-F001-1.xml")); !os.IsNotExist(err) {
+		t.Errorf("Save escribió fuera del directorio del store: %v", err)
+	}
+
+	// Read y Delete encuentran el archivo que guardó Save
+	if data, err := store.Read(name); err != nil || string(data) != "<Invoice/>" {
+		t.Errorf("Read: %q %v", data, err)
+	}
+	if err := store.Delete(name); err != nil {
+		t.Fatalf("Delete falló: %v", err)
+	}
+	if names, _ := store.List(); len(names) != 0 {
+		t.Errorf("el archivo no se eliminó: %v", names)
+	}
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// typoDocument retorna el documento de ejemplo con dos líneas y un campo mal escrito en
+// la primera ("descripcion" junto a description)
+func typoDocument(t *testing.T) map[string]interface{} {
+	t.Helper()
+	doc := documentJSON(t, sampleDocument()).(map[string]interface{})
+	items := doc["items"].([]interface{})
+	items = append(items, documentJSON(t, sampleDocument().Items[0]))
+	items[0].(map[string]interface{})["descripcion"] = "Producto A"
+	doc["items"] = items
+	return doc
+}
+
+func TestUnknownFieldsPaths(t *testing.T) {
+	doc := typoDocument(t)
+	second := doc["items"].([]interface{})[1].(map[string]interface{})
+	second["unitcode"] = second["unitCode"]
+	delete(second, "unitCode")
+	doc["customer"].(map[string]interface{})["address"].(map[string]interface{})["ubigeoo"] = "150101"
+
+	fields := DocumentSchema().UnknownFields(doc)
+	want := map[string]string{
+		"customer.address.ubigeoo": "Field declared in the document schema",
+		"items[0].descripcion":     "Field declared in the document schema",
+		"items[1].unitcode":        "unitCode",
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("se esperaban %d campos desconocidos, obtenido %+v", len(want), fields)
+	}
+	for _, field := range fields {
+		if field.Rule != UnknownFieldRule || want[field.Field] != field.Expected {
+			t.Errorf("campo desconocido inesperado: %+v", field)
+		}
+	}
+
+	// Los documentos dentro del request de /convert se reportan relativos al documento
+	request := map[string]interface{}{"document": doc, "certificado": ""}
+	fields = ConvertRequestSchema().UnknownFields(request)
+	if len(fields) != len(want)+1 || fields[0].Field != "certificado" {
+		t.Errorf("se esperaban los campos del request y del documento, obtenido %+v", fields)
+	}
+}
+
+func TestStrictParsingRejectsUnknownFields(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cfg    *config.Config
+		query  string
+		strict bool
+	}{
+		{"por config", &config.Config{StrictParsing: true}, "", true},
+		{"por query", &config.Config{}, "?strictParsing=true", true},
+		{"query desactiva el config", &config.Config{StrictParsing: true}, "?strictParsing=false", false},
+	} {
+		router, _ := api.NewRouterWithService(tc.cfg, newMemoryService())
+		doc := typoDocument(t)
+		request := convertRequest(t, sampleDocument())
+		request["document"] = doc
+
+		for path, body := range map[string]interface{}{"/api/v1/validate": doc, "/api/v1/convert": request, "/api/v2/convert": request} {
+			rec := doJSONRequest(router, http.MethodPost, path+tc.query, body)
+			var resp map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if !tc.strict {
+				if rec.Code != http.StatusOK {
+					t.Errorf("%s %s: código HTTP = %d, esperado 200: %s", tc.name, path, rec.Code, rec.Body.String())
+				}
+				continue
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s %s: código HTTP = %d, esperado 400: %s", tc.name, path, rec.Code, rec.Body.String())
+				continue
+			}
+
+			code, details := resp["errorCode"], resp["validationErrors"]
+			if errObj, ok := resp["error"].(map[string]interface{}); ok {
+				code, details = errObj["code"], errObj["details"]
+			}
+			fields, _ := details.([]interface{})
+			if code != UnknownFieldCode || len(fields) != 1 || fields[0].(map[string]interface{})["field"] != "items[0].descripcion" {
+				t.Errorf("%s %s: se esperaba ERR_UNKNOWN_FIELD en items[0].descripcion, obtenido %s", tc.name, path, rec.Body.String())
+			}
+		}
+	}
+}
+
+func TestLenientParsingWarnsUnknownFields(t *testing.T) {
+	router, _ := api.NewRouterWithService(&config.Config{}, newMemoryService())
+
+	request := convertRequest(t, sampleDocument())
+	request["document"] = typoDocument(t)
+	for path, body := range map[string]interface{}{"/api/v1/validate": request["document"], "/api/v1/convert": request} {
+		rec := doJSONRequest(router, http.MethodPost, path, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: código HTTP = %d, esperado 200: %s", path, rec.Code, rec.Body.String())
+		}
+		var resp APIResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if !hasRule(resp.Warnings, UnknownFieldRule) {
+			t.Errorf("%s: se esperaba el warning del campo ignorado, obtenido %+v", path, resp.Warnings)
+		}
+	}
+
+	// Sin modo estricto, el typo en unitCode sigue fallando por estructura, pero el
+	// warning señala la causa
+	doc := typoDocument(t)
+	item := doc["items"].([]interface{})[1].(map[string]interface{})
+	item["unitcode"] = "NIU"
+	delete(item, "unitCode")
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/validate", doc)
+	var resp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusBadRequest || len(resp.ValidationErrors) != 1 || resp.ValidationErrors[0].Field != "items[1].unitCode" {
+		t.Fatalf("se esperaba el error de unitCode faltante, obtenido %d %s", rec.Code, rec.Body.String())
+	}
+	var hint *ValidationError
+	for i := range resp.Warnings {
+		if resp.Warnings[i].Field == "items[1].unitcode" {
+			hint = &resp.Warnings[i]
+		}
+	}
+	if hint == nil || hint.Expected != "unitCode" {
+		t.Errorf("se esperaba el warning que sugiere unitCode, obtenido %+v", resp.Warnings)
+	}
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// suggestionFor retorna la sugerencia del primer error de la regla
+func suggestionFor(t *testing.T, doc *BusinessDocument, rule string) string {
+	t.Helper()
+	for _, ve := range NewValidationService(nil).ValidateBusinessDocument(doc) {
+		if ve.Rule == rule {
+			return ve.Suggestion
+		}
+	}
+	t.Fatalf("se esperaba un error %s", rule)
+	return ""
+}
+
+func TestValidationSuggestions(t *testing.T) {
+	cases := []struct {
+		name string
+		edit func(doc *BusinessDocument)
+		rule string
+		want string
+	}{
+		{"dígito verificador del RUC", func(doc *BusinessDocument) { doc.Issuer.DocumentID = "20605384810" }, "ruc_validation",
+			"The expected check digit for 2060538481X is 2 (20605384812)"},
+		{"RUC con separadores", func(doc *BusinessDocument) { doc.Issuer.DocumentID = "20-12345678-6" }, "ruc_validation",
+			"Remove the separators: 20123456786"},
+		{"RUC sin dígito verificador", func(doc *BusinessDocument) { doc.Issuer.DocumentID = "2012345678" }, "ruc_validation",
+			"The RUC is missing its check digit: the check digit for 2012345678 is 6 (20123456786)"},
+		{"moneda en minúsculas", func(doc *BusinessDocument) { doc.Currency = "usd" }, "currency_validation",
+			"Use the uppercase ISO 4217 code USD"},
+		{"fecha día/mes/año", func(doc *BusinessDocument) { doc.IssueDate = "07/06/2024" }, "date_validation",
+			"Use the YYYY-MM-DD format: 2024-06-07"},
+		{"fecha con hora", func(doc *BusinessDocument) { doc.IssueDate = "2024-06-07T10:30:00-05:00" }, "date_validation",
+			"Use the YYYY-MM-DD format: 2024-06-07"},
+		{"IGV mal calculado", func(doc *BusinessDocument) { doc.Taxes[0].TaxAmount = 17.5 }, "sum_validation",
+			"The IGV at 18.00% of subTotal 100.00 is 18.00: set taxes[0].taxAmount to 18.00 and the total of 118.00 adds up"},
+		{"total que no cuadra", func(doc *BusinessDocument) { doc.Totals.TotalAmount = 118.5 }, "sum_validation",
+			"totalAmount is 0.50 more than subTotal + taxes (118.00): set totals.totalAmount to 118.00"},
+		{"serie de boleta en factura", func(doc *BusinessDocument) { doc.Series = "B003" }, "series_validation",
+			"Invoices use series starting with F: F003"},
+		{"serie en minúsculas", func(doc *BusinessDocument) { doc.Series = "f003" }, "series_validation",
+			"Use the series in uppercase: F003"},
+		{"serie de 5 caracteres", func(doc *BusinessDocument) { doc.Series = "F0003" }, "series_validation",
+			"The series must have 4 characters, e.g. F003"},
+	}
+
+	for _, tc := range cases {
+		doc := sampleDocument()
+		tc.edit(doc)
+		if got := suggestionFor(t, doc, tc.rule); got != tc.want {
+			t.Errorf("%s: sugerencia %q, esperado %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestValidationSuggestionOnlyWhenConcrete(t *testing.T) {
+	cases := []struct {
+		name string
+		edit func(doc *BusinessDocument)
+		rule string
+	}{
+		{"RUC con letras", func(doc *BusinessDocument) { doc.Issuer.DocumentID = "ABC" }, "ruc_validation"},
+		{"moneda desconocida", func(doc *BusinessDocument) { doc.Currency = "XXX" }, "currency_validation"},
+		{"fecha irreconocible", func(doc *BusinessDocument) { doc.IssueDate = "ayer" }, "date_validation"},
+		{"serie de nota sin letra", func(doc *BusinessDocument) { doc.Type = "07"; doc.Series = "NC001" }, "series_validation"},
+	}
+
+	for _, tc := range cases {
+		doc := sampleDocument()
+		tc.edit(doc)
+		if got := suggestionFor(t, doc, tc.rule); got != "" {
+			t.Errorf("%s: no se esperaba sugerencia, obtenido %q", tc.name, got)
+		}
+	}
+}
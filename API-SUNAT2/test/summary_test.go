@@ -0,0 +1,177 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// summaryLine es una línea del resumen firmado, decodificada para las pruebas
+type summaryLine struct {
+	DocumentTypeCode string `xml:"DocumentTypeCode"`
+	ID               string `xml:"ID"`
+	ReferenceID      string `xml:"BillingReference>InvoiceDocumentReference>ID"`
+	ConditionCode    string `xml:"Status>ConditionCode"`
+	TotalAmount      string `xml:"TotalAmount"`
+}
+
+// summaryLines decodifica las líneas del resumen firmado en el store
+func summaryLines(t *testing.T, service *UBLConverterService, summaryID string) []summaryLine {
+	t.Helper()
+	xmlData, err := service.GetStore().Read(summaryID + ".xml")
+	if err != nil {
+		t.Fatalf("no se guardó el XML del resumen: %v", err)
+	}
+	var summary struct {
+		Lines []summaryLine `xml:"SummaryDocumentsLine"`
+	}
+	// La firma va antes del elemento raíz: se decodifica desde SummaryDocuments
+	start := strings.Index(string(xmlData), "<SummaryDocuments")
+	if start < 0 || xml.Unmarshal(xmlData[start:], &summary) != nil {
+		t.Fatalf("XML del resumen inválido: %s", xmlData)
+	}
+	return summary.Lines
+}
+
+// newSummaryService emite boletas del 2024-06-07 con un reloj fijo al día siguiente
+func newSummaryService(t *testing.T, docs ...*BusinessDocument) *UBLConverterService {
+	t.Helper()
+	service := newMemoryService()
+	service.SetClock(&fixedClock{now: time.Date(2024, 6, 8, 9, 0, 0, 0, time.UTC)})
+	for _, doc := range docs {
+		processForSending(t, service, doc)
+	}
+	return service
+}
+
+func generateSummary(t *testing.T, service *UBLConverterService, ruc, date string) *APIResponse {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	resp, err := service.GenerateSummary(context.Background(), ruc, date, certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("generación del resumen falló: %v", err)
+	}
+	return resp
+}
+
+func TestGenerateSummaryMixedBoletas(t *testing.T) {
+	note := sampleCreditNote("07", 1)
+	note.Series = "BC01"
+	note.Reference.DocumentType = "03"
+	note.Reference.DocumentID = "B001-1"
+	otherDate := sampleBoleta("4")
+	otherDate.IssueDate = "2024-06-06"
+	otherIssuer := sampleBoleta("5")
+	otherIssuer.Issuer.DocumentID = "20123456794"
+
+	service := newSummaryService(t, sampleBoleta("1"), sampleBoleta("2"), sampleBoleta("3"), note, sampleDocument(), otherDate, otherIssuer)
+	if resp, _ := service.VoidDocument("20123456786-03-B001-3", "Error en el importe"); resp.Status != "SUCCESS" {
+		t.Fatalf("anulación falló: %+v", resp)
+	}
+	if resp, _ := service.VoidDocument("20123456786-01-F003-123456", ""); resp.ErrorCode != "ERR_NOT_SUMMARIZED" {
+		t.Errorf("una factura no se anula por resumen: %+v", resp)
+	}
+
+	resp := generateSummary(t, service, "20123456786", "2024-06-07")
+	if resp.Status != "SUCCESS" {
+		t.Fatalf("resumen falló: %+v", resp)
+	}
+	if resp.DocumentID != "20123456786-RC-20240608-1" || resp.Data["added"] != 3 || resp.Data["voided"] != 1 {
+		t.Errorf("resumen inesperado: %s %+v", resp.DocumentID, resp.Data)
+	}
+	if _, err := service.GetStore().Read(resp.DocumentID + ".zip"); err != nil {
+		t.Errorf("no se guardó el ZIP del resumen: %v", err)
+	}
+
+	want := map[string]string{"B001-1": "1", "B001-2": "1", "B001-3": "3", "BC01-1": "1"}
+	lines := summaryLines(t, service, resp.DocumentID)
+	if len(lines) != len(want) {
+		t.Fatalf("se esperaban %d líneas, obtenido %+v", len(want), lines)
+	}
+	for _, line := range lines {
+		if want[line.ID] != line.ConditionCode {
+			t.Errorf("línea %s con estado %q, esperado %q", line.ID, line.ConditionCode, want[line.ID])
+		}
+		if line.ID == "BC01-1" && (line.DocumentTypeCode != "07" || line.ReferenceID != "B001-1" || line.TotalAmount != "59.00") {
+			t.Errorf("nota de crédito sin la boleta de referencia: %+v", line)
+		}
+		if line.ID == "B001-1" && (line.ReferenceID != "" || line.TotalAmount != "118.00") {
+			t.Errorf("boleta inesperada: %+v", line)
+		}
+	}
+
+	if resp := generateSummary(t, service, "20123456786", "2024-06-10"); resp.ErrorCode != "ERR_INVALID_DATE" {
+		t.Errorf("fecha futura: se esperaba ERR_INVALID_DATE, obtenido %+v", resp)
+	}
+	if resp := generateSummary(t, service, "20123456786", "2024-06-05"); resp.ErrorCode != "ERR_SUMMARY_EMPTY" {
+		t.Errorf("día sin boletas: se esperaba ERR_SUMMARY_EMPTY, obtenido %+v", resp)
+	}
+}
+
+func TestGenerateSummarySkipsReportedBoletas(t *testing.T) {
+	service := newSummaryService(t, sampleBoleta("1"), sampleBoleta("2"))
+	certPEM, keyPEM := loadTestCredentials(t)
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{}, &fixedClock{now: time.Date(2024, 6, 8, 9, 0, 0, 0, time.UTC)}))
+
+	// Un resumen que aún no se envía no bloquea a los siguientes
+	first := generateSummary(t, service, "20123456786", "2024-06-07")
+	again := generateSummary(t, service, "20123456786", "2024-06-07")
+	if again.Status != "SUCCESS" || again.DocumentID != "20123456786-RC-20240608-2" {
+		t.Fatalf("se esperaba un segundo resumen con correlativo 2, obtenido %+v", again)
+	}
+
+	sent, err := service.SendDocument(context.Background(), first.DocumentID, "")
+	if err != nil || sent.Status != "SUCCESS" || sent.Data["cdrStatus"] != CDRAccepted {
+		t.Fatalf("envío del resumen falló: %v %+v", err, sent)
+	}
+
+	if resp := generateSummary(t, service, "20123456786", "2024-06-07"); resp.ErrorCode != "ERR_SUMMARY_EMPTY" {
+		t.Fatalf("las boletas ya informadas no deben repetirse: %+v", resp)
+	}
+
+	// Anular una boleta informada genera un resumen solo con su baja
+	service.VoidDocument("20123456786-03-B001-2", "Anulación")
+	resp := generateSummary(t, service, "20123456786", "2024-06-07")
+	if resp.Status != "SUCCESS" || resp.DocumentID != "20123456786-RC-20240608-3" || resp.Data["skipped"] != 1 {
+		t.Fatalf("resumen de baja inesperado: %+v", resp)
+	}
+	lines := summaryLines(t, service, resp.DocumentID)
+	if len(lines) != 1 || lines[0].ID != "B001-2" || lines[0].ConditionCode != SummaryStatusVoid {
+		t.Errorf("se esperaba solo la baja de B001-2, obtenido %+v", lines)
+	}
+}
+
+func TestGenerateSummaryAutoSend(t *testing.T) {
+	service := newSummaryService(t, sampleBoleta("1"))
+	certPEM, keyPEM := loadTestCredentials(t)
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, MockSunatRules{}, &fixedClock{now: time.Date(2024, 6, 8, 9, 0, 0, 0, time.UTC)}))
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+
+	body := convertRequest(t, sampleDocument())
+	delete(body, "document")
+	body["autoSend"] = true
+	rec := doJSONRequest(router, http.MethodPost, "/api/v2/summaries/generate?ruc=20123456786&date=2024-06-07", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código HTTP = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp api.V2Response
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	submission, _ := resp.Data["submission"].(map[string]interface{})
+	if resp.Document == nil || resp.Document.ID != "20123456786-RC-20240608-1" || submission["cdrStatus"] != CDRAccepted {
+		t.Fatalf("se esperaba el resumen enviado y aceptado, obtenido %s", rec.Body.String())
+	}
+
+	rec = doJSONRequest(router, http.MethodPost, "/api/v2/summaries/generate?ruc=20123456786&date=2024-06-07", body)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("resumen repetido: código HTTP = %d, esperado 409: %s", rec.Code, rec.Body.String())
+	}
+}
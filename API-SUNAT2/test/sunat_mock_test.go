@@ -0,0 +1,125 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/service"
+	. "API-SUNAT2/util"
+	"github.com/gin-gonic/gin"
+)
+
+func newMockSunatRouterWithRules(t *testing.T, rules MockSunatRules) (*gin.Engine, *UBLConverterService) {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	clock := &fixedClock{now: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)}
+	service.SetSunatMock(NewMockSunatClient(service.GetSigner(), certPEM, keyPEM, rules, clock))
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secret"}, service)
+	return router, service
+}
+
+// convertAndSend emite el documento de ejemplo por /api/v2 y lo envía al ambiente indicado
+func convertAndSend(t *testing.T, router *gin.Engine, environment string) api.V2Response {
+	t.Helper()
+	rec := doJSONRequest(router, http.MethodPost, "/api/v2/convert", convertRequest(t, sampleDocument()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("convert = %d: %s", rec.Code, rec.Body.String())
+	}
+	var converted api.V2Response
+	json.Unmarshal(rec.Body.Bytes(), &converted)
+
+	rec = doJSONRequest(router, http.MethodPost, "/api/v2/documents/"+converted.Document.ID+"/send", map[string]string{"environment": environment})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("send = %d: %s", rec.Code, rec.Body.String())
+	}
+	var sent api.V2Response
+	json.Unmarshal(rec.Body.Bytes(), &sent)
+	return sent
+}
+
+func TestSunatMockPipeline(t *testing.T) {
+	cases := []struct {
+		name       string
+		rules      MockSunatRules
+		wantStatus string
+		wantCode   string
+		wantNotes  int
+	}{
+		{"aceptar todo", MockSunatRules{}, CDRAccepted, "0", 0},
+		{"rechazar serie", MockSunatRules{RejectSeries: []string{"B001", "F003"}}, CDRRejected, "2999", 0},
+		{"observar monto", MockSunatRules{ObserveAmount: 100}, CDRObserved, "0", 1},
+		{"monto bajo umbral", MockSunatRules{ObserveAmount: 1000}, CDRAccepted, "0", 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, service := newMockSunatRouterWithRules(t, tc.rules)
+
+			// El ambiente pedido se ignora: en modo mock todo queda como "mock"
+			sent := convertAndSend(t, router, EnvironmentProduction)
+			if sent.Data["environment"] != EnvironmentMock {
+				t.Errorf("environment = %v, esperado mock", sent.Data["environment"])
+			}
+			if sent.Data["cdrStatus"] != tc.wantStatus || sent.Data["responseCode"] != tc.wantCode {
+				t.Errorf("CDR = %v/%v, esperado %s/%s", sent.Data["cdrStatus"], sent.Data["responseCode"], tc.wantStatus, tc.wantCode)
+			}
+
+			records, err := service.ListSubmissions(EnvironmentMock)
+			if err != nil || len(records) != 1 {
+				t.Fatalf("envíos mock = %v, %v", records, err)
+			}
+			if records[0].Status != tc.wantStatus || len(records[0].Notes) != tc.wantNotes {
+				t.Errorf("registro inesperado: %+v", records[0])
+			}
+
+			// El CDR simulado está firmado y es parseable como uno real
+			cdr, err := service.GetStore().Read(records[0].CDRFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, cdrXML, err := UnzipXMLBytes(cdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != "R-20123456786-01-F003-123456.xml" || !strings.Contains(string(cdrXML), "SignatureValue") {
+				t.Errorf("CDR sin firma o con nombre inesperado: %s", name)
+			}
+			result, err := ParseCDR(cdr)
+			if err != nil || result.ReferenceID != "F003-123456" {
+				t.Errorf("ParseCDR = %+v, %v", result, err)
+			}
+		})
+	}
+}
+
+func TestSunatMockSubmissionsFilter(t *testing.T) {
+	router, _ := newMockSunatRouterWithRules(t, MockSunatRules{})
+	convertAndSend(t, router, "")
+
+	headers := map[string]string{"X-Admin-API-Key": "secret"}
+	for environment, want := range map[string]int{EnvironmentMock: 1, EnvironmentBeta: 0} {
+		rec := doRequest(router, http.MethodGet, "/api/v1/admin/submissions?environment="+environment, headers)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("submissions = %d", rec.Code)
+		}
+		var resp struct {
+			Data struct {
+				Submissions []json.RawMessage `json:"submissions"`
+			} `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if len(resp.Data.Submissions) != want {
+			t.Errorf("ambiente %s: %d envíos, esperados %d", environment, len(resp.Data.Submissions), want)
+		}
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/v1/admin/submissions?environment=staging", headers); rec.Code != http.StatusBadRequest {
+		t.Errorf("ambiente inválido = %d, esperado 400", rec.Code)
+	}
+}
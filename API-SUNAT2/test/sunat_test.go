@@ -0,0 +1,338 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	. "API-SUNAT2/util"
+)
+
+// mockSunatClient registra el endpoint con el que fue creado y los archivos enviados
+type mockSunatClient struct {
+	endpoint SunatEndpoint
+	sent     []string
+	err      error
+}
+
+func (m *mockSunatClient) SendBill(ctx context.Context, fileName string, zipData []byte) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.sent = append(m.sent, fileName)
+	return buildCDR("0", "aceptado por "+m.endpoint.Username), nil
+}
+
+func (m *mockSunatClient) SendSummary(ctx context.Context, fileName string, zipData []byte) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	m.sent = append(m.sent, fileName)
+	return "ticket-" + fileName, nil
+}
+
+func (m *mockSunatClient) GetStatus(ctx context.Context, ticket string) ([]byte, error) {
+	return buildCDR("0", "resumen aceptado por "+m.endpoint.Username), nil
+}
+
+func (m *mockSunatClient) GetStatusCdr(ctx context.Context, ruc, docType, series, number string) (*SunatCDRStatus, error) {
+	return &SunatCDRStatus{Code: SunatCdrNotFound}, nil
+}
+
+// buildCDR arma un ZIP de CDR mínimo con el código y descripción indicados
+func buildCDR(code, description string) []byte {
+	cdr, _ := ZipXMLBytes("R-cdr.xml", []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ar:ApplicationResponse xmlns:ar="urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2" xmlns:cac="urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2" xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">
+<cac:DocumentResponse><cac:Response><cbc:ReferenceID>F003-123456</cbc:ReferenceID><cbc:ResponseCode>`+code+`</cbc:ResponseCode><cbc:Description>`+description+`</cbc:Description></cac:Response></cac:DocumentResponse>
+</ar:ApplicationResponse>`))
+	return cdr
+}
+
+// newMockSunatRouter retorna un router cuyos clientes mock quedan en clients
+func newMockSunatRouter(credentials SunatCredentials, clients *[]*mockSunatClient) *SunatRouter {
+	return NewSunatRouter(credentials, func(endpoint SunatEndpoint) SunatClient {
+		client := &mockSunatClient{endpoint: endpoint}
+		*clients = append(*clients, client)
+		return client
+	})
+}
+
+func processForSending(t *testing.T, service *UBLConverterService, doc *BusinessDocument) string {
+	t.Helper()
+	certPEM, keyPEM := loadTestCredentials(t)
+	resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("procesamiento falló: %v %+v", err, resp)
+	}
+	return resp.DocumentID
+}
+
+func TestSunatEnvironmentRouting(t *testing.T) {
+	var clients []*mockSunatClient
+	service := newMemoryService()
+	service.SetSunatRouter(newMockSunatRouter(SunatCredentials{
+		"20123456786": {
+			EnvironmentBeta:       {Username: "20123456786MODDATOS", Password: "moddatos"},
+			EnvironmentProduction: {URL: "https://ose.example/billService", Username: "20123456786PROD", Password: "secret"},
+		},
+		"*": {
+			EnvironmentHomologation: {Username: "HOMOLOGACION", Password: "secret"},
+		},
+	}, &clients), EnvironmentBeta)
+
+	documentID := processForSending(t, service, sampleDocument())
+
+	cases := []struct {
+		environment string
+		wantUser    string
+		wantURL     string
+	}{
+		{"", "20123456786MODDATOS", "https://e-beta.sunat.gob.pe/ol-ti-itcpfegem-beta/billService"},
+		{EnvironmentHomologation, "HOMOLOGACION", "https://www.sunat.gob.pe/ol-ti-itcpgem-sqa/billService"},
+		{EnvironmentProduction, "20123456786PROD", "https://ose.example/billService"},
+	}
+	for i, tc := range cases {
+		resp, err := service.SendDocument(context.Background(), documentID, tc.environment)
+		if err != nil || resp.Status != "SUCCESS" {
+			t.Fatalf("envío a %q falló: %v %+v", tc.environment, err, resp)
+		}
+		client := clients[i]
+		if client.endpoint.Username != tc.wantUser || client.endpoint.URL != tc.wantURL {
+			t.Errorf("ambiente %q: endpoint %+v", tc.environment, client.endpoint)
+		}
+		if len(client.sent) != 1 || client.sent[0] != documentID+".zip" {
+			t.Errorf("ambiente %q: archivos enviados %v", tc.environment, client.sent)
+		}
+	}
+
+	beta, err := service.ListSubmissions(EnvironmentBeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(beta) != 1 || beta[0].Environment != EnvironmentBeta || beta[0].DocumentID != documentID {
+		t.Errorf("envíos a beta inesperados: %+v", beta)
+	}
+	all, _ := service.ListSubmissions("")
+	if len(all) != 3 {
+		t.Errorf("se esperaban 3 envíos registrados, obtenidos %d", len(all))
+	}
+
+	if beta[0].Status != CDRAccepted || beta[0].Description != "aceptado por 20123456786MODDATOS" {
+		t.Errorf("resultado del CDR de beta inesperado: %+v", beta[0])
+	}
+	if _, err := service.GetStore().Read(beta[0].CDRFile); err != nil {
+		t.Errorf("CDR de beta no guardado: %v", err)
+	}
+}
+
+func TestSunatSendErrors(t *testing.T) {
+	var clients []*mockSunatClient
+	service := newMemoryService()
+
+	documentID := processForSending(t, service, sampleDocument())
+	if resp, _ := service.SendDocument(context.Background(), documentID, EnvironmentBeta); resp.ErrorCode != "ERR_SUNAT_NOT_CONFIGURED" {
+		t.Errorf("sin configuración: código %q", resp.ErrorCode)
+	}
+
+	service.SetSunatRouter(newMockSunatRouter(SunatCredentials{
+		"20123456786": {EnvironmentBeta: {Username: "u", Password: "p"}},
+	}, &clients), EnvironmentBeta)
+
+	cases := []struct {
+		documentID  string
+		environment string
+		code        string
+	}{
+		{documentID, "staging", "ERR_INVALID_ENVIRONMENT"},
+		{"../../etc/passwd", EnvironmentBeta, "ERR_INVALID_DOCUMENT_ID"},
+		{"20123456786-01-F003-999999", EnvironmentBeta, "ERR_DOCUMENT_NOT_FOUND"},
+		{documentID, EnvironmentProduction, "ERR_SUNAT_CREDENTIALS"},
+	}
+	for _, tc := range cases {
+		resp, err := service.SendDocument(context.Background(), tc.documentID, tc.environment)
+		if err != nil || resp.Status != "ERROR" || resp.ErrorCode != tc.code {
+			t.Errorf("%s/%s: se esperaba %s, obtenido %+v", tc.documentID, tc.environment, tc.code, resp)
+		}
+	}
+	if len(clients) != 0 {
+		t.Errorf("no debió crearse ningún cliente SOAP, creados %d", len(clients))
+	}
+}
+
+func TestSunatTestDocumentNotSentToProduction(t *testing.T) {
+	var clients []*mockSunatClient
+	service := newMemoryService()
+	service.SetSunatRouter(newMockSunatRouter(SunatCredentials{
+		"*": {
+			EnvironmentBeta:       {Username: "beta", Password: "p"},
+			EnvironmentProduction: {Username: "prod", Password: "p"},
+		},
+	}, &clients), EnvironmentBeta)
+
+	doc := sampleDocument()
+	doc.Test = true
+	documentID := processForSending(t, service, doc)
+
+	resp, _ := service.SendDocument(context.Background(), documentID, EnvironmentProduction)
+	if resp.ErrorCode != "ERR_TEST_DOCUMENT_PROD" {
+		t.Fatalf("se esperaba ERR_TEST_DOCUMENT_PROD, obtenido %+v", resp)
+	}
+	if len(clients) != 0 {
+		t.Fatal("el documento de prueba no debe llegar al cliente de producción")
+	}
+
+	if resp, _ := service.SendDocument(context.Background(), documentID, EnvironmentBeta); resp.Status != "SUCCESS" {
+		t.Errorf("el documento de prueba debe poder enviarse a beta: %+v", resp)
+	}
+}
+
+func TestZIPFileNameTemplate(t *testing.T) {
+	// 15:15:30 UTC son las 10:15:30 en Lima
+	at := time.Date(2024, 1, 15, 15, 15, 30, 0, time.UTC)
+	cases := map[string]string{
+		"":                     "20123456786-01-F001-123.zip",
+		"{ruc}.zip":            "20123456786.zip",
+		"X-{tipo}":             "X-01.zip",
+		"{serie}_{numero}.ZIP": "F001_123.ZIP",
+		"{timestamp}.zip":      "20240115T101530.zip",
+		"{ruc}-{tipo}-{serie}-{numero}-{timestamp}.zip": "20123456786-01-F001-123-20240115T101530.zip",
+	}
+	for template, want := range cases {
+		namer, err := NewZIPFileNamer(template)
+		if err != nil {
+			t.Fatalf("plantilla %q: %v", template, err)
+		}
+		if got := namer.Name("20123456786-01-F001-123", at); got != want {
+			t.Errorf("plantilla %q: se esperaba %s, obtenido %s", template, want, got)
+		}
+	}
+
+	for _, template := range []string{"{ruc}-{fecha}.zip", "{ruc-{tipo}.zip", "envios/{ruc}.zip"} {
+		if _, err := NewZIPFileNamer(template); err == nil {
+			t.Errorf("la plantilla %q debería rechazarse", template)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "credenciales.json")
+	os.WriteFile(path, []byte(`{"*": {"beta": {"username": "u", "password": "p", "zipFileName": "{ruc}-{fecha}"}}}`), 0o600)
+	if _, err := LoadSunatCredentials(path); err == nil {
+		t.Errorf("una plantilla inválida en las credenciales debe rechazarse al cargarlas")
+	}
+}
+
+func TestSunatSendsCustomZIPName(t *testing.T) {
+	var clients []*mockSunatClient
+	service := newMemoryService()
+	service.SetSunatRouter(newMockSunatRouter(SunatCredentials{
+		"*": {
+			EnvironmentBeta:       {Username: "beta", Password: "p"},
+			EnvironmentProduction: {URL: "https://ose.example/billService", Username: "ose", Password: "p", ZIPFileName: "{ruc}-{tipo}-{serie}-{numero}-{timestamp}.zip"},
+		},
+	}, &clients), EnvironmentBeta)
+
+	documentID := processForSending(t, service, sampleDocument())
+	service.SetClock(&fixedClock{now: time.Date(2024, 1, 15, 15, 15, 30, 0, time.UTC)})
+
+	resp, err := service.SendDocument(context.Background(), documentID, EnvironmentProduction)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("envío falló: %v %+v", err, resp)
+	}
+	sentName := documentID + "-20240115T101530.zip"
+	if len(clients) != 1 || len(clients[0].sent) != 1 || clients[0].sent[0] != sentName {
+		t.Fatalf("el OSE debe recibir el ZIP con el sufijo de timestamp, enviados %v", clients[0].sent)
+	}
+
+	// El ZIP archivado y el XML que contiene conservan el nombre estándar
+	zipData, err := service.GetStore().Read(documentID + ".zip")
+	if err != nil {
+		t.Fatalf("el ZIP archivado debe conservar el nombre estándar: %v", err)
+	}
+	if xmlName, _, err := UnzipXMLBytes(zipData); err != nil || xmlName != documentID+".xml" {
+		t.Errorf("el XML dentro del ZIP debe conservar el nombre estándar: %s %v", xmlName, err)
+	}
+	if _, err := service.GetStore().Read(sentName); err == nil {
+		t.Errorf("el nombre del envío no debe crear otro archivo en el store")
+	}
+
+	submissions, _ := service.ListSubmissions(EnvironmentProduction)
+	if len(submissions) != 1 || submissions[0].ZIPFile != documentID+".zip" || submissions[0].SentFileName != sentName {
+		t.Errorf("el registro del envío debe guardar ambos nombres: %+v", submissions)
+	}
+
+	// El proveedor sin plantilla recibe el nombre estándar
+	service.SendDocument(context.Background(), documentID, EnvironmentBeta)
+	if sent := clients[1].sent; len(sent) != 1 || sent[0] != documentID+".zip" {
+		t.Errorf("SUNAT debe recibir el nombre estándar, enviados %v", sent)
+	}
+}
+
+func TestSOAPSunatClient(t *testing.T) {
+	cdr := []byte("PK-cdr")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("SOAPAction") != "urn:sendBill" {
+			t.Errorf("SOAPAction = %q", r.Header.Get("SOAPAction"))
+		}
+		if !strings.Contains(string(body), "<wsse:Username>20123456786MODDATOS</wsse:Username>") {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `<soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/"><soap-env:Body><soap-env:Fault><faultcode>soap-env:Client.0111</faultcode><faultstring>No tiene el perfil para enviar comprobantes electronicos</faultstring></soap-env:Fault></soap-env:Body></soap-env:Envelope>`)
+			return
+		}
+		io.WriteString(w, `<soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/"><soap-env:Body><br:sendBillResponse xmlns:br="http://service.sunat.gob.pe"><applicationResponse>`+
+			base64.StdEncoding.EncodeToString(cdr)+`</applicationResponse></br:sendBillResponse></soap-env:Body></soap-env:Envelope>`)
+	}))
+	defer server.Close()
+
+	client := NewSOAPSunatClient(SunatEndpoint{URL: server.URL, Username: "20123456786MODDATOS", Password: "moddatos"}, nil)
+	got, err := client.SendBill(context.Background(), "20123456786-01-F003-123456.zip", []byte("zip"))
+	if err != nil || string(got) != string(cdr) {
+		t.Fatalf("SendBill = %q, %v", got, err)
+	}
+
+	client = NewSOAPSunatClient(SunatEndpoint{URL: server.URL, Username: "otro", Password: "x"}, nil)
+	_, err = client.SendBill(context.Background(), "20123456786-01-F003-123456.zip", []byte("zip"))
+	fault, ok := err.(*SunatFault)
+	if !ok || fault.Code != "soap-env:Client.0111" {
+		t.Fatalf("se esperaba SunatFault 0111, obtenido %v", err)
+	}
+}
+
+func TestSOAPSunatClientGetStatusCdr(t *testing.T) {
+	cdr := []byte("PK-cdr")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/billConsultService" || r.Header.Get("SOAPAction") != "urn:getStatusCdr" {
+			t.Errorf("request inesperado: %s %q", r.URL.Path, r.Header.Get("SOAPAction"))
+		}
+		if !strings.Contains(string(body), "<serieComprobante>F003</serieComprobante><numeroComprobante>7</numeroComprobante>") {
+			io.WriteString(w, `<soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/"><soap-env:Body><ns2:getStatusCdrResponse xmlns:ns2="http://service.sunat.gob.pe"><statusCdr><statusCode>0011</statusCode><statusMessage>El comprobante de pago electrónico no existe.</statusMessage></statusCdr></ns2:getStatusCdrResponse></soap-env:Body></soap-env:Envelope>`)
+			return
+		}
+		io.WriteString(w, `<soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/"><soap-env:Body><ns2:getStatusCdrResponse xmlns:ns2="http://service.sunat.gob.pe"><statusCdr><content>`+
+			base64.StdEncoding.EncodeToString(cdr)+`</content><statusCode>0001</statusCode><statusMessage>El comprobante existe y está aceptado.</statusMessage></statusCdr></ns2:getStatusCdrResponse></soap-env:Body></soap-env:Envelope>`)
+	}))
+	defer server.Close()
+
+	client := NewSOAPSunatClient(SunatEndpoint{URL: server.URL + "/billService", ConsultURL: server.URL + "/billConsultService", Username: "u", Password: "p"}, nil)
+	status, err := client.GetStatusCdr(context.Background(), "20123456786", "01", "F003", "7")
+	if err != nil || status.Code != "0001" || string(status.CDR) != string(cdr) {
+		t.Fatalf("GetStatusCdr = %+v, %v", status, err)
+	}
+	status, err = client.GetStatusCdr(context.Background(), "20123456786", "01", "F003", "8")
+	if err != nil || status.Code != SunatCdrNotFound || status.CDR != nil {
+		t.Fatalf("GetStatusCdr de un comprobante inexistente = %+v, %v", status, err)
+	}
+
+	client = NewSOAPSunatClient(SunatEndpoint{URL: server.URL + "/billService"}, nil)
+	if _, err := client.GetStatusCdr(context.Background(), "20123456786", "01", "F003", "7"); err == nil {
+		t.Error("sin ConsultURL getStatusCdr debe fallar")
+	}
+}
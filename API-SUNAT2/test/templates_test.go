@@ -0,0 +1,253 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func putDocumentDefaults(t *testing.T, router http.Handler, ruc string, defaults map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/issuers/"+ruc+"/defaults",
+		strings.NewReader(mustJSON(t, map[string]interface{}{"defaults": defaults})))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-API-Key", "secreto")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func issuerDefaults() map[string]interface{} {
+	return map[string]interface{}{
+		"currency": "USD",
+		"series":   "F003",
+		"issuer": map[string]interface{}{
+			"documentType": "6",
+			"name":         "RODRIGO S.A.C",
+			"address": map[string]interface{}{
+				"street":     "Av. Principal 123",
+				"city":       "LIMA",
+				"district":   "MIRAFLORES",
+				"province":   "LIMA",
+				"department": "LIMA",
+				"country":    "PE",
+				"ubigeo":     "150122",
+			},
+		},
+		"observations": []interface{}{"Cuenta BCP: 191-0000000-0-00"},
+	}
+}
+
+func TestDocumentTemplateMergeConflicts(t *testing.T) {
+	service := newMemoryService()
+	if _, err := service.SetDocumentTemplate("20123456786", issuerDefaults()); err != nil {
+		t.Fatal(err)
+	}
+
+	// El request trae su propia moneda, calle y observaciones (vacías): ganan sobre la plantilla
+	document := map[string]interface{}{
+		"currency": "PEN",
+		"series":   nil,
+		"issuer": map[string]interface{}{
+			"documentId": "20123456786",
+			"address":    map[string]interface{}{"street": "Jr. Sucursal 9"},
+		},
+		"observations": []interface{}{},
+	}
+	fields := service.MergeDocumentTemplate(document)
+
+	want := []string{
+		"issuer.address.city", "issuer.address.country", "issuer.address.department",
+		"issuer.address.district", "issuer.address.province", "issuer.address.ubigeo",
+		"issuer.documentType", "issuer.name", "series",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("campos de la plantilla: se esperaba %v, obtenido %v", want, fields)
+	}
+	if document["currency"] != "PEN" || document["series"] != "F003" {
+		t.Errorf("el request gana y un null toma el valor de la plantilla: %v", document)
+	}
+	address := document["issuer"].(map[string]interface{})["address"].(map[string]interface{})
+	if address["street"] != "Jr. Sucursal 9" || address["ubigeo"] != "150122" {
+		t.Errorf("los objetos se combinan campo a campo: %v", address)
+	}
+	if observations := document["observations"].([]interface{}); len(observations) != 0 {
+		t.Errorf("los arrays del request reemplazan por completo a los de la plantilla: %v", observations)
+	}
+
+	// La plantilla en memoria no comparte valores con el documento completado
+	address["ubigeo"] = "150101"
+	if ubigeo := service.DocumentTemplateDefaults("20123456786")["issuer"].(map[string]interface{})["address"].(map[string]interface{})["ubigeo"]; ubigeo != "150122" {
+		t.Errorf("modificar el documento no debe alterar la plantilla: %v", ubigeo)
+	}
+}
+
+func TestDocumentTemplateAbsent(t *testing.T) {
+	service := newMemoryService()
+	document := documentJSON(t, sampleDocument()).(map[string]interface{})
+	before := mustJSON(t, document)
+
+	if fields := service.MergeDocumentTemplate(document); fields != nil {
+		t.Errorf("sin plantilla no se completan campos: %v", fields)
+	}
+	if mustJSON(t, document) != before {
+		t.Errorf("sin plantilla el documento no debe cambiar")
+	}
+	// Sin emisor no hay plantilla que buscar
+	if fields := service.MergeDocumentTemplate(map[string]interface{}{"currency": "PEN"}); fields != nil {
+		t.Errorf("sin emisor no se completan campos: %v", fields)
+	}
+}
+
+func TestDocumentTemplateRejectsInvalidDefaults(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+
+	for name, defaults := range map[string]map[string]interface{}{
+		"campo desconocido": {"moneda": "PEN"},
+		"tipo equivocado":   {"items": "ninguno"},
+		"otro emisor":       {"issuer": map[string]interface{}{"documentId": "20000000001"}},
+	} {
+		rec := putDocumentDefaults(t, router, "20123456786", defaults)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_DOCUMENT_TEMPLATE") {
+			t.Errorf("%s: se esperaba 400 ERR_INVALID_DOCUMENT_TEMPLATE, obtenido %d: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestDocumentTemplateAppliedOnConvert(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+
+	defaults := issuerDefaults()
+	defaults["currency"] = "PEN"
+	if rec := putDocumentDefaults(t, router, "20123456786", defaults); rec.Code != http.StatusOK {
+		t.Fatalf("registro de la plantilla: código %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// El request solo trae lo variable: el RUC del emisor, cliente, ítems y totales
+	doc := documentJSON(t, sampleDocument()).(map[string]interface{})
+	delete(doc, "currency")
+	delete(doc, "series")
+	doc["issuer"] = map[string]interface{}{"documentId": "20123456786"}
+	request := convertRequest(t, sampleDocument())
+	request["document"] = doc
+
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", request)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp APIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.DocumentID != "20123456786-01-F003-123456" {
+		t.Errorf("la serie debe tomarse de la plantilla: %s", resp.DocumentID)
+	}
+	// La dirección ausente se completa entera y se reporta como un solo campo
+	if fields, ok := resp.Data["templateFields"].([]interface{}); !ok || len(fields) != 6 || fields[1] != "issuer.address" {
+		t.Errorf("la respuesta debe indicar los campos de la plantilla: %v", resp.Data["templateFields"])
+	}
+	record := readDocumentRecord(t, service.GetStore(), resp.DocumentID)
+	if len(record.TemplateFields) != 6 || record.TemplateFields[0] != "currency" {
+		t.Errorf("el registro debe conservar los campos de la plantilla: %v", record.TemplateFields)
+	}
+	xml, err := service.GetStore().Read(resp.DocumentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(xml), "Cuenta BCP") || !strings.Contains(string(xml), "150122") {
+		t.Errorf("el XML debe incluir las observaciones y el ubigeo de la plantilla")
+	}
+
+	// Un documento completo no toma nada de la plantilla
+	full := sampleDocument()
+	full.Number = "123457"
+	full.Observations = []string{"Otra cuenta"}
+	rec = doJSONRequest(router, http.MethodPost, "/api/v1/validate", full)
+	var validated APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &validated)
+	if rec.Code != http.StatusOK || validated.Data["templateFields"] != nil {
+		t.Errorf("un documento completo no debe completarse con la plantilla: %d %v", rec.Code, validated.Data["templateFields"])
+	}
+}
+
+// convertedSupplierContact convierte el documento de ejemplo con el emisor indicado y
+// retorna el cac:Contact del AccountingSupplierParty del XML guardado
+func convertedSupplierContact(t *testing.T, router http.Handler, service *UBLConverterService, issuer map[string]interface{}) string {
+	t.Helper()
+	doc := documentJSON(t, sampleDocument()).(map[string]interface{})
+	doc["issuer"] = issuer
+	request := convertRequest(t, sampleDocument())
+	request["document"] = doc
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", request)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("código %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp APIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	xml, err := service.GetStore().Read(resp.DocumentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	supplier := strings.SplitN(strings.SplitN(string(xml), "<cac:AccountingSupplierParty>", 2)[1], "</cac:AccountingSupplierParty>", 2)[0]
+	return supplier[strings.Index(supplier, "<cac:Contact>"):]
+}
+
+func TestIssuerContactPrecedence(t *testing.T) {
+	// Sin plantilla ni request el contacto se emite vacío
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+	issuer := documentJSON(t, sampleDocument().Issuer).(map[string]interface{})
+	if contact := convertedSupplierContact(t, router, service, issuer); strings.Contains(contact, "ElectronicMail") || strings.Contains(contact, "Telephone") {
+		t.Errorf("sin datos de contacto no se emiten: %s", contact)
+	}
+
+	// La plantilla completa el contacto ausente del request
+	service = newMemoryService()
+	router, _ = api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+	defaults := issuerDefaults()
+	defaults["currency"] = "PEN"
+	defaults["issuer"].(map[string]interface{})["email"] = "facturacion@rodrigo.pe"
+	defaults["issuer"].(map[string]interface{})["telephone"] = "+51 1 234-5678"
+	if rec := putDocumentDefaults(t, router, "20123456786", defaults); rec.Code != http.StatusOK {
+		t.Fatalf("registro de la plantilla: código %d: %s", rec.Code, rec.Body.String())
+	}
+	contact := convertedSupplierContact(t, router, service, map[string]interface{}{"documentId": "20123456786"})
+	if !strings.Contains(contact, "<cbc:Telephone>+51 1 234-5678</cbc:Telephone>") || !strings.Contains(contact, "<cbc:ElectronicMail>facturacion@rodrigo.pe</cbc:ElectronicMail>") {
+		t.Errorf("el contacto debe tomarse de la plantilla: %s", contact)
+	}
+
+	// El valor explícito del request prevalece sobre la plantilla
+	issuer = map[string]interface{}{"documentId": "20123456786", "email": "ventas@rodrigo.pe"}
+	contact = convertedSupplierContact(t, router, service, issuer)
+	if !strings.Contains(contact, "<cbc:ElectronicMail>ventas@rodrigo.pe</cbc:ElectronicMail>") || !strings.Contains(contact, "+51 1 234-5678") {
+		t.Errorf("el correo del request debe prevalecer y el teléfono venir de la plantilla: %s", contact)
+	}
+}
+
+func TestIssuerContactFormat(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+
+	rec := putDocumentDefaults(t, router, "20123456786", map[string]interface{}{"issuer": map[string]interface{}{"email": "facturacion"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "issuer.email") {
+		t.Errorf("un correo inválido en la plantilla: se esperaba 400, obtenido %d: %s", rec.Code, rec.Body.String())
+	}
+
+	doc := sampleDocument()
+	doc.Issuer.Telephone = "llamar al anexo"
+	if errs := NewValidationService(nil).ValidateBusinessDocument(doc); !hasRule(errs, "contact_validation") {
+		t.Errorf("un teléfono inválido en el documento debe rechazarse: %+v", errs)
+	}
+}
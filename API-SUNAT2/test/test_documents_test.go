@@ -0,0 +1,100 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	"API-SUNAT2/storage"
+)
+
+// newTestDocumentsService retorna un servicio con el RUC de prueba y la serie F999
+// marcados como de prueba, cuyos artefactos van a un store separado
+func newTestDocumentsService() (*UBLConverterService, *storage.MemoryStore, *storage.MemoryStore) {
+	service := newMemoryService()
+	service.SetTestDocuments([]string{"20000000001"}, []string{"f999"})
+	main, separated := storage.NewMemoryStore(), storage.NewMemoryStore()
+	service.SetStore(storage.NewPartitionedStore(main, separated, service.IsTestArtifact))
+	return service, main, separated
+}
+
+func TestTestDocumentsDetectedAndIsolated(t *testing.T) {
+	service, main, separated := newTestDocumentsService()
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	byIssuer := sampleDocument()
+	byIssuer.Issuer.DocumentID = "20000000001"
+	bySeries := sampleDocument()
+	bySeries.Series = "F999"
+	for name, doc := range map[string]*BusinessDocument{"RUC de prueba": byIssuer, "serie de prueba": bySeries, "producción": sampleDocument()} {
+		resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+		if err != nil || resp.Status != "SUCCESS" {
+			t.Fatalf("%s: procesamiento falló: %v %+v", name, err, resp)
+		}
+		test := name != "producción"
+		if (resp.Data["test"] == true) != test {
+			t.Errorf("%s: la respuesta debe indicar test=%v: %v", name, test, resp.Data["test"])
+		}
+		if record := readDocumentRecord(t, service.GetStore(), resp.DocumentID); record.Test != test {
+			t.Errorf("%s: el registro debe indicar test=%v", name, test)
+		}
+		// Los artefactos del documento quedan solo en el store que le corresponde
+		own, other := main, separated
+		if test {
+			own, other = separated, main
+		}
+		if _, err := own.Read(resp.DocumentID + ".xml"); err != nil {
+			t.Errorf("%s: el XML no está en su store: %v", name, err)
+		}
+		names, _ := other.List()
+		for _, stored := range names {
+			if strings.HasPrefix(stored, resp.DocumentID) {
+				t.Errorf("%s: %s no debe guardarse en el otro store", name, stored)
+			}
+		}
+	}
+}
+
+func TestTestDocumentsExcludedFromReports(t *testing.T) {
+	service, _, _ := newTestDocumentsService()
+	doc := sampleDocument()
+	doc.Issuer.DocumentID = "20000000001"
+	processForSending(t, service, doc)
+	processForSending(t, service, sampleDocument())
+
+	report, err := service.EndOfDayReport("", sampleDocument().IssueDate, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Issued != 1 || report.TestExcluded != 1 || len(report.Issuers) != 1 || report.Issuers[0].IssuerRUC != "20123456786" {
+		t.Errorf("el reporte no debe incluir los documentos de prueba: %+v", report)
+	}
+	report, _ = service.EndOfDayReport("", sampleDocument().IssueDate, true)
+	if report.Issued != 2 || report.TestExcluded != 0 {
+		t.Errorf("con includeTest el reporte debe incluirlos: %+v", report)
+	}
+}
+
+func TestTestDocumentsBlockedInProduction(t *testing.T) {
+	var clients []*mockSunatClient
+	service, _, _ := newTestDocumentsService()
+	service.SetSunatRouter(newMockSunatRouter(SunatCredentials{
+		"*": {
+			EnvironmentBeta:       {Username: "beta", Password: "p"},
+			EnvironmentProduction: {Username: "prod", Password: "p"},
+		},
+	}, &clients), EnvironmentBeta)
+
+	doc := sampleDocument()
+	doc.Series = "F999"
+	documentID := processForSending(t, service, doc)
+	resp, _ := service.SendDocument(context.Background(), documentID, EnvironmentProduction)
+	if resp.ErrorCode != ErrTestDocumentProdCode || len(clients) != 0 {
+		t.Fatalf("se esperaba %s sin llamar a SUNAT, obtenido %+v", ErrTestDocumentProdCode, resp)
+	}
+	if resp, _ := service.SendDocument(context.Background(), documentID, EnvironmentBeta); resp.Status != "SUCCESS" {
+		t.Errorf("el documento de prueba debe poder enviarse a beta: %+v", resp)
+	}
+}
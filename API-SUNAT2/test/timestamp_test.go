@@ -0,0 +1,184 @@
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "API-SUNAT2/service"
+)
+
+// Estructuras RFC 3161 mínimas para construir respuestas de una TSA simulada
+type testImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type testTimeStampReq struct {
+	Version        int
+	MessageImprint testImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type testTSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint testImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+type testEncapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo testEncapContentInfo
+}
+
+type testContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     testSignedData `asn1:"explicit,tag:0"`
+}
+
+type testStatusInfo struct {
+	Status int
+}
+
+type testTimeStampResp struct {
+	Status         testStatusInfo
+	TimeStampToken testContentInfo
+}
+
+func buildTimestampResponse(t *testing.T, digest []byte, genTime time.Time) []byte {
+	t.Helper()
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, Parameters: asn1.NullRawValue}
+	info, err := asn1.Marshal(testTSTInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: testImprint{HashAlgorithm: sha256Alg, HashedMessage: digest},
+		SerialNumber:   big.NewInt(42),
+		GenTime:        genTime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := asn1.Marshal(testTimeStampResp{
+		Status: testStatusInfo{Status: 0},
+		TimeStampToken: testContentInfo{
+			ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+			Content: testSignedData{
+				Version:          3,
+				DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Alg},
+				EncapContentInfo: testEncapContentInfo{
+					EContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4},
+					EContent:     info,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// mockTSA es una TSA simulada que responde con un token válido o falla
+type mockTSA struct {
+	t    *testing.T
+	fail bool
+}
+
+func (m *mockTSA) Timestamp(digest []byte) ([]byte, error) {
+	if m.fail {
+		return nil, errors.New("TSA timeout")
+	}
+	return buildTimestampResponse(m.t, digest, time.Date(2024, 6, 7, 10, 30, 0, 0, time.UTC)), nil
+}
+
+func TestSignatureTimestampStored(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.GetSigner().SetTimestampAuthority(&mockTSA{t: t}, true)
+
+	response, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || response.Status != "SUCCESS" {
+		t.Fatalf("procesamiento falló: %v %+v", err, response)
+	}
+	token, err := service.GetStore().Read("20123456786-01-F003-123456.tsr")
+	if err != nil {
+		t.Fatalf("no se guardó el token TSR: %v", err)
+	}
+	hash := sha256.Sum256(token)
+	if response.Data["timestampHash"] != hex.EncodeToString(hash[:]) {
+		t.Fatalf("hash del timestamp inesperado: %v", response.Data["timestampHash"])
+	}
+}
+
+func TestSignatureTimestampFailureModes(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	service := newMemoryService()
+	service.GetSigner().SetTimestampAuthority(&mockTSA{t: t, fail: true}, true)
+	response, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || response.ErrorCode != "ERR_TIMESTAMP_FAILED" {
+		t.Fatalf("se esperaba ERR_TIMESTAMP_FAILED, se obtuvo %v %+v", err, response)
+	}
+
+	service = newMemoryService()
+	service.GetSigner().SetTimestampAuthority(&mockTSA{t: t, fail: true}, false)
+	response, err = service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || response.Status != "SUCCESS" {
+		t.Fatalf("se esperaba continuar sin sello, se obtuvo %v %+v", err, response)
+	}
+	if !hasRule(response.Warnings, "timestamp_unavailable") {
+		t.Fatalf("se esperaba warning timestamp_unavailable: %+v", response.Warnings)
+	}
+}
+
+func TestHTTPTimestampAuthority(t *testing.T) {
+	genTime := time.Date(2024, 6, 7, 10, 30, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/timestamp-query" {
+			http.Error(w, "bad content type", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req testTimeStampReq
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(buildTimestampResponse(t, req.MessageImprint.HashedMessage, genTime))
+	}))
+	defer server.Close()
+
+	digest := sha256.Sum256([]byte("signature value"))
+	token, err := NewHTTPTimestampAuthority(server.URL, nil).Timestamp(digest[:])
+	if err != nil {
+		t.Fatalf("timestamp falló: %v", err)
+	}
+	stamped, err := VerifyTimestamp(token, digest[:])
+	if err != nil || !stamped.Equal(genTime) {
+		t.Fatalf("verificación falló: %v %v", err, stamped)
+	}
+
+	other := sha256.Sum256([]byte("otra firma"))
+	if _, err := VerifyTimestamp(token, other[:]); err == nil {
+		t.Fatalf("se esperaba error con un digest distinto")
+	}
+}
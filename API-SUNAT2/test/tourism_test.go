@@ -0,0 +1,135 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// tourismInvoice retorna una factura de paquete turístico para dos pasajeros junto a
+// la línea normal del documento de ejemplo
+func tourismInvoice() *BusinessDocument {
+	doc := sampleDocument()
+	passengers := []TourismDetail{
+		{PassengerDocType: "7", PassengerDocNumber: "X1234567", PassengerName: "JOHN SMITH", ServiceType: TourismPackage, StartDate: "2024-06-10", EndDate: "2024-06-14"},
+		{PassengerDocType: "7", PassengerDocNumber: "Y7654321", PassengerName: "JANE SMITH", ServiceType: TourismPackage, StartDate: "2024-06-10", EndDate: "2024-06-14"},
+	}
+	for i := range passengers {
+		doc.Items = append(doc.Items, DocumentItem{
+			ID:            "PKG-CUSCO",
+			Description:   "Paquete turístico Cusco 4 noches",
+			Quantity:      1,
+			UnitCode:      "ZZ",
+			UnitPrice:     500,
+			LineTotal:     500,
+			Taxes:         []Tax{{TaxType: "9995", TaxAmount: 0, TaxRate: 0, TaxBase: 500}},
+			TourismDetail: &passengers[i],
+		})
+	}
+	doc.Totals = DocumentTotals{SubTotal: 1100, TotalTaxes: 18, TotalAmount: 1118, PayableAmount: 1118}
+	return doc
+}
+
+func TestTourismDetailValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+
+	cases := []struct {
+		name  string
+		edit  func(detail *TourismDetail)
+		field string
+	}{
+		{"paquete válido", func(detail *TourismDetail) {}, ""},
+		{"hospedaje de un día", func(detail *TourismDetail) {
+			detail.ServiceType = TourismLodging
+			detail.EndDate = detail.StartDate
+		}, ""},
+		{"DNI de pasajero domiciliado", func(detail *TourismDetail) { detail.PassengerDocType = "1" }, "passengerDocType"},
+		{"pasaporte demasiado largo", func(detail *TourismDetail) { detail.PassengerDocNumber = "X12345678901234" }, "passengerDocNumber"},
+		{"pasaporte con símbolos", func(detail *TourismDetail) { detail.PassengerDocNumber = "X-123" }, "passengerDocNumber"},
+		{"sin nombre", func(detail *TourismDetail) { detail.PassengerName = " " }, "passengerName"},
+		{"servicio desconocido", func(detail *TourismDetail) { detail.ServiceType = "crucero" }, "serviceType"},
+		{"fecha inválida", func(detail *TourismDetail) { detail.StartDate = "10/06/2024" }, "startDate"},
+		{"salida antes del ingreso", func(detail *TourismDetail) { detail.EndDate = "2024-06-09" }, "endDate"},
+	}
+
+	for _, tc := range cases {
+		doc := tourismInvoice()
+		tc.edit(doc.Items[2].TourismDetail)
+		errs := validator.ValidateBusinessDocument(doc)
+		if tc.field == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: no se esperaban errores, obtenido %+v", tc.name, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Rule != "tourism_detail_validation" || errs[0].Field != "items[2].tourismDetail."+tc.field {
+			t.Errorf("%s: se esperaba tourism_detail_validation en items[2].tourismDetail.%s, obtenido %+v", tc.name, tc.field, errs)
+		}
+	}
+}
+
+func TestTourismPackageInvoice(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+
+	resp, err := service.ProcessDocument(context.Background(), tourismInvoice(), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("se esperaba éxito: %v %+v", err, resp)
+	}
+	xmlData, err := service.GetStore().Read(resp.DocumentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmlStr := string(xmlData)
+
+	// La línea normal no lleva propiedades; cada pasajero lleva las suyas
+	lines := strings.Split(xmlStr, "<cac:InvoiceLine>")[1:]
+	if len(lines) != 3 {
+		t.Fatalf("se esperaban 3 líneas, obtenido %d", len(lines))
+	}
+	if strings.Contains(lines[0], "AdditionalItemProperty") {
+		t.Error("la línea normal no debe llevar AdditionalItemProperty")
+	}
+	for i, passenger := range []string{"JOHN SMITH", "JANE SMITH"} {
+		line := lines[i+1]
+		for _, want := range []string{
+			">4007</cbc:NameCode>", "<cbc:Value>" + passenger + "</cbc:Value>",
+			">4008</cbc:NameCode>", "<cbc:Value>7</cbc:Value>",
+			">4009</cbc:NameCode>",
+			">4003</cbc:NameCode>", "<cbc:StartDate>2024-06-10</cbc:StartDate>",
+			">4004</cbc:NameCode>", "<cbc:EndDate>2024-06-14</cbc:EndDate>",
+			"Paquete turístico: Nombres y Apellidos del Huésped",
+		} {
+			if !strings.Contains(line, want) {
+				t.Errorf("pasajero %s: falta %s en la línea", passenger, want)
+			}
+		}
+		if strings.Contains(line, ">4005</cbc:NameCode>") {
+			t.Errorf("pasajero %s: la permanencia solo se emite para hospedaje", passenger)
+		}
+	}
+}
+
+func TestTourismLodgingStay(t *testing.T) {
+	doc := tourismInvoice()
+	doc.Items[1].TourismDetail.ServiceType = TourismLodging
+	doc.VehiclePlate = "ABC-123"
+
+	xmlData, err := NewUBLConverter(nil).ConvertToUBL(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Split(string(xmlData), "<cac:InvoiceLine>")[2]
+	for _, want := range []string{
+		"Beneficio Hospedajes: Número de Días de Permanencia",
+		`<cbc:DurationMeasure unitCode="DAY">4</cbc:DurationMeasure>`,
+		">7000</cbc:NameCode>",
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("falta %s en la línea de hospedaje", want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+func putUnitMappings(t *testing.T, router http.Handler, ruc string, mappings map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/issuers/"+ruc+"/unit-mappings",
+		strings.NewReader(mustJSON(t, map[string]interface{}{"mappings": mappings})))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-API-Key", "secreto")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func mustJSON(t *testing.T, value interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUnitMappingsAppliedBeforeValidation(t *testing.T) {
+	service := newMemoryService()
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto"}, service)
+
+	rec := putUnitMappings(t, router, "20123456786", map[string]string{"CAJ": "BX", "paq": "pk", "DOC": "DZN"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("registro del mapeo: código %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := putUnitMappings(t, router, "20123456786", map[string]string{"CAJ": "CAJA"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("un destino fuera del catálogo 03 debe rechazarse: código %d", rec.Code)
+	}
+
+	convert := func(number, unitCode string) (APIResponse, string) {
+		doc := sampleDocument()
+		doc.Number = number
+		doc.Items[0].UnitCode = unitCode
+		rec := doJSONRequest(router, http.MethodPost, "/api/v1/convert", convertRequest(t, doc))
+		var resp APIResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unidad %s: código %d: %s", unitCode, rec.Code, rec.Body.String())
+		}
+		xml, err := service.GetStore().Read(resp.DocumentID + ".xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(xml)
+	}
+
+	// El ERP manda "CAJ" y el XML sale con la unidad del catálogo 03
+	resp, xml := convert("101", "CAJ")
+	if !strings.Contains(xml, `unitCode="BX"`) || strings.Contains(xml, `unitCode="CAJ"`) {
+		t.Errorf("se esperaba la unidad BX en el XML")
+	}
+	if applied, ok := resp.Data["unitMappings"].([]interface{}); !ok || len(applied) != 1 {
+		t.Errorf("la respuesta debe indicar el mapeo aplicado: %v", resp.Data)
+	}
+	record := readDocumentRecord(t, service.GetStore(), resp.DocumentID)
+	want := AppliedUnitMapping{Field: "items[0].unitCode", From: "CAJ", To: "BX"}
+	if len(record.UnitMappings) != 1 || record.UnitMappings[0] != want {
+		t.Errorf("el registro debe conservar el mapeo aplicado: %+v", record.UnitMappings)
+	}
+
+	// Los códigos del ERP se comparan sin distinguir mayúsculas
+	if _, xml := convert("102", "paq"); !strings.Contains(xml, `unitCode="PK"`) {
+		t.Errorf("se esperaba la unidad PK en el XML")
+	}
+
+	// Al modificar el mapeo el cache se recarga
+	putUnitMappings(t, router, "20123456786", map[string]string{"CAJ": "PK"})
+	if _, xml := convert("103", "CAJ"); !strings.Contains(xml, `unitCode="PK"`) {
+		t.Errorf("el mapeo modificado debe aplicarse de inmediato")
+	}
+
+	// Una unidad válida del catálogo 03 no se registra como mapeada
+	if resp, _ := convert("104", "NIU"); resp.Data["unitMappings"] != nil {
+		t.Errorf("NIU no debe mapearse: %v", resp.Data["unitMappings"])
+	}
+
+	// Otra instancia sobre el mismo store lee el mapeo guardado
+	other := NewUBLConverterService("")
+	other.SetStore(service.GetStore())
+	if mappings := other.UnitMappings("20123456786"); mappings["CAJ"] != "PK" {
+		t.Errorf("el mapeo debe persistir en el store: %v", mappings)
+	}
+}
+
+func TestUnmappedUnitCodeFails(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	if _, err := service.SetUnitMappings("20123456786", map[string]string{"CAJ": "BX"}); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := sampleDocument()
+	doc.Items[0].UnitCode = "DOC"
+	resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if err != nil || resp.ErrorCode != ValidationFailedCode {
+		t.Fatalf("se esperaba %s, obtenido %v %+v", ValidationFailedCode, err, resp)
+	}
+	var unitErr *ValidationError
+	for i, e := range resp.ValidationErrors {
+		if e.Rule == "unit_code_validation" {
+			unitErr = &resp.ValidationErrors[i]
+		}
+	}
+	if unitErr == nil || unitErr.Field != "items[0].unitCode" || unitErr.Received != "DOC" {
+		t.Fatalf("se esperaba el error de unidad, obtenido %+v", resp.ValidationErrors)
+	}
+	if !strings.Contains(unitErr.Suggestion, "/api/v1/issuers/20123456786/unit-mappings") {
+		t.Errorf("la sugerencia debe indicar cómo registrar el mapeo: %q", unitErr.Suggestion)
+	}
+
+	// Un código válido en minúsculas se corrige con la sugerencia, sin mapeo
+	doc = sampleDocument()
+	doc.Items[0].UnitCode = "niu"
+	resp, _ = service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	if len(resp.ValidationErrors) == 0 || resp.ValidationErrors[0].Suggestion != "Use the catalog 03 code NIU" {
+		t.Errorf("se esperaba la sugerencia en mayúsculas, obtenido %+v", resp.ValidationErrors)
+	}
+
+	// Por HTTP el código sin mapeo llega al validador en lugar de fallar por estructura
+	router, _ := api.NewRouterWithService(&config.Config{}, service)
+	doc = sampleDocument()
+	doc.Items[0].UnitCode = "DOC"
+	rec := doJSONRequest(router, http.MethodPost, "/api/v1/validate", doc)
+	var httpResp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &httpResp)
+	if rec.Code != http.StatusBadRequest || !hasRule(httpResp.ValidationErrors, "unit_code_validation") {
+		t.Errorf("se esperaba 400 con unit_code_validation, obtenido %d %s", rec.Code, rec.Body.String())
+	}
+}
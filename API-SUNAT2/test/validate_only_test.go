@@ -0,0 +1,175 @@
+package test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// signingCertificate retorna el certificado con que se firmó el XML
+func signingCertificate(t *testing.T, xmlData []byte) *x509.Certificate {
+	t.Helper()
+	match := regexp.MustCompile(`<ds:X509Certificate>([^<]+)</ds:X509Certificate>`).FindSubmatch(xmlData)
+	if match == nil {
+		t.Fatal("el XML no tiene ds:X509Certificate")
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(match[1])), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// soapServer simula el endpoint SOAP de SUNAT y cuenta las peticiones que recibe
+func soapServer(t *testing.T) (*httptest.Server, *int64) {
+	t.Helper()
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestValidateOnlyConvert(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetValidateOnly(true)
+
+	response, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || response.Status != "SUCCESS" {
+		t.Fatalf("se esperaba la conversión: %+v %v", response, err)
+	}
+	xmlData, err := service.GetStore().Read(response.DocumentID + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(xmlData), "<cbc:Note>"+ValidateOnlyNote+"</cbc:Note>") {
+		t.Errorf("falta la nota %q:\n%s", ValidateOnlyNote, xmlData)
+	}
+
+	// El certificado del request se ignora
+	if cert := signingCertificate(t, xmlData); cert.Subject.CommonName != "NO VALIDO - PRUEBA" {
+		t.Errorf("se esperaba el certificado de prueba, se firmó con %q", cert.Subject.CommonName)
+	}
+	if certificates, _ := service.ListCertificates(); len(certificates) != 0 {
+		t.Errorf("el certificado de prueba no debe registrarse: %+v", certificates)
+	}
+
+	// Sin certificado en el request también se firma
+	doc := sampleDocument()
+	doc.Number = "2"
+	if response, err := service.ProcessDocument(context.Background(), doc, nil, nil); err != nil || response.Status != "SUCCESS" {
+		t.Errorf("sin certificado se esperaba la conversión: %+v %v", response, err)
+	}
+
+	// Fuera del modo validate-only el XML no lleva la nota
+	service.SetValidateOnly(false)
+	doc.Number = "3"
+	response, _ = service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+	xmlData, _ = service.GetStore().Read(response.DocumentID + ".xml")
+	if strings.Contains(string(xmlData), ValidateOnlyNote) {
+		t.Error("en modo full no se marca el documento")
+	}
+}
+
+func TestValidateOnlyNeverReachesSunat(t *testing.T) {
+	server, hits := soapServer(t)
+	service := newMemoryService()
+	service.SetSunatRouter(NewSunatRouter(SunatCredentials{
+		"*": {
+			EnvironmentBeta:       {URL: server.URL, ConsultURL: server.URL, Username: "u", Password: "p"},
+			EnvironmentProduction: {URL: server.URL, ConsultURL: server.URL, Username: "u", Password: "p"},
+		},
+	}, nil), EnvironmentBeta)
+	documentID := processForSending(t, service, sampleDocument())
+	service.SetValidateOnly(true)
+
+	for _, environment := range []string{"", EnvironmentBeta, EnvironmentProduction, EnvironmentMock} {
+		response, err := service.SendDocument(context.Background(), documentID, environment)
+		if err != nil || response.ErrorCode != ErrValidateOnlyCode {
+			t.Errorf("ambiente %q: se esperaba %s: %+v %v", environment, ErrValidateOnlyCode, response, err)
+		}
+	}
+
+	// Tampoco la reconciliación ni la homologación llegan al cliente SOAP
+	store := service.GetStore()
+	submission, _ := json.Marshal(SubmissionRecord{DocumentID: documentID, Environment: EnvironmentBeta, Status: SubmissionSent, SentAt: time.Now().Add(-24 * time.Hour)})
+	store.Save(documentID+"."+EnvironmentBeta+".envio", submission)
+	service.ReconcileSubmissions(context.Background(), ReconcileOptions{})
+	certPEM, keyPEM := loadTestCredentials(t)
+	service.RunHomologation(context.Background(), HomologationRequest{RUC: "20123456786", Send: true, Environment: EnvironmentBeta}, certPEM, keyPEM)
+
+	if n := atomic.LoadInt64(hits); n != 0 {
+		t.Errorf("el cliente SOAP recibió %d peticiones en modo validate-only", n)
+	}
+}
+
+func TestValidateOnlyRouter(t *testing.T) {
+	server, hits := soapServer(t)
+	credentials := filepath.Join(t.TempDir(), "sunat.json")
+	os.WriteFile(credentials, []byte(`{"*": {"beta": {"url": "`+server.URL+`", "username": "u", "password": "p"}}}`), 0600)
+	storePath := t.TempDir()
+	router, _ := api.NewRouter(&config.Config{
+		Mode:                 ModeValidateOnly,
+		XMLStorePath:         storePath,
+		SunatCredentialsFile: credentials,
+		SunatEnvironment:     EnvironmentProduction,
+	})
+
+	// El certificado es opcional: se firma con el de prueba aunque el ambiente sea producción
+	rec := doJSONRequest(router, http.MethodPost, "/api/v2/convert", map[string]interface{}{"document": sampleDocument()})
+	var converted struct {
+		Status      string `json:"status"`
+		Environment string `json:"environment"`
+		Document    struct {
+			ID string `json:"id"`
+		} `json:"document"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &converted)
+	if rec.Code != http.StatusOK || converted.Environment != ModeValidateOnly {
+		t.Fatalf("convert: código %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(storePath, ValidateOnlyStorePrefix, converted.Document.ID+".xml")); err != nil {
+		t.Errorf("el XML debe guardarse bajo el prefijo %s: %v", ValidateOnlyStorePrefix, err)
+	}
+	if _, err := os.Stat(filepath.Join(storePath, converted.Document.ID+".xml")); err == nil {
+		t.Error("el XML no debe guardarse en el store de producción")
+	}
+
+	rec = doJSONRequest(router, http.MethodPost, "/api/v1/documents/"+converted.Document.ID+"/send", map[string]string{"environment": EnvironmentBeta})
+	var sent APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &sent)
+	if sent.ErrorCode != ErrValidateOnlyCode || sent.Environment != ModeValidateOnly {
+		t.Errorf("send: se esperaba %s: %s", ErrValidateOnlyCode, rec.Body.String())
+	}
+	if n := atomic.LoadInt64(hits); n != 0 {
+		t.Errorf("el cliente SOAP recibió %d peticiones en modo validate-only", n)
+	}
+
+	// Las respuestas fuera del contrato llevan la cabecera
+	rec = doRequest(router, http.MethodGet, "/health", nil)
+	if rec.Header().Get("X-Environment") != ModeValidateOnly || !strings.Contains(rec.Body.String(), `"mode":"validate-only"`) {
+		t.Errorf("health: %v %s", rec.Header(), rec.Body.String())
+	}
+}
@@ -0,0 +1,180 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// invalidCurrencyDocument retorna la factura de ejemplo con una moneda inexistente
+func invalidCurrencyDocument() *BusinessDocument {
+	doc := sampleDocument()
+	doc.Currency = "Soles"
+	return doc
+}
+
+// failedRules retorna cuántas veces falló cada regla en la respuesta
+func failedRules(response *APIResponse) map[string]int {
+	rules := make(map[string]int)
+	for _, validationErr := range response.ValidationErrors {
+		rules[validationErr.Rule]++
+	}
+	return rules
+}
+
+func TestValidationStatsAggregator(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetClock(&fixedClock{now: time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)})
+	stop := service.StartValidationStats(time.Hour, 10)
+	defer stop()
+
+	// /validate y /convert se contabilizan igual
+	_, failure := service.ValidateDocument(context.Background(), invalidCurrencyDocument())
+	if failure == nil {
+		t.Fatal("se esperaba un documento inválido")
+	}
+	expected := failedRules(failure)
+	response, err := service.ProcessDocument(context.Background(), invalidCurrencyDocument(), certPEM, keyPEM)
+	if err != nil || response.ErrorCode != ValidationFailedCode {
+		t.Fatalf("se esperaba la validación fallida: %+v %v", response, err)
+	}
+	// Un documento válido no suma
+	processForSending(t, service, sampleDocument())
+
+	// Hasta el flush los conteos están solo en memoria
+	name := ValidationStatsName("20123456786", "2024-06-07")
+	if _, err := service.GetStore().Read(name); err == nil {
+		t.Fatal("no se esperaba el archivo antes del flush")
+	}
+	if err := service.FlushValidationStats(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Un segundo flush suma a lo ya guardado
+	service.ValidateDocument(context.Background(), invalidCurrencyDocument())
+	if err := service.FlushValidationStats(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := service.GetStore().Read(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var day ValidationStatsDay
+	if err := json.Unmarshal(data, &day); err != nil {
+		t.Fatal(err)
+	}
+	for rule, count := range expected {
+		stats := day.Rules[rule]
+		if stats == nil || stats.Count != 3*count {
+			t.Errorf("regla %s: se esperaban %d fallos: %+v", rule, 3*count, stats)
+		}
+	}
+
+	// Los ejemplos conservan el formato pero no el valor recibido
+	if strings.Contains(string(data), "Soles") || !strings.Contains(string(data), `"received":"Xxxxx"`) {
+		t.Errorf("los ejemplos deben anonimizarse: %s", data)
+	}
+
+	// Al detenerse se escribe lo pendiente
+	doc := invalidCurrencyDocument()
+	doc.Issuer.DocumentID = "../../etc"
+	service.ValidateDocument(context.Background(), doc)
+	stop()
+	if _, err := service.GetStore().Read(ValidationStatsName("sin-ruc", "2024-06-07")); err != nil {
+		t.Errorf("un RUC inválido se agrupa como sin-ruc: %v", err)
+	}
+}
+
+func TestValidationReport(t *testing.T) {
+	service := newMemoryService()
+	clock := &fixedClock{now: time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)}
+	service.SetClock(clock)
+	service.StartValidationStats(time.Hour, 10)
+
+	validate := func(modify func(doc *BusinessDocument)) {
+		doc := sampleDocument()
+		modify(doc)
+		if _, failure := service.ValidateDocument(context.Background(), doc); failure == nil {
+			t.Fatal("se esperaba un documento inválido")
+		}
+	}
+	badCurrency := func(doc *BusinessDocument) { doc.Currency = "Soles" }
+	badDate := func(doc *BusinessDocument) { doc.IssueDate = "07/06/2024" }
+
+	validate(badCurrency)
+	validate(badCurrency)
+	validate(badDate)
+	clock.now = clock.now.AddDate(0, 0, 1)
+	validate(badDate)
+	validate(func(doc *BusinessDocument) {
+		doc.Issuer.DocumentID = "20100000001"
+		doc.Currency = "Soles"
+	})
+
+	report, err := service.ValidationReport("20123456786", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rules) == 0 || report.Total == 0 {
+		t.Fatalf("reporte vacío: %+v", report)
+	}
+	for i := 1; i < len(report.Rules); i++ {
+		if report.Rules[i].Count > report.Rules[i-1].Count {
+			t.Errorf("el ranking debe ir de mayor a menor: %+v", report.Rules)
+		}
+	}
+
+	// El rango de fechas y el RUC filtran los días contabilizados
+	all, _ := service.ValidationReport("", "", "")
+	firstDay, _ := service.ValidationReport("20123456786", "2024-06-07", "2024-06-07")
+	other, _ := service.ValidationReport("20100000001", "", "")
+	if all.Total != report.Total+other.Total || firstDay.Total >= report.Total || other.Total == 0 {
+		t.Errorf("filtros inesperados: todos %d, emisor %d, primer día %d, otro %d", all.Total, report.Total, firstDay.Total, other.Total)
+	}
+
+	for _, invalid := range [][2]string{{"07/06/2024", ""}, {"2024-06-08", "2024-06-07"}} {
+		if _, err := service.ValidationReport("", invalid[0], invalid[1]); err == nil {
+			t.Errorf("se esperaba error con el rango %v", invalid)
+		}
+	}
+}
+
+func TestValidationReportEndpoint(t *testing.T) {
+	service := newMemoryService()
+	service.StartValidationStats(time.Hour, 10)
+	service.ValidateDocument(context.Background(), invalidCurrencyDocument())
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "secreto", IssuerAPIKeys: "clave-emisor:20123456786"}, service)
+
+	issuer := map[string]string{"X-API-Key": "clave-emisor"}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/reports/validation?ruc=20100000001", issuer); rec.Code != http.StatusForbidden {
+		t.Errorf("otro RUC: se esperaba 403, se obtuvo %d", rec.Code)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/reports/validation", issuer); rec.Code != http.StatusForbidden {
+		t.Errorf("sin RUC una clave de emisor no ve a todos: se obtuvo %d", rec.Code)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/reports/validation?from=ayer", map[string]string{"X-Admin-API-Key": "secreto"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("fecha inválida: se esperaba 400, se obtuvo %d", rec.Code)
+	}
+
+	rec := doRequest(router, http.MethodGet, "/api/v1/reports/validation?ruc=20123456786", issuer)
+	var resp struct {
+		Data struct {
+			Validation ValidationReport `json:"validation"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("código %d: %s", rec.Code, rec.Body.String())
+	}
+	if report := resp.Data.Validation; report.RUC != "20123456786" || report.Total == 0 || len(report.Rules[0].Examples) == 0 {
+		t.Errorf("reporte inesperado: %+v", report)
+	}
+}
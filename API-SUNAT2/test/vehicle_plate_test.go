@@ -0,0 +1,57 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+)
+
+func TestVehiclePlateValidation(t *testing.T) {
+	validator := NewValidationService(nil)
+	cases := []struct {
+		plate string
+		valid bool
+	}{
+		{"", true},
+		{"ABC-123", true},
+		{"abc123", true},
+		{"A1B-234", true},
+		{"1234-AB", true},
+		{"AB-123", false},
+		{"123-456", false},
+		{"ABCD-1234", false},
+	}
+	for _, tc := range cases {
+		doc := sampleDocument()
+		doc.VehiclePlate = tc.plate
+		invalid := hasRule(validator.ValidateBusinessDocument(doc), "vehicle_plate_validation")
+		if invalid == tc.valid {
+			t.Errorf("placa %q: válida esperada %v", tc.plate, tc.valid)
+		}
+	}
+}
+
+func TestVehiclePlateSerialization(t *testing.T) {
+	converter := NewUBLConverter(nil)
+
+	doc := sampleDocument()
+	xmlData, err := converter.ConvertToUBL(doc)
+	if err != nil {
+		t.Fatalf("conversión falló: %v", err)
+	}
+	if strings.Contains(string(xmlData), "AdditionalItemProperty") {
+		t.Fatalf("sin placa no debe emitirse AdditionalItemProperty")
+	}
+
+	doc.VehiclePlate = "abc-123"
+	xmlData, err = converter.ConvertToUBL(doc)
+	if err != nil {
+		t.Fatalf("conversión falló: %v", err)
+	}
+	for _, want := range []string{"catalogo55", ">7000</cbc:NameCode>", "<cbc:Value>ABC-123</cbc:Value>"} {
+		if !strings.Contains(string(xmlData), want) {
+			t.Fatalf("se esperaba %q en el XML", want)
+		}
+	}
+}
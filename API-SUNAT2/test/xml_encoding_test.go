@@ -0,0 +1,127 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+	. "API-SUNAT2/util"
+)
+
+// signedDigestMatches verifica que la firma corresponda a los bytes finales del XML,
+// es decir, a los bytes escritos antes de firmar
+func signedDigestMatches(t *testing.T, signed []byte) bool {
+	t.Helper()
+	results, err := NewDigitalSignatureService(nil).VerifySignatures(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(results) == 1 && results[0].Valid
+}
+
+func TestXMLEncodingOutput(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	description := "Café de altura ñandú"
+
+	cases := []struct {
+		encoding    string
+		declaration string
+		bom         bool
+		text        []byte
+	}{
+		{XMLEncodingUTF8, `encoding="UTF-8"`, false, []byte(description)},
+		{XMLEncodingUTF8BOM, `encoding="UTF-8"`, true, []byte(description)},
+		{XMLEncodingLatin1, `encoding="ISO-8859-1"`, false, []byte("Caf\xe9 de altura \xf1and\xfa")},
+	}
+
+	for _, tc := range cases {
+		service := newMemoryService()
+		service.SetXMLEncoding(tc.encoding)
+		doc := sampleDocument()
+		doc.Items[0].Description = description
+
+		pipeline := service.NewDefaultPipeline()
+		pipeline.SetWriter(nil)
+		ctx, err := pipeline.Run(context.Background(), doc, certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.encoding, err)
+		}
+
+		if hasBOM := bytes.HasPrefix(ctx.XML, []byte{0xEF, 0xBB, 0xBF}); hasBOM != tc.bom {
+			t.Errorf("%s: BOM presente = %v, esperado %v", tc.encoding, hasBOM, tc.bom)
+		}
+		if !bytes.Contains(ctx.XML[:60], []byte(tc.declaration)) {
+			t.Errorf("%s: se esperaba la declaración %s, obtenido %q", tc.encoding, tc.declaration, ctx.XML[:60])
+		}
+		if !bytes.Contains(ctx.XML, tc.text) {
+			t.Errorf("%s: la descripción no está codificada como se esperaba", tc.encoding)
+		}
+		if !signedDigestMatches(t, ctx.XML) {
+			t.Errorf("%s: el digest no corresponde a los bytes finales", tc.encoding)
+		}
+	}
+}
+
+func TestXMLEncodingEmoji(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+
+	for _, encoding := range []string{XMLEncodingUTF8, XMLEncodingUTF8BOM, XMLEncodingLatin1} {
+		service := newMemoryService()
+		service.SetXMLEncoding(encoding)
+		doc := sampleDocument()
+		doc.Items[0].Description = "Torta de cumpleaños 🎂"
+
+		resp, err := service.ProcessDocument(context.Background(), doc, certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoding != XMLEncodingLatin1 {
+			if resp.Status != "SUCCESS" {
+				t.Errorf("%s: se esperaba éxito, obtenido %+v", encoding, resp)
+				continue
+			}
+			stored, _ := service.GetStore().Read(resp.DocumentID + ".xml")
+			if !strings.Contains(string(stored), "Torta de cumpleaños 🎂") {
+				t.Errorf("%s: se esperaba el emoji en UTF-8", encoding)
+			}
+			continue
+		}
+
+		if resp.ErrorCode != "ERR_XML_ENCODING" || !strings.Contains(resp.ErrorMessage, "U+1F382") || !strings.Contains(resp.ErrorMessage, "cbc:Description") {
+			t.Errorf("se esperaba ERR_XML_ENCODING indicando el carácter y el elemento, obtenido %s: %s", resp.ErrorCode, resp.ErrorMessage)
+		}
+		if names, _ := service.GetStore().List(); len(names) != 0 {
+			t.Errorf("no debe guardarse un XML que no se pudo codificar: %v", names)
+		}
+	}
+
+	_, err := EncodeXML([]byte(`<?xml version="1.0" encoding="UTF-8"?><a>🎂</a>`), XMLEncodingLatin1)
+	var charErr *UnrepresentableCharError
+	if !errors.As(err, &charErr) || charErr.Char != '🎂' || charErr.Element != "a" {
+		t.Errorf("se esperaba UnrepresentableCharError en <a>, obtenido %v", err)
+	}
+}
+
+func TestXMLEncodingReadBack(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.SetXMLEncoding(XMLEncodingLatin1)
+
+	boleta := sampleBoleta("1")
+	boleta.Items[0].Description = "Piña"
+	if resp, err := service.ProcessDocument(context.Background(), boleta, certPEM, keyPEM); err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("se esperaba éxito: %v %+v", err, resp)
+	}
+
+	// El canje lee el importe de la boleta guardada en ISO-8859-1
+	invoice := sampleDocument()
+	invoice.ExchangedDocuments = []DocumentReference{{DocumentType: "03", DocumentID: "B001-1"}}
+	resp, err := service.ProcessDocument(context.Background(), invoice, certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("se esperaba leer la boleta en ISO-8859-1: %v %+v", err, resp)
+	}
+}
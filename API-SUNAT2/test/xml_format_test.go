@@ -0,0 +1,109 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	. "API-SUNAT2/service"
+	. "API-SUNAT2/util"
+)
+
+// crlfInvoice es un XML escrito en Windows: con declaración, CRLF y salto final
+const crlfInvoice = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n" +
+	"<Invoice xmlns=\"urn:oasis:names:specification:ubl:schema:xsd:Invoice-2\" xmlns:cbc=\"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2\">\r\n" +
+	"  <cbc:ID>F001-1</cbc:ID>\r\n" +
+	"</Invoice>\r\n\r\n"
+
+func TestXMLFormatLineEndings(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	inputs := map[string]string{
+		"CRLF":                 crlfInvoice,
+		"declaración doble":    "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" + crlfInvoice,
+		"BOM y CR sueltos":     "\xEF\xBB\xBF" + strings.ReplaceAll(crlfInvoice, "\r\n", "\r"),
+		"sin declaración":      strings.SplitN(crlfInvoice, "\r\n", 2)[1],
+		"declaración con LF":   strings.ReplaceAll(crlfInvoice, "\r\n", "\n"),
+		"espacios al comienzo": "\r\n  " + crlfInvoice,
+	}
+	for _, lineEnding := range []string{XMLLineEndingLF, XMLLineEndingCRLF} {
+		signer := NewDigitalSignatureService(nil)
+		signer.SetXMLFormat(XMLFormat{LineEnding: lineEnding})
+		for name, input := range inputs {
+			signed, err := signer.SignXML([]byte(input), certPEM, keyPEM)
+			if err != nil {
+				t.Fatalf("%s %s: %v", lineEnding, name, err)
+			}
+			text := strings.TrimPrefix(string(signed), "\xEF\xBB\xBF")
+			if strings.Count(text, "<?xml") != 1 || !strings.HasPrefix(text, `<?xml version="1.0" encoding="UTF-8"?>`) {
+				t.Errorf("%s %s: se esperaba una sola declaración al inicio:\n%.120s", lineEnding, name, text)
+			}
+			lines := strings.Count(text, "\n")
+			switch lineEnding {
+			case XMLLineEndingLF:
+				if strings.Contains(text, "\r") {
+					t.Errorf("%s %s: quedan CR en el XML", lineEnding, name)
+				}
+			case XMLLineEndingCRLF:
+				if strings.Count(text, "\r\n") != lines || strings.Count(text, "\r") != lines {
+					t.Errorf("%s %s: fines de línea mezclados", lineEnding, name)
+				}
+			}
+			if !strings.HasSuffix(text, "</Invoice>") {
+				t.Errorf("%s %s: el archivo debe terminar en el cierre del elemento raíz: %q", lineEnding, name, text[len(text)-20:])
+			}
+			if !signedDigestMatches(t, signed) {
+				t.Errorf("%s %s: la firma no corresponde a los bytes normalizados", lineEnding, name)
+			}
+		}
+	}
+
+	// La salida no depende de cómo llegaron los fines de línea (la firma PKCS#1 v1.5 es
+	// determinista para una misma clave)
+	signer := NewDigitalSignatureService(nil)
+	lf, _ := signer.SignXML([]byte(inputs["declaración con LF"]), certPEM, keyPEM)
+	crlf, _ := signer.SignXML([]byte(crlfInvoice), certPEM, keyPEM)
+	if !bytes.Equal(lf, crlf) {
+		t.Error("el XML firmado cambia según los fines de línea de entrada")
+	}
+}
+
+func TestXMLFormatOmitDeclaration(t *testing.T) {
+	utf8 := NormalizeXML([]byte(crlfInvoice), XMLFormat{OmitDeclaration: true})
+	if !bytes.HasPrefix(utf8, []byte("<Invoice ")) {
+		t.Errorf("la declaración UTF-8 debe omitirse: %.60q", utf8)
+	}
+
+	// Sin declaración un XML ISO-8859-1 se leería como UTF-8
+	latin1 := strings.Replace(crlfInvoice, "UTF-8", "ISO-8859-1", 1)
+	kept := NormalizeXML([]byte(latin1), XMLFormat{OmitDeclaration: true})
+	if !bytes.HasPrefix(kept, []byte(`<?xml version="1.0" encoding="ISO-8859-1"?>`+"\n<Invoice ")) {
+		t.Errorf("la declaración ISO-8859-1 debe conservarse: %.80q", kept)
+	}
+
+	// Las instrucciones de procesamiento que empiezan con xml no son declaraciones
+	stylesheet := "<?xml version=\"1.0\"?>\n<?xml-stylesheet href=\"factura.xsl\"?>\n<Invoice/>"
+	if normalized := NormalizeXML([]byte(stylesheet), XMLFormat{}); string(normalized) != stylesheet {
+		t.Errorf("se perdió la instrucción xml-stylesheet: %q", normalized)
+	}
+}
+
+func TestXMLFormatPipeline(t *testing.T) {
+	certPEM, keyPEM := loadTestCredentials(t)
+	service := newMemoryService()
+	service.GetSigner().SetXMLFormat(XMLFormat{LineEnding: XMLLineEndingCRLF})
+	resp, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("procesamiento falló: %v %+v", err, resp)
+	}
+	stored, _ := service.GetStore().Read(resp.DocumentID + ".xml")
+	if bytes.Count(stored, []byte("\n")) == 0 || bytes.Count(stored, []byte("\r\n")) != bytes.Count(stored, []byte("\n")) {
+		t.Error("el XML guardado debe tener solo CRLF")
+	}
+	if bytes.Count(stored, []byte("<?xml")) != 1 {
+		t.Error("el XML guardado debe tener una sola declaración")
+	}
+	if !signedDigestMatches(t, stored) {
+		t.Error("la firma del XML guardado no es válida")
+	}
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"API-SUNAT2/api"
+	"API-SUNAT2/config"
+	. "API-SUNAT2/model"
+	. "API-SUNAT2/service"
+)
+
+// attachedZIPClient guarda el ZIP tal como se le entregó para adjuntarlo al SOAP
+type attachedZIPClient struct {
+	mockSunatClient
+	attached []byte
+}
+
+func (m *attachedZIPClient) SendBill(ctx context.Context, fileName string, zipData []byte) ([]byte, error) {
+	m.attached = append([]byte(nil), zipData...)
+	return m.mockSunatClient.SendBill(ctx, fileName, zipData)
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func TestZIPHashRegisteredOnSend(t *testing.T) {
+	client := &attachedZIPClient{}
+	service := newMemoryService()
+	service.SetSunatRouter(NewSunatRouter(SunatCredentials{"*": {EnvironmentBeta: {}}}, func(SunatEndpoint) SunatClient { return client }), EnvironmentBeta)
+
+	certPEM, keyPEM := loadTestCredentials(t)
+	resp, err := service.ProcessDocument(context.Background(), sampleDocument(), certPEM, keyPEM)
+	if err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("procesamiento falló: %v %+v", err, resp)
+	}
+	documentID := resp.DocumentID
+	zipData, _ := service.GetStore().Read(documentID + ".zip")
+	if resp.Data["zipHash"] != sha256Hex(zipData) || resp.Data["zipSize"] != int64(len(zipData)) {
+		t.Errorf("respuesta de /convert: %v %v", resp.Data["zipHash"], resp.Data["zipSize"])
+	}
+	var record DocumentRecord
+	data, _ := service.GetStore().Read(RecordName(documentID))
+	json.Unmarshal(data, &record)
+	if record.ZIPHash != sha256Hex(zipData) || record.ZIPSize != int64(len(zipData)) {
+		t.Errorf("registro del documento: %s %d", record.ZIPHash, record.ZIPSize)
+	}
+
+	sent, err := service.SendDocument(context.Background(), documentID, EnvironmentBeta)
+	if err != nil || sent.Status != "SUCCESS" {
+		t.Fatalf("envío falló: %v %+v", err, sent)
+	}
+	attachedHash := sha256Hex(client.attached)
+	if sent.Data["zipHash"] != attachedHash || sent.Data["zipSize"] != int64(len(client.attached)) {
+		t.Errorf("respuesta del envío: %v %v, adjunto %s", sent.Data["zipHash"], sent.Data["zipSize"], attachedHash)
+	}
+	submissions, _ := service.ListSubmissions(EnvironmentBeta)
+	if len(submissions) != 1 || submissions[0].ZIPHash != attachedHash || submissions[0].ZIPSize != int64(len(client.attached)) {
+		t.Errorf("registro del envío: %+v", submissions)
+	}
+
+	report, err := service.CheckZIPIntegrity("")
+	if err != nil || report.Checked != 2 || len(report.Issues) != 0 {
+		t.Fatalf("ZIP sin cambios: %+v %v", report, err)
+	}
+}
+
+func TestZIPIntegrityDetectsChanges(t *testing.T) {
+	service := newMemoryService()
+	service.SetSunatMock(&mockSunatClient{})
+	documentID := processForSending(t, service, sampleDocument())
+	other := sampleDocument()
+	other.Number = "123457"
+	otherID := processForSending(t, service, other)
+	if resp, err := service.SendDocument(context.Background(), documentID, ""); err != nil || resp.Status != "SUCCESS" {
+		t.Fatalf("envío falló: %v %+v", err, resp)
+	}
+
+	// Modificar el ZIP después de enviarlo
+	store := service.GetStore()
+	original, _ := store.Read(documentID + ".zip")
+	tampered := append(append([]byte(nil), original...), 0)
+	store.Save(documentID+".zip", tampered)
+
+	report, err := service.CheckZIPIntegrity("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 3 || len(report.Issues) != 2 {
+		t.Fatalf("se esperaban 2 discrepancias en 3 registros: %+v", report)
+	}
+	references := map[string]bool{}
+	for _, issue := range report.Issues {
+		references[issue.Reference] = true
+		if issue.DocumentID != documentID || issue.ExpectedHash != sha256Hex(original) || issue.ExpectedSize != int64(len(original)) ||
+			issue.ActualHash != sha256Hex(tampered) || issue.ActualSize != int64(len(tampered)) {
+			t.Errorf("discrepancia: %+v", issue)
+		}
+	}
+	if !references[ZIPReferenceGenerated] || !references[EnvironmentMock] {
+		t.Errorf("referencias: %v", references)
+	}
+
+	// Un ZIP eliminado también se reporta; el filtro limita la revisión a un documento
+	store.Delete(otherID + ".zip")
+	report, _ = service.CheckZIPIntegrity(otherID)
+	if report.Checked != 1 || len(report.Issues) != 1 || report.Issues[0].Message != "ZIP file is missing" {
+		t.Errorf("ZIP faltante: %+v", report)
+	}
+
+	router, _ := api.NewRouterWithService(&config.Config{AdminAPIKey: "admin"}, service)
+	rec := doRequest(router, http.MethodGet, "/api/v1/admin/reports/zip-integrity?documentId="+documentID, map[string]string{"X-Admin-API-Key": "admin"})
+	var resp struct {
+		Data struct {
+			Report ZIPIntegrityReport `json:"report"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Data.Report.Issues) != 2 {
+		t.Errorf("endpoint: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,15 @@
+package util
+
+import "time"
+
+// Clock abstrae la hora actual para poder inyectar relojes fijos en pruebas
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock usa la hora del sistema
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
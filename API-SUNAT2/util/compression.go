@@ -0,0 +1,283 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultGzipMaxDecompressedBytes es el tamaño máximo de un body de entrada ya
+// descomprimido; lo que lo excede se rechaza como posible zip bomb
+const DefaultGzipMaxDecompressedBytes = 64 * 1024 * 1024
+
+// DefaultGzipMinSize es el tamaño mínimo de una respuesta para comprimirla; por debajo
+// la cabecera gzip no compensa
+const DefaultGzipMinSize = 1024
+
+// GzipOptions configura GzipMiddleware; los valores en cero usan los por defecto
+type GzipOptions struct {
+	MaxDecompressedBytes int64
+	MinSize              int
+}
+
+// CompressionMetrics acumula los bytes antes y después de la compresión, de los bodies
+// de entrada y de las respuestas
+type CompressionMetrics struct {
+	requests, requestCompressed, requestExpanded    int64
+	responses, responseOriginal, responseCompressed int64
+	rejected                                        int64
+}
+
+// NewCompressionMetrics crea las métricas vacías
+func NewCompressionMetrics() *CompressionMetrics {
+	return &CompressionMetrics{}
+}
+
+// WriteMetrics escribe en formato de texto de Prometheus los bytes comprimidos y
+// descomprimidos y el ratio de compresión de las respuestas
+func (m *CompressionMetrics) WriteMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP http_gzip_requests_total Bodies de entrada gzip descomprimidos y rechazados por exceder el límite")
+	fmt.Fprintln(w, "# TYPE http_gzip_requests_total counter")
+	fmt.Fprintf(w, "http_gzip_requests_total{result=\"decompressed\"} %d\n", atomic.LoadInt64(&m.requests))
+	fmt.Fprintf(w, "http_gzip_requests_total{result=\"rejected\"} %d\n", atomic.LoadInt64(&m.rejected))
+	fmt.Fprintln(w, "# HELP http_gzip_request_bytes_total Bytes de los bodies de entrada gzip, comprimidos y expandidos")
+	fmt.Fprintln(w, "# TYPE http_gzip_request_bytes_total counter")
+	fmt.Fprintf(w, "http_gzip_request_bytes_total{stage=\"compressed\"} %d\n", atomic.LoadInt64(&m.requestCompressed))
+	fmt.Fprintf(w, "http_gzip_request_bytes_total{stage=\"expanded\"} %d\n", atomic.LoadInt64(&m.requestExpanded))
+	fmt.Fprintln(w, "# HELP http_gzip_responses_total Respuestas comprimidas con gzip")
+	fmt.Fprintln(w, "# TYPE http_gzip_responses_total counter")
+	fmt.Fprintf(w, "http_gzip_responses_total %d\n", atomic.LoadInt64(&m.responses))
+	fmt.Fprintln(w, "# HELP http_gzip_response_bytes_total Bytes de las respuestas comprimidas, antes y después de comprimir")
+	fmt.Fprintln(w, "# TYPE http_gzip_response_bytes_total counter")
+	original, compressed := atomic.LoadInt64(&m.responseOriginal), atomic.LoadInt64(&m.responseCompressed)
+	fmt.Fprintf(w, "http_gzip_response_bytes_total{stage=\"original\"} %d\n", original)
+	fmt.Fprintf(w, "http_gzip_response_bytes_total{stage=\"compressed\"} %d\n", compressed)
+	fmt.Fprintln(w, "# HELP http_gzip_response_ratio Bytes comprimidos sobre bytes originales de las respuestas")
+	fmt.Fprintln(w, "# TYPE http_gzip_response_ratio gauge")
+	ratio := 0.0
+	if original > 0 {
+		ratio = float64(compressed) / float64(original)
+	}
+	fmt.Fprintf(w, "http_gzip_response_ratio %.4f\n", ratio)
+}
+
+// GzipMiddleware descomprime los bodies con Content-Encoding: gzip, con un límite del
+// tamaño expandido, y comprime con gzip las respuestas de texto si el cliente envía
+// Accept-Encoding: gzip. Los ZIP y demás contenidos binarios no se recomprimen.
+func GzipMiddleware(opts GzipOptions, metrics *CompressionMetrics) gin.HandlerFunc {
+	if opts.MaxDecompressedBytes <= 0 {
+		opts.MaxDecompressedBytes = DefaultGzipMaxDecompressedBytes
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = DefaultGzipMinSize
+	}
+	if metrics == nil {
+		metrics = NewCompressionMetrics()
+	}
+
+	return func(c *gin.Context) {
+		if encoding := strings.TrimSpace(c.GetHeader("Content-Encoding")); encoding != "" && !strings.EqualFold(encoding, "identity") {
+			if !strings.EqualFold(encoding, "gzip") {
+				c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+					"status":       "error",
+					"errorCode":    "ERR_UNSUPPORTED_ENCODING",
+					"errorMessage": fmt.Sprintf("Unsupported Content-Encoding %q, only gzip is accepted", encoding),
+				})
+				return
+			}
+			if !decompressBody(c, opts.MaxDecompressedBytes, metrics) {
+				return
+			}
+		}
+
+		if c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		writer := &gzipResponseWriter{ResponseWriter: c.Writer, minSize: opts.MinSize, metrics: metrics}
+		c.Writer = writer
+		defer writer.finish()
+		c.Next()
+	}
+}
+
+// decompressBody reemplaza el body gzip del request por su contenido expandido. Si el
+// gzip es inválido o se expande por encima de limit, responde el error y retorna false.
+func decompressBody(c *gin.Context, limit int64, metrics *CompressionMetrics) bool {
+	compressed := &countingReader{reader: c.Request.Body}
+	reader, err := gzip.NewReader(compressed)
+	var expanded []byte
+	if err == nil {
+		// Se lee un byte más que el límite para distinguir "justo en el límite" de "excedido"
+		expanded, err = io.ReadAll(io.LimitReader(reader, limit+1))
+		reader.Close()
+	}
+	c.Request.Body.Close()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"status":       "error",
+			"errorCode":    "ERR_INVALID_REQUEST",
+			"errorMessage": fmt.Sprintf("Invalid gzip body: %v", err),
+		})
+		return false
+	}
+	if int64(len(expanded)) > limit {
+		atomic.AddInt64(&metrics.rejected, 1)
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"status":       "error",
+			"errorCode":    "ERR_PAYLOAD_TOO_LARGE",
+			"errorMessage": fmt.Sprintf("Decompressed body exceeds %d bytes", limit),
+		})
+		return false
+	}
+
+	atomic.AddInt64(&metrics.requests, 1)
+	atomic.AddInt64(&metrics.requestCompressed, compressed.count)
+	atomic.AddInt64(&metrics.requestExpanded, int64(len(expanded)))
+	c.Request.Body = io.NopCloser(bytes.NewReader(expanded))
+	c.Request.ContentLength = int64(len(expanded))
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.Header.Del("Content-Length")
+	return true
+}
+
+// acceptsGzip indica si el header Accept-Encoding acepta gzip con q mayor a cero
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		if params = strings.ReplaceAll(params, " ", ""); strings.HasPrefix(params, "q=") {
+			q, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			return err == nil && q > 0
+		}
+		return true
+	}
+	return false
+}
+
+// compressibleContentType indica si vale la pena comprimir una respuesta por su tipo:
+// JSON, XML, CSV y texto. Los ZIP y binarios ya están comprimidos o no ganan nada.
+func compressibleContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/json", mediaType == "application/xml", mediaType == "application/x-ndjson",
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter retiene los primeros bytes de la respuesta hasta decidir si se
+// comprime: por el Content-Type y por alcanzar minSize
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minSize int
+	metrics *CompressionMetrics
+
+	pending    bytes.Buffer
+	bypass     bool
+	gz         *gzip.Writer
+	compressed *countingWriter
+	original   int64
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.bypass {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.gz != nil {
+		w.original += int64(len(data))
+		return w.gz.Write(data)
+	}
+	if w.Header().Get("Content-Encoding") != "" || !compressibleContentType(w.Header().Get("Content-Type")) {
+		w.bypass = true
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.pending.Write(data)
+	if w.pending.Len() >= w.minSize {
+		if err := w.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush comprime lo retenido para no demorar una respuesta que se envía por partes
+func (w *gzipResponseWriter) Flush() {
+	if w.gz == nil && w.pending.Len() > 0 {
+		w.startGzip()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// startGzip fija las cabeceras de la respuesta comprimida y comprime lo retenido
+func (w *gzipResponseWriter) startGzip() error {
+	header := w.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+
+	w.compressed = &countingWriter{writer: w.ResponseWriter}
+	w.gz = gzip.NewWriter(w.compressed)
+	w.original = int64(w.pending.Len())
+	_, err := w.gz.Write(w.pending.Bytes())
+	w.pending.Reset()
+	return err
+}
+
+// finish cierra el gzip o, si la respuesta no llegó a minSize, la escribe tal cual
+func (w *gzipResponseWriter) finish() {
+	if w.gz == nil {
+		if w.pending.Len() > 0 {
+			w.ResponseWriter.Write(w.pending.Bytes())
+		}
+		return
+	}
+	w.gz.Close()
+	atomic.AddInt64(&w.metrics.responses, 1)
+	atomic.AddInt64(&w.metrics.responseOriginal, w.original)
+	atomic.AddInt64(&w.metrics.responseCompressed, w.compressed.count)
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,226 @@
+// Package httpclient construye los clientes HTTP de los integradores externos (SUNAT,
+// padrón, TSA) sobre un transport compartido, con timeout por destino y métricas de
+// latencia.
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Destinos de las salidas HTTP
+const (
+	DestinationSunat   = "sunat"
+	DestinationPadron  = "padron"
+	DestinationTSA     = "tsa"
+	DestinationWebhook = "webhook"
+	DestinationEvents  = "events"
+	DestinationTime    = "time"
+	DestinationKMS     = "kms"
+)
+
+// Options configura el transport compartido y los timeouts por destino
+type Options struct {
+	// ProxyURL es el proxy corporativo; vacío usa HTTP_PROXY/HTTPS_PROXY del entorno
+	ProxyURL            string
+	MaxConnsPerHost     int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	KeepAlive           time.Duration
+	DialTimeout         time.Duration
+	// Timeouts es el timeout total del request por destino; DefaultTimeout aplica al resto
+	Timeouts       map[string]time.Duration
+	DefaultTimeout time.Duration
+}
+
+// DefaultOptions retorna los límites y timeouts usados si no se configuran otros
+func DefaultOptions() Options {
+	return Options{
+		MaxConnsPerHost:     20,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		DialTimeout:         5 * time.Second,
+		Timeouts: map[string]time.Duration{
+			DestinationSunat:  60 * time.Second,
+			DestinationPadron: 10 * time.Second,
+			DestinationTSA:    10 * time.Second,
+			DestinationTime:   10 * time.Second,
+			DestinationKMS:    10 * time.Second,
+		},
+		DefaultTimeout: 30 * time.Second,
+	}
+}
+
+// Pool entrega un cliente por destino; todos comparten el mismo transport y su pool
+// de conexiones
+type Pool struct {
+	transport      *http.Transport
+	timeouts       map[string]time.Duration
+	defaultTimeout time.Duration
+	metrics        *Metrics
+
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+func NewPool(opts Options) (*Pool, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.ProxyURL)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{Timeout: opts.DialTimeout, KeepAlive: opts.KeepAlive}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	timeouts := make(map[string]time.Duration)
+	for destination, timeout := range opts.Timeouts {
+		timeouts[destination] = timeout
+	}
+	return &Pool{
+		transport:      transport,
+		timeouts:       timeouts,
+		defaultTimeout: opts.DefaultTimeout,
+		metrics:        NewMetrics(),
+		clients:        make(map[string]*http.Client),
+	}, nil
+}
+
+var (
+	defaultPool     *Pool
+	defaultPoolOnce sync.Once
+)
+
+// Default retorna un pool con DefaultOptions compartido por el proceso; lo usan los
+// integradores que no reciben un cliente
+func Default() *Pool {
+	defaultPoolOnce.Do(func() {
+		defaultPool, _ = NewPool(DefaultOptions())
+	})
+	return defaultPool
+}
+
+// Client retorna el cliente del destino, con su timeout y métricas de latencia. Se
+// crea una sola vez por destino.
+func (p *Pool) Client(destination string) *http.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if client, ok := p.clients[destination]; ok {
+		return client
+	}
+	timeout, ok := p.timeouts[destination]
+	if !ok {
+		timeout = p.defaultTimeout
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: &measuredTransport{destination: destination, next: p.transport, metrics: p.metrics},
+	}
+	p.clients[destination] = client
+	return client
+}
+
+// Metrics retorna las métricas de latencia por destino
+func (p *Pool) Metrics() *Metrics {
+	return p.metrics
+}
+
+// CloseIdleConnections cierra las conexiones ociosas del transport compartido
+func (p *Pool) CloseIdleConnections() {
+	p.transport.CloseIdleConnections()
+}
+
+// measuredTransport registra la latencia de cada request de un destino
+type measuredTransport struct {
+	destination string
+	next        http.RoundTripper
+	metrics     *Metrics
+}
+
+func (t *measuredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	t.metrics.Record(t.destination, time.Since(start), err != nil || resp.StatusCode >= 500)
+	return resp, err
+}
+
+// LatencyStats resume la latencia de los requests a un destino
+type LatencyStats struct {
+	Count  int64   `json:"count"`
+	Errors int64   `json:"errors"`
+	AvgMs  float64 `json:"avgMs"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+// Metrics acumula la latencia de los requests por destino
+type Metrics struct {
+	mu    sync.Mutex
+	stats map[string]*latencyTotals
+}
+
+type latencyTotals struct {
+	count  int64
+	errors int64
+	total  time.Duration
+	max    time.Duration
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{stats: make(map[string]*latencyTotals)}
+}
+
+// Record registra un request; failed indica error de red o respuesta 5xx
+func (m *Metrics) Record(destination string, elapsed time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totals, ok := m.stats[destination]
+	if !ok {
+		totals = &latencyTotals{}
+		m.stats[destination] = totals
+	}
+	totals.count++
+	totals.total += elapsed
+	if elapsed > totals.max {
+		totals.max = elapsed
+	}
+	if failed {
+		totals.errors++
+	}
+}
+
+// Report retorna la latencia promedio y máxima por destino
+func (m *Metrics) Report() map[string]LatencyStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := make(map[string]LatencyStats)
+	for destination, totals := range m.stats {
+		report[destination] = LatencyStats{
+			Count:  totals.count,
+			Errors: totals.errors,
+			AvgMs:  float64(totals.total.Microseconds()) / 1000 / float64(totals.count),
+			MaxMs:  float64(totals.max.Microseconds()) / 1000,
+		}
+	}
+	return report
+}
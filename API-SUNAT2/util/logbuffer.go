@@ -0,0 +1,148 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultLogBufferSize es la cantidad de entradas retenidas en memoria por defecto
+const DefaultLogBufferSize = 10000
+
+// LogEntry es una entrada de log asociada a una operación
+type LogEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields"`
+}
+
+type bufferedEntry struct {
+	seq           uint64
+	correlationID string
+	entry         LogEntry
+}
+
+// LogBuffer es un ring buffer de las últimas entradas con correlationId, indexado
+// por correlationId. Se registra como hook de logrus.
+type LogBuffer struct {
+	mu      sync.RWMutex
+	entries []bufferedEntry
+	nextSeq uint64
+	index   map[string][]uint64
+}
+
+func NewLogBuffer(size int) *LogBuffer {
+	if size <= 0 {
+		size = DefaultLogBufferSize
+	}
+	return &LogBuffer{
+		entries: make([]bufferedEntry, size),
+		index:   make(map[string][]uint64),
+	}
+}
+
+func (b *LogBuffer) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire retiene la entrada si tiene correlationId, desplazando la más antigua si el buffer está lleno
+func (b *LogBuffer) Fire(e *logrus.Entry) error {
+	correlationID, _ := e.Data["correlationId"].(string)
+	if correlationID == "" {
+		return nil
+	}
+
+	fields := make(map[string]interface{}, len(e.Data))
+	for key, value := range e.Data {
+		if key != "correlationId" {
+			fields[key] = value
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slot := &b.entries[b.nextSeq%uint64(len(b.entries))]
+	if b.nextSeq >= uint64(len(b.entries)) {
+		// La entrada desplazada es siempre la más antigua de su correlationId
+		evicted := b.index[slot.correlationID][1:]
+		if len(evicted) == 0 {
+			delete(b.index, slot.correlationID)
+		} else {
+			b.index[slot.correlationID] = evicted
+		}
+	}
+
+	*slot = bufferedEntry{
+		seq:           b.nextSeq,
+		correlationID: correlationID,
+		entry: LogEntry{
+			Time:    e.Time,
+			Level:   e.Level.String(),
+			Message: e.Message,
+			Fields:  fields,
+		},
+	}
+	b.index[correlationID] = append(b.index[correlationID], b.nextSeq)
+	b.nextSeq++
+	return nil
+}
+
+// Get retorna en orden las entradas retenidas de la operación
+func (b *LogBuffer) Get(correlationID string) []LogEntry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	seqs := b.index[correlationID]
+	entries := make([]LogEntry, 0, len(seqs))
+	for _, seq := range seqs {
+		entries = append(entries, b.entries[seq%uint64(len(b.entries))].entry)
+	}
+	return entries
+}
+
+// SearchLogFile busca en un archivo de logs JSON (uno por línea) las entradas de una operación
+func SearchLogFile(path, correlationID string) ([]LogEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil {
+			continue
+		}
+		if fields["correlationId"] != correlationID {
+			continue
+		}
+
+		entry := LogEntry{Fields: make(map[string]interface{})}
+		for key, value := range fields {
+			switch key {
+			case "correlationId":
+			case logrus.FieldKeyTime:
+				if text, ok := value.(string); ok {
+					entry.Time, _ = time.Parse(time.RFC3339, text)
+				}
+			case logrus.FieldKeyLevel:
+				entry.Level, _ = value.(string)
+			case logrus.FieldKeyMsg:
+				entry.Message, _ = value.(string)
+			default:
+				entry.Fields[key] = value
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
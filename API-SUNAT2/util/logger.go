@@ -1,19 +1,56 @@
 package util
 
 import (
+	"io"
+	"os"
+
 	. "API-SUNAT2/model"
 	"github.com/sirupsen/logrus"
 )
 
 type LogService struct {
-	logger *logrus.Logger
+	logger  *logrus.Logger
+	buffer  *LogBuffer
+	logFile string
 }
 
 func NewLogService() *LogService {
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{})
 	logger.SetLevel(logrus.InfoLevel)
-	return &LogService{logger: logger}
+	buffer := NewLogBuffer(DefaultLogBufferSize)
+	logger.AddHook(buffer)
+	return &LogService{logger: logger, buffer: buffer}
+}
+
+// SetBufferSize reemplaza el buffer en memoria por uno vacío del tamaño indicado
+func (l *LogService) SetBufferSize(size int) {
+	l.buffer = NewLogBuffer(size)
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(l.buffer)
+	l.logger.ReplaceHooks(hooks)
+}
+
+// EnableFile agrega a la salida estándar un archivo de logs persistente, consultado
+// cuando las entradas de una operación ya salieron del buffer en memoria
+func (l *LogService) EnableFile(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.logger.SetOutput(io.MultiWriter(os.Stdout, file))
+	l.logFile = path
+	return nil
+}
+
+// GetEntries retorna en orden las entradas de log de una operación, buscando en el
+// archivo persistente si el buffer en memoria ya no las tiene
+func (l *LogService) GetEntries(correlationID string) ([]LogEntry, error) {
+	entries := l.buffer.Get(correlationID)
+	if len(entries) > 0 || l.logFile == "" {
+		return entries, nil
+	}
+	return SearchLogFile(l.logFile, correlationID)
 }
 
 func (l *LogService) LogOperation(log OperationLog) {
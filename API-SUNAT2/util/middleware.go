@@ -1,7 +1,9 @@
 package util
 
 import (
+	"crypto/subtle"
 	"fmt"
+	"net/http"
 	"time"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -51,6 +53,69 @@ func RequestIDMiddleware() gin.HandlerFunc {
 	}
 }
 
+// AdminAuthMiddleware exige la API key de administración en el header X-Admin-API-Key
+func AdminAuthMiddleware(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := c.GetHeader("X-Admin-API-Key")
+		if apiKey == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"status":       "error",
+				"errorCode":    "ERR_UNAUTHORIZED",
+				"errorMessage": "Invalid or missing admin API key",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AllowedIssuersKey es la clave del contexto con los RUC que puede consultar la API
+// key del request; nil si es la API key de administración, que puede consultar todos
+const AllowedIssuersKey = "AllowedIssuers"
+
+// IssuerAuthMiddleware exige la API key de administración (X-Admin-API-Key) o una API
+// key de emisor (X-API-Key). issuerKeys asocia cada API key de emisor con sus RUC.
+func IssuerAuthMiddleware(adminKey string, issuerKeys map[string][]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if provided := c.GetHeader("X-Admin-API-Key"); adminKey != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) == 1 {
+			c.Next()
+			return
+		}
+
+		provided := c.GetHeader("X-API-Key")
+		var allowed []string
+		for key, rucs := range issuerKeys {
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1 {
+				allowed = rucs
+			}
+		}
+		if provided == "" || allowed == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"status":       "error",
+				"errorCode":    "ERR_UNAUTHORIZED",
+				"errorMessage": "Invalid or missing API key",
+			})
+			return
+		}
+		c.Set(AllowedIssuersKey, allowed)
+		c.Next()
+	}
+}
+
+// IssuerAllowed indica si la API key del request puede consultar los documentos del RUC
+func IssuerAllowed(c *gin.Context, ruc string) bool {
+	value, ok := c.Get(AllowedIssuersKey)
+	if !ok {
+		return true
+	}
+	for _, allowed := range value.([]string) {
+		if allowed == ruc {
+			return true
+		}
+	}
+	return false
+}
+
 func generateCorrelationID() string {
 	return uuid.New().String()
 }
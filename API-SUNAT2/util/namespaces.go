@@ -0,0 +1,78 @@
+package util
+
+import "encoding/xml"
+
+// Namespaces de UBL 2.1 y XMLDSig. Al leer un XML los elementos se resuelven por
+// namespace y nombre local, sin depender del prefijo: otros proveedores usan
+// namespaces por defecto o prefijos como n1: o inv: en lugar de cac:/cbc:.
+const (
+	NamespaceInvoice             = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	NamespaceCreditNote          = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	NamespaceDebitNote           = "urn:oasis:names:specification:ubl:schema:xsd:DebitNote-2"
+	NamespaceApplicationResponse = "urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2"
+	NamespaceCAC                 = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	NamespaceCBC                 = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+	NamespaceExt                 = "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2"
+	NamespaceDS                  = "http://www.w3.org/2000/09/xmldsig#"
+)
+
+// conventionalPrefixes son los namespaces de los prefijos habituales, para los XML que
+// los usan sin declararlos (las facturas generadas por el servicio no declaran cac:,
+// cbc:, ext: ni ds:)
+var conventionalPrefixes = map[string]string{
+	"cac": NamespaceCAC,
+	"cbc": NamespaceCBC,
+	"ext": NamespaceExt,
+	"ds":  NamespaceDS,
+}
+
+// ResolveName completa el namespace de un nombre que el decoder dejó con un prefijo
+// habitual sin declarar; los demás nombres no cambian
+func ResolveName(name xml.Name) xml.Name {
+	if space, ok := conventionalPrefixes[name.Space]; ok {
+		name.Space = space
+	}
+	return name
+}
+
+// namespaceReader entrega los tokens del decoder con los nombres resueltos por ResolveName
+type namespaceReader struct {
+	decoder *xml.Decoder
+}
+
+func (r namespaceReader) Token() (xml.Token, error) {
+	token, err := r.decoder.Token()
+	switch t := token.(type) {
+	case xml.StartElement:
+		t.Name = ResolveName(t.Name)
+		return t, err
+	case xml.EndElement:
+		t.Name = ResolveName(t.Name)
+		return t, err
+	}
+	return token, err
+}
+
+// newNamespaceDecoder envuelve el decoder para que los elementos con prefijos habituales
+// sin declarar se resuelvan a su namespace
+func newNamespaceDecoder(decoder *xml.Decoder) *xml.Decoder {
+	return xml.NewTokenDecoder(namespaceReader{decoder: decoder})
+}
+
+// CAC, CBC, Ext y DS retornan el nombre completo de un elemento de cada namespace, para
+// compararlo con el Name de los tokens del decoder
+func CAC(local string) xml.Name { return xml.Name{Space: NamespaceCAC, Local: local} }
+func CBC(local string) xml.Name { return xml.Name{Space: NamespaceCBC, Local: local} }
+func Ext(local string) xml.Name { return xml.Name{Space: NamespaceExt, Local: local} }
+func DS(local string) xml.Name  { return xml.Name{Space: NamespaceDS, Local: local} }
+
+// IsUBLDocumentRoot indica si el elemento es la raíz de una factura, boleta o nota
+func IsUBLDocumentRoot(name xml.Name) bool {
+	switch name {
+	case xml.Name{Space: NamespaceInvoice, Local: "Invoice"},
+		xml.Name{Space: NamespaceCreditNote, Local: "CreditNote"},
+		xml.Name{Space: NamespaceDebitNote, Local: "DebitNote"}:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+var (
+	currencyNamesMu sync.RWMutex
+	// currencyNames es el nombre con que se lee cada moneda en el monto en letras
+	currencyNames = map[string]string{
+		"PEN": "SOLES",
+		"USD": "DÓLARES AMERICANOS",
+		"EUR": "EUROS",
+	}
+)
+
+// RegisterCurrencyName agrega o reemplaza el nombre de una moneda en el monto en letras
+func RegisterCurrencyName(currency, name string) {
+	currencyNamesMu.Lock()
+	defer currencyNamesMu.Unlock()
+	currencyNames[strings.ToUpper(currency)] = strings.ToUpper(name)
+}
+
+// CurrencyName retorna el nombre de la moneda en el monto en letras; una moneda sin
+// nombre registrado se lee con su código
+func CurrencyName(currency string) string {
+	currencyNamesMu.RLock()
+	defer currencyNamesMu.RUnlock()
+	if name, ok := currencyNames[strings.ToUpper(currency)]; ok {
+		return name
+	}
+	return strings.ToUpper(currency)
+}
+
+// AmountToWords expresa el monto en letras con los céntimos como fracción, como lo
+// pide la leyenda 1000: 1250.5 en PEN es "MIL DOSCIENTOS CINCUENTA CON 50/100 SOLES".
+// Los montos negativos se expresan por su valor absoluto.
+func AmountToWords(amount float64, currency string) string {
+	cents := int64(math.Round(math.Abs(amount) * 100))
+	words := IntegerToWords(cents / 100)
+	return fmt.Sprintf("%s CON %02d/100 %s", words, cents%100, CurrencyName(currency))
+}
+
+// IntegerToWords expresa un entero en letras, con millones y miles de millones
+// ("MIL DOSCIENTOS MILLONES")
+func IntegerToWords(n int64) string {
+	if n == 0 {
+		return "CERO"
+	}
+	return numberToWords(n, false)
+}
+
+// numberToWords expresa un entero positivo; los millones se leen en apócope ("VEINTIÚN MILLONES")
+func numberToWords(n int64, apocope bool) string {
+	if n < 1000000 {
+		return thousandsToWords(n, apocope)
+	}
+	millions, rest := n/1000000, n%1000000
+	words := "UN MILLÓN"
+	if millions > 1 {
+		words = numberToWords(millions, true) + " MILLONES"
+	}
+	if rest > 0 {
+		words += " " + thousandsToWords(rest, apocope)
+	}
+	return words
+}
+
+// thousandsToWords expresa un número menor a un millón; apocope usa "UN" y "VEINTIÚN"
+// en lugar de "UNO" y "VEINTIUNO" al final, cuando al número le sigue un sustantivo
+func thousandsToWords(n int64, apocope bool) string {
+	thousands, rest := n/1000, n%1000
+	var parts []string
+	switch {
+	case thousands == 1:
+		parts = append(parts, "MIL")
+	case thousands > 1:
+		parts = append(parts, hundredsToWords(thousands, true)+" MIL")
+	}
+	if rest > 0 {
+		parts = append(parts, hundredsToWords(rest, apocope))
+	}
+	return strings.Join(parts, " ")
+}
+
+var (
+	unitWords = []string{"", "UNO", "DOS", "TRES", "CUATRO", "CINCO", "SEIS", "SIETE", "OCHO", "NUEVE",
+		"DIEZ", "ONCE", "DOCE", "TRECE", "CATORCE", "QUINCE", "DIECISÉIS", "DIECISIETE", "DIECIOCHO", "DIECINUEVE",
+		"VEINTE", "VEINTIUNO", "VEINTIDÓS", "VEINTITRÉS", "VEINTICUATRO", "VEINTICINCO", "VEINTISÉIS", "VEINTISIETE", "VEINTIOCHO", "VEINTINUEVE"}
+	tenWords     = []string{"", "", "", "TREINTA", "CUARENTA", "CINCUENTA", "SESENTA", "SETENTA", "OCHENTA", "NOVENTA"}
+	hundredWords = []string{"", "CIENTO", "DOSCIENTOS", "TRESCIENTOS", "CUATROCIENTOS", "QUINIENTOS", "SEISCIENTOS", "SETECIENTOS", "OCHOCIENTOS", "NOVECIENTOS"}
+)
+
+// hundredsToWords expresa un número menor a mil; "CIEN" solo es el cien exacto
+func hundredsToWords(n int64, apocope bool) string {
+	if n == 100 {
+		return "CIEN"
+	}
+	var parts []string
+	if n >= 100 {
+		parts = append(parts, hundredWords[n/100])
+	}
+	if rest := n % 100; rest > 0 {
+		parts = append(parts, tensToWords(rest, apocope))
+	}
+	return strings.Join(parts, " ")
+}
+
+// tensToWords expresa un número entre 1 y 99
+func tensToWords(n int64, apocope bool) string {
+	var words string
+	if n < 30 {
+		words = unitWords[n]
+	} else if words = tenWords[n/10]; n%10 > 0 {
+		words += " Y " + unitWords[n%10]
+	}
+	if apocope {
+		switch {
+		case n == 21:
+			return "VEINTIÚN"
+		case n%10 == 1 && n != 11:
+			return strings.TrimSuffix(words, "UNO") + "UN"
+		}
+	}
+	return words
+}
+
+// accentReplacer quita las tildes y la diéresis; la Ñ se conserva
+var accentReplacer = strings.NewReplacer("Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U",
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u")
+
+// RemoveAccents quita las tildes del texto, para receptores que comparan sin ellas
+func RemoveAccents(text string) string {
+	return accentReplacer.Replace(text)
+}
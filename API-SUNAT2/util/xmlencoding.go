@@ -0,0 +1,188 @@
+package util
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Codificaciones de salida del XML generado
+const (
+	XMLEncodingUTF8    = "utf8"
+	XMLEncodingUTF8BOM = "utf8-bom"
+	XMLEncodingLatin1  = "iso-8859-1"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+var xmlDeclaration = regexp.MustCompile(`^<\?xml\s[^>]*\?>`)
+var declaredEncoding = regexp.MustCompile(`encoding="[^"]*"`)
+
+// Fines de línea del XML firmado
+const (
+	XMLLineEndingLF   = "lf"
+	XMLLineEndingCRLF = "crlf"
+)
+
+// XMLFormat es la forma de los bytes del XML firmado: el fin de línea ("" equivale a LF)
+// y si se omite la declaración <?xml ...?>
+type XMLFormat struct {
+	LineEnding      string
+	OmitDeclaration bool
+}
+
+// IsValidXMLLineEnding indica si el fin de línea de salida es conocido
+func IsValidXMLLineEnding(lineEnding string) bool {
+	return lineEnding == XMLLineEndingLF || lineEnding == XMLLineEndingCRLF
+}
+
+// IsValidXMLEncoding indica si la codificación de salida es conocida
+func IsValidXMLEncoding(encoding string) bool {
+	switch encoding {
+	case XMLEncodingUTF8, XMLEncodingUTF8BOM, XMLEncodingLatin1:
+		return true
+	}
+	return false
+}
+
+// UnrepresentableCharError indica un carácter del XML que no existe en la codificación de salida
+type UnrepresentableCharError struct {
+	Char     rune
+	Element  string
+	Encoding string
+}
+
+func (e *UnrepresentableCharError) Error() string {
+	return fmt.Sprintf("character %q (U+%04X) in <%s> cannot be represented in %s", e.Char, e.Char, e.Element, e.Encoding)
+}
+
+// EncodeXML recibe el XML en UTF-8 y retorna los bytes finales en la codificación
+// indicada, con la declaración encoding que les corresponde
+func EncodeXML(xmlData []byte, encoding string) ([]byte, error) {
+	body := bytes.TrimPrefix(xmlData, utf8BOM)
+	switch encoding {
+	case "", XMLEncodingUTF8:
+		return declareEncoding(body, "UTF-8"), nil
+	case XMLEncodingUTF8BOM:
+		return append(append([]byte{}, utf8BOM...), declareEncoding(body, "UTF-8")...), nil
+	case XMLEncodingLatin1:
+		body = declareEncoding(body, "ISO-8859-1")
+		for offset, r := range string(body) {
+			if r > 0xFF {
+				return nil, &UnrepresentableCharError{Char: r, Element: enclosingElement(body[:offset]), Encoding: "ISO-8859-1"}
+			}
+		}
+		return charmap.ISO8859_1.NewEncoder().Bytes(body)
+	default:
+		return nil, fmt.Errorf("unknown XML encoding %q", encoding)
+	}
+}
+
+// declareEncoding reemplaza (o agrega) el atributo encoding de la declaración XML
+func declareEncoding(xmlData []byte, name string) []byte {
+	attr := []byte(`encoding="` + name + `"`)
+	declaration := xmlDeclaration.Find(xmlData)
+	if declaration == nil {
+		return append([]byte(`<?xml version="1.0" `+string(attr)+"?>\n"), xmlData...)
+	}
+	var updated []byte
+	if declaredEncoding.Match(declaration) {
+		updated = declaredEncoding.ReplaceAll(declaration, attr)
+	} else {
+		updated = append([]byte{}, bytes.TrimSuffix(declaration, []byte("?>"))...)
+		updated = append(updated, " "+string(attr)+"?>"...)
+	}
+	return append(updated, xmlData[len(declaration):]...)
+}
+
+// NormalizeXML deja el XML con una sola declaración al inicio (la primera, si el XML
+// trae varias), los fines de línea unificados y sin saltos ni espacios al final del
+// archivo. El BOM se conserva. Con OmitDeclaration la declaración se quita, salvo que
+// declare una codificación distinta de UTF-8, sin la cual el XML no se podría leer.
+func NormalizeXML(xmlData []byte, format XMLFormat) []byte {
+	body := bytes.TrimPrefix(xmlData, utf8BOM)
+	hasBOM := len(body) < len(xmlData)
+	body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	body = bytes.ReplaceAll(body, []byte("\r"), []byte("\n"))
+
+	var declaration []byte
+	for {
+		body = bytes.TrimLeft(body, " \t\n")
+		found := xmlDeclaration.Find(body)
+		if found == nil {
+			break
+		}
+		if declaration == nil {
+			declaration = found
+		}
+		body = body[len(found):]
+	}
+	if declaration == nil {
+		declaration = []byte(strings.TrimSuffix(xml.Header, "\n"))
+	}
+	if format.OmitDeclaration && !declaresOtherEncoding(declaration) {
+		declaration = nil
+	}
+
+	var normalized []byte
+	if hasBOM {
+		normalized = append(normalized, utf8BOM...)
+	}
+	if declaration != nil {
+		normalized = append(append(normalized, declaration...), '\n')
+	}
+	normalized = append(normalized, bytes.TrimRight(body, " \t\n")...)
+	if format.LineEnding == XMLLineEndingCRLF {
+		normalized = bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+	}
+	return normalized
+}
+
+// declaresOtherEncoding indica si la declaración XML indica una codificación distinta de UTF-8
+func declaresOtherEncoding(declaration []byte) bool {
+	attr := declaredEncoding.Find(declaration)
+	if attr == nil {
+		return false
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(string(attr), `encoding="`), `"`)
+	return !strings.EqualFold(name, "UTF-8")
+}
+
+// enclosingElement retorna el nombre del último elemento abierto antes de un offset
+func enclosingElement(before []byte) string {
+	start := bytes.LastIndexByte(before, '<')
+	if start == -1 {
+		return ""
+	}
+	name := before[start+1:]
+	if end := bytes.IndexAny(name, " >/"); end != -1 {
+		name = name[:end]
+	}
+	return string(name)
+}
+
+// NewXMLDecoder crea un decoder que admite los XML generados en cualquiera de las
+// codificaciones de salida (UTF-8 con o sin BOM e ISO-8859-1). Los nombres de los
+// elementos quedan con su namespace, cualquiera sea el prefijo usado (ver ResolveName).
+func NewXMLDecoder(r io.Reader) *xml.Decoder {
+	return newNamespaceDecoder(NewRawXMLDecoder(r))
+}
+
+// NewRawXMLDecoder crea un decoder con las mismas codificaciones que NewXMLDecoder pero
+// sin resolver los prefijos, para leer los tokens tal como están escritos con RawToken
+func NewRawXMLDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		switch strings.ToUpper(label) {
+		case "ISO-8859-1", "ISO8859-1", "LATIN1":
+			return charmap.ISO8859_1.NewDecoder().Reader(input), nil
+		}
+		return nil, fmt.Errorf("unsupported XML charset %q", label)
+	}
+	return decoder
+}
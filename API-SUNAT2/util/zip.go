@@ -2,10 +2,13 @@ package util
 
 import (
 	"archive/zip"
+	"bytes"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Empaqueta un archivo XML en un ZIP con el mismo nombre base
@@ -49,4 +52,49 @@ func ZipXMLFile(xmlPath string) (string, error) {
 
 	log.Printf("DEBUG: ZIP creado exitosamente en: %s", zipPath)
 	return zipPath, nil
-} 
\ No newline at end of file
+} 
+
+// ZipXMLBytes empaqueta el contenido XML en un ZIP en memoria con una sola entrada
+func ZipXMLBytes(xmlName string, xmlData []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+
+	writer, err := zipWriter.Create(xmlName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(xmlData); err != nil {
+		return nil, err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnzipXMLBytes retorna el nombre y contenido del primer XML de un ZIP en memoria
+func UnzipXMLBytes(zipData []byte) (string, []byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, file := range reader.File {
+		if !strings.EqualFold(filepath.Ext(file.Name), ".xml") {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return "", nil, err
+		}
+		return file.Name, data, nil
+	}
+
+	return "", nil, fmt.Errorf("zip does not contain an XML file")
+}
@@ -0,0 +1,13 @@
+// Package version expone la versión del binario. Se fija al compilar:
+//
+//	go build -ldflags "-X API-SUNAT2/version.Version=1.4.0 \
+//	  -X API-SUNAT2/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X API-SUNAT2/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+// Valores fijados con -ldflags; sin ellos el binario se identifica como dev
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)